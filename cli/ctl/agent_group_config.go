@@ -19,6 +19,7 @@ package ctl
 import (
 	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/spf13/cobra"
 
@@ -31,7 +32,7 @@ func RegisterAgentGroupConfigCommand() *cobra.Command {
 		Use:   "agent-group-config",
 		Short: "agent-group config operation commands",
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Printf("please run with 'example | list | create | update | delete'.\n")
+			fmt.Printf("please run with 'example | list | create | update | delete | history | diff | rollback | rollout'.\n")
 		},
 	}
 
@@ -79,6 +80,33 @@ func RegisterAgentGroupConfigCommand() *cobra.Command {
 		},
 	}
 
+	history := &cobra.Command{
+		Use:     "history <agent-group ID>",
+		Short:   "list agent-group config revisions",
+		Example: "deepflow-ctl agent-group-config history g-xxxxxx",
+		Run: func(cmd *cobra.Command, args []string) {
+			historyAgentGroupConfig(cmd, args)
+		},
+	}
+
+	diff := &cobra.Command{
+		Use:     "diff <agent-group ID> <revision> [base revision]",
+		Short:   "diff agent-group config revisions, compare with the previous revision by default",
+		Example: "deepflow-ctl agent-group-config diff g-xxxxxx 3\ndeepflow-ctl agent-group-config diff g-xxxxxx 3 1",
+		Run: func(cmd *cobra.Command, args []string) {
+			diffAgentGroupConfig(cmd, args)
+		},
+	}
+
+	rollback := &cobra.Command{
+		Use:     "rollback <agent-group ID> <revision>",
+		Short:   "rollback agent-group config to the specified revision",
+		Example: "deepflow-ctl agent-group-config rollback g-xxxxxx 2",
+		Run: func(cmd *cobra.Command, args []string) {
+			rollbackAgentGroupConfig(cmd, args)
+		},
+	}
+
 	example := &cobra.Command{
 		Use:   "example",
 		Short: "example agent-group config",
@@ -91,6 +119,10 @@ func RegisterAgentGroupConfigCommand() *cobra.Command {
 	agentGroupConfig.AddCommand(create)
 	agentGroupConfig.AddCommand(update)
 	agentGroupConfig.AddCommand(delete)
+	agentGroupConfig.AddCommand(history)
+	agentGroupConfig.AddCommand(diff)
+	agentGroupConfig.AddCommand(rollback)
+	agentGroupConfig.AddCommand(registerAgentGroupConfigRolloutCommand())
 	return agentGroupConfig
 }
 
@@ -291,3 +323,91 @@ func deleteAgentGroupConfig(cmd *cobra.Command, args []string) {
 		return
 	}
 }
+
+func historyAgentGroupConfig(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "must specify agent-group ID.\nExample: %s\n", cmd.Example)
+		return
+	}
+	server := common.GetServerInfo(cmd)
+
+	agentGroupLcuuid, err := getAgentGroupLcuuid(cmd, server, args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	url := fmt.Sprintf("http://%s:%d/v1/agent-group-configuration/%s/revisions", server.IP, server.Port, agentGroupLcuuid)
+	response, err := common.CURLPerform("GET", url, nil, "",
+		[]common.HTTPOption{common.WithTimeout(common.GetTimeout(cmd)), common.WithORGID(common.GetORGID(cmd))}...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	t := table.New()
+	t.SetHeader([]string{"REVISION", "OPERATION", "SOURCE_REVISION", "USER_ID", "CREATED_AT"})
+	tableItems := [][]string{}
+	for i := range response.Get("DATA").MustArray() {
+		revision := response.Get("DATA").GetIndex(i)
+		sourceRevision := ""
+		if source := revision.Get("SOURCE_REVISION").MustInt(); source > 0 {
+			sourceRevision = strconv.Itoa(source)
+		}
+		tableItems = append(tableItems, []string{
+			strconv.Itoa(revision.Get("REVISION").MustInt()),
+			revision.Get("OPERATION").MustString(),
+			sourceRevision,
+			strconv.Itoa(revision.Get("USER_ID").MustInt()),
+			revision.Get("CREATED_AT").MustString(),
+		})
+	}
+	t.AppendBulk(tableItems)
+	t.Render()
+}
+
+func diffAgentGroupConfig(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		fmt.Fprintf(os.Stderr, "must specify agent-group ID and revision.\nExample: %s\n", cmd.Example)
+		return
+	}
+	server := common.GetServerInfo(cmd)
+
+	agentGroupLcuuid, err := getAgentGroupLcuuid(cmd, server, args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	url := fmt.Sprintf("http://%s:%d/v1/agent-group-configuration/%s/revisions/%s/diff", server.IP, server.Port, agentGroupLcuuid, args[1])
+	if len(args) > 2 {
+		url += "?base=" + args[2]
+	}
+	response, err := common.CURLPerform("GET", url, nil, "",
+		[]common.HTTPOption{common.WithTimeout(common.GetTimeout(cmd)), common.WithORGID(common.GetORGID(cmd))}...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	fmt.Print(response.Get("DATA").MustString())
+}
+
+func rollbackAgentGroupConfig(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		fmt.Fprintf(os.Stderr, "must specify agent-group ID and revision.\nExample: %s\n", cmd.Example)
+		return
+	}
+	server := common.GetServerInfo(cmd)
+
+	agentGroupLcuuid, err := getAgentGroupLcuuid(cmd, server, args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	url := fmt.Sprintf("http://%s:%d/v1/agent-group-configuration/%s/revisions/%s/rollback", server.IP, server.Port, agentGroupLcuuid, args[1])
+	_, err = common.CURLPerform("POST", url, nil, "",
+		[]common.HTTPOption{common.WithTimeout(common.GetTimeout(cmd)), common.WithORGID(common.GetORGID(cmd))}...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	fmt.Printf("agent-group (%s) config rolled back to revision %s\n", args[0], args[1])
+}
@@ -0,0 +1,252 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ctl
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/deepflowio/deepflow/cli/ctl/common"
+	"github.com/deepflowio/deepflow/cli/ctl/common/table"
+)
+
+func registerAgentGroupConfigRolloutCommand() *cobra.Command {
+	rollout := &cobra.Command{
+		Use:   "rollout",
+		Short: "agent-group config canary rollout commands",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Printf("please run with 'start | list | show | promote | abort'.\n")
+		},
+	}
+
+	var (
+		startFilename  string
+		percentage     int
+		agentNames     string
+		observeSeconds int
+		maxCPURatio    float64
+		maxMemoryRatio float64
+	)
+	start := &cobra.Command{
+		Use:   "start <agent-group ID> -f <filename> (--percentage <1-100> | --agents <agent names>)",
+		Short: "deliver the config to part of the agents first, promote it automatically if they stay healthy",
+		Example: "deepflow-ctl agent-group-config rollout start g-xxxxxx -f deepflow-config.yaml --percentage 10\n" +
+			"deepflow-ctl agent-group-config rollout start g-xxxxxx -f deepflow-config.yaml --agents agent-1,agent-2 --observe-seconds 1800",
+		Run: func(cmd *cobra.Command, args []string) {
+			body := map[string]interface{}{
+				"PERCENTAGE":       percentage,
+				"OBSERVE_SECONDS":  observeSeconds,
+				"MAX_CPU_RATIO":    maxCPURatio,
+				"MAX_MEMORY_RATIO": maxMemoryRatio,
+			}
+			if agentNames != "" {
+				body["AGENT_NAMES"] = strings.Split(agentNames, ",")
+			}
+			startAgentGroupConfigRollout(cmd, args, startFilename, body)
+		},
+	}
+	start.Flags().StringVarP(&startFilename, "filename", "f", "", "file of the agent-group config to rollout")
+	start.Flags().IntVarP(&percentage, "percentage", "p", 0, "percentage of agents in the group to rollout first")
+	start.Flags().StringVarP(&agentNames, "agents", "a", "", "agent names to rollout first, separated by ','")
+	start.Flags().IntVarP(&observeSeconds, "observe-seconds", "", 0, "how long the canary agents must stay healthy before promotion, default 600")
+	start.Flags().Float64VarP(&maxCPURatio, "max-cpu-ratio", "", 0, "unhealthy if cpu usage / max_millicpus exceeds it, default 1")
+	start.Flags().Float64VarP(&maxMemoryRatio, "max-memory-ratio", "", 0, "unhealthy if memory usage / max_memory exceeds it, default 0.9")
+	start.MarkFlagRequired("filename")
+
+	list := &cobra.Command{
+		Use:     "list <agent-group ID>",
+		Short:   "list agent-group config rollouts",
+		Example: "deepflow-ctl agent-group-config rollout list g-xxxxxx",
+		Run: func(cmd *cobra.Command, args []string) {
+			listAgentGroupConfigRollouts(cmd, args)
+		},
+	}
+
+	show := &cobra.Command{
+		Use:     "show <agent-group ID> <rollout ID>",
+		Short:   "show agent-group config rollout status of each agent",
+		Example: "deepflow-ctl agent-group-config rollout show g-xxxxxx 7d1f0b6e-xxxx",
+		Run: func(cmd *cobra.Command, args []string) {
+			showAgentGroupConfigRollout(cmd, args)
+		},
+	}
+
+	promote := &cobra.Command{
+		Use:     "promote <agent-group ID> <rollout ID>",
+		Short:   "deliver the canary config to all agents in the group now",
+		Example: "deepflow-ctl agent-group-config rollout promote g-xxxxxx 7d1f0b6e-xxxx",
+		Run: func(cmd *cobra.Command, args []string) {
+			finishAgentGroupConfigRollout(cmd, args, "promote")
+		},
+	}
+
+	abort := &cobra.Command{
+		Use:     "abort <agent-group ID> <rollout ID>",
+		Short:   "roll back the canary agents to the agent-group config",
+		Example: "deepflow-ctl agent-group-config rollout abort g-xxxxxx 7d1f0b6e-xxxx",
+		Run: func(cmd *cobra.Command, args []string) {
+			finishAgentGroupConfigRollout(cmd, args, "rollback")
+		},
+	}
+
+	rollout.AddCommand(start)
+	rollout.AddCommand(list)
+	rollout.AddCommand(show)
+	rollout.AddCommand(promote)
+	rollout.AddCommand(abort)
+	return rollout
+}
+
+func getAgentGroupConfigRolloutURL(cmd *cobra.Command, server *common.Server, shortUUID string) (string, error) {
+	agentGroupLcuuid, err := getAgentGroupLcuuid(cmd, server, shortUUID)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("http://%s:%d/v1/agent-group-configuration/%s/rollouts", server.IP, server.Port, agentGroupLcuuid), nil
+}
+
+func startAgentGroupConfigRollout(cmd *cobra.Command, args []string, filename string, body map[string]interface{}) {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "must specify agent-group ID.\nExample: %s\n", cmd.Example)
+		return
+	}
+	yamlFile, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	body["YAML"] = string(yamlFile)
+
+	server := common.GetServerInfo(cmd)
+	url, err := getAgentGroupConfigRolloutURL(cmd, server, args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	response, err := common.CURLPerform("POST", url, body, "",
+		[]common.HTTPOption{common.WithTimeout(common.GetTimeout(cmd)), common.WithORGID(common.GetORGID(cmd))}...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	data := response.Get("DATA")
+	fmt.Printf("rollout %s started, revision %d delivered to %d agents\n",
+		data.Get("LCUUID").MustString(), data.Get("REVISION").MustInt(), len(data.Get("AGENTS").MustArray()))
+}
+
+func listAgentGroupConfigRollouts(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "must specify agent-group ID.\nExample: %s\n", cmd.Example)
+		return
+	}
+	server := common.GetServerInfo(cmd)
+	url, err := getAgentGroupConfigRolloutURL(cmd, server, args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	response, err := common.CURLPerform("GET", url, nil, "",
+		[]common.HTTPOption{common.WithTimeout(common.GetTimeout(cmd)), common.WithORGID(common.GetORGID(cmd))}...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	t := table.New()
+	t.SetHeader([]string{"ID", "REVISION", "BASE_REVISION", "STATE", "CREATED_AT", "MESSAGE"})
+	tableItems := [][]string{}
+	for i := range response.Get("DATA").MustArray() {
+		rollout := response.Get("DATA").GetIndex(i)
+		tableItems = append(tableItems, []string{
+			rollout.Get("LCUUID").MustString(),
+			strconv.Itoa(rollout.Get("REVISION").MustInt()),
+			strconv.Itoa(rollout.Get("BASE_REVISION").MustInt()),
+			rollout.Get("STATE").MustString(),
+			rollout.Get("CREATED_AT").MustString(),
+			rollout.Get("MESSAGE").MustString(),
+		})
+	}
+	t.AppendBulk(tableItems)
+	t.Render()
+}
+
+func showAgentGroupConfigRollout(cmd *cobra.Command, args []string) {
+	if len(args) < 2 {
+		fmt.Fprintf(os.Stderr, "must specify agent-group ID and rollout ID.\nExample: %s\n", cmd.Example)
+		return
+	}
+	server := common.GetServerInfo(cmd)
+	url, err := getAgentGroupConfigRolloutURL(cmd, server, args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	response, err := common.CURLPerform("GET", url+"/"+args[1], nil, "",
+		[]common.HTTPOption{common.WithTimeout(common.GetTimeout(cmd)), common.WithORGID(common.GetORGID(cmd))}...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	data := response.Get("DATA")
+	fmt.Printf("revision: %d (base %d), state: %s, observe: %ds, max cpu ratio: %.2f, max memory ratio: %.2f\n",
+		data.Get("REVISION").MustInt(), data.Get("BASE_REVISION").MustInt(), data.Get("STATE").MustString(),
+		data.Get("OBSERVE_SECONDS").MustInt(), data.Get("MAX_CPU_RATIO").MustFloat64(), data.Get("MAX_MEMORY_RATIO").MustFloat64())
+	if message := data.Get("MESSAGE").MustString(); message != "" {
+		fmt.Printf("message: %s\n", message)
+	}
+
+	t := table.New()
+	t.SetHeader([]string{"AGENT", "STATE", "CPU_RATIO", "MEMORY_RATIO", "UPDATED_AT", "MESSAGE"})
+	tableItems := [][]string{}
+	for i := range data.Get("AGENTS").MustArray() {
+		agent := data.Get("AGENTS").GetIndex(i)
+		tableItems = append(tableItems, []string{
+			agent.Get("VTAP_NAME").MustString(),
+			agent.Get("STATE").MustString(),
+			fmt.Sprintf("%.2f", agent.Get("CPU_RATIO").MustFloat64()),
+			fmt.Sprintf("%.2f", agent.Get("MEMORY_RATIO").MustFloat64()),
+			agent.Get("UPDATED_AT").MustString(),
+			agent.Get("MESSAGE").MustString(),
+		})
+	}
+	t.AppendBulk(tableItems)
+	t.Render()
+}
+
+func finishAgentGroupConfigRollout(cmd *cobra.Command, args []string, action string) {
+	if len(args) < 2 {
+		fmt.Fprintf(os.Stderr, "must specify agent-group ID and rollout ID.\nExample: %s\n", cmd.Example)
+		return
+	}
+	server := common.GetServerInfo(cmd)
+	url, err := getAgentGroupConfigRolloutURL(cmd, server, args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	_, err = common.CURLPerform("POST", fmt.Sprintf("%s/%s/%s", url, args[1], action), nil, "",
+		[]common.HTTPOption{common.WithTimeout(common.GetTimeout(cmd)), common.WithORGID(common.GetORGID(cmd))}...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	fmt.Printf("rollout %s %s done\n", args[1], action)
+}
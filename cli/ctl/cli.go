@@ -34,6 +34,10 @@ func Execute(version string) {
 		Use:              "deepflow-ctl",
 		Short:            "deepflow server tool",
 		TraverseChildren: true,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			token, _ := cmd.Flags().GetString("token")
+			common.SetToken(token)
+		},
 	}
 
 	var outputVersion bool
@@ -44,6 +48,7 @@ func Execute(version string) {
 	root.PersistentFlags().Uint32P("svc-port", "", 20417, "deepflow-server service http port")
 	root.PersistentFlags().Uint32P("org-id", "", common.DEFAULT_ORG_ID, "organization id")
 	root.PersistentFlags().DurationP("timeout", "", time.Second*30, "deepflow-ctl timeout")
+	root.PersistentFlags().String("token", os.Getenv("DEEPFLOW_TOKEN"), "deepflow-server api token, required when auth is enabled, default: env DEEPFLOW_TOKEN")
 	root.ParseFlags(os.Args[1:])
 
 	// support output version
@@ -36,10 +36,24 @@ import (
 )
 
 const (
-	HEADER_KEY_X_ORG_ID = "X-Org-Id"
-	DEFAULT_ORG_ID      = 1
+	HEADER_KEY_X_ORG_ID      = "X-Org-Id"
+	HEADER_KEY_AUTHORIZATION = "Authorization"
+	DEFAULT_ORG_ID           = 1
 )
 
+// deepflow-server 开启认证时使用的 API token，由 --token 参数或 DEEPFLOW_TOKEN 环境变量指定
+var authToken string
+
+func SetToken(token string) {
+	authToken = token
+}
+
+func setAuthorization(req *http.Request) {
+	if authToken != "" {
+		req.Header.Set(HEADER_KEY_AUTHORIZATION, "Bearer "+authToken)
+	}
+}
+
 // Filter query string parameters
 type Filter map[string]interface{}
 
@@ -93,6 +107,7 @@ func CURLPerform(method string, url string, body map[string]interface{}, strBody
 	req.Header.Set("Accept", "application/json, text/plain")
 	req.Header.Set("X-User-Id", "1")
 	req.Header.Set("X-User-Type", "1")
+	setAuthorization(req)
 
 	return parseResponse(req, cfg)
 }
@@ -145,6 +160,7 @@ func CURLPostFormData(url, contentType string, body *bytes.Buffer, opts ...HTTPO
 	req.Header.Set("Accept", "application/json, text/plain")
 	req.Header.Set("X-User-Id", "1")
 	req.Header.Set("X-User-Type", "1")
+	setAuthorization(req)
 	req.Close = true
 
 	return parseResponse(req, cfg)
@@ -173,6 +189,7 @@ func CURLResponseRawJson(method string, url string, opts ...HTTPOption) (*simple
 	req.Header.Set("Accept", "application/json, text/plain")
 	req.Header.Set("X-User-Id", "1")
 	req.Header.Set("X-User-Type", "1")
+	setAuthorization(req)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -87,7 +87,7 @@ func RegisterDomainCommand() *cobra.Command {
 		Use:     "example domain_type",
 		Short:   "example domain create yaml",
 		Long:    "supported types: " + strings.Trim(fmt.Sprint(common.DomainTypes), "[]"),
-		Example: "deepflow-ctl domain example agent_sync \nsupport example type: aliyun | aws | baidu_bce | filereader | agent_sync | \nhuawei | kubernetes | qingcloud | tencent | volcengine",
+		Example: "deepflow-ctl domain example agent_sync \nsupport example type: aliyun | aws | azure | baidu_bce | filereader | agent_sync | \ngcp | huawei | kubernetes | openstack | qingcloud | tencent | volcengine | vsphere",
 		Run: func(cmd *cobra.Command, args []string) {
 			exampleDomainConfig(cmd, args)
 		},
@@ -312,6 +312,14 @@ func exampleDomainConfig(cmd *cobra.Command, args []string) {
 		fmt.Printf(string(example.YamlDomainFileReader))
 	case common.DOMAIN_TYPE_VOLCENGINE:
 		fmt.Printf(string(example.YamlDomainVolcengine))
+	case common.DOMAIN_TYPE_OPENSTACK:
+		fmt.Printf(string(example.YamlDomainOpenStack))
+	case common.DOMAIN_TYPE_VSPHERE:
+		fmt.Printf(string(example.YamlDomainVSphere))
+	case common.DOMAIN_TYPE_AZURE:
+		fmt.Printf(string(example.YamlDomainAzure))
+	case common.DOMAIN_TYPE_GCP:
+		fmt.Printf(string(example.YamlDomainGCP))
 	default:
 		err := fmt.Sprintf("domain_type %s not supported\n", args[0])
 		fmt.Fprintln(os.Stderr, err)
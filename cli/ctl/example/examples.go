@@ -24,12 +24,18 @@ var YamlDomainAliYun []byte
 //go:embed domain_aws.yaml
 var YamlDomainAws []byte
 
+//go:embed domain_azure.yaml
+var YamlDomainAzure []byte
+
 //go:embed domain_baidubce.yaml
 var YamlDomainBaiduBce []byte
 
 //go:embed domain_filereader.yaml
 var YamlDomainFileReader []byte
 
+//go:embed domain_gcp.yaml
+var YamlDomainGCP []byte
+
 //go:embed domain_genesis.yaml
 var YamlDomainGenesis []byte
 
@@ -39,6 +45,9 @@ var YamlDomainHuawei []byte
 //go:embed domain_kubernetes.yaml
 var YamlDomainKubernetes []byte
 
+//go:embed domain_openstack.yaml
+var YamlDomainOpenStack []byte
+
 //go:embed domain_qingcloud.yaml
 var YamlDomainQingCloud []byte
 
@@ -48,6 +57,9 @@ var YamlDomainTencent []byte
 //go:embed domain_volcengine.yaml
 var YamlDomainVolcengine []byte
 
+//go:embed domain_vsphere.yaml
+var YamlDomainVSphere []byte
+
 //go:embed sub_domain_create.yaml
 var YamlSubDomain []byte
 
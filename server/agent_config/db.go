@@ -16,7 +16,11 @@
 
 package agent_config
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type MySQLAgentGroupConfiguration struct {
 	ID               int       `gorm:"primaryKey;column:id;type:int;not null" json:"ID"`
@@ -31,6 +35,100 @@ func (MySQLAgentGroupConfiguration) TableName() string {
 	return "agent_group_configuration"
 }
 
+const (
+	REVISION_OPERATION_CREATE   = "create"
+	REVISION_OPERATION_UPDATE   = "update"
+	REVISION_OPERATION_ROLLBACK = "rollback"
+	REVISION_OPERATION_CANARY   = "canary"  // 灰度发布的配置，仅下发给灰度采集器
+	REVISION_OPERATION_PROMOTE  = "promote" // 灰度发布完成，配置下发给采集器组内的全部采集器
+)
+
+// 采集器组配置的每次变更都会保存为一个版本，revision 在同一采集器组内从 1 开始递增
+type MySQLAgentGroupConfigurationRevision struct {
+	ID               int       `gorm:"primaryKey;column:id;type:int;not null" json:"ID"`
+	AgentGroupLcuuid string    `gorm:"column:agent_group_lcuuid;type:char(64);default:not null" json:"AGENT_GROUP_LCUUID"`
+	Revision         int       `gorm:"column:revision;type:int;not null" json:"REVISION"`
+	Yaml             string    `gorm:"column:yaml;type:text;default:not null" json:"YAML,omitempty"`
+	Operation        string    `gorm:"column:operation;type:char(16);not null" json:"OPERATION"`
+	SourceRevision   int       `gorm:"column:source_revision;type:int;default:0" json:"SOURCE_REVISION"` // 回滚时对应的目标版本
+	UserID           int       `gorm:"column:user_id;type:int;default:0" json:"USER_ID"`
+	CreatedAt        time.Time `gorm:"column:created_at;type:timestamp;not null;default:CURRENT_TIMESTAMP" json:"CREATED_AT"`
+}
+
+func (MySQLAgentGroupConfigurationRevision) TableName() string {
+	return "agent_group_configuration_revision"
+}
+
+const (
+	ROLLOUT_STATE_RUNNING     = "running"
+	ROLLOUT_STATE_PROMOTED    = "promoted"
+	ROLLOUT_STATE_ROLLED_BACK = "rolled_back"
+
+	ROLLOUT_AGENT_STATE_PENDING   = "pending"
+	ROLLOUT_AGENT_STATE_HEALTHY   = "healthy"
+	ROLLOUT_AGENT_STATE_UNHEALTHY = "unhealthy"
+	ROLLOUT_AGENT_STATE_UNKNOWN   = "unknown" // 监控数据查询失败，无法判断
+)
+
+// 采集器组配置灰度发布，running 状态时 revision 对应的配置仅下发给灰度采集器
+type MySQLAgentGroupConfigurationRollout struct {
+	ID               int       `gorm:"primaryKey;column:id;type:int;not null" json:"ID"`
+	Lcuuid           string    `gorm:"column:lcuuid;type:char(64);default:not null" json:"LCUUID"`
+	AgentGroupLcuuid string    `gorm:"column:agent_group_lcuuid;type:char(64);default:not null" json:"AGENT_GROUP_LCUUID"`
+	Revision         int       `gorm:"column:revision;type:int;not null" json:"REVISION"`
+	BaseRevision     int       `gorm:"column:base_revision;type:int;default:0" json:"BASE_REVISION"`
+	Percentage       int       `gorm:"column:percentage;type:int;default:0" json:"PERCENTAGE"`
+	State            string    `gorm:"column:state;type:char(16);not null" json:"STATE"`
+	ObserveSeconds   int       `gorm:"column:observe_seconds;type:int;default:600" json:"OBSERVE_SECONDS"`
+	MaxCPURatio      float64   `gorm:"column:max_cpu_ratio;type:double;default:1" json:"MAX_CPU_RATIO"`         // 对应 deepflow_agent_monitor.max_millicpus_ratio
+	MaxMemoryRatio   float64   `gorm:"column:max_memory_ratio;type:double;default:0.9" json:"MAX_MEMORY_RATIO"` // 对应 deepflow_agent_monitor.max_memory_ratio
+	Message          string    `gorm:"column:message;type:text" json:"MESSAGE"`
+	UserID           int       `gorm:"column:user_id;type:int;default:0" json:"USER_ID"`
+	CreatedAt        time.Time `gorm:"column:created_at;type:timestamp;not null;default:CURRENT_TIMESTAMP" json:"CREATED_AT"`
+	UpdatedAt        time.Time `gorm:"column:updated_at;type:timestamp;not null;default:CURRENT_TIMESTAMP" json:"UPDATED_AT"`
+}
+
+func (MySQLAgentGroupConfigurationRollout) TableName() string {
+	return "agent_group_configuration_rollout"
+}
+
+type MySQLAgentGroupConfigurationRolloutAgent struct {
+	ID                 int       `gorm:"primaryKey;column:id;type:int;not null" json:"ID"`
+	RolloutID          int       `gorm:"column:rollout_id;type:int;not null" json:"ROLLOUT_ID"`
+	VTapID             int       `gorm:"column:vtap_id;type:int;not null" json:"VTAP_ID"`
+	VTapName           string    `gorm:"column:vtap_name;type:varchar(256)" json:"VTAP_NAME"`
+	BaselineExceptions int64     `gorm:"column:baseline_exceptions;type:bigint unsigned;default:0" json:"BASELINE_EXCEPTIONS"` // 灰度开始时已存在的异常，不作为判断依据
+	State              string    `gorm:"column:state;type:char(16);not null" json:"STATE"`
+	CPURatio           float64   `gorm:"column:cpu_ratio;type:double;default:0" json:"CPU_RATIO"`
+	MemoryRatio        float64   `gorm:"column:memory_ratio;type:double;default:0" json:"MEMORY_RATIO"`
+	Message            string    `gorm:"column:message;type:text" json:"MESSAGE"`
+	UpdatedAt          time.Time `gorm:"column:updated_at;type:timestamp;not null;default:CURRENT_TIMESTAMP" json:"UPDATED_AT"`
+}
+
+func (MySQLAgentGroupConfigurationRolloutAgent) TableName() string {
+	return "agent_group_configuration_rollout_agent"
+}
+
+// RolloutAgentConfig 灰度中的采集器及其下发的灰度配置
+type RolloutAgentConfig struct {
+	RolloutID        int
+	AgentGroupLcuuid string
+	Yaml             string
+	VTapID           int
+}
+
+// GetRunningRolloutAgentConfigs 通过一次关联查询获取所有灰度中的采集器及其灰度配置
+func GetRunningRolloutAgentConfigs(db *gorm.DB) ([]*RolloutAgentConfig, error) {
+	var configs []*RolloutAgentConfig
+	err := db.Table(MySQLAgentGroupConfigurationRollout{}.TableName()+" AS r").
+		Select("r.id AS rollout_id, r.agent_group_lcuuid, rev.yaml, a.vtap_id").
+		Joins("JOIN "+MySQLAgentGroupConfigurationRevision{}.TableName()+" AS rev ON rev.agent_group_lcuuid = r.agent_group_lcuuid AND rev.revision = r.revision").
+		Joins("JOIN "+MySQLAgentGroupConfigurationRolloutAgent{}.TableName()+" AS a ON a.rollout_id = r.id").
+		Where("r.state = ?", ROLLOUT_STATE_RUNNING).
+		Scan(&configs).Error
+	return configs, err
+}
+
 type AgentGroupConfigModel struct {
 	ID                                int      `gorm:"primaryKey;column:id;type:int;not null" json:"ID"`
 	MaxCollectPps                     *int     `gorm:"column:max_collect_pps;type:int;default:null" json:"MAX_COLLECT_PPS"`
@@ -49,122 +49,34 @@ func ConvertYAMLToJSON(yamlData []byte) ([]byte, error) {
 	return dataFmt.mapToJSON(keyToComment)
 }
 
+// ValidateYAML 根据 template.yaml 校验配置的字段、类型、取值范围和可选值，错误类型为 ValidationErrors
 func ValidateYAML(yamlData []byte) error {
-	tmplFmt := NewTemplateFormatter(YamlAgentGroupConfigTemplate)
-	KeyToComment, err := tmplFmt.GenerateKeyToComment()
+	validator, err := GetTemplateValidator()
 	if err != nil {
-		return fmt.Errorf("generate key to comment error: %v", err)
+		return err
 	}
-	tmplFmt.DataFormatter.fmtMapValAndRefresh(KeyToComment, true)
-
-	dataFmt := NewDataFormatter()
-	err = dataFmt.LoadYAMLData(yamlData)
-	if err != nil {
-		return fmt.Errorf("new data formatter error: %v", err)
-	}
-	err = dataFmt.fmtMapValAndRefresh(KeyToComment, true)
-	if err != nil {
-		return fmt.Errorf("convert value and refresh error: %v", err)
-	}
-
-	return validateNodeAgainstTemplate(dataFmt.yamlNode, tmplFmt.DataFormatter.yamlNode)
+	return validator.Validate(yamlData)
 }
 
 func ConvertJSONToYAMLAndValidate(jsonData map[string]interface{}) ([]byte, error) {
-	tmplFmt := NewTemplateFormatter(YamlAgentGroupConfigTemplate)
-	KeyToComment, err := tmplFmt.GenerateKeyToComment()
+	keyToComment, err := NewTemplateFormatter(YamlAgentGroupConfigTemplate).GenerateKeyToComment()
 	if err != nil {
 		return nil, fmt.Errorf("generate key to comment error: %v", err)
 	}
-	tmplFmt.DataFormatter.fmtMapValAndRefresh(KeyToComment, true)
 
 	dataFmt := NewDataFormatter()
-	dataFmt.setKeyToComment(KeyToComment)
+	dataFmt.setKeyToComment(keyToComment)
 	err = dataFmt.LoadMapData(jsonData)
 	if err != nil {
 		return nil, fmt.Errorf("new data formatter error: %v", err)
 	}
-	err = dataFmt.fmtMapValAndRefresh(KeyToComment, true)
-	if err != nil {
-		return nil, fmt.Errorf("convert value and refresh error: %v", err)
-	}
 
-	if err := validateNodeAgainstTemplate(dataFmt.yamlNode, tmplFmt.DataFormatter.yamlNode); err != nil {
+	if err := ValidateYAML(dataFmt.formattedYAMLData); err != nil {
 		return nil, err
 	}
-
 	return dataFmt.formattedYAMLData, nil
 }
 
-func validateNodeAgainstTemplate(node, nodeTemplate *yaml.Node) error {
-	if node.Kind != nodeTemplate.Kind {
-		return fmt.Errorf("node kind mismatch: expected %v, got %v", nodeTemplate.Kind, node.Kind)
-	}
-
-	switch node.Kind {
-	case yaml.DocumentNode:
-		if len(node.Content) != len(nodeTemplate.Content) {
-			return fmt.Errorf("document node content length mismatch")
-		}
-		for i := range node.Content {
-			if err := validateNodeAgainstTemplate(node.Content[i], nodeTemplate.Content[i]); err != nil {
-				return err
-			}
-		}
-	case yaml.MappingNode:
-		nodeMap := make(map[string]*yaml.Node)
-		for i := 0; i < len(node.Content); i += 2 {
-			nodeMap[node.Content[i].Value] = node.Content[i+1]
-		}
-
-		templateMap := make(map[string]*yaml.Node)
-		for i := 0; i < len(nodeTemplate.Content); i += 2 {
-			templateMap[nodeTemplate.Content[i].Value] = nodeTemplate.Content[i+1]
-		}
-
-		for key, value := range nodeMap {
-			if templateValue, exists := templateMap[key]; exists {
-				if err := validateNodeAgainstTemplate(value, templateValue); err != nil {
-					return fmt.Errorf("invalid value for key '%s': %v", key, err)
-				}
-			} else {
-				return fmt.Errorf("unexpected key in configuration: %s", key)
-			}
-		}
-	case yaml.SequenceNode:
-		if len(node.Content) > 0 && len(nodeTemplate.Content) > 0 {
-			for _, item := range node.Content {
-				if err := validateNodeAgainstTemplate(item, nodeTemplate.Content[0]); err != nil {
-					return fmt.Errorf("invalid sequence item: %v", err)
-				}
-			}
-		}
-		// TODO validate sequence content by comment
-	case yaml.ScalarNode:
-		if nodeTemplate.Tag == "!!null" { // TODO more strict validation
-			return nil
-		}
-		if (nodeTemplate.Tag == "!!float" && node.Tag == "!!int") || (nodeTemplate.Tag == "!!int" && node.Tag == "!!float") {
-			return nil
-		}
-		if node.Tag != nodeTemplate.Tag {
-			return fmt.Errorf("scalar type mismatch: expected %s, got %s", nodeTemplate.Tag, node.Tag)
-		}
-	case yaml.AliasNode:
-		if nodeTemplate.Kind != yaml.AliasNode {
-			return fmt.Errorf("unexpected alias node")
-		}
-		// For alias nodes, we should validate the actual content they refer to
-		if err := validateNodeAgainstTemplate(node.Alias, nodeTemplate.Alias); err != nil {
-			return fmt.Errorf("invalid alias node: %v", err)
-		}
-	default:
-		return fmt.Errorf("unsupported node kind: %v", node.Kind)
-	}
-
-	return nil
-}
-
 func ConvertTemplateYAMLToJSON(d DynamicOptions) ([]byte, error) {
 	return NewTemplateFormatter(YamlAgentGroupConfigTemplate).mapToJSON(d)
 }
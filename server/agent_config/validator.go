@@ -0,0 +1,409 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent_config
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	dynamicOptions = "_DYNAMIC_OPTIONS_"
+	rootPath       = "<root>"
+)
+
+// ValidationError 描述配置中单个字段的校验错误，Path 为以 . 分隔的字段路径，列表元素以 [i] 表示
+type ValidationError struct {
+	Path    string `json:"PATH"`
+	Line    int    `json:"LINE"`
+	Message string `json:"MESSAGE"`
+}
+
+func (e *ValidationError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s (line %d): %s", e.Path, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *ValidationErrors) add(path string, node *yaml.Node, format string, a ...interface{}) {
+	if path == "" {
+		path = rootPath
+	}
+	*e = append(*e, &ValidationError{Path: path, Line: node.Line, Message: fmt.Sprintf(format, a...)})
+}
+
+// TemplateValidator 根据 template.yaml 中各字段注释的 type、range、enum_options 校验 agent 配置，
+// 模板中不存在的字段视为未知字段。
+type TemplateValidator struct {
+	keyToComment KeyToComment
+	template     map[string]interface{}
+}
+
+// 这些字段的 enum_options 只是常用取值，实际还支持其他格式，不做可选值校验
+var enumHintOnlyKeys = map[string]bool{
+	"global.self_monitoring.log.log_level": true, // 支持 info,deepflow_agent::rpc::session=debug 这样的模块级配置
+}
+
+var (
+	templateValidator     *TemplateValidator
+	templateValidatorErr  error
+	templateValidatorOnce sync.Once
+)
+
+// GetTemplateValidator 返回基于内置 template.yaml 的校验器，模板只解析一次
+func GetTemplateValidator() (*TemplateValidator, error) {
+	templateValidatorOnce.Do(func() {
+		templateValidator, templateValidatorErr = NewTemplateValidator(YamlAgentGroupConfigTemplate)
+	})
+	return templateValidator, templateValidatorErr
+}
+
+func NewTemplateValidator(templateData []byte) (*TemplateValidator, error) {
+	tmplFmt := NewTemplateFormatter(templateData)
+	keyToComment, err := tmplFmt.GenerateKeyToComment()
+	if err != nil {
+		return nil, fmt.Errorf("generate key to comment error: %v", err)
+	}
+	return &TemplateValidator{
+		keyToComment: keyToComment,
+		template:     tmplFmt.mapData,
+	}, nil
+}
+
+// Validate 校验 yaml 配置，返回所有校验错误（ValidationErrors），而不是遇到第一个错误就返回
+func (v *TemplateValidator) Validate(yamlData []byte) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(yamlData, &root); err != nil {
+		return fmt.Errorf("unmarshal yaml error: %v", err)
+	}
+	if len(root.Content) == 0 {
+		return nil
+	}
+	var errs ValidationErrors
+	v.validateMapping("", root.Content[0], v.template, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (v *TemplateValidator) validateMapping(path string, node *yaml.Node, template map[string]interface{}, errs *ValidationErrors) {
+	node = resolveAlias(node)
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+	if node.Kind != yaml.MappingNode {
+		errs.add(path, node, "expected a section, got %s", nodeTypeName(node))
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+		// 合并键（<<: *anchor）引用的 section 按当前 section 校验
+		if keyNode.Tag == "!!merge" {
+			v.validateMerge(path, valueNode, template, errs)
+			continue
+		}
+		keyPath := keyNode.Value
+		if path != "" {
+			keyPath = path + "." + keyNode.Value
+		}
+		tmplValue, ok := template[keyNode.Value]
+		if !ok || strings.HasSuffix(keyNode.Value, keyCommentSuffix) {
+			errs.add(keyPath, keyNode, "unknown key")
+			continue
+		}
+		v.validateValue(keyPath, valueNode, tmplValue, errs)
+	}
+}
+
+// 合并键的值可以是单个 section 或 section 列表
+func (v *TemplateValidator) validateMerge(path string, node *yaml.Node, template map[string]interface{}, errs *ValidationErrors) {
+	node = resolveAlias(node)
+	if node.Kind != yaml.SequenceNode {
+		v.validateMapping(path, node, template, errs)
+		return
+	}
+	for _, item := range node.Content {
+		v.validateMapping(path, item, template, errs)
+	}
+}
+
+func (v *TemplateValidator) validateValue(path string, node *yaml.Node, tmplValue interface{}, errs *ValidationErrors) {
+	node = resolveAlias(node)
+	comment := v.keyToComment[path]
+	valueType, _ := comment["type"].(string)
+	switch valueType {
+	case "section":
+		tmplMap, _ := tmplValue.(map[string]interface{})
+		v.validateMapping(path, node, tmplMap, errs)
+		return
+	case "dict":
+		// dict 类型的值结构由 value_comments 描述，这里只校验是否为合法的 yaml 结构或字符串
+		if node.Kind == yaml.ScalarNode && node.Tag != "!!str" && node.Tag != "!!null" {
+			errs.add(path, node, "expected dict, got %s", nodeTypeName(node))
+		}
+		return
+	case "":
+		// 没有注释的字段按模板默认值的结构校验
+		if tmplMap, ok := tmplValue.(map[string]interface{}); ok {
+			v.validateMapping(path, node, tmplMap, errs)
+			return
+		}
+	}
+
+	_, tmplIsList := tmplValue.([]interface{})
+	if node.Kind == yaml.SequenceNode {
+		if !tmplIsList && tmplValue != nil {
+			errs.add(path, node, "expected a single %s, got list", valueType)
+			return
+		}
+		for i, item := range node.Content {
+			v.validateScalar(fmt.Sprintf("%s[%d]", path, i), resolveAlias(item), valueType, comment, errs)
+		}
+		return
+	}
+	if tmplIsList && node.Tag != "!!null" {
+		errs.add(path, node, "expected a list of %s, got %s", valueType, nodeTypeName(node))
+		return
+	}
+	v.validateScalar(path, node, valueType, comment, errs)
+}
+
+func (v *TemplateValidator) validateScalar(path string, node *yaml.Node, valueType string, comment map[string]interface{}, errs *ValidationErrors) {
+	if node.Kind != yaml.ScalarNode {
+		errs.add(path, node, "expected %s, got %s", valueType, nodeTypeName(node))
+		return
+	}
+	if node.Tag == "!!null" {
+		return
+	}
+
+	switch valueType {
+	case "bool":
+		if node.Tag != "!!bool" {
+			errs.add(path, node, "expected bool, got %s", nodeTypeName(node))
+		}
+	case "int":
+		if node.Tag != "!!int" {
+			errs.add(path, node, "expected int, got %s", nodeTypeName(node))
+			return
+		}
+		value, err := strconv.ParseInt(node.Value, 0, 64)
+		if err != nil {
+			errs.add(path, node, "invalid int %q: %v", node.Value, err)
+			return
+		}
+		if min, max, ok := numberRange(comment); ok && (float64(value) < min || float64(value) > max) {
+			errs.add(path, node, "value %d is out of range [%v, %v]", value, min, max)
+			return
+		}
+		v.validateEnum(path, node, strconv.FormatInt(value, 10), comment, errs)
+	case "float":
+		if node.Tag != "!!float" && node.Tag != "!!int" {
+			errs.add(path, node, "expected float, got %s", nodeTypeName(node))
+			return
+		}
+		value, err := strconv.ParseFloat(node.Value, 64)
+		if err != nil {
+			errs.add(path, node, "invalid float %q: %v", node.Value, err)
+			return
+		}
+		if min, max, ok := numberRange(comment); ok && (value < min || value > max) {
+			errs.add(path, node, "value %v is out of range [%v, %v]", value, min, max)
+		}
+	case "string":
+		if node.Tag != "!!str" {
+			errs.add(path, node, "expected string, got %s", nodeTypeName(node))
+			return
+		}
+		// string 类型的 range 表示长度范围
+		if min, max, ok := numberRange(comment); ok && (float64(len(node.Value)) < min || float64(len(node.Value)) > max) {
+			errs.add(path, node, "length %d is out of range [%v, %v]", len(node.Value), min, max)
+			return
+		}
+		v.validateEnum(path, node, node.Value, comment, errs)
+	case "duration":
+		if node.Tag != "!!str" {
+			errs.add(path, node, "expected duration such as 10s, got %s", nodeTypeName(node))
+			return
+		}
+		value, err := ParseDuration(node.Value)
+		if err != nil {
+			errs.add(path, node, "%v", err)
+			return
+		}
+		if min, max, ok := durationRange(comment); ok && (value < min || value > max) {
+			valueRange := comment["range"].([]interface{})
+			errs.add(path, node, "value %s is out of range [%v, %v]", node.Value, valueRange[0], valueRange[1])
+		}
+	case "ip":
+		if node.Tag != "!!str" || (node.Value != "" && net.ParseIP(node.Value) == nil) {
+			errs.add(path, node, "invalid ip %q", node.Value)
+		}
+	}
+}
+
+func (v *TemplateValidator) validateEnum(path string, node *yaml.Node, value string, comment map[string]interface{}, errs *ValidationErrors) {
+	options := enumOptions(comment)
+	if len(options) == 0 || enumHintOnlyKeys[strings.SplitN(path, "[", 2)[0]] {
+		return
+	}
+	for _, option := range options {
+		if strings.EqualFold(option, value) {
+			return
+		}
+	}
+	errs.add(path, node, "value %q is not one of [%s]", node.Value, strings.Join(options, ", "))
+}
+
+// enumOptions 返回注释中的可选值，enum_options 为空或包含动态选项时返回 nil
+func enumOptions(comment map[string]interface{}) []string {
+	rawOptions, _ := comment["enum_options"].([]interface{})
+	options := make([]string, 0, len(rawOptions))
+	for _, rawOption := range rawOptions {
+		switch option := rawOption.(type) {
+		case map[interface{}]interface{}:
+			for key := range option {
+				options = append(options, fmt.Sprintf("%v", key))
+			}
+		case map[string]interface{}:
+			for key := range option {
+				if key == dynamicOptions {
+					return nil
+				}
+				options = append(options, key)
+			}
+		default:
+			if fmt.Sprintf("%v", option) == dynamicOptions {
+				return nil
+			}
+			options = append(options, fmt.Sprintf("%v", option))
+		}
+	}
+	return options
+}
+
+func numberRange(comment map[string]interface{}) (float64, float64, bool) {
+	valueRange, _ := comment["range"].([]interface{})
+	if len(valueRange) != 2 {
+		return 0, 0, false
+	}
+	min, err := strconv.ParseFloat(fmt.Sprintf("%v", valueRange[0]), 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	max, err := strconv.ParseFloat(fmt.Sprintf("%v", valueRange[1]), 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return min, max, true
+}
+
+func durationRange(comment map[string]interface{}) (time.Duration, time.Duration, bool) {
+	valueRange, _ := comment["range"].([]interface{})
+	if len(valueRange) != 2 {
+		return 0, 0, false
+	}
+	min, err := ParseDuration(fmt.Sprintf("%v", valueRange[0]))
+	if err != nil {
+		return 0, 0, false
+	}
+	max, err := ParseDuration(fmt.Sprintf("%v", valueRange[1]))
+	if err != nil {
+		return 0, 0, false
+	}
+	return min, max, true
+}
+
+var durationPartRegex = regexp.MustCompile(`^(\d+)(ns|us|µs|ms|s|m|h|d)`)
+
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"µs": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+}
+
+// ParseDuration 解析 agent 配置中的时长，与 agent 使用的 humantime 格式一致，支持 d 单位及 1h30m 这样的组合
+func ParseDuration(s string) (time.Duration, error) {
+	remain := strings.ReplaceAll(strings.TrimSpace(s), " ", "")
+	if remain == "" {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	var duration time.Duration
+	for remain != "" {
+		matches := durationPartRegex.FindStringSubmatch(remain)
+		if matches == nil {
+			return 0, fmt.Errorf("invalid duration %q, expected value like 10s, 5m, 1h or 1d", s)
+		}
+		value, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %v", s, err)
+		}
+		duration += time.Duration(value) * durationUnits[matches[2]]
+		remain = remain[len(matches[0]):]
+	}
+	return duration, nil
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+func nodeTypeName(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "section"
+	case yaml.SequenceNode:
+		return "list"
+	case yaml.ScalarNode:
+		switch node.Tag {
+		case "!!str":
+			return fmt.Sprintf("string %q", node.Value)
+		case "!!int", "!!float", "!!bool":
+			return fmt.Sprintf("%s %s", strings.TrimPrefix(node.Tag, "!!"), node.Value)
+		case "!!null":
+			return "null"
+		}
+	}
+	return node.Tag
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package agent_config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		yamlData string
+		want     []string
+	}{
+		{
+			name: "valid",
+			yamlData: `global:
+  limits:
+    max_millicpus: 2000
+    local_log_retention: 30d
+  self_monitoring:
+    log:
+      log_level: info,deepflow_agent::rpc::session=debug
+outputs:
+  flow_log:
+    filters:
+      l7_capture_network_types: [0, 3]`,
+			want: nil,
+		},
+		{
+			name: "out of range",
+			yamlData: `global:
+  limits:
+    max_millicpus: 0
+    local_log_retention: 1d`,
+			want: []string{
+				"global.limits.max_millicpus (line 3): value 0 is out of range [1, 100000]",
+				"global.limits.local_log_retention (line 4): value 1d is out of range [10d, 10000d]",
+			},
+		},
+		{
+			name: "enum and type",
+			yamlData: `global:
+  communication:
+    ingester_traffic_overflow_action: RETRY
+  circuit_breakers:
+    relative_sys_load:
+      trigger_threshold: high`,
+			want: []string{
+				`global.communication.ingester_traffic_overflow_action (line 3): value "RETRY" is not one of [WAIT, DROP]`,
+				`global.circuit_breakers.relative_sys_load.trigger_threshold (line 6): expected float, got string "high"`,
+			},
+		},
+		{
+			name: "unknown key and list item",
+			yamlData: `inputs:
+  proc:
+    pid: 123
+outputs:
+  flow_log:
+    filters:
+      l7_capture_network_types: [0, a]`,
+			want: []string{
+				"inputs.proc.pid (line 3): unknown key",
+				`outputs.flow_log.filters.l7_capture_network_types[1] (line 7): expected int, got string "a"`,
+			},
+		},
+		{
+			name: "merge key",
+			yamlData: `global:
+  limits:
+    <<: &limits
+      max_millicpus: 2000
+    local_log_retention: 30d
+  tunning:
+    <<: *limits`,
+			want: []string{
+				"global.tunning.max_millicpus (line 4): unknown key",
+			},
+		},
+		{
+			name: "merge key list",
+			yamlData: `global:
+  limits:
+    <<: [{max_millicpus: 0}, {pid: 1}]`,
+			want: []string{
+				"global.limits.max_millicpus (line 3): value 0 is out of range [1, 100000]",
+				"global.limits.pid (line 3): unknown key",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateYAML([]byte(tt.yamlData))
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			errs, ok := err.(ValidationErrors)
+			if !assert.True(t, ok, "unexpected error: %v", err) {
+				return
+			}
+			got := make([]string, len(errs))
+			for i, e := range errs {
+				got[i] = e.Error()
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for s, want := range map[string]time.Duration{
+		"0ns":   0,
+		"100ms": 100 * time.Millisecond,
+		"1h30m": 90 * time.Minute,
+		"10d":   240 * time.Hour,
+	} {
+		got, err := ParseDuration(s)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got, s)
+	}
+	for _, s := range []string{"", "10", "1y", "s10"} {
+		_, err := ParseDuration(s)
+		assert.Error(t, err, s)
+	}
+}
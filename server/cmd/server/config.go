@@ -26,6 +26,7 @@ import (
 	yaml "gopkg.in/yaml.v2"
 
 	"github.com/deepflowio/deepflow/server/ingester/ingesterctl"
+	"github.com/deepflowio/deepflow/server/libs/auth"
 	"github.com/deepflowio/deepflow/server/libs/debug"
 )
 
@@ -37,6 +38,7 @@ type Config struct {
 	MaxCPUs             int                 `yaml:"max-cpus"`
 	MonitorPaths        []string            `yaml:"monitor-paths"`
 	FreeOSMemoryManager FreeOSMemoryManager `yaml:"free-os-memory-manager"`
+	Auth                auth.Config         `yaml:"auth"`
 }
 
 type FreeOSMemoryManager struct {
@@ -67,6 +69,7 @@ func loadConfig(path string) *Config {
 		},
 		MonitorPaths:        []string{"/", "/mnt", "/var/log"},
 		FreeOSMemoryManager: FreeOSMemoryManager{false, DEFAULT_FREE_INTERVAL_SECOND},
+		Auth:                auth.DefaultConfig(),
 	}
 	configBytes, err := os.ReadFile(path)
 	if err != nil {
@@ -78,6 +81,10 @@ func loadConfig(path string) *Config {
 		fmt.Printf("Unmarshal yaml(%s) error: %s", path, err)
 		os.Exit(1)
 	}
+	if err = config.Auth.Validate(); err != nil {
+		fmt.Printf("Invalid auth config: %s", err)
+		os.Exit(1)
+	}
 
 	return config
 }
@@ -34,6 +34,7 @@ import (
 	"github.com/deepflowio/deepflow/server/ingester/droplet/profiler"
 	"github.com/deepflowio/deepflow/server/ingester/ingester"
 	"github.com/deepflowio/deepflow/server/ingester/ingesterctl"
+	"github.com/deepflowio/deepflow/server/libs/auth"
 	"github.com/deepflowio/deepflow/server/libs/debug"
 	"github.com/deepflowio/deepflow/server/libs/logger"
 	"github.com/deepflowio/deepflow/server/mcp"
@@ -106,6 +107,8 @@ func main() {
 	report.SetServerInfo(Branch, RevCount, Revision)
 
 	shared := common.NewControllerIngesterShared()
+	// controller、querier 和 mcp 启动前初始化认证配置
+	auth.Init(cfg.Auth)
 
 	go mcp.NewMCPServer(*configPath).Start()
 
@@ -0,0 +1,275 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/config"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
+	"github.com/deepflowio/deepflow/server/controller/statsd"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+var log = logger.MustGetLogger("cloud.azure")
+
+const (
+	SUBSCRIPTION_API_VERSION   = "2022-12-01"
+	RESOURCE_GROUP_API_VERSION = "2021-04-01"
+	NETWORK_API_VERSION        = "2023-09-01"
+	COMPUTE_API_VERSION        = "2023-09-01"
+
+	PROVIDER_NETWORK = "Microsoft.Network"
+	PROVIDER_COMPUTE = "Microsoft.Compute"
+)
+
+type Azure struct {
+	orgID          int
+	teamID         int
+	lcuuid         string
+	lcuuidGenerate string
+	name           string
+	httpTimeout    int
+	config         *Config
+	token          *Token
+	toolDataSet    *ToolDataSet       // 处理资源数据时，构建的需要提供给其他资源使用的工具数据
+	cloudStatsd    statsd.CloudStatsd // 性能监控
+	debugger       *cloudcommon.Debugger
+}
+
+func NewAzure(orgID int, domain metadbmodel.Domain, globalCloudCfg config.CloudConfig) (*Azure, error) {
+	conf := &Config{}
+	err := conf.LoadFromString(orgID, domain.Config)
+	if err != nil {
+		return nil, err
+	}
+	return &Azure{
+		orgID:  orgID,
+		teamID: domain.TeamID,
+		lcuuid: domain.Lcuuid,
+		// TODO: display_name后期需要修改为uuid_generate
+		lcuuidGenerate: domain.DisplayName,
+		name:           domain.Name,
+		httpTimeout:    globalCloudCfg.HTTPTimeout,
+		config:         conf,
+		debugger:       cloudcommon.NewDebugger(domain.Name),
+	}, nil
+}
+
+func (a *Azure) ClearDebugLog() {
+	a.debugger.Clear()
+}
+
+func (a *Azure) CheckAuth() error {
+	_, err := a.createToken()
+	return err
+}
+
+func (a *Azure) GetCloudData() (model.Resource, error) {
+	a.cloudStatsd = statsd.NewCloudStatsd()
+	a.toolDataSet = NewToolDataSet()
+	var resource model.Resource
+	if _, err := a.getToken(); err != nil {
+		return resource, err
+	}
+
+	subscriptionIDs, err := a.getSubscriptionIDs()
+	if err != nil {
+		return resource, err
+	}
+	for _, subscriptionID := range subscriptionIDs {
+		regions, err := a.getRegions(subscriptionID)
+		if err != nil {
+			return resource, err
+		}
+		resource.Regions = append(resource.Regions, regions...)
+
+		scopes, err := a.getScopes(subscriptionID)
+		if err != nil {
+			return resource, err
+		}
+		for _, scope := range scopes {
+			vpcs, networks, subnets, err := a.getVNets(scope)
+			if err != nil {
+				return resource, err
+			}
+			resource.VPCs = append(resource.VPCs, vpcs...)
+			resource.Networks = append(resource.Networks, networks...)
+			resource.Subnets = append(resource.Subnets, subnets...)
+
+			if err := a.getPublicIPs(scope); err != nil {
+				return resource, err
+			}
+			if err := a.getNICs(scope); err != nil {
+				return resource, err
+			}
+
+			vms, vifs, ips, fIPs, err := a.getVMs(scope)
+			if err != nil {
+				return resource, err
+			}
+			resource.VMs = append(resource.VMs, vms...)
+			resource.VInterfaces = append(resource.VInterfaces, vifs...)
+			resource.IPs = append(resource.IPs, ips...)
+			resource.FloatingIPs = append(resource.FloatingIPs, fIPs...)
+
+			lbs, listeners, targetServers, lbVMConns, vifs, ips, err := a.getLBs(scope)
+			if err != nil {
+				return resource, err
+			}
+			resource.LBs = append(resource.LBs, lbs...)
+			resource.LBListeners = append(resource.LBListeners, listeners...)
+			resource.LBTargetServers = append(resource.LBTargetServers, targetServers...)
+			resource.LBVMConnections = append(resource.LBVMConnections, lbVMConns...)
+			resource.VInterfaces = append(resource.VInterfaces, vifs...)
+			resource.IPs = append(resource.IPs, ips...)
+
+			natGateways, natVMConns, vifs, ips, err := a.getNATGateways(scope)
+			if err != nil {
+				return resource, err
+			}
+			resource.NATGateways = append(resource.NATGateways, natGateways...)
+			resource.NATVMConnections = append(resource.NATVMConnections, natVMConns...)
+			resource.VInterfaces = append(resource.VInterfaces, vifs...)
+			resource.IPs = append(resource.IPs, ips...)
+		}
+	}
+	// 对等连接的两端可能位于不同订阅中，在全部VNet同步后处理
+	resource.PeerConnections = a.getPeerConnections()
+	resource.AZs = a.getAZs()
+
+	log.Debugf("region resource num info: %v", a.toolDataSet.regionLcuuidToResourceNum, logger.NewORGPrefix(a.orgID))
+	log.Debugf("az resource num info: %v", a.toolDataSet.azLcuuidToResourceNum, logger.NewORGPrefix(a.orgID))
+	resource.Regions = cloudcommon.EliminateEmptyRegions(resource.Regions, a.toolDataSet.regionLcuuidToResourceNum)
+	resource.AZs = cloudcommon.EliminateEmptyAZs(resource.AZs, a.toolDataSet.azLcuuidToResourceNum)
+
+	a.cloudStatsd.ResCount = statsd.GetResCount(resource)
+	statsd.MetaStatsd.RegisterStatsdTable(a)
+
+	a.debugger.Refresh()
+	return resource, nil
+}
+
+func (a *Azure) GetStatter() statsd.StatsdStatter {
+	globalTags := map[string]string{
+		"domain_name": a.name,
+		"domain":      a.lcuuid,
+		"platform":    common.AZURE_EN,
+	}
+
+	return statsd.StatsdStatter{
+		OrgID:      a.orgID,
+		TeamID:     a.teamID,
+		GlobalTags: globalTags,
+		Element:    statsd.GetCloudStatsd(a.cloudStatsd),
+	}
+}
+
+// getSubscriptionIDs 未配置订阅时，同步凭据可见的全部已启用订阅
+func (a *Azure) getSubscriptionIDs() ([]string, error) {
+	if len(a.config.SubscriptionIDs) > 0 {
+		return a.config.SubscriptionIDs, nil
+	}
+	jSubscriptions, err := a.getRawData(
+		fmt.Sprintf("%s/subscriptions?api-version=%s", a.config.ResourceManagerEndpoint, SUBSCRIPTION_API_VERSION), "subscriptions",
+	)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for i := range jSubscriptions {
+		js := jSubscriptions[i]
+		id := js.Get("subscriptionId").MustString()
+		if id == "" || js.Get("state").MustString() != "Enabled" {
+			log.Infof("exclude subscription: %s, not enabled", id, logger.NewORGPrefix(a.orgID))
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// getScopes 未配置资源组时按订阅查询资源，否则只查询订阅中配置的资源组
+func (a *Azure) getScopes(subscriptionID string) ([]string, error) {
+	subscriptionScope := "/subscriptions/" + subscriptionID
+	if len(a.config.ResourceGroups) == 0 {
+		return []string{subscriptionScope}, nil
+	}
+	jGroups, err := a.getRawData(
+		fmt.Sprintf("%s%s/resourcegroups?api-version=%s", a.config.ResourceManagerEndpoint, subscriptionScope, RESOURCE_GROUP_API_VERSION), "resourcegroups",
+	)
+	if err != nil {
+		return nil, err
+	}
+	var scopes []string
+	for i := range jGroups {
+		name := jGroups[i].Get("name").MustString()
+		if !a.config.ResourceGroups[strings.ToLower(name)] {
+			continue
+		}
+		scopes = append(scopes, subscriptionScope+"/resourceGroups/"+name)
+	}
+	return scopes, nil
+}
+
+func (a *Azure) listURL(scope, provider, resourceType, apiVersion string) string {
+	return fmt.Sprintf("%s%s/providers/%s/%s?api-version=%s", a.config.ResourceManagerEndpoint, scope, provider, resourceType, apiVersion)
+}
+
+// getRawData 请求azure resource manager api，响应中存在nextLink时继续查询下一页
+func (a *Azure) getRawData(url, name string) (jsonList []*simplejson.Json, err error) {
+	statsdAPIStartTime := time.Now()
+
+	nextURL := url
+	for nextURL != "" {
+		resp, err := RequestGet(nextURL, a.token.token, time.Duration(a.httpTimeout))
+		if err != nil {
+			return []*simplejson.Json{}, err
+		}
+		jData := resp.Get("value")
+		for i := range jData.MustArray() {
+			jsonList = append(jsonList, jData.GetIndex(i))
+		}
+		nextURL = resp.Get("nextLink").MustString()
+	}
+	a.cloudStatsd.RefreshAPIMoniter(name, len(jsonList), statsdAPIStartTime)
+
+	a.debugger.WriteJson(name, url, jsonList)
+	return
+}
+
+// azure资源ID为不区分大小写的资源路径，统一转为小写后生成lcuuid
+func (a *Azure) idToLcuuid(id string) string {
+	return common.GenerateUUIDByOrgID(a.orgID, strings.ToLower(id))
+}
+
+func getTags(j *simplejson.Json) map[string]string {
+	tags := map[string]string{}
+	for k, v := range j.Get("tags").MustMap() {
+		if s, ok := v.(string); ok {
+			tags[k] = s
+		}
+	}
+	return tags
+}
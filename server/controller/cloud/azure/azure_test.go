@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package azure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/config"
+	cloudtest "github.com/deepflowio/deepflow/server/controller/cloud/test"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	metadbcommon "github.com/deepflowio/deepflow/server/controller/db/metadb/common"
+	"github.com/deepflowio/deepflow/server/controller/statsd"
+	statsdcfg "github.com/deepflowio/deepflow/server/controller/statsd/config"
+)
+
+// 使用录制的azure api响应模拟microsoft entra id及resource manager服务
+func newFixtureServer(t *testing.T) *httptest.Server {
+	fixtures := map[string]string{
+		"/tenant-1/oauth2/v2.0/token":    "token.json",
+		"/subscriptions":                 "subscriptions.json",
+		"/subscriptions/sub-1/locations": "locations.json",
+		"/subscriptions/sub-1/providers/Microsoft.Network/virtualNetworks":       "virtual_networks.json",
+		"/subscriptions/sub-1/providers/Microsoft.Network/publicIPAddresses":     "public_ip_addresses.json",
+		"/subscriptions/sub-1/providers/Microsoft.Network/networkInterfaces":     "network_interfaces.json",
+		"/subscriptions/sub-1/providers/Microsoft.Compute/virtualMachines":       "virtual_machines.json",
+		"/subscriptions/sub-1/providers/Microsoft.Compute/virtualMachines?page2": "virtual_machines_page2.json",
+		"/subscriptions/sub-1/providers/Microsoft.Network/loadBalancers":         "load_balancers.json",
+		"/subscriptions/sub-1/providers/Microsoft.Network/natGateways":           "nat_gateways.json",
+	}
+	return cloudtest.NewFixtureServer(t, fixtures, "$skiptoken", func(key string, w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == http.MethodGet && r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		}
+		return true
+	})
+}
+
+func TestAzure(t *testing.T) {
+	Convey("TestAzure", t, func() {
+		server := newFixtureServer(t)
+		defer server.Close()
+		statsd.NewStatsdMonitor(statsdcfg.StatsdConfig{})
+		config.CONF = &config.CloudConfig{}
+
+		a := &Azure{
+			orgID:          metadbcommon.DEFAULT_ORG_ID,
+			lcuuidGenerate: "test_azure",
+			name:           "test_azure",
+			httpTimeout:    5,
+			config: &Config{
+				TenantID:                "tenant-1",
+				ClientID:                "client-1",
+				ClientSecret:            "secret",
+				ResourceGroups:          map[string]bool{},
+				AuthorityHost:           server.URL,
+				ResourceManagerEndpoint: server.URL,
+			},
+			debugger: cloudcommon.NewDebugger("test_azure"),
+		}
+		So(a.CheckAuth(), ShouldBeNil)
+
+		data, err := a.GetCloudData()
+		So(err, ShouldBeNil)
+
+		Convey("azure resource number should be equal", func() {
+			So(len(data.Regions), ShouldEqual, 1)
+			So(len(data.AZs), ShouldEqual, 2)
+			So(len(data.VPCs), ShouldEqual, 2)
+			So(len(data.Networks), ShouldEqual, 3)
+			So(len(data.Subnets), ShouldEqual, 3)
+			So(len(data.PeerConnections), ShouldEqual, 1)
+			So(len(data.VMs), ShouldEqual, 3)
+			So(len(data.VInterfaces), ShouldEqual, 6)
+			So(len(data.IPs), ShouldEqual, 6)
+			So(len(data.FloatingIPs), ShouldEqual, 1)
+			So(len(data.LBs), ShouldEqual, 1)
+			So(len(data.LBListeners), ShouldEqual, 1)
+			So(len(data.LBTargetServers), ShouldEqual, 3)
+			So(len(data.LBVMConnections), ShouldEqual, 2)
+			So(len(data.NATGateways), ShouldEqual, 1)
+			So(len(data.NATVMConnections), ShouldEqual, 1)
+		})
+
+		Convey("azure resource relations should be correct", func() {
+			So(data.Regions[0].Name, ShouldEqual, "East US")
+			vmIDPrefix := "/subscriptions/sub-1/resourceGroups/rg-1/providers/Microsoft.Compute/virtualMachines/"
+			for _, vm := range data.VMs {
+				switch vm.Name {
+				case "vm2":
+					So(vm.State, ShouldEqual, common.VM_STATE_STOPPED)
+					So(vm.VPCLcuuid, ShouldEqual, a.idToLcuuid("/subscriptions/sub-1/resourceGroups/rg-1/providers/Microsoft.Network/virtualNetworks/vnet-a"))
+				case "vm3":
+					So(vm.State, ShouldEqual, common.VM_STATE_RUNNING)
+					So(vm.VPCLcuuid, ShouldEqual, a.idToLcuuid("/subscriptions/sub-1/resourceGroups/rg-1/providers/Microsoft.Network/virtualNetworks/vnet-b"))
+				}
+			}
+			for _, vif := range data.VInterfaces {
+				if vif.DeviceType == common.VIF_DEVICE_TYPE_VM && vif.Type == common.VIF_TYPE_LAN && vif.Name == "nic-vm1" {
+					So(vif.Mac, ShouldEqual, "00:0d:3a:00:00:01")
+				}
+			}
+			So(data.FloatingIPs[0].IP, ShouldEqual, "20.0.0.1")
+			So(data.FloatingIPs[0].VMLcuuid, ShouldEqual, a.idToLcuuid(vmIDPrefix+"vm1"))
+			So(data.LBs[0].Model, ShouldEqual, cloudcommon.LB_MODEL_EXTERNAL)
+			So(data.LBs[0].VIP, ShouldEqual, "20.0.0.2")
+			So(data.LBListeners[0].Protocol, ShouldEqual, "TCP")
+			for _, ts := range data.LBTargetServers {
+				So(ts.Port, ShouldEqual, 8080)
+				if ts.IP == "10.0.2.100" {
+					So(ts.Type, ShouldEqual, common.LB_SERVER_TYPE_IP)
+				} else {
+					So(ts.Type, ShouldEqual, common.LB_SERVER_TYPE_VM)
+				}
+			}
+			So(data.NATGateways[0].FloatingIPs, ShouldEqual, "20.0.0.3")
+			So(data.NATVMConnections[0].VMLcuuid, ShouldEqual, a.idToLcuuid(vmIDPrefix+"vm2"))
+		})
+	})
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package azure
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bitly/go-simplejson"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+const (
+	CLOUD_PUBLIC = "public"
+	CLOUD_CHINA  = "china"
+)
+
+// 不同Azure云环境的认证及资源管理地址
+var CLOUD_ENDPOINTS = map[string][2]string{
+	CLOUD_PUBLIC: {"https://login.microsoftonline.com", "https://management.azure.com"},
+	CLOUD_CHINA:  {"https://login.chinacloudapi.cn", "https://management.chinacloudapi.cn"},
+}
+
+type Config struct {
+	RegionLcuuid            string
+	TenantID                string
+	ClientID                string
+	ClientSecret            string
+	SubscriptionIDs         []string // 为空时同步凭据可见的全部订阅
+	ResourceGroups          map[string]bool
+	AuthorityHost           string
+	ResourceManagerEndpoint string
+	IncludeRegions          map[string]bool
+}
+
+func (c *Config) LoadFromString(orgID int, sConf string) (err error) {
+	jConf, err := simplejson.NewJson([]byte(sConf))
+	if err != nil {
+		log.Errorf("convert config string: %s to json failed: %v", sConf, err, logger.NewORGPrefix(orgID))
+		return
+	}
+	c.TenantID, err = jConf.Get("tenant_id").String()
+	if err != nil {
+		log.Error("tenant_id must be specified", logger.NewORGPrefix(orgID))
+		return
+	}
+	c.ClientID, err = jConf.Get("client_id").String()
+	if err != nil {
+		log.Error("client_id must be specified", logger.NewORGPrefix(orgID))
+		return
+	}
+	secret, err := jConf.Get("client_secret").String()
+	if err != nil {
+		log.Error("client_secret must be specified", logger.NewORGPrefix(orgID))
+		return
+	}
+	dsecret, err := common.DecryptSecretKey(secret)
+	if err != nil {
+		log.Errorf("decrypt client_secret failed (%s)", err.Error(), logger.NewORGPrefix(orgID))
+		return
+	}
+	c.ClientSecret = dsecret
+
+	cloud := jConf.Get("cloud").MustString(CLOUD_PUBLIC)
+	endpoints, ok := CLOUD_ENDPOINTS[cloud]
+	if !ok {
+		err = fmt.Errorf("cloud (%s) must be %s or %s", cloud, CLOUD_PUBLIC, CLOUD_CHINA)
+		log.Error(err.Error(), logger.NewORGPrefix(orgID))
+		return
+	}
+	c.AuthorityHost = endpoints[0]
+	c.ResourceManagerEndpoint = endpoints[1]
+
+	for _, s := range strings.Split(jConf.Get("subscription_ids").MustString(), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			c.SubscriptionIDs = append(c.SubscriptionIDs, s)
+		}
+	}
+	c.ResourceGroups = map[string]bool{}
+	for _, rg := range strings.Split(jConf.Get("resource_groups").MustString(), ",") {
+		if rg = strings.TrimSpace(rg); rg != "" {
+			// 资源组名称不区分大小写
+			c.ResourceGroups[strings.ToLower(rg)] = true
+		}
+	}
+	c.RegionLcuuid = jConf.Get("region_uuid").MustString()
+	c.IncludeRegions = cloudcommon.UniqRegions(jConf.Get("include_regions").MustString())
+	return
+}
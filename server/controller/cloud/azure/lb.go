@@ -0,0 +1,250 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package azure
+
+import (
+	"strings"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+// getLBs 同步负载均衡器，每条负载均衡规则对应一个监听器，规则关联的后端池成员作为后端主机
+func (a *Azure) getLBs(scope string) (
+	lbs []model.LB, lbListeners []model.LBListener, lbTargetServers []model.LBTargetServer, lbVMConns []model.LBVMConnection,
+	vifs []model.VInterface, ips []model.IP, err error,
+) {
+	jLBs, err := a.getRawData(a.listURL(scope, PROVIDER_NETWORK, "loadBalancers", NETWORK_API_VERSION), "loadBalancers")
+	if err != nil {
+		return
+	}
+
+	for i := range jLBs {
+		jLB := jLBs[i]
+		name := jLB.Get("name").MustString()
+		if !cloudcommon.CheckJsonAttributes(jLB, []string{"id", "name", "location", "properties"}) {
+			log.Infof("exclude lb: %s, missing attr", name, logger.NewORGPrefix(a.orgID))
+			continue
+		}
+		regionLcuuid, ok := a.getRegionLcuuid(jLB)
+		if !ok {
+			log.Infof("exclude lb: %s, region not synced", name, logger.NewORGPrefix(a.orgID))
+			continue
+		}
+		jProps := jLB.Get("properties")
+		lbLcuuid := a.idToLcuuid(jLB.Get("id").MustString())
+
+		// 后端池ID -> 后端成员
+		poolIDToMembers := map[string][]VMIP{}
+		jPools := jProps.Get("backendAddressPools")
+		for j := range jPools.MustArray() {
+			jPool := jPools.GetIndex(j)
+			poolID := strings.ToLower(jPool.Get("id").MustString())
+			jIPConfigs := jPool.Get("properties").Get("backendIPConfigurations")
+			for k := range jIPConfigs.MustArray() {
+				if member, ok := a.toolDataSet.ipConfigIDToVMIP[strings.ToLower(jIPConfigs.GetIndex(k).Get("id").MustString())]; ok {
+					poolIDToMembers[poolID] = append(poolIDToMembers[poolID], member)
+				}
+			}
+			jAddresses := jPool.Get("properties").Get("loadBalancerBackendAddresses")
+			for k := range jAddresses.MustArray() {
+				if ip := jAddresses.GetIndex(k).Get("properties").Get("ipAddress").MustString(); ip != "" {
+					poolIDToMembers[poolID] = append(poolIDToMembers[poolID], VMIP{IP: ip})
+				}
+			}
+		}
+
+		// 前端ip配置ID -> 前端ip
+		var vpcLcuuid string
+		var vips []string
+		lbModel := cloudcommon.LB_MODEL_INTERNAL
+		frontendIDToIP := map[string]string{}
+		var frontendVIFs []model.VInterface
+		var frontendIPs []model.IP
+		jFrontends := jProps.Get("frontendIPConfigurations")
+		for j := range jFrontends.MustArray() {
+			jFrontend := jFrontends.GetIndex(j)
+			frontendID := strings.ToLower(jFrontend.Get("id").MustString())
+			jfProps := jFrontend.Get("properties")
+			vifLcuuid := a.idToLcuuid(frontendID)
+			if ip := jfProps.Get("privateIPAddress").MustString(); ip != "" {
+				network, ok := a.toolDataSet.subnetIDToNetwork[strings.ToLower(jfProps.Get("subnet").Get("id").MustString())]
+				if !ok {
+					continue
+				}
+				vpcLcuuid = network.VPCLcuuid
+				frontendIDToIP[frontendID] = ip
+				vips = append(vips, ip)
+				frontendVIFs = append(
+					frontendVIFs,
+					model.VInterface{
+						Lcuuid:        vifLcuuid,
+						Type:          common.VIF_TYPE_LAN,
+						Mac:           common.VIF_DEFAULT_MAC,
+						DeviceType:    common.VIF_DEVICE_TYPE_LB,
+						DeviceLcuuid:  lbLcuuid,
+						NetworkLcuuid: network.Lcuuid,
+						VPCLcuuid:     network.VPCLcuuid,
+						RegionLcuuid:  regionLcuuid,
+					},
+				)
+				frontendIPs = append(
+					frontendIPs,
+					model.IP{
+						Lcuuid:           common.GenerateUUIDByOrgID(a.orgID, vifLcuuid+ip),
+						VInterfaceLcuuid: vifLcuuid,
+						IP:               ip,
+						SubnetLcuuid:     a.getSubnetLcuuid(network.Lcuuid, ip),
+						RegionLcuuid:     regionLcuuid,
+					},
+				)
+			} else if ip, ok := a.toolDataSet.publicIPIDToIP[strings.ToLower(jfProps.Get("publicIPAddress").Get("id").MustString())]; ok {
+				lbModel = cloudcommon.LB_MODEL_EXTERNAL
+				frontendIDToIP[frontendID] = ip
+				vips = append(vips, ip)
+				frontendVIFs = append(
+					frontendVIFs,
+					model.VInterface{
+						Lcuuid:        vifLcuuid,
+						Type:          common.VIF_TYPE_WAN,
+						Mac:           common.VIF_DEFAULT_MAC,
+						DeviceType:    common.VIF_DEVICE_TYPE_LB,
+						DeviceLcuuid:  lbLcuuid,
+						NetworkLcuuid: common.NETWORK_ISP_LCUUID,
+						RegionLcuuid:  regionLcuuid,
+					},
+				)
+				frontendIPs = append(
+					frontendIPs,
+					model.IP{
+						Lcuuid:           common.GenerateUUIDByOrgID(a.orgID, vifLcuuid+ip),
+						VInterfaceLcuuid: vifLcuuid,
+						IP:               ip,
+						RegionLcuuid:     regionLcuuid,
+					},
+				)
+			}
+		}
+		// 公网负载均衡器的前端不在VNet中，使用后端云主机所在的VPC
+		if vpcLcuuid == "" {
+			for _, members := range poolIDToMembers {
+				for _, m := range members {
+					if m.VPCLcuuid != "" {
+						vpcLcuuid = m.VPCLcuuid
+						break
+					}
+				}
+			}
+		}
+		if vpcLcuuid == "" {
+			log.Infof("exclude lb: %s, missing vpc info", name, logger.NewORGPrefix(a.orgID))
+			continue
+		}
+		lbs = append(
+			lbs,
+			model.LB{
+				Lcuuid:       lbLcuuid,
+				Name:         name,
+				Label:        jProps.Get("resourceGuid").MustString(),
+				Model:        lbModel,
+				VIP:          strings.Join(vips, common.STRINGS_JOIN_COMMA),
+				VPCLcuuid:    vpcLcuuid,
+				RegionLcuuid: regionLcuuid,
+			},
+		)
+		a.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+		for _, vif := range frontendVIFs {
+			vif.VPCLcuuid = vpcLcuuid
+			vifs = append(vifs, vif)
+		}
+		ips = append(ips, frontendIPs...)
+
+		lbVMConnKeys := map[string]bool{}
+		jRules := jProps.Get("loadBalancingRules")
+		for j := range jRules.MustArray() {
+			jRule := jRules.GetIndex(j)
+			jrProps := jRule.Get("properties")
+			ruleName := jRule.Get("name").MustString()
+			frontendIP, ok := frontendIDToIP[strings.ToLower(jrProps.Get("frontendIPConfiguration").Get("id").MustString())]
+			if !ok {
+				log.Infof("exclude lb_listener: %s, missing frontend info", ruleName, logger.NewORGPrefix(a.orgID))
+				continue
+			}
+			listenerLcuuid := a.idToLcuuid(jRule.Get("id").MustString())
+			protocol := strings.ToUpper(jrProps.Get("protocol").MustString())
+			lbListeners = append(
+				lbListeners,
+				model.LBListener{
+					Lcuuid:   listenerLcuuid,
+					LBLcuuid: lbLcuuid,
+					Name:     ruleName,
+					Label:    ruleName,
+					IPs:      frontendIP,
+					Protocol: protocol,
+					Port:     jrProps.Get("frontendPort").MustInt(),
+				},
+			)
+
+			poolIDs := []string{strings.ToLower(jrProps.Get("backendAddressPool").Get("id").MustString())}
+			jRulePools := jrProps.Get("backendAddressPools")
+			for k := range jRulePools.MustArray() {
+				poolIDs = append(poolIDs, strings.ToLower(jRulePools.GetIndex(k).Get("id").MustString()))
+			}
+			memberKeys := map[string]bool{}
+			for _, poolID := range poolIDs {
+				for _, m := range poolIDToMembers[poolID] {
+					if memberKeys[m.IP] {
+						continue
+					}
+					memberKeys[m.IP] = true
+					serverType := common.LB_SERVER_TYPE_IP
+					if m.VMLcuuid != "" {
+						serverType = common.LB_SERVER_TYPE_VM
+					}
+					lbTargetServers = append(
+						lbTargetServers,
+						model.LBTargetServer{
+							Lcuuid:           common.GenerateUUIDByOrgID(a.orgID, listenerLcuuid+m.IP),
+							LBLcuuid:         lbLcuuid,
+							LBListenerLcuuid: listenerLcuuid,
+							Type:             serverType,
+							IP:               m.IP,
+							VMLcuuid:         m.VMLcuuid,
+							Protocol:         protocol,
+							Port:             jrProps.Get("backendPort").MustInt(),
+							VPCLcuuid:        vpcLcuuid,
+						},
+					)
+					if m.VMLcuuid != "" && !lbVMConnKeys[m.VMLcuuid] {
+						lbVMConnKeys[m.VMLcuuid] = true
+						lbVMConns = append(
+							lbVMConns,
+							model.LBVMConnection{
+								Lcuuid:   common.GenerateUUIDByOrgID(a.orgID, lbLcuuid+m.VMLcuuid),
+								LBLcuuid: lbLcuuid,
+								VMLcuuid: m.VMLcuuid,
+							},
+						)
+					}
+				}
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package azure
+
+import (
+	"strings"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+// getNATGateways 同步已关联子网的NAT网关，关联子网中的云主机通过NAT网关访问公网
+func (a *Azure) getNATGateways(scope string) (
+	natGateways []model.NATGateway, natVMConns []model.NATVMConnection, vifs []model.VInterface, ips []model.IP, err error,
+) {
+	jNATs, err := a.getRawData(a.listURL(scope, PROVIDER_NETWORK, "natGateways", NETWORK_API_VERSION), "natGateways")
+	if err != nil {
+		return
+	}
+
+	for i := range jNATs {
+		jNAT := jNATs[i]
+		name := jNAT.Get("name").MustString()
+		if !cloudcommon.CheckJsonAttributes(jNAT, []string{"id", "name", "location", "properties"}) {
+			log.Infof("exclude nat_gateway: %s, missing attr", name, logger.NewORGPrefix(a.orgID))
+			continue
+		}
+		regionLcuuid, ok := a.getRegionLcuuid(jNAT)
+		if !ok {
+			log.Infof("exclude nat_gateway: %s, region not synced", name, logger.NewORGPrefix(a.orgID))
+			continue
+		}
+		jProps := jNAT.Get("properties")
+		var vpcLcuuid string
+		var subnetIDs []string
+		jSubnets := jProps.Get("subnets")
+		for j := range jSubnets.MustArray() {
+			subnetID := strings.ToLower(jSubnets.GetIndex(j).Get("id").MustString())
+			if network, ok := a.toolDataSet.subnetIDToNetwork[subnetID]; ok {
+				vpcLcuuid = network.VPCLcuuid
+				subnetIDs = append(subnetIDs, subnetID)
+			}
+		}
+		if vpcLcuuid == "" {
+			log.Infof("exclude nat_gateway: %s, not associated with subnet", name, logger.NewORGPrefix(a.orgID))
+			continue
+		}
+
+		var floatingIPs []string
+		jPublicIPs := jProps.Get("publicIpAddresses")
+		for j := range jPublicIPs.MustArray() {
+			if ip, ok := a.toolDataSet.publicIPIDToIP[strings.ToLower(jPublicIPs.GetIndex(j).Get("id").MustString())]; ok {
+				floatingIPs = append(floatingIPs, ip)
+			}
+		}
+		natLcuuid := a.idToLcuuid(jNAT.Get("id").MustString())
+		natGateways = append(
+			natGateways,
+			model.NATGateway{
+				Lcuuid:       natLcuuid,
+				Name:         name,
+				Label:        jProps.Get("resourceGuid").MustString(),
+				FloatingIPs:  strings.Join(floatingIPs, common.STRINGS_JOIN_COMMA),
+				VPCLcuuid:    vpcLcuuid,
+				RegionLcuuid: regionLcuuid,
+			},
+		)
+		a.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+
+		vifLcuuid := common.GenerateUUIDByOrgID(a.orgID, natLcuuid)
+		vifs = append(
+			vifs,
+			model.VInterface{
+				Lcuuid:        vifLcuuid,
+				Type:          common.VIF_TYPE_WAN,
+				Mac:           common.VIF_DEFAULT_MAC,
+				DeviceLcuuid:  natLcuuid,
+				DeviceType:    common.VIF_DEVICE_TYPE_NAT_GATEWAY,
+				NetworkLcuuid: common.NETWORK_ISP_LCUUID,
+				VPCLcuuid:     vpcLcuuid,
+				RegionLcuuid:  regionLcuuid,
+			},
+		)
+		for _, ip := range floatingIPs {
+			ips = append(
+				ips,
+				model.IP{
+					Lcuuid:           common.GenerateUUIDByOrgID(a.orgID, vifLcuuid+ip),
+					VInterfaceLcuuid: vifLcuuid,
+					IP:               ip,
+					RegionLcuuid:     regionLcuuid,
+				},
+			)
+		}
+
+		vmKeys := map[string]bool{}
+		for _, subnetID := range subnetIDs {
+			for _, vmLcuuid := range a.toolDataSet.subnetIDToVMLcuuids[subnetID] {
+				if vmKeys[vmLcuuid] {
+					continue
+				}
+				vmKeys[vmLcuuid] = true
+				natVMConns = append(
+					natVMConns,
+					model.NATVMConnection{
+						Lcuuid:           common.GenerateUUIDByOrgID(a.orgID, natLcuuid+vmLcuuid),
+						NATGatewayLcuuid: natLcuuid,
+						VMLcuuid:         vmLcuuid,
+					},
+				)
+			}
+		}
+	}
+	return
+}
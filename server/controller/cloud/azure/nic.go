@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package azure
+
+import (
+	"strings"
+
+	"github.com/deepflowio/deepflow/server/controller/common"
+)
+
+// getPublicIPs 缓存已分配地址的公网ip，由绑定的网卡、负载均衡器及NAT网关使用
+func (a *Azure) getPublicIPs(scope string) error {
+	jPublicIPs, err := a.getRawData(a.listURL(scope, PROVIDER_NETWORK, "publicIPAddresses", NETWORK_API_VERSION), "publicIPAddresses")
+	if err != nil {
+		return err
+	}
+	for i := range jPublicIPs {
+		jIP := jPublicIPs[i]
+		ip := jIP.Get("properties").Get("ipAddress").MustString()
+		if ip == "" {
+			continue
+		}
+		a.toolDataSet.publicIPIDToIP[strings.ToLower(jIP.Get("id").MustString())] = ip
+	}
+	return nil
+}
+
+// getNICs 缓存网卡信息，在同步云主机时生成接口及ip
+func (a *Azure) getNICs(scope string) error {
+	jNICs, err := a.getRawData(a.listURL(scope, PROVIDER_NETWORK, "networkInterfaces", NETWORK_API_VERSION), "networkInterfaces")
+	if err != nil {
+		return err
+	}
+	for i := range jNICs {
+		if id := jNICs[i].Get("id").MustString(); id != "" {
+			a.toolDataSet.nicIDToNIC[strings.ToLower(id)] = jNICs[i]
+		}
+	}
+	return nil
+}
+
+// azure中mac地址格式为00-0D-3A-12-34-56
+func formatMac(mac string) string {
+	if mac == "" {
+		return common.VIF_DEFAULT_MAC
+	}
+	return strings.ToLower(strings.ReplaceAll(mac, "-", ":"))
+}
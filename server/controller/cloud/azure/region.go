@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package azure
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bitly/go-simplejson"
+
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+// getRegions 同步订阅中可用的物理区域，include_regions可使用区域名称(eastus)或显示名称(East US)
+func (a *Azure) getRegions(subscriptionID string) ([]model.Region, error) {
+	jLocations, err := a.getRawData(
+		fmt.Sprintf("%s/subscriptions/%s/locations?api-version=%s", a.config.ResourceManagerEndpoint, subscriptionID, SUBSCRIPTION_API_VERSION), "locations",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var regions []model.Region
+	for i := range jLocations {
+		jl := jLocations[i]
+		name := jl.Get("name").MustString()
+		displayName := jl.Get("displayName").MustString()
+		if name == "" || jl.Get("metadata").Get("regionType").MustString("Physical") != "Physical" {
+			continue
+		}
+		if len(a.config.IncludeRegions) > 0 {
+			_, nameIncluded := a.config.IncludeRegions[name]
+			_, displayNameIncluded := a.config.IncludeRegions[displayName]
+			if !nameIncluded && !displayNameIncluded {
+				log.Infof("exclude region: %s, not included", name, logger.NewORGPrefix(a.orgID))
+				continue
+			}
+		}
+		if _, ok := a.toolDataSet.locationToRegionLcuuid[name]; ok {
+			continue
+		}
+		if displayName == "" {
+			displayName = name
+		}
+		lcuuid := a.config.RegionLcuuid
+		if lcuuid == "" {
+			lcuuid = common.GenerateUUIDByOrgID(a.orgID, name+"_"+a.lcuuidGenerate)
+			regions = append(
+				regions,
+				model.Region{
+					Lcuuid: lcuuid,
+					Label:  name,
+					Name:   displayName,
+				},
+			)
+		}
+		a.toolDataSet.locationToRegionLcuuid[name] = lcuuid
+	}
+	return regions, nil
+}
+
+// getRegionLcuuid 资源所在区域未同步时返回false
+func (a *Azure) getRegionLcuuid(j *simplejson.Json) (string, bool) {
+	location := strings.ToLower(strings.ReplaceAll(j.Get("location").MustString(), " ", ""))
+	lcuuid, ok := a.toolDataSet.locationToRegionLcuuid[location]
+	return lcuuid, ok
+}
+
+// azure中可用区只是区域内的编号(1/2/3)，未指定可用区的资源统一放入以区域命名的可用区中
+func (a *Azure) getAZLcuuid(j *simplejson.Json, regionLcuuid string) string {
+	location := strings.ToLower(j.Get("location").MustString())
+	zone := ""
+	if zones := j.Get("zones").MustStringArray(); len(zones) > 0 {
+		zone = zones[0]
+	}
+	lcuuid := common.GenerateUUIDByOrgID(a.orgID, location+"_"+zone+"_"+a.lcuuidGenerate)
+	if _, ok := a.toolDataSet.azLcuuidToAZ[lcuuid]; !ok {
+		name := location
+		if zone != "" {
+			name = location + "-" + zone
+		}
+		a.toolDataSet.azLcuuidToAZ[lcuuid] = model.AZ{
+			Lcuuid:       lcuuid,
+			Label:        zone,
+			Name:         name,
+			RegionLcuuid: regionLcuuid,
+		}
+	}
+	return lcuuid
+}
+
+func (a *Azure) getAZs() []model.AZ {
+	var azs []model.AZ
+	for _, az := range a.toolDataSet.azLcuuidToAZ {
+		azs = append(azs, az)
+	}
+	sort.Slice(azs, func(i, j int) bool { return azs[i].Name < azs[j].Name })
+	return azs
+}
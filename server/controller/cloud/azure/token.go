@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package azure
+
+import (
+	"errors"
+	"net/url"
+	"time"
+)
+
+type Token struct {
+	token     string
+	expiresAt time.Time
+}
+
+// 检查token是否过期，离失效时间小于5m即认为过期
+func (t *Token) isExpired() bool {
+	return time.Until(t.expiresAt).Minutes() < 5
+}
+
+func (a *Azure) getToken() (*Token, error) {
+	if a.token == nil || a.token.isExpired() {
+		t, err := a.createToken()
+		if err != nil {
+			return nil, err
+		}
+		a.token = t
+	}
+	return a.token, nil
+}
+
+// 使用应用(service principal)的client credentials获取resource manager的访问token
+func (a *Azure) createToken() (*Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", a.config.ClientID)
+	form.Set("client_secret", a.config.ClientSecret)
+	form.Set("scope", a.config.ResourceManagerEndpoint+"/.default")
+	resp, err := RequestToken(a.config.AuthorityHost+"/"+a.config.TenantID+"/oauth2/v2.0/token", time.Duration(a.httpTimeout), form)
+	if err != nil {
+		return nil, err
+	}
+	token := &Token{
+		token:     resp.Get("access_token").MustString(),
+		expiresAt: time.Now().Add(time.Duration(resp.Get("expires_in").MustInt(3600)) * time.Second),
+	}
+	if token.token == "" {
+		return nil, errors.New("azure token response has no access_token")
+	}
+	return token, nil
+}
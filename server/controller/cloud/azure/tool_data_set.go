@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package azure
+
+import (
+	"github.com/bitly/go-simplejson"
+
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+)
+
+type ToolDataSet struct {
+	locationToRegionLcuuid  map[string]string
+	azLcuuidToAZ            map[string]model.AZ
+	vnetIDToVPCLcuuid       map[string]string
+	vpcLcuuidToRegionLcuuid map[string]string
+	subnetIDToNetwork       map[string]model.Network
+	networkLcuuidToSubnets  map[string][]model.Subnet
+	subnetIDToVMLcuuids     map[string][]string
+	publicIPIDToIP          map[string]string
+	nicIDToNIC              map[string]*simplejson.Json
+	ipConfigIDToVMIP        map[string]VMIP
+	peerings                []peering
+
+	regionLcuuidToResourceNum map[string]int
+	azLcuuidToResourceNum     map[string]int
+}
+
+func NewToolDataSet() *ToolDataSet {
+	return &ToolDataSet{
+		locationToRegionLcuuid:    make(map[string]string),
+		azLcuuidToAZ:              make(map[string]model.AZ),
+		vnetIDToVPCLcuuid:         make(map[string]string),
+		vpcLcuuidToRegionLcuuid:   make(map[string]string),
+		subnetIDToNetwork:         make(map[string]model.Network),
+		networkLcuuidToSubnets:    make(map[string][]model.Subnet),
+		subnetIDToVMLcuuids:       make(map[string][]string),
+		publicIPIDToIP:            make(map[string]string),
+		nicIDToNIC:                make(map[string]*simplejson.Json),
+		ipConfigIDToVMIP:          make(map[string]VMIP),
+		regionLcuuidToResourceNum: make(map[string]int),
+		azLcuuidToResourceNum:     make(map[string]int),
+	}
+}
+
+// VMIP 网卡ip配置对应的云主机及其私网ip，用于关联负载均衡后端
+type VMIP struct {
+	VMLcuuid  string
+	VPCLcuuid string
+	IP        string
+}
+
+type peering struct {
+	name         string
+	localVNetID  string
+	remoteVNetID string
+}
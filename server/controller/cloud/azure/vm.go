@@ -0,0 +1,234 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package azure
+
+import (
+	"strings"
+	"time"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+var STATE_CONVERTION = map[string]int{
+	"PowerState/running":     common.VM_STATE_RUNNING,
+	"PowerState/stopped":     common.VM_STATE_STOPPED,
+	"PowerState/deallocated": common.VM_STATE_STOPPED,
+}
+
+func (a *Azure) getVMs(scope string) ([]model.VM, []model.VInterface, []model.IP, []model.FloatingIP, error) {
+	// statusOnly=true时返回instanceView，用于获取运行状态
+	jVMs, err := a.getRawData(a.listURL(scope, PROVIDER_COMPUTE, "virtualMachines", COMPUTE_API_VERSION)+"&statusOnly=true", "virtualMachines")
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	var vms []model.VM
+	var vifs []model.VInterface
+	var ips []model.IP
+	var fIPs []model.FloatingIP
+	for i := range jVMs {
+		jVM := jVMs[i]
+		name := jVM.Get("name").MustString()
+		if !cloudcommon.CheckJsonAttributes(jVM, []string{"id", "name", "location", "properties"}) {
+			log.Infof("exclude vm: %s, missing attr", name, logger.NewORGPrefix(a.orgID))
+			continue
+		}
+		regionLcuuid, ok := a.getRegionLcuuid(jVM)
+		if !ok {
+			log.Infof("exclude vm: %s, region not synced", name, logger.NewORGPrefix(a.orgID))
+			continue
+		}
+		jProps := jVM.Get("properties")
+		var nicIDs []string
+		jNICRefs := jProps.Get("networkProfile").Get("networkInterfaces")
+		for j := range jNICRefs.MustArray() {
+			nicID := strings.ToLower(jNICRefs.GetIndex(j).Get("id").MustString())
+			if _, ok := a.toolDataSet.nicIDToNIC[nicID]; !ok {
+				continue
+			}
+			// 主网卡放在首位，用于确定云主机所属VPC
+			if jNICRefs.GetIndex(j).Get("properties").Get("primary").MustBool() {
+				nicIDs = append([]string{nicID}, nicIDs...)
+			} else {
+				nicIDs = append(nicIDs, nicID)
+			}
+		}
+		if len(nicIDs) == 0 {
+			log.Infof("exclude vm: %s, missing nic info", name, logger.NewORGPrefix(a.orgID))
+			continue
+		}
+		primaryNetwork, ok := a.getNICNetwork(nicIDs[0])
+		if !ok {
+			log.Infof("exclude vm: %s, missing network info", name, logger.NewORGPrefix(a.orgID))
+			continue
+		}
+
+		state := common.VM_STATE_EXCEPTION
+		jStatuses := jProps.Get("instanceView").Get("statuses")
+		for j := range jStatuses.MustArray() {
+			if s, ok := STATE_CONVERTION[jStatuses.GetIndex(j).Get("code").MustString()]; ok {
+				state = s
+			}
+		}
+		vmLcuuid := a.idToLcuuid(jVM.Get("id").MustString())
+		azLcuuid := a.getAZLcuuid(jVM, regionLcuuid)
+		vm := model.VM{
+			Lcuuid:       vmLcuuid,
+			Name:         name,
+			Label:        jProps.Get("vmId").MustString(),
+			HType:        common.VM_HTYPE_VM_C,
+			State:        state,
+			VPCLcuuid:    primaryNetwork.VPCLcuuid,
+			AZLcuuid:     azLcuuid,
+			RegionLcuuid: regionLcuuid,
+			CloudTags:    getTags(jVM),
+		}
+		if created := jProps.Get("timeCreated").MustString(); created != "" {
+			createdAt, err := time.Parse(time.RFC3339, created)
+			if err != nil {
+				log.Errorf("parse created failed: %s", created, logger.NewORGPrefix(a.orgID))
+			} else {
+				vm.CreatedAt = createdAt
+			}
+		}
+		vms = append(vms, vm)
+		a.toolDataSet.azLcuuidToResourceNum[azLcuuid]++
+		a.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+
+		for _, nicID := range nicIDs {
+			nicVIFs, nicIPs, nicFIPs := a.getVMNICResources(nicID, vm)
+			vifs = append(vifs, nicVIFs...)
+			ips = append(ips, nicIPs...)
+			fIPs = append(fIPs, nicFIPs...)
+		}
+	}
+	return vms, vifs, ips, fIPs, nil
+}
+
+// getNICNetwork 使用网卡首个ip配置所在的子网作为网卡所属网络
+func (a *Azure) getNICNetwork(nicID string) (model.Network, bool) {
+	jIPConfigs := a.toolDataSet.nicIDToNIC[nicID].Get("properties").Get("ipConfigurations")
+	for i := range jIPConfigs.MustArray() {
+		subnetID := strings.ToLower(jIPConfigs.GetIndex(i).Get("properties").Get("subnet").Get("id").MustString())
+		if network, ok := a.toolDataSet.subnetIDToNetwork[subnetID]; ok {
+			return network, true
+		}
+	}
+	return model.Network{}, false
+}
+
+// getVMNICResources 生成云主机网卡的接口及私网ip，网卡绑定的公网ip作为浮动ip并生成对应的公网接口
+func (a *Azure) getVMNICResources(nicID string, vm model.VM) (vifs []model.VInterface, ips []model.IP, fIPs []model.FloatingIP) {
+	network, ok := a.getNICNetwork(nicID)
+	if !ok {
+		log.Infof("exclude vinterface: %s, missing network info", nicID, logger.NewORGPrefix(a.orgID))
+		return
+	}
+	jNIC := a.toolDataSet.nicIDToNIC[nicID]
+	vifLcuuid := a.idToLcuuid(nicID)
+	mac := formatMac(jNIC.Get("properties").Get("macAddress").MustString())
+	vifs = append(
+		vifs,
+		model.VInterface{
+			Lcuuid:        vifLcuuid,
+			Name:          jNIC.Get("name").MustString(),
+			Type:          common.VIF_TYPE_LAN,
+			Mac:           mac,
+			DeviceType:    common.VIF_DEVICE_TYPE_VM,
+			DeviceLcuuid:  vm.Lcuuid,
+			NetworkLcuuid: network.Lcuuid,
+			VPCLcuuid:     network.VPCLcuuid,
+			RegionLcuuid:  vm.RegionLcuuid,
+		},
+	)
+
+	jIPConfigs := jNIC.Get("properties").Get("ipConfigurations")
+	for i := range jIPConfigs.MustArray() {
+		jIPConfig := jIPConfigs.GetIndex(i)
+		jProps := jIPConfig.Get("properties")
+		ip := jProps.Get("privateIPAddress").MustString()
+		if ip == "" {
+			continue
+		}
+		subnetID := strings.ToLower(jProps.Get("subnet").Get("id").MustString())
+		ipNetwork, ok := a.toolDataSet.subnetIDToNetwork[subnetID]
+		if !ok {
+			ipNetwork = network
+		}
+		ips = append(
+			ips,
+			model.IP{
+				Lcuuid:           common.GenerateUUIDByOrgID(a.orgID, vifLcuuid+ip),
+				VInterfaceLcuuid: vifLcuuid,
+				IP:               ip,
+				SubnetLcuuid:     a.getSubnetLcuuid(ipNetwork.Lcuuid, ip),
+				RegionLcuuid:     vm.RegionLcuuid,
+			},
+		)
+		a.toolDataSet.ipConfigIDToVMIP[strings.ToLower(jIPConfig.Get("id").MustString())] = VMIP{
+			VMLcuuid:  vm.Lcuuid,
+			VPCLcuuid: vm.VPCLcuuid,
+			IP:        ip,
+		}
+		if !common.Contains(a.toolDataSet.subnetIDToVMLcuuids[subnetID], vm.Lcuuid) {
+			a.toolDataSet.subnetIDToVMLcuuids[subnetID] = append(a.toolDataSet.subnetIDToVMLcuuids[subnetID], vm.Lcuuid)
+		}
+
+		publicIP, ok := a.toolDataSet.publicIPIDToIP[strings.ToLower(jProps.Get("publicIPAddress").Get("id").MustString())]
+		if !ok {
+			continue
+		}
+		wanVIFLcuuid := common.GenerateUUIDByOrgID(a.orgID, vm.Lcuuid+publicIP)
+		vifs = append(
+			vifs,
+			model.VInterface{
+				Lcuuid:        wanVIFLcuuid,
+				Type:          common.VIF_TYPE_WAN,
+				Mac:           cloudcommon.GenerateWANVInterfaceMac(mac),
+				DeviceType:    common.VIF_DEVICE_TYPE_VM,
+				DeviceLcuuid:  vm.Lcuuid,
+				NetworkLcuuid: common.NETWORK_ISP_LCUUID,
+				VPCLcuuid:     vm.VPCLcuuid,
+				RegionLcuuid:  vm.RegionLcuuid,
+			},
+		)
+		ips = append(
+			ips,
+			model.IP{
+				Lcuuid:           common.GenerateUUIDByOrgID(a.orgID, wanVIFLcuuid+publicIP),
+				VInterfaceLcuuid: wanVIFLcuuid,
+				IP:               publicIP,
+				RegionLcuuid:     vm.RegionLcuuid,
+			},
+		)
+		fIPs = append(
+			fIPs,
+			model.FloatingIP{
+				Lcuuid:        common.GenerateUUIDByOrgID(a.orgID, vm.Lcuuid+publicIP),
+				IP:            publicIP,
+				VMLcuuid:      vm.Lcuuid,
+				NetworkLcuuid: common.NETWORK_ISP_LCUUID,
+				VPCLcuuid:     vm.VPCLcuuid,
+				RegionLcuuid:  vm.RegionLcuuid,
+			},
+		)
+	}
+	return
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package azure
+
+import (
+	"sort"
+	"strings"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+// getVNets 每个VNet对应一个VPC，VNet中的每个子网对应一个网络
+func (a *Azure) getVNets(scope string) ([]model.VPC, []model.Network, []model.Subnet, error) {
+	jVNets, err := a.getRawData(a.listURL(scope, PROVIDER_NETWORK, "virtualNetworks", NETWORK_API_VERSION), "virtualNetworks")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var vpcs []model.VPC
+	var networks []model.Network
+	var subnets []model.Subnet
+	for i := range jVNets {
+		jVNet := jVNets[i]
+		name := jVNet.Get("name").MustString()
+		if !cloudcommon.CheckJsonAttributes(jVNet, []string{"id", "name", "location", "properties"}) {
+			log.Infof("exclude vpc: %s, missing attr", name, logger.NewORGPrefix(a.orgID))
+			continue
+		}
+		regionLcuuid, ok := a.getRegionLcuuid(jVNet)
+		if !ok {
+			log.Infof("exclude vpc: %s, region not synced", name, logger.NewORGPrefix(a.orgID))
+			continue
+		}
+		vnetID := jVNet.Get("id").MustString()
+		vpcLcuuid := a.idToLcuuid(vnetID)
+		jProps := jVNet.Get("properties")
+		vpc := model.VPC{
+			Lcuuid:       vpcLcuuid,
+			Name:         name,
+			Label:        jProps.Get("resourceGuid").MustString(),
+			RegionLcuuid: regionLcuuid,
+		}
+		if prefixes := jProps.Get("addressSpace").Get("addressPrefixes").MustStringArray(); len(prefixes) > 0 {
+			vpc.CIDR = prefixes[0]
+		}
+		vpcs = append(vpcs, vpc)
+		a.toolDataSet.vnetIDToVPCLcuuid[strings.ToLower(vnetID)] = vpcLcuuid
+		a.toolDataSet.vpcLcuuidToRegionLcuuid[vpcLcuuid] = regionLcuuid
+		a.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+
+		jSubnets := jProps.Get("subnets")
+		for j := range jSubnets.MustArray() {
+			jSubnet := jSubnets.GetIndex(j)
+			subnetID := jSubnet.Get("id").MustString()
+			subnetName := jSubnet.Get("name").MustString()
+			// 子网可能使用addressPrefix或addressPrefixes(多个地址段)描述
+			cidrs := jSubnet.Get("properties").Get("addressPrefixes").MustStringArray()
+			if cidr := jSubnet.Get("properties").Get("addressPrefix").MustString(); cidr != "" {
+				cidrs = append([]string{cidr}, cidrs...)
+			}
+			if subnetID == "" || len(cidrs) == 0 {
+				log.Infof("exclude network: %s, missing attr", subnetName, logger.NewORGPrefix(a.orgID))
+				continue
+			}
+			networkLcuuid := a.idToLcuuid(subnetID)
+			network := model.Network{
+				Lcuuid:       networkLcuuid,
+				Name:         subnetName,
+				Label:        name + "/" + subnetName,
+				NetType:      common.NETWORK_TYPE_LAN,
+				VPCLcuuid:    vpcLcuuid,
+				RegionLcuuid: regionLcuuid,
+			}
+			networks = append(networks, network)
+			a.toolDataSet.subnetIDToNetwork[strings.ToLower(subnetID)] = network
+			a.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+
+			for _, cidr := range cidrs {
+				subnet := model.Subnet{
+					Lcuuid:        common.GenerateUUIDByOrgID(a.orgID, networkLcuuid+cidr),
+					Name:          subnetName,
+					CIDR:          cidr,
+					NetworkLcuuid: networkLcuuid,
+					VPCLcuuid:     vpcLcuuid,
+				}
+				subnets = append(subnets, subnet)
+				a.toolDataSet.networkLcuuidToSubnets[networkLcuuid] = append(a.toolDataSet.networkLcuuidToSubnets[networkLcuuid], subnet)
+			}
+		}
+
+		jPeerings := jProps.Get("virtualNetworkPeerings")
+		for j := range jPeerings.MustArray() {
+			jPeering := jPeerings.GetIndex(j)
+			if jPeering.Get("properties").Get("peeringState").MustString() != "Connected" {
+				continue
+			}
+			a.toolDataSet.peerings = append(
+				a.toolDataSet.peerings,
+				peering{
+					name:         jPeering.Get("name").MustString(),
+					localVNetID:  strings.ToLower(vnetID),
+					remoteVNetID: strings.ToLower(jPeering.Get("properties").Get("remoteVirtualNetwork").Get("id").MustString()),
+				},
+			)
+		}
+	}
+	return vpcs, networks, subnets, nil
+}
+
+// getPeerConnections azure中对等连接需要在两端VNet中分别创建，两端只生成一条对等连接
+func (a *Azure) getPeerConnections() []model.PeerConnection {
+	var peerConns []model.PeerConnection
+	keys := make(map[string]bool)
+	for _, p := range a.toolDataSet.peerings {
+		localVPCLcuuid, ok := a.toolDataSet.vnetIDToVPCLcuuid[p.localVNetID]
+		if !ok {
+			continue
+		}
+		remoteVPCLcuuid, ok := a.toolDataSet.vnetIDToVPCLcuuid[p.remoteVNetID]
+		if !ok {
+			log.Infof("exclude peer_connection: %s, remote vpc not synced", p.name, logger.NewORGPrefix(a.orgID))
+			continue
+		}
+		pair := []string{p.localVNetID, p.remoteVNetID}
+		sort.Strings(pair)
+		key := strings.Join(pair, ",")
+		if keys[key] {
+			continue
+		}
+		keys[key] = true
+		peerConns = append(
+			peerConns,
+			model.PeerConnection{
+				Lcuuid:             common.GenerateUUIDByOrgID(a.orgID, key),
+				Name:               p.name,
+				Label:              p.name,
+				LocalVPCLcuuid:     localVPCLcuuid,
+				RemoteVPCLcuuid:    remoteVPCLcuuid,
+				LocalRegionLcuuid:  a.toolDataSet.vpcLcuuidToRegionLcuuid[localVPCLcuuid],
+				RemoteRegionLcuuid: a.toolDataSet.vpcLcuuidToRegionLcuuid[remoteVPCLcuuid],
+			},
+		)
+	}
+	return peerConns
+}
+
+func (a *Azure) getSubnetLcuuid(networkLcuuid, ip string) string {
+	subnets := a.toolDataSet.networkLcuuidToSubnets[networkLcuuid]
+	for _, subnet := range subnets {
+		if cloudcommon.IsIPInCIDR(ip, subnet.CIDR) {
+			return subnet.Lcuuid
+		}
+	}
+	if len(subnets) > 0 {
+		return subnets[0].Lcuuid
+	}
+	return ""
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gcp
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/bitly/go-simplejson"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+const (
+	DEFAULT_TOKEN_URI        = "https://oauth2.googleapis.com/token"
+	DEFAULT_COMPUTE_ENDPOINT = "https://compute.googleapis.com/compute/v1"
+)
+
+type Config struct {
+	RegionLcuuid    string
+	ClientEmail     string
+	PrivateKeyID    string
+	PrivateKey      string
+	TokenURI        string
+	ComputeEndpoint string
+	ProjectIDs      []string // 为空时使用服务账号所属项目
+	IncludeRegions  map[string]bool
+}
+
+func (c *Config) LoadFromString(orgID int, sConf string) (err error) {
+	jConf, err := simplejson.NewJson([]byte(sConf))
+	if err != nil {
+		log.Errorf("convert config string: %s to json failed: %v", sConf, err, logger.NewORGPrefix(orgID))
+		return
+	}
+	key, err := jConf.Get("service_account_key").String()
+	if err != nil {
+		log.Error("service_account_key must be specified", logger.NewORGPrefix(orgID))
+		return
+	}
+	dkey, err := common.DecryptSecretKey(key)
+	if err != nil {
+		log.Errorf("decrypt service_account_key failed (%s)", err.Error(), logger.NewORGPrefix(orgID))
+		return
+	}
+	if err = c.loadServiceAccountKey(dkey); err != nil {
+		log.Error(err.Error(), logger.NewORGPrefix(orgID))
+		return
+	}
+
+	var projectIDs []string
+	for _, p := range strings.Split(jConf.Get("project_ids").MustString(), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			projectIDs = append(projectIDs, p)
+		}
+	}
+	if len(projectIDs) > 0 {
+		c.ProjectIDs = projectIDs
+	}
+	if len(c.ProjectIDs) == 0 {
+		err = errors.New("project_ids must be specified when service_account_key has no project_id")
+		log.Error(err.Error(), logger.NewORGPrefix(orgID))
+		return
+	}
+	c.ComputeEndpoint = strings.TrimSuffix(jConf.Get("compute_endpoint").MustString(DEFAULT_COMPUTE_ENDPOINT), "/")
+	c.RegionLcuuid = jConf.Get("region_uuid").MustString()
+	c.IncludeRegions = cloudcommon.UniqRegions(jConf.Get("include_regions").MustString())
+	return
+}
+
+// loadServiceAccountKey 解析服务账号的json密钥文件
+func (c *Config) loadServiceAccountKey(key string) error {
+	jKey, err := simplejson.NewJson([]byte(key))
+	if err != nil {
+		return errors.New("service_account_key must be a json key file of service account")
+	}
+	if jKey.Get("type").MustString() != "service_account" {
+		return errors.New("service_account_key type must be service_account")
+	}
+	c.ClientEmail = jKey.Get("client_email").MustString()
+	c.PrivateKeyID = jKey.Get("private_key_id").MustString()
+	c.PrivateKey = jKey.Get("private_key").MustString()
+	if c.ClientEmail == "" || c.PrivateKey == "" {
+		return errors.New("service_account_key must contain client_email and private_key")
+	}
+	c.TokenURI = jKey.Get("token_uri").MustString(DEFAULT_TOKEN_URI)
+	if projectID := jKey.Get("project_id").MustString(); projectID != "" {
+		c.ProjectIDs = []string{projectID}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+)
+
+func newErr(url, msg string) error {
+	return errors.New(fmt.Sprintf("request url: %s, %s", url, msg))
+}
+
+func RequestGet(url, token string, timeout time.Duration) (*simplejson.Json, error) {
+	log.Debugf("url: %s", url)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		err = newErr(url, fmt.Sprintf("new request failed: %s", err.Error()))
+		log.Errorf(err.Error())
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	return doRequest(url, req, timeout)
+}
+
+// RequestPost 用于compute api中以POST方式调用的列表接口，如instanceGroups.listInstances
+func RequestPost(url, token string, timeout time.Duration, body map[string]interface{}) (*simplejson.Json, error) {
+	log.Debugf("url: %s", url)
+	bodyStr, _ := json.Marshal(&body)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(bodyStr))
+	if err != nil {
+		err = newErr(url, fmt.Sprintf("new request failed: %s", err.Error()))
+		log.Errorf(err.Error())
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	return doRequest(url, req, timeout)
+}
+
+// RequestToken 使用表单提交获取oauth2 token
+func RequestToken(url string, timeout time.Duration, form url.Values) (*simplejson.Json, error) {
+	log.Debugf("url: %s", url)
+	req, err := http.NewRequest("POST", url, strings.NewReader(form.Encode()))
+	if err != nil {
+		err = newErr(url, fmt.Sprintf("new request failed: %s", err.Error()))
+		log.Errorf(err.Error())
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doRequest(url, req, timeout)
+}
+
+func doRequest(url string, req *http.Request, timeout time.Duration) (*simplejson.Json, error) {
+	client := cloudcommon.GetUnverifyHTTPClient(time.Second * timeout)
+	resp, err := client.Do(req)
+	if err != nil {
+		err = newErr(url, fmt.Sprintf("failed: %s", err.Error()))
+		log.Errorf(err.Error())
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		err = newErr(url, fmt.Sprintf("read failed: %s", err.Error()))
+		log.Errorf(err.Error())
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = newErr(url, fmt.Sprintf("failed: status %d, %s", resp.StatusCode, string(respBody)))
+		log.Errorf(err.Error())
+		return nil, err
+	}
+	jsonResp, err := simplejson.NewJson(respBody)
+	if err != nil {
+		err = newErr(url, fmt.Sprintf("JSONiz failed: %s", err.Error()))
+		log.Errorf(err.Error())
+		return nil, err
+	}
+	return jsonResp, nil
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gcp
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/config"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
+	"github.com/deepflowio/deepflow/server/controller/statsd"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+var log = logger.MustGetLogger("cloud.gcp")
+
+// 分页查询时每页的数量
+const PAGE_LIMIT = 500
+
+type GCP struct {
+	orgID          int
+	teamID         int
+	lcuuid         string
+	lcuuidGenerate string
+	name           string
+	httpTimeout    int
+	config         *Config
+	token          *Token
+	toolDataSet    *ToolDataSet       // 处理资源数据时，构建的需要提供给其他资源使用的工具数据
+	cloudStatsd    statsd.CloudStatsd // 性能监控
+	debugger       *cloudcommon.Debugger
+}
+
+func NewGCP(orgID int, domain metadbmodel.Domain, globalCloudCfg config.CloudConfig) (*GCP, error) {
+	conf := &Config{}
+	err := conf.LoadFromString(orgID, domain.Config)
+	if err != nil {
+		return nil, err
+	}
+	return &GCP{
+		orgID:  orgID,
+		teamID: domain.TeamID,
+		lcuuid: domain.Lcuuid,
+		// TODO: display_name后期需要修改为uuid_generate
+		lcuuidGenerate: domain.DisplayName,
+		name:           domain.Name,
+		httpTimeout:    globalCloudCfg.HTTPTimeout,
+		config:         conf,
+		debugger:       cloudcommon.NewDebugger(domain.Name),
+	}, nil
+}
+
+func (g *GCP) ClearDebugLog() {
+	g.debugger.Clear()
+}
+
+func (g *GCP) CheckAuth() error {
+	_, err := g.createToken()
+	return err
+}
+
+func (g *GCP) GetCloudData() (model.Resource, error) {
+	g.cloudStatsd = statsd.NewCloudStatsd()
+	g.toolDataSet = NewToolDataSet()
+	var resource model.Resource
+	if _, err := g.getToken(); err != nil {
+		return resource, err
+	}
+
+	for _, project := range g.config.ProjectIDs {
+		regions, azs, err := g.getRegionsAndZones(project)
+		if err != nil {
+			return resource, err
+		}
+		resource.Regions = append(resource.Regions, regions...)
+		resource.AZs = append(resource.AZs, azs...)
+
+		if err := g.getNetworks(project); err != nil {
+			return resource, err
+		}
+		networks, subnets, err := g.getSubnetworks(project)
+		if err != nil {
+			return resource, err
+		}
+		resource.Networks = append(resource.Networks, networks...)
+		resource.Subnets = append(resource.Subnets, subnets...)
+
+		if err := g.getAddresses(project); err != nil {
+			return resource, err
+		}
+
+		vms, vifs, ips, fIPs, err := g.getVMs(project)
+		if err != nil {
+			return resource, err
+		}
+		resource.VMs = append(resource.VMs, vms...)
+		resource.VInterfaces = append(resource.VInterfaces, vifs...)
+		resource.IPs = append(resource.IPs, ips...)
+		resource.FloatingIPs = append(resource.FloatingIPs, fIPs...)
+
+		lbs, listeners, targetServers, lbVMConns, vifs, ips, err := g.getLBs(project)
+		if err != nil {
+			return resource, err
+		}
+		resource.LBs = append(resource.LBs, lbs...)
+		resource.LBListeners = append(resource.LBListeners, listeners...)
+		resource.LBTargetServers = append(resource.LBTargetServers, targetServers...)
+		resource.LBVMConnections = append(resource.LBVMConnections, lbVMConns...)
+		resource.VInterfaces = append(resource.VInterfaces, vifs...)
+		resource.IPs = append(resource.IPs, ips...)
+
+		natGateways, natVMConns, vifs, ips, err := g.getNATGateways(project)
+		if err != nil {
+			return resource, err
+		}
+		resource.NATGateways = append(resource.NATGateways, natGateways...)
+		resource.NATVMConnections = append(resource.NATVMConnections, natVMConns...)
+		resource.VInterfaces = append(resource.VInterfaces, vifs...)
+		resource.IPs = append(resource.IPs, ips...)
+	}
+	resource.VPCs = g.getVPCs()
+	// 对等连接的两端可能位于不同项目中，在全部网络同步后处理
+	resource.PeerConnections = g.getPeerConnections()
+
+	log.Debugf("region resource num info: %v", g.toolDataSet.regionLcuuidToResourceNum, logger.NewORGPrefix(g.orgID))
+	log.Debugf("az resource num info: %v", g.toolDataSet.azLcuuidToResourceNum, logger.NewORGPrefix(g.orgID))
+	resource.Regions = cloudcommon.EliminateEmptyRegions(resource.Regions, g.toolDataSet.regionLcuuidToResourceNum)
+	resource.AZs = cloudcommon.EliminateEmptyAZs(resource.AZs, g.toolDataSet.azLcuuidToResourceNum)
+
+	g.cloudStatsd.ResCount = statsd.GetResCount(resource)
+	statsd.MetaStatsd.RegisterStatsdTable(g)
+
+	g.debugger.Refresh()
+	return resource, nil
+}
+
+func (g *GCP) GetStatter() statsd.StatsdStatter {
+	globalTags := map[string]string{
+		"domain_name": g.name,
+		"domain":      g.lcuuid,
+		"platform":    common.GCP_EN,
+	}
+
+	return statsd.StatsdStatter{
+		OrgID:      g.orgID,
+		TeamID:     g.teamID,
+		GlobalTags: globalTags,
+		Element:    statsd.GetCloudStatsd(g.cloudStatsd),
+	}
+}
+
+func (g *GCP) projectURL(project, path string) string {
+	return fmt.Sprintf("%s/projects/%s/%s", g.config.ComputeEndpoint, project, path)
+}
+
+// getRawData 请求compute api，响应中存在nextPageToken时继续查询下一页
+// aggregated为true时为聚合列表接口，items为区域/可用区到资源列表的映射，此时从resultKey中提取资源
+func (g *GCP) getRawData(rawURL, resultKey string, aggregated bool) (jsonList []*simplejson.Json, err error) {
+	statsdAPIStartTime := time.Now()
+
+	sep := "?"
+	if strings.Contains(rawURL, "?") {
+		sep = "&"
+	}
+	var pageToken string
+	for {
+		pageURL := fmt.Sprintf("%s%smaxResults=%d", rawURL, sep, PAGE_LIMIT)
+		if pageToken != "" {
+			pageURL += "&pageToken=" + url.QueryEscape(pageToken)
+		}
+		resp, err := RequestGet(pageURL, g.token.token, time.Duration(g.httpTimeout))
+		if err != nil {
+			return []*simplejson.Json{}, err
+		}
+		jItems := resp.Get("items")
+		if aggregated {
+			for scope := range jItems.MustMap() {
+				jData := jItems.Get(scope).Get(resultKey)
+				for i := range jData.MustArray() {
+					jsonList = append(jsonList, jData.GetIndex(i))
+				}
+			}
+		} else {
+			for i := range jItems.MustArray() {
+				jsonList = append(jsonList, jItems.GetIndex(i))
+			}
+		}
+		pageToken = resp.Get("nextPageToken").MustString()
+		if pageToken == "" {
+			break
+		}
+	}
+	g.cloudStatsd.RefreshAPIMoniter(resultKey, len(jsonList), statsdAPIStartTime)
+
+	g.debugger.WriteJson(resultKey, rawURL, jsonList)
+	return
+}
+
+// gcp资源间通过selfLink引用，不同接口返回的域名可能不同(www.googleapis.com/compute.googleapis.com)，统一使用projects/开始的路径
+func linkPath(selfLink string) string {
+	if i := strings.Index(selfLink, "projects/"); i >= 0 {
+		return selfLink[i:]
+	}
+	return selfLink
+}
+
+// lastSegment 获取selfLink中的资源名称，如区域或可用区名称
+func lastSegment(selfLink string) string {
+	return selfLink[strings.LastIndex(selfLink, "/")+1:]
+}
+
+func getLabels(j *simplejson.Json) map[string]string {
+	labels := map[string]string{}
+	for k, v := range j.Get("labels").MustMap() {
+		if s, ok := v.(string); ok {
+			labels[k] = s
+		}
+	}
+	return labels
+}
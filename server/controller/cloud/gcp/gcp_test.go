@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gcp
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/config"
+	cloudtest "github.com/deepflowio/deepflow/server/controller/cloud/test"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	metadbcommon "github.com/deepflowio/deepflow/server/controller/db/metadb/common"
+	"github.com/deepflowio/deepflow/server/controller/statsd"
+	statsdcfg "github.com/deepflowio/deepflow/server/controller/statsd/config"
+)
+
+// 使用录制的compute api响应模拟google oauth2及compute服务，token接口校验jwt签名
+func newFixtureServer(t *testing.T, publicKey *rsa.PublicKey) *httptest.Server {
+	prefix := "/compute/v1/projects/demo-project/"
+	fixtures := map[string]string{
+		"/token":                              "token.json",
+		prefix + "regions":                    "regions.json",
+		prefix + "zones":                      "zones.json",
+		prefix + "global/networks":            "networks.json",
+		prefix + "aggregated/subnetworks":     "subnetworks.json",
+		prefix + "aggregated/addresses":       "addresses.json",
+		prefix + "aggregated/instances":       "instances.json",
+		prefix + "aggregated/instances?page2": "instances_page2.json",
+		prefix + "aggregated/targetPools":     "target_pools.json",
+		prefix + "aggregated/backendServices": "backend_services.json",
+		prefix + "aggregated/forwardingRules": "forwarding_rules.json",
+		prefix + "aggregated/routers":         "routers.json",
+		prefix + "zones/us-central1-b/instanceGroups/db-group/listInstances": "instance_group_instances.json",
+	}
+	return cloudtest.NewFixtureServer(t, fixtures, "pageToken", func(key string, w http.ResponseWriter, r *http.Request) bool {
+		if key == "/token" {
+			parts := strings.Split(r.FormValue("assertion"), ".")
+			if r.FormValue("grant_type") != JWT_BEARER_GRANT_TYPE || len(parts) != 3 {
+				w.WriteHeader(http.StatusBadRequest)
+				return false
+			}
+			signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+			digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			if rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return false
+			}
+		} else if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		}
+		return true
+	})
+}
+
+func TestGCP(t *testing.T) {
+	Convey("TestGCP", t, func() {
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		pkcs8, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		So(err, ShouldBeNil)
+		server := newFixtureServer(t, &privateKey.PublicKey)
+		defer server.Close()
+		statsd.NewStatsdMonitor(statsdcfg.StatsdConfig{})
+		config.CONF = &config.CloudConfig{}
+
+		g := &GCP{
+			orgID:          metadbcommon.DEFAULT_ORG_ID,
+			lcuuidGenerate: "test_gcp",
+			name:           "test_gcp",
+			httpTimeout:    5,
+			config: &Config{
+				ClientEmail:     "deepflow@demo-project.iam.gserviceaccount.com",
+				PrivateKeyID:    "key-1",
+				PrivateKey:      string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})),
+				TokenURI:        server.URL + "/token",
+				ComputeEndpoint: server.URL + "/compute/v1",
+				ProjectIDs:      []string{"demo-project"},
+			},
+			debugger: cloudcommon.NewDebugger("test_gcp"),
+		}
+		So(g.CheckAuth(), ShouldBeNil)
+
+		data, err := g.GetCloudData()
+		So(err, ShouldBeNil)
+
+		Convey("gcp resource number should be equal", func() {
+			So(len(data.Regions), ShouldEqual, 2)
+			So(len(data.AZs), ShouldEqual, 2)
+			So(len(data.VPCs), ShouldEqual, 3)
+			So(len(data.Networks), ShouldEqual, 3)
+			So(len(data.Subnets), ShouldEqual, 4)
+			So(len(data.PeerConnections), ShouldEqual, 1)
+			So(len(data.VMs), ShouldEqual, 3)
+			So(len(data.VInterfaces), ShouldEqual, 7)
+			So(len(data.IPs), ShouldEqual, 7)
+			So(len(data.FloatingIPs), ShouldEqual, 1)
+			So(len(data.LBs), ShouldEqual, 2)
+			So(len(data.LBListeners), ShouldEqual, 2)
+			So(len(data.LBTargetServers), ShouldEqual, 3)
+			So(len(data.LBVMConnections), ShouldEqual, 3)
+			So(len(data.NATGateways), ShouldEqual, 1)
+			So(len(data.NATVMConnections), ShouldEqual, 1)
+		})
+
+		Convey("gcp resource relations should be correct", func() {
+			usDefaultVPCLcuuid := common.GenerateUUIDByOrgID(g.orgID, "1001_us-central1")
+			for _, vm := range data.VMs {
+				switch vm.Name {
+				case "web-1":
+					So(vm.State, ShouldEqual, common.VM_STATE_RUNNING)
+					So(vm.VPCLcuuid, ShouldEqual, usDefaultVPCLcuuid)
+				case "db-1":
+					So(vm.State, ShouldEqual, common.VM_STATE_STOPPED)
+					So(vm.VPCLcuuid, ShouldEqual, common.GenerateUUIDByOrgID(g.orgID, "1002_us-central1"))
+				}
+			}
+			So(data.FloatingIPs[0].IP, ShouldEqual, "35.0.0.1")
+			for _, lb := range data.LBs {
+				switch lb.Name {
+				case "fr-web":
+					So(lb.Model, ShouldEqual, cloudcommon.LB_MODEL_EXTERNAL)
+					So(lb.VPCLcuuid, ShouldEqual, usDefaultVPCLcuuid)
+				case "fr-db":
+					So(lb.Model, ShouldEqual, cloudcommon.LB_MODEL_INTERNAL)
+				}
+			}
+			for _, listener := range data.LBListeners {
+				if listener.Name == "fr-db" {
+					So(listener.Port, ShouldEqual, 5432)
+				} else {
+					So(listener.Port, ShouldEqual, 80)
+				}
+			}
+			So(data.NATGateways[0].FloatingIPs, ShouldEqual, "34.0.0.10")
+			So(data.NATVMConnections[0].VMLcuuid, ShouldEqual, common.GenerateUUIDByOrgID(g.orgID, "3002"))
+		})
+	})
+}
@@ -0,0 +1,254 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gcp
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+// getLBs 每条区域级转发规则对应一个负载均衡器及一个监听器，后端为目标池或后端服务中实例组的云主机
+// 全局转发规则(全局外部应用负载均衡器等)没有所属区域，暂不同步
+func (g *GCP) getLBs(project string) (
+	lbs []model.LB, lbListeners []model.LBListener, lbTargetServers []model.LBTargetServer, lbVMConns []model.LBVMConnection,
+	vifs []model.VInterface, ips []model.IP, err error,
+) {
+	targetPoolLinkToInstances, err := g.getLinkedMembers(project, "targetPools", "instances", "")
+	if err != nil {
+		return
+	}
+	backendServiceLinkToGroups, err := g.getLinkedMembers(project, "backendServices", "backends", "group")
+	if err != nil {
+		return
+	}
+	jRules, err := g.getRawData(g.projectURL(project, "aggregated/forwardingRules"), "forwardingRules", true)
+	if err != nil {
+		return
+	}
+
+	for i := range jRules {
+		jRule := jRules[i]
+		name := jRule.Get("name").MustString()
+		if !cloudcommon.CheckJsonAttributes(jRule, []string{"id", "name", "IPAddress", "IPProtocol"}) {
+			log.Infof("exclude lb: %s, missing attr", name, logger.NewORGPrefix(g.orgID))
+			continue
+		}
+		regionName := lastSegment(jRule.Get("region").MustString())
+		regionLcuuid, ok := g.toolDataSet.regionNameToLcuuid[regionName]
+		if !ok {
+			log.Infof("exclude lb: %s, global or region not synced", name, logger.NewORGPrefix(g.orgID))
+			continue
+		}
+
+		var members []VMIP
+		if target := linkPath(jRule.Get("target").MustString()); target != "" {
+			for _, instance := range targetPoolLinkToInstances[target] {
+				if m, ok := g.toolDataSet.instanceLinkToVMIP[instance]; ok {
+					members = append(members, m)
+				}
+			}
+		}
+		if backendService := linkPath(jRule.Get("backendService").MustString()); backendService != "" {
+			for _, group := range backendServiceLinkToGroups[backendService] {
+				instances, err := g.getBackendGroupMembers(group)
+				if err != nil {
+					return nil, nil, nil, nil, nil, nil, err
+				}
+				for _, instance := range instances {
+					if m, ok := g.toolDataSet.instanceLinkToVMIP[instance]; ok {
+						members = append(members, m)
+					}
+				}
+			}
+		}
+
+		vpcLcuuid, ok := g.getVPCLcuuid(jRule.Get("network").MustString(), regionName)
+		if !ok && len(members) > 0 {
+			// 外部直通负载均衡器的转发规则不属于VPC网络，使用后端云主机所在的VPC
+			vpcLcuuid, ok = members[0].VPCLcuuid, true
+		}
+		if !ok {
+			log.Infof("exclude lb: %s, missing vpc info", name, logger.NewORGPrefix(g.orgID))
+			continue
+		}
+
+		ruleID := jRule.Get("id").MustString()
+		lbLcuuid := common.GenerateUUIDByOrgID(g.orgID, ruleID)
+		vip := jRule.Get("IPAddress").MustString()
+		lbModel := cloudcommon.LB_MODEL_INTERNAL
+		if strings.HasPrefix(jRule.Get("loadBalancingScheme").MustString(), "EXTERNAL") {
+			lbModel = cloudcommon.LB_MODEL_EXTERNAL
+		}
+		lbs = append(
+			lbs,
+			model.LB{
+				Lcuuid:       lbLcuuid,
+				Name:         name,
+				Label:        ruleID,
+				Model:        lbModel,
+				VIP:          vip,
+				VPCLcuuid:    vpcLcuuid,
+				RegionLcuuid: regionLcuuid,
+			},
+		)
+		g.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+
+		vifLcuuid := common.GenerateUUIDByOrgID(g.orgID, lbLcuuid+vip)
+		vif := model.VInterface{
+			Lcuuid:        vifLcuuid,
+			Type:          common.VIF_TYPE_WAN,
+			Mac:           common.VIF_DEFAULT_MAC,
+			DeviceType:    common.VIF_DEVICE_TYPE_LB,
+			DeviceLcuuid:  lbLcuuid,
+			NetworkLcuuid: common.NETWORK_ISP_LCUUID,
+			VPCLcuuid:     vpcLcuuid,
+			RegionLcuuid:  regionLcuuid,
+		}
+		ip := model.IP{
+			Lcuuid:           common.GenerateUUIDByOrgID(g.orgID, vifLcuuid+vip),
+			VInterfaceLcuuid: vifLcuuid,
+			IP:               vip,
+			RegionLcuuid:     regionLcuuid,
+		}
+		if network, ok := g.toolDataSet.subnetworkLinkToNetwork[linkPath(jRule.Get("subnetwork").MustString())]; ok && lbModel == cloudcommon.LB_MODEL_INTERNAL {
+			vif.Type = common.VIF_TYPE_LAN
+			vif.NetworkLcuuid = network.Lcuuid
+			ip.SubnetLcuuid = g.getSubnetLcuuid(network.Lcuuid, vip)
+		}
+		vifs = append(vifs, vif)
+		ips = append(ips, ip)
+
+		listenerLcuuid := common.GenerateUUIDByOrgID(g.orgID, ruleID+"_listener")
+		protocol := jRule.Get("IPProtocol").MustString()
+		port := getPort(jRule)
+		lbListeners = append(
+			lbListeners,
+			model.LBListener{
+				Lcuuid:   listenerLcuuid,
+				LBLcuuid: lbLcuuid,
+				Name:     name,
+				Label:    ruleID,
+				IPs:      vip,
+				Protocol: protocol,
+				Port:     port,
+			},
+		)
+		// 直通负载均衡器不修改目的端口，后端端口与监听端口相同
+		lbVMConnKeys := map[string]bool{}
+		for _, m := range members {
+			if lbVMConnKeys[m.VMLcuuid] {
+				continue
+			}
+			lbVMConnKeys[m.VMLcuuid] = true
+			lbTargetServers = append(
+				lbTargetServers,
+				model.LBTargetServer{
+					Lcuuid:           common.GenerateUUIDByOrgID(g.orgID, listenerLcuuid+m.VMLcuuid),
+					LBLcuuid:         lbLcuuid,
+					LBListenerLcuuid: listenerLcuuid,
+					Type:             common.LB_SERVER_TYPE_VM,
+					IP:               m.IP,
+					VMLcuuid:         m.VMLcuuid,
+					Protocol:         protocol,
+					Port:             port,
+					VPCLcuuid:        vpcLcuuid,
+				},
+			)
+			lbVMConns = append(
+				lbVMConns,
+				model.LBVMConnection{
+					Lcuuid:   common.GenerateUUIDByOrgID(g.orgID, lbLcuuid+m.VMLcuuid),
+					LBLcuuid: lbLcuuid,
+					VMLcuuid: m.VMLcuuid,
+				},
+			)
+		}
+	}
+	return
+}
+
+// getLinkedMembers 获取资源selfLink到其引用资源selfLink列表的映射，memberKey非空时引用位于列表元素的memberKey属性中
+func (g *GCP) getLinkedMembers(project, resourceType, listKey, memberKey string) (map[string][]string, error) {
+	jResources, err := g.getRawData(g.projectURL(project, "aggregated/"+resourceType), resourceType, true)
+	if err != nil {
+		return nil, err
+	}
+	linkToMembers := map[string][]string{}
+	for i := range jResources {
+		jr := jResources[i]
+		link := linkPath(jr.Get("selfLink").MustString())
+		jList := jr.Get(listKey)
+		for j := range jList.MustArray() {
+			var member string
+			if memberKey == "" {
+				member = jList.GetIndex(j).MustString()
+			} else {
+				member = jList.GetIndex(j).Get(memberKey).MustString()
+			}
+			if member != "" {
+				linkToMembers[link] = append(linkToMembers[link], linkPath(member))
+			}
+		}
+	}
+	return linkToMembers, nil
+}
+
+// getBackendGroupMembers 获取实例组中的云主机，后端为网络端点组(NEG)时跳过
+func (g *GCP) getBackendGroupMembers(groupLink string) ([]string, error) {
+	if !strings.Contains(groupLink, "/instanceGroups/") {
+		return nil, nil
+	}
+	if members, ok := g.toolDataSet.backendGroupLinkToMembers[groupLink]; ok {
+		return members, nil
+	}
+	statsdAPIStartTime := time.Now()
+	resp, err := RequestPost(
+		g.config.ComputeEndpoint+"/"+groupLink+"/listInstances", g.token.token, time.Duration(g.httpTimeout),
+		map[string]interface{}{"instanceState": "ALL"},
+	)
+	if err != nil {
+		return nil, err
+	}
+	var members []string
+	jItems := resp.Get("items")
+	for i := range jItems.MustArray() {
+		if instance := jItems.GetIndex(i).Get("instance").MustString(); instance != "" {
+			members = append(members, linkPath(instance))
+		}
+	}
+	g.cloudStatsd.RefreshAPIMoniter("listInstances", len(members), statsdAPIStartTime)
+	g.toolDataSet.backendGroupLinkToMembers[groupLink] = members
+	return members, nil
+}
+
+// getPort 转发规则使用portRange(如80-80)或ports描述端口，使用首个端口作为监听端口
+func getPort(jRule *simplejson.Json) int {
+	portStr := strings.Split(jRule.Get("portRange").MustString(), "-")[0]
+	if ports := jRule.Get("ports").MustStringArray(); portStr == "" && len(ports) > 0 {
+		portStr = ports[0]
+	}
+	port, _ := strconv.Atoi(portStr)
+	return port
+}
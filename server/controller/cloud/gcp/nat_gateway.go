@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gcp
+
+import (
+	"sort"
+	"strings"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+// getNATGateways Cloud NAT配置在Cloud Router中，每个NAT配置对应一个NAT网关
+// 自动分配(AUTO_ONLY)的NAT ip不在预留地址中，此时NAT网关没有浮动ip
+func (g *GCP) getNATGateways(project string) (
+	natGateways []model.NATGateway, natVMConns []model.NATVMConnection, vifs []model.VInterface, ips []model.IP, err error,
+) {
+	jRouters, err := g.getRawData(g.projectURL(project, "aggregated/routers"), "routers", true)
+	if err != nil {
+		return
+	}
+
+	var instanceLinks []string
+	for link := range g.toolDataSet.instanceLinkToVMIP {
+		instanceLinks = append(instanceLinks, link)
+	}
+	sort.Strings(instanceLinks)
+
+	for i := range jRouters {
+		jRouter := jRouters[i]
+		routerName := jRouter.Get("name").MustString()
+		if !cloudcommon.CheckJsonAttributes(jRouter, []string{"id", "name", "network", "region"}) {
+			log.Infof("exclude router: %s, missing attr", routerName, logger.NewORGPrefix(g.orgID))
+			continue
+		}
+		regionName := lastSegment(jRouter.Get("region").MustString())
+		networkLink := linkPath(jRouter.Get("network").MustString())
+		vpcLcuuid, ok := g.getVPCLcuuid(networkLink, regionName)
+		if !ok {
+			log.Infof("exclude router: %s, missing vpc or region info", routerName, logger.NewORGPrefix(g.orgID))
+			continue
+		}
+		regionLcuuid := g.toolDataSet.regionNameToLcuuid[regionName]
+
+		jNATs := jRouter.Get("nats")
+		for j := range jNATs.MustArray() {
+			jNAT := jNATs.GetIndex(j)
+			name := jNAT.Get("name").MustString()
+			var floatingIPs []string
+			for _, addressLink := range jNAT.Get("natIps").MustStringArray() {
+				if ip, ok := g.toolDataSet.addressLinkToIP[linkPath(addressLink)]; ok {
+					floatingIPs = append(floatingIPs, ip)
+				}
+			}
+			natLcuuid := common.GenerateUUIDByOrgID(g.orgID, jRouter.Get("id").MustString()+"_"+name)
+			natGateways = append(
+				natGateways,
+				model.NATGateway{
+					Lcuuid:       natLcuuid,
+					Name:         name,
+					Label:        routerName + "/" + name,
+					FloatingIPs:  strings.Join(floatingIPs, common.STRINGS_JOIN_COMMA),
+					VPCLcuuid:    vpcLcuuid,
+					RegionLcuuid: regionLcuuid,
+				},
+			)
+			g.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+
+			vifLcuuid := common.GenerateUUIDByOrgID(g.orgID, natLcuuid)
+			vifs = append(
+				vifs,
+				model.VInterface{
+					Lcuuid:        vifLcuuid,
+					Type:          common.VIF_TYPE_WAN,
+					Mac:           common.VIF_DEFAULT_MAC,
+					DeviceLcuuid:  natLcuuid,
+					DeviceType:    common.VIF_DEVICE_TYPE_NAT_GATEWAY,
+					NetworkLcuuid: common.NETWORK_ISP_LCUUID,
+					VPCLcuuid:     vpcLcuuid,
+					RegionLcuuid:  regionLcuuid,
+				},
+			)
+			for _, ip := range floatingIPs {
+				ips = append(
+					ips,
+					model.IP{
+						Lcuuid:           common.GenerateUUIDByOrgID(g.orgID, vifLcuuid+ip),
+						VInterfaceLcuuid: vifLcuuid,
+						IP:               ip,
+						RegionLcuuid:     regionLcuuid,
+					},
+				)
+			}
+
+			// LIST_OF_SUBNETWORKS时只有指定子网中的云主机使用NAT
+			var subnetworkLinks map[string]bool
+			if jNAT.Get("sourceSubnetworkIpRangesToNat").MustString() == "LIST_OF_SUBNETWORKS" {
+				subnetworkLinks = map[string]bool{}
+				jSubnetworks := jNAT.Get("subnetworks")
+				for k := range jSubnetworks.MustArray() {
+					subnetworkLinks[linkPath(jSubnetworks.GetIndex(k).Get("name").MustString())] = true
+				}
+			}
+			// 有外部ip的云主机不经过Cloud NAT访问公网
+			for _, link := range instanceLinks {
+				m := g.toolDataSet.instanceLinkToVMIP[link]
+				if m.HasExternalIP || m.RegionName != regionName || m.NetworkLink != networkLink {
+					continue
+				}
+				if subnetworkLinks != nil && !subnetworkLinks[m.SubnetworkLink] {
+					continue
+				}
+				natVMConns = append(
+					natVMConns,
+					model.NATVMConnection{
+						Lcuuid:           common.GenerateUUIDByOrgID(g.orgID, natLcuuid+m.VMLcuuid),
+						NATGatewayLcuuid: natLcuuid,
+						VMLcuuid:         m.VMLcuuid,
+					},
+				)
+			}
+		}
+	}
+	return
+}
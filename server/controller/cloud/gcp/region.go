@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gcp
+
+import (
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+// getRegionsAndZones 区域及可用区为全局统一的，多个项目中相同的区域只同步一次
+func (g *GCP) getRegionsAndZones(project string) ([]model.Region, []model.AZ, error) {
+	jRegions, err := g.getRawData(g.projectURL(project, "regions"), "regions", false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var regions []model.Region
+	for i := range jRegions {
+		jr := jRegions[i]
+		name := jr.Get("name").MustString()
+		if !cloudcommon.CheckJsonAttributes(jr, []string{"name"}) {
+			continue
+		}
+		if len(g.config.IncludeRegions) > 0 {
+			if _, ok := g.config.IncludeRegions[name]; !ok {
+				log.Infof("exclude region: %s, not included", name, logger.NewORGPrefix(g.orgID))
+				continue
+			}
+		}
+		if _, ok := g.toolDataSet.regionNameToLcuuid[name]; ok {
+			continue
+		}
+		lcuuid := g.config.RegionLcuuid
+		if lcuuid == "" {
+			lcuuid = common.GenerateUUIDByOrgID(g.orgID, name+"_"+g.lcuuidGenerate)
+			regions = append(
+				regions,
+				model.Region{
+					Lcuuid: lcuuid,
+					Label:  name,
+					Name:   name,
+				},
+			)
+		}
+		g.toolDataSet.regionNameToLcuuid[name] = lcuuid
+	}
+
+	jZones, err := g.getRawData(g.projectURL(project, "zones"), "zones", false)
+	if err != nil {
+		return nil, nil, err
+	}
+	var azs []model.AZ
+	for i := range jZones {
+		jz := jZones[i]
+		name := jz.Get("name").MustString()
+		if !cloudcommon.CheckJsonAttributes(jz, []string{"name", "region"}) {
+			continue
+		}
+		regionName := lastSegment(jz.Get("region").MustString())
+		regionLcuuid, ok := g.toolDataSet.regionNameToLcuuid[regionName]
+		if !ok {
+			continue
+		}
+		if _, ok := g.toolDataSet.zoneNameToAZLcuuid[name]; ok {
+			continue
+		}
+		lcuuid := common.GenerateUUIDByOrgID(g.orgID, name+"_"+g.lcuuidGenerate)
+		azs = append(
+			azs,
+			model.AZ{
+				Lcuuid:       lcuuid,
+				Label:        name,
+				Name:         name,
+				RegionLcuuid: regionLcuuid,
+			},
+		)
+		g.toolDataSet.zoneNameToAZLcuuid[name] = lcuuid
+		g.toolDataSet.zoneNameToRegionName[name] = regionName
+	}
+	return regions, azs, nil
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gcp
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	COMPUTE_READONLY_SCOPE = "https://www.googleapis.com/auth/compute.readonly"
+	JWT_BEARER_GRANT_TYPE  = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+)
+
+type Token struct {
+	token     string
+	expiresAt time.Time
+}
+
+// 检查token是否过期，离失效时间小于5m即认为过期
+func (t *Token) isExpired() bool {
+	return time.Until(t.expiresAt).Minutes() < 5
+}
+
+func (g *GCP) getToken() (*Token, error) {
+	if g.token == nil || g.token.isExpired() {
+		t, err := g.createToken()
+		if err != nil {
+			return nil, err
+		}
+		g.token = t
+	}
+	return g.token, nil
+}
+
+// 使用服务账号私钥签名的jwt换取只读的访问token
+func (g *GCP) createToken() (*Token, error) {
+	assertion, err := g.signJWT(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", JWT_BEARER_GRANT_TYPE)
+	form.Set("assertion", assertion)
+	resp, err := RequestToken(g.config.TokenURI, time.Duration(g.httpTimeout), form)
+	if err != nil {
+		return nil, err
+	}
+	token := &Token{
+		token:     resp.Get("access_token").MustString(),
+		expiresAt: time.Now().Add(time.Duration(resp.Get("expires_in").MustInt(3600)) * time.Second),
+	}
+	if token.token == "" {
+		return nil, errors.New("gcp token response has no access_token")
+	}
+	return token, nil
+}
+
+func (g *GCP) signJWT(now time.Time) (string, error) {
+	key, err := parsePrivateKey(g.config.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	header, _ := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": g.config.PrivateKeyID,
+	})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   g.config.ClientEmail,
+		"scope": COMPUTE_READONLY_SCOPE,
+		"aud":   g.config.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("sign jwt failed: %s", err.Error())
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// 服务账号密钥文件中的私钥为PKCS#8格式，兼容PKCS#1格式
+func parsePrivateKey(s string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("private_key is not pem encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse private_key failed: %s", err.Error())
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private_key is not a rsa private key")
+	}
+	return key, nil
+}
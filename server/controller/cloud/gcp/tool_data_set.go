@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gcp
+
+import (
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+)
+
+type ToolDataSet struct {
+	regionNameToLcuuid        map[string]string
+	zoneNameToAZLcuuid        map[string]string
+	zoneNameToRegionName      map[string]string
+	networkLinkToNetwork      map[string]VPCNetwork
+	vpcLcuuidToVPC            map[string]model.VPC
+	subnetworkLinkToNetwork   map[string]model.Network
+	networkLcuuidToSubnets    map[string][]model.Subnet
+	addressLinkToIP           map[string]string
+	instanceLinkToVMIP        map[string]VMIP
+	backendGroupLinkToMembers map[string][]string
+
+	regionLcuuidToResourceNum map[string]int
+	azLcuuidToResourceNum     map[string]int
+}
+
+func NewToolDataSet() *ToolDataSet {
+	return &ToolDataSet{
+		regionNameToLcuuid:        make(map[string]string),
+		zoneNameToAZLcuuid:        make(map[string]string),
+		zoneNameToRegionName:      make(map[string]string),
+		networkLinkToNetwork:      make(map[string]VPCNetwork),
+		vpcLcuuidToVPC:            make(map[string]model.VPC),
+		subnetworkLinkToNetwork:   make(map[string]model.Network),
+		networkLcuuidToSubnets:    make(map[string][]model.Subnet),
+		addressLinkToIP:           make(map[string]string),
+		instanceLinkToVMIP:        make(map[string]VMIP),
+		backendGroupLinkToMembers: make(map[string][]string),
+		regionLcuuidToResourceNum: make(map[string]int),
+		azLcuuidToResourceNum:     make(map[string]int),
+	}
+}
+
+// VPCNetwork gcp中的VPC网络是全局资源，按区域拆分为多个VPC
+type VPCNetwork struct {
+	ID       string
+	Name     string
+	Peerings []Peering
+}
+
+type Peering struct {
+	Name        string
+	NetworkLink string
+}
+
+// VMIP 云主机主网卡信息，用于关联负载均衡后端及NAT网关
+type VMIP struct {
+	VMLcuuid       string
+	VPCLcuuid      string
+	RegionName     string
+	IP             string
+	NetworkLink    string
+	SubnetworkLink string
+	HasExternalIP  bool
+}
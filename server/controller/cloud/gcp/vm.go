@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gcp
+
+import (
+	"time"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+var STATE_CONVERTION = map[string]int{
+	"RUNNING":    common.VM_STATE_RUNNING,
+	"STOPPED":    common.VM_STATE_STOPPED,
+	"SUSPENDED":  common.VM_STATE_STOPPED,
+	"TERMINATED": common.VM_STATE_STOPPED,
+}
+
+// getAddresses 缓存预留的ip地址，由Cloud NAT使用
+func (g *GCP) getAddresses(project string) error {
+	jAddresses, err := g.getRawData(g.projectURL(project, "aggregated/addresses"), "addresses", true)
+	if err != nil {
+		return err
+	}
+	for i := range jAddresses {
+		ja := jAddresses[i]
+		if ip := ja.Get("address").MustString(); ip != "" {
+			g.toolDataSet.addressLinkToIP[linkPath(ja.Get("selfLink").MustString())] = ip
+		}
+	}
+	return nil
+}
+
+// getVMs 同步云主机及其网卡；compute api中不返回网卡的mac地址，使用默认mac
+func (g *GCP) getVMs(project string) ([]model.VM, []model.VInterface, []model.IP, []model.FloatingIP, error) {
+	jVMs, err := g.getRawData(g.projectURL(project, "aggregated/instances"), "instances", true)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	var vms []model.VM
+	var vifs []model.VInterface
+	var ips []model.IP
+	var fIPs []model.FloatingIP
+	for i := range jVMs {
+		jVM := jVMs[i]
+		name := jVM.Get("name").MustString()
+		if !cloudcommon.CheckJsonAttributes(jVM, []string{"id", "name", "zone", "status", "selfLink", "networkInterfaces"}) {
+			log.Infof("exclude vm: %s, missing attr", name, logger.NewORGPrefix(g.orgID))
+			continue
+		}
+		zoneName := lastSegment(jVM.Get("zone").MustString())
+		azLcuuid, ok := g.toolDataSet.zoneNameToAZLcuuid[zoneName]
+		if !ok {
+			log.Infof("exclude vm: %s, zone not synced", name, logger.NewORGPrefix(g.orgID))
+			continue
+		}
+		regionName := g.toolDataSet.zoneNameToRegionName[zoneName]
+		regionLcuuid := g.toolDataSet.regionNameToLcuuid[regionName]
+		jNICs := jVM.Get("networkInterfaces")
+		vpcLcuuid, ok := g.getVPCLcuuid(jNICs.GetIndex(0).Get("network").MustString(), regionName)
+		if !ok {
+			log.Infof("exclude vm: %s, missing vpc info", name, logger.NewORGPrefix(g.orgID))
+			continue
+		}
+
+		state, ok := STATE_CONVERTION[jVM.Get("status").MustString()]
+		if !ok {
+			state = common.VM_STATE_EXCEPTION
+		}
+		vmID := jVM.Get("id").MustString()
+		vmLcuuid := common.GenerateUUIDByOrgID(g.orgID, vmID)
+		vm := model.VM{
+			Lcuuid:       vmLcuuid,
+			Name:         name,
+			Label:        vmID,
+			HType:        common.VM_HTYPE_VM_C,
+			State:        state,
+			VPCLcuuid:    vpcLcuuid,
+			AZLcuuid:     azLcuuid,
+			RegionLcuuid: regionLcuuid,
+			CloudTags:    getLabels(jVM),
+		}
+		if created := jVM.Get("creationTimestamp").MustString(); created != "" {
+			createdAt, err := time.Parse(time.RFC3339, created)
+			if err != nil {
+				log.Errorf("parse created failed: %s", created, logger.NewORGPrefix(g.orgID))
+			} else {
+				vm.CreatedAt = createdAt
+			}
+		}
+		vms = append(vms, vm)
+		g.toolDataSet.azLcuuidToResourceNum[azLcuuid]++
+		g.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+
+		for j := range jNICs.MustArray() {
+			jNIC := jNICs.GetIndex(j)
+			nicName := jNIC.Get("name").MustString()
+			network, ok := g.toolDataSet.subnetworkLinkToNetwork[linkPath(jNIC.Get("subnetwork").MustString())]
+			if !ok {
+				log.Infof("exclude vinterface: %s of vm: %s, missing network info", nicName, name, logger.NewORGPrefix(g.orgID))
+				continue
+			}
+			vifLcuuid := common.GenerateUUIDByOrgID(g.orgID, vmID+"_"+nicName)
+			vifs = append(
+				vifs,
+				model.VInterface{
+					Lcuuid:        vifLcuuid,
+					Name:          nicName,
+					Type:          common.VIF_TYPE_LAN,
+					Mac:           common.VIF_DEFAULT_MAC,
+					DeviceType:    common.VIF_DEVICE_TYPE_VM,
+					DeviceLcuuid:  vmLcuuid,
+					NetworkLcuuid: network.Lcuuid,
+					VPCLcuuid:     network.VPCLcuuid,
+					RegionLcuuid:  regionLcuuid,
+				},
+			)
+			ip := jNIC.Get("networkIP").MustString()
+			if ip != "" {
+				ips = append(
+					ips,
+					model.IP{
+						Lcuuid:           common.GenerateUUIDByOrgID(g.orgID, vifLcuuid+ip),
+						VInterfaceLcuuid: vifLcuuid,
+						IP:               ip,
+						SubnetLcuuid:     g.getSubnetLcuuid(network.Lcuuid, ip),
+						RegionLcuuid:     regionLcuuid,
+					},
+				)
+			}
+
+			var hasExternalIP bool
+			jAccessConfigs := jNIC.Get("accessConfigs")
+			for k := range jAccessConfigs.MustArray() {
+				publicIP := jAccessConfigs.GetIndex(k).Get("natIP").MustString()
+				if publicIP == "" {
+					continue
+				}
+				hasExternalIP = true
+				wanVIFLcuuid := common.GenerateUUIDByOrgID(g.orgID, vmLcuuid+publicIP)
+				vifs = append(
+					vifs,
+					model.VInterface{
+						Lcuuid:        wanVIFLcuuid,
+						Type:          common.VIF_TYPE_WAN,
+						Mac:           common.VIF_DEFAULT_MAC,
+						DeviceType:    common.VIF_DEVICE_TYPE_VM,
+						DeviceLcuuid:  vmLcuuid,
+						NetworkLcuuid: common.NETWORK_ISP_LCUUID,
+						VPCLcuuid:     vpcLcuuid,
+						RegionLcuuid:  regionLcuuid,
+					},
+				)
+				ips = append(
+					ips,
+					model.IP{
+						Lcuuid:           common.GenerateUUIDByOrgID(g.orgID, wanVIFLcuuid+publicIP),
+						VInterfaceLcuuid: wanVIFLcuuid,
+						IP:               publicIP,
+						RegionLcuuid:     regionLcuuid,
+					},
+				)
+				fIPs = append(
+					fIPs,
+					model.FloatingIP{
+						Lcuuid:        common.GenerateUUIDByOrgID(g.orgID, vmLcuuid+publicIP),
+						IP:            publicIP,
+						VMLcuuid:      vmLcuuid,
+						NetworkLcuuid: common.NETWORK_ISP_LCUUID,
+						VPCLcuuid:     vpcLcuuid,
+						RegionLcuuid:  regionLcuuid,
+					},
+				)
+			}
+			// 主网卡(nic0)用于关联负载均衡后端及NAT网关
+			if j == 0 {
+				g.toolDataSet.instanceLinkToVMIP[linkPath(jVM.Get("selfLink").MustString())] = VMIP{
+					VMLcuuid:       vmLcuuid,
+					VPCLcuuid:      vpcLcuuid,
+					RegionName:     regionName,
+					IP:             ip,
+					NetworkLink:    linkPath(jNIC.Get("network").MustString()),
+					SubnetworkLink: linkPath(jNIC.Get("subnetwork").MustString()),
+					HasExternalIP:  hasExternalIP,
+				}
+			}
+		}
+	}
+	return vms, vifs, ips, fIPs, nil
+}
@@ -0,0 +1,221 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gcp
+
+import (
+	"sort"
+	"strings"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+func (g *GCP) getNetworks(project string) error {
+	jNetworks, err := g.getRawData(g.projectURL(project, "global/networks"), "networks", false)
+	if err != nil {
+		return err
+	}
+	for i := range jNetworks {
+		jn := jNetworks[i]
+		if !cloudcommon.CheckJsonAttributes(jn, []string{"id", "name", "selfLink"}) {
+			log.Infof("exclude vpc: %s, missing attr", jn.Get("name").MustString(), logger.NewORGPrefix(g.orgID))
+			continue
+		}
+		network := VPCNetwork{
+			ID:   jn.Get("id").MustString(),
+			Name: jn.Get("name").MustString(),
+		}
+		jPeerings := jn.Get("peerings")
+		for j := range jPeerings.MustArray() {
+			jp := jPeerings.GetIndex(j)
+			if jp.Get("state").MustString() != "ACTIVE" {
+				continue
+			}
+			network.Peerings = append(network.Peerings, Peering{Name: jp.Get("name").MustString(), NetworkLink: linkPath(jp.Get("network").MustString())})
+		}
+		g.toolDataSet.networkLinkToNetwork[linkPath(jn.Get("selfLink").MustString())] = network
+	}
+	return nil
+}
+
+// gcp中VPC网络为全局资源，其中的子网属于区域；每个区域中的每个VPC网络对应一个VPC
+func (g *GCP) getVPCLcuuid(networkLink, regionName string) (string, bool) {
+	network, ok := g.toolDataSet.networkLinkToNetwork[linkPath(networkLink)]
+	if !ok {
+		return "", false
+	}
+	regionLcuuid, ok := g.toolDataSet.regionNameToLcuuid[regionName]
+	if !ok {
+		return "", false
+	}
+	lcuuid := common.GenerateUUIDByOrgID(g.orgID, network.ID+"_"+regionName)
+	if _, ok := g.toolDataSet.vpcLcuuidToVPC[lcuuid]; !ok {
+		g.toolDataSet.vpcLcuuidToVPC[lcuuid] = model.VPC{
+			Lcuuid:       lcuuid,
+			Name:         network.Name,
+			Label:        network.ID,
+			RegionLcuuid: regionLcuuid,
+		}
+		g.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+	}
+	return lcuuid, true
+}
+
+func (g *GCP) getVPCs() []model.VPC {
+	var vpcs []model.VPC
+	for _, vpc := range g.toolDataSet.vpcLcuuidToVPC {
+		vpcs = append(vpcs, vpc)
+	}
+	sort.Slice(vpcs, func(i, j int) bool { return vpcs[i].Lcuuid < vpcs[j].Lcuuid })
+	return vpcs
+}
+
+// getSubnetworks 每个子网对应一个网络，子网的主地址段及次要地址段(如GKE的pod/service地址段)均作为子网同步
+func (g *GCP) getSubnetworks(project string) ([]model.Network, []model.Subnet, error) {
+	jSubnetworks, err := g.getRawData(g.projectURL(project, "aggregated/subnetworks"), "subnetworks", true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var networks []model.Network
+	var subnets []model.Subnet
+	for i := range jSubnetworks {
+		js := jSubnetworks[i]
+		name := js.Get("name").MustString()
+		if !cloudcommon.CheckJsonAttributes(js, []string{"id", "name", "selfLink", "network", "region", "ipCidrRange"}) {
+			log.Infof("exclude network: %s, missing attr", name, logger.NewORGPrefix(g.orgID))
+			continue
+		}
+		regionName := lastSegment(js.Get("region").MustString())
+		vpcLcuuid, ok := g.getVPCLcuuid(js.Get("network").MustString(), regionName)
+		if !ok {
+			log.Infof("exclude network: %s, missing vpc or region info", name, logger.NewORGPrefix(g.orgID))
+			continue
+		}
+		regionLcuuid := g.toolDataSet.regionNameToLcuuid[regionName]
+		networkLcuuid := common.GenerateUUIDByOrgID(g.orgID, js.Get("id").MustString())
+		network := model.Network{
+			Lcuuid:       networkLcuuid,
+			Name:         name,
+			Label:        js.Get("id").MustString(),
+			NetType:      common.NETWORK_TYPE_LAN,
+			VPCLcuuid:    vpcLcuuid,
+			RegionLcuuid: regionLcuuid,
+		}
+		networks = append(networks, network)
+		g.toolDataSet.subnetworkLinkToNetwork[linkPath(js.Get("selfLink").MustString())] = network
+		g.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+
+		cidrs := []string{js.Get("ipCidrRange").MustString()}
+		jRanges := js.Get("secondaryIpRanges")
+		for j := range jRanges.MustArray() {
+			if cidr := jRanges.GetIndex(j).Get("ipCidrRange").MustString(); cidr != "" {
+				cidrs = append(cidrs, cidr)
+			}
+		}
+		for j, cidr := range cidrs {
+			subnet := model.Subnet{
+				Lcuuid:        common.GenerateUUIDByOrgID(g.orgID, networkLcuuid+cidr),
+				Name:          name,
+				CIDR:          cidr,
+				NetworkLcuuid: networkLcuuid,
+				VPCLcuuid:     vpcLcuuid,
+			}
+			if j == 0 {
+				subnet.GatewayIP = js.Get("gatewayAddress").MustString()
+			} else {
+				subnet.Name = jRanges.GetIndex(j - 1).Get("rangeName").MustString(name)
+			}
+			subnets = append(subnets, subnet)
+			g.toolDataSet.networkLcuuidToSubnets[networkLcuuid] = append(g.toolDataSet.networkLcuuidToSubnets[networkLcuuid], subnet)
+		}
+	}
+	return networks, subnets, nil
+}
+
+func (g *GCP) getSubnetLcuuid(networkLcuuid, ip string) string {
+	subnets := g.toolDataSet.networkLcuuidToSubnets[networkLcuuid]
+	for _, subnet := range subnets {
+		if cloudcommon.IsIPInCIDR(ip, subnet.CIDR) {
+			return subnet.Lcuuid
+		}
+	}
+	if len(subnets) > 0 {
+		return subnets[0].Lcuuid
+	}
+	return ""
+}
+
+// getPeerConnections 对等的VPC网络在两端均有对等记录，每个区域中两端均存在VPC时生成一条对等连接
+func (g *GCP) getPeerConnections() []model.PeerConnection {
+	var regionNames []string
+	for name := range g.toolDataSet.regionNameToLcuuid {
+		regionNames = append(regionNames, name)
+	}
+	sort.Strings(regionNames)
+
+	var networkLinks []string
+	for link := range g.toolDataSet.networkLinkToNetwork {
+		networkLinks = append(networkLinks, link)
+	}
+	sort.Strings(networkLinks)
+
+	var peerConns []model.PeerConnection
+	keys := make(map[string]bool)
+	for _, link := range networkLinks {
+		local := g.toolDataSet.networkLinkToNetwork[link]
+		for _, p := range local.Peerings {
+			remote, ok := g.toolDataSet.networkLinkToNetwork[p.NetworkLink]
+			if !ok {
+				log.Infof("exclude peer_connection: %s, remote network not synced", p.Name, logger.NewORGPrefix(g.orgID))
+				continue
+			}
+			pair := []string{local.ID, remote.ID}
+			sort.Strings(pair)
+			for _, regionName := range regionNames {
+				key := strings.Join(pair, ",") + "_" + regionName
+				if keys[key] {
+					continue
+				}
+				localVPCLcuuid := common.GenerateUUIDByOrgID(g.orgID, local.ID+"_"+regionName)
+				remoteVPCLcuuid := common.GenerateUUIDByOrgID(g.orgID, remote.ID+"_"+regionName)
+				_, localOK := g.toolDataSet.vpcLcuuidToVPC[localVPCLcuuid]
+				_, remoteOK := g.toolDataSet.vpcLcuuidToVPC[remoteVPCLcuuid]
+				if !localOK || !remoteOK {
+					continue
+				}
+				keys[key] = true
+				regionLcuuid := g.toolDataSet.regionNameToLcuuid[regionName]
+				peerConns = append(
+					peerConns,
+					model.PeerConnection{
+						Lcuuid:             common.GenerateUUIDByOrgID(g.orgID, key),
+						Name:               p.Name,
+						Label:              p.Name,
+						LocalVPCLcuuid:     localVPCLcuuid,
+						RemoteVPCLcuuid:    remoteVPCLcuuid,
+						LocalRegionLcuuid:  regionLcuuid,
+						RemoteRegionLcuuid: regionLcuuid,
+					},
+				)
+			}
+		}
+	}
+	return peerConns
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+// nova的internal可用区中为控制节点服务，不作为AZ同步
+const INTERNAL_AZ_NAME = "internal"
+
+func (o *OpenStack) getAZs(regionID, regionLcuuid string) ([]model.AZ, error) {
+	computeURL, ok := o.getEndpoint(regionID, SERVICE_TYPE_COMPUTE)
+	if !ok {
+		log.Infof("region (%s) has no compute endpoint", regionID, logger.NewORGPrefix(o.orgID))
+		return nil, nil
+	}
+	jAZs, err := o.getRawData(computeURL+"/os-availability-zone/detail", "availabilityZoneInfo", false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var azs []model.AZ
+	for i := range jAZs {
+		ja := jAZs[i]
+		zname := ja.Get("zoneName").MustString()
+		if !cloudcommon.CheckJsonAttributes(ja, []string{"zoneName"}) || zname == INTERNAL_AZ_NAME {
+			log.Infof("exclude az: %s", zname, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		lcuuid := common.GenerateUUIDByOrgID(o.orgID, regionID+"_"+zname+"_"+o.lcuuidGenerate)
+		azs = append(
+			azs,
+			model.AZ{
+				Lcuuid:       lcuuid,
+				Name:         zname,
+				RegionLcuuid: regionLcuuid,
+			},
+		)
+		o.toolDataSet.azNameToAZLcuuid[regionID+zname] = lcuuid
+		for hostName := range ja.Get("hosts").MustMap() {
+			o.toolDataSet.hostNameToAZName[hostName] = zname
+		}
+	}
+	return azs, nil
+}
+
+func (o *OpenStack) azNameToAZLcuuid(regionID, azName string) string {
+	return o.toolDataSet.azNameToAZLcuuid[regionID+azName]
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bitly/go-simplejson"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+const (
+	DEFAULT_DOMAIN_NAME   = "Default"
+	DEFAULT_ENDPOINT_TYPE = "public"
+)
+
+type Config struct {
+	RegionLcuuid      string
+	AuthURL           string // keystone地址，不包含/v3后缀
+	Username          string
+	Password          string
+	UserDomainName    string
+	ProjectName       string
+	ProjectDomainName string
+	EndpointType      string // 从catalog中选取endpoint的类型：public/internal/admin
+	IncludeRegions    map[string]bool
+}
+
+func (c *Config) LoadFromString(orgID int, sConf string) (err error) {
+	jConf, err := simplejson.NewJson([]byte(sConf))
+	if err != nil {
+		log.Errorf("convert config string: %s to json failed: %v", sConf, err, logger.NewORGPrefix(orgID))
+		return
+	}
+	c.AuthURL, err = jConf.Get("auth_url").String()
+	if err != nil {
+		log.Error("auth_url must be specified", logger.NewORGPrefix(orgID))
+		return
+	}
+	c.AuthURL = strings.TrimSuffix(strings.TrimSuffix(c.AuthURL, "/"), "/v3")
+	c.Username, err = jConf.Get("username").String()
+	if err != nil {
+		log.Error("username must be specified", logger.NewORGPrefix(orgID))
+		return
+	}
+	pswd, err := jConf.Get("password").String()
+	if err != nil {
+		log.Error("password must be specified", logger.NewORGPrefix(orgID))
+		return
+	}
+	dpswd, err := common.DecryptSecretKey(pswd)
+	if err != nil {
+		log.Errorf("decrypt password failed (%s)", err.Error(), logger.NewORGPrefix(orgID))
+		return
+	}
+	c.Password = dpswd
+	c.ProjectName, err = jConf.Get("project_name").String()
+	if err != nil {
+		log.Error("project_name must be specified", logger.NewORGPrefix(orgID))
+		return
+	}
+	c.UserDomainName = jConf.Get("user_domain_name").MustString(DEFAULT_DOMAIN_NAME)
+	c.ProjectDomainName = jConf.Get("project_domain_name").MustString(DEFAULT_DOMAIN_NAME)
+
+	c.EndpointType = strings.TrimSuffix(jConf.Get("endpoint_type").MustString(DEFAULT_ENDPOINT_TYPE), "URL")
+	if !common.Contains([]string{"public", "internal", "admin"}, c.EndpointType) {
+		err = fmt.Errorf("endpoint_type (%s) must be public, internal or admin", c.EndpointType)
+		log.Error(err.Error(), logger.NewORGPrefix(orgID))
+		return
+	}
+	c.RegionLcuuid = jConf.Get("region_uuid").MustString()
+	c.IncludeRegions = cloudcommon.UniqRegions(jConf.Get("include_regions").MustString())
+	return
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+// getFloatingIPs 只同步绑定到云主机端口的floating ip
+func (o *OpenStack) getFloatingIPs(regionID, regionLcuuid string) ([]model.FloatingIP, error) {
+	networkURL, ok := o.getEndpoint(regionID, SERVICE_TYPE_NETWORK)
+	if !ok {
+		return nil, nil
+	}
+	jFIPs, err := o.getRawData(networkURL+"/floatingips", "floatingips", false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var fIPs []model.FloatingIP
+	for i := range jFIPs {
+		jf := jFIPs[i]
+		ip := jf.Get("floating_ip_address").MustString()
+		if !cloudcommon.CheckJsonAttributes(jf, []string{"id", "floating_ip_address", "floating_network_id", "port_id"}) {
+			log.Infof("exclude floating_ip: %s, missing attr", ip, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		portID := jf.Get("port_id").MustString()
+		if portID != "" {
+			o.toolDataSet.portIDToFloatingIP[portID] = ip
+		}
+		vif, ok := o.toolDataSet.portIDToVInterface[portID]
+		if !ok || vif.DeviceType != common.VIF_DEVICE_TYPE_VM {
+			log.Infof("exclude floating_ip: %s, not associated with vm", ip, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		networkLcuuid := common.IDGenerateUUID(o.orgID, jf.Get("floating_network_id").MustString())
+		if _, ok := o.toolDataSet.lcuuidToNetwork[networkLcuuid]; !ok {
+			log.Infof("exclude floating_ip: %s, missing network info", ip, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		fIPs = append(
+			fIPs,
+			model.FloatingIP{
+				Lcuuid:        common.IDGenerateUUID(o.orgID, jf.Get("id").MustString()),
+				IP:            ip,
+				VMLcuuid:      vif.DeviceLcuuid,
+				NetworkLcuuid: networkLcuuid,
+				VPCLcuuid:     vif.VPCLcuuid,
+				RegionLcuuid:  regionLcuuid,
+			},
+		)
+	}
+	return fIPs, nil
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	"strings"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+var HTYPE_CONVERTION = map[string]int{
+	"qemu":           common.HOST_HTYPE_KVM,
+	"kvm":            common.HOST_HTYPE_KVM,
+	"vmware vcenter": common.HOST_HTYPE_ESXI,
+	"hyperv":         common.HOST_HTYPE_HYPER_V,
+}
+
+// getHosts 同步nova中的计算节点，需要admin权限
+func (o *OpenStack) getHosts(regionID, regionLcuuid string) ([]model.Host, error) {
+	computeURL, ok := o.getEndpoint(regionID, SERVICE_TYPE_COMPUTE)
+	if !ok {
+		return nil, nil
+	}
+	jHypervisors, err := o.getRawData(computeURL+"/os-hypervisors/detail", "hypervisors", false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []model.Host
+	for i := range jHypervisors {
+		jh := jHypervisors[i]
+		hostname := jh.Get("hypervisor_hostname").MustString()
+		if !cloudcommon.CheckJsonAttributes(jh, []string{"hypervisor_hostname", "host_ip", "hypervisor_type"}) {
+			log.Infof("exclude host: %s, missing attr", hostname, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		// hypervisor_hostname可能为FQDN，可用区中记录的是nova-compute服务的host
+		serviceHost := jh.Get("service").Get("host").MustString()
+		if serviceHost == "" {
+			serviceHost = strings.Split(hostname, ".")[0]
+		}
+		azLcuuid := o.azNameToAZLcuuid(regionID, o.toolDataSet.hostNameToAZName[serviceHost])
+		if azLcuuid == "" {
+			log.Infof("exclude host: %s, missing az info", hostname, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		ip := jh.Get("host_ip").MustString()
+		htype := common.HOST_HTYPE_KVM
+		for key, t := range HTYPE_CONVERTION {
+			if strings.HasPrefix(strings.ToLower(jh.Get("hypervisor_type").MustString()), key) {
+				htype = t
+				break
+			}
+		}
+		hosts = append(
+			hosts,
+			model.Host{
+				Lcuuid:       common.GenerateUUIDByOrgID(o.orgID, regionID+"_"+hostname+"_"+o.lcuuidGenerate),
+				Name:         hostname,
+				IP:           ip,
+				Hostname:     hostname,
+				Type:         common.HOST_TYPE_VM,
+				HType:        htype,
+				VCPUNum:      jh.Get("vcpus").MustInt(),
+				MemTotal:     jh.Get("memory_mb").MustInt(),
+				AZLcuuid:     azLcuuid,
+				RegionLcuuid: regionLcuuid,
+			},
+		)
+		o.toolDataSet.hostNameToIP[serviceHost] = ip
+		o.toolDataSet.hostNameToIP[hostname] = ip
+		o.toolDataSet.azLcuuidToResourceNum[azLcuuid]++
+		o.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+	}
+	return hosts, nil
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	"fmt"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+// getLBs 同步octavia负载均衡器，catalog中没有load-balancer服务时跳过
+func (o *OpenStack) getLBs(regionID, regionLcuuid string) (
+	lbs []model.LB, lbListeners []model.LBListener, lbTargetServers []model.LBTargetServer, lbVMConns []model.LBVMConnection,
+	vifs []model.VInterface, ips []model.IP, err error,
+) {
+	lbURL, ok := o.getEndpoint(regionID, SERVICE_TYPE_LOAD_BALANCER)
+	if !ok {
+		log.Infof("region (%s) has no load-balancer endpoint", regionID, logger.NewORGPrefix(o.orgID))
+		return
+	}
+	jLBs, err := o.getRawData(lbURL+"/lbaas/loadbalancers", "loadbalancers", false, nil)
+	if err != nil {
+		return
+	}
+
+	requiredAttrs := []string{"id", "name", "vip_address", "vip_port_id", "vip_network_id"}
+	for i := range jLBs {
+		jLB := jLBs[i]
+		name := jLB.Get("name").MustString()
+		if !cloudcommon.CheckJsonAttributes(jLB, requiredAttrs) {
+			log.Infof("exclude lb: %s, missing attr", name, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		network, ok := o.toolDataSet.lcuuidToNetwork[common.IDGenerateUUID(o.orgID, jLB.Get("vip_network_id").MustString())]
+		if !ok {
+			log.Infof("exclude lb: %s, missing network info", name, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		if name == "" {
+			name = jLB.Get("id").MustString()
+		}
+		id := common.IDGenerateUUID(o.orgID, jLB.Get("id").MustString())
+		vip := jLB.Get("vip_address").MustString()
+		vipPortID := jLB.Get("vip_port_id").MustString()
+		publicIP, hasPublicIP := o.toolDataSet.portIDToFloatingIP[vipPortID]
+		lbModel := cloudcommon.LB_MODEL_INTERNAL
+		if hasPublicIP || network.External {
+			lbModel = cloudcommon.LB_MODEL_EXTERNAL
+		}
+		lb := model.LB{
+			Lcuuid:       id,
+			Name:         name,
+			Label:        jLB.Get("id").MustString(),
+			Model:        lbModel,
+			VIP:          vip,
+			VPCLcuuid:    network.VPCLcuuid,
+			RegionLcuuid: regionLcuuid,
+		}
+		lbs = append(lbs, lb)
+		o.toolDataSet.lbLcuuidToIP[id] = vip
+		o.toolDataSet.lbLcuuidToVPCLcuuid[id] = lb.VPCLcuuid
+		o.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+
+		vifType := common.VIF_TYPE_LAN
+		if network.External {
+			vifType = common.VIF_TYPE_WAN
+		}
+		vifLcuuid := common.IDGenerateUUID(o.orgID, vipPortID)
+		vifs = append(
+			vifs,
+			model.VInterface{
+				Lcuuid:        vifLcuuid,
+				Type:          vifType,
+				Mac:           common.VIF_DEFAULT_MAC,
+				DeviceType:    common.VIF_DEVICE_TYPE_LB,
+				DeviceLcuuid:  id,
+				NetworkLcuuid: network.Lcuuid,
+				VPCLcuuid:     lb.VPCLcuuid,
+				RegionLcuuid:  regionLcuuid,
+			},
+		)
+		ips = append(
+			ips,
+			model.IP{
+				Lcuuid:           common.GenerateUUIDByOrgID(o.orgID, vifLcuuid+vip),
+				VInterfaceLcuuid: vifLcuuid,
+				IP:               vip,
+				SubnetLcuuid:     o.getSubnetLcuuid(network.Lcuuid, vip),
+				RegionLcuuid:     regionLcuuid,
+			},
+		)
+		if hasPublicIP {
+			wanVIFLcuuid := common.GenerateUUIDByOrgID(o.orgID, id+publicIP)
+			vifs = append(
+				vifs,
+				model.VInterface{
+					Lcuuid:        wanVIFLcuuid,
+					Type:          common.VIF_TYPE_WAN,
+					Mac:           common.VIF_DEFAULT_MAC,
+					DeviceType:    common.VIF_DEVICE_TYPE_LB,
+					DeviceLcuuid:  id,
+					NetworkLcuuid: common.NETWORK_ISP_LCUUID,
+					VPCLcuuid:     lb.VPCLcuuid,
+					RegionLcuuid:  regionLcuuid,
+				},
+			)
+			ips = append(
+				ips,
+				model.IP{
+					Lcuuid:           common.GenerateUUIDByOrgID(o.orgID, wanVIFLcuuid+publicIP),
+					VInterfaceLcuuid: wanVIFLcuuid,
+					IP:               publicIP,
+					RegionLcuuid:     regionLcuuid,
+				},
+			)
+		}
+	}
+
+	lbListeners, lbTargetServers, lbVMConns, err = o.getListenersAndTargetServers(lbURL)
+	return
+}
+
+func (o *OpenStack) getListenersAndTargetServers(lbURL string) (
+	lbListeners []model.LBListener, lbTargetServers []model.LBTargetServer, lbVMConns []model.LBVMConnection, err error,
+) {
+	jListeners, err := o.getRawData(lbURL+"/lbaas/listeners", "listeners", false, nil)
+	if err != nil {
+		return
+	}
+
+	listenerRequiredAttrs := []string{"id", "name", "loadbalancers", "protocol", "protocol_port"}
+	lbVMConnKeys := make(map[string]bool)
+	for i := range jListeners {
+		jL := jListeners[i]
+		name := jL.Get("name").MustString()
+		if !cloudcommon.CheckJsonAttributes(jL, listenerRequiredAttrs) {
+			log.Infof("exclude lb_listener: %s, missing attr", name, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		var lbLcuuid string
+		jLBs := jL.Get("loadbalancers")
+		for j := range jLBs.MustArray() {
+			if lbID := jLBs.GetIndex(j).Get("id").MustString(); lbID != "" {
+				lbLcuuid = common.IDGenerateUUID(o.orgID, lbID)
+			}
+		}
+		if _, ok := o.toolDataSet.lbLcuuidToIP[lbLcuuid]; !ok {
+			log.Infof("exclude lb_listener: %s, missing lb info", name, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		if name == "" {
+			name = jL.Get("id").MustString()
+		}
+		listenerLcuuid := common.IDGenerateUUID(o.orgID, jL.Get("id").MustString())
+		protocol := jL.Get("protocol").MustString()
+		lbListeners = append(
+			lbListeners,
+			model.LBListener{
+				Lcuuid:   listenerLcuuid,
+				LBLcuuid: lbLcuuid,
+				Name:     name,
+				Label:    jL.Get("id").MustString(),
+				IPs:      o.toolDataSet.lbLcuuidToIP[lbLcuuid],
+				Protocol: protocol,
+				Port:     jL.Get("protocol_port").MustInt(),
+			},
+		)
+
+		poolID := jL.Get("default_pool_id").MustString()
+		if poolID == "" {
+			continue
+		}
+		jMembers, err := o.getRawData(fmt.Sprintf("%s/lbaas/pools/%s/members", lbURL, poolID), "members", false, nil)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for j := range jMembers {
+			jM := jMembers[j]
+			if !cloudcommon.CheckJsonAttributes(jM, []string{"id", "address", "protocol_port"}) {
+				log.Infof("exclude lb_target_server: %s, missing attr", jM.Get("id").MustString(), logger.NewORGPrefix(o.orgID))
+				continue
+			}
+			ip := jM.Get("address").MustString()
+			serverType := common.LB_SERVER_TYPE_IP
+			vmLcuuid, ok := o.toolDataSet.keyToVMLcuuid[SubnetIPKey{common.IDGenerateUUID(o.orgID, jM.Get("subnet_id").MustString()), ip}]
+			if ok {
+				serverType = common.LB_SERVER_TYPE_VM
+			}
+			lbTargetServers = append(
+				lbTargetServers,
+				model.LBTargetServer{
+					Lcuuid:           common.GenerateUUIDByOrgID(o.orgID, listenerLcuuid+jM.Get("id").MustString()),
+					LBLcuuid:         lbLcuuid,
+					LBListenerLcuuid: listenerLcuuid,
+					Type:             serverType,
+					IP:               ip,
+					VMLcuuid:         vmLcuuid,
+					Protocol:         protocol,
+					Port:             jM.Get("protocol_port").MustInt(),
+					VPCLcuuid:        o.toolDataSet.lbLcuuidToVPCLcuuid[lbLcuuid],
+				},
+			)
+			if vmLcuuid != "" && !lbVMConnKeys[lbLcuuid+vmLcuuid] {
+				lbVMConnKeys[lbLcuuid+vmLcuuid] = true
+				lbVMConns = append(
+					lbVMConns,
+					model.LBVMConnection{
+						Lcuuid:   common.GenerateUUIDByOrgID(o.orgID, lbLcuuid+vmLcuuid),
+						LBLcuuid: lbLcuuid,
+						VMLcuuid: vmLcuuid,
+					},
+				)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+func (o *OpenStack) getNetworks(regionID, regionLcuuid string) ([]model.Network, []model.Subnet, error) {
+	networkURL, ok := o.getEndpoint(regionID, SERVICE_TYPE_NETWORK)
+	if !ok {
+		log.Infof("region (%s) has no network endpoint", regionID, logger.NewORGPrefix(o.orgID))
+		return nil, nil, nil
+	}
+	jNetworks, err := o.getRawData(networkURL+"/networks", "networks", false, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var networks []model.Network
+	for i := range jNetworks {
+		jn := jNetworks[i]
+		name := jn.Get("name").MustString()
+		if !cloudcommon.CheckJsonAttributes(jn, []string{"id", "name"}) {
+			log.Infof("exclude network: %s, missing attr", name, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		projectID := getProjectID(jn)
+		if projectID == "" {
+			log.Infof("exclude network: %s, missing project info", name, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		external := jn.Get("router:external").MustBool()
+		netType := common.NETWORK_TYPE_LAN
+		if external {
+			netType = common.NETWORK_TYPE_WAN
+		}
+		var azLcuuid string
+		if azNames := jn.Get("availability_zones").MustStringArray(); len(azNames) == 1 {
+			azLcuuid = o.azNameToAZLcuuid(regionID, azNames[0])
+		}
+		id := common.IDGenerateUUID(o.orgID, jn.Get("id").MustString())
+		network := model.Network{
+			Lcuuid:         id,
+			Name:           name,
+			SegmentationID: jn.Get("provider:segmentation_id").MustInt(),
+			Shared:         jn.Get("shared").MustBool(),
+			External:       external,
+			NetType:        netType,
+			VPCLcuuid:      o.getVPCLcuuid(projectID, regionLcuuid),
+			AZLcuuid:       azLcuuid,
+			RegionLcuuid:   regionLcuuid,
+		}
+		networks = append(networks, network)
+		o.toolDataSet.lcuuidToNetwork[id] = network
+		if azLcuuid != "" {
+			o.toolDataSet.azLcuuidToResourceNum[azLcuuid]++
+		}
+		o.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+	}
+
+	jSubnets, err := o.getRawData(networkURL+"/subnets", "subnets", false, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var subnets []model.Subnet
+	for i := range jSubnets {
+		js := jSubnets[i]
+		name := js.Get("name").MustString()
+		if !cloudcommon.CheckJsonAttributes(js, []string{"id", "cidr", "network_id"}) {
+			log.Infof("exclude subnet: %s, missing attr", name, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		networkLcuuid := common.IDGenerateUUID(o.orgID, js.Get("network_id").MustString())
+		network, ok := o.toolDataSet.lcuuidToNetwork[networkLcuuid]
+		if !ok {
+			log.Infof("exclude subnet: %s, missing network info", name, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		if name == "" {
+			name = network.Name
+		}
+		subnet := model.Subnet{
+			Lcuuid:        common.IDGenerateUUID(o.orgID, js.Get("id").MustString()),
+			Name:          name,
+			CIDR:          js.Get("cidr").MustString(),
+			GatewayIP:     js.Get("gateway_ip").MustString(),
+			NetworkLcuuid: networkLcuuid,
+			VPCLcuuid:     network.VPCLcuuid,
+		}
+		subnets = append(subnets, subnet)
+		o.toolDataSet.networkLcuuidToSubnets[networkLcuuid] = append(o.toolDataSet.networkLcuuidToSubnets[networkLcuuid], subnet)
+	}
+	return networks, subnets, nil
+}
+
+func (o *OpenStack) getSubnetLcuuid(networkLcuuid, ip string) string {
+	for _, subnet := range o.toolDataSet.networkLcuuidToSubnets[networkLcuuid] {
+		if cloudcommon.IsIPInCIDR(ip, subnet.CIDR) {
+			return subnet.Lcuuid
+		}
+	}
+	return ""
+}
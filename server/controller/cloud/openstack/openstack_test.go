@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/config"
+	cloudtest "github.com/deepflowio/deepflow/server/controller/cloud/test"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	metadbcommon "github.com/deepflowio/deepflow/server/controller/db/metadb/common"
+	"github.com/deepflowio/deepflow/server/controller/statsd"
+	statsdcfg "github.com/deepflowio/deepflow/server/controller/statsd/config"
+)
+
+// 使用录制的openstack api响应模拟keystone/nova/neutron/octavia服务
+func newFixtureServer(t *testing.T) *httptest.Server {
+	fixtures := map[string]string{
+		"/v3/auth/tokens": "auth_tokens.json",
+		"/v3/regions":     "regions.json",
+		"/v3/projects":    "projects.json",
+		"/compute/v2.1/os-availability-zone/detail":    "availability_zones.json",
+		"/compute/v2.1/os-hypervisors/detail":          "hypervisors.json",
+		"/compute/v2.1/servers/detail":                 "servers.json",
+		"/network/v2.0/networks":                       "networks.json",
+		"/network/v2.0/subnets":                        "subnets.json",
+		"/network/v2.0/routers":                        "routers.json",
+		"/network/v2.0/ports":                          "ports.json",
+		"/network/v2.0/floatingips":                    "floatingips.json",
+		"/load-balancer/v2/lbaas/loadbalancers":        "loadbalancers.json",
+		"/load-balancer/v2/lbaas/listeners":            "listeners.json",
+		"/load-balancer/v2/lbaas/pools/pool-1/members": "members.json",
+	}
+	return cloudtest.NewFixtureServer(t, fixtures, "", func(key string, w http.ResponseWriter, r *http.Request) bool {
+		if key != "/v3/auth/tokens" && r.Header.Get("X-Auth-Token") != "test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		}
+		// 云服务器需查询全部项目
+		if key == "/compute/v2.1/servers/detail" && r.URL.Query().Get("all_tenants") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return false
+		}
+		if r.Method == http.MethodPost {
+			w.Header().Set("X-Subject-Token", "test-token")
+			w.WriteHeader(http.StatusCreated)
+		}
+		return true
+	})
+}
+
+func TestOpenStack(t *testing.T) {
+	Convey("TestOpenStack", t, func() {
+		server := newFixtureServer(t)
+		defer server.Close()
+		statsd.NewStatsdMonitor(statsdcfg.StatsdConfig{})
+		config.CONF = &config.CloudConfig{}
+
+		o := &OpenStack{
+			orgID:          metadbcommon.DEFAULT_ORG_ID,
+			lcuuidGenerate: "test_openstack",
+			name:           "test_openstack",
+			httpTimeout:    5,
+			config: &Config{
+				AuthURL:           server.URL,
+				Username:          "admin",
+				Password:          "password",
+				UserDomainName:    DEFAULT_DOMAIN_NAME,
+				ProjectName:       "admin",
+				ProjectDomainName: DEFAULT_DOMAIN_NAME,
+				EndpointType:      DEFAULT_ENDPOINT_TYPE,
+			},
+			debugger: cloudcommon.NewDebugger("test_openstack"),
+		}
+		So(o.CheckAuth(), ShouldBeNil)
+
+		data, err := o.GetCloudData()
+		So(err, ShouldBeNil)
+
+		Convey("openstack resource number should be equal", func() {
+			So(len(data.Regions), ShouldEqual, 1)
+			So(len(data.AZs), ShouldEqual, 1)
+			So(len(data.Hosts), ShouldEqual, 1)
+			So(len(data.VPCs), ShouldEqual, 2)
+			So(len(data.Networks), ShouldEqual, 2)
+			So(len(data.Subnets), ShouldEqual, 2)
+			So(len(data.VRouters), ShouldEqual, 1)
+			So(len(data.RoutingTables), ShouldEqual, 1)
+			So(len(data.VMs), ShouldEqual, 2)
+			So(len(data.DHCPPorts), ShouldEqual, 1)
+			So(len(data.VInterfaces), ShouldEqual, 6)
+			So(len(data.IPs), ShouldEqual, 6)
+			So(len(data.FloatingIPs), ShouldEqual, 1)
+			So(len(data.LBs), ShouldEqual, 1)
+			So(len(data.LBListeners), ShouldEqual, 1)
+			So(len(data.LBTargetServers), ShouldEqual, 2)
+			So(len(data.LBVMConnections), ShouldEqual, 1)
+		})
+
+		Convey("openstack resource relations should be correct", func() {
+			So(data.Hosts[0].HType, ShouldEqual, common.HOST_HTYPE_KVM)
+			So(data.Hosts[0].AZLcuuid, ShouldEqual, data.AZs[0].Lcuuid)
+			for _, vm := range data.VMs {
+				So(vm.LaunchServer, ShouldEqual, "10.0.0.11")
+				So(vm.VPCLcuuid, ShouldEqual, common.GenerateUUIDByOrgID(o.orgID, "p1_"+data.Regions[0].Lcuuid))
+			}
+			So(data.FloatingIPs[0].VMLcuuid, ShouldEqual, common.IDGenerateUUID(o.orgID, "vm-1"))
+			So(data.LBs[0].Model, ShouldEqual, cloudcommon.LB_MODEL_INTERNAL)
+			for _, ts := range data.LBTargetServers {
+				if ts.IP == "192.168.1.10" {
+					So(ts.Type, ShouldEqual, common.LB_SERVER_TYPE_VM)
+				} else {
+					So(ts.Type, ShouldEqual, common.LB_SERVER_TYPE_IP)
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+// getRegions 只同步catalog中存在endpoint的region
+func (o *OpenStack) getRegions() ([]model.Region, error) {
+	jRegions, err := o.getRawData(o.config.AuthURL+"/v3/regions", "regions", false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var regions []model.Region
+	for i := range jRegions {
+		jr := jRegions[i]
+		if !cloudcommon.CheckJsonAttributes(jr, []string{"id"}) {
+			continue
+		}
+		id := jr.Get("id").MustString()
+		if len(o.config.IncludeRegions) > 0 {
+			if _, ok := o.config.IncludeRegions[id]; !ok {
+				log.Infof("exclude region: %s, not included", id, logger.NewORGPrefix(o.orgID))
+				continue
+			}
+		}
+		if _, ok := o.token.endpoints[id]; !ok {
+			log.Infof("exclude region: %s, no endpoint in catalog", id, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+
+		region := model.Region{
+			Lcuuid: common.GenerateUUIDByOrgID(o.orgID, id+"_"+o.lcuuidGenerate),
+			Name:   id,
+		}
+		regions = append(regions, region)
+		o.toolDataSet.regionIDToLcuuid[id] = region.Lcuuid
+	}
+	return regions, nil
+}
+
+func (o *OpenStack) regionIDToLcuuid(regionID string) string {
+	if o.config.RegionLcuuid != "" {
+		return o.config.RegionLcuuid
+	}
+	return o.toolDataSet.regionIDToLcuuid[regionID]
+}
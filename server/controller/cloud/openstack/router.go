@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+func (o *OpenStack) getRouters(regionID, regionLcuuid string) ([]model.VRouter, []model.RoutingTable, error) {
+	networkURL, ok := o.getEndpoint(regionID, SERVICE_TYPE_NETWORK)
+	if !ok {
+		return nil, nil, nil
+	}
+	jRouters, err := o.getRawData(networkURL+"/routers", "routers", false, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var vrouters []model.VRouter
+	var routingTables []model.RoutingTable
+	for i := range jRouters {
+		jr := jRouters[i]
+		name := jr.Get("name").MustString()
+		if !cloudcommon.CheckJsonAttributes(jr, []string{"id", "name"}) {
+			log.Infof("exclude vrouter: %s, missing attr", name, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		projectID := getProjectID(jr)
+		if projectID == "" {
+			log.Infof("exclude vrouter: %s, missing project info", name, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		id := common.IDGenerateUUID(o.orgID, jr.Get("id").MustString())
+		vrouters = append(
+			vrouters,
+			model.VRouter{
+				Lcuuid:       id,
+				Name:         name,
+				Label:        jr.Get("id").MustString(),
+				VPCLcuuid:    o.getVPCLcuuid(projectID, regionLcuuid),
+				RegionLcuuid: regionLcuuid,
+			},
+		)
+		o.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+
+		jRoutes := jr.Get("routes")
+		for j := range jRoutes.MustArray() {
+			jRoute := jRoutes.GetIndex(j)
+			destination := jRoute.Get("destination").MustString()
+			nexthop := jRoute.Get("nexthop").MustString()
+			if destination == "" || nexthop == "" {
+				continue
+			}
+			routingTables = append(
+				routingTables,
+				model.RoutingTable{
+					Lcuuid:        common.GenerateUUIDByOrgID(o.orgID, id+destination+nexthop),
+					VRouterLcuuid: id,
+					Destination:   destination,
+					NexthopType:   common.ROUTING_TABLE_TYPE_IP,
+					Nexthop:       nexthop,
+				},
+			)
+		}
+	}
+	return vrouters, routingTables, nil
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+const (
+	SERVICE_TYPE_IDENTITY      = "identity"
+	SERVICE_TYPE_COMPUTE       = "compute"
+	SERVICE_TYPE_NETWORK       = "network"
+	SERVICE_TYPE_LOAD_BALANCER = "load-balancer"
+)
+
+type Token struct {
+	token     string
+	expiresAt string
+	// region id -> service type -> endpoint url
+	endpoints map[string]map[string]string
+}
+
+// 检查token是否过期，离失效时间小于5m即认为过期
+func (t *Token) isExpired() bool {
+	expire, err := time.Parse(time.RFC3339, t.expiresAt)
+	if err != nil {
+		log.Errorf("parse expire time error: %s, %v", t.expiresAt, err)
+		return true
+	}
+	return expire.Sub(time.Now()).Minutes() < 5
+}
+
+func (o *OpenStack) getToken() (*Token, error) {
+	if o.token == nil || o.token.isExpired() {
+		t, err := o.createToken()
+		if err != nil {
+			return nil, err
+		}
+		o.token = t
+	}
+	return o.token, nil
+}
+
+// keystone v3密码认证，token的作用域为配置的project
+func (o *OpenStack) createToken() (*Token, error) {
+	authBody := map[string]interface{}{
+		"auth": map[string]interface{}{
+			"identity": map[string]interface{}{
+				"methods": []string{"password"},
+				"password": map[string]interface{}{
+					"user": map[string]interface{}{
+						"domain": map[string]interface{}{
+							"name": o.config.UserDomainName,
+						},
+						"name":     o.config.Username,
+						"password": o.config.Password,
+					},
+				},
+			},
+			"scope": map[string]interface{}{
+				"project": map[string]interface{}{
+					"domain": map[string]interface{}{
+						"name": o.config.ProjectDomainName,
+					},
+					"name": o.config.ProjectName,
+				},
+			},
+		},
+	}
+	resp, err := RequestPost(o.config.AuthURL+"/v3/auth/tokens", time.Duration(o.httpTimeout), authBody)
+	if err != nil {
+		return nil, err
+	}
+	token := &Token{
+		token:     resp.Get("X-Subject-Token").MustString(),
+		expiresAt: resp.Get("token").Get("expires_at").MustString(),
+		endpoints: o.parseCatalog(resp.Get("token").Get("catalog")),
+	}
+	if token.token == "" {
+		return nil, errors.New("keystone response has no X-Subject-Token header")
+	}
+	if len(token.endpoints) == 0 {
+		return nil, errors.New("keystone response has no service catalog")
+	}
+	return token, nil
+}
+
+func (o *OpenStack) parseCatalog(jCatalog *simplejson.Json) map[string]map[string]string {
+	endpoints := make(map[string]map[string]string)
+	for i := range jCatalog.MustArray() {
+		jService := jCatalog.GetIndex(i)
+		serviceType := jService.Get("type").MustString()
+		jEndpoints := jService.Get("endpoints")
+		for j := range jEndpoints.MustArray() {
+			jEndpoint := jEndpoints.GetIndex(j)
+			if jEndpoint.Get("interface").MustString() != o.config.EndpointType {
+				continue
+			}
+			regionID := jEndpoint.Get("region_id").MustString()
+			if regionID == "" {
+				regionID = jEndpoint.Get("region").MustString()
+			}
+			if _, ok := endpoints[regionID]; !ok {
+				endpoints[regionID] = make(map[string]string)
+			}
+			endpoints[regionID][serviceType] = strings.TrimSuffix(jEndpoint.Get("url").MustString(), "/")
+		}
+	}
+	log.Debugf("endpoints info (%+v)", endpoints, logger.NewORGPrefix(o.orgID))
+	return endpoints
+}
+
+// getEndpoint 获取region中服务的endpoint，network/load-balancer服务的endpoint统一补齐版本号
+func (o *OpenStack) getEndpoint(regionID, serviceType string) (string, bool) {
+	url, ok := o.token.endpoints[regionID][serviceType]
+	if !ok || url == "" {
+		return "", false
+	}
+	if serviceType == SERVICE_TYPE_NETWORK && !strings.HasSuffix(url, "/v2.0") {
+		url += "/v2.0"
+	}
+	if serviceType == SERVICE_TYPE_LOAD_BALANCER && !strings.HasSuffix(url, "/v2") && !strings.HasSuffix(url, "/v2.0") {
+		url += "/v2"
+	}
+	return url, true
+}
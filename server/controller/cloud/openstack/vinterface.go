@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	"strings"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+const (
+	DEVICE_OWNER_VM_PRE       = "compute"
+	DEVICE_OWNER_ROUTER_GW    = "network:router_gateway"
+	DEVICE_OWNER_ROUTER_IFACE = "network:router_interface"
+	DEVICE_OWNER_ROUTER_HA    = "network:ha_router_replicated_interface"
+	DEVICE_OWNER_ROUTER_DVR   = "network:router_interface_distributed"
+	DEVICE_OWNER_DHCP         = "network:dhcp"
+)
+
+func (o *OpenStack) getVInterfaces(regionID, regionLcuuid string) ([]model.DHCPPort, []model.VInterface, []model.IP, error) {
+	networkURL, ok := o.getEndpoint(regionID, SERVICE_TYPE_NETWORK)
+	if !ok {
+		return nil, nil, nil, nil
+	}
+	// neutron不支持all_tenants参数(开启过滤参数校验时会返回400)，admin角色默认返回全部项目的端口
+	jPorts, err := o.getRawData(networkURL+"/ports", "ports", true, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var dhcpPorts []model.DHCPPort
+	var vifs []model.VInterface
+	var ips []model.IP
+	vifRequiredAttrs := []string{"id", "mac_address", "network_id", "device_id", "device_owner"}
+	for i := range jPorts {
+		jPort := jPorts[i]
+		mac := jPort.Get("mac_address").MustString()
+		if !cloudcommon.CheckJsonAttributes(jPort, vifRequiredAttrs) {
+			log.Infof("exclude vinterface: %s, missing attr", mac, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		networkLcuuid := common.IDGenerateUUID(o.orgID, jPort.Get("network_id").MustString())
+		network, ok := o.toolDataSet.lcuuidToNetwork[networkLcuuid]
+		if !ok {
+			log.Infof("exclude vinterface: %s, missing network info", mac, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		id := common.IDGenerateUUID(o.orgID, jPort.Get("id").MustString())
+		deviceLcuuid := common.IDGenerateUUID(o.orgID, jPort.Get("device_id").MustString())
+		deviceOwner := jPort.Get("device_owner").MustString()
+
+		var deviceType int
+		switch {
+		case strings.HasPrefix(deviceOwner, DEVICE_OWNER_VM_PRE):
+			if _, ok := o.toolDataSet.lcuuidToVM[deviceLcuuid]; !ok {
+				log.Infof("exclude vinterface: %s, missing vm info", mac, logger.NewORGPrefix(o.orgID))
+				continue
+			}
+			deviceType = common.VIF_DEVICE_TYPE_VM
+		case common.Contains([]string{DEVICE_OWNER_ROUTER_GW, DEVICE_OWNER_ROUTER_IFACE, DEVICE_OWNER_ROUTER_HA, DEVICE_OWNER_ROUTER_DVR}, deviceOwner):
+			deviceType = common.VIF_DEVICE_TYPE_VROUTER
+		case deviceOwner == DEVICE_OWNER_DHCP:
+			deviceType = common.VIF_DEVICE_TYPE_DHCP_PORT
+			deviceLcuuid = id
+			name := network.Name + "_DHCP"
+			if len(name) > 256 {
+				name = name[:256]
+			}
+			dhcpPorts = append(
+				dhcpPorts,
+				model.DHCPPort{
+					Lcuuid:       id,
+					Name:         name,
+					VPCLcuuid:    network.VPCLcuuid,
+					AZLcuuid:     network.AZLcuuid,
+					RegionLcuuid: regionLcuuid,
+				},
+			)
+		default:
+			// floating ip和负载均衡器的端口由对应资源处理
+			log.Debugf("exclude vinterface: %s, %s", mac, deviceOwner, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+
+		vifType := common.VIF_TYPE_LAN
+		if network.External {
+			vifType = common.VIF_TYPE_WAN
+		}
+		vif := model.VInterface{
+			Lcuuid:        id,
+			Mac:           mac,
+			Type:          vifType,
+			DeviceType:    deviceType,
+			DeviceLcuuid:  deviceLcuuid,
+			NetworkLcuuid: network.Lcuuid,
+			VPCLcuuid:     network.VPCLcuuid,
+			RegionLcuuid:  regionLcuuid,
+		}
+		vifs = append(vifs, vif)
+		o.toolDataSet.portIDToVInterface[jPort.Get("id").MustString()] = vif
+
+		jIPs := jPort.Get("fixed_ips")
+		for j := range jIPs.MustArray() {
+			jIP := jIPs.GetIndex(j)
+			ipAddr := jIP.Get("ip_address").MustString()
+			if ipAddr == "" {
+				continue
+			}
+			subnetLcuuid := common.IDGenerateUUID(o.orgID, jIP.Get("subnet_id").MustString())
+			ips = append(
+				ips,
+				model.IP{
+					Lcuuid:           common.GenerateUUIDByOrgID(o.orgID, id+ipAddr),
+					VInterfaceLcuuid: id,
+					IP:               ipAddr,
+					SubnetLcuuid:     subnetLcuuid,
+					RegionLcuuid:     regionLcuuid,
+				},
+			)
+			if deviceType == common.VIF_DEVICE_TYPE_VM {
+				o.toolDataSet.keyToVMLcuuid[SubnetIPKey{subnetLcuuid, ipAddr}] = deviceLcuuid
+			}
+		}
+	}
+	return dhcpPorts, vifs, ips, nil
+}
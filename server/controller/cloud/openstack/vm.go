@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	"fmt"
+	"time"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+var STATE_CONVERTION = map[string]int{
+	"ACTIVE":  common.VM_STATE_RUNNING,
+	"SHUTOFF": common.VM_STATE_STOPPED,
+	"ERROR":   common.VM_STATE_EXCEPTION,
+}
+
+func (o *OpenStack) getVMs(regionID, regionLcuuid string) ([]model.VM, error) {
+	computeURL, ok := o.getEndpoint(regionID, SERVICE_TYPE_COMPUTE)
+	if !ok {
+		return nil, nil
+	}
+	// 需要admin角色，all_tenants用于查询全部项目的云服务器，否则仅返回token所属项目的云服务器
+	jVMs, err := o.getRawData(fmt.Sprintf("%s/servers/detail?all_tenants=1", computeURL), "servers", true, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var vms []model.VM
+	requiredAttrs := []string{"id", "name", "status", "tenant_id", "OS-EXT-AZ:availability_zone"}
+	for i := range jVMs {
+		jVM := jVMs[i]
+		name := jVM.Get("name").MustString()
+		if !cloudcommon.CheckJsonAttributes(jVM, requiredAttrs) {
+			log.Infof("exclude vm: %s, missing attr", name, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		azLcuuid := o.azNameToAZLcuuid(regionID, jVM.Get("OS-EXT-AZ:availability_zone").MustString())
+		if azLcuuid == "" {
+			log.Infof("exclude vm: %s, missing az info", name, logger.NewORGPrefix(o.orgID))
+			continue
+		}
+		state, ok := STATE_CONVERTION[jVM.Get("status").MustString()]
+		if !ok {
+			state = common.VM_STATE_EXCEPTION
+		}
+		cloudTags := map[string]string{}
+		for k, v := range jVM.Get("metadata").MustMap() {
+			if s, ok := v.(string); ok {
+				cloudTags[k] = s
+			}
+		}
+		id := common.IDGenerateUUID(o.orgID, jVM.Get("id").MustString())
+		vm := model.VM{
+			Lcuuid:       id,
+			Name:         name,
+			Label:        jVM.Get("id").MustString(),
+			HType:        common.VM_HTYPE_VM_C,
+			State:        state,
+			LaunchServer: o.toolDataSet.hostNameToIP[jVM.Get("OS-EXT-SRV-ATTR:host").MustString()],
+			VPCLcuuid:    o.getVPCLcuuid(jVM.Get("tenant_id").MustString(), regionLcuuid),
+			AZLcuuid:     azLcuuid,
+			RegionLcuuid: regionLcuuid,
+			CloudTags:    cloudTags,
+		}
+		created := jVM.Get("created").MustString()
+		if created != "" {
+			createdAt, err := time.Parse(time.RFC3339, created)
+			if err != nil {
+				log.Errorf("parse created failed: %s", created, logger.NewORGPrefix(o.orgID))
+			} else {
+				vm.CreatedAt = createdAt
+			}
+		}
+		vms = append(vms, vm)
+		o.toolDataSet.lcuuidToVM[id] = vm
+		o.toolDataSet.azLcuuidToResourceNum[azLcuuid]++
+		o.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+	}
+	return vms, nil
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openstack
+
+import (
+	"sort"
+
+	"github.com/bitly/go-simplejson"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+// getProjects 获取项目名称，用于VPC命名；需要admin权限，失败时使用项目ID作为VPC名称
+func (o *OpenStack) getProjects() {
+	jProjects, err := o.getRawData(o.config.AuthURL+"/v3/projects", "projects", false, nil)
+	if err != nil {
+		log.Warningf("get projects failed, use project id as vpc name: %s", err.Error(), logger.NewORGPrefix(o.orgID))
+		return
+	}
+	for i := range jProjects {
+		jp := jProjects[i]
+		if !cloudcommon.CheckJsonAttributes(jp, []string{"id", "name"}) {
+			continue
+		}
+		o.toolDataSet.projectIDToName[jp.Get("id").MustString()] = jp.Get("name").MustString()
+	}
+}
+
+// OpenStack中没有VPC的概念，每个region中的每个项目(租户)对应一个VPC
+func (o *OpenStack) getVPCLcuuid(projectID, regionLcuuid string) string {
+	lcuuid := common.GenerateUUIDByOrgID(o.orgID, projectID+"_"+regionLcuuid)
+	if _, ok := o.toolDataSet.vpcLcuuidToVPC[lcuuid]; ok {
+		return lcuuid
+	}
+	name, ok := o.toolDataSet.projectIDToName[projectID]
+	if !ok {
+		name = projectID
+	}
+	o.toolDataSet.vpcLcuuidToVPC[lcuuid] = model.VPC{
+		Lcuuid:       lcuuid,
+		Name:         name,
+		Label:        projectID,
+		RegionLcuuid: regionLcuuid,
+	}
+	o.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+	return lcuuid
+}
+
+func (o *OpenStack) getVPCs() []model.VPC {
+	var vpcs []model.VPC
+	for _, vpc := range o.toolDataSet.vpcLcuuidToVPC {
+		vpcs = append(vpcs, vpc)
+	}
+	sort.Slice(vpcs, func(i, j int) bool { return vpcs[i].Lcuuid < vpcs[j].Lcuuid })
+	return vpcs
+}
+
+// neutron资源中project_id和tenant_id均表示所属项目，旧版本中只有tenant_id
+func getProjectID(j *simplejson.Json) string {
+	if projectID := j.Get("project_id").MustString(); projectID != "" {
+		return projectID
+	}
+	return j.Get("tenant_id").MustString()
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// NewFixtureServer 使用 testfiles 目录下录制的 api 响应模拟云平台服务，响应中的 {{endpoint}} 替换为服务地址。
+// fixtures 为请求 key 到响应文件的映射，key 为请求路径，分页请求的 key 为 "路径?分页参数值"，pageParam 为空时不区分分页；
+// authorize 用于各云平台校验认证信息或设置响应头，返回 false 时已写入错误响应
+func NewFixtureServer(t *testing.T, fixtures map[string]string, pageParam string, authorize func(key string, w http.ResponseWriter, r *http.Request) bool) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Path
+		if pageParam != "" {
+			if page := r.URL.Query().Get(pageParam); page != "" {
+				key += "?" + page
+			}
+		}
+		file, ok := fixtures[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if authorize != nil && !authorize(key, w, r) {
+			return
+		}
+		data, err := os.ReadFile("testfiles/" + file)
+		if err != nil {
+			t.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(strings.ReplaceAll(string(data), "{{endpoint}}", server.URL)))
+	}))
+	return server
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vsphere
+
+import (
+	"context"
+
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+)
+
+// getAZs 集群及独立主机(ComputeResource)均作为AZ
+func (v *VSphere) getAZs(ctx context.Context, dc types.ManagedObjectReference, regionLcuuid string) ([]model.AZ, error) {
+	var crs []mo.ComputeResource
+	err := v.retrieve(ctx, dc, "ComputeResource", []string{"name", "host"}, &crs)
+	if err != nil {
+		return nil, err
+	}
+
+	var azs []model.AZ
+	for _, cr := range crs {
+		lcuuid := common.GenerateUUIDByOrgID(v.orgID, cr.Self.Value+"_"+v.lcuuidGenerate)
+		azs = append(
+			azs,
+			model.AZ{
+				Lcuuid:       lcuuid,
+				Name:         cr.Name,
+				Label:        cr.Self.Value,
+				RegionLcuuid: regionLcuuid,
+			},
+		)
+		for _, host := range cr.Host {
+			v.toolDataSet.hostIDToAZLcuuid[host.Value] = lcuuid
+		}
+	}
+	return azs, nil
+}
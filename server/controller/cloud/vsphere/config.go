@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vsphere
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/bitly/go-simplejson"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+type Config struct {
+	RegionLcuuid   string
+	URL            *url.URL // vCenter sdk地址，如 https://vcenter.example.com/sdk
+	Username       string
+	Password       string
+	Insecure       bool            // 是否跳过证书校验
+	IncludeRegions map[string]bool // 需要同步的数据中心名称
+}
+
+func (c *Config) LoadFromString(orgID int, sConf string) (err error) {
+	jConf, err := simplejson.NewJson([]byte(sConf))
+	if err != nil {
+		log.Errorf("convert config string: %s to json failed: %v", sConf, err, logger.NewORGPrefix(orgID))
+		return
+	}
+	host, err := jConf.Get("host").String()
+	if err != nil {
+		log.Error("host must be specified", logger.NewORGPrefix(orgID))
+		return
+	}
+	c.URL, err = parseURL(host)
+	if err != nil {
+		log.Errorf("parse host (%s) failed: %s", host, err.Error(), logger.NewORGPrefix(orgID))
+		return
+	}
+	c.Username, err = jConf.Get("username").String()
+	if err != nil {
+		log.Error("username must be specified", logger.NewORGPrefix(orgID))
+		return
+	}
+	pswd, err := jConf.Get("password").String()
+	if err != nil {
+		log.Error("password must be specified", logger.NewORGPrefix(orgID))
+		return
+	}
+	dpswd, err := common.DecryptSecretKey(pswd)
+	if err != nil {
+		log.Errorf("decrypt password failed (%s)", err.Error(), logger.NewORGPrefix(orgID))
+		return
+	}
+	c.Password = dpswd
+	c.Insecure = jConf.Get("insecure").MustBool(true)
+	c.RegionLcuuid = jConf.Get("region_uuid").MustString()
+	c.IncludeRegions = cloudcommon.UniqRegions(jConf.Get("include_regions").MustString())
+	return
+}
+
+// parseURL 支持只配置vCenter地址，缺省使用https协议和/sdk路径
+func parseURL(host string) (*url.URL, error) {
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/sdk"
+	}
+	return u, nil
+}
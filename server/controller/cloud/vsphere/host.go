@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vsphere
+
+import (
+	"context"
+
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+func (v *VSphere) getHosts(ctx context.Context, dc types.ManagedObjectReference, regionLcuuid string) ([]model.Host, error) {
+	var hss []mo.HostSystem
+	err := v.retrieve(ctx, dc, "HostSystem", []string{"name", "summary", "config.network.vnic"}, &hss)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []model.Host
+	for _, hs := range hss {
+		azLcuuid, ok := v.toolDataSet.hostIDToAZLcuuid[hs.Self.Value]
+		if !ok {
+			log.Infof("exclude host: %s, missing az info", hs.Name, logger.NewORGPrefix(v.orgID))
+			continue
+		}
+		host := model.Host{
+			Lcuuid:       common.GenerateUUIDByOrgID(v.orgID, hs.Self.Value+"_"+v.lcuuidGenerate),
+			Name:         hs.Name,
+			IP:           getHostIP(hs),
+			Hostname:     hs.Name,
+			Type:         common.HOST_TYPE_VM,
+			HType:        common.HOST_HTYPE_ESXI,
+			AZLcuuid:     azLcuuid,
+			RegionLcuuid: regionLcuuid,
+		}
+		if hw := hs.Summary.Hardware; hw != nil {
+			host.VCPUNum = int(hw.NumCpuThreads)
+			host.MemTotal = int(hw.MemorySize / 1024 / 1024)
+		}
+		hosts = append(hosts, host)
+		v.toolDataSet.hostIDToIP[hs.Self.Value] = host.IP
+		v.toolDataSet.azLcuuidToResourceNum[azLcuuid]++
+		v.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+	}
+	return hosts, nil
+}
+
+// getHostIP 使用第一个VMkernel网卡的地址作为主机IP，没有时使用主机名称(通常为管理IP)
+func getHostIP(hs mo.HostSystem) string {
+	if hs.Config != nil && hs.Config.Network != nil {
+		for _, vnic := range hs.Config.Network.Vnic {
+			if vnic.Spec.Ip != nil && vnic.Spec.Ip.IpAddress != "" {
+				return vnic.Spec.Ip.IpAddress
+			}
+		}
+	}
+	return hs.Name
+}
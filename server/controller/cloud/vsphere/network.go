@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vsphere
+
+import (
+	"context"
+	"strings"
+
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+const (
+	NETWORK_TYPE_STANDARD = "Network"
+	DVS_UPLINK_TAG        = "SYSTEM/DVS.UPLINKPG"
+	DVS_UPLINK_NAME_INFIX = "-DVUplinks-"
+)
+
+// getNetworks 标准交换机端口组和分布式交换机端口组均作为network，分布式交换机的上行链路端口组除外
+func (v *VSphere) getNetworks(ctx context.Context, dc types.ManagedObjectReference, vpcLcuuid, regionLcuuid string) ([]model.Network, error) {
+	var stdNetworks []mo.Network
+	err := v.retrieve(ctx, dc, NETWORK_TYPE_STANDARD, []string{"name"}, &stdNetworks)
+	if err != nil {
+		return nil, err
+	}
+	var pgs []mo.DistributedVirtualPortgroup
+	err = v.retrieve(ctx, dc, "DistributedVirtualPortgroup", []string{"name", "key", "tag", "config.defaultPortConfig"}, &pgs)
+	if err != nil {
+		return nil, err
+	}
+
+	var networks []model.Network
+	addNetwork := func(ref types.ManagedObjectReference, name string, vlanID int) string {
+		lcuuid := common.GenerateUUIDByOrgID(v.orgID, ref.Value+"_"+v.lcuuidGenerate)
+		network := model.Network{
+			Lcuuid:         lcuuid,
+			Name:           name,
+			Label:          ref.Value,
+			SegmentationID: vlanID,
+			NetType:        common.NETWORK_TYPE_LAN,
+			VPCLcuuid:      vpcLcuuid,
+			RegionLcuuid:   regionLcuuid,
+		}
+		networks = append(networks, network)
+		v.toolDataSet.lcuuidToNetwork[lcuuid] = network
+		v.toolDataSet.networkIDToLcuuid[ref.Value] = lcuuid
+		v.toolDataSet.networkNameToLcuuid[dc.Value+"/"+name] = lcuuid
+		v.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+		return lcuuid
+	}
+
+	// container view中Network类型包含其子类型，此处只处理标准端口组
+	for _, n := range stdNetworks {
+		if n.Self.Type != NETWORK_TYPE_STANDARD {
+			continue
+		}
+		addNetwork(n.Self, n.Name, 0)
+	}
+	for _, pg := range pgs {
+		if isUplinkPortgroup(pg) {
+			log.Infof("exclude network: %s, dvs uplink portgroup", pg.Name, logger.NewORGPrefix(v.orgID))
+			continue
+		}
+		lcuuid := addNetwork(pg.Self, pg.Name, getPortgroupVlanID(pg))
+		v.toolDataSet.portgroupKeyToLcuuid[pg.Key] = lcuuid
+	}
+	return networks, nil
+}
+
+func isUplinkPortgroup(pg mo.DistributedVirtualPortgroup) bool {
+	for _, tag := range pg.Tag {
+		if tag.Key == DVS_UPLINK_TAG {
+			return true
+		}
+	}
+	return strings.Contains(pg.Name, DVS_UPLINK_NAME_INFIX)
+}
+
+func getPortgroupVlanID(pg mo.DistributedVirtualPortgroup) int {
+	setting, ok := pg.Config.DefaultPortConfig.(*types.VMwareDVSPortSetting)
+	if !ok || setting == nil {
+		return 0
+	}
+	if vlan, ok := setting.Vlan.(*types.VmwareDistributedVirtualSwitchVlanIdSpec); ok && vlan != nil {
+		return int(vlan.VlanId)
+	}
+	return 0
+}
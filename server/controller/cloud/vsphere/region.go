@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vsphere
+
+import (
+	"context"
+
+	"github.com/vmware/govmomi/vim25/mo"
+
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+func (v *VSphere) getDatacenters(ctx context.Context) ([]mo.Datacenter, error) {
+	var dcs []mo.Datacenter
+	err := v.retrieve(ctx, v.client.ServiceContent.RootFolder, "Datacenter", []string{"name"}, &dcs)
+	if err != nil {
+		return nil, err
+	}
+
+	var retDCs []mo.Datacenter
+	for _, dc := range dcs {
+		if len(v.config.IncludeRegions) > 0 {
+			if _, ok := v.config.IncludeRegions[dc.Name]; !ok {
+				log.Infof("exclude datacenter: %s, not included", dc.Name, logger.NewORGPrefix(v.orgID))
+				continue
+			}
+		}
+		retDCs = append(retDCs, dc)
+	}
+	return retDCs, nil
+}
+
+// vSphere中没有VPC的概念，每个数据中心对应一个region和一个VPC
+func (v *VSphere) formatRegionAndVPC(dc mo.Datacenter) (model.Region, model.VPC) {
+	region := model.Region{
+		Lcuuid: common.GenerateUUIDByOrgID(v.orgID, dc.Self.Value+"_"+v.lcuuidGenerate),
+		Name:   dc.Name,
+	}
+	vpc := model.VPC{
+		Lcuuid:       common.GenerateUUIDByOrgID(v.orgID, dc.Self.Value+"_vpc_"+v.lcuuidGenerate),
+		Name:         dc.Name,
+		Label:        dc.Self.Value,
+		RegionLcuuid: region.Lcuuid,
+	}
+	return region, vpc
+}
+
+func (v *VSphere) getRegionLcuuid(lcuuid string) string {
+	if v.config.RegionLcuuid != "" {
+		return v.config.RegionLcuuid
+	}
+	return lcuuid
+}
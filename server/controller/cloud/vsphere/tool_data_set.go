@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vsphere
+
+import (
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+)
+
+type ToolDataSet struct {
+	hostIDToAZLcuuid       map[string]string
+	hostIDToIP             map[string]string
+	networkIDToLcuuid      map[string]string // 标准端口组和分布式端口组的moref -> network lcuuid
+	portgroupKeyToLcuuid   map[string]string // 分布式端口组key -> network lcuuid
+	networkNameToLcuuid    map[string]string // 数据中心ID + VMware Tools上报的网络名称 -> network lcuuid
+	lcuuidToNetwork        map[string]model.Network
+	networkLcuuidToSubnets map[string][]model.Subnet
+
+	regionLcuuidToResourceNum map[string]int
+	azLcuuidToResourceNum     map[string]int
+}
+
+func NewToolDataSet() *ToolDataSet {
+	return &ToolDataSet{
+		hostIDToAZLcuuid:          make(map[string]string),
+		hostIDToIP:                make(map[string]string),
+		networkIDToLcuuid:         make(map[string]string),
+		portgroupKeyToLcuuid:      make(map[string]string),
+		networkNameToLcuuid:       make(map[string]string),
+		lcuuidToNetwork:           make(map[string]model.Network),
+		networkLcuuidToSubnets:    make(map[string][]model.Subnet),
+		regionLcuuidToResourceNum: make(map[string]int),
+		azLcuuidToResourceNum:     make(map[string]int),
+	}
+}
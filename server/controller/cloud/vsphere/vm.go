@@ -0,0 +1,252 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+var STATE_CONVERTION = map[types.VirtualMachinePowerState]int{
+	types.VirtualMachinePowerStatePoweredOn:  common.VM_STATE_RUNNING,
+	types.VirtualMachinePowerStatePoweredOff: common.VM_STATE_STOPPED,
+}
+
+// vmNIC 虚拟机网卡，网络信息来自网卡的backing，IP信息来自VMware Tools
+type vmNIC struct {
+	key           int32
+	mac           string
+	networkLcuuid string
+}
+
+func (v *VSphere) getVMs(ctx context.Context, dc types.ManagedObjectReference, vpcLcuuid, regionLcuuid string) (
+	[]model.VM, []model.VInterface, []model.IP, []model.Subnet, error,
+) {
+	var mvms []mo.VirtualMachine
+	err := v.retrieve(ctx, dc, "VirtualMachine", []string{"name", "config", "runtime", "guest"}, &mvms)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	var vms []model.VM
+	var vifs []model.VInterface
+	var ips []model.IP
+	var subnets []model.Subnet
+	for _, mvm := range mvms {
+		if mvm.Config == nil {
+			log.Infof("exclude vm: %s, missing config", mvm.Name, logger.NewORGPrefix(v.orgID))
+			continue
+		}
+		if mvm.Config.Template {
+			log.Debugf("exclude vm: %s, is template", mvm.Name, logger.NewORGPrefix(v.orgID))
+			continue
+		}
+		var hostID string
+		if mvm.Runtime.Host != nil {
+			hostID = mvm.Runtime.Host.Value
+		}
+		azLcuuid, ok := v.toolDataSet.hostIDToAZLcuuid[hostID]
+		if !ok {
+			log.Infof("exclude vm: %s, missing az info", mvm.Name, logger.NewORGPrefix(v.orgID))
+			continue
+		}
+		uuid := mvm.Config.InstanceUuid
+		if uuid == "" {
+			uuid = mvm.Self.Value + "_" + v.lcuuidGenerate
+		}
+		state, ok := STATE_CONVERTION[mvm.Runtime.PowerState]
+		if !ok {
+			state = common.VM_STATE_EXCEPTION
+		}
+		vmLcuuid := common.IDGenerateUUID(v.orgID, uuid)
+		vm := model.VM{
+			Lcuuid:       vmLcuuid,
+			Name:         mvm.Name,
+			Label:        mvm.Self.Value,
+			HType:        common.VM_HTYPE_VM_C,
+			State:        state,
+			LaunchServer: v.toolDataSet.hostIDToIP[hostID],
+			VPCLcuuid:    vpcLcuuid,
+			AZLcuuid:     azLcuuid,
+			RegionLcuuid: regionLcuuid,
+		}
+		if mvm.Config.CreateDate != nil {
+			vm.CreatedAt = *mvm.Config.CreateDate
+		}
+		if mvm.Guest != nil {
+			vm.Hostname = mvm.Guest.HostName
+			vm.IP = mvm.Guest.IpAddress
+		}
+		vms = append(vms, vm)
+		v.toolDataSet.azLcuuidToResourceNum[azLcuuid]++
+		v.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+
+		for _, nic := range v.getVMNICs(dc, mvm) {
+			vifLcuuid := common.GenerateUUIDByOrgID(v.orgID, vmLcuuid+nic.mac)
+			vifs = append(
+				vifs,
+				model.VInterface{
+					Lcuuid:        vifLcuuid,
+					Type:          common.VIF_TYPE_LAN,
+					Mac:           nic.mac,
+					DeviceLcuuid:  vmLcuuid,
+					DeviceType:    common.VIF_DEVICE_TYPE_VM,
+					NetworkLcuuid: nic.networkLcuuid,
+					VPCLcuuid:     vpcLcuuid,
+					RegionLcuuid:  regionLcuuid,
+				},
+			)
+			for _, addr := range getGuestNICIPs(mvm.Guest, nic) {
+				subnetLcuuid, subnet := v.getSubnet(nic.networkLcuuid, addr)
+				if subnet != nil {
+					subnets = append(subnets, *subnet)
+				}
+				ips = append(
+					ips,
+					model.IP{
+						Lcuuid:           common.GenerateUUIDByOrgID(v.orgID, vifLcuuid+addr.ip),
+						VInterfaceLcuuid: vifLcuuid,
+						IP:               addr.ip,
+						SubnetLcuuid:     subnetLcuuid,
+						RegionLcuuid:     regionLcuuid,
+					},
+				)
+			}
+		}
+	}
+	return vms, vifs, ips, subnets, nil
+}
+
+// getVMNICs 从虚拟机硬件中获取以太网卡，根据backing关联标准端口组或分布式端口组
+func (v *VSphere) getVMNICs(dc types.ManagedObjectReference, mvm mo.VirtualMachine) []vmNIC {
+	var nics []vmNIC
+	for _, device := range mvm.Config.Hardware.Device {
+		card, ok := device.(types.BaseVirtualEthernetCard)
+		if !ok {
+			continue
+		}
+		ethernet := card.GetVirtualEthernetCard()
+		if ethernet.MacAddress == "" {
+			continue
+		}
+		nic := vmNIC{key: ethernet.Key, mac: strings.ToLower(ethernet.MacAddress)}
+		switch backing := ethernet.Backing.(type) {
+		case *types.VirtualEthernetCardNetworkBackingInfo:
+			if backing.Network != nil {
+				nic.networkLcuuid = v.toolDataSet.networkIDToLcuuid[backing.Network.Value]
+			}
+		case *types.VirtualEthernetCardDistributedVirtualPortBackingInfo:
+			nic.networkLcuuid = v.toolDataSet.portgroupKeyToLcuuid[backing.Port.PortgroupKey]
+		}
+		// 其他类型的backing(如NSX opaque network)使用VMware Tools上报的网络名称关联
+		if nic.networkLcuuid == "" && mvm.Guest != nil {
+			for _, guestNIC := range mvm.Guest.Net {
+				if guestNIC.DeviceConfigId == nic.key || strings.EqualFold(guestNIC.MacAddress, nic.mac) {
+					nic.networkLcuuid = v.toolDataSet.networkNameToLcuuid[dc.Value+"/"+guestNIC.Network]
+					break
+				}
+			}
+		}
+		if nic.networkLcuuid == "" {
+			log.Infof("exclude vinterface: %s of vm: %s, missing network info", nic.mac, mvm.Name, logger.NewORGPrefix(v.orgID))
+			continue
+		}
+		nics = append(nics, nic)
+	}
+	return nics
+}
+
+type guestIP struct {
+	ip           string
+	prefixLength int32 // 为0时表示未知
+}
+
+// getGuestNICIPs 获取VMware Tools上报的网卡IP，忽略IPv6 link-local地址
+func getGuestNICIPs(guest *types.GuestInfo, nic vmNIC) []guestIP {
+	if guest == nil {
+		return nil
+	}
+	var addrs []guestIP
+	for _, guestNIC := range guest.Net {
+		if guestNIC.DeviceConfigId != nic.key && !strings.EqualFold(guestNIC.MacAddress, nic.mac) {
+			continue
+		}
+		if guestNIC.IpConfig != nil {
+			for _, addr := range guestNIC.IpConfig.IpAddress {
+				addrs = append(addrs, guestIP{addr.IpAddress, addr.PrefixLength})
+			}
+		} else {
+			for _, addr := range guestNIC.IpAddress {
+				addrs = append(addrs, guestIP{ip: addr})
+			}
+		}
+		break
+	}
+	var ret []guestIP
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr.ip)
+		if ip == nil || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		ret = append(ret, addr)
+	}
+	return ret
+}
+
+// getSubnet vSphere中没有子网，根据VMware Tools上报的IP和掩码生成，返回新生成的subnet
+func (v *VSphere) getSubnet(networkLcuuid string, addr guestIP) (string, *model.Subnet) {
+	if addr.prefixLength == 0 {
+		for _, subnet := range v.toolDataSet.networkLcuuidToSubnets[networkLcuuid] {
+			if cloudcommon.IsIPInCIDR(addr.ip, subnet.CIDR) {
+				return subnet.Lcuuid, nil
+			}
+		}
+		return "", nil
+	}
+	_, ipNet, err := net.ParseCIDR(fmt.Sprintf("%s/%d", addr.ip, addr.prefixLength))
+	if err != nil {
+		log.Infof("invalid ip: %s/%d", addr.ip, addr.prefixLength, logger.NewORGPrefix(v.orgID))
+		return "", nil
+	}
+	cidr := ipNet.String()
+	lcuuid := common.GenerateUUIDByOrgID(v.orgID, networkLcuuid+cidr)
+	for _, subnet := range v.toolDataSet.networkLcuuidToSubnets[networkLcuuid] {
+		if subnet.Lcuuid == lcuuid {
+			return lcuuid, nil
+		}
+	}
+	network := v.toolDataSet.lcuuidToNetwork[networkLcuuid]
+	subnet := model.Subnet{
+		Lcuuid:        lcuuid,
+		Name:          network.Name + "_" + cidr,
+		CIDR:          cidr,
+		NetworkLcuuid: networkLcuuid,
+		VPCLcuuid:     network.VPCLcuuid,
+	}
+	v.toolDataSet.networkLcuuidToSubnets[networkLcuuid] = append(v.toolDataSet.networkLcuuidToSubnets[networkLcuuid], subnet)
+	return lcuuid, &subnet
+}
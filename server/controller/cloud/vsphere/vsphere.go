@@ -0,0 +1,230 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vsphere
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/view"
+	"github.com/vmware/govmomi/vim25/types"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/config"
+	"github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
+	"github.com/deepflowio/deepflow/server/controller/statsd"
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+var log = logger.MustGetLogger("cloud.vsphere")
+
+type VSphere struct {
+	orgID          int
+	teamID         int
+	lcuuid         string
+	lcuuidGenerate string
+	name           string
+	httpTimeout    int
+	config         *Config
+	client         *govmomi.Client
+	toolDataSet    *ToolDataSet       // 处理资源数据时，构建的需要提供给其他资源使用的工具数据
+	cloudStatsd    statsd.CloudStatsd // 性能监控
+	debugger       *cloudcommon.Debugger
+}
+
+func NewVSphere(orgID int, domain metadbmodel.Domain, globalCloudCfg config.CloudConfig) (*VSphere, error) {
+	conf := &Config{}
+	err := conf.LoadFromString(orgID, domain.Config)
+	if err != nil {
+		return nil, err
+	}
+	return &VSphere{
+		orgID:  orgID,
+		teamID: domain.TeamID,
+		lcuuid: domain.Lcuuid,
+		// TODO: display_name后期需要修改为uuid_generate
+		lcuuidGenerate: domain.DisplayName,
+		name:           domain.Name,
+		httpTimeout:    globalCloudCfg.HTTPTimeout,
+		config:         conf,
+		debugger:       cloudcommon.NewDebugger(domain.Name),
+	}, nil
+}
+
+func (v *VSphere) ClearDebugLog() {
+	v.debugger.Clear()
+}
+
+func (v *VSphere) newContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), time.Duration(v.httpTimeout)*time.Second)
+}
+
+func (v *VSphere) login(ctx context.Context) error {
+	u := *v.config.URL
+	u.User = url.UserPassword(v.config.Username, v.config.Password)
+	client, err := govmomi.NewClient(ctx, &u, v.config.Insecure)
+	if err != nil {
+		log.Errorf("login vcenter (%s) failed: %s", v.config.URL.Host, err.Error(), logger.NewORGPrefix(v.orgID))
+		return err
+	}
+	v.client = client
+	return nil
+}
+
+func (v *VSphere) logout() {
+	if v.client == nil {
+		return
+	}
+	ctx, cancel := v.newContext()
+	defer cancel()
+	if err := v.client.Logout(ctx); err != nil {
+		log.Warningf("logout vcenter (%s) failed: %s", v.config.URL.Host, err.Error(), logger.NewORGPrefix(v.orgID))
+	}
+	v.client = nil
+}
+
+func (v *VSphere) CheckAuth() error {
+	ctx, cancel := v.newContext()
+	defer cancel()
+	if err := v.login(ctx); err != nil {
+		return err
+	}
+	v.logout()
+	return nil
+}
+
+func (v *VSphere) GetCloudData() (model.Resource, error) {
+	v.cloudStatsd = statsd.NewCloudStatsd()
+	v.toolDataSet = NewToolDataSet()
+	var resource model.Resource
+
+	ctx, cancel := v.newContext()
+	defer cancel()
+	if err := v.login(ctx); err != nil {
+		return resource, err
+	}
+	defer v.logout()
+
+	datacenters, err := v.getDatacenters(ctx)
+	if err != nil {
+		return resource, err
+	}
+	var regions []model.Region
+	for _, dc := range datacenters {
+		region, vpc := v.formatRegionAndVPC(dc)
+		regions = append(regions, region)
+		regionLcuuid := v.getRegionLcuuid(region.Lcuuid)
+		if v.config.RegionLcuuid != "" {
+			vpc.RegionLcuuid = regionLcuuid
+		}
+		resource.VPCs = append(resource.VPCs, vpc)
+		v.toolDataSet.regionLcuuidToResourceNum[regionLcuuid]++
+
+		azs, err := v.getAZs(ctx, dc.Self, regionLcuuid)
+		if err != nil {
+			return resource, err
+		}
+		resource.AZs = append(resource.AZs, azs...)
+
+		hosts, err := v.getHosts(ctx, dc.Self, regionLcuuid)
+		if err != nil {
+			return resource, err
+		}
+		resource.Hosts = append(resource.Hosts, hosts...)
+
+		networks, err := v.getNetworks(ctx, dc.Self, vpc.Lcuuid, regionLcuuid)
+		if err != nil {
+			return resource, err
+		}
+		resource.Networks = append(resource.Networks, networks...)
+
+		vms, vifs, ips, subnets, err := v.getVMs(ctx, dc.Self, vpc.Lcuuid, regionLcuuid)
+		if err != nil {
+			return resource, err
+		}
+		resource.VMs = append(resource.VMs, vms...)
+		resource.VInterfaces = append(resource.VInterfaces, vifs...)
+		resource.IPs = append(resource.IPs, ips...)
+		resource.Subnets = append(resource.Subnets, subnets...)
+	}
+
+	log.Debugf("region resource num info: %v", v.toolDataSet.regionLcuuidToResourceNum, logger.NewORGPrefix(v.orgID))
+	log.Debugf("az resource num info: %v", v.toolDataSet.azLcuuidToResourceNum, logger.NewORGPrefix(v.orgID))
+	resource.Regions = cloudcommon.EliminateEmptyRegions(regions, v.toolDataSet.regionLcuuidToResourceNum)
+	resource.AZs = cloudcommon.EliminateEmptyAZs(resource.AZs, v.toolDataSet.azLcuuidToResourceNum)
+
+	v.cloudStatsd.ResCount = statsd.GetResCount(resource)
+	statsd.MetaStatsd.RegisterStatsdTable(v)
+
+	v.debugger.Refresh()
+	return resource, nil
+}
+
+func (v *VSphere) GetStatter() statsd.StatsdStatter {
+	globalTags := map[string]string{
+		"domain_name": v.name,
+		"domain":      v.lcuuid,
+		"platform":    common.VSPHERE_EN,
+	}
+
+	return statsd.StatsdStatter{
+		OrgID:      v.orgID,
+		TeamID:     v.teamID,
+		GlobalTags: globalTags,
+		Element:    statsd.GetCloudStatsd(v.cloudStatsd),
+	}
+}
+
+// retrieve 通过container view获取容器下指定类型的全部对象，dst为对应mo类型的slice指针
+func (v *VSphere) retrieve(ctx context.Context, container types.ManagedObjectReference, kind string, props []string, dst interface{}) error {
+	startTime := time.Now()
+	m := view.NewManager(v.client.Client)
+	cv, err := m.CreateContainerView(ctx, container, []string{kind}, true)
+	if err != nil {
+		log.Errorf("create %s view failed: %s", kind, err.Error(), logger.NewORGPrefix(v.orgID))
+		return err
+	}
+	defer cv.Destroy(ctx)
+
+	if err := cv.Retrieve(ctx, []string{kind}, props, dst); err != nil {
+		log.Errorf("retrieve %s failed: %s", kind, err.Error(), logger.NewORGPrefix(v.orgID))
+		return err
+	}
+
+	v.cloudStatsd.RefreshAPIMoniter(kind, reflect.ValueOf(dst).Elem().Len(), startTime)
+
+	// mo对象转换为json较耗时，仅在开启debug时记录
+	if config.CONF != nil && config.CONF.DebugEnabled {
+		var jsonList []*simplejson.Json
+		if b, err := json.Marshal(dst); err == nil {
+			if j, err := simplejson.NewJson(b); err == nil {
+				for i := range j.MustArray() {
+					jsonList = append(jsonList, j.GetIndex(i))
+				}
+			}
+		}
+		v.debugger.WriteJson(kind, container.Value, jsonList)
+	}
+	return nil
+}
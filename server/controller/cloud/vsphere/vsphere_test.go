@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vsphere
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/vmware/govmomi/simulator"
+
+	cloudcommon "github.com/deepflowio/deepflow/server/controller/cloud/common"
+	"github.com/deepflowio/deepflow/server/controller/cloud/config"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	metadbcommon "github.com/deepflowio/deepflow/server/controller/db/metadb/common"
+	"github.com/deepflowio/deepflow/server/controller/statsd"
+	statsdcfg "github.com/deepflowio/deepflow/server/controller/statsd/config"
+)
+
+func TestVSphere(t *testing.T) {
+	Convey("TestVSphere", t, func() {
+		// vcsim默认模型：1个数据中心，1个集群(3台主机)和1台独立主机，每个集群/独立主机2台虚拟机
+		vpx := simulator.VPX()
+		defer vpx.Remove()
+		So(vpx.Create(), ShouldBeNil)
+		server := vpx.Service.NewServer()
+		defer server.Close()
+		statsd.NewStatsdMonitor(statsdcfg.StatsdConfig{})
+		config.CONF = &config.CloudConfig{}
+
+		password, _ := server.URL.User.Password()
+		u := *server.URL
+		u.User = nil
+		v := &VSphere{
+			orgID:          metadbcommon.DEFAULT_ORG_ID,
+			lcuuidGenerate: "test_vsphere",
+			name:           "test_vsphere",
+			httpTimeout:    30,
+			config: &Config{
+				URL:      &u,
+				Username: server.URL.User.Username(),
+				Password: password,
+				Insecure: true,
+			},
+			debugger: cloudcommon.NewDebugger("test_vsphere"),
+		}
+		So(v.CheckAuth(), ShouldBeNil)
+
+		data, err := v.GetCloudData()
+		So(err, ShouldBeNil)
+
+		Convey("vsphere resource number should be equal", func() {
+			So(len(data.Regions), ShouldEqual, 1)
+			So(len(data.VPCs), ShouldEqual, 1)
+			So(len(data.AZs), ShouldEqual, 2)
+			So(len(data.Hosts), ShouldEqual, 4)
+			So(len(data.VMs), ShouldEqual, 4)
+			So(len(data.VInterfaces), ShouldBeGreaterThan, 0)
+		})
+
+		Convey("vsphere resource relations should be correct", func() {
+			azLcuuids := map[string]bool{}
+			for _, az := range data.AZs {
+				azLcuuids[az.Lcuuid] = true
+			}
+			for _, host := range data.Hosts {
+				So(host.HType, ShouldEqual, common.HOST_HTYPE_ESXI)
+				So(azLcuuids[host.AZLcuuid], ShouldBeTrue)
+			}
+			for _, vm := range data.VMs {
+				So(vm.State, ShouldEqual, common.VM_STATE_RUNNING)
+				So(vm.LaunchServer, ShouldNotBeEmpty)
+				So(azLcuuids[vm.AZLcuuid], ShouldBeTrue)
+			}
+			networkLcuuids := map[string]bool{}
+			for _, network := range data.Networks {
+				So(strings.Contains(network.Name, DVS_UPLINK_NAME_INFIX), ShouldBeFalse)
+				networkLcuuids[network.Lcuuid] = true
+			}
+			for _, vif := range data.VInterfaces {
+				So(networkLcuuids[vif.NetworkLcuuid], ShouldBeTrue)
+			}
+		})
+	})
+}
+
+func TestParseURL(t *testing.T) {
+	Convey("TestParseURL", t, func() {
+		u, err := parseURL("vcenter.example.com")
+		So(err, ShouldBeNil)
+		So(u.String(), ShouldEqual, "https://vcenter.example.com/sdk")
+
+		u, err = parseURL("http://127.0.0.1:8989/sdk")
+		So(err, ShouldBeNil)
+		So(u.String(), ShouldEqual, "http://127.0.0.1:8989/sdk")
+	})
+}
@@ -351,6 +351,7 @@ const (
 	VOLCENGINE        = 30
 	H3C               = 31
 	FUSIONCOMPUTE     = 32
+	GCP               = 33
 
 	OPENSTACK_EN         = "openstack"
 	VSPHERE_EN           = "vsphere"
@@ -383,6 +384,7 @@ const (
 	VOLCENGINE_EN        = "volcengine"
 	H3C_EN               = "h3c"
 	FUSIONCOMPUTE_EN     = "fusioncompute"
+	GCP_EN               = "gcp"
 
 	TENCENT_CH          = "腾讯云"
 	ALIYUN_CH           = "阿里云"
@@ -405,6 +407,7 @@ const (
 	KUBERNETES_CH    = "Kubernetes"
 	CLOUD_TOWER_CH   = "CloudTower"
 	FUSIONCOMPUTE_CH = "FusionCompute"
+	GCP_CH           = "Google Cloud"
 )
 
 var DomainTypeToIconID = map[int]int{
@@ -426,6 +429,7 @@ var IconNameToDomainTypes = map[string][]int{
 	KINGSOFT_PRIVATE_CH: {KINGSOFT_PRIVATE},
 	BAIDU_BCE_CH:        {BAIDU_BCE},
 	VOLCENGINE_CH:       {VOLCENGINE},
+	GCP_CH:              {GCP},
 }
 
 const (
@@ -45,7 +45,7 @@ func GetMasterControllerHostPort() (masterIP string, httpPort, grpcPort int, err
 		httpPort = GConfig.HTTPPort
 		grpcPort = GConfig.GRPCPort
 		url := fmt.Sprintf("http://%s/v1/election-leader/", net.JoinHostPort(host, fmt.Sprintf("%d", httpPort)))
-		resp, err = CURLPerform("GET", url, nil)
+		resp, err = CURLPerform("GET", url, nil, WithInternalAuthorization())
 		if err != nil {
 			return
 		}
@@ -67,7 +67,7 @@ func GetMasterControllerHostPort() (masterIP string, httpPort, grpcPort int, err
 			}
 
 			url := fmt.Sprintf("http://%s/v1/election-leader/", net.JoinHostPort(host, fmt.Sprintf("%d", httpPort)))
-			resp, err = CURLPerform("GET", url, nil)
+			resp, err = CURLPerform("GET", url, nil, WithInternalAuthorization())
 			if err == nil {
 				respGetted = true
 				break
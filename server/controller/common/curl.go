@@ -29,6 +29,8 @@ import (
 	"time"
 
 	simplejson "github.com/bitly/go-simplejson"
+
+	"github.com/deepflowio/deepflow/server/libs/auth"
 )
 
 var (
@@ -63,6 +65,11 @@ func WithORGHeader(value string) HeaderOption {
 	}
 }
 
+// WithInternalAuthorization 开启认证时携带内部 token，仅用于调用 controller、querier 等 deepflow-server 组件
+func WithInternalAuthorization() HeaderOption {
+	return auth.SetInternalAuthorization
+}
+
 func fillHeader(req *http.Request) {
 	if req.Header.Get(HEADER_KEY_X_USER_ID) == "" {
 		req.Header.Set(HEADER_KEY_X_USER_ID, fmt.Sprintf("%d", USER_ID_SUPER_ADMIN))
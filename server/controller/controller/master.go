@@ -96,6 +96,7 @@ func checkAndStartMasterFunctions(
 
 	vtapCheck := vtap.NewVTapCheck(cfg.MonitorCfg, ctx)
 	vtapRebalanceCheck := vtap.NewRebalanceCheck(cfg.MonitorCfg, ctx)
+	agentConfigRolloutCheck := vtap.NewRolloutCheck(cfg, ctx)
 	vtapLicenseAllocation := license.NewVTapLicenseAllocation(cfg.MonitorCfg, ctx)
 	recorderResource := recorder.GetResource()
 	domainChecker := resoureservice.NewDomainCheck(ctx)
@@ -150,6 +151,9 @@ func checkAndStartMasterFunctions(
 				// rebalance vtap check
 				vtapRebalanceCheck.Start(sCtx)
 
+				// agent group config rollout check
+				agentConfigRolloutCheck.Start(sCtx)
+
 				// license分配和检查
 				if cfg.BillingMethod == common.BILLING_METHOD_LICENSE {
 					vtapLicenseAllocation.Start(sCtx)
@@ -177,6 +181,7 @@ func checkAndStartMasterFunctions(
 				// stop controller check
 				// stop analyzer check
 				// stop vtap check
+				// stop agent group config rollout check
 				// stop vtap license allocation and check
 				// stop domain checker
 				// stop prometheus related
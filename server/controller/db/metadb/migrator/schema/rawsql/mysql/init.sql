@@ -1595,6 +1595,70 @@ CREATE TABLE IF NOT EXISTS agent_group_configuration (
 ) ENGINE=innodb DEFAULT CHARSET=utf8 AUTO_INCREMENT=1;
 TRUNCATE TABLE agent_group_configuration;
 
+CREATE TABLE IF NOT EXISTS agent_group_configuration_revision (
+    id                  INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    agent_group_lcuuid  CHAR(64) NOT NULL,
+    revision            INTEGER NOT NULL,
+    yaml                TEXT,
+    operation           CHAR(16) NOT NULL DEFAULT 'update' COMMENT 'create, update, rollback',
+    source_revision     INTEGER DEFAULT 0 COMMENT 'revision rolled back to',
+    user_id             INTEGER DEFAULT 0,
+    created_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX group_revision_index(agent_group_lcuuid, revision)
+) ENGINE=innodb DEFAULT CHARSET=utf8 AUTO_INCREMENT=1;
+TRUNCATE TABLE agent_group_configuration_revision;
+
+CREATE TABLE IF NOT EXISTS agent_group_configuration_rollout (
+    id                  INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    lcuuid              CHAR(64) NOT NULL,
+    agent_group_lcuuid  CHAR(64) NOT NULL,
+    revision            INTEGER NOT NULL,
+    base_revision       INTEGER DEFAULT 0,
+    percentage          INTEGER DEFAULT 0,
+    state               CHAR(16) NOT NULL COMMENT 'running, promoted, rolled_back',
+    observe_seconds     INTEGER DEFAULT 600,
+    max_cpu_ratio       DOUBLE DEFAULT 1,
+    max_memory_ratio    DOUBLE DEFAULT 0.9,
+    message             TEXT,
+    user_id             INTEGER DEFAULT 0,
+    created_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at          TIMESTAMP NOT NULL ON UPDATE CURRENT_TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX agent_group_lcuuid_index(agent_group_lcuuid)
+) ENGINE=innodb DEFAULT CHARSET=utf8 AUTO_INCREMENT=1;
+TRUNCATE TABLE agent_group_configuration_rollout;
+
+CREATE TABLE IF NOT EXISTS agent_group_configuration_rollout_agent (
+    id                  INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    rollout_id          INTEGER NOT NULL,
+    vtap_id             INTEGER NOT NULL,
+    vtap_name           VARCHAR(256),
+    baseline_exceptions BIGINT UNSIGNED DEFAULT 0,
+    state               CHAR(16) NOT NULL COMMENT 'pending, healthy, unhealthy, unknown',
+    cpu_ratio           DOUBLE DEFAULT 0,
+    memory_ratio        DOUBLE DEFAULT 0,
+    message             TEXT,
+    updated_at          TIMESTAMP NOT NULL ON UPDATE CURRENT_TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX rollout_id_index(rollout_id)
+) ENGINE=innodb DEFAULT CHARSET=utf8 AUTO_INCREMENT=1;
+TRUNCATE TABLE agent_group_configuration_rollout_agent;
+
+CREATE TABLE IF NOT EXISTS api_token (
+    id                  INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    name                VARCHAR(256) NOT NULL,
+    token_hash          CHAR(64) NOT NULL COMMENT 'sha256 of token',
+    token_prefix        CHAR(16) NOT NULL,
+    org_id              INTEGER NOT NULL,
+    role                CHAR(16) NOT NULL COMMENT 'viewer, editor, admin, super_admin',
+    user_id             INTEGER DEFAULT 0,
+    created_by          INTEGER DEFAULT 0,
+    expired_at          DATETIME DEFAULT NULL,
+    created_at          DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    lcuuid              CHAR(64) NOT NULL,
+    UNIQUE INDEX token_hash_index(token_hash),
+    UNIQUE INDEX lcuuid_index(lcuuid)
+) ENGINE=innodb DEFAULT CHARSET=utf8 AUTO_INCREMENT=1;
+TRUNCATE TABLE api_token;
+
 CREATE TABLE IF NOT EXISTS npb_tunnel (
     id                  INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
     user_id             INTEGER DEFAULT 1,
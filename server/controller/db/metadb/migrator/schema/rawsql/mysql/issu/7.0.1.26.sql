@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS agent_group_configuration_revision (
+    id                  INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    agent_group_lcuuid  CHAR(64) NOT NULL,
+    revision            INTEGER NOT NULL,
+    yaml                TEXT,
+    operation           CHAR(16) NOT NULL DEFAULT 'update' COMMENT 'create, update, rollback',
+    source_revision     INTEGER DEFAULT 0 COMMENT 'revision rolled back to',
+    user_id             INTEGER DEFAULT 0,
+    created_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX group_revision_index(agent_group_lcuuid, revision)
+) ENGINE=innodb DEFAULT CHARSET=utf8 AUTO_INCREMENT=1;
+
+INSERT INTO agent_group_configuration_revision (agent_group_lcuuid, revision, yaml, operation, created_at)
+    SELECT agent_group_lcuuid, 1, yaml, 'create', updated_at FROM agent_group_configuration
+    WHERE agent_group_lcuuid NOT IN (SELECT agent_group_lcuuid FROM agent_group_configuration_revision);
+
+UPDATE db_version SET version='7.0.1.26';
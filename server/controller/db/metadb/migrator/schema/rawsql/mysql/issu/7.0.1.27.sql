@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS agent_group_configuration_rollout (
+    id                  INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    lcuuid              CHAR(64) NOT NULL,
+    agent_group_lcuuid  CHAR(64) NOT NULL,
+    revision            INTEGER NOT NULL,
+    base_revision       INTEGER DEFAULT 0,
+    percentage          INTEGER DEFAULT 0,
+    state               CHAR(16) NOT NULL COMMENT 'running, promoted, rolled_back',
+    observe_seconds     INTEGER DEFAULT 600,
+    max_cpu_ratio       DOUBLE DEFAULT 1,
+    max_memory_ratio    DOUBLE DEFAULT 0.9,
+    message             TEXT,
+    user_id             INTEGER DEFAULT 0,
+    created_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at          TIMESTAMP NOT NULL ON UPDATE CURRENT_TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX agent_group_lcuuid_index(agent_group_lcuuid)
+) ENGINE=innodb DEFAULT CHARSET=utf8 AUTO_INCREMENT=1;
+
+CREATE TABLE IF NOT EXISTS agent_group_configuration_rollout_agent (
+    id                  INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    rollout_id          INTEGER NOT NULL,
+    vtap_id             INTEGER NOT NULL,
+    vtap_name           VARCHAR(256),
+    baseline_exceptions BIGINT UNSIGNED DEFAULT 0,
+    state               CHAR(16) NOT NULL COMMENT 'pending, healthy, unhealthy, unknown',
+    cpu_ratio           DOUBLE DEFAULT 0,
+    memory_ratio        DOUBLE DEFAULT 0,
+    message             TEXT,
+    updated_at          TIMESTAMP NOT NULL ON UPDATE CURRENT_TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX rollout_id_index(rollout_id)
+) ENGINE=innodb DEFAULT CHARSET=utf8 AUTO_INCREMENT=1;
+
+UPDATE db_version SET version='7.0.1.27';
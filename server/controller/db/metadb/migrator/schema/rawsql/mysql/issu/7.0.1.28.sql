@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS api_token (
+    id                  INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    name                VARCHAR(256) NOT NULL,
+    token_hash          CHAR(64) NOT NULL COMMENT 'sha256 of token',
+    token_prefix        CHAR(16) NOT NULL,
+    org_id              INTEGER NOT NULL,
+    role                CHAR(16) NOT NULL COMMENT 'viewer, editor, admin, super_admin',
+    user_id             INTEGER DEFAULT 0,
+    created_by          INTEGER DEFAULT 0,
+    expired_at          DATETIME DEFAULT NULL,
+    created_at          DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    lcuuid              CHAR(64) NOT NULL,
+    UNIQUE INDEX token_hash_index(token_hash),
+    UNIQUE INDEX lcuuid_index(lcuuid)
+) ENGINE=innodb DEFAULT CHARSET=utf8 AUTO_INCREMENT=1;
+
+UPDATE db_version SET version='7.0.1.28';
@@ -1322,6 +1322,76 @@ TRUNCATE TABLE agent_group_configuration;
 COMMENT ON COLUMN agent_group_configuration.created_at IS 'Timestamp when the record was created';
 COMMENT ON COLUMN agent_group_configuration.updated_at IS 'Timestamp when the record was last updated';
 
+CREATE TABLE IF NOT EXISTS agent_group_configuration_revision (
+    id                  SERIAL PRIMARY KEY,
+    agent_group_lcuuid  VARCHAR(64) NOT NULL,
+    revision            INTEGER NOT NULL,
+    yaml                TEXT,
+    operation           VARCHAR(16) NOT NULL DEFAULT 'update',
+    source_revision     INTEGER DEFAULT 0,
+    user_id             INTEGER DEFAULT 0,
+    created_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (agent_group_lcuuid, revision)
+);
+TRUNCATE TABLE agent_group_configuration_revision;
+COMMENT ON COLUMN agent_group_configuration_revision.operation IS 'create, update, rollback';
+COMMENT ON COLUMN agent_group_configuration_revision.source_revision IS 'revision rolled back to';
+
+CREATE TABLE IF NOT EXISTS agent_group_configuration_rollout (
+    id                  SERIAL PRIMARY KEY,
+    lcuuid              VARCHAR(64) NOT NULL,
+    agent_group_lcuuid  VARCHAR(64) NOT NULL,
+    revision            INTEGER NOT NULL,
+    base_revision       INTEGER DEFAULT 0,
+    percentage          INTEGER DEFAULT 0,
+    state               VARCHAR(16) NOT NULL,
+    observe_seconds     INTEGER DEFAULT 600,
+    max_cpu_ratio       DOUBLE PRECISION DEFAULT 1,
+    max_memory_ratio    DOUBLE PRECISION DEFAULT 0.9,
+    message             TEXT,
+    user_id             INTEGER DEFAULT 0,
+    created_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX agent_group_configuration_rollout_agent_group_lcuuid_index ON agent_group_configuration_rollout (agent_group_lcuuid);
+TRUNCATE TABLE agent_group_configuration_rollout;
+COMMENT ON COLUMN agent_group_configuration_rollout.state IS 'running, promoted, rolled_back';
+
+CREATE TABLE IF NOT EXISTS agent_group_configuration_rollout_agent (
+    id                  SERIAL PRIMARY KEY,
+    rollout_id          INTEGER NOT NULL,
+    vtap_id             INTEGER NOT NULL,
+    vtap_name           VARCHAR(256),
+    baseline_exceptions BIGINT DEFAULT 0,
+    state               VARCHAR(16) NOT NULL,
+    cpu_ratio           DOUBLE PRECISION DEFAULT 0,
+    memory_ratio        DOUBLE PRECISION DEFAULT 0,
+    message             TEXT,
+    updated_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX agent_group_configuration_rollout_agent_rollout_id_index ON agent_group_configuration_rollout_agent (rollout_id);
+TRUNCATE TABLE agent_group_configuration_rollout_agent;
+COMMENT ON COLUMN agent_group_configuration_rollout_agent.state IS 'pending, healthy, unhealthy, unknown';
+
+CREATE TABLE IF NOT EXISTS api_token (
+    id                  SERIAL PRIMARY KEY,
+    name                VARCHAR(256) NOT NULL,
+    token_hash          VARCHAR(64) NOT NULL,
+    token_prefix        VARCHAR(16) NOT NULL,
+    org_id              INTEGER NOT NULL,
+    role                VARCHAR(16) NOT NULL,
+    user_id             INTEGER DEFAULT 0,
+    created_by          INTEGER DEFAULT 0,
+    expired_at          TIMESTAMP DEFAULT NULL,
+    created_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    lcuuid              VARCHAR(64) NOT NULL,
+    UNIQUE (token_hash),
+    UNIQUE (lcuuid)
+);
+TRUNCATE TABLE api_token;
+COMMENT ON COLUMN api_token.token_hash IS 'sha256 of token';
+COMMENT ON COLUMN api_token.role IS 'viewer, editor, admin, super_admin';
+
 CREATE TABLE IF NOT EXISTS controller (
     id                  SERIAL PRIMARY KEY,
     state               INTEGER,
@@ -524,6 +524,25 @@ func (MailServer) TableName() string {
 	return "mail_server"
 }
 
+// APIToken 静态 API token，仅保存 token 的 sha256，统一保存在默认组织的数据库中
+type APIToken struct {
+	ID          int        `gorm:"primaryKey;column:id;type:int;not null" json:"ID"`
+	Name        string     `gorm:"column:name;type:varchar(256);not null" json:"NAME"`
+	TokenHash   string     `gorm:"unique;column:token_hash;type:char(64);not null" json:"-"`
+	TokenPrefix string     `gorm:"column:token_prefix;type:char(16);not null" json:"TOKEN_PREFIX"`
+	ORGID       int        `gorm:"column:org_id;type:int;not null" json:"ORG_ID"`
+	Role        string     `gorm:"column:role;type:char(16);not null" json:"ROLE"` // viewer, editor, admin, super_admin
+	UserID      int        `gorm:"column:user_id;type:int;default:0" json:"USER_ID"`
+	CreatedBy   int        `gorm:"column:created_by;type:int;default:0" json:"CREATED_BY"`
+	ExpiredAt   *time.Time `gorm:"column:expired_at;type:datetime;default:null" json:"EXPIRED_AT"` // null 表示永不过期
+	CreatedAt   time.Time  `gorm:"column:created_at;type:datetime;not null;default:CURRENT_TIMESTAMP" json:"CREATED_AT"`
+	Lcuuid      string     `gorm:"unique;column:lcuuid;type:char(64)" json:"LCUUID"`
+}
+
+func (APIToken) TableName() string {
+	return "api_token"
+}
+
 type AlarmPolicy struct {
 	ID     int    `gorm:"primaryKey;column:id;type:int;not null" json:"ID"`
 	Name   string `gorm:"column:name;type:char(128)" json:"NAME"`
@@ -40,6 +40,7 @@ import (
 	"github.com/deepflowio/deepflow/server/controller/common"
 	"github.com/deepflowio/deepflow/server/controller/db/metadb"
 	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
+	"github.com/deepflowio/deepflow/server/libs/auth"
 	"github.com/deepflowio/deepflow/server/libs/logger"
 )
 
@@ -476,6 +477,7 @@ func IPInRanges(ip string, ipRanges ...netaddr.IPPrefix) bool {
 	return false
 }
 
+// RequestGet 用于调用其他 controller 的 API，开启认证时携带内部 token
 func RequestGet(url string, timeout int, queryStrings map[string]string) error {
 	client := &http.Client{
 		Transport: &http.Transport{
@@ -494,6 +496,7 @@ func RequestGet(url string, timeout int, queryStrings map[string]string) error {
 		queryData.Add(k, v)
 	}
 	request.URL.RawQuery = queryData.Encode()
+	auth.SetInternalAuthorization(request)
 
 	response, err := client.Do(request)
 	if err != nil {
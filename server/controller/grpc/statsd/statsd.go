@@ -27,8 +27,8 @@ var log = logger.MustGetLogger("trisolaris/statsd")
 
 type Counter struct {
 	ReqCount uint64 `statsd:"req_count"`
-	AvgDelay uint64 `statsd:"avg_delay"`
-	MaxDelay uint64 `statsd:"max_delay"`
+	AvgDelay uint64 `statsd:"avg_delay,gauge"`
+	MaxDelay uint64 `statsd:"max_delay,gauge"`
 	SumDelay uint64
 }
 
@@ -17,7 +17,9 @@
 package router
 
 import (
+	"fmt"
 	"io"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 
@@ -26,6 +28,7 @@ import (
 	"github.com/deepflowio/deepflow/server/controller/http/common"
 	"github.com/deepflowio/deepflow/server/controller/http/common/response"
 	"github.com/deepflowio/deepflow/server/controller/http/service"
+	"github.com/deepflowio/deepflow/server/controller/model"
 )
 
 type AgentGroupConfig struct {
@@ -54,6 +57,16 @@ func (cgc *AgentGroupConfig) RegisterTo(e *gin.Engine) {
 
 	e.DELETE("/v1/agent-group-configuration/:group-lcuuid", deleteAgentGroupConfig(cgc.cfg))
 
+	e.GET("/v1/agent-group-configuration/:group-lcuuid/revisions", getAgentGroupConfigRevisions(cgc.cfg))
+	e.GET("/v1/agent-group-configuration/:group-lcuuid/revisions/:revision/yaml", getAgentGroupConfigRevision(cgc.cfg))
+	e.GET("/v1/agent-group-configuration/:group-lcuuid/revisions/:revision/diff", diffAgentGroupConfigRevisions(cgc.cfg))
+	e.POST("/v1/agent-group-configuration/:group-lcuuid/revisions/:revision/rollback", rollbackAgentGroupConfig(cgc.cfg))
+
+	e.GET("/v1/agent-group-configuration/:group-lcuuid/rollouts", getAgentGroupConfigRollouts(cgc.cfg))
+	e.POST("/v1/agent-group-configuration/:group-lcuuid/rollouts", createAgentGroupConfigRollout(cgc.cfg))
+	e.GET("/v1/agent-group-configuration/:group-lcuuid/rollouts/:rollout-lcuuid", getAgentGroupConfigRollout(cgc.cfg))
+	e.POST("/v1/agent-group-configuration/:group-lcuuid/rollouts/:rollout-lcuuid/promote", promoteAgentGroupConfigRollout(cgc.cfg))
+	e.POST("/v1/agent-group-configuration/:group-lcuuid/rollouts/:rollout-lcuuid/rollback", rollbackAgentGroupConfigRollout(cgc.cfg))
 }
 
 func getYAMLAgentGroupConfigTmpl(c *gin.Context) {
@@ -157,3 +170,107 @@ func deleteAgentGroupConfig(cfg *config.ControllerConfig) gin.HandlerFunc {
 		response.JSON(c, response.SetError(err))
 	}
 }
+
+func getAgentGroupConfigRevisions(cfg *config.ControllerConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		groupLcuuid := c.Param("group-lcuuid")
+		data, err := service.NewAgentGroupConfig(common.GetUserInfo(c), cfg).GetAgentGroupConfigRevisions(groupLcuuid)
+		response.JSON(c, response.SetData(data), response.SetError(err))
+	}
+}
+
+func getAgentGroupConfigRevision(cfg *config.ControllerConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		revision, err := parseRevision(c.Param("revision"))
+		if err != nil {
+			response.JSON(c, response.SetOptStatus(common.INVALID_PARAMETERS), response.SetError(err))
+			return
+		}
+		groupLcuuid := c.Param("group-lcuuid")
+		data, err := service.NewAgentGroupConfig(common.GetUserInfo(c), cfg).GetAgentGroupConfigRevision(groupLcuuid, revision)
+		response.JSON(c, response.SetData(data), response.SetError(err))
+	}
+}
+
+func diffAgentGroupConfigRevisions(cfg *config.ControllerConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		revision, err := parseRevision(c.Param("revision"))
+		if err != nil {
+			response.JSON(c, response.SetOptStatus(common.INVALID_PARAMETERS), response.SetError(err))
+			return
+		}
+		var base int
+		if baseStr := c.Query("base"); baseStr != "" {
+			if base, err = parseRevision(baseStr); err != nil {
+				response.JSON(c, response.SetOptStatus(common.INVALID_PARAMETERS), response.SetError(err))
+				return
+			}
+		}
+		groupLcuuid := c.Param("group-lcuuid")
+		data, err := service.NewAgentGroupConfig(common.GetUserInfo(c), cfg).DiffAgentGroupConfigRevisions(groupLcuuid, revision, base)
+		response.JSON(c, response.SetData(data), response.SetError(err))
+	}
+}
+
+func rollbackAgentGroupConfig(cfg *config.ControllerConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		revision, err := parseRevision(c.Param("revision"))
+		if err != nil {
+			response.JSON(c, response.SetOptStatus(common.INVALID_PARAMETERS), response.SetError(err))
+			return
+		}
+		groupLcuuid := c.Param("group-lcuuid")
+		data, err := service.NewAgentGroupConfig(common.GetUserInfo(c), cfg).RollbackAgentGroupConfig(groupLcuuid, revision)
+		response.JSON(c, response.SetData(string(data)), response.SetError(err))
+	}
+}
+
+func getAgentGroupConfigRollouts(cfg *config.ControllerConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		groupLcuuid := c.Param("group-lcuuid")
+		data, err := service.NewAgentGroupConfig(common.GetUserInfo(c), cfg).GetAgentGroupConfigRollouts(groupLcuuid)
+		response.JSON(c, response.SetData(data), response.SetError(err))
+	}
+}
+
+func createAgentGroupConfigRollout(cfg *config.ControllerConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body model.AgentGroupConfigRolloutCreate
+		if err := c.ShouldBindJSON(&body); err != nil {
+			response.JSON(c, response.SetOptStatus(common.INVALID_POST_DATA), response.SetError(err))
+			return
+		}
+		groupLcuuid := c.Param("group-lcuuid")
+		data, err := service.NewAgentGroupConfig(common.GetUserInfo(c), cfg).CreateAgentGroupConfigRollout(groupLcuuid, &body)
+		response.JSON(c, response.SetData(data), response.SetError(err))
+	}
+}
+
+func getAgentGroupConfigRollout(cfg *config.ControllerConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, err := service.NewAgentGroupConfig(common.GetUserInfo(c), cfg).GetAgentGroupConfigRollout(c.Param("group-lcuuid"), c.Param("rollout-lcuuid"))
+		response.JSON(c, response.SetData(data), response.SetError(err))
+	}
+}
+
+func promoteAgentGroupConfigRollout(cfg *config.ControllerConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := service.NewAgentGroupConfig(common.GetUserInfo(c), cfg).PromoteAgentGroupConfigRollout(c.Param("group-lcuuid"), c.Param("rollout-lcuuid"), "manual promote")
+		response.JSON(c, response.SetError(err))
+	}
+}
+
+func rollbackAgentGroupConfigRollout(cfg *config.ControllerConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := service.NewAgentGroupConfig(common.GetUserInfo(c), cfg).RollbackAgentGroupConfigRollout(c.Param("group-lcuuid"), c.Param("rollout-lcuuid"), "manual rollback")
+		response.JSON(c, response.SetError(err))
+	}
+}
+
+func parseRevision(s string) (int, error) {
+	revision, err := strconv.Atoi(s)
+	if err != nil || revision <= 0 {
+		return 0, fmt.Errorf("invalid revision: %s", s)
+	}
+	return revision, nil
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	"github.com/deepflowio/deepflow/server/controller/http/common/response"
+	"github.com/deepflowio/deepflow/server/controller/http/service"
+	"github.com/deepflowio/deepflow/server/controller/model"
+	"github.com/deepflowio/deepflow/server/libs/auth"
+)
+
+type APIToken struct{}
+
+func NewAPIToken() *APIToken {
+	return new(APIToken)
+}
+
+func (t *APIToken) RegisterTo(e *gin.Engine) {
+	// querier 和 mcp 通过该接口校验静态 token
+	e.GET("/v1/auth/identity/", getIdentity)
+
+	adminRoutes := e.Group("/v1/api-tokens")
+	adminRoutes.Use(AdminPermissionVerificationMiddleware())
+	adminRoutes.GET("/", getAPITokens)
+	adminRoutes.POST("/", createAPIToken)
+	adminRoutes.DELETE("/:lcuuid/", deleteAPIToken)
+}
+
+// getCallerRole 未开启认证时根据 X-User-Type 确定调用方角色
+func getCallerRole(c *gin.Context, userInfo *httpcommon.UserInfo) auth.Role {
+	if identity := auth.GetIdentity(c); identity != nil {
+		return identity.Role
+	}
+	return auth.RoleFromUserType(userInfo.Type)
+}
+
+func getIdentity(c *gin.Context) {
+	if identity := auth.GetIdentity(c); identity != nil {
+		response.JSON(c, response.SetData(identity))
+		return
+	}
+	userInfo := httpcommon.GetUserInfo(c)
+	response.JSON(c, response.SetData(&auth.Identity{
+		ORGID:  userInfo.ORGID,
+		UserID: userInfo.ID,
+		Role:   auth.RoleFromUserType(userInfo.Type),
+	}))
+}
+
+func getAPITokens(c *gin.Context) {
+	userInfo := httpcommon.GetUserInfo(c)
+	data, err := service.NewAPIToken(userInfo, getCallerRole(c, userInfo)).GetAPITokens()
+	response.JSON(c, response.SetData(data), response.SetError(err))
+}
+
+func createAPIToken(c *gin.Context) {
+	var tokenCreate model.APITokenCreate
+	if err := c.ShouldBindBodyWith(&tokenCreate, binding.JSON); err != nil {
+		response.JSON(c, response.SetOptStatus(httpcommon.INVALID_PARAMETERS), response.SetError(err))
+		return
+	}
+	userInfo := httpcommon.GetUserInfo(c)
+	data, err := service.NewAPIToken(userInfo, getCallerRole(c, userInfo)).CreateAPIToken(tokenCreate)
+	response.JSON(c, response.SetData(data), response.SetError(err))
+}
+
+func deleteAPIToken(c *gin.Context) {
+	userInfo := httpcommon.GetUserInfo(c)
+	data, err := service.NewAPIToken(userInfo, getCallerRole(c, userInfo)).DeleteAPIToken(c.Param("lcuuid"))
+	response.JSON(c, response.SetData(data), response.SetError(err))
+}
@@ -35,14 +35,32 @@ import (
 	"github.com/deepflowio/deepflow/server/controller/http/router/agent"
 	"github.com/deepflowio/deepflow/server/controller/http/router/resource"
 	"github.com/deepflowio/deepflow/server/controller/http/router/vtap"
+	"github.com/deepflowio/deepflow/server/controller/http/service"
 	"github.com/deepflowio/deepflow/server/controller/manager"
 	"github.com/deepflowio/deepflow/server/controller/monitor"
 	trouter "github.com/deepflowio/deepflow/server/controller/trisolaris/server/http"
+	"github.com/deepflowio/deepflow/server/libs/auth"
 	"github.com/deepflowio/deepflow/server/libs/logger"
+	"github.com/deepflowio/deepflow/server/libs/stats"
 )
 
 var log = logging.MustGetLogger("http")
 
+// 开启认证时各路由分组要求的角色，未列出的路由读操作需要 viewer，写操作需要 editor
+var authRouteRules = []auth.RouteRule{
+	{PathPrefix: "/v1/controllers/", ReadRole: auth.ROLE_ADMIN, WriteRole: auth.ROLE_ADMIN},
+	{PathPrefix: "/v1/analyzers/", ReadRole: auth.ROLE_ADMIN, WriteRole: auth.ROLE_ADMIN},
+	{PathPrefix: "/v1/rebalance-vtap/", ReadRole: auth.ROLE_ADMIN, WriteRole: auth.ROLE_ADMIN},
+	{PathPrefix: "/v1/mail-server/", ReadRole: auth.ROLE_ADMIN, WriteRole: auth.ROLE_ADMIN},
+	{PathPrefix: "/v1/plugin/", ReadRole: auth.ROLE_VIEWER, WriteRole: auth.ROLE_ADMIN},
+	{PathPrefix: "/v1/vtap-repo/", ReadRole: auth.ROLE_VIEWER, WriteRole: auth.ROLE_ADMIN},
+	{PathPrefix: "/v1/api-tokens/", ReadRole: auth.ROLE_ADMIN, WriteRole: auth.ROLE_ADMIN},
+	{PathPrefix: "/v1/caches/", ReadRole: auth.ROLE_ADMIN, WriteRole: auth.ROLE_ADMIN},
+	{PathPrefix: "/v1/org/", ReadRole: auth.ROLE_ADMIN, WriteRole: auth.ROLE_SUPER_ADMIN},
+	{PathPrefix: "/v1/orgs/", ReadRole: auth.ROLE_VIEWER, WriteRole: auth.ROLE_SUPER_ADMIN},
+	{PathPrefix: "/v1/alloc-org-id/", ReadRole: auth.ROLE_SUPER_ADMIN, WriteRole: auth.ROLE_SUPER_ADMIN},
+}
+
 type Server struct {
 	engine           *gin.Engine
 	controllerConfig *config.ControllerConfig
@@ -63,6 +81,8 @@ func NewServer(logFile string, cfg *config.ControllerConfig) *Server {
 	g.Use(gin.Recovery())
 	g.Use(gin.LoggerWithFormatter(logger.GinLogFormat))
 	// set custom middleware
+	// 认证中间件会覆盖 X-Org-Id 等请求头，需在 HandleORGIDMiddleware 之前执行，健康检查和 metrics 无需认证
+	g.Use(auth.NewAuthenticator(service.APITokenStore{}, authRouteRules, "/v1/health/", stats.METRICS_PATH).GinMiddleware())
 	g.Use(HandleORGIDMiddleware())
 
 	appender.SetSwaggerConfig(cfg)
@@ -75,6 +95,7 @@ func NewServer(logFile string, cfg *config.ControllerConfig) *Server {
 
 func (s *Server) Start() {
 	router.NewHealth().RegisterTo(s.engine)
+	s.engine.GET(stats.METRICS_PATH, gin.WrapH(stats.MetricsHandler()))
 	go func() {
 		if err := s.engine.Run(fmt.Sprintf(":%d", s.controllerConfig.ListenPort)); err != nil {
 			log.Errorf("startup service failed, err:%v\n", err)
@@ -123,6 +144,7 @@ func (s *Server) appendRegistrant() []registrant.Registrant {
 		router.NewPlugin(),
 		router.NewMail(),
 		router.NewDatabase(s.controllerConfig),
+		router.NewAPIToken(),
 		router.NewAgentGroupConfig(s.controllerConfig),
 
 		// icon
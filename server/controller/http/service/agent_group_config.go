@@ -34,6 +34,7 @@ import (
 	"github.com/deepflowio/deepflow/server/controller/db/metadb"
 	"github.com/deepflowio/deepflow/server/controller/db/metadb/model"
 	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	"github.com/deepflowio/deepflow/server/controller/http/common/response"
 	"github.com/deepflowio/deepflow/server/controller/trisolaris/refresh"
 	querierConfig "github.com/deepflowio/deepflow/server/querier/config"
 )
@@ -184,6 +185,7 @@ func (a *AgentGroupConfig) getL7ProtocolsFromCK(db *metadb.DB) ([]string, error)
 		url,
 		reqBody,
 		common.WithORGHeader(strconv.Itoa(db.GetORGID())),
+		common.WithInternalAuthorization(),
 	)
 	if err != nil {
 		log.Errorf("failed to get l7 protocols from ck: %v", err, db.LogPrefixORGID)
@@ -265,11 +267,14 @@ func (a *AgentGroupConfig) GetAgentGroupConfigs(dataType int) (interface{}, erro
 func (a *AgentGroupConfig) getStringYaml(data interface{}, dataType int) (string, error) {
 	if dataType == DataTypeJSON {
 		bytes, err := agentconf.ConvertJSONToYAMLAndValidate(data.(map[string]interface{}))
-		return string(bytes), err
+		if err != nil {
+			return "", response.ServiceError(httpcommon.INVALID_POST_DATA, err.Error())
+		}
+		return string(bytes), nil
 	} else {
 		err := agentconf.ValidateYAML(data.([]byte))
 		if err != nil {
-			return "", fmt.Errorf("yaml validate failed: %v, please check the yaml format", err)
+			return "", response.ServiceError(httpcommon.INVALID_POST_DATA, fmt.Sprintf("yaml validate failed: %v, please check the yaml format", err))
 		}
 		return string(data.([]byte)), nil
 	}
@@ -290,6 +295,9 @@ func (a *AgentGroupConfig) CreateAgentGroupConfig(groupLcuuid string, data inter
 		return nil, err
 	}
 
+	if err := a.checkNoRunningRollout(dbInfo, groupLcuuid); err != nil {
+		return nil, err
+	}
 	strYaml, err := a.getStringYaml(data, dataType)
 	if err != nil {
 		log.Errorf("failed to convert data to yaml: %v", err)
@@ -298,28 +306,23 @@ func (a *AgentGroupConfig) CreateAgentGroupConfig(groupLcuuid string, data inter
 
 	var agentGroupConfig agentconf.MySQLAgentGroupConfiguration
 	if err := dbInfo.Where("agent_group_lcuuid = ?", groupLcuuid).First(&agentGroupConfig).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			newConfig := &agentconf.MySQLAgentGroupConfiguration{
-				Lcuuid:           uuid.New().String(),
-				AgentGroupLcuuid: groupLcuuid,
-				Yaml:             strYaml,
-			}
-			if err := dbInfo.Create(newConfig).Error; err != nil {
-				log.Errorf("failed to insert agent_group_configuration (agent group lcuuid %s): %v", groupLcuuid, err)
-				return nil, err
-			}
-		} else {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
 			log.Errorf("failed to get agent_group_configuration (agent group lcuuid %s): %v", groupLcuuid, err)
 			return nil, err
 		}
-	} else {
-		// TODO(weiqiang): duplicate and verify
-		agentGroupConfig.Yaml = strYaml
-		if err := dbInfo.Save(&agentGroupConfig).Error; err != nil {
-			log.Errorf("failed to update agent_group_configuration (agent group lcuuid %s): %v", groupLcuuid, err)
-			return nil, err
+		agentGroupConfig = agentconf.MySQLAgentGroupConfiguration{
+			Lcuuid:           uuid.New().String(),
+			AgentGroupLcuuid: groupLcuuid,
 		}
 	}
+	operation := agentconf.REVISION_OPERATION_UPDATE
+	if agentGroupConfig.ID == 0 {
+		operation = agentconf.REVISION_OPERATION_CREATE
+	}
+	if err := a.saveAgentGroupConfig(dbInfo, &agentGroupConfig, strYaml, operation, 0); err != nil {
+		log.Errorf("failed to save agent_group_configuration (agent group lcuuid %s): %v", groupLcuuid, err, dbInfo.LogPrefixORGID)
+		return nil, err
+	}
 
 	refresh.RefreshCache(dbInfo.GetORGID(), []common.DataChanged{common.DATA_CHANGED_VTAP})
 	return a.strToBytes(agentGroupConfig.Yaml, dataType)
@@ -341,6 +344,9 @@ func (a *AgentGroupConfig) UpdateAgentGroupConfig(groupLcuuid string, data inter
 		return nil, err
 	}
 
+	if err := a.checkNoRunningRollout(dbInfo, groupLcuuid); err != nil {
+		return nil, err
+	}
 	strYaml, err := a.getStringYaml(data, dataType)
 	if err != nil {
 		log.Errorf("failed to convert data to yaml: %v", err)
@@ -351,12 +357,10 @@ func (a *AgentGroupConfig) UpdateAgentGroupConfig(groupLcuuid string, data inter
 	if err := dbInfo.Where("agent_group_lcuuid = ?", groupLcuuid).First(&agentGroupConfig).Error; err != nil {
 		log.Errorf("failed to get agent_group_configuration (agent group lcuuid %s): %v", groupLcuuid, err)
 		return nil, err
-	} else {
-		agentGroupConfig.Yaml = strYaml
-		if err := dbInfo.Save(&agentGroupConfig).Error; err != nil {
-			log.Errorf("failed to update agent_group_configuration (agent group lcuuid %s): %v", groupLcuuid, err)
-			return nil, err
-		}
+	}
+	if err := a.saveAgentGroupConfig(dbInfo, &agentGroupConfig, strYaml, agentconf.REVISION_OPERATION_UPDATE, 0); err != nil {
+		log.Errorf("failed to update agent_group_configuration (agent group lcuuid %s): %v", groupLcuuid, err, dbInfo.LogPrefixORGID)
+		return nil, err
 	}
 
 	refresh.RefreshCache(dbInfo.GetORGID(), []common.DataChanged{common.DATA_CHANGED_VTAP})
@@ -377,6 +381,16 @@ func (a *AgentGroupConfig) DeleteAgentGroupConfig(groupLcuuid string) error {
 		if err := tx.Where("vtap_group_lcuuid = ?", groupLcuuid).Delete(&agentconf.AgentGroupConfigModel{}).Error; err != nil {
 			return fmt.Errorf("failed to delete vtap_group_configuration (agent group lcuuid %s): %v", groupLcuuid, err)
 		}
+		if err := tx.Where("agent_group_lcuuid = ?", groupLcuuid).Delete(&agentconf.MySQLAgentGroupConfigurationRevision{}).Error; err != nil {
+			return fmt.Errorf("failed to delete agent_group_configuration_revision (agent group lcuuid %s): %v", groupLcuuid, err)
+		}
+		rolloutIDs := tx.Model(&agentconf.MySQLAgentGroupConfigurationRollout{}).Select("id").Where("agent_group_lcuuid = ?", groupLcuuid)
+		if err := tx.Where("rollout_id IN (?)", rolloutIDs).Delete(&agentconf.MySQLAgentGroupConfigurationRolloutAgent{}).Error; err != nil {
+			return fmt.Errorf("failed to delete agent_group_configuration_rollout_agent (agent group lcuuid %s): %v", groupLcuuid, err)
+		}
+		if err := tx.Where("agent_group_lcuuid = ?", groupLcuuid).Delete(&agentconf.MySQLAgentGroupConfigurationRollout{}).Error; err != nil {
+			return fmt.Errorf("failed to delete agent_group_configuration_rollout (agent group lcuuid %s): %v", groupLcuuid, err)
+		}
 		return nil
 	})
 	if err != nil {
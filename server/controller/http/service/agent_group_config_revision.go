@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"gorm.io/gorm"
+
+	agentconf "github.com/deepflowio/deepflow/server/agent_config"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/db/metadb"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	"github.com/deepflowio/deepflow/server/controller/http/common/response"
+	"github.com/deepflowio/deepflow/server/controller/trisolaris/refresh"
+)
+
+// saveAgentGroupConfig 在同一事务中保存配置并记录新版本，配置内容未变化时不做任何修改
+func (a *AgentGroupConfig) saveAgentGroupConfig(db *metadb.DB, config *agentconf.MySQLAgentGroupConfiguration, strYaml, operation string, sourceRevision int) error {
+	if config.ID != 0 && config.Yaml == strYaml {
+		log.Infof("agent group (lcuuid %s) config not changed, skip saving", config.AgentGroupLcuuid, db.LogPrefixORGID)
+		return nil
+	}
+	return db.GetGORMDB().Transaction(func(tx *gorm.DB) error {
+		return a.saveAgentGroupConfigTx(tx, config, strYaml, operation, sourceRevision)
+	})
+}
+
+// saveAgentGroupConfigTx 保存配置并记录新版本，需在事务中调用
+func (a *AgentGroupConfig) saveAgentGroupConfigTx(tx *gorm.DB, config *agentconf.MySQLAgentGroupConfiguration, strYaml, operation string, sourceRevision int) error {
+	config.Yaml = strYaml
+	if err := tx.Save(config).Error; err != nil {
+		return err
+	}
+	_, err := a.addRevision(tx, config.AgentGroupLcuuid, strYaml, operation, sourceRevision)
+	return err
+}
+
+// addRevision 记录一个新版本并返回版本号，需在事务中调用
+func (a *AgentGroupConfig) addRevision(tx *gorm.DB, groupLcuuid, strYaml, operation string, sourceRevision int) (int, error) {
+	var latest int
+	if err := tx.Model(&agentconf.MySQLAgentGroupConfigurationRevision{}).Where("agent_group_lcuuid = ?", groupLcuuid).
+		Select("COALESCE(MAX(revision), 0)").Scan(&latest).Error; err != nil {
+		return 0, err
+	}
+	revision := &agentconf.MySQLAgentGroupConfigurationRevision{
+		AgentGroupLcuuid: groupLcuuid,
+		Revision:         latest + 1,
+		Yaml:             strYaml,
+		Operation:        operation,
+		SourceRevision:   sourceRevision,
+		UserID:           a.resourceAccess.UserInfo.ID,
+	}
+	if err := tx.Create(revision).Error; err != nil {
+		return 0, err
+	}
+	return revision.Revision, nil
+}
+
+// GetAgentGroupConfigRevisions 按版本倒序返回采集器组配置的历史版本，不包含配置内容
+func (a *AgentGroupConfig) GetAgentGroupConfigRevisions(groupLcuuid string) ([]agentconf.MySQLAgentGroupConfigurationRevision, error) {
+	dbInfo, err := metadb.GetDB(a.resourceAccess.UserInfo.ORGID)
+	if err != nil {
+		return nil, err
+	}
+	var revisions []agentconf.MySQLAgentGroupConfigurationRevision
+	if err := dbInfo.Where("agent_group_lcuuid = ?", groupLcuuid).Omit("yaml").Order("revision DESC").Find(&revisions).Error; err != nil {
+		log.Errorf("failed to get agent_group_configuration_revision (agent group lcuuid %s): %v", groupLcuuid, err, dbInfo.LogPrefixORGID)
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func (a *AgentGroupConfig) GetAgentGroupConfigRevision(groupLcuuid string, revision int) (*agentconf.MySQLAgentGroupConfigurationRevision, error) {
+	dbInfo, err := metadb.GetDB(a.resourceAccess.UserInfo.ORGID)
+	if err != nil {
+		return nil, err
+	}
+	return a.getRevision(dbInfo, groupLcuuid, revision)
+}
+
+func (a *AgentGroupConfig) getRevision(db *metadb.DB, groupLcuuid string, revision int) (*agentconf.MySQLAgentGroupConfigurationRevision, error) {
+	var data agentconf.MySQLAgentGroupConfigurationRevision
+	if err := db.Where("agent_group_lcuuid = ? AND revision = ?", groupLcuuid, revision).First(&data).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, response.ServiceError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("agent group (lcuuid %s) config revision %d not found", groupLcuuid, revision))
+		}
+		return nil, err
+	}
+	return &data, nil
+}
+
+// DiffAgentGroupConfigRevisions 返回 baseRevision 到 revision 的 unified diff，baseRevision 为 0 时与上一个版本比较
+func (a *AgentGroupConfig) DiffAgentGroupConfigRevisions(groupLcuuid string, revision, baseRevision int) (string, error) {
+	dbInfo, err := metadb.GetDB(a.resourceAccess.UserInfo.ORGID)
+	if err != nil {
+		return "", err
+	}
+	target, err := a.getRevision(dbInfo, groupLcuuid, revision)
+	if err != nil {
+		return "", err
+	}
+	if baseRevision == 0 {
+		baseRevision = revision - 1
+	}
+	var baseYaml string
+	if baseRevision > 0 {
+		base, err := a.getRevision(dbInfo, groupLcuuid, baseRevision)
+		if err != nil {
+			return "", err
+		}
+		baseYaml = base.Yaml
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(baseYaml),
+		B:        difflib.SplitLines(target.Yaml),
+		FromFile: fmt.Sprintf("revision %d", baseRevision),
+		ToFile:   fmt.Sprintf("revision %d", revision),
+		Context:  3,
+	})
+}
+
+// RollbackAgentGroupConfig 将配置回滚为指定版本的内容，回滚本身也会记录为一个新版本
+func (a *AgentGroupConfig) RollbackAgentGroupConfig(groupLcuuid string, revision int) ([]byte, error) {
+	dbInfo, err := metadb.GetDB(a.resourceAccess.UserInfo.ORGID)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("rollback agent group config, group lcuuid: %s, revision: %d", groupLcuuid, revision, dbInfo.LogPrefixORGID)
+	if err := a.checkNoRunningRollout(dbInfo, groupLcuuid); err != nil {
+		return nil, err
+	}
+	target, err := a.getRevision(dbInfo, groupLcuuid, revision)
+	if err != nil {
+		return nil, err
+	}
+	// 模板可能在该版本保存后发生变化，回滚前重新校验
+	if err := agentconf.ValidateYAML([]byte(target.Yaml)); err != nil {
+		return nil, response.ServiceError(httpcommon.INVALID_POST_DATA, fmt.Sprintf("revision %d is no longer valid: %v", revision, err))
+	}
+	var agentGroupConfig agentconf.MySQLAgentGroupConfiguration
+	if err := dbInfo.Where("agent_group_lcuuid = ?", groupLcuuid).First(&agentGroupConfig).Error; err != nil {
+		log.Errorf("failed to get agent_group_configuration (agent group lcuuid %s): %v", groupLcuuid, err, dbInfo.LogPrefixORGID)
+		return nil, err
+	}
+	if err := a.saveAgentGroupConfig(dbInfo, &agentGroupConfig, target.Yaml, agentconf.REVISION_OPERATION_ROLLBACK, revision); err != nil {
+		log.Errorf("failed to rollback agent_group_configuration (agent group lcuuid %s): %v", groupLcuuid, err, dbInfo.LogPrefixORGID)
+		return nil, err
+	}
+
+	refresh.RefreshCache(dbInfo.GetORGID(), []common.DataChanged{common.DATA_CHANGED_VTAP})
+	return []byte(agentGroupConfig.Yaml), nil
+}
@@ -0,0 +1,282 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	agentconf "github.com/deepflowio/deepflow/server/agent_config"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/db/metadb"
+	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	"github.com/deepflowio/deepflow/server/controller/http/common/response"
+	"github.com/deepflowio/deepflow/server/controller/model"
+	"github.com/deepflowio/deepflow/server/controller/trisolaris/refresh"
+)
+
+const (
+	DEFAULT_ROLLOUT_OBSERVE_SECONDS  = 600
+	DEFAULT_ROLLOUT_MAX_CPU_RATIO    = 1.0
+	DEFAULT_ROLLOUT_MAX_MEMORY_RATIO = 0.9
+)
+
+// checkNoRunningRollout 灰度发布期间不允许直接修改采集器组配置
+func (a *AgentGroupConfig) checkNoRunningRollout(db *metadb.DB, groupLcuuid string) error {
+	var count int64
+	if err := db.Model(&agentconf.MySQLAgentGroupConfigurationRollout{}).
+		Where("agent_group_lcuuid = ? AND state = ?", groupLcuuid, agentconf.ROLLOUT_STATE_RUNNING).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return response.ServiceError(httpcommon.INVALID_POST_DATA, fmt.Sprintf("agent group (lcuuid %s) has a running config rollout, promote or roll it back first", groupLcuuid))
+	}
+	return nil
+}
+
+// CreateAgentGroupConfigRollout 保存新配置为 canary 版本并仅下发给选中的灰度采集器，采集器组配置保持不变
+func (a *AgentGroupConfig) CreateAgentGroupConfigRollout(groupLcuuid string, create *model.AgentGroupConfigRolloutCreate) (*model.AgentGroupConfigRollout, error) {
+	dbInfo, err := metadb.GetDB(a.resourceAccess.UserInfo.ORGID)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("create agent group config rollout, group lcuuid: %s, percentage: %d, agents: %v", groupLcuuid, create.Percentage, create.AgentNames, dbInfo.LogPrefixORGID)
+	if create.Percentage == 0 && len(create.AgentNames) == 0 {
+		return nil, response.ServiceError(httpcommon.INVALID_POST_DATA, "PERCENTAGE or AGENT_NAMES must be specified")
+	}
+	if err := a.checkNoRunningRollout(dbInfo, groupLcuuid); err != nil {
+		return nil, err
+	}
+	strYaml, err := a.getStringYaml([]byte(create.YAML), DataTypeYAML)
+	if err != nil {
+		return nil, err
+	}
+	var agentGroupConfig agentconf.MySQLAgentGroupConfiguration
+	if err := dbInfo.Where("agent_group_lcuuid = ?", groupLcuuid).First(&agentGroupConfig).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, response.ServiceError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("agent group (lcuuid %s) config not found, create it before rollout", groupLcuuid))
+		}
+		return nil, err
+	}
+	if agentGroupConfig.Yaml == strYaml {
+		return nil, response.ServiceError(httpcommon.INVALID_POST_DATA, "config not changed, no need to rollout")
+	}
+	vtaps, err := a.selectRolloutVTaps(dbInfo, groupLcuuid, create)
+	if err != nil {
+		return nil, err
+	}
+
+	rollout := &agentconf.MySQLAgentGroupConfigurationRollout{
+		Lcuuid:           uuid.New().String(),
+		AgentGroupLcuuid: groupLcuuid,
+		Percentage:       create.Percentage,
+		State:            agentconf.ROLLOUT_STATE_RUNNING,
+		ObserveSeconds:   create.ObserveSeconds,
+		MaxCPURatio:      create.MaxCPURatio,
+		MaxMemoryRatio:   create.MaxMemoryRatio,
+		UserID:           a.resourceAccess.UserInfo.ID,
+	}
+	if rollout.ObserveSeconds == 0 {
+		rollout.ObserveSeconds = DEFAULT_ROLLOUT_OBSERVE_SECONDS
+	}
+	if rollout.MaxCPURatio == 0 {
+		rollout.MaxCPURatio = DEFAULT_ROLLOUT_MAX_CPU_RATIO
+	}
+	if rollout.MaxMemoryRatio == 0 {
+		rollout.MaxMemoryRatio = DEFAULT_ROLLOUT_MAX_MEMORY_RATIO
+	}
+	agents := make([]agentconf.MySQLAgentGroupConfigurationRolloutAgent, len(vtaps))
+	err = dbInfo.GetGORMDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&agentconf.MySQLAgentGroupConfigurationRevision{}).Where("agent_group_lcuuid = ?", groupLcuuid).
+			Select("COALESCE(MAX(revision), 0)").Scan(&rollout.BaseRevision).Error; err != nil {
+			return err
+		}
+		if rollout.Revision, err = a.addRevision(tx, groupLcuuid, strYaml, agentconf.REVISION_OPERATION_CANARY, 0); err != nil {
+			return err
+		}
+		if err := tx.Create(rollout).Error; err != nil {
+			return err
+		}
+		for i, vtap := range vtaps {
+			agents[i] = agentconf.MySQLAgentGroupConfigurationRolloutAgent{
+				RolloutID:          rollout.ID,
+				VTapID:             vtap.ID,
+				VTapName:           vtap.Name,
+				BaselineExceptions: vtap.Exceptions,
+				State:              agentconf.ROLLOUT_AGENT_STATE_PENDING,
+			}
+		}
+		return tx.Create(&agents).Error
+	})
+	if err != nil {
+		log.Errorf("failed to create agent group config rollout (agent group lcuuid %s): %v", groupLcuuid, err, dbInfo.LogPrefixORGID)
+		return nil, err
+	}
+
+	refresh.RefreshCache(dbInfo.GetORGID(), []common.DataChanged{common.DATA_CHANGED_VTAP})
+	return &model.AgentGroupConfigRollout{MySQLAgentGroupConfigurationRollout: *rollout, Agents: agents}, nil
+}
+
+// selectRolloutVTaps 显式指定采集器时校验其属于该采集器组，否则按 ID 排序后取前 PERCENTAGE% 个（至少一个）
+func (a *AgentGroupConfig) selectRolloutVTaps(db *metadb.DB, groupLcuuid string, create *model.AgentGroupConfigRolloutCreate) ([]metadbmodel.VTap, error) {
+	var vtaps []metadbmodel.VTap
+	if err := db.Where("vtap_group_lcuuid = ?", groupLcuuid).Order("id").Find(&vtaps).Error; err != nil {
+		return nil, err
+	}
+	if len(vtaps) == 0 {
+		return nil, response.ServiceError(httpcommon.INVALID_POST_DATA, fmt.Sprintf("agent group (lcuuid %s) has no agent", groupLcuuid))
+	}
+	if len(create.AgentNames) == 0 {
+		count := int(math.Ceil(float64(len(vtaps)) * float64(create.Percentage) / 100))
+		return vtaps[:count], nil
+	}
+
+	nameToVTap := make(map[string]metadbmodel.VTap, len(vtaps))
+	for _, vtap := range vtaps {
+		nameToVTap[vtap.Name] = vtap
+	}
+	selected := make([]metadbmodel.VTap, 0, len(create.AgentNames))
+	for _, name := range create.AgentNames {
+		vtap, ok := nameToVTap[name]
+		if !ok {
+			return nil, response.ServiceError(httpcommon.INVALID_POST_DATA, fmt.Sprintf("agent (%s) not in agent group (lcuuid %s)", name, groupLcuuid))
+		}
+		selected = append(selected, vtap)
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].ID < selected[j].ID })
+	return selected, nil
+}
+
+func (a *AgentGroupConfig) GetAgentGroupConfigRollouts(groupLcuuid string) ([]agentconf.MySQLAgentGroupConfigurationRollout, error) {
+	dbInfo, err := metadb.GetDB(a.resourceAccess.UserInfo.ORGID)
+	if err != nil {
+		return nil, err
+	}
+	var rollouts []agentconf.MySQLAgentGroupConfigurationRollout
+	if err := dbInfo.Where("agent_group_lcuuid = ?", groupLcuuid).Order("id DESC").Find(&rollouts).Error; err != nil {
+		return nil, err
+	}
+	return rollouts, nil
+}
+
+// GetAgentGroupConfigRollout 返回灰度发布及每个灰度采集器的状态
+func (a *AgentGroupConfig) GetAgentGroupConfigRollout(groupLcuuid, rolloutLcuuid string) (*model.AgentGroupConfigRollout, error) {
+	dbInfo, err := metadb.GetDB(a.resourceAccess.UserInfo.ORGID)
+	if err != nil {
+		return nil, err
+	}
+	rollout, err := a.getRollout(dbInfo, groupLcuuid, rolloutLcuuid)
+	if err != nil {
+		return nil, err
+	}
+	var agents []agentconf.MySQLAgentGroupConfigurationRolloutAgent
+	if err := dbInfo.Where("rollout_id = ?", rollout.ID).Order("vtap_id").Find(&agents).Error; err != nil {
+		return nil, err
+	}
+	return &model.AgentGroupConfigRollout{MySQLAgentGroupConfigurationRollout: *rollout, Agents: agents}, nil
+}
+
+func (a *AgentGroupConfig) getRollout(db *metadb.DB, groupLcuuid, rolloutLcuuid string) (*agentconf.MySQLAgentGroupConfigurationRollout, error) {
+	var rollout agentconf.MySQLAgentGroupConfigurationRollout
+	if err := db.Where("agent_group_lcuuid = ? AND lcuuid = ?", groupLcuuid, rolloutLcuuid).First(&rollout).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, response.ServiceError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("agent group (lcuuid %s) config rollout (%s) not found", groupLcuuid, rolloutLcuuid))
+		}
+		return nil, err
+	}
+	return &rollout, nil
+}
+
+// PromoteAgentGroupConfigRollout 将灰度版本应用到采集器组，下发给组内全部采集器
+func (a *AgentGroupConfig) PromoteAgentGroupConfigRollout(groupLcuuid, rolloutLcuuid, message string) error {
+	dbInfo, err := metadb.GetDB(a.resourceAccess.UserInfo.ORGID)
+	if err != nil {
+		return err
+	}
+	log.Infof("promote agent group config rollout (%s), group lcuuid: %s, message: %s", rolloutLcuuid, groupLcuuid, message, dbInfo.LogPrefixORGID)
+	rollout, err := a.getRunningRollout(dbInfo, groupLcuuid, rolloutLcuuid)
+	if err != nil {
+		return err
+	}
+	target, err := a.getRevision(dbInfo, groupLcuuid, rollout.Revision)
+	if err != nil {
+		return err
+	}
+	var agentGroupConfig agentconf.MySQLAgentGroupConfiguration
+	if err := dbInfo.Where("agent_group_lcuuid = ?", groupLcuuid).First(&agentGroupConfig).Error; err != nil {
+		return err
+	}
+	// 配置推广与灰度状态在同一事务中更新，避免配置已推广而灰度仍为 RUNNING，阻塞之后的配置修改
+	err = dbInfo.GetGORMDB().Transaction(func(tx *gorm.DB) error {
+		if agentGroupConfig.Yaml != target.Yaml {
+			if err := a.saveAgentGroupConfigTx(tx, &agentGroupConfig, target.Yaml, agentconf.REVISION_OPERATION_PROMOTE, rollout.Revision); err != nil {
+				return err
+			}
+		}
+		return updateRolloutState(tx, rollout, agentconf.ROLLOUT_STATE_PROMOTED, message)
+	})
+	if err != nil {
+		log.Errorf("failed to promote agent group config rollout (%s): %v", rolloutLcuuid, err, dbInfo.LogPrefixORGID)
+		return err
+	}
+	refresh.RefreshCache(dbInfo.GetORGID(), []common.DataChanged{common.DATA_CHANGED_VTAP})
+	return nil
+}
+
+// RollbackAgentGroupConfigRollout 结束灰度发布，灰度采集器恢复使用采集器组配置
+func (a *AgentGroupConfig) RollbackAgentGroupConfigRollout(groupLcuuid, rolloutLcuuid, message string) error {
+	dbInfo, err := metadb.GetDB(a.resourceAccess.UserInfo.ORGID)
+	if err != nil {
+		return err
+	}
+	log.Infof("rollback agent group config rollout (%s), group lcuuid: %s, message: %s", rolloutLcuuid, groupLcuuid, message, dbInfo.LogPrefixORGID)
+	rollout, err := a.getRunningRollout(dbInfo, groupLcuuid, rolloutLcuuid)
+	if err != nil {
+		return err
+	}
+	return a.finishRollout(dbInfo, rollout, agentconf.ROLLOUT_STATE_ROLLED_BACK, message)
+}
+
+func (a *AgentGroupConfig) getRunningRollout(db *metadb.DB, groupLcuuid, rolloutLcuuid string) (*agentconf.MySQLAgentGroupConfigurationRollout, error) {
+	rollout, err := a.getRollout(db, groupLcuuid, rolloutLcuuid)
+	if err != nil {
+		return nil, err
+	}
+	if rollout.State != agentconf.ROLLOUT_STATE_RUNNING {
+		return nil, response.ServiceError(httpcommon.INVALID_POST_DATA, fmt.Sprintf("config rollout (%s) is already %s", rolloutLcuuid, rollout.State))
+	}
+	return rollout, nil
+}
+
+func updateRolloutState(tx *gorm.DB, rollout *agentconf.MySQLAgentGroupConfigurationRollout, state, message string) error {
+	return tx.Model(rollout).Updates(map[string]interface{}{"state": state, "message": message}).Error
+}
+
+func (a *AgentGroupConfig) finishRollout(db *metadb.DB, rollout *agentconf.MySQLAgentGroupConfigurationRollout, state, message string) error {
+	if err := updateRolloutState(db.GetGORMDB(), rollout, state, message); err != nil {
+		log.Errorf("failed to update agent group config rollout (%s) state: %v", rollout.Lcuuid, err, db.LogPrefixORGID)
+		return err
+	}
+	refresh.RefreshCache(db.GetORGID(), []common.DataChanged{common.DATA_CHANGED_VTAP})
+	return nil
+}
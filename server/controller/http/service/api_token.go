@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/deepflowio/deepflow/server/controller/db/metadb"
+	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	"github.com/deepflowio/deepflow/server/controller/http/common/response"
+	"github.com/deepflowio/deepflow/server/controller/model"
+	"github.com/deepflowio/deepflow/server/libs/auth"
+)
+
+// APIToken 静态 API token 的管理，调用方只能管理本组织的 token，且不能创建高于自身角色的 token
+type APIToken struct {
+	userInfo *httpcommon.UserInfo
+	role     auth.Role
+}
+
+func NewAPIToken(userInfo *httpcommon.UserInfo, role auth.Role) *APIToken {
+	return &APIToken{userInfo: userInfo, role: role}
+}
+
+func (a *APIToken) GetAPITokens() ([]metadbmodel.APIToken, error) {
+	var tokens []metadbmodel.APIToken
+	if err := metadb.DefaultDB.Where("org_id = ?", a.userInfo.ORGID).Order("id").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (a *APIToken) CreateAPIToken(create model.APITokenCreate) (*model.APITokenCreated, error) {
+	role := auth.Role(create.Role)
+	if !a.role.Covers(role) {
+		return nil, response.ServiceError(httpcommon.NO_PERMISSIONS, fmt.Sprintf("role %s can not create token with role %s", a.role, role))
+	}
+	orgID := a.userInfo.ORGID
+	if create.ORGID != 0 && create.ORGID != orgID {
+		if a.role != auth.ROLE_SUPER_ADMIN {
+			return nil, response.ServiceError(httpcommon.NO_PERMISSIONS, "only super admin can create token for other organizations")
+		}
+		orgID = create.ORGID
+	}
+	// token 的 USER_ID 会作为 X-User-Id 传递给下游，为其他用户创建 token 会获得该用户的权限
+	userID := a.userInfo.ID
+	if create.UserID != 0 && create.UserID != userID {
+		if a.role != auth.ROLE_SUPER_ADMIN {
+			return nil, response.ServiceError(httpcommon.NO_PERMISSIONS, "only super admin can create token for other users")
+		}
+		userID = create.UserID
+	}
+
+	token, err := auth.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	dbToken := &metadbmodel.APIToken{
+		Name:        create.Name,
+		TokenHash:   auth.HashToken(token),
+		TokenPrefix: auth.DisplayToken(token),
+		ORGID:       orgID,
+		Role:        create.Role,
+		UserID:      userID,
+		CreatedBy:   a.userInfo.ID,
+		Lcuuid:      uuid.New().String(),
+	}
+	if create.ExpireSeconds > 0 {
+		expiredAt := time.Now().Add(time.Duration(create.ExpireSeconds) * time.Second)
+		dbToken.ExpiredAt = &expiredAt
+	}
+	if err := metadb.DefaultDB.Create(dbToken).Error; err != nil {
+		return nil, err
+	}
+	log.Infof("api token %s (%s) created for org %d with role %s by user %d", dbToken.Name, dbToken.TokenPrefix, orgID, role, a.userInfo.ID)
+	return &model.APITokenCreated{
+		ID:          dbToken.ID,
+		Name:        dbToken.Name,
+		Token:       token,
+		TokenPrefix: dbToken.TokenPrefix,
+		ORGID:       dbToken.ORGID,
+		Role:        dbToken.Role,
+		UserID:      dbToken.UserID,
+		ExpiredAt:   dbToken.ExpiredAt,
+		Lcuuid:      dbToken.Lcuuid,
+	}, nil
+}
+
+func (a *APIToken) DeleteAPIToken(lcuuid string) (*metadbmodel.APIToken, error) {
+	var token metadbmodel.APIToken
+	if err := metadb.DefaultDB.Where("lcuuid = ? AND org_id = ?", lcuuid, a.userInfo.ORGID).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, response.ServiceError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("api token (lcuuid %s) not found", lcuuid))
+		}
+		return nil, err
+	}
+	if !a.role.Covers(auth.Role(token.Role)) {
+		return nil, response.ServiceError(httpcommon.NO_PERMISSIONS, fmt.Sprintf("role %s can not delete token with role %s", a.role, token.Role))
+	}
+	if err := metadb.DefaultDB.Delete(&token).Error; err != nil {
+		return nil, err
+	}
+	log.Infof("api token %s (%s) deleted by user %d", token.Name, token.TokenPrefix, a.userInfo.ID)
+	return &token, nil
+}
+
+// APITokenStore 从 metadb 校验静态 token，实现 auth.TokenStore
+type APITokenStore struct{}
+
+func (APITokenStore) LookupToken(token string) (*auth.Identity, error) {
+	var dbToken metadbmodel.APIToken
+	if err := metadb.DefaultDB.Where("token_hash = ?", auth.HashToken(token)).First(&dbToken).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, auth.ErrInvalidToken
+		}
+		return nil, err
+	}
+	if dbToken.ExpiredAt != nil && time.Now().After(*dbToken.ExpiredAt) {
+		return nil, auth.ErrInvalidToken
+	}
+	return &auth.Identity{
+		ORGID:   dbToken.ORGID,
+		UserID:  dbToken.UserID,
+		Role:    auth.Role(dbToken.Role),
+		Subject: dbToken.Name,
+		Method:  auth.AUTH_METHOD_TOKEN,
+	}, nil
+}
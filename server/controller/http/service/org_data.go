@@ -135,7 +135,7 @@ func GetORGData(cfg *config.ControllerConfig) (*simplejson.Json, error) {
 			log.Error(err)
 			return errResponse, err
 		}
-		orgResponse, err := controllerCommon.CURLPerform("GET", fmt.Sprintf("http://%s:%d/v1/orgs/", controller.IP, cfg.ListenNodePort), body)
+		orgResponse, err := controllerCommon.CURLPerform("GET", fmt.Sprintf("http://%s:%d/v1/orgs/", controller.IP, cfg.ListenNodePort), body, controllerCommon.WithInternalAuthorization())
 		if err != nil {
 			log.Error(err)
 			return errResponse, err
@@ -276,6 +276,7 @@ func (c *DeletedORGChecker) triggerAllServersToDelete(ids []int) error {
 			"DELETE",
 			fmt.Sprintf("http://%s/v1/org/?%s", net.JoinHostPort(ip, fmt.Sprintf("%d", port)), query),
 			nil,
+			controllerCommon.WithInternalAuthorization(),
 		)
 		if err != nil {
 			log.Errorf("failed to call controller %s: %s", controller.Name, err.Error())
@@ -36,6 +36,7 @@ import (
 	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
 	"github.com/deepflowio/deepflow/server/controller/grpc/statsd"
 	"github.com/deepflowio/deepflow/server/controller/model"
+	"github.com/deepflowio/deepflow/server/libs/auth"
 	"github.com/deepflowio/deepflow/server/libs/logger"
 	"github.com/deepflowio/deepflow/server/querier/config"
 )
@@ -658,6 +659,7 @@ func (q *Query) GetAgentDispatcher(orgDB *metadb.DB, domainPrefix string, dataDu
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set(common.HEADER_KEY_X_ORG_ID, strconv.Itoa(orgDB.ORGID))
+	auth.SetInternalAuthorization(req)
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
@@ -170,6 +170,7 @@ func (v *VTapInterface) getRawVTapVinterfacesByRegion(host string, port int, que
 		common.WithHeader(common.HEADER_KEY_X_USER_TYPE, fmt.Sprintf("%d", v.userInfo.Type)),
 		common.WithHeader(common.HEADER_KEY_X_USER_ID, fmt.Sprintf("%d", v.userInfo.ID)),
 		common.WithHeader(common.HEADER_KEY_X_ORG_ID, fmt.Sprintf("%d", v.userInfo.ORGID)),
+		common.WithInternalAuthorization(),
 	)
 	if err != nil {
 		log.Errorf("get genesis vinterface failed: %s, %s", err.Error(), url, v.db.LogPrefixORGID)
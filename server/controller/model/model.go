@@ -257,6 +257,21 @@ type VtapGroupUpdate struct {
 	VtapLcuuids []string `json:"VTAP_LCUUIDS"`
 }
 
+// 灰度采集器由 PERCENTAGE 按比例选取，或由 AGENT_NAMES 显式指定
+type AgentGroupConfigRolloutCreate struct {
+	YAML           string   `json:"YAML" binding:"required"`
+	Percentage     int      `json:"PERCENTAGE" binding:"min=0,max=100"`
+	AgentNames     []string `json:"AGENT_NAMES"`
+	ObserveSeconds int      `json:"OBSERVE_SECONDS" binding:"min=0"`
+	MaxCPURatio    float64  `json:"MAX_CPU_RATIO" binding:"min=0"`
+	MaxMemoryRatio float64  `json:"MAX_MEMORY_RATIO" binding:"min=0"`
+}
+
+type AgentGroupConfigRollout struct {
+	agent_config.MySQLAgentGroupConfigurationRollout
+	Agents []agent_config.MySQLAgentGroupConfigurationRolloutAgent `json:"AGENTS"`
+}
+
 type DataSource struct {
 	ID                        int    `json:"ID"`
 	Name                      string `json:"NAME"`
@@ -758,6 +773,27 @@ type MailServerUpdate struct {
 	Security     string `json:"SECURITY"`
 }
 
+type APITokenCreate struct {
+	Name          string `json:"NAME" binding:"required"`
+	Role          string `json:"ROLE" binding:"required,oneof=viewer editor admin super_admin"`
+	ORGID         int    `json:"ORG_ID"`                         // 仅 super_admin 可以为其他组织创建 token，默认为当前组织
+	UserID        int    `json:"USER_ID"`                        // 仅 super_admin 可以为其他用户创建 token，默认为当前用户
+	ExpireSeconds int    `json:"EXPIRE_SECONDS" binding:"min=0"` // 0 表示永不过期
+}
+
+// APITokenCreated 创建成功时返回 token 明文，之后无法再次获取
+type APITokenCreated struct {
+	ID          int        `json:"ID"`
+	Name        string     `json:"NAME"`
+	Token       string     `json:"TOKEN"`
+	TokenPrefix string     `json:"TOKEN_PREFIX"`
+	ORGID       int        `json:"ORG_ID"`
+	Role        string     `json:"ROLE"`
+	UserID      int        `json:"USER_ID"`
+	ExpiredAt   *time.Time `json:"EXPIRED_AT"`
+	Lcuuid      string     `json:"LCUUID"`
+}
+
 type MailServer struct {
 	ID           int    `json:"ID"`
 	Status       int    `json:"STATUS"`
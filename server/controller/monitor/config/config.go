@@ -28,7 +28,8 @@ type MonitorConfig struct {
 	VTapCheckInterval           int                           `default:"60" yaml:"vtap_check_interval"`
 	ExceptionTimeFrame          int                           `default:"3600" yaml:"exception_time_frame"`
 	AutoRebalanceVTap           bool                          `default:"true" yaml:"auto_rebalance_vtap"`
-	RebalanceCheckInterval      int                           `default:"300" yaml:"rebalance_check_interval"` // unit: second
+	RebalanceCheckInterval      int                           `default:"300" yaml:"rebalance_check_interval"`           // unit: second
+	RolloutCheckInterval        int                           `default:"60" yaml:"agent_config_rollout_check_interval"` // unit: second
 	VTapAutoDelete              VTapAutoDelete                `yaml:"vtap_auto_delete"`
 	Warrant                     configs.Warrant               `yaml:"warrant"`
 	IngesterLoadBalancingConfig IngesterLoadBalancingStrategy `yaml:"ingester-load-balancing-strategy"`
@@ -0,0 +1,269 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vtap
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	agentconf "github.com/deepflowio/deepflow/server/agent_config"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	controllerconfig "github.com/deepflowio/deepflow/server/controller/config"
+	"github.com/deepflowio/deepflow/server/controller/db/metadb"
+	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	"github.com/deepflowio/deepflow/server/controller/http/service"
+	querierCommon "github.com/deepflowio/deepflow/server/querier/common"
+	querierConfig "github.com/deepflowio/deepflow/server/querier/config"
+)
+
+// 采集器自身上报的异常，更高位为控制器设置的分配失败、授权等异常，与配置无关
+const agentExceptionsMask = 0x3FFFFFFF
+
+// RolloutCheck 检查灰度采集器的健康状况，自动推广或回滚采集器组配置的灰度发布
+type RolloutCheck struct {
+	vCtx    context.Context
+	vCancel context.CancelFunc
+	cfg     *controllerconfig.ControllerConfig
+}
+
+func NewRolloutCheck(cfg *controllerconfig.ControllerConfig, ctx context.Context) *RolloutCheck {
+	vCtx, vCancel := context.WithCancel(ctx)
+	return &RolloutCheck{
+		vCtx:    vCtx,
+		vCancel: vCancel,
+		cfg:     cfg,
+	}
+}
+
+func (r *RolloutCheck) Start(sCtx context.Context) {
+	log.Info("agent config rollout check start")
+	go func() {
+		ticker := time.NewTicker(time.Duration(r.cfg.MonitorCfg.RolloutCheckInterval) * time.Second)
+		defer ticker.Stop()
+	LOOP:
+		for {
+			select {
+			case <-ticker.C:
+				metadb.DoOnAllDBs(func(db *metadb.DB) error {
+					r.check(db)
+					return nil
+				})
+			case <-sCtx.Done():
+				break LOOP
+			case <-r.vCtx.Done():
+				break LOOP
+			}
+		}
+	}()
+}
+
+func (r *RolloutCheck) Stop() {
+	if r.vCancel != nil {
+		r.vCancel()
+	}
+	log.Info("agent config rollout check stopped")
+}
+
+func (r *RolloutCheck) check(db *metadb.DB) {
+	var rollouts []*agentconf.MySQLAgentGroupConfigurationRollout
+	if err := db.Where("state = ?", agentconf.ROLLOUT_STATE_RUNNING).Find(&rollouts).Error; err != nil {
+		log.Errorf("get running agent config rollouts failed: %s", err, db.LogPrefixORGID)
+		return
+	}
+	for _, rollout := range rollouts {
+		r.checkRollout(db, rollout)
+	}
+}
+
+type agentStat struct {
+	cpuRatio    float64
+	memoryRatio float64
+}
+
+func (r *RolloutCheck) checkRollout(db *metadb.DB, rollout *agentconf.MySQLAgentGroupConfigurationRollout) {
+	var agents []*agentconf.MySQLAgentGroupConfigurationRolloutAgent
+	if err := db.Where("rollout_id = ?", rollout.ID).Find(&agents).Error; err != nil {
+		log.Errorf("get agent config rollout (%s) agents failed: %s", rollout.Lcuuid, err, db.LogPrefixORGID)
+		return
+	}
+	vtapIDs := make([]int, len(agents))
+	for i, agent := range agents {
+		vtapIDs[i] = agent.VTapID
+	}
+	var vtaps []*metadbmodel.VTap
+	if err := db.Where("id IN ?", vtapIDs).Find(&vtaps).Error; err != nil {
+		log.Errorf("get agent config rollout (%s) vtaps failed: %s", rollout.Lcuuid, err, db.LogPrefixORGID)
+		return
+	}
+	idToVTap := make(map[int]*metadbmodel.VTap, len(vtaps))
+	names := make([]string, 0, len(vtaps))
+	for _, vtap := range vtaps {
+		idToVTap[vtap.ID] = vtap
+		names = append(names, vtap.Name)
+	}
+
+	// 只统计最近两个检查周期的数据，且不早于灰度开始时间
+	since := time.Now().Add(-2 * time.Duration(r.cfg.MonitorCfg.RolloutCheckInterval) * time.Second)
+	if since.Before(rollout.CreatedAt) {
+		since = rollout.CreatedAt
+	}
+	nameToStat, statErr := queryAgentStats(db, names, since)
+	if statErr != nil {
+		// 查询失败时无法判断资源使用，灰度采集器状态为 unknown，暂停自动推广和超时回滚
+		log.Warningf("query agent config rollout (%s) agent stats failed: %s", rollout.Lcuuid, statErr, db.LogPrefixORGID)
+	}
+
+	for _, agent := range agents {
+		vtap := idToVTap[agent.VTapID]
+		var stat *agentStat
+		if vtap != nil {
+			stat = nameToStat[vtap.Name]
+		}
+		agent.State, agent.Message = judgeRolloutAgent(rollout, agent, vtap, stat, statErr)
+		if stat != nil {
+			agent.CPURatio, agent.MemoryRatio = stat.cpuRatio, stat.memoryRatio
+		}
+		if err := db.Model(agent).Updates(map[string]interface{}{
+			"state":        agent.State,
+			"message":      agent.Message,
+			"cpu_ratio":    agent.CPURatio,
+			"memory_ratio": agent.MemoryRatio,
+		}).Error; err != nil {
+			log.Errorf("update agent config rollout (%s) agent (%s) failed: %s", rollout.Lcuuid, agent.VTapName, err, db.LogPrefixORGID)
+		}
+	}
+
+	state, message := decideRollout(rollout, agents, time.Now())
+	if state == "" {
+		return
+	}
+	agentGroupConfig := service.NewAgentGroupConfig(
+		httpcommon.NewUserInfo(common.USER_TYPE_SUPER_ADMIN, common.USER_ID_SUPER_ADMIN, db.ORGID), r.cfg,
+	)
+	var err error
+	if state == agentconf.ROLLOUT_STATE_PROMOTED {
+		err = agentGroupConfig.PromoteAgentGroupConfigRollout(rollout.AgentGroupLcuuid, rollout.Lcuuid, message)
+	} else {
+		err = agentGroupConfig.RollbackAgentGroupConfigRollout(rollout.AgentGroupLcuuid, rollout.Lcuuid, message)
+	}
+	if err != nil {
+		log.Errorf("finish agent config rollout (%s) failed: %s", rollout.Lcuuid, err, db.LogPrefixORGID)
+	}
+}
+
+// decideRollout 根据灰度采集器的状态决定推广或回滚，返回空状态时继续观察。
+// 存在 unknown 的采集器时不推广也不因超时回滚，仅在确认不健康时回滚
+func decideRollout(rollout *agentconf.MySQLAgentGroupConfigurationRollout, agents []*agentconf.MySQLAgentGroupConfigurationRolloutAgent, now time.Time) (string, string) {
+	var unhealthy []string
+	pending, unknown := 0, 0
+	for _, agent := range agents {
+		switch agent.State {
+		case agentconf.ROLLOUT_AGENT_STATE_UNHEALTHY:
+			unhealthy = append(unhealthy, fmt.Sprintf("%s: %s", agent.VTapName, agent.Message))
+		case agentconf.ROLLOUT_AGENT_STATE_PENDING:
+			pending++
+		case agentconf.ROLLOUT_AGENT_STATE_UNKNOWN:
+			unknown++
+		}
+	}
+	observed := now.Sub(rollout.CreatedAt)
+	observeDuration := time.Duration(rollout.ObserveSeconds) * time.Second
+	switch {
+	case len(unhealthy) > 0:
+		return agentconf.ROLLOUT_STATE_ROLLED_BACK, "auto rollback, unhealthy agents: " + strings.Join(unhealthy, "; ")
+	case unknown > 0:
+		return "", ""
+	case pending > 0 && observed >= 2*observeDuration:
+		return agentconf.ROLLOUT_STATE_ROLLED_BACK, fmt.Sprintf("auto rollback, %d agents have no monitor data after %s", pending, observed.Truncate(time.Second))
+	case pending == 0 && observed >= observeDuration:
+		return agentconf.ROLLOUT_STATE_PROMOTED, fmt.Sprintf("auto promote, %d agents healthy for %s", len(agents), observed.Truncate(time.Second))
+	}
+	return "", ""
+}
+
+// judgeRolloutAgent 返回灰度采集器的状态及原因，新增异常、失联或资源使用超出阈值均视为不健康，
+// 监控数据查询失败时资源使用未知
+func judgeRolloutAgent(rollout *agentconf.MySQLAgentGroupConfigurationRollout, agent *agentconf.MySQLAgentGroupConfigurationRolloutAgent,
+	vtap *metadbmodel.VTap, stat *agentStat, statErr error) (string, string) {
+	if vtap == nil {
+		return agentconf.ROLLOUT_AGENT_STATE_UNHEALTHY, "agent not found"
+	}
+	if vtap.State == common.VTAP_STATE_NOT_CONNECTED {
+		return agentconf.ROLLOUT_AGENT_STATE_UNHEALTHY, "agent lost"
+	}
+	if exceptions := vtap.Exceptions & agentExceptionsMask &^ agent.BaselineExceptions; exceptions != 0 {
+		return agentconf.ROLLOUT_AGENT_STATE_UNHEALTHY, fmt.Sprintf("new exceptions 0x%x", exceptions)
+	}
+	if stat == nil {
+		if statErr != nil {
+			return agentconf.ROLLOUT_AGENT_STATE_UNKNOWN, "query monitor data failed: " + statErr.Error()
+		}
+		return agentconf.ROLLOUT_AGENT_STATE_PENDING, "no monitor data yet"
+	}
+	if stat.cpuRatio > rollout.MaxCPURatio {
+		return agentconf.ROLLOUT_AGENT_STATE_UNHEALTHY, fmt.Sprintf("cpu ratio %.2f exceeds %.2f", stat.cpuRatio, rollout.MaxCPURatio)
+	}
+	if stat.memoryRatio > rollout.MaxMemoryRatio {
+		return agentconf.ROLLOUT_AGENT_STATE_UNHEALTHY, fmt.Sprintf("memory ratio %.2f exceeds %.2f", stat.memoryRatio, rollout.MaxMemoryRatio)
+	}
+	return agentconf.ROLLOUT_AGENT_STATE_HEALTHY, ""
+}
+
+// queryAgentStats 从 deepflow_agent_monitor 查询采集器 CPU、内存使用相对于其限制的比例
+func queryAgentStats(db *metadb.DB, names []string, since time.Time) (map[string]*agentStat, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = querierCommon.QuoteString(name)
+	}
+	sql := fmt.Sprintf("SELECT `tag.host`, Avg(`metrics.max_millicpus_ratio`) AS `cpu_ratio`, Max(`metrics.max_memory_ratio`) AS `memory_ratio`"+
+		" FROM deepflow_agent_monitor WHERE `time`>=%d AND `tag.host` IN (%s) GROUP BY `tag.host`", since.Unix(), strings.Join(quoted, ","))
+	values := url.Values{
+		"db":  {"deepflow_tenant"},
+		"sql": {sql},
+	}
+	queryURL := fmt.Sprintf("http://%s:%d/v1/query", common.GetPodIP(), querierConfig.Cfg.ListenPort)
+	resp, err := common.CURLForm(http.MethodPost, queryURL, values, common.WithORGHeader(strconv.Itoa(db.ORGID)), common.WithInternalAuthorization())
+	if err != nil {
+		return nil, err
+	}
+
+	result := resp.Get("result")
+	columnIndex := make(map[string]int)
+	for i, column := range result.Get("columns").MustArray() {
+		if name, ok := column.(string); ok {
+			columnIndex[name] = i
+		}
+	}
+	nameToStat := make(map[string]*agentStat)
+	for i := range result.Get("values").MustArray() {
+		value := result.Get("values").GetIndex(i)
+		nameToStat[value.GetIndex(columnIndex["tag.host"]).MustString()] = &agentStat{
+			cpuRatio:    value.GetIndex(columnIndex["cpu_ratio"]).MustFloat64(),
+			memoryRatio: value.GetIndex(columnIndex["memory_ratio"]).MustFloat64(),
+		}
+	}
+	return nameToStat, nil
+}
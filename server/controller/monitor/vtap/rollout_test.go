@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vtap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	agentconf "github.com/deepflowio/deepflow/server/agent_config"
+	"github.com/deepflowio/deepflow/server/controller/common"
+	metadbmodel "github.com/deepflowio/deepflow/server/controller/db/metadb/model"
+)
+
+func TestJudgeRolloutAgent(t *testing.T) {
+	rollout := &agentconf.MySQLAgentGroupConfigurationRollout{MaxCPURatio: 1, MaxMemoryRatio: 0.9}
+	agent := &agentconf.MySQLAgentGroupConfigurationRolloutAgent{BaselineExceptions: 0x1}
+	vtap := &metadbmodel.VTap{State: common.VTAP_STATE_NORMAL, Exceptions: 0x1}
+	queryErr := errors.New("401 Unauthorized")
+	var cases = []struct {
+		name    string
+		vtap    *metadbmodel.VTap
+		stat    *agentStat
+		statErr error
+		state   string
+	}{
+		{"not found", nil, nil, nil, agentconf.ROLLOUT_AGENT_STATE_UNHEALTHY},
+		{"lost", &metadbmodel.VTap{State: common.VTAP_STATE_NOT_CONNECTED}, nil, queryErr, agentconf.ROLLOUT_AGENT_STATE_UNHEALTHY},
+		{"new exceptions", &metadbmodel.VTap{State: common.VTAP_STATE_NORMAL, Exceptions: 0x3}, nil, nil, agentconf.ROLLOUT_AGENT_STATE_UNHEALTHY},
+		{"no data", vtap, nil, nil, agentconf.ROLLOUT_AGENT_STATE_PENDING},
+		{"query failed", vtap, nil, queryErr, agentconf.ROLLOUT_AGENT_STATE_UNKNOWN},
+		{"cpu exceeded", vtap, &agentStat{cpuRatio: 1.5}, nil, agentconf.ROLLOUT_AGENT_STATE_UNHEALTHY},
+		{"memory exceeded", vtap, &agentStat{memoryRatio: 0.95}, nil, agentconf.ROLLOUT_AGENT_STATE_UNHEALTHY},
+		{"healthy", vtap, &agentStat{cpuRatio: 0.5, memoryRatio: 0.5}, nil, agentconf.ROLLOUT_AGENT_STATE_HEALTHY},
+	}
+	for _, c := range cases {
+		if state, message := judgeRolloutAgent(rollout, agent, c.vtap, c.stat, c.statErr); state != c.state {
+			t.Errorf("%s: expect %s, got %s (%s)", c.name, c.state, state, message)
+		}
+	}
+}
+
+func TestDecideRollout(t *testing.T) {
+	now := time.Now()
+	newAgents := func(states ...string) []*agentconf.MySQLAgentGroupConfigurationRolloutAgent {
+		agents := make([]*agentconf.MySQLAgentGroupConfigurationRolloutAgent, len(states))
+		for i, state := range states {
+			agents[i] = &agentconf.MySQLAgentGroupConfigurationRolloutAgent{VTapName: "agent", State: state}
+		}
+		return agents
+	}
+	const (
+		healthy   = agentconf.ROLLOUT_AGENT_STATE_HEALTHY
+		pending   = agentconf.ROLLOUT_AGENT_STATE_PENDING
+		unhealthy = agentconf.ROLLOUT_AGENT_STATE_UNHEALTHY
+		unknown   = agentconf.ROLLOUT_AGENT_STATE_UNKNOWN
+	)
+	var cases = []struct {
+		name     string
+		observed time.Duration
+		agents   []*agentconf.MySQLAgentGroupConfigurationRolloutAgent
+		state    string
+	}{
+		{"observing", 5 * time.Minute, newAgents(healthy, pending), ""},
+		{"unhealthy", time.Minute, newAgents(healthy, unhealthy), agentconf.ROLLOUT_STATE_ROLLED_BACK},
+		{"promote", 10 * time.Minute, newAgents(healthy, healthy), agentconf.ROLLOUT_STATE_PROMOTED},
+		{"pending timeout", 20 * time.Minute, newAgents(healthy, pending), agentconf.ROLLOUT_STATE_ROLLED_BACK},
+		// 监控数据查询失败时暂停，不推广也不超时回滚
+		{"unknown", 30 * time.Minute, newAgents(unknown, unknown), ""},
+		{"unknown and pending", 30 * time.Minute, newAgents(unknown, pending), ""},
+		{"unknown and unhealthy", time.Minute, newAgents(unknown, unhealthy), agentconf.ROLLOUT_STATE_ROLLED_BACK},
+	}
+	for _, c := range cases {
+		rollout := &agentconf.MySQLAgentGroupConfigurationRollout{ObserveSeconds: 600, CreatedAt: now.Add(-c.observed)}
+		state, message := decideRollout(rollout, c.agents, now)
+		if state != c.state {
+			t.Errorf("%s: expect %q, got %q (%s)", c.name, c.state, state, message)
+		}
+		if state == agentconf.ROLLOUT_STATE_ROLLED_BACK && !strings.HasPrefix(message, "auto rollback") {
+			t.Errorf("%s: unexpected message %s", c.name, message)
+		}
+	}
+}
@@ -432,6 +432,7 @@ func (q *querier) getByRegion(domainNamePrefix string, resourceType string) (*si
 		url,
 		q.reqBody[resourceType],
 		common.WithORGHeader(strconv.Itoa(q.org.GetID())),
+		common.WithInternalAuthorization(),
 	)
 	if err != nil {
 		log.Errorf("failed to get raw data: %s, %s", err.Error(), url, q.org.LogPrefix)
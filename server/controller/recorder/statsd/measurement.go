@@ -26,8 +26,8 @@ type Monitor interface {
 
 type LocalResourceSyncDelay struct {
 	Count    uint64 `statsd:"count"`
-	AvgDelay uint64 `statsd:"avg_delay"`
-	MaxDelay uint64 `statsd:"max_delay"`
+	AvgDelay uint64 `statsd:"avg_delay,gauge"`
+	MaxDelay uint64 `statsd:"max_delay,gauge"`
 	sumDelay uint64
 }
 
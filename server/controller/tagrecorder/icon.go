@@ -128,7 +128,7 @@ func GetIconInfo(cfg config.ControllerConfig) (map[string]int, map[IconKey]int,
 		return domainToIconID, resourceToIconID, err
 	}
 	body := make(map[string]interface{})
-	response, err := common.CURLPerform("GET", fmt.Sprintf("http://%s:%d/v1/icons/", controller.IP, cfg.ListenNodePort), body)
+	response, err := common.CURLPerform("GET", fmt.Sprintf("http://%s:%d/v1/icons/", controller.IP, cfg.ListenNodePort), body, common.WithInternalAuthorization())
 	if err != nil {
 		log.Error(err)
 		return domainToIconID, resourceToIconID, err
@@ -82,7 +82,7 @@ func (r *RefreshOP) refreshCache(orgID int, dataTypes []common.DataChanged, othe
 			continue
 		}
 		trisolaris_url := fmt.Sprintf(urlFormat, controllerIP, common.GConfig.HTTPPort) + paramsEncode
-		resp, err := common.CURLPerform("PUT", trisolaris_url, nil)
+		resp, err := common.CURLPerform("PUT", trisolaris_url, nil, common.WithInternalAuthorization())
 		if err != nil {
 			log.Errorf("request trisolaris failed: %s, URL: %s", resp, trisolaris_url)
 		}
@@ -94,7 +94,7 @@ func (r *RefreshOP) refreshCache(orgID int, dataTypes []common.DataChanged, othe
 			continue
 		}
 		trisolaris_url := fmt.Sprintf(urlFormat, controllerIP, common.GConfig.HTTPNodePort) + paramsEncode
-		resp, err := common.CURLPerform("PUT", trisolaris_url, nil)
+		resp, err := common.CURLPerform("PUT", trisolaris_url, nil, common.WithInternalAuthorization())
 		if err != nil {
 			log.Errorf("request trisolaris failed: %s, URL: %s", resp, trisolaris_url)
 		}
@@ -34,9 +34,9 @@ const (
 )
 
 type Counter struct {
-	Max                  int `statsd:"max-bucket"`
-	Size                 int `statsd:"size"`
-	AvgScan              int `statsd:"avg-scan"` // 平均扫描次数
+	Max                  int `statsd:"max-bucket,gauge"`
+	Size                 int `statsd:"size,gauge"`
+	AvgScan              int `statsd:"avg-scan,gauge"` // 平均扫描次数
 	totalScan, scanTimes int
 }
 
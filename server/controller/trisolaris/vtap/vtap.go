@@ -33,6 +33,7 @@ import (
 
 	"github.com/deepflowio/deepflow/message/agent"
 	"github.com/deepflowio/deepflow/message/trident"
+	"github.com/deepflowio/deepflow/server/agent_config"
 	"github.com/deepflowio/deepflow/server/controller/common"
 	. "github.com/deepflowio/deepflow/server/controller/common"
 	mysql_model "github.com/deepflowio/deepflow/server/controller/db/metadb/model" // FIXME: To avoid ambiguity, name the package either mysql_model or db_model.
@@ -71,6 +72,7 @@ type VTapInfo struct {
 	vtapGroupShortIDToLcuuid       map[string]string
 	vtapGroupLcuuidToShortID       map[string]string
 	vtapGroupLcuuidToConfiguration map[string]*VTapConfig
+	vtapIDToCanaryConfiguration    map[int]*canaryConfig
 	vtapGroupLcuuidToLocalConfig   map[string]string
 	noVTapTapPortsMac              mapset.Set
 	kvmVTapCtrlIPToTapPorts        map[string]mapset.Set
@@ -140,6 +142,7 @@ func NewVTapInfo(db *gorm.DB, metaData *metadata.MetaData, cfg *config.Config, o
 		vtapGroupShortIDToLcuuid:       make(map[string]string),
 		vtapGroupLcuuidToShortID:       make(map[string]string),
 		vtapGroupLcuuidToConfiguration: make(map[string]*VTapConfig),
+		vtapIDToCanaryConfiguration:    make(map[int]*canaryConfig),
 		vtapGroupLcuuidToLocalConfig:   make(map[string]string),
 		noVTapTapPortsMac:              mapset.NewSet(),
 		kvmVTapCtrlIPToTapPorts:        make(map[string]mapset.Set),
@@ -502,6 +505,35 @@ func (v *VTapInfo) getAgentConfigs() {
 		vtapGroupLcuuidToConfiguration[config.AgentGroupLcuuid] = vTapConfig
 	}
 	v.vtapGroupLcuuidToConfiguration = vtapGroupLcuuidToConfiguration
+	v.vtapIDToCanaryConfiguration = v.getCanaryAgentConfigs()
+}
+
+type canaryConfig struct {
+	agentGroupLcuuid string
+	config           *VTapConfig
+}
+
+// getCanaryAgentConfigs 灰度发布中的配置只下发给灰度采集器
+func (v *VTapInfo) getCanaryAgentConfigs() map[int]*canaryConfig {
+	vtapIDToCanaryConfiguration := make(map[int]*canaryConfig)
+	rolloutAgentConfigs, err := agent_config.GetRunningRolloutAgentConfigs(v.db)
+	if err != nil {
+		log.Error(v.Logf("get running rollout agent configs failed: %s", err))
+		return vtapIDToCanaryConfiguration
+	}
+	rolloutIDToCanary := make(map[int]*canaryConfig)
+	for _, c := range rolloutAgentConfigs {
+		canary, ok := rolloutIDToCanary[c.RolloutID]
+		if !ok {
+			canary = &canaryConfig{
+				agentGroupLcuuid: c.AgentGroupLcuuid,
+				config:           NewVTapConfig(c.Yaml),
+			}
+			rolloutIDToCanary[c.RolloutID] = canary
+		}
+		vtapIDToCanaryConfiguration[c.VTapID] = canary
+	}
+	return vtapIDToCanaryConfiguration
 }
 
 func (v *VTapInfo) GetVTapConfigFromShortID(shortID string) *VTapConfig {
@@ -1409,12 +1409,22 @@ func (c *VTapCache) initVTapPodDomains() {
 	c.podDomains = c.vTapInfo.getVTapPodDomains(c)
 }
 
+// getVTapGroupConfig 灰度采集器优先使用灰度发布中的配置
+func (c *VTapCache) getVTapGroupConfig() (*VTapConfig, bool) {
+	v := c.vTapInfo
+	vtapGroupLcuuid := c.GetVTapGroupLcuuid()
+	if canary, ok := v.vtapIDToCanaryConfiguration[int(c.GetVTapID())]; ok && canary.agentGroupLcuuid == vtapGroupLcuuid {
+		return canary.config, true
+	}
+	config, ok := v.vtapGroupLcuuidToConfiguration[vtapGroupLcuuid]
+	return config, ok
+}
+
 func (c *VTapCache) initVTapConfig() {
 	v := c.vTapInfo
 	realConfig := VTapConfig{}
-	vtapGroupLcuuid := c.GetVTapGroupLcuuid()
 
-	if config, ok := v.vtapGroupLcuuidToConfiguration[vtapGroupLcuuid]; ok {
+	if config, ok := c.getVTapGroupConfig(); ok {
 		realConfig = deepcopy.Copy(*config).(VTapConfig)
 		realConfig.UserConfig = config.GetUserConfig()
 	} else {
@@ -1434,7 +1444,7 @@ func (c *VTapCache) updateVTapConfigFromDB() {
 	v := c.vTapInfo
 	newConfig := VTapConfig{}
 
-	config, ok := v.vtapGroupLcuuidToConfiguration[c.GetVTapGroupLcuuid()]
+	config, ok := c.getVTapGroupConfig()
 	if ok {
 		newConfig = deepcopy.Copy(*config).(VTapConfig)
 		newConfig.UserConfig = config.GetUserConfig()
@@ -24,6 +24,7 @@ import (
 	"github.com/deepflowio/deepflow/server/ingester/app_log/dbwriter"
 	"github.com/deepflowio/deepflow/server/ingester/app_log/decoder"
 	dropletqueue "github.com/deepflowio/deepflow/server/ingester/droplet/queue"
+	"github.com/deepflowio/deepflow/server/ingester/exporters"
 	"github.com/deepflowio/deepflow/server/ingester/ingesterctl"
 	"github.com/deepflowio/deepflow/server/ingester/pkg/ckwriter"
 	"github.com/deepflowio/deepflow/server/libs/datatype"
@@ -51,6 +52,7 @@ func NewApplicationLogger(
 	config *config.Config,
 	recv *receiver.Receiver,
 	platformDataManager *grpc.PlatformDataManager,
+	exporters *exporters.Exporters,
 ) (*ApplicationLogger, error) {
 	manager := dropletqueue.NewManager(ingesterctl.INGESTERCTL_APPLICATION_LOG_QUEUE)
 
@@ -58,15 +60,16 @@ func NewApplicationLogger(
 	if err != nil {
 		return nil, err
 	}
-	sysLogger, err := NewLogger(datatype.MESSAGE_TYPE_SYSLOG, config, manager, recv, platformDataManager, ckwriter)
+	sysLogger, err := NewLogger(datatype.MESSAGE_TYPE_SYSLOG, config, manager, recv, platformDataManager, ckwriter, nil)
 	if err != nil {
 		return nil, err
 	}
-	agentLogger, err := NewLogger(datatype.MESSAGE_TYPE_AGENT_LOG, config, manager, recv, platformDataManager, ckwriter)
+	agentLogger, err := NewLogger(datatype.MESSAGE_TYPE_AGENT_LOG, config, manager, recv, platformDataManager, ckwriter, nil)
 	if err != nil {
 		return nil, err
 	}
-	appLogger, err := NewLogger(datatype.MESSAGE_TYPE_APPLICATION_LOG, config, manager, recv, platformDataManager, ckwriter)
+	// only the logs of applications are exported, syslog and agent logs are deepflow's own logs
+	appLogger, err := NewLogger(datatype.MESSAGE_TYPE_APPLICATION_LOG, config, manager, recv, platformDataManager, ckwriter, exporters)
 	if err != nil {
 		return nil, err
 	}
@@ -102,6 +105,7 @@ func NewLogger(
 	recv *receiver.Receiver,
 	platformDataManager *grpc.PlatformDataManager,
 	ckwriter *ckwriter.CKWriter,
+	exporters *exporters.Exporters,
 ) (*Logger, error) {
 
 	queueCount := config.DecoderQueueCount
@@ -131,6 +135,7 @@ func NewLogger(
 			queue.QueueReader(decodeQueues.FixedMultiQueue[i]),
 			logWriter,
 			platformDatas[i],
+			exporters,
 			config,
 		)
 	}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dbwriter
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+
+	"github.com/deepflowio/deepflow/server/ingester/exporters/common"
+	"github.com/deepflowio/deepflow/server/ingester/exporters/config"
+	utag "github.com/deepflowio/deepflow/server/ingester/exporters/universal_tag"
+	"github.com/deepflowio/deepflow/server/libs/utils"
+)
+
+// severity_number is stored as the value of log/syslog, refer to decoder.SEVERITY_*
+var severityNumberToOtlp = map[uint8]plog.SeverityNumber{
+	2: plog.SeverityNumberFatal,
+	3: plog.SeverityNumberError,
+	4: plog.SeverityNumberWarn,
+	5: plog.SeverityNumberInfo,
+	6: plog.SeverityNumberDebug,
+	7: plog.SeverityNumberTrace,
+}
+
+func (l *ApplicationLogStore) DataSource() uint32 {
+	return uint32(config.APPLICATION_LOG)
+}
+
+func (l *ApplicationLogStore) TimestampUs() int64 {
+	return l.Timestamp
+}
+
+func (l *ApplicationLogStore) GetFieldValueByOffsetAndKind(offset uintptr, kind reflect.Kind, dataType utils.DataType) interface{} {
+	return utils.GetValueByOffsetAndKind(uintptr(unsafe.Pointer(l)), offset, kind, dataType)
+}
+
+func (l *ApplicationLogStore) QueryUniversalTags(utags *utag.UniversalTagsManager) *utag.UniversalTags {
+	return utags.QueryUniversalTags(l.OrgId,
+		l.RegionID, l.AZID, l.HostID, l.PodNSID, l.PodClusterID, l.SubnetID, l.AgentID,
+		l.L3DeviceType, l.AutoServiceType, l.AutoInstanceType,
+		l.L3DeviceID, l.AutoServiceID, l.AutoInstanceID, l.PodNodeID, l.PodGroupID, l.PodID, uint32(l.L3EpcID), l.GProcessID, l.ServiceID,
+		l.IsIPv4, l.IP4, l.IP6)
+}
+
+func (l *ApplicationLogStore) EncodeTo(protocol config.ExportProtocol, utags *utag.UniversalTagsManager, cfg *config.ExporterCfg) (interface{}, error) {
+	switch protocol {
+	case config.PROTOCOL_OTLP:
+		return l.EncodeToOtlp(utags, cfg.ExportFieldCategoryBits), nil
+	case config.PROTOCOL_KAFKA:
+		tags := l.QueryUniversalTags(utags)
+		if tags == nil {
+			tags = &utag.UniversalTags{}
+		}
+		k8sLabels := utags.QueryCustomK8sLabels(l.OrgId, l.PodID)
+		return common.EncodeToKafka(l, int(l.DataSource()), cfg, tags, tags, k8sLabels, k8sLabels), nil
+	default:
+		return nil, fmt.Errorf("application_log unsupport export to %s", protocol)
+	}
+}
+
+func (l *ApplicationLogStore) EncodeToOtlp(utags *utag.UniversalTagsManager, dataTypeBits uint64) interface{} {
+	logSlice := plog.NewResourceLogsSlice()
+	resLog := logSlice.AppendEmpty()
+	resAttrs := resLog.Resource().Attributes()
+	common.PutStrWithoutEmpty(resAttrs, "service.name", l.AppService)
+	common.PutUniversalTags(resAttrs, l.QueryUniversalTags(utags), dataTypeBits)
+	if l.PodID != 0 {
+		common.PutK8sLabels(resAttrs, utags.QueryCustomK8sLabels(l.OrgId, l.PodID), dataTypeBits)
+	}
+
+	record := resLog.ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+	record.SetTimestamp(pcommon.Timestamp(l.Timestamp * 1000)) // us -> ns
+	record.SetObservedTimestamp(pcommon.Timestamp(l.Timestamp * 1000))
+	record.SetSeverityNumber(severityNumberToOtlp[l.SeverityNumber])
+	record.SetSeverityText(record.SeverityNumber().String())
+	record.Body().SetStr(l.Body)
+	if traceId, err := hex.DecodeString(l.TraceID); err == nil && len(traceId) == 16 {
+		record.SetTraceID(pcommon.TraceID(traceId))
+	}
+	if spanId, err := hex.DecodeString(l.SpanID); err == nil && len(spanId) == 8 {
+		record.SetSpanID(pcommon.SpanID(spanId))
+	}
+
+	attrs := record.Attributes()
+	common.PutStrWithoutEmpty(attrs, "df.log.type", l.Type)
+	common.PutAttributes(attrs, l.AttributeNames, l.AttributeValues, dataTypeBits)
+	if dataTypeBits&config.METRICS != 0 && len(l.MetricsNames) == len(l.MetricsValues) {
+		for i := range l.MetricsNames {
+			attrs.PutDouble(l.MetricsNames[i], l.MetricsValues[i])
+		}
+	}
+	return logSlice
+}
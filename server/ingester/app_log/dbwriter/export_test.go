@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dbwriter
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/collector/pdata/plog"
+
+	"github.com/deepflowio/deepflow/server/ingester/exporters/config"
+	exporterstest "github.com/deepflowio/deepflow/server/ingester/exporters/test"
+	utag "github.com/deepflowio/deepflow/server/ingester/exporters/universal_tag"
+)
+
+func testApplicationLog() *ApplicationLogStore {
+	return &ApplicationLogStore{
+		Time:            1700000000,
+		Timestamp:       1700000000123456,
+		Type:            "log",
+		TraceID:         "0af7651916cd43dd8448eb211c80319c",
+		SpanID:          "b7ad6b7169203331",
+		SeverityNumber:  3,
+		Body:            "connect to mysql failed",
+		AppService:      "order-service",
+		AttributeNames:  []string{"k8s.container.name", "empty"},
+		AttributeValues: []string{"order", ""},
+		MetricsNames:    []string{"retry"},
+		MetricsValues:   []float64{3},
+	}
+}
+
+func TestApplicationLogEncodeToOtlp(t *testing.T) {
+	utags := &utag.UniversalTagsManager{}
+	bits := config.NATIVE_TAG | config.METRICS
+
+	logs := plog.NewLogs()
+	testApplicationLog().EncodeToOtlp(utags, bits).(plog.ResourceLogsSlice).MoveAndAppendTo(logs.ResourceLogs())
+	got, err := (&plog.JSONMarshaler{}).MarshalLogs(logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporterstest.CheckJSONFixture(t, "testfiles/app_log_otlp.json", got)
+
+	// 非法的 trace_id/span_id 不设置，未开启的字段类别不导出
+	l := testApplicationLog()
+	l.TraceID, l.SpanID = "not-a-hex-id", "b7ad"
+	record := l.EncodeToOtlp(utags, 0).(plog.ResourceLogsSlice).At(0).ScopeLogs().At(0).LogRecords().At(0)
+	if !record.TraceID().IsEmpty() || !record.SpanID().IsEmpty() {
+		t.Errorf("invalid trace_id or span_id should not be exported")
+	}
+	if record.Attributes().Len() != 1 {
+		t.Errorf("only df.log.type is expected, got %v", record.Attributes().AsRaw())
+	}
+}
+
+func TestApplicationLogEncodeTo(t *testing.T) {
+	cfg := &config.ExporterCfg{ExportFieldCategoryBits: config.NATIVE_TAG}
+	utags := &utag.UniversalTagsManager{}
+	l := testApplicationLog()
+	if _, err := l.EncodeTo(config.PROTOCOL_OTLP, utags, cfg); err != nil {
+		t.Errorf("encode to otlp failed: %s", err)
+	}
+	if _, err := l.EncodeTo(config.PROTOCOL_PROMETHEUS, utags, cfg); err == nil {
+		t.Errorf("application log should not be exported to prometheus")
+	}
+}
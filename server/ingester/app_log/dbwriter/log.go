@@ -23,7 +23,6 @@ import (
 	"sync/atomic"
 
 	basecommon "github.com/deepflowio/deepflow/server/ingester/common"
-	"github.com/deepflowio/deepflow/server/ingester/exporters/config"
 	"github.com/deepflowio/deepflow/server/ingester/flow_tag"
 	"github.com/deepflowio/deepflow/server/libs/ckdb"
 	"github.com/deepflowio/deepflow/server/libs/nativetag"
@@ -66,15 +65,15 @@ type ApplicationLogStore struct {
 	Time      uint32 `json:"time" category:"$tag" sub:"flow_info"` // s
 	Timestamp int64  `json:"timestamp" category:"$tag" sub:"flow_info"`
 	_id       uint64 `json:"_id" category:"$tag" sub:"flow_info"`
-	Type      string
+	Type      string `json:"_type" category:"$tag" sub:"flow_info"`
 
-	TraceID    string
-	SpanID     string
+	TraceID    string `json:"trace_id" category:"$tag" sub:"tracing_info"`
+	SpanID     string `json:"span_id" category:"$tag" sub:"tracing_info"`
 	TraceFlags uint32
 
-	SeverityNumber uint8 // numerical value of the severity(also known as log level id)
+	SeverityNumber uint8 `json:"severity_number" category:"$tag" sub:"tracing_info" enumfile:"severity_number"` // numerical value of the severity(also known as log level id)
 
-	Body string
+	Body string `json:"body" category:"$tag" sub:"tracing_info"`
 
 	AppService string `json:"app_service" category:"$tag" sub:"service_info"` // service name
 
@@ -131,10 +130,6 @@ func (l *ApplicationLogStore) Release() {
 	ReleaseApplicationLogStore(l)
 }
 
-func (l *ApplicationLogStore) DataSource() uint32 {
-	return uint32(config.MAX_DATASOURCE_ID)
-}
-
 var LogCounter uint32
 
 func (l *ApplicationLogStore) SetId(time, analyzerID uint32) {
@@ -30,6 +30,9 @@ import (
 	"github.com/deepflowio/deepflow/server/ingester/app_log/config"
 	"github.com/deepflowio/deepflow/server/ingester/app_log/dbwriter"
 	ingestercommon "github.com/deepflowio/deepflow/server/ingester/common"
+	"github.com/deepflowio/deepflow/server/ingester/exporters"
+	exporterscommon "github.com/deepflowio/deepflow/server/ingester/exporters/common"
+	exportconfig "github.com/deepflowio/deepflow/server/ingester/exporters/config"
 	"github.com/deepflowio/deepflow/server/libs/ckdb"
 	"github.com/deepflowio/deepflow/server/libs/codec"
 	"github.com/deepflowio/deepflow/server/libs/datatype"
@@ -115,6 +118,7 @@ type Decoder struct {
 	platformData      *grpc.PlatformInfoTable
 	inQueue           queue.QueueReader
 	logWriter         *dbwriter.AppLogWriter
+	exporters         *exporters.Exporters
 	debugEnabled      bool
 	config            *config.Config
 	appLogEntrysCache []AppLogEntry
@@ -130,6 +134,7 @@ func NewDecoder(
 	inQueue queue.QueueReader,
 	logWriter *dbwriter.AppLogWriter,
 	platformData *grpc.PlatformInfoTable,
+	exporters *exporters.Exporters,
 	config *config.Config,
 ) *Decoder {
 	return &Decoder{
@@ -139,6 +144,7 @@ func NewDecoder(
 		inQueue:           inQueue,
 		debugEnabled:      log.IsEnabledFor(logging.DEBUG),
 		logWriter:         logWriter,
+		exporters:         exporters,
 		appLogEntrysCache: make([]AppLogEntry, 0),
 		config:            config,
 		counter:           &Counter{},
@@ -162,6 +168,7 @@ func (d *Decoder) Run() {
 		n := d.inQueue.Gets(buffer)
 		for i := 0; i < n; i++ {
 			if buffer[i] == nil {
+				d.export(nil)
 				continue
 			}
 			d.counter.InCount++
@@ -449,10 +456,18 @@ func (d *Decoder) WriteAppLog(agentId uint16, l *AppLogEntry) error {
 	customServiceID := d.platformData.QueryCustomService(s.OrgId, s.L3EpcID, !s.IsIPv4, s.IP4, s.IP6, 0)
 	s.AutoServiceID, s.AutoServiceType = ingestercommon.GetAutoService(customServiceID, s.ServiceID, s.PodGroupID, 0, s.PodNodeID, s.L3DeviceID, uint32(s.SubnetID), uint8(s.L3DeviceType), podGroupType, s.L3EpcID)
 
+	d.export(s)
 	d.logWriter.Write(s)
 	return nil
 }
 
+func (d *Decoder) export(item exporterscommon.ExportItem) {
+	if d.exporters == nil {
+		return
+	}
+	d.exporters.Put(uint32(exportconfig.APPLICATION_LOG), d.index, item)
+}
+
 type AppLogEntry struct {
 	LogType    string `json:"_df_log_type"`
 	UserID     int    `json:"user_id"`
@@ -58,6 +58,10 @@ const (
 	DefaultStatsInterval            = 10      // s
 	DefaultFlowTagCacheFlushTimeout = 1800    // s
 	DefaultFlowTagCacheMaxSize      = 1 << 18 // 256k
+	DefaultCKWriterSpoolDir         = "/var/lib/deepflow/ckwriter-spool"
+	DefaultCKWriterSpoolMaxSize     = 1024 // MB
+	DefaultCKWriterSpoolMaxAge      = 60   // minute
+	DefaultCKWriterSpoolReplay      = 10   // s
 	IndexTypeHash                   = "hash"
 	IndexTypeIncremetalIdLocation   = "incremental-id"
 	FormatHex                       = "hex"
@@ -139,6 +143,30 @@ type CKWriterConfig struct {
 	FlushTimeout int `yaml:"flush-timeout"`
 }
 
+// CKWriterSpool 开启后，写入 ClickHouse 失败的数据块会落盘暂存，待 ClickHouse 恢复后按顺序重新写入
+type CKWriterSpool struct {
+	Enabled        bool   `yaml:"enabled"`
+	Dir            string `yaml:"dir"`
+	MaxSize        int    `yaml:"max-size"`        // MB, total size of all the spooled blocks
+	MaxAge         int    `yaml:"max-age"`         // minute, spooled blocks older than this are dropped
+	ReplayInterval int    `yaml:"replay-interval"` // s
+}
+
+func (s *CKWriterSpool) Validate() {
+	if s.Dir == "" {
+		s.Dir = DefaultCKWriterSpoolDir
+	}
+	if s.MaxSize <= 0 {
+		s.MaxSize = DefaultCKWriterSpoolMaxSize
+	}
+	if s.MaxAge <= 0 {
+		s.MaxAge = DefaultCKWriterSpoolMaxAge
+	}
+	if s.ReplayInterval <= 0 {
+		s.ReplayInterval = DefaultCKWriterSpoolReplay
+	}
+}
+
 type CKDB struct {
 	External            bool     `yaml:"external"`
 	Type                string   `yaml:"type"`
@@ -177,6 +205,7 @@ type Config struct {
 	TCPReadBuffer            int             `yaml:"tcp-read-buffer"`
 	TCPReaderBuffer          int             `yaml:"tcp-reader-buffer"`
 	CKDiskMonitor            CKDiskMonitor   `yaml:"ck-disk-monitor"`
+	CKWriterSpool            CKWriterSpool   `yaml:"ckwriter-spool"`
 	ColdStorage              CKDBColdStorage `yaml:"ckdb-cold-storage"`
 	ckdbColdStorages         map[string]*ckdb.ColdStorage
 	NodeIP                   string `yaml:"node-ip"`
@@ -339,6 +368,7 @@ func (c *Config) Validate() error {
 		return nil
 	}
 	c.CKDiskMonitor.Validate()
+	c.CKWriterSpool.Validate()
 
 	if c.CKDB.Type == "" {
 		c.CKDB.Type = ckdb.CKDBTypeClickhouse
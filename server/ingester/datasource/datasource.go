@@ -28,6 +28,7 @@ import (
 	"github.com/deepflowio/deepflow/server/ingester/common"
 	"github.com/deepflowio/deepflow/server/ingester/config"
 	"github.com/deepflowio/deepflow/server/libs/ckdb"
+	"github.com/deepflowio/deepflow/server/libs/stats"
 	"github.com/deepflowio/deepflow/server/libs/utils"
 	"github.com/gorilla/mux"
 	logging "github.com/op/go-logging"
@@ -215,6 +216,7 @@ func (m *DatasourceManager) RegisterHandlers() {
 	router.HandleFunc("/v1/rpadd/", m.rpAdd).Methods("POST")
 	router.HandleFunc("/v1/rpmod/", m.rpMod).Methods("PATCH")
 	router.HandleFunc("/v1/rpdel/", m.rpDel).Methods("DELETE")
+	router.Handle(stats.METRICS_PATH, stats.MetricsHandler()).Methods("GET")
 }
 
 func (m *DatasourceManager) Start() {
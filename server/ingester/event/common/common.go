@@ -65,6 +65,12 @@ func (e EventType) DataSource() uint32 {
 	switch e {
 	case PERF_EVENT:
 		return uint32(exportconfig.PERF_EVENT)
+	case RESOURCE_EVENT:
+		return uint32(exportconfig.RESOURCE_EVENT)
+	case K8S_EVENT:
+		return uint32(exportconfig.K8S_EVENT)
+	case ALERT_EVENT:
+		return uint32(exportconfig.ALERT_EVENT)
 	default:
 		return uint32(exportconfig.MAX_DATASOURCE_ID)
 	}
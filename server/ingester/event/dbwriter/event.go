@@ -64,7 +64,7 @@ type EventStore struct {
 
 	SignalSource     uint8  `json:"signal_source" category:"$tag" sub:"capture_info" enumfile:"perf_event_signal_source"` // Resource / File IO
 	EventType        string `json:"event_type" category:"$tag" sub:"event_info" enumfile:"perf_event_type"`
-	EventDescription string
+	EventDescription string `json:"event_description" category:"$tag" sub:"event_info"`
 	ProcessKName     string `json:"process_kname" category:"$tag" sub:"service_info"` // us
 
 	GProcessID uint32 `json:"gprocess_id" category:"$tag" sub:"universal_tag"`
@@ -133,7 +133,10 @@ func (e *EventStore) DataSource() uint32 {
 	if e.HasMetrics {
 		return uint32(config.PERF_EVENT)
 	}
-	return uint32(config.MAX_DATASOURCE_ID)
+	if e.SignalSource == uint8(SIGNAL_SOURCE_K8S) {
+		return uint32(config.K8S_EVENT)
+	}
+	return uint32(config.RESOURCE_EVENT)
 }
 
 func (e *EventStore) EncodeTo(protocol config.ExportProtocol, utags *utag.UniversalTagsManager, cfg *config.ExporterCfg) (interface{}, error) {
@@ -141,7 +144,7 @@ func (e *EventStore) EncodeTo(protocol config.ExportProtocol, utags *utag.Univer
 	case config.PROTOCOL_KAFKA:
 		tags := e.QueryUniversalTags(utags)
 		k8sLabels := utags.QueryCustomK8sLabels(e.OrgId, e.PodID)
-		return exportercommon.EncodeToJson(e, int(e.DataSource()), cfg, tags, tags, k8sLabels, k8sLabels), nil
+		return exportercommon.EncodeToKafka(e, int(e.DataSource()), cfg, tags, tags, k8sLabels, k8sLabels), nil
 	default:
 		return nil, fmt.Errorf("event unsupport export to %s", protocol)
 	}
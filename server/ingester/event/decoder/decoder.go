@@ -416,6 +416,7 @@ func (d *Decoder) handleResourceEvent(event *eventapi.ResourceEvent) {
 		)
 
 	d.counter.OutCount++
+	d.export(s)
 	d.eventWriter.Write(s)
 }
 
@@ -465,5 +466,6 @@ func (d *Decoder) writeAlertEvent(event *alert_event.AlertEvent) {
 	s.TeamID = uint16(event.GetTeamId())
 	s.UserId = event.GetUserId()
 
+	d.export(s)
 	d.eventWriter.WriteAlertEvent(s)
 }
@@ -0,0 +1,460 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package archive_exporter
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	logging "github.com/op/go-logging"
+
+	ingester_common "github.com/deepflowio/deepflow/server/ingester/common"
+	"github.com/deepflowio/deepflow/server/ingester/exporters/common"
+	exporters_cfg "github.com/deepflowio/deepflow/server/ingester/exporters/config"
+	utag "github.com/deepflowio/deepflow/server/ingester/exporters/universal_tag"
+	"github.com/deepflowio/deepflow/server/ingester/ingesterctl"
+	"github.com/deepflowio/deepflow/server/libs/ckdb"
+	"github.com/deepflowio/deepflow/server/libs/debug"
+	"github.com/deepflowio/deepflow/server/libs/queue"
+	"github.com/deepflowio/deepflow/server/libs/stats"
+	"github.com/deepflowio/deepflow/server/libs/utils"
+)
+
+var log = logging.MustGetLogger("archive_exporter")
+
+const (
+	QUEUE_BATCH_COUNT = 1024
+
+	TMP_SUFFIX     = ".tmp"
+	JSONL_SUFFIX   = ".jsonl"
+	GZIP_SUFFIX    = ".gz"
+	PARQUET_SUFFIX = ".parquet"
+)
+
+type ArchiveExporter struct {
+	index                int
+	dataQueues           queue.FixedMultiQueue
+	queueCount           int
+	universalTagsManager *utag.UniversalTagsManager
+	config               *exporters_cfg.ExporterCfg
+	uploader             *S3Uploader
+	counter              *Counter
+	lastCounter          Counter
+	running              bool
+
+	utils.Closable
+}
+
+// Counter is updated by the queues and the uploader concurrently, all the fields are accessed atomically
+type Counter struct {
+	RecvCounter         int64 `statsd:"recv-count"`
+	WriteCounter        int64 `statsd:"write-count"`
+	WriteBytes          int64 `statsd:"write-bytes"`
+	FileCounter         int64 `statsd:"file-count"`
+	DropCounter         int64 `statsd:"drop-count"`
+	UploadCounter       int64 `statsd:"upload-count"`
+	UploadBytes         int64 `statsd:"upload-bytes"`
+	UploadFailedCounter int64 `statsd:"upload-failed-count"`
+	UploadDropCounter   int64 `statsd:"upload-drop-count"`
+}
+
+func (e *ArchiveExporter) GetCounter() interface{} {
+	c := e.counter
+	counter := Counter{
+		RecvCounter:         atomic.SwapInt64(&c.RecvCounter, 0),
+		WriteCounter:        atomic.SwapInt64(&c.WriteCounter, 0),
+		WriteBytes:          atomic.SwapInt64(&c.WriteBytes, 0),
+		FileCounter:         atomic.SwapInt64(&c.FileCounter, 0),
+		DropCounter:         atomic.SwapInt64(&c.DropCounter, 0),
+		UploadCounter:       atomic.SwapInt64(&c.UploadCounter, 0),
+		UploadBytes:         atomic.SwapInt64(&c.UploadBytes, 0),
+		UploadFailedCounter: atomic.SwapInt64(&c.UploadFailedCounter, 0),
+		UploadDropCounter:   atomic.SwapInt64(&c.UploadDropCounter, 0),
+	}
+	e.lastCounter = counter
+	return &counter
+}
+
+func NewArchiveExporter(index int, config *exporters_cfg.ExporterCfg, universalTagsManager *utag.UniversalTagsManager) *ArchiveExporter {
+	dataQueues := queue.NewOverwriteQueues(
+		fmt.Sprintf("archive_exporter_%d", index), queue.HashKey(config.QueueCount), config.QueueSize,
+		queue.OptionFlushIndicator(time.Second),
+		queue.OptionRelease(func(p interface{}) { p.(common.ExportItem).Release() }),
+		ingester_common.QUEUE_STATS_MODULE_INGESTER)
+
+	exporter := &ArchiveExporter{
+		index:                index,
+		dataQueues:           dataQueues,
+		queueCount:           config.QueueCount,
+		universalTagsManager: universalTagsManager,
+		config:               config,
+		counter:              &Counter{},
+	}
+	if config.Archive.S3.Enabled {
+		exporter.uploader = NewS3Uploader(&config.Archive.S3, config.Archive.Dir, exporter.counter)
+	}
+	debug.ServerRegisterSimple(ingesterctl.CMD_ARCHIVE_EXPORTER, exporter)
+	ingester_common.RegisterCountableForIngester("exporter", exporter, stats.OptionStatTags{
+		"type": "archive", "index": strconv.Itoa(index)})
+	log.Infof("archive exporter %d created, archive config: %+v", index, config.Archive)
+	return exporter
+}
+
+func (e *ArchiveExporter) Put(items ...interface{}) {
+	recv := atomic.AddInt64(&e.counter.RecvCounter, 1)
+	e.dataQueues.Put(queue.HashKey(int(recv)%e.queueCount), items...)
+}
+
+func (e *ArchiveExporter) Start() {
+	if e.running {
+		log.Warningf("archive exporter %d already running", e.index)
+		return
+	}
+	if err := os.MkdirAll(e.config.Archive.Dir, 0755); err != nil {
+		log.Errorf("archive exporter %d create dir %s failed: %s", e.index, e.config.Archive.Dir, err)
+		return
+	}
+	e.running = true
+	if e.uploader != nil {
+		e.uploader.Start()
+	}
+	for i := 0; i < e.queueCount; i++ {
+		go e.queueProcess(int(i))
+	}
+	log.Infof("archive exporter %d started %d queue", e.index, e.queueCount)
+}
+
+func (e *ArchiveExporter) Close() {
+	e.Closable.Close()
+	e.running = false
+	if e.uploader != nil {
+		e.uploader.Close()
+	}
+	log.Infof("archive exporter %d stopping", e.index)
+}
+
+type partitionKey struct {
+	dataSource uint32
+	orgId      uint16
+	hour       int64 // unix seconds of the hour
+}
+
+func itemPartition(item common.ExportItem) partitionKey {
+	orgId := uint16(ckdb.DEFAULT_ORG_ID)
+	if o, ok := item.(interface{ OrgID() uint16 }); ok && o.OrgID() != ckdb.INVALID_ORG_ID {
+		orgId = o.OrgID()
+	}
+	return partitionKey{
+		dataSource: item.DataSource(),
+		orgId:      orgId,
+		hour:       item.TimestampUs() / int64(time.Second/time.Microsecond) / 3600 * 3600,
+	}
+}
+
+// partitionDir returns the hive style partition directory, could be read directly by Hive, Spark, Trino, etc.
+func partitionDir(dir string, key partitionKey) string {
+	t := time.Unix(key.hour, 0).UTC()
+	return filepath.Join(dir,
+		"datasource="+exporters_cfg.DataSourceID(key.dataSource).String(),
+		"org_id="+strconv.Itoa(int(key.orgId)),
+		"date="+t.Format("2006-01-02"),
+		fmt.Sprintf("hour=%02d", t.Hour()))
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// archiveFile is the file being written, it is renamed to remove the '.tmp' suffix after closed
+type archiveFile struct {
+	path string
+	file *os.File
+	cw   *countWriter
+	bw   *bufio.Writer
+	gz   *gzip.Writer
+	w    io.Writer
+
+	rows    []string // parquet rows are buffered as json and written when closing
+	rowSize int64
+	count   int
+}
+
+func (e *ArchiveExporter) newArchiveFile(queueID int, key partitionKey) (*archiveFile, error) {
+	cfg := &e.config.Archive
+	dir := partitionDir(cfg.Dir, key)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("part-%d-%d-%d", e.index, queueID, time.Now().UnixNano())
+	f := &archiveFile{}
+	if cfg.Format == exporters_cfg.ARCHIVE_FORMAT_PARQUET {
+		f.path = filepath.Join(dir, name+PARQUET_SUFFIX)
+		return f, nil
+	}
+
+	f.path = filepath.Join(dir, name+JSONL_SUFFIX)
+	if cfg.Compression == exporters_cfg.ARCHIVE_COMPRESSION_GZIP {
+		f.path += GZIP_SUFFIX
+	}
+	file, err := os.OpenFile(f.path+TMP_SUFFIX, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	f.file = file
+	f.cw = &countWriter{w: file}
+	f.bw = bufio.NewWriterSize(f.cw, 64*1024)
+	f.w = f.bw
+	if cfg.Compression == exporters_cfg.ARCHIVE_COMPRESSION_GZIP {
+		f.gz = gzip.NewWriter(f.bw)
+		f.w = f.gz
+	}
+	return f, nil
+}
+
+func (f *archiveFile) write(jsonStr string) error {
+	f.count++
+	if f.file == nil {
+		f.rows = append(f.rows, jsonStr)
+		f.rowSize += int64(len(jsonStr))
+		return nil
+	}
+	if _, err := io.WriteString(f.w, jsonStr); err != nil {
+		return err
+	}
+	_, err := f.w.Write([]byte{'\n'})
+	return err
+}
+
+// size returns the bytes written to the disk for jsonl, and the bytes of json rows for parquet
+func (f *archiveFile) size() int64 {
+	if f.file == nil {
+		return f.rowSize
+	}
+	return f.cw.n
+}
+
+// decodeRows decodes the buffered json rows, invalid rows are skipped
+func (f *archiveFile) decodeRows() []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0, len(f.rows))
+	for _, jsonStr := range f.rows {
+		d := json.NewDecoder(strings.NewReader(jsonStr))
+		d.UseNumber()
+		row := make(map[string]interface{})
+		if err := d.Decode(&row); err != nil {
+			log.Debugf("decode archive row %s failed: %s", jsonStr, err)
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func (f *archiveFile) close(codec int32) error {
+	if f.file == nil {
+		file, err := os.OpenFile(f.path+TMP_SUFFIX, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		bw := bufio.NewWriterSize(file, 64*1024)
+		err = WriteParquet(bw, f.decodeRows(), codec)
+		if err == nil {
+			err = bw.Flush()
+		}
+		f.rows = nil
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if f.gz != nil {
+			err = f.gz.Close()
+		}
+		if flushErr := f.bw.Flush(); err == nil {
+			err = flushErr
+		}
+		if closeErr := f.file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return os.Rename(f.path+TMP_SUFFIX, f.path)
+}
+
+func parquetCodec(compression string) int32 {
+	switch compression {
+	case exporters_cfg.ARCHIVE_COMPRESSION_SNAPPY:
+		return PARQUET_SNAPPY
+	case exporters_cfg.ARCHIVE_COMPRESSION_GZIP:
+		return PARQUET_GZIP
+	default:
+		return PARQUET_UNCOMPRESSED
+	}
+}
+
+func (e *ArchiveExporter) closeFile(f *archiveFile) {
+	if err := f.close(parquetCodec(e.config.Archive.Compression)); err != nil {
+		log.Warningf("archive exporter %d close file %s failed: %s", e.index, f.path, err)
+		return
+	}
+	atomic.AddInt64(&e.counter.FileCounter, 1)
+	if e.uploader != nil {
+		e.uploader.Upload(f.path)
+	}
+}
+
+// archiveFiles are the files being written by a queue
+type archiveFiles struct {
+	files    map[partitionKey]*archiveFile
+	buffered int64 // size of the parquet rows buffered in memory
+}
+
+func (e *ArchiveExporter) closePartition(files *archiveFiles, key partitionKey) {
+	f := files.files[key]
+	if f.file == nil {
+		files.buffered -= f.rowSize
+	}
+	e.closeFile(f)
+	delete(files.files, key)
+}
+
+// closeExpiredFiles closes the files of the hours ended 'close-delay' seconds ago
+func (e *ArchiveExporter) closeExpiredFiles(files *archiveFiles, now time.Time) {
+	delay := int64(e.config.Archive.CloseDelay)
+	for key := range files.files {
+		if key.hour+3600+delay <= now.Unix() {
+			e.closePartition(files, key)
+		}
+	}
+}
+
+// limitBuffer closes the files buffering the most parquet rows until the buffered size is under the limit
+func (e *ArchiveExporter) limitBuffer(files *archiveFiles) {
+	limit := int64(e.config.Archive.BufferSize) << 20
+	for files.buffered > limit {
+		var largest partitionKey
+		var largestSize int64
+		for key, f := range files.files {
+			if f.file == nil && f.rowSize > largestSize {
+				largest, largestSize = key, f.rowSize
+			}
+		}
+		if largestSize == 0 {
+			return
+		}
+		e.closePartition(files, largest)
+	}
+}
+
+func (e *ArchiveExporter) queueProcess(queueID int) {
+	items := make([]interface{}, QUEUE_BATCH_COUNT)
+	files := &archiveFiles{files: make(map[partitionKey]*archiveFile)}
+	maxFileSize := int64(e.config.Archive.MaxFileSize) << 20
+	maxFileRows := e.config.Archive.MaxFileRows
+	lastCheck := time.Now()
+
+	for e.running {
+		n := e.dataQueues.Gets(queue.HashKey(queueID), items)
+		for _, item := range items[:n] {
+			if item == nil {
+				if now := time.Now(); now.Sub(lastCheck) >= time.Second {
+					e.closeExpiredFiles(files, now)
+					lastCheck = now
+				}
+				continue
+			}
+			exportItem, ok := item.(common.ExportItem)
+			if !ok {
+				atomic.AddInt64(&e.counter.DropCounter, 1)
+				continue
+			}
+
+			// reuse the json encoding of kafka exporter, includes field selection and translation
+			json, err := exportItem.EncodeTo(exporters_cfg.PROTOCOL_KAFKA, e.universalTagsManager, e.config)
+			key := itemPartition(exportItem)
+			exportItem.Release()
+			if err != nil {
+				if atomic.AddInt64(&e.counter.DropCounter, 1) == 1 {
+					log.Warningf("archive encode failed, err: %s", err)
+				}
+				continue
+			}
+			jsonStr, ok := json.(string)
+			if !ok {
+				if atomic.AddInt64(&e.counter.DropCounter, 1) == 1 {
+					log.Warningf("archive exporter %d got unexpected encoded type %T", e.index, json)
+				}
+				continue
+			}
+
+			f := files.files[key]
+			if f == nil {
+				if f, err = e.newArchiveFile(queueID, key); err != nil {
+					if atomic.AddInt64(&e.counter.DropCounter, 1) == 1 {
+						log.Warningf("archive exporter %d create file failed, err: %s", e.index, err)
+					}
+					continue
+				}
+				files.files[key] = f
+			}
+			if err := f.write(jsonStr); err != nil {
+				if atomic.AddInt64(&e.counter.DropCounter, 1) == 1 {
+					log.Warningf("archive exporter %d write file %s failed, err: %s", e.index, f.path, err)
+				}
+				continue
+			}
+			atomic.AddInt64(&e.counter.WriteCounter, 1)
+			atomic.AddInt64(&e.counter.WriteBytes, int64(len(jsonStr)))
+			if f.file == nil {
+				files.buffered += int64(len(jsonStr))
+			}
+
+			if f.size() >= maxFileSize || f.count >= maxFileRows {
+				e.closePartition(files, key)
+			}
+			e.limitBuffer(files)
+		}
+	}
+
+	for key := range files.files {
+		e.closePartition(files, key)
+	}
+}
+
+func (e *ArchiveExporter) HandleSimpleCommand(op uint16, arg string) string {
+	return fmt.Sprintf("archive exporter %d last 10s counter: %+v", e.index, e.lastCounter)
+}
@@ -0,0 +1,436 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package archive_exporter
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/golang/snappy"
+
+	exporters_cfg "github.com/deepflowio/deepflow/server/ingester/exporters/config"
+)
+
+// thriftReader decodes thrift compact protocol structs as map[field id]value
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1, 2: // bool in field header
+		return typ == 1
+	case 3:
+		r.pos++
+		return int64(r.buf[r.pos-1])
+	case 4, 5, 6:
+		return r.zigzag()
+	case 7:
+		v := math.Float64frombits(binary.LittleEndian.Uint64(r.buf[r.pos:]))
+		r.pos += 8
+		return v
+	case 8:
+		n := int(r.uvarint())
+		r.pos += n
+		return string(r.buf[r.pos-n : r.pos])
+	case 9:
+		h := r.buf[r.pos]
+		r.pos++
+		size := int(h >> 4)
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = r.value(h & 0x0f)
+		}
+		return list
+	case 12:
+		return r.readStruct()
+	}
+	panic("unsupported thrift type")
+}
+
+func (r *thriftReader) readStruct() map[int16]interface{} {
+	s := make(map[int16]interface{})
+	var last int16
+	for {
+		h := r.buf[r.pos]
+		r.pos++
+		if h == 0 {
+			return s
+		}
+		if delta := int16(h >> 4); delta != 0 {
+			last += delta
+		} else {
+			last = int16(r.zigzag())
+		}
+		s[last] = r.value(h & 0x0f)
+	}
+}
+
+func readParquet(t *testing.T, data []byte) (map[int16]interface{}, map[string][]interface{}) {
+	if string(data[:4]) != PARQUET_MAGIC || string(data[len(data)-4:]) != PARQUET_MAGIC {
+		t.Fatalf("invalid parquet magic")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := &thriftReader{buf: data[len(data)-8-footerLen : len(data)-8]}
+	meta := footer.readStruct()
+	if footer.pos != footerLen {
+		t.Fatalf("footer length %d, decoded %d", footerLen, footer.pos)
+	}
+
+	columns := make(map[string][]interface{})
+	rowGroup := meta[4].([]interface{})[0].(map[int16]interface{})
+	for _, c := range rowGroup[1].([]interface{}) {
+		chunk := c.(map[int16]interface{})[3].(map[int16]interface{})
+		typ, name, codec := int32(chunk[1].(int64)), chunk[3].([]interface{})[0].(string), int32(chunk[4].(int64))
+		r := &thriftReader{buf: data, pos: int(chunk[9].(int64))}
+		header := r.readStruct()
+		page := data[r.pos : r.pos+int(header[3].(int64))]
+		switch codec {
+		case PARQUET_SNAPPY:
+			page, _ = snappy.Decode(nil, page)
+		case PARQUET_GZIP:
+			gz, _ := gzip.NewReader(bytes.NewReader(page))
+			page, _ = io.ReadAll(gz)
+		}
+		if len(page) != int(header[2].(int64)) {
+			t.Fatalf("column %s page size %d, expect %d", name, len(page), header[2])
+		}
+
+		numValues := int(header[5].(map[int16]interface{})[1].(int64))
+		levels := page[4 : 4+binary.LittleEndian.Uint32(page)]
+		_, n := binary.Uvarint(levels)
+		levels = levels[n:]
+		values := page[4+binary.LittleEndian.Uint32(page):]
+		column := make([]interface{}, numValues)
+		defined := 0
+		for i := range column {
+			if levels[i/8]&(1<<(i%8)) == 0 {
+				continue
+			}
+			switch typ {
+			case PARQUET_BOOLEAN:
+				column[i] = values[defined/8]&(1<<(defined%8)) != 0
+			case PARQUET_INT64:
+				column[i] = int64(binary.LittleEndian.Uint64(values))
+				values = values[8:]
+			case PARQUET_DOUBLE:
+				column[i] = math.Float64frombits(binary.LittleEndian.Uint64(values))
+				values = values[8:]
+			default:
+				l := binary.LittleEndian.Uint32(values)
+				column[i] = string(values[4 : 4+l])
+				values = values[4+l:]
+			}
+			defined++
+		}
+		columns[name] = column
+	}
+	return meta, columns
+}
+
+func TestWriteParquet(t *testing.T) {
+	lines := []string{
+		`{"time":1700000000,"datasource":"flow_log.l7_flow_log","ip4":"1.2.3.4","rrt":1.5,"ok":true,"tags":["a","b"]}`,
+		`{"time":1700000001,"datasource":"flow_log.l7_flow_log","rrt":2,"response_code":200,"ok":false}`,
+	}
+	for i := 0; i < 20; i++ {
+		lines = append(lines, `{"time":1700000002,"response_code":404}`)
+	}
+	rows := []map[string]interface{}{}
+	for _, l := range lines {
+		d := json.NewDecoder(strings.NewReader(l))
+		d.UseNumber()
+		row := make(map[string]interface{})
+		if err := d.Decode(&row); err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+
+	for _, codec := range []int32{PARQUET_UNCOMPRESSED, PARQUET_SNAPPY, PARQUET_GZIP} {
+		var b bytes.Buffer
+		if err := WriteParquet(&b, rows, codec); err != nil {
+			t.Fatal(err)
+		}
+		meta, columns := readParquet(t, b.Bytes())
+		if meta[3].(int64) != int64(len(rows)) {
+			t.Errorf("num rows %d, expect %d", meta[3], len(rows))
+		}
+		schema := meta[2].([]interface{})
+		if len(schema) != 8 || schema[0].(map[int16]interface{})[5].(int64) != 7 {
+			t.Fatalf("unexpected schema %v", schema)
+		}
+		if name := schema[1].(map[int16]interface{})[4]; name != "datasource" {
+			t.Errorf("first column %s, expect datasource", name)
+		}
+
+		expects := map[string][]interface{}{
+			"time":          {int64(1700000000), int64(1700000001), int64(1700000002)},
+			"rrt":           {1.5, 2.0, nil},
+			"ok":            {true, false, nil},
+			"ip4":           {"1.2.3.4", nil, nil},
+			"response_code": {nil, int64(200), int64(404)},
+			"tags":          {`["a","b"]`, nil, nil},
+		}
+		for name, expect := range expects {
+			column := columns[name]
+			if len(column) != len(rows) {
+				t.Fatalf("column %s has %d values", name, len(column))
+			}
+			for i, v := range expect {
+				if column[i] != v {
+					t.Errorf("codec %d column %s row %d got %v, expect %v", codec, name, i, column[i], v)
+				}
+			}
+		}
+	}
+}
+
+func TestPartitionDir(t *testing.T) {
+	key := partitionKey{
+		dataSource: uint32(exporters_cfg.L7_FLOW_LOG),
+		orgId:      2,
+		hour:       time.Date(2024, 3, 5, 7, 0, 0, 0, time.UTC).Unix(),
+	}
+	dir := partitionDir("/archive", key)
+	expect := "/archive/datasource=" + exporters_cfg.L7_FLOW_LOG.String() + "/org_id=2/date=2024-03-05/hour=07"
+	if dir != expect {
+		t.Errorf("partition dir %s, expect %s", dir, expect)
+	}
+}
+
+func TestArchiveFileJsonl(t *testing.T) {
+	e := &ArchiveExporter{config: &exporters_cfg.ExporterCfg{}, counter: &Counter{}}
+	e.config.Archive.Dir = t.TempDir()
+	e.config.Archive.Format = exporters_cfg.ARCHIVE_FORMAT_JSONL
+	if err := e.config.Archive.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := e.newArchiveFile(0, partitionKey{dataSource: uint32(exporters_cfg.L7_FLOW_LOG), orgId: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{`{"a":1}`, `{"a":2}`} {
+		if err := f.write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(f.path + TMP_SUFFIX); err != nil {
+		t.Fatalf("tmp file not exist: %s", err)
+	}
+	e.closeFile(f)
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := []string{}
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 2 || lines[1] != `{"a":2}` {
+		t.Errorf("unexpected lines %v", lines)
+	}
+	if files := scanArchiveFiles(e.config.Archive.Dir); len(files) != 1 || files[0] != f.path {
+		t.Errorf("unexpected scanned files %v", files)
+	}
+}
+
+// serverSignature calculates the signature of the request as S3 does, the object key is escaped after decoded
+func serverSignature(t *testing.T, r *http.Request, accessKey, secretKey string) string {
+	req, err := http.NewRequest(r.Method, "http://"+r.Host+r.URL.Path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.ContentLength = r.ContentLength
+	req.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+	req.Header.Set("X-Amz-Content-Sha256", r.Header.Get("X-Amz-Content-Sha256"))
+	signTime, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentials := aws.Credentials{AccessKeyID: accessKey, SecretAccessKey: secretKey}
+	if err := v4.NewSigner().SignHTTP(context.Background(), credentials, req, r.Header.Get("X-Amz-Content-Sha256"), "s3", "us-east-1", signTime); err != nil {
+		t.Fatal(err)
+	}
+	return req.Header.Get("Authorization")
+}
+
+func TestEscapeObjectKey(t *testing.T) {
+	key := "archive/datasource=flow_log.l7_flow_log/org_id=1/part 0~1.jsonl"
+	if got := escapeObjectKey(key); got != "archive/datasource%3Dflow_log.l7_flow_log/org_id%3D1/part%200~1.jsonl" {
+		t.Errorf("unexpected escaped key %s", got)
+	}
+}
+
+func TestS3UploadOverflow(t *testing.T) {
+	u := NewS3Uploader(&exporters_cfg.ArchiveS3{}, t.TempDir(), &Counter{})
+	u.files = make(chan string)
+	u.Upload("a.jsonl")
+	u.Upload("b.jsonl")
+	if overflow := u.takeOverflow(); len(overflow) != 2 || overflow[1] != "b.jsonl" || u.counter.UploadDropCounter != 2 {
+		t.Errorf("the files overflowing the upload queue should be retried, got %v", overflow)
+	}
+	if overflow := u.takeOverflow(); len(overflow) != 0 {
+		t.Errorf("unexpected overflow %v", overflow)
+	}
+}
+
+func TestArchiveBufferLimit(t *testing.T) {
+	e := &ArchiveExporter{config: &exporters_cfg.ExporterCfg{}, counter: &Counter{}}
+	e.config.Archive.Dir = t.TempDir()
+	e.config.Archive.Format = exporters_cfg.ARCHIVE_FORMAT_PARQUET
+	e.config.Archive.BufferSize = 1
+	if err := e.config.Archive.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := &archiveFiles{files: make(map[partitionKey]*archiveFile)}
+	row := `{"datasource":"flow_log.l7_flow_log","body":"` + strings.Repeat("x", 1000) + `"}`
+	keys := []partitionKey{{orgId: 1}, {orgId: 2}}
+	for i, count := range []int{600, 500} {
+		f, err := e.newArchiveFile(0, keys[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		files.files[keys[i]] = f
+		for j := 0; j < count; j++ {
+			f.write(row)
+			files.buffered += int64(len(row))
+		}
+	}
+	largest := files.files[keys[0]]
+	e.limitBuffer(files)
+
+	if _, ok := files.files[keys[0]]; ok || len(files.files) != 1 {
+		t.Fatalf("the file buffering the most rows should be closed, files: %v", files.files)
+	}
+	if files.buffered != files.files[keys[1]].rowSize {
+		t.Errorf("buffered size %d mismatch with the file %d", files.buffered, files.files[keys[1]].rowSize)
+	}
+	if _, err := os.Stat(largest.path); err != nil {
+		t.Errorf("the closed parquet file not exist: %s", err)
+	}
+	if e.counter.FileCounter != 1 {
+		t.Errorf("unexpected counter %+v", e.counter)
+	}
+}
+
+// the http server is a stand-in of MinIO which supports PutObject only
+func TestS3Upload(t *testing.T) {
+	objects := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=minio/") || !strings.Contains(auth, "/us-east-1/s3/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("X-Amz-Content-Sha256") == "" || r.Header.Get("X-Amz-Date") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// S3 escapes the decoded object key to calculate the signature
+		if expect := serverSignature(t, r, "minio", "minio123"); auth != expect {
+			t.Errorf("signature mismatch, got %s, expect %s", auth, expect)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		objects[r.URL.Path] = body
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	cfg := &exporters_cfg.Archive{
+		Dir: dir,
+		S3: exporters_cfg.ArchiveS3{
+			Enabled:        true,
+			Endpoint:       server.URL,
+			Bucket:         "deepflow",
+			Prefix:         "/archive/",
+			AccessKey:      "minio",
+			SecretKey:      "minio123",
+			ForcePathStyle: true,
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "datasource=flow_log.l7_flow_log", "org_id=1", "part-0-0-1.jsonl")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, []byte(`{"a":1}`+"\n"), 0644)
+
+	u := NewS3Uploader(&cfg.S3, dir, &Counter{})
+	if err := u.uploadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	key := "/deepflow/archive/datasource=flow_log.l7_flow_log/org_id=1/part-0-0-1.jsonl"
+	if string(objects[key]) != `{"a":1}`+"\n" {
+		t.Errorf("object %s not uploaded, objects: %v", key, objects)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("local file should be removed after uploaded")
+	}
+
+	u.cfg.SecretKey = ""
+	u.cfg.AccessKey = "invalid"
+	if err := u.PutObject(context.Background(), "x", nil); err == nil {
+		t.Errorf("put object with invalid access key should fail")
+	}
+}
@@ -0,0 +1,412 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package archive_exporter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+
+	"github.com/golang/snappy"
+)
+
+// A minimal parquet writer: each file has a single row group, each column chunk has a single
+// PLAIN encoded data page (v1), and all columns are OPTIONAL.
+// refer to: https://github.com/apache/parquet-format
+
+const (
+	PARQUET_MAGIC = "PAR1"
+
+	// parquet physical types
+	PARQUET_BOOLEAN    int32 = 0
+	PARQUET_INT64      int32 = 2
+	PARQUET_DOUBLE     int32 = 5
+	PARQUET_BYTE_ARRAY int32 = 6
+
+	// parquet compression codecs
+	PARQUET_UNCOMPRESSED int32 = 0
+	PARQUET_SNAPPY       int32 = 1
+	PARQUET_GZIP         int32 = 2
+
+	parquetRepetitionOptional int32 = 1
+	parquetConvertedUTF8      int32 = 0
+	parquetEncodingPlain      int32 = 0
+	parquetEncodingRLE        int32 = 3
+	parquetPageTypeData       int32 = 0
+)
+
+// thrift compact protocol types
+const (
+	thriftI32    byte = 5
+	thriftI64    byte = 6
+	thriftBinary byte = 8
+	thriftList   byte = 9
+	thriftStruct byte = 12
+)
+
+// thriftWriter encodes the parquet metadata with thrift compact protocol
+type thriftWriter struct {
+	buf       []byte
+	lastField int16
+	stack     []int16
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	t.buf = binary.AppendUvarint(t.buf, v)
+}
+
+func (t *thriftWriter) zigzag(v int64) {
+	t.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (t *thriftWriter) fieldHeader(id int16, typ byte) {
+	if delta := id - t.lastField; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.zigzag(int64(id))
+	}
+	t.lastField = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.fieldHeader(id, thriftI32)
+	t.zigzag(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.fieldHeader(id, thriftI64)
+	t.zigzag(v)
+}
+
+func (t *thriftWriter) binary(id int16, v string) {
+	t.fieldHeader(id, thriftBinary)
+	t.rawBinary(v)
+}
+
+func (t *thriftWriter) rawBinary(v string) {
+	t.varint(uint64(len(v)))
+	t.buf = append(t.buf, v...)
+}
+
+func (t *thriftWriter) listBegin(id int16, elemType byte, size int) {
+	t.fieldHeader(id, thriftList)
+	if size < 15 {
+		t.buf = append(t.buf, byte(size)<<4|elemType)
+	} else {
+		t.buf = append(t.buf, 0xf0|elemType)
+		t.varint(uint64(size))
+	}
+}
+
+// structBegin starts a struct field, or a struct element of list if id is 0
+func (t *thriftWriter) structBegin(id int16) {
+	if id != 0 {
+		t.fieldHeader(id, thriftStruct)
+	}
+	t.stack = append(t.stack, t.lastField)
+	t.lastField = 0
+}
+
+func (t *thriftWriter) structEnd() {
+	t.buf = append(t.buf, 0) // STOP
+	t.lastField = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+type parquetColumn struct {
+	name     string
+	typ      int32
+	defined  []bool
+	booleans []bool
+	int64s   []int64
+	doubles  []float64
+	strings  []string
+}
+
+// inferColumnType returns the parquet type of the json values, nil values are ignored
+func inferColumnType(values []interface{}) int32 {
+	typ := int32(-1)
+	for _, v := range values {
+		var t int32
+		switch x := v.(type) {
+		case nil:
+			continue
+		case bool:
+			t = PARQUET_BOOLEAN
+		case json.Number:
+			if _, err := x.Int64(); err == nil {
+				t = PARQUET_INT64
+			} else {
+				t = PARQUET_DOUBLE
+			}
+		default:
+			return PARQUET_BYTE_ARRAY
+		}
+		switch {
+		case typ == -1:
+			typ = t
+		case typ == t:
+		case (typ == PARQUET_INT64 && t == PARQUET_DOUBLE) || (typ == PARQUET_DOUBLE && t == PARQUET_INT64):
+			typ = PARQUET_DOUBLE
+		default:
+			return PARQUET_BYTE_ARRAY
+		}
+	}
+	if typ == -1 {
+		return PARQUET_BYTE_ARRAY
+	}
+	return typ
+}
+
+func newParquetColumn(name string, values []interface{}) *parquetColumn {
+	c := &parquetColumn{name: name, typ: inferColumnType(values), defined: make([]bool, len(values))}
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		c.defined[i] = true
+		switch c.typ {
+		case PARQUET_BOOLEAN:
+			c.booleans = append(c.booleans, v.(bool))
+		case PARQUET_INT64:
+			n, _ := v.(json.Number).Int64()
+			c.int64s = append(c.int64s, n)
+		case PARQUET_DOUBLE:
+			f, _ := v.(json.Number).Float64()
+			c.doubles = append(c.doubles, f)
+		default:
+			switch x := v.(type) {
+			case string:
+				c.strings = append(c.strings, x)
+			case json.Number:
+				c.strings = append(c.strings, x.String())
+			default:
+				// arrays and objects are stored as json strings
+				b, _ := json.Marshal(x)
+				c.strings = append(c.strings, string(b))
+			}
+		}
+	}
+	return c
+}
+
+// encodePage encodes the definition levels and the PLAIN values of data page v1
+func (c *parquetColumn) encodePage() []byte {
+	// definition levels: bit-packed hybrid encoding with bit width 1, prefixed by the length
+	groups := (len(c.defined) + 7) / 8
+	levels := binary.AppendUvarint(nil, uint64(groups)<<1|1)
+	packed := make([]byte, groups)
+	for i, d := range c.defined {
+		if d {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	levels = append(levels, packed...)
+
+	page := binary.LittleEndian.AppendUint32(make([]byte, 0, 4+len(levels)), uint32(len(levels)))
+	page = append(page, levels...)
+	switch c.typ {
+	case PARQUET_BOOLEAN:
+		bits := make([]byte, (len(c.booleans)+7)/8)
+		for i, b := range c.booleans {
+			if b {
+				bits[i/8] |= 1 << (i % 8)
+			}
+		}
+		page = append(page, bits...)
+	case PARQUET_INT64:
+		for _, v := range c.int64s {
+			page = binary.LittleEndian.AppendUint64(page, uint64(v))
+		}
+	case PARQUET_DOUBLE:
+		for _, v := range c.doubles {
+			page = binary.LittleEndian.AppendUint64(page, math.Float64bits(v))
+		}
+	default:
+		for _, v := range c.strings {
+			page = binary.LittleEndian.AppendUint32(page, uint32(len(v)))
+			page = append(page, v...)
+		}
+	}
+	return page
+}
+
+func compressPage(data []byte, codec int32) ([]byte, error) {
+	switch codec {
+	case PARQUET_SNAPPY:
+		return snappy.Encode(nil, data), nil
+	case PARQUET_GZIP:
+		var b bytes.Buffer
+		w := gzip.NewWriter(&b)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	default:
+		return data, nil
+	}
+}
+
+type columnChunkMeta struct {
+	offset           int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+// WriteParquet writes the json objects as a parquet file with a single row group. The columns are
+// the union of the keys in order of appearance, the column types are inferred from the values.
+func WriteParquet(w io.Writer, rows []map[string]interface{}, codec int32) error {
+	var names []string
+	index := make(map[string]int)
+	for _, row := range rows {
+		for k := range row {
+			if _, ok := index[k]; !ok {
+				index[k] = len(names)
+				names = append(names, k)
+			}
+		}
+	}
+	// map iteration is random, keep 'datasource' and 'time' in the front for readability
+	sortColumnNames(names)
+
+	offset := int64(len(PARQUET_MAGIC))
+	if _, err := io.WriteString(w, PARQUET_MAGIC); err != nil {
+		return err
+	}
+
+	columns := make([]*parquetColumn, len(names))
+	metas := make([]columnChunkMeta, len(names))
+	values := make([]interface{}, len(rows))
+	var totalSize int64
+	for i, name := range names {
+		for j, row := range rows {
+			values[j] = row[name]
+		}
+		c := newParquetColumn(name, values)
+		columns[i] = c
+
+		page := c.encodePage()
+		compressed, err := compressPage(page, codec)
+		if err != nil {
+			return err
+		}
+		header := &thriftWriter{}
+		header.i32(1, parquetPageTypeData)
+		header.i32(2, int32(len(page)))
+		header.i32(3, int32(len(compressed)))
+		header.structBegin(5)
+		header.i32(1, int32(len(rows)))
+		header.i32(2, parquetEncodingPlain)
+		header.i32(3, parquetEncodingRLE)
+		header.i32(4, parquetEncodingRLE)
+		header.structEnd()
+		header.buf = append(header.buf, 0) // STOP of PageHeader
+
+		if _, err := w.Write(header.buf); err != nil {
+			return err
+		}
+		if _, err := w.Write(compressed); err != nil {
+			return err
+		}
+		metas[i] = columnChunkMeta{
+			offset:           offset,
+			uncompressedSize: int64(len(header.buf) + len(page)),
+			compressedSize:   int64(len(header.buf) + len(compressed)),
+		}
+		offset += metas[i].compressedSize
+		totalSize += metas[i].uncompressedSize
+	}
+
+	footer := encodeFileMetaData(columns, metas, int64(len(rows)), totalSize, codec)
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	footer = append(footer, PARQUET_MAGIC...)
+	_, err := w.Write(footer)
+	return err
+}
+
+func sortColumnNames(names []string) {
+	front := 0
+	for _, name := range []string{"datasource", "time"} {
+		for i := front; i < len(names); i++ {
+			if names[i] == name {
+				copy(names[front+1:i+1], names[front:i])
+				names[front] = name
+				front++
+				break
+			}
+		}
+	}
+}
+
+func encodeFileMetaData(columns []*parquetColumn, metas []columnChunkMeta, numRows, totalSize int64, codec int32) []byte {
+	t := &thriftWriter{}
+	t.i32(1, 1) // version
+
+	t.listBegin(2, thriftStruct, len(columns)+1)
+	t.structBegin(0)
+	t.binary(4, "schema")
+	t.i32(5, int32(len(columns)))
+	t.structEnd()
+	for _, c := range columns {
+		t.structBegin(0)
+		t.i32(1, c.typ)
+		t.i32(3, parquetRepetitionOptional)
+		t.binary(4, c.name)
+		if c.typ == PARQUET_BYTE_ARRAY {
+			t.i32(6, parquetConvertedUTF8)
+		}
+		t.structEnd()
+	}
+
+	t.i64(3, numRows)
+
+	t.listBegin(4, thriftStruct, 1)
+	t.structBegin(0)
+	t.listBegin(1, thriftStruct, len(columns))
+	for i, c := range columns {
+		t.structBegin(0)
+		t.i64(2, metas[i].offset)
+		t.structBegin(3)
+		t.i32(1, c.typ)
+		t.listBegin(2, thriftI32, 2)
+		t.zigzag(int64(parquetEncodingPlain))
+		t.zigzag(int64(parquetEncodingRLE))
+		t.listBegin(3, thriftBinary, 1)
+		t.rawBinary(c.name)
+		t.i32(4, codec)
+		t.i64(5, numRows)
+		t.i64(6, metas[i].uncompressedSize)
+		t.i64(7, metas[i].compressedSize)
+		t.i64(9, metas[i].offset)
+		t.structEnd()
+		t.structEnd()
+	}
+	t.i64(2, totalSize)
+	t.i64(3, numRows)
+	t.structEnd()
+
+	t.binary(6, "deepflow-server")
+	t.buf = append(t.buf, 0) // STOP of FileMetaData
+	return t.buf
+}
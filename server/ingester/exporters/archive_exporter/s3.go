@@ -0,0 +1,259 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package archive_exporter
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+
+	exporters_cfg "github.com/deepflowio/deepflow/server/ingester/exporters/config"
+)
+
+const (
+	UPLOAD_QUEUE_SIZE     = 4096
+	UPLOAD_RETRY_INTERVAL = 10 * time.Second
+)
+
+// S3Uploader uploads the closed archive files to S3 compatible object storage with PutObject,
+// the failed files and the files overflowing the upload queue are kept on the local disk and retried periodically.
+type S3Uploader struct {
+	cfg     *exporters_cfg.ArchiveS3
+	dir     string
+	client  *http.Client
+	signer  *v4.Signer
+	files   chan string
+	pending []string
+	counter *Counter
+	running int32
+
+	overflowLock sync.Mutex
+	overflow     []string // the files dropped by the full upload queue
+}
+
+func NewS3Uploader(cfg *exporters_cfg.ArchiveS3, dir string, counter *Counter) *S3Uploader {
+	return &S3Uploader{
+		cfg:    cfg,
+		dir:    dir,
+		client: &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Second},
+		signer: v4.NewSigner(func(o *v4.SignerOptions) {
+			// the object key in the url is escaped by escapeObjectKey already, S3 does not escape it again
+			o.DisableURIPathEscaping = true
+		}),
+		files:   make(chan string, UPLOAD_QUEUE_SIZE),
+		counter: counter,
+	}
+}
+
+func (u *S3Uploader) Start() {
+	if !atomic.CompareAndSwapInt32(&u.running, 0, 1) {
+		return
+	}
+	// the files closed but not uploaded before restarting
+	if !u.cfg.KeepLocal {
+		u.pending = append(u.pending, scanArchiveFiles(u.dir)...)
+	}
+	go u.run()
+}
+
+func (u *S3Uploader) Close() {
+	atomic.StoreInt32(&u.running, 0)
+}
+
+// Upload puts the file into the upload queue, if the queue is full, the file is uploaded at the next retry
+func (u *S3Uploader) Upload(path string) {
+	select {
+	case u.files <- path:
+	default:
+		atomic.AddInt64(&u.counter.UploadDropCounter, 1)
+		u.overflowLock.Lock()
+		u.overflow = append(u.overflow, path)
+		u.overflowLock.Unlock()
+	}
+}
+
+func (u *S3Uploader) takeOverflow() []string {
+	u.overflowLock.Lock()
+	defer u.overflowLock.Unlock()
+	overflow := u.overflow
+	u.overflow = nil
+	return overflow
+}
+
+func (u *S3Uploader) run() {
+	ticker := time.NewTicker(UPLOAD_RETRY_INTERVAL)
+	defer ticker.Stop()
+	for atomic.LoadInt32(&u.running) == 1 {
+		select {
+		case path := <-u.files:
+			if err := u.uploadFile(path); err != nil {
+				log.Warningf("upload archive file %s failed: %s", path, err)
+				u.pending = append(u.pending, path)
+			}
+		case <-ticker.C:
+			pending := append(u.pending, u.takeOverflow()...)
+			u.pending = nil
+			for i, path := range pending {
+				if atomic.LoadInt32(&u.running) == 0 {
+					u.pending = append(u.pending, pending[i:]...)
+					break
+				}
+				if err := u.uploadFile(path); err != nil {
+					u.pending = append(u.pending, path)
+				}
+			}
+		}
+	}
+}
+
+func (u *S3Uploader) uploadFile(path string) error {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	rel, err := filepath.Rel(u.dir, path)
+	if err != nil {
+		return err
+	}
+	key := filepath.ToSlash(rel)
+	if u.cfg.Prefix != "" {
+		key = u.cfg.Prefix + "/" + key
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(u.cfg.Timeout)*time.Second)
+	defer cancel()
+	if err := u.PutObject(ctx, key, body); err != nil {
+		atomic.AddInt64(&u.counter.UploadFailedCounter, 1)
+		return err
+	}
+	atomic.AddInt64(&u.counter.UploadCounter, 1)
+	atomic.AddInt64(&u.counter.UploadBytes, int64(len(body)))
+	if !u.cfg.KeepLocal {
+		if err := os.Remove(path); err != nil {
+			log.Warningf("remove uploaded archive file %s failed: %s", path, err)
+		}
+	}
+	return nil
+}
+
+func (u *S3Uploader) objectURL(key string) (string, error) {
+	endpoint, err := url.Parse(u.cfg.Endpoint)
+	if err != nil {
+		return "", err
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return "", fmt.Errorf("invalid s3 endpoint %s", u.cfg.Endpoint)
+	}
+	key = escapeObjectKey(key)
+	if u.cfg.ForcePathStyle {
+		return fmt.Sprintf("%s://%s/%s/%s", endpoint.Scheme, endpoint.Host, u.cfg.Bucket, key), nil
+	}
+	return fmt.Sprintf("%s://%s.%s/%s", endpoint.Scheme, u.cfg.Bucket, endpoint.Host, key), nil
+}
+
+// escapeObjectKey escapes the object key as the canonical URI of AWS signature version 4, all the characters
+// except the unreserved characters and '/' are escaped, e.g. the '=' of hive partitions is escaped as '%3D'.
+// The escaped key is sent and signed as it is, so that the signature matches the one calculated by S3.
+func escapeObjectKey(key string) string {
+	var sb strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~' || c == '/' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+// PutObject uploads the object with AWS signature version 4
+func (u *S3Uploader) PutObject(ctx context.Context, key string, body []byte) error {
+	objectURL, err := u.objectURL(key)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	req.Header.Set("Content-Type", contentType(key))
+	req.ContentLength = int64(len(body))
+
+	credentials := aws.Credentials{AccessKeyID: u.cfg.AccessKey, SecretAccessKey: u.cfg.SecretKey}
+	if err := u.signer.SignHTTP(ctx, credentials, req, payloadHash, "s3", u.cfg.Region, time.Now()); err != nil {
+		return err
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("put object %s failed, status code: %d, response: %s", key, resp.StatusCode, msg)
+	}
+	return nil
+}
+
+func contentType(key string) string {
+	switch {
+	case strings.HasSuffix(key, ".gz"):
+		return "application/gzip"
+	case strings.HasSuffix(key, JSONL_SUFFIX):
+		return "application/x-ndjson"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// scanArchiveFiles returns the closed archive files under the dir, the '.tmp' files being written are skipped
+func scanArchiveFiles(dir string) []string {
+	files := []string{}
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasSuffix(path, TMP_SUFFIX) {
+			return nil
+		}
+		if strings.HasSuffix(path, JSONL_SUFFIX) || strings.HasSuffix(path, JSONL_SUFFIX+GZIP_SUFFIX) || strings.HasSuffix(path, PARQUET_SUFFIX) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
@@ -77,14 +77,70 @@ func GetFunc(funcName string) interface{} {
 	return funcMaps[funcName]
 }
 
-func writeK8sLabels(sb *strings.Builder, keyName, valueName string, k8sLabels utag.Labels) {
-	if len(k8sLabels) == 0 {
-		return
+// FieldEncoder receives the exported fields which are selected and translated by EncodeFields
+type FieldEncoder interface {
+	EncodeString(key, value string)
+	EncodeFloat64(key string, value float64, valueStr string)
+	EncodeStringSlice(key string, value []string)
+	EncodeFloat64Slice(key string, value []float64)
+	EncodeK8sLabels(keyName, valueName string, k8sLabels utag.Labels)
+}
+
+type jsonEncoder struct {
+	sb *strings.Builder
+}
+
+func (e jsonEncoder) writeKey(key string) {
+	if e.sb.Len() > 1 {
+		e.sb.WriteString(`,`)
+	}
+	e.sb.WriteString(`"`)
+	e.sb.WriteString(key)
+	e.sb.WriteString(`":`)
+}
+
+func (e jsonEncoder) EncodeString(key, value string) {
+	e.writeKey(key)
+	e.sb.WriteString(`"`)
+	utils.EscapeJsonStringToStringBuilder(e.sb, value)
+	e.sb.WriteString(`"`)
+}
+
+func (e jsonEncoder) EncodeFloat64(key string, value float64, valueStr string) {
+	e.writeKey(key)
+	e.sb.WriteString(valueStr)
+}
+
+func (e jsonEncoder) EncodeStringSlice(key string, value []string) {
+	e.writeKey(key)
+	e.sb.WriteString("[")
+	for i, v := range value {
+		if i != 0 {
+			e.sb.WriteString(`,`)
+		}
+		e.sb.WriteString(`"`)
+		e.sb.WriteString(v)
+		e.sb.WriteString(`"`)
+	}
+	e.sb.WriteString("]")
+}
+
+func (e jsonEncoder) EncodeFloat64Slice(key string, value []float64) {
+	e.writeKey(key)
+	e.sb.WriteString("[")
+	for i, v := range value {
+		if i != 0 {
+			e.sb.WriteString(`,`)
+		}
+		e.sb.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
 	}
+	e.sb.WriteString("]")
+}
+
+func (e jsonEncoder) EncodeK8sLabels(keyName, valueName string, k8sLabels utag.Labels) {
 	valuesBuilder := &strings.Builder{}
-	sb.WriteString(`,"`)
-	sb.WriteString(keyName)
-	sb.WriteString(`":[`)
+	e.writeKey(keyName)
+	e.sb.WriteString(`[`)
 
 	valuesBuilder.WriteString(`,"`)
 	valuesBuilder.WriteString(valueName)
@@ -93,34 +149,90 @@ func writeK8sLabels(sb *strings.Builder, keyName, valueName string, k8sLabels ut
 	isFirst := true
 	for key, value := range k8sLabels {
 		if !isFirst {
-			sb.WriteString(`,`)
+			e.sb.WriteString(`,`)
 			valuesBuilder.WriteString(`,`)
 		}
 		isFirst = false
-		sb.WriteString(`"`)
-		sb.WriteString(key)
-		sb.WriteString(`"`)
+		e.sb.WriteString(`"`)
+		e.sb.WriteString(key)
+		e.sb.WriteString(`"`)
 
 		valuesBuilder.WriteString(`"`)
 		valuesBuilder.WriteString(value)
 		valuesBuilder.WriteString(`"`)
 
 	}
-	sb.WriteString(`]`)
+	e.sb.WriteString(`]`)
 	valuesBuilder.WriteString(`]`)
 
-	sb.WriteString(valuesBuilder.String())
+	e.sb.WriteString(valuesBuilder.String())
 }
 
 func EncodeToJson(item EncodeItem, dataSourceId int, exporterCfg *config.ExporterCfg, uTags0, uTags1 *utag.UniversalTags, k8sLabels0, k8sLabels1 utag.Labels) string {
 	var sb = &strings.Builder{}
-	sb.WriteString("{\"datasource\":\"")
-	sb.WriteString(config.DataSourceID(dataSourceId).String())
-	sb.WriteString(`"`)
+	sb.WriteString("{")
+	if !EncodeFields(item, dataSourceId, exporterCfg, uTags0, uTags1, k8sLabels0, k8sLabels1, jsonEncoder{sb}) {
+		return ""
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+// EncodeToKafka encodes the item for PROTOCOL_KAFKA, returns *ExportFields for the avro format of kafka exporter,
+// otherwise returns the json string
+func EncodeToKafka(item EncodeItem, dataSourceId int, exporterCfg *config.ExporterCfg, uTags0, uTags1 *utag.UniversalTags, k8sLabels0, k8sLabels1 utag.Labels) interface{} {
+	if exporterCfg.ExportProtocol == config.PROTOCOL_KAFKA && exporterCfg.Format == config.KAFKA_FORMAT_AVRO {
+		fields := &ExportFields{}
+		if !EncodeFields(item, dataSourceId, exporterCfg, uTags0, uTags1, k8sLabels0, k8sLabels1, fields) {
+			return nil
+		}
+		return fields
+	}
+	return EncodeToJson(item, dataSourceId, exporterCfg, uTags0, uTags1, k8sLabels0, k8sLabels1)
+}
+
+// ExportField is the exported field selected by EncodeFields
+type ExportField struct {
+	Key      string
+	Value    interface{} // string, float64, []string or []float64
+	ValueStr string      // the string of float64 value, keeps the precision of integers
+}
+
+// ExportFields collects the exported fields, used by the formats encoding from the fields directly instead of json
+type ExportFields []ExportField
+
+func (f *ExportFields) EncodeString(key, value string) {
+	*f = append(*f, ExportField{Key: key, Value: value})
+}
+
+func (f *ExportFields) EncodeFloat64(key string, value float64, valueStr string) {
+	*f = append(*f, ExportField{Key: key, Value: value, ValueStr: valueStr})
+}
+
+func (f *ExportFields) EncodeStringSlice(key string, value []string) {
+	*f = append(*f, ExportField{Key: key, Value: value})
+}
+
+func (f *ExportFields) EncodeFloat64Slice(key string, value []float64) {
+	*f = append(*f, ExportField{Key: key, Value: value})
+}
+
+func (f *ExportFields) EncodeK8sLabels(keyName, valueName string, k8sLabels utag.Labels) {
+	names, values := make([]string, 0, len(k8sLabels)), make([]string, 0, len(k8sLabels))
+	for key, value := range k8sLabels {
+		names = append(names, key)
+		values = append(values, value)
+	}
+	*f = append(*f, ExportField{Key: keyName, Value: names}, ExportField{Key: valueName, Value: values})
+}
+
+// EncodeFields selects and translates the exported fields of the item, returns false if the data source is invalid
+func EncodeFields(item EncodeItem, dataSourceId int, exporterCfg *config.ExporterCfg, uTags0, uTags1 *utag.UniversalTags, k8sLabels0, k8sLabels1 utag.Labels, enc FieldEncoder) bool {
+	enc.EncodeString("datasource", config.DataSourceID(dataSourceId).String())
 
 	if dataSourceId >= int(config.MAX_DATASOURCE_ID) {
 		log.Errorf("export datasource wrong: datasourceid %d ", dataSourceId)
-		return ""
+		return false
 	}
 
 	isMapItem := config.DataSourceID(dataSourceId).IsMap()
@@ -199,51 +311,30 @@ func EncodeToJson(item EncodeItem, dataSourceId int, exporterCfg *config.Exporte
 			continue
 		}
 
-		sb.WriteString(`,"`)
-		sb.WriteString(keyStr)
-		sb.WriteString(`":`)
 		if isString {
-			sb.WriteString(`"`)
-			utils.EscapeJsonStringToStringBuilder(sb, valueStr)
-			sb.WriteString(`"`)
+			enc.EncodeString(keyStr, valueStr)
 		} else if isStringSlice {
-			sb.WriteString("[")
-			for i, v := range stringSlice {
-				if i != 0 {
-					sb.WriteString(`,`)
-				}
-				sb.WriteString(`"`)
-				sb.WriteString(v)
-				sb.WriteString(`"`)
-			}
-			sb.WriteString("]")
+			enc.EncodeStringSlice(keyStr, stringSlice)
 		} else if isFloat64Slice {
-			sb.WriteString("[")
-			for i, v := range float64Slice {
-				if i != 0 {
-					sb.WriteString(`,`)
-				}
-				sb.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
-			}
-			sb.WriteString("]")
+			enc.EncodeFloat64Slice(keyStr, float64Slice)
 		} else if isFloat64 {
-			sb.WriteString(valueStr)
+			enc.EncodeFloat64(keyStr, valueFloat64, valueStr)
 		} else {
 			log.Warningf("unreachable")
 		}
 	}
 
 	if isMapItem {
-		writeK8sLabels(sb, "k8s_label_names_0", "k8s_label_values_0", k8sLabels0)
-		writeK8sLabels(sb, "k8s_label_names_1", "k8s_label_values_1", k8sLabels1)
-	} else {
-		writeK8sLabels(sb, "k8s_label_names", "k8s_label_values", k8sLabels0)
+		if len(k8sLabels0) > 0 {
+			enc.EncodeK8sLabels("k8s_label_names_0", "k8s_label_values_0", k8sLabels0)
+		}
+		if len(k8sLabels1) > 0 {
+			enc.EncodeK8sLabels("k8s_label_names_1", "k8s_label_values_1", k8sLabels1)
+		}
+	} else if len(k8sLabels0) > 0 {
+		enc.EncodeK8sLabels("k8s_label_names", "k8s_label_values", k8sLabels0)
 	}
 
-	sb.WriteString(`,"time_str":"`)
-	sb.WriteString(time.UnixMicro(item.TimestampUs()).String())
-	sb.WriteString(`"`)
-
-	sb.WriteString("}")
-	return sb.String()
+	enc.EncodeString("time_str", time.UnixMicro(item.TimestampUs()).String())
+	return true
 }
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package common
+
+import (
+	"go.opentelemetry.io/collector/pdata/pcommon"
+
+	"github.com/deepflowio/deepflow/server/ingester/exporters/config"
+	utag "github.com/deepflowio/deepflow/server/ingester/exporters/universal_tag"
+)
+
+func PutStrWithoutEmpty(attrs pcommon.Map, key, value string) {
+	if value != "" {
+		attrs.PutStr(key, value)
+	}
+}
+
+func PutUniversalTags(attrs pcommon.Map, tags *utag.UniversalTags, dataTypeBits uint64) {
+	if tags == nil || dataTypeBits&config.UNIVERSAL_TAG == 0 {
+		return
+	}
+	RangeUniversalTags(tags, func(name, value string) {
+		attrs.PutStr("df.universal_tag."+name, value)
+	})
+}
+
+func PutK8sLabels(attrs pcommon.Map, labels utag.Labels, dataTypeBits uint64) {
+	if dataTypeBits&config.K8S_LABEL == 0 {
+		return
+	}
+	for name, value := range labels {
+		PutStrWithoutEmpty(attrs, "df.custom_tag.k8s.labels."+name, value)
+	}
+}
+
+// PutAttributes puts the native tags (attribute_names/attribute_values) into the otlp attributes
+func PutAttributes(attrs pcommon.Map, names, values []string, dataTypeBits uint64) {
+	if dataTypeBits&config.NATIVE_TAG == 0 || len(names) != len(values) {
+		return
+	}
+	for i := range names {
+		PutStrWithoutEmpty(attrs, names[i], values[i])
+	}
+}
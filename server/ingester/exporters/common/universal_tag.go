@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package common
+
+import (
+	"strings"
+
+	utag "github.com/deepflowio/deepflow/server/ingester/exporters/universal_tag"
+)
+
+// the universal tags of single side data sources(app_log, ext_metrics, etc.) have no '_0/_1' suffix
+var singleSideUniversalTags = []struct {
+	id   uint8
+	name string
+}{
+	{utag.Region, "region"},
+	{utag.AZ, "az"},
+	{utag.Host, "host"},
+	{utag.L3Epc, "vpc"},
+	{utag.Subnet, "subnet"},
+	{utag.PodCluster, "pod_cluster"},
+	{utag.PodNS, "pod_ns"},
+	{utag.PodNode, "pod_node"},
+	{utag.PodGroup, "pod_group"},
+	{utag.Pod, "pod"},
+	{utag.Service, "service"},
+	{utag.GProcess, "gprocess"},
+	{utag.Vtap, "agent"},
+	{utag.CHost, "chost"},
+	{utag.Router, "router"},
+	{utag.DhcpGW, "dhcpgw"},
+	{utag.PodService, "pod_service"},
+	{utag.Redis, "redis"},
+	{utag.RDS, "rds"},
+	{utag.LB, "lb"},
+	{utag.NatGW, "natgw"},
+	{utag.AutoInstanceType, "auto_instance_type"},
+	{utag.AutoInstance, "auto_instance"},
+	{utag.AutoServiceType, "auto_service_type"},
+	{utag.AutoService, "auto_service"},
+}
+
+// RangeUniversalTags calls f for every universal tag which is not empty
+func RangeUniversalTags(tags *utag.UniversalTags, f func(name, value string)) {
+	if tags == nil {
+		return
+	}
+	for _, t := range singleSideUniversalTags {
+		if tags[t.id] != "" {
+			f(t.name, tags[t.id])
+		}
+	}
+}
+
+// SanitizePrometheusName replaces the characters which are not allowed in prometheus metric and label names by '_'
+// refer to: https://prometheus.io/docs/concepts/data_model/#metric-names-and-labels
+func SanitizePrometheusName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, name)
+}
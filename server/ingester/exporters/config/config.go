@@ -43,6 +43,21 @@ const (
 	DefaultExportOtlpBatchSize  = 32
 	DefaultExportOtherBatchSize = 1024
 	SecurityProtocol            = "SASL_SSL"
+	SecurityProtocolPlaintext   = "SASL_PLAINTEXT"
+
+	DefaultRemoteWriteMaxRetries = 3
+	DefaultRemoteWriteMinBackoff = 30   // ms
+	DefaultRemoteWriteMaxBackoff = 5000 // ms
+	DefaultRemoteWriteTimeout    = 30   // s
+
+	DefaultSchemaRegistryTimeout = 10 // s
+
+	DefaultArchiveDir         = "/var/lib/deepflow/archive"
+	DefaultArchiveMaxFileSize = 256 // MB
+	DefaultArchiveMaxFileRows = 100000
+	DefaultArchiveBufferSize  = 64 // MB, parquet rows are buffered in memory until the file is closed
+	DefaultArchiveCloseDelay  = 60 // s
+	DefaultArchiveS3Timeout   = 60 // s
 
 	CATEGORY_K8S_LABEL = "$k8s.label"
 	CATEGORY_TAG       = "$tag"
@@ -69,6 +84,13 @@ const (
 	PERF_EVENT = DataSourceID(flow_metrics.METRICS_TABLE_ID_MAX) + 1 + iota
 	L4_FLOW_LOG
 	L7_FLOW_LOG
+	APPLICATION_LOG
+	RESOURCE_EVENT
+	K8S_EVENT
+	ALERT_EVENT
+	EXT_METRICS
+	PROMETHEUS
+	PROFILE
 
 	MAX_DATASOURCE_ID
 )
@@ -85,6 +107,13 @@ var dataSourceStrings = []string{
 	PERF_EVENT:         "event.perf_event",
 	L4_FLOW_LOG:        "flow_log.l4_flow_log",
 	L7_FLOW_LOG:        "flow_log.l7_flow_log",
+	APPLICATION_LOG:    "application_log.log",
+	RESOURCE_EVENT:     "event.resource_event",
+	K8S_EVENT:          "event.k8s_event",
+	ALERT_EVENT:        "event.alert_event",
+	EXT_METRICS:        "ext_metrics.metrics",
+	PROMETHEUS:         "prometheus.samples",
+	PROFILE:            "profile.in_process",
 	MAX_DATASOURCE_ID:  "invalid_datasource",
 }
 
@@ -100,6 +129,13 @@ var dataSourceTopicStrings = []string{
 	PERF_EVENT:         TOPIC_PREFIX + dataSourceStrings[PERF_EVENT],
 	L4_FLOW_LOG:        TOPIC_PREFIX + dataSourceStrings[L4_FLOW_LOG],
 	L7_FLOW_LOG:        TOPIC_PREFIX + dataSourceStrings[L7_FLOW_LOG],
+	APPLICATION_LOG:    TOPIC_PREFIX + dataSourceStrings[APPLICATION_LOG],
+	RESOURCE_EVENT:     TOPIC_PREFIX + dataSourceStrings[RESOURCE_EVENT],
+	K8S_EVENT:          TOPIC_PREFIX + dataSourceStrings[K8S_EVENT],
+	ALERT_EVENT:        TOPIC_PREFIX + dataSourceStrings[ALERT_EVENT],
+	EXT_METRICS:        TOPIC_PREFIX + dataSourceStrings[EXT_METRICS],
+	PROMETHEUS:         TOPIC_PREFIX + dataSourceStrings[PROMETHEUS],
+	PROFILE:            TOPIC_PREFIX + dataSourceStrings[PROFILE],
 	MAX_DATASOURCE_ID:  TOPIC_PREFIX + dataSourceStrings[MAX_DATASOURCE_ID],
 }
 
@@ -145,7 +181,8 @@ func (d DataSourceID) TopicString() string {
 
 func (d DataSourceID) IsMap() bool {
 	switch d {
-	case NETWORK_1M, APPLICATION_1M, NETWORK_1S, APPLICATION_1S, PERF_EVENT:
+	case NETWORK_1M, APPLICATION_1M, NETWORK_1S, APPLICATION_1S, PERF_EVENT,
+		APPLICATION_LOG, RESOURCE_EVENT, K8S_EVENT, ALERT_EVENT, EXT_METRICS, PROMETHEUS, PROFILE:
 		return false
 	default:
 		return true
@@ -471,32 +508,291 @@ type ExporterCfg struct {
 	ExportFieldStructTags      [MAX_DATASOURCE_ID][]StructTags   // gen by `ExportFields` and init when exporting item first time
 	TagFiltersStructTags       [MAX_DATASOURCE_ID][]StructTags   // gen by `TagFilters`  and init when exporting item first time
 	TagFiltersGroupsStructTags [MAX_DATASOURCE_ID][][]StructTags // gen by `TagFiltersGroups` and init when exporting item first time
+	PartitionKeyStructTags     [MAX_DATASOURCE_ID][]StructTags   // gen by `PartitionKey` and init when exporting item first time
 
 	// private configuration
 	ExtraHeaders map[string]string `yaml:"extra-headers"`
 
+	// prometheus private configuration
+	LabelMapping map[string]string `yaml:"label-mapping"` // rename the labels of time series, the label is dropped if the new name is empty
+	RemoteWrite  RemoteWrite       `yaml:"remote-write"`
+
 	// kafka private configuration
-	Sasl  Sasl   `yaml:"sasl"`
-	Topic string `yaml:"topic"`
+	Sasl           Sasl           `yaml:"sasl"`
+	Tls            Tls            `yaml:"tls"`
+	Topic          string         `yaml:"topic"`
+	Format         string         `yaml:"format"`          // 'json', 'protobuf' or 'avro'
+	SchemaRegistry SchemaRegistry `yaml:"schema-registry"` // required by 'avro'
+	PartitionKey   string         `yaml:"partition-key"`   // the field name as the message key, e.g.: trace_id, pod
+
+	// archive private configuration
+	Archive Archive `yaml:"archive"`
 }
 
 type Sasl struct {
 	Enabled          bool   `yaml:"enabled"`
-	SecurityProtocol string `yaml:"security-protocol"` // only support 'SASL_SSL'
-	Mechanism        string `yaml:"sasl-mechanism"`    // only support 'PLAIN'
+	SecurityProtocol string `yaml:"security-protocol"` // 'SASL_SSL' or 'SASL_PLAINTEXT', TLS is enabled implicitly for 'SASL_SSL' if 'tls.enabled' is not configured
+	Mechanism        string `yaml:"sasl-mechanism"`    // 'PLAIN', 'SCRAM-SHA-256' or 'SCRAM-SHA-512'
 	Username         string `yaml:"username"`
 	Password         string `yaml:"password"`
 }
 
-func (s *Sasl) Validate() error {
+func (s *Sasl) Validate(tls *Tls) error {
 	if !s.Enabled {
 		return nil
 	}
-	if s.SecurityProtocol != SecurityProtocol {
-		log.Warningf("'sasl-protocol' only support value %s", SecurityProtocol)
+	explicitProtocol := s.SecurityProtocol != ""
+	if s.SecurityProtocol == "" {
+		s.SecurityProtocol = SecurityProtocol
+	}
+	if s.Mechanism == "" {
+		s.Mechanism = sarama.SASLTypePlaintext
+	}
+	switch s.SecurityProtocol {
+	case SecurityProtocol:
+		if tls.Enabled {
+			break
+		}
+		// the credentials should not be sent without encryption, only the explicit conflict is rejected
+		// to keep the configurations of the old versions working
+		if !tls.enabledSet {
+			log.Warningf("'security-protocol' is %s but 'tls' is not configured, enable tls implicitly", SecurityProtocol)
+			tls.Enabled = true
+		} else if explicitProtocol {
+			return fmt.Errorf("'security-protocol' %s conflicts with 'tls.enabled: false', use %s explicitly", SecurityProtocol, SecurityProtocolPlaintext)
+		} else {
+			log.Warningf("'tls.enabled' is false, use 'security-protocol' %s, the credentials are sent without encryption", SecurityProtocolPlaintext)
+			s.SecurityProtocol = SecurityProtocolPlaintext
+		}
+	case SecurityProtocolPlaintext:
+	default:
+		return fmt.Errorf("'security-protocol' only support value %s, %s", SecurityProtocol, SecurityProtocolPlaintext)
+	}
+	switch s.Mechanism {
+	case sarama.SASLTypePlaintext, sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512:
+	default:
+		return fmt.Errorf("'sasl-mechanism' only support value %s, %s, %s", sarama.SASLTypePlaintext, sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512)
+	}
+	return nil
+}
+
+type Tls struct {
+	Enabled            bool   `yaml:"enabled"`
+	CaFile             string `yaml:"ca-file"`   // use the system CAs if empty
+	CertFile           string `yaml:"cert-file"` // client certificate
+	KeyFile            string `yaml:"key-file"`
+	ServerName         string `yaml:"server-name"`
+	InsecureSkipVerify bool   `yaml:"insecure-skip-verify"`
+
+	enabledSet bool // whether 'enabled' is configured, TLS is enabled implicitly for SASL_SSL if not
+}
+
+func (t *Tls) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Tls
+	var enabled struct {
+		Enabled *bool `yaml:"enabled"`
+	}
+	if err := unmarshal(&enabled); err != nil {
+		return err
+	}
+	if err := unmarshal((*plain)(t)); err != nil {
+		return err
+	}
+	t.enabledSet = enabled.Enabled != nil
+	return nil
+}
+
+func (t *Tls) Validate() error {
+	if !t.Enabled {
+		return nil
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("tls 'cert-file' and 'key-file' should be configured together")
+	}
+	return nil
+}
+
+// SchemaRegistry is the confluent compatible schema registry, the avro schemas are registered
+// with the subject '<topic>-value'
+type SchemaRegistry struct {
+	Url      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Timeout  int    `yaml:"timeout"` // s
+}
+
+const (
+	KAFKA_FORMAT_JSON     = "json"
+	KAFKA_FORMAT_PROTOBUF = "protobuf" // OTLP protobuf, same as 'otlp_proto' encoding of opentelemetry collector kafka receiver
+	KAFKA_FORMAT_AVRO     = "avro"     // confluent wire format: magic byte 0, 4 bytes schema id, avro binary
+)
+
+// otlpDataSources are the datasources which can be encoded as otlp, used by the kafka protobuf format
+var otlpDataSources = []DataSourceID{L7_FLOW_LOG, APPLICATION_LOG, EXT_METRICS, PROMETHEUS}
+
+func (cfg *ExporterCfg) validateKafka() error {
+	if err := cfg.Tls.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.Sasl.Validate(&cfg.Tls); err != nil {
+		return err
+	}
+	if cfg.Format == "" {
+		cfg.Format = KAFKA_FORMAT_JSON
+	}
+	switch cfg.Format {
+	case KAFKA_FORMAT_JSON:
+	case KAFKA_FORMAT_PROTOBUF:
+		for _, dataSource := range cfg.DataSources {
+			id, err := ToDataSourceID(dataSource)
+			if err != nil {
+				continue
+			}
+			supported := false
+			for _, otlpDataSource := range otlpDataSources {
+				if id == otlpDataSource {
+					supported = true
+					break
+				}
+			}
+			if !supported {
+				return fmt.Errorf("datasource %s does not support kafka format %s, use %s or %s instead", dataSource, KAFKA_FORMAT_PROTOBUF, KAFKA_FORMAT_JSON, KAFKA_FORMAT_AVRO)
+			}
+		}
+	case KAFKA_FORMAT_AVRO:
+		if cfg.SchemaRegistry.Url == "" {
+			return fmt.Errorf("'schema-registry.url' is required by kafka format %s", KAFKA_FORMAT_AVRO)
+		}
+		cfg.SchemaRegistry.Url = strings.TrimSuffix(cfg.SchemaRegistry.Url, "/")
+		if cfg.SchemaRegistry.Timeout <= 0 {
+			cfg.SchemaRegistry.Timeout = DefaultSchemaRegistryTimeout
+		}
+	default:
+		return fmt.Errorf("unsupport kafka format %s, support formats %s, %s, %s", cfg.Format, KAFKA_FORMAT_JSON, KAFKA_FORMAT_PROTOBUF, KAFKA_FORMAT_AVRO)
+	}
+	return nil
+}
+
+// RemoteWrite is the retry configuration of the prometheus remote-write client.
+// Requests which fail with network errors, 429 or 5xx are retried with exponential backoff,
+// other 4xx errors are not recoverable and dropped directly.
+type RemoteWrite struct {
+	MaxRetries int `yaml:"max-retries"`
+	MinBackoff int `yaml:"min-backoff"` // ms
+	MaxBackoff int `yaml:"max-backoff"` // ms
+	Timeout    int `yaml:"timeout"`     // s, timeout of each request
+}
+
+func (r *RemoteWrite) Validate(protocol ExportProtocol) {
+	// for compatibility, the 'prometheus' protocol does not retry by default
+	if r.MaxRetries == 0 && protocol == PROTOCOL_PROMETHEUS_REMOTE_WRITE {
+		r.MaxRetries = DefaultRemoteWriteMaxRetries
+	}
+	if r.MaxRetries < 0 {
+		r.MaxRetries = 0
+	}
+	if r.MinBackoff <= 0 {
+		r.MinBackoff = DefaultRemoteWriteMinBackoff
+	}
+	if r.MaxBackoff < r.MinBackoff {
+		r.MaxBackoff = DefaultRemoteWriteMaxBackoff
+		if r.MaxBackoff < r.MinBackoff {
+			r.MaxBackoff = r.MinBackoff
+		}
+	}
+	if r.Timeout <= 0 {
+		r.Timeout = DefaultRemoteWriteTimeout
+	}
+}
+
+const (
+	ARCHIVE_FORMAT_JSONL   = "jsonl"
+	ARCHIVE_FORMAT_PARQUET = "parquet"
+
+	ARCHIVE_COMPRESSION_NONE   = "none"
+	ARCHIVE_COMPRESSION_GZIP   = "gzip"
+	ARCHIVE_COMPRESSION_SNAPPY = "snappy"
+)
+
+// Archive writes the data to local files partitioned by data source, org and hour:
+//
+//	<dir>/datasource=<data source>/org_id=<org id>/date=<YYYY-MM-DD>/hour=<HH>/part-<queue>-<unix nano>.<jsonl[.gz]|parquet>
+//
+// the files being written have the suffix '.tmp', and are uploaded to S3 after closed if S3 is enabled.
+type Archive struct {
+	Format      string    `yaml:"format"` // 'jsonl' or 'parquet'
+	Dir         string    `yaml:"dir"`
+	Compression string    `yaml:"compression"`   // jsonl: 'gzip' or 'none', parquet: 'snappy', 'gzip' or 'none'
+	MaxFileSize int       `yaml:"max-file-size"` // MB, rotate the file when exceeded
+	MaxFileRows int       `yaml:"max-file-rows"` // rotate the file when exceeded
+	BufferSize  int       `yaml:"buffer-size"`   // MB, parquet only, the file buffering the most rows is closed when the rows buffered by a queue exceed it
+	CloseDelay  int       `yaml:"close-delay"`   // s, the file of the past hour is closed after the delay, to wait for the late data
+	S3          ArchiveS3 `yaml:"s3"`
+}
+
+// ArchiveS3 uploads the closed files to a S3 compatible object storage (AWS S3, MinIO, etc.),
+// the object key is '<prefix>/<the path relative to archive dir>'.
+type ArchiveS3 struct {
+	Enabled        bool   `yaml:"enabled"`
+	Endpoint       string `yaml:"endpoint"` // e.g. 'https://s3.us-east-1.amazonaws.com', 'http://minio:9000'
+	Region         string `yaml:"region"`
+	Bucket         string `yaml:"bucket"`
+	Prefix         string `yaml:"prefix"`
+	AccessKey      string `yaml:"access-key"`
+	SecretKey      string `yaml:"secret-key"`
+	ForcePathStyle bool   `yaml:"force-path-style"` // required by MinIO
+	KeepLocal      bool   `yaml:"keep-local"`       // keep the local files after uploaded
+	Timeout        int    `yaml:"timeout"`          // s
+}
+
+func (a *Archive) Validate() error {
+	if a.Format == "" {
+		a.Format = ARCHIVE_FORMAT_JSONL
+	}
+	switch a.Format {
+	case ARCHIVE_FORMAT_JSONL:
+		if a.Compression == "" {
+			a.Compression = ARCHIVE_COMPRESSION_GZIP
+		}
+		if a.Compression != ARCHIVE_COMPRESSION_GZIP && a.Compression != ARCHIVE_COMPRESSION_NONE {
+			return fmt.Errorf("archive format %s unsupport compression %s", a.Format, a.Compression)
+		}
+	case ARCHIVE_FORMAT_PARQUET:
+		if a.Compression == "" {
+			a.Compression = ARCHIVE_COMPRESSION_SNAPPY
+		}
+		if a.Compression != ARCHIVE_COMPRESSION_SNAPPY && a.Compression != ARCHIVE_COMPRESSION_GZIP && a.Compression != ARCHIVE_COMPRESSION_NONE {
+			return fmt.Errorf("archive format %s unsupport compression %s", a.Format, a.Compression)
+		}
+	default:
+		return fmt.Errorf("unsupport archive format %s, support formats %s, %s", a.Format, ARCHIVE_FORMAT_JSONL, ARCHIVE_FORMAT_PARQUET)
+	}
+	if a.Dir == "" {
+		a.Dir = DefaultArchiveDir
+	}
+	if a.MaxFileSize <= 0 {
+		a.MaxFileSize = DefaultArchiveMaxFileSize
+	}
+	if a.MaxFileRows <= 0 {
+		a.MaxFileRows = DefaultArchiveMaxFileRows
 	}
-	if s.Mechanism != sarama.SASLTypePlaintext {
-		log.Warningf("'sasl-mechanism' only support value %s", sarama.SASLTypePlaintext)
+	if a.CloseDelay <= 0 {
+		a.CloseDelay = DefaultArchiveCloseDelay
+	}
+	if a.BufferSize <= 0 {
+		a.BufferSize = DefaultArchiveBufferSize
+	}
+	if a.S3.Enabled {
+		if a.S3.Endpoint == "" || a.S3.Bucket == "" {
+			return fmt.Errorf("archive s3 'endpoint' and 'bucket' should not be empty")
+		}
+		if a.S3.Region == "" {
+			a.S3.Region = "us-east-1"
+		}
+		if a.S3.Timeout <= 0 {
+			a.S3.Timeout = DefaultArchiveS3Timeout
+		}
+		a.S3.Prefix = strings.Trim(a.S3.Prefix, "/")
 	}
 	return nil
 }
@@ -507,15 +803,21 @@ const (
 	PROTOCOL_OTLP ExportProtocol = iota
 	PROTOCOL_PROMETHEUS
 	PROTOCOL_KAFKA
+	// same encoding as PROTOCOL_PROMETHEUS, retries with backoff by default and normalizes the batch by the remote-write v1 spec
+	PROTOCOL_PROMETHEUS_REMOTE_WRITE
+	// write to local files (and S3), encoded as same as PROTOCOL_KAFKA
+	PROTOCOL_ARCHIVE
 
 	MAX_PROTOCOL_ID
 )
 
 var protocolToStrings = []string{
-	PROTOCOL_OTLP:       "opentelemetry",
-	PROTOCOL_PROMETHEUS: "prometheus",
-	PROTOCOL_KAFKA:      "kafka",
-	MAX_PROTOCOL_ID:     "unknown",
+	PROTOCOL_OTLP:                    "opentelemetry",
+	PROTOCOL_PROMETHEUS:              "prometheus",
+	PROTOCOL_KAFKA:                   "kafka",
+	PROTOCOL_PROMETHEUS_REMOTE_WRITE: "prometheus-remote-write",
+	PROTOCOL_ARCHIVE:                 "archive",
+	MAX_PROTOCOL_ID:                  "unknown",
 }
 
 func stringToExportProtocol(str string) ExportProtocol {
@@ -569,7 +871,17 @@ func (cfg *ExporterCfg) Validate() error {
 	}
 
 	cfg.TagFilterCondition.Validate()
-	cfg.Sasl.Validate()
+	cfg.RemoteWrite.Validate(cfg.ExportProtocol)
+	if cfg.ExportProtocol == PROTOCOL_KAFKA {
+		if err := cfg.validateKafka(); err != nil {
+			return err
+		}
+	}
+	if cfg.ExportProtocol == PROTOCOL_ARCHIVE {
+		if err := cfg.Archive.Validate(); err != nil {
+			return err
+		}
+	}
 
 	for i := range cfg.TagFiltersGroups {
 		cfg.TagFiltersGroups[i].Validate()
@@ -49,3 +49,101 @@ func TestConfig(t *testing.T) {
 		t.Logf("yaml unmarshal, got: %s", string(bytes))
 	}
 }
+
+func TestRemoteWriteValidate(t *testing.T) {
+	r := RemoteWrite{}
+	r.Validate(PROTOCOL_PROMETHEUS)
+	if r.MaxRetries != 0 || r.MinBackoff != DefaultRemoteWriteMinBackoff || r.MaxBackoff != DefaultRemoteWriteMaxBackoff {
+		t.Errorf("unexpected prometheus remote write config: %+v", r)
+	}
+
+	r = RemoteWrite{MinBackoff: 10000}
+	r.Validate(PROTOCOL_PROMETHEUS_REMOTE_WRITE)
+	if r.MaxRetries != DefaultRemoteWriteMaxRetries || r.MaxBackoff != 10000 || r.Timeout != DefaultRemoteWriteTimeout {
+		t.Errorf("unexpected prometheus-remote-write config: %+v", r)
+	}
+}
+
+func TestArchiveValidate(t *testing.T) {
+	a := Archive{Format: ARCHIVE_FORMAT_PARQUET}
+	if err := a.Validate(); err != nil || a.Compression != ARCHIVE_COMPRESSION_SNAPPY || a.Dir != DefaultArchiveDir {
+		t.Errorf("unexpected archive config: %+v, err: %v", a, err)
+	}
+
+	a = Archive{Compression: ARCHIVE_COMPRESSION_SNAPPY}
+	if err := a.Validate(); err == nil {
+		t.Errorf("jsonl should not support snappy compression")
+	}
+
+	a = Archive{S3: ArchiveS3{Enabled: true, Endpoint: "http://minio:9000"}}
+	if err := a.Validate(); err == nil {
+		t.Errorf("s3 bucket should not be empty")
+	}
+}
+
+func TestKafkaValidate(t *testing.T) {
+	cfg := ExporterCfg{Sasl: Sasl{Enabled: true, Mechanism: "SCRAM-SHA-512"}, Tls: Tls{Enabled: true}}
+	if err := cfg.validateKafka(); err != nil || cfg.Format != KAFKA_FORMAT_JSON || cfg.Sasl.SecurityProtocol != SecurityProtocol {
+		t.Errorf("unexpected kafka config: %+v, err: %v", cfg, err)
+	}
+
+	// tls 未配置时 SASL_SSL 隐式开启 tls，与旧版本配置兼容
+	cfg = ExporterCfg{Sasl: Sasl{Enabled: true, Mechanism: "SCRAM-SHA-512"}}
+	if err := cfg.validateKafka(); err != nil || !cfg.Tls.Enabled {
+		t.Errorf("SASL_SSL without tls config should enable tls, config: %+v, err: %v", cfg, err)
+	}
+
+	cases := []struct {
+		name     string
+		yaml     string
+		fail     bool
+		protocol string
+	}{
+		{"explicit SASL_SSL with tls disabled", "sasl: {enabled: true, security-protocol: SASL_SSL}\ntls: {enabled: false}", true, ""},
+		{"default protocol with tls disabled", "sasl: {enabled: true}\ntls: {enabled: false}", false, SecurityProtocolPlaintext},
+		{"explicit SASL_SSL without tls config", "sasl: {enabled: true, security-protocol: SASL_SSL}\ntls: {ca-file: ca.crt}", false, SecurityProtocol},
+	}
+	for _, c := range cases {
+		cfg = ExporterCfg{}
+		if err := yaml.Unmarshal([]byte(c.yaml), &cfg); err != nil {
+			t.Fatal(err)
+		}
+		err := cfg.validateKafka()
+		if c.fail != (err != nil) {
+			t.Errorf("%s: unexpected err: %v", c.name, err)
+		}
+		if !c.fail && cfg.Sasl.SecurityProtocol != c.protocol {
+			t.Errorf("%s: expect security protocol %s, got %s", c.name, c.protocol, cfg.Sasl.SecurityProtocol)
+		}
+	}
+
+	cfg = ExporterCfg{Sasl: Sasl{Enabled: true, SecurityProtocol: SecurityProtocolPlaintext}}
+	if err := cfg.validateKafka(); err != nil {
+		t.Errorf("SASL_PLAINTEXT without tls should pass, err: %s", err)
+	}
+
+	cfg = ExporterCfg{Sasl: Sasl{Enabled: true, Mechanism: "GSSAPI"}}
+	if err := cfg.validateKafka(); err == nil {
+		t.Errorf("GSSAPI should be unsupported")
+	}
+
+	cfg = ExporterCfg{Format: KAFKA_FORMAT_PROTOBUF, DataSources: []string{"flow_log.l7_flow_log", "application_log.log"}}
+	if err := cfg.validateKafka(); err != nil {
+		t.Errorf("protobuf with otlp datasources should pass, err: %s", err)
+	}
+
+	cfg = ExporterCfg{Format: KAFKA_FORMAT_PROTOBUF, DataSources: []string{"flow_log.l7_flow_log", "flow_metrics.network.1m"}}
+	if err := cfg.validateKafka(); err == nil {
+		t.Errorf("protobuf with flow metrics should fail")
+	}
+
+	cfg = ExporterCfg{Format: KAFKA_FORMAT_AVRO}
+	if err := cfg.validateKafka(); err == nil {
+		t.Errorf("avro without schema registry should fail")
+	}
+
+	cfg = ExporterCfg{Tls: Tls{Enabled: true, CertFile: "client.crt"}}
+	if err := cfg.validateKafka(); err == nil {
+		t.Errorf("tls cert without key should fail")
+	}
+}
@@ -22,6 +22,7 @@ import (
 
 	logging "github.com/op/go-logging"
 
+	"github.com/deepflowio/deepflow/server/ingester/exporters/archive_exporter"
 	"github.com/deepflowio/deepflow/server/ingester/exporters/common"
 	"github.com/deepflowio/deepflow/server/ingester/exporters/config"
 	"github.com/deepflowio/deepflow/server/ingester/exporters/enum_translation"
@@ -93,10 +94,12 @@ func NewExporters(cfg *config.Config) *Exporters {
 		switch exporterCfg.ExportProtocol {
 		case config.PROTOCOL_OTLP:
 			exporter = otlp_exporter.NewOtlpExporter(i, &cfg.Exporters[i], universalTagManager)
-		case config.PROTOCOL_PROMETHEUS:
+		case config.PROTOCOL_PROMETHEUS, config.PROTOCOL_PROMETHEUS_REMOTE_WRITE:
 			exporter = prometheus_exporter.NewPrometheusExporter(i, &cfg.Exporters[i], universalTagManager)
 		case config.PROTOCOL_KAFKA:
 			exporter = kafka_exporter.NewKafkaExporter(i, &cfg.Exporters[i], universalTagManager)
+		case config.PROTOCOL_ARCHIVE:
+			exporter = archive_exporter.NewArchiveExporter(i, &cfg.Exporters[i], universalTagManager)
 		default:
 			exporter = nil
 			log.Warningf("unsupport export protocol %s", exporterCfg.Protocol)
@@ -207,6 +210,17 @@ func IsExportField(tag *config.StructTags, exportFieldCategoryBits uint64, expor
 	return false
 }
 
+// IsPartitionKeyField matches the field name, or the key name of universal tag which the '_id' is removed, e.g.: 'pod' matches 'pod_id'
+func IsPartitionKeyField(tag *config.StructTags, partitionKey string) bool {
+	if partitionKey == "" || tag.Name == "" {
+		return false
+	}
+	if tag.Name == partitionKey || tag.MapName == partitionKey {
+		return true
+	}
+	return tag.UniversalTagMapID > 0 && strings.Replace(tag.Name, "_id", "", 1) == partitionKey
+}
+
 func (es *Exporters) initStructTags(item interface{}, dataSourceId uint32, exporterCfg *config.ExporterCfg) {
 	if exporterCfg.TagFiltersStructTags[dataSourceId] == nil {
 		t := reflect.TypeOf(item)
@@ -311,6 +325,7 @@ func (es *Exporters) initStructTags(item interface{}, dataSourceId uint32, expor
 		tagFiltersStructTags := []config.StructTags{}
 		tagFiltersGroupsStructTags := make([][]config.StructTags, len(exporterCfg.TagFiltersGroups))
 		exportFieldStructTags := []config.StructTags{}
+		partitionKeyStructTags := []config.StructTags{}
 		for _, structTag := range all {
 			if len(structTag.TagFilters) > 0 {
 				tagFiltersStructTags = append(tagFiltersStructTags, structTag)
@@ -323,10 +338,14 @@ func (es *Exporters) initStructTags(item interface{}, dataSourceId uint32, expor
 			if structTag.IsExportedField {
 				exportFieldStructTags = append(exportFieldStructTags, structTag)
 			}
+			if IsPartitionKeyField(&structTag, exporterCfg.PartitionKey) {
+				partitionKeyStructTags = append(partitionKeyStructTags, structTag)
+			}
 		}
 		exporterCfg.TagFiltersStructTags[dataSourceId] = tagFiltersStructTags
 		exporterCfg.TagFiltersGroupsStructTags[dataSourceId] = tagFiltersGroupsStructTags
 		exporterCfg.ExportFieldStructTags[dataSourceId] = exportFieldStructTags
+		exporterCfg.PartitionKeyStructTags[dataSourceId] = partitionKeyStructTags
 
 		dsid := config.DataSourceID(dataSourceId)
 		log.Infof("export protocol %s datasource %s, get all structTags: %+v", exporterCfg.Protocol, dsid.String(), all)
@@ -389,6 +408,11 @@ func (es *Exporters) getPutCache(dataSourceId, decoderId, exporterId int) *Expor
 	return &es.putCaches[(dataSourceId*queue.MAX_QUEUE_COUNT+decoderId)*MAX_EXPORTERS_PER_DATASOURCE+exporterId]
 }
 
+// IsDataSourceExported avoids building the export items of the data source which no exporter subscribes
+func (es *Exporters) IsDataSourceExported(dataSourceId uint32) bool {
+	return es != nil && len(es.dataSourceExporters[dataSourceId]) > 0
+}
+
 func (es *Exporters) Put(dataSourceId uint32, decoderIndex int, item common.ExportItem) {
 	if utils.IsNil(item) {
 		es.Flush(int(dataSourceId), decoderIndex)
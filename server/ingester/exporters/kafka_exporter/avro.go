@@ -0,0 +1,409 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka_exporter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/deepflowio/deepflow/server/ingester/exporters/common"
+	exporters_cfg "github.com/deepflowio/deepflow/server/ingester/exporters/config"
+)
+
+const (
+	AVRO_NAMESPACE = "io.deepflow.exporter"
+
+	// retry registering the schema after the interval if failed
+	SCHEMA_REGISTER_RETRY_INTERVAL = 10 * time.Second
+)
+
+type avroType uint8
+
+const (
+	avroString avroType = iota
+	avroLong
+	avroDouble
+	avroStringArray
+	// the type of field is unknown before encoding, union of long, double, string and array
+	avroAny
+)
+
+var avroTypeSchemas = []interface{}{
+	avroString:      []interface{}{"null", "string"},
+	avroLong:        []interface{}{"null", "long"},
+	avroDouble:      []interface{}{"null", "double"},
+	avroStringArray: []interface{}{"null", map[string]interface{}{"type": "array", "items": "string"}},
+	avroAny: []interface{}{"null", "long", "double", "string",
+		map[string]interface{}{"type": "array", "items": []string{"long", "double", "string"}}},
+}
+
+type avroField struct {
+	key  string // json key
+	name string // avro field name
+	typ  avroType
+}
+
+// avroSchema has the same fields as the json encoding of the data source, all fields are nullable
+type avroSchema struct {
+	fields []avroField
+	index  map[string]int // field index of json keys
+	schema string
+
+	ids        map[string]int32 // schema id of topics
+	lastFailed map[string]time.Time
+}
+
+// sanitizeAvroName replaces the characters which are not in [A-Za-z0-9_] with '_'
+func sanitizeAvroName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || (i > 0 && c >= '0' && c <= '9')) {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+func structTagAvroType(tag *exporters_cfg.StructTags, cfg *exporters_cfg.ExporterCfg) avroType {
+	if tag.ToStringFuncName != "" ||
+		(tag.UniversalTagMapID > 0 && !cfg.UniversalTagTranslateToNameDisabled) ||
+		(tag.EnumFile != "" && !cfg.EnumTranslateToNameDisabled) {
+		return avroString
+	}
+	switch tag.DataKind {
+	case reflect.String:
+		return avroString
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return avroLong
+	case reflect.Float32, reflect.Float64:
+		return avroDouble
+	default:
+		return avroAny
+	}
+}
+
+// newAvroSchema generates the schema by the exported fields, the field names are same as common.EncodeToJson
+func newAvroSchema(dataSourceId uint32, cfg *exporters_cfg.ExporterCfg) (*avroSchema, error) {
+	ds := exporters_cfg.DataSourceID(dataSourceId)
+	s := &avroSchema{
+		index:      make(map[string]int),
+		ids:        make(map[string]int32),
+		lastFailed: make(map[string]time.Time),
+	}
+	names := make(map[string]string)
+	addField := func(key string, typ avroType) error {
+		name := sanitizeAvroName(key)
+		if existed, ok := names[name]; ok {
+			if existed == key {
+				return nil
+			}
+			return fmt.Errorf("avro field name %s of %s conflicts with %s", name, key, existed)
+		}
+		names[name] = key
+		s.index[key] = len(s.fields)
+		s.fields = append(s.fields, avroField{key: key, name: name, typ: typ})
+		return nil
+	}
+
+	keys := []string{"datasource"}
+	types := []avroType{avroString}
+	for i := range cfg.ExportFieldStructTags[dataSourceId] {
+		tag := &cfg.ExportFieldStructTags[dataSourceId][i]
+		key := tag.Name
+		if ds.IsMap() && tag.MapName != "" {
+			key = tag.MapName
+		}
+		if tag.ToStringFuncName == "" && tag.UniversalTagMapID > 0 && !cfg.UniversalTagTranslateToNameDisabled {
+			key = strings.Replace(key, "_id", "", 1)
+		}
+		keys = append(keys, key)
+		types = append(types, structTagAvroType(tag, cfg))
+	}
+	if ds.IsMap() {
+		keys = append(keys, "k8s_label_names_0", "k8s_label_values_0", "k8s_label_names_1", "k8s_label_values_1")
+		types = append(types, avroStringArray, avroStringArray, avroStringArray, avroStringArray)
+	} else {
+		keys = append(keys, "k8s_label_names", "k8s_label_values")
+		types = append(types, avroStringArray, avroStringArray)
+	}
+	keys = append(keys, "time_str")
+	types = append(types, avroString)
+	for i, key := range keys {
+		if err := addField(key, types[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	fields := make([]map[string]interface{}, 0, len(s.fields))
+	for _, f := range s.fields {
+		fields = append(fields, map[string]interface{}{"name": f.name, "type": avroTypeSchemas[f.typ], "default": nil})
+	}
+	schema, err := json.Marshal(map[string]interface{}{
+		"type":      "record",
+		"name":      sanitizeAvroName(ds.String()),
+		"namespace": AVRO_NAMESPACE,
+		"fields":    fields,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.schema = string(schema)
+	return s, nil
+}
+
+func appendAvroLong(b []byte, v int64) []byte {
+	return binary.AppendVarint(b, v)
+}
+
+func appendAvroString(b []byte, v string) []byte {
+	b = appendAvroLong(b, int64(len(v)))
+	return append(b, v...)
+}
+
+func appendAvroDouble(b []byte, v float64) []byte {
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+}
+
+func avroLongValue(f *common.ExportField) int64 {
+	if i, err := strconv.ParseInt(f.ValueStr, 10, 64); err == nil {
+		return i
+	}
+	return int64(f.Value.(float64))
+}
+
+func toAvroString(f *common.ExportField) string {
+	switch v := f.Value.(type) {
+	case string:
+		return v
+	case float64:
+		return f.ValueStr
+	default:
+		s, _ := json.Marshal(v)
+		return string(s)
+	}
+}
+
+func appendAvroStrings(b []byte, items []string) []byte {
+	if len(items) > 0 {
+		b = appendAvroLong(b, int64(len(items)))
+		for _, item := range items {
+			b = appendAvroString(b, item)
+		}
+	}
+	return appendAvroLong(b, 0)
+}
+
+// appendAvroNumber appends the index of union ["long", "double"] and the value, the base is the index of "long"
+func appendAvroNumber(b []byte, v float64, valueStr string, base int64) []byte {
+	if i, err := strconv.ParseInt(valueStr, 10, 64); err == nil {
+		return appendAvroLong(appendAvroLong(b, base), i)
+	}
+	return appendAvroDouble(appendAvroLong(b, base+1), v)
+}
+
+func appendAvroValue(b []byte, typ avroType, f *common.ExportField) ([]byte, error) {
+	if f == nil {
+		return appendAvroLong(b, 0), nil
+	}
+	switch typ {
+	case avroString:
+		return appendAvroString(appendAvroLong(b, 1), toAvroString(f)), nil
+	case avroLong, avroDouble:
+		v, ok := f.Value.(float64)
+		if !ok {
+			return nil, fmt.Errorf("value %v is not number", f.Value)
+		}
+		if typ == avroLong {
+			return appendAvroLong(appendAvroLong(b, 1), avroLongValue(f)), nil
+		}
+		return appendAvroDouble(appendAvroLong(b, 1), v), nil
+	case avroStringArray:
+		switch v := f.Value.(type) {
+		case []string:
+			return appendAvroStrings(appendAvroLong(b, 1), v), nil
+		case []float64:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, strconv.FormatFloat(item, 'f', -1, 64))
+			}
+			return appendAvroStrings(appendAvroLong(b, 1), items), nil
+		default:
+			return nil, fmt.Errorf("value %v is not array", f.Value)
+		}
+	default:
+		switch v := f.Value.(type) {
+		case string:
+			return appendAvroString(appendAvroLong(b, 3), v), nil
+		case float64:
+			return appendAvroNumber(b, v, f.ValueStr, 1), nil
+		case []string:
+			b = appendAvroLong(b, 4)
+			if len(v) > 0 {
+				b = appendAvroLong(b, int64(len(v)))
+				for _, item := range v {
+					b = appendAvroString(appendAvroLong(b, 2), item)
+				}
+			}
+			return appendAvroLong(b, 0), nil
+		case []float64:
+			b = appendAvroLong(b, 4)
+			if len(v) > 0 {
+				b = appendAvroLong(b, int64(len(v)))
+				for _, item := range v {
+					b = appendAvroDouble(appendAvroLong(b, 1), item)
+				}
+			}
+			return appendAvroLong(b, 0), nil
+		default:
+			return nil, fmt.Errorf("unsupport value %v", f.Value)
+		}
+	}
+}
+
+// encode encodes the exported fields to the confluent wire format, the fields not in the schema are ignored
+func (s *avroSchema) encode(b []byte, schemaId int32, fields common.ExportFields) ([]byte, error) {
+	values := make([]*common.ExportField, len(s.fields))
+	for i := range fields {
+		if index, ok := s.index[fields[i].Key]; ok {
+			values[index] = &fields[i]
+		}
+	}
+	b = append(b, 0)
+	b = binary.BigEndian.AppendUint32(b, uint32(schemaId))
+	var err error
+	for i, f := range s.fields {
+		if b, err = appendAvroValue(b, f.typ, values[i]); err != nil {
+			return nil, fmt.Errorf("encode field %s failed: %s", f.key, err)
+		}
+	}
+	return b, nil
+}
+
+// AvroEncoder registers the schemas of data sources to the schema registry and encodes the items
+type AvroEncoder struct {
+	sync.Mutex
+	config       *exporters_cfg.ExporterCfg
+	client       *http.Client
+	schemas      [exporters_cfg.MAX_DATASOURCE_ID]*avroSchema
+	schemaErrors [exporters_cfg.MAX_DATASOURCE_ID]error // the schema could not be generated by the configured fields
+	registering  singleflight.Group
+}
+
+func NewAvroEncoder(config *exporters_cfg.ExporterCfg) *AvroEncoder {
+	return &AvroEncoder{
+		config: config,
+		client: &http.Client{Timeout: time.Duration(config.SchemaRegistry.Timeout) * time.Second},
+	}
+}
+
+func (a *AvroEncoder) schemaID(dataSourceId uint32, topic string) (*avroSchema, int32, error) {
+	a.Lock()
+	s := a.schemas[dataSourceId]
+	if s == nil {
+		if a.schemaErrors[dataSourceId] == nil {
+			s, a.schemaErrors[dataSourceId] = newAvroSchema(dataSourceId, a.config)
+			a.schemas[dataSourceId] = s
+		}
+		if err := a.schemaErrors[dataSourceId]; err != nil {
+			a.Unlock()
+			return nil, 0, err
+		}
+	}
+	if id, ok := s.ids[topic]; ok {
+		a.Unlock()
+		return s, id, nil
+	}
+	if time.Since(s.lastFailed[topic]) < SCHEMA_REGISTER_RETRY_INTERVAL {
+		a.Unlock()
+		return nil, 0, fmt.Errorf("register schema of topic %s failed recently", topic)
+	}
+	a.Unlock()
+
+	// register without holding the lock, so the encoding of the registered schemas is not blocked,
+	// and the concurrent registering of the same data source and topic is merged into one request
+	key := strconv.Itoa(int(dataSourceId)) + "/" + topic
+	id, err, _ := a.registering.Do(key, func() (interface{}, error) {
+		id, err := a.register(topic+"-value", s.schema)
+		a.Lock()
+		defer a.Unlock()
+		if err != nil {
+			s.lastFailed[topic] = time.Now()
+			return nil, err
+		}
+		log.Infof("kafka exporter %s registered avro schema id %d of topic %s", a.config.SchemaRegistry.Url, id, topic)
+		s.ids[topic] = id
+		return id, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return s, id.(int32), nil
+}
+
+// register registers the schema under the subject, returns the schema id. If the schema is
+// already registered, the schema registry returns the existing id.
+func (a *AvroEncoder) register(subject, schema string) (int32, error) {
+	body, _ := json.Marshal(map[string]string{"schema": schema})
+	req, err := http.NewRequest(http.MethodPost, a.config.SchemaRegistry.Url+"/subjects/"+subject+"/versions", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	if a.config.SchemaRegistry.Username != "" {
+		req.SetBasicAuth(a.config.SchemaRegistry.Username, a.config.SchemaRegistry.Password)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return 0, fmt.Errorf("register schema of subject %s failed, status code: %d, response: %s", subject, resp.StatusCode, respBody)
+	}
+	var result struct {
+		ID int32 `json:"id"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return 0, fmt.Errorf("invalid schema registry response %s: %s", respBody, err)
+	}
+	return result.ID, nil
+}
+
+func (a *AvroEncoder) Encode(dataSourceId uint32, topic string, fields common.ExportFields) ([]byte, error) {
+	s, id, err := a.schemaID(dataSourceId, topic)
+	if err != nil {
+		return nil, err
+	}
+	return s.encode(make([]byte, 0, 1024), id, fields)
+}
@@ -17,12 +17,20 @@
 package kafka_exporter
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"os"
+	"reflect"
 	"strconv"
 	"time"
 
 	"github.com/IBM/sarama"
 	logging "github.com/op/go-logging"
+	"github.com/xdg-go/scram"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
 
 	ingester_common "github.com/deepflowio/deepflow/server/ingester/common"
 	"github.com/deepflowio/deepflow/server/ingester/exporters/common"
@@ -47,6 +55,7 @@ type KafkaExporter struct {
 	dataQueues           queue.FixedMultiQueue
 	queueCount           int
 	producers            []sarama.SyncProducer
+	avroEncoder          *AvroEncoder
 	universalTagsManager *utag.UniversalTagsManager
 	config               *exporters_cfg.ExporterCfg
 	counter              *Counter
@@ -89,6 +98,9 @@ func NewKafkaExporter(index int, config *exporters_cfg.ExporterCfg, universalTag
 		config:               config,
 		counter:              &Counter{},
 	}
+	if config.Format == exporters_cfg.KAFKA_FORMAT_AVRO {
+		exporter.avroEncoder = NewAvroEncoder(config)
+	}
 	debug.ServerRegisterSimple(ingesterctl.CMD_KAFKA_EXPORTER, exporter)
 	ingester_common.RegisterCountableForIngester("exporter", exporter, stats.OptionStatTags{
 		"type": "kafka", "index": strconv.Itoa(index)})
@@ -133,10 +145,27 @@ func (e *KafkaExporter) newProducer(id int) error {
 	config.Producer.Return.Successes = true
 	config.Producer.Compression = sarama.CompressionSnappy
 
+	if e.config.Tls.Enabled {
+		tlsConfig, err := newTLSConfig(&e.config.Tls)
+		if err != nil {
+			return err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
 	config.Net.SASL.Enable = e.config.Sasl.Enabled
 	config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
 	config.Net.SASL.User = e.config.Sasl.Username
 	config.Net.SASL.Password = e.config.Sasl.Password
+	switch e.config.Sasl.Mechanism {
+	case sarama.SASLTypeSCRAMSHA256:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return newScramClient(scram.SHA256) }
+	case sarama.SASLTypeSCRAMSHA512:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return newScramClient(scram.SHA512) }
+	}
 
 	producer, err := sarama.NewSyncProducer(e.config.Endpoints, config)
 	if err != nil {
@@ -147,6 +176,100 @@ func (e *KafkaExporter) newProducer(id int) error {
 	return nil
 }
 
+func newTLSConfig(cfg *exporters_cfg.Tls) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CaFile != "" {
+		caCert, err := os.ReadFile(cfg.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file %s failed: %s", cfg.CaFile, err)
+		}
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("invalid ca file %s", cfg.CaFile)
+		}
+		tlsConfig.RootCAs = certPool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client cert %s failed: %s", cfg.CertFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// encode encodes the item as the message value by the configured format
+func (e *KafkaExporter) encode(item common.ExportItem, topic string) ([]byte, error) {
+	switch e.config.Format {
+	case exporters_cfg.KAFKA_FORMAT_PROTOBUF:
+		dst, err := item.EncodeTo(exporters_cfg.PROTOCOL_OTLP, e.universalTagsManager, e.config)
+		if err != nil {
+			return nil, err
+		}
+		switch v := dst.(type) {
+		case ptrace.ResourceSpansSlice:
+			traces := ptrace.NewTraces()
+			v.MoveAndAppendTo(traces.ResourceSpans())
+			return (&ptrace.ProtoMarshaler{}).MarshalTraces(traces)
+		case plog.ResourceLogsSlice:
+			logs := plog.NewLogs()
+			v.MoveAndAppendTo(logs.ResourceLogs())
+			return (&plog.ProtoMarshaler{}).MarshalLogs(logs)
+		case pmetric.ResourceMetricsSlice:
+			metrics := pmetric.NewMetrics()
+			v.MoveAndAppendTo(metrics.ResourceMetrics())
+			return (&pmetric.ProtoMarshaler{}).MarshalMetrics(metrics)
+		default:
+			return nil, fmt.Errorf("unsupport otlp type %T", dst)
+		}
+	default:
+		dst, err := item.EncodeTo(exporters_cfg.PROTOCOL_KAFKA, e.universalTagsManager, e.config)
+		if err != nil {
+			return nil, err
+		}
+		switch v := dst.(type) {
+		case string:
+			return utils.Slice(v), nil
+		case *common.ExportFields:
+			// the avro format is encoded from the fields directly
+			if e.avroEncoder == nil {
+				return nil, fmt.Errorf("avro encoder is not initialized")
+			}
+			return e.avroEncoder.Encode(item.DataSource(), topic, *v)
+		default:
+			return nil, fmt.Errorf("unsupport kafka encoding type %T", dst)
+		}
+	}
+}
+
+// messageKey returns the value of 'partition-key' field, the messages with the same key are sent to the same partition.
+// If the value is empty, returns nil and the message is sent to a random partition.
+func (e *KafkaExporter) messageKey(item common.ExportItem) sarama.Encoder {
+	structTags := e.config.PartitionKeyStructTags[item.DataSource()]
+	if len(structTags) == 0 {
+		return nil
+	}
+	tag := &structTags[0]
+	value := item.GetFieldValueByOffsetAndKind(tag.Offset, tag.DataKind, tag.DataType)
+	if utils.IsNil(value) {
+		return nil
+	}
+	var key string
+	if tag.ToStringFuncName != "" {
+		key = tag.ToStringFunc.Call([]reflect.Value{reflect.ValueOf(value)})[0].String()
+	} else {
+		key = fmt.Sprintf("%v", value)
+	}
+	if key == "" || key == "0" {
+		return nil
+	}
+	return sarama.StringEncoder(key)
+}
+
 func (e *KafkaExporter) queueProcess(queueID int) {
 	items := make([]interface{}, QUEUE_BATCH_COUNT)
 	batch := []*sarama.ProducerMessage{}
@@ -165,7 +288,11 @@ func (e *KafkaExporter) queueProcess(queueID int) {
 				continue
 			}
 
-			json, err := exportItem.EncodeTo(exporters_cfg.PROTOCOL_KAFKA, e.universalTagsManager, e.config)
+			topic := e.config.Topic
+			if topic == "" {
+				topic = exporters_cfg.DataSourceID(exportItem.DataSource()).TopicString()
+			}
+			value, err := e.encode(exportItem, topic)
 			if err != nil {
 				if e.counter.DropCounter == 0 {
 					log.Warningf("kafka encode failed, err: %s", err)
@@ -175,21 +302,16 @@ func (e *KafkaExporter) queueProcess(queueID int) {
 				continue
 			}
 
-			jsonStr := json.(string)
-			topic := e.config.Topic
-			if topic == "" {
-				topic = exporters_cfg.DataSourceID(exportItem.DataSource()).TopicString()
-			}
 			batch = append(batch,
 				&sarama.ProducerMessage{
 					Topic:     topic,
-					Key:       nil,
-					Value:     sarama.ByteEncoder(utils.Slice(jsonStr)),
+					Key:       e.messageKey(exportItem),
+					Value:     sarama.ByteEncoder(value),
 					Timestamp: time.UnixMicro(exportItem.TimestampUs()),
 				},
 			)
 			if len(batch) >= e.config.BatchSize {
-				log.Debugf("kafka: %s \n %+v", jsonStr, item)
+				log.Debugf("kafka: %+v", item)
 				e.exportBatch(queueID, batch)
 				batch = batch[:0]
 			}
@@ -0,0 +1,183 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka_exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xdg-go/scram"
+
+	"github.com/deepflowio/deepflow/server/ingester/exporters/common"
+	exporters_cfg "github.com/deepflowio/deepflow/server/ingester/exporters/config"
+)
+
+// test vector of RFC 7677
+func TestScramSHA256(t *testing.T) {
+	c := newScramClient(scram.SHA256)
+	c.nonceGen = func() string { return "rOprNGfwEbeRWgbNEkqO" }
+	if err := c.Begin("user", "pencil", ""); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := c.Step("")
+	if first != "n,,n=user,r=rOprNGfwEbeRWgbNEkqO" {
+		t.Errorf("client first message %s", first)
+	}
+	final, err := c.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final != "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=" {
+		t.Errorf("client final message %s", final)
+	}
+	if c.Done() {
+		t.Errorf("scram should not be done before server final message")
+	}
+	if _, err := c.Step("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="); err != nil || !c.Done() {
+		t.Errorf("verify server final message failed: %v", err)
+	}
+
+	c.Begin("user", "pencil", "")
+	c.Step("")
+	c.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	if _, err := c.Step("v=AAAA"); err == nil {
+		t.Errorf("invalid server signature should fail")
+	}
+}
+
+func TestAvroEncode(t *testing.T) {
+	var registered map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/subjects/deepflow.flow_log.l7_flow_log-value/versions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &registered)
+		w.Write([]byte(`{"id":7}`))
+	}))
+	defer server.Close()
+
+	dataSource := uint32(exporters_cfg.L7_FLOW_LOG)
+	cfg := &exporters_cfg.ExporterCfg{SchemaRegistry: exporters_cfg.SchemaRegistry{Url: server.URL, Timeout: 1}}
+	cfg.ExportFieldStructTags[dataSource] = []exporters_cfg.StructTags{
+		{Name: "response_code", DataKind: reflect.Int32},
+		{Name: "pod_id", DataKind: reflect.Uint32, UniversalTagMapID: 1},
+		{Name: "attribute_names", DataKind: reflect.Slice},
+		{Name: "metrics_values", DataKind: reflect.Slice},
+	}
+	encoder := NewAvroEncoder(cfg)
+	fields := common.ExportFields{
+		{Key: "datasource", Value: "flow_log.l7_flow_log"},
+		{Key: "response_code", Value: float64(-1), ValueStr: "-1"},
+		{Key: "pod", Value: "pod-a"},
+		{Key: "attribute_names", Value: []string{"a"}},
+		{Key: "metrics_values", Value: []float64{1.5}},
+		{Key: "unknown", Value: "ignored"},
+		{Key: "time_str", Value: "t"},
+	}
+	b, err := encoder.Encode(dataSource, "deepflow.flow_log.l7_flow_log", fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var schema struct {
+		Fields []struct {
+			Name string `json:"name"`
+		} `json:"fields"`
+	}
+	json.Unmarshal([]byte(registered["schema"]), &schema)
+	names := []string{}
+	for _, f := range schema.Fields {
+		names = append(names, f.Name)
+	}
+	expectNames := []string{"datasource", "response_code", "pod", "attribute_names", "metrics_values",
+		"k8s_label_names_0", "k8s_label_values_0", "k8s_label_names_1", "k8s_label_values_1", "time_str"}
+	if !reflect.DeepEqual(names, expectNames) {
+		t.Errorf("schema fields %v, expect %v", names, expectNames)
+	}
+
+	expect := []byte{0, 0, 0, 0, 7}
+	expect = append(expect, 2, 40)
+	expect = append(expect, []byte("flow_log.l7_flow_log")...)
+	expect = append(expect, 2, 1)                           // response_code: long -1
+	expect = append(expect, 2, 10, 'p', 'o', 'd', '-', 'a') // pod: string
+	expect = append(expect, 8, 2, 4, 2, 'a', 0)             // attribute_names: array of string
+	expect = append(expect, 8, 2, 2, 0, 0, 0, 0, 0, 0, 0xf8, 0x3f, 0)
+	expect = append(expect, 0, 0, 0, 0) // k8s labels: null
+	expect = append(expect, 2, 2, 't')  // time_str
+	if !bytes.Equal(b, expect) {
+		t.Errorf("avro encoded %v, expect %v", b, expect)
+	}
+
+	if _, err := encoder.Encode(dataSource, "deepflow.flow_log.l7_flow_log", common.ExportFields{{Key: "response_code", Value: "200"}}); err == nil {
+		t.Errorf("string value of long field should fail")
+	}
+}
+
+func TestAvroSchemaConflict(t *testing.T) {
+	dataSource := uint32(exporters_cfg.L7_FLOW_LOG)
+	cfg := &exporters_cfg.ExporterCfg{}
+	cfg.ExportFieldStructTags[dataSource] = []exporters_cfg.StructTags{
+		{Name: "attribute.a-b", DataKind: reflect.String},
+		{Name: "attribute.a_b", DataKind: reflect.String},
+	}
+	if _, err := newAvroSchema(dataSource, cfg); err == nil || !strings.Contains(err.Error(), "conflicts") {
+		t.Errorf("the fields with the same sanitized name should fail, err: %v", err)
+	}
+
+	encoder := NewAvroEncoder(cfg)
+	if _, err := encoder.Encode(dataSource, "topic", nil); err == nil {
+		t.Errorf("encode with the conflict schema should fail")
+	}
+}
+
+func TestAvroRegisterOnce(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(`{"id":3}`))
+	}))
+	defer server.Close()
+
+	dataSource := uint32(exporters_cfg.L4_FLOW_LOG)
+	encoder := NewAvroEncoder(&exporters_cfg.ExporterCfg{SchemaRegistry: exporters_cfg.SchemaRegistry{Url: server.URL, Timeout: 1}})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := encoder.Encode(dataSource, "deepflow.flow_log.l4_flow_log", nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if requests := atomic.LoadInt32(&requests); requests != 1 {
+		t.Errorf("the concurrent registering should be merged, requests: %d", requests)
+	}
+}
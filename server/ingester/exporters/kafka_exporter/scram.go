@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka_exporter
+
+import "github.com/xdg-go/scram"
+
+// scramClient implements sarama.SCRAMClient with github.com/xdg-go/scram
+type scramClient struct {
+	hashGen  scram.HashGeneratorFcn
+	nonceGen scram.NonceGeneratorFcn // replaces the random nonce in tests
+
+	conversation *scram.ClientConversation
+}
+
+func newScramClient(hashGen scram.HashGeneratorFcn) *scramClient {
+	return &scramClient{hashGen: hashGen}
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.hashGen.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	if c.nonceGen != nil {
+		client.WithNonceGenerator(c.nonceGen)
+	}
+	c.conversation = client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conversation.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.conversation.Done()
+}
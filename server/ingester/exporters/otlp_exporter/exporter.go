@@ -24,6 +24,10 @@ import (
 
 	logging "github.com/op/go-logging"
 	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
 	"go.opentelemetry.io/collector/pdata/ptrace"
 	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
 	"golang.org/x/net/context"
@@ -52,7 +56,7 @@ type OtlpExporter struct {
 	Addr                 string
 	dataQueues           queue.FixedMultiQueue
 	queueCount           int
-	grpcExporters        []ptraceotlp.GRPCClient
+	grpcExporters        []*grpcClients
 	grpcConns            []*grpc.ClientConn
 	grpcFailedCounters   []int
 	universalTagsManager *utag.UniversalTagsManager
@@ -64,6 +68,17 @@ type OtlpExporter struct {
 	utils.Closable
 }
 
+// l7_flow_log is exported as traces, application_log as logs, ext_metrics/prometheus as metrics
+type grpcClients struct {
+	traces  ptraceotlp.GRPCClient
+	logs    plogotlp.GRPCClient
+	metrics pmetricotlp.GRPCClient
+}
+
+type otlpRequest interface {
+	MarshalJSON() ([]byte, error)
+}
+
 type Counter struct {
 	RecvCounter      int64 `statsd:"recv-count"`
 	SendCounter      int64 `statsd:"send-count"`
@@ -94,7 +109,7 @@ func NewOtlpExporter(index int, config *exporters_cfg.ExporterCfg, universalTags
 		universalTagsManager: universalTagsManager,
 		grpcConns:            make([]*grpc.ClientConn, config.QueueCount),
 		grpcFailedCounters:   make([]int, config.QueueCount),
-		grpcExporters:        make([]ptraceotlp.GRPCClient, config.QueueCount),
+		grpcExporters:        make([]*grpcClients, config.QueueCount),
 		config:               config,
 		counter:              &Counter{},
 	}
@@ -128,8 +143,10 @@ func (e *OtlpExporter) Close() {
 }
 
 func (e *OtlpExporter) queueProcess(queueID int) {
-	var batchCount int
+	var batchCount, tracesCount, logsCount, metricsCount int
 	traces := ptrace.NewTraces()
+	logs := plog.NewLogs()
+	metrics := pmetric.NewMetrics()
 	items := make([]interface{}, QUEUE_BATCH_COUNT)
 
 	ctx := context.Background()
@@ -142,12 +159,26 @@ func (e *OtlpExporter) queueProcess(queueID int) {
 			return
 		}
 
-		if err := e.grpcExport(ctx, queueID, ptraceotlp.NewExportRequestFromTraces(traces)); err == nil {
-			e.counter.SendCounter += int64(batchCount)
+		if tracesCount > 0 {
+			if err := e.grpcExport(ctx, queueID, ptraceotlp.NewExportRequestFromTraces(traces)); err == nil {
+				e.counter.SendCounter += int64(tracesCount)
+			}
+			log.Debugf(tracesToString(traces))
+			traces = ptrace.NewTraces()
+		}
+		if logsCount > 0 {
+			if err := e.grpcExport(ctx, queueID, plogotlp.NewExportRequestFromLogs(logs)); err == nil {
+				e.counter.SendCounter += int64(logsCount)
+			}
+			logs = plog.NewLogs()
 		}
-		batchCount = 0
-		log.Debugf(tracesToString(traces))
-		traces = ptrace.NewTraces()
+		if metricsCount > 0 {
+			if err := e.grpcExport(ctx, queueID, pmetricotlp.NewExportRequestFromMetrics(metrics)); err == nil {
+				e.counter.SendCounter += int64(metricsCount)
+			}
+			metrics = pmetric.NewMetrics()
+		}
+		batchCount, tracesCount, logsCount, metricsCount = 0, 0, 0, 0
 	}
 
 	for e.running {
@@ -173,8 +204,21 @@ func (e *OtlpExporter) queueProcess(queueID int) {
 				exportItem.Release()
 				continue
 			}
-			rsSlice := dst.(ptrace.ResourceSpansSlice)
-			rsSlice.MoveAndAppendTo(traces.ResourceSpans())
+			switch v := dst.(type) {
+			case ptrace.ResourceSpansSlice:
+				v.MoveAndAppendTo(traces.ResourceSpans())
+				tracesCount++
+			case plog.ResourceLogsSlice:
+				v.MoveAndAppendTo(logs.ResourceLogs())
+				logsCount++
+			case pmetric.ResourceMetricsSlice:
+				v.MoveAndAppendTo(metrics.ResourceMetrics())
+				metricsCount++
+			default:
+				e.counter.DropCounter++
+				exportItem.Release()
+				continue
+			}
 
 			batchCount++
 			if batchCount >= e.config.BatchSize {
@@ -185,7 +229,7 @@ func (e *OtlpExporter) queueProcess(queueID int) {
 	}
 }
 
-func (e *OtlpExporter) grpcExport(ctx context.Context, queueID int, req ptraceotlp.ExportRequest) error {
+func (e *OtlpExporter) grpcExport(ctx context.Context, queueID int, req otlpRequest) error {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Warningf("grpc otlp export error: %s", r)
@@ -206,10 +250,21 @@ func (e *OtlpExporter) grpcExport(ctx context.Context, queueID int, req ptraceot
 			return err
 		}
 	}
-	_, err := e.grpcExporters[queueID].Export(ctx, req)
+	var err error
+	clients := e.grpcExporters[queueID]
+	switch r := req.(type) {
+	case ptraceotlp.ExportRequest:
+		_, err = clients.traces.Export(ctx, r)
+	case plogotlp.ExportRequest:
+		_, err = clients.logs.Export(ctx, r)
+	case pmetricotlp.ExportRequest:
+		_, err = clients.metrics.Export(ctx, r)
+	default:
+		err = fmt.Errorf("unsupport otlp request %T", req)
+	}
 	if err != nil {
 		if e.counter.DropCounter == 0 {
-			log.Warningf("otlp exporter %d send grpc traces failed. faildCounter=%d, err: %s", e.index, e.grpcFailedCounters[queueID], err)
+			log.Warningf("otlp exporter %d send grpc %T failed. faildCounter=%d, err: %s", e.index, req, e.grpcFailedCounters[queueID], err)
 		}
 		e.counter.DropCounter++
 		e.grpcExporters[queueID] = nil
@@ -248,7 +303,11 @@ func (e *OtlpExporter) newGrpcExporter(queueID int) error {
 	}
 
 	e.grpcConns[queueID] = conn
-	e.grpcExporters[queueID] = ptraceotlp.NewGRPCClient(conn)
+	e.grpcExporters[queueID] = &grpcClients{
+		traces:  ptraceotlp.NewGRPCClient(conn),
+		logs:    plogotlp.NewGRPCClient(conn),
+		metrics: pmetricotlp.NewGRPCClient(conn),
+	}
 	return nil
 }
 
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
@@ -57,6 +58,7 @@ type PrometheusExporter struct {
 	dataQueues            queue.FixedMultiQueue
 	queueCount            int
 	requestFailedCounters []int
+	client                *http.Client
 
 	universalTagsManager *utag.UniversalTagsManager
 	config               *exporters_cfg.ExporterCfg
@@ -73,6 +75,7 @@ type Counter struct {
 	SendBatchCounter int64 `statsd:"send-batch-count"`
 	DropCounter      int64 `statsd:"drop-count"`
 	DropBatchCounter int64 `statsd:"drop-batch-count"`
+	RetryCounter     int64 `statsd:"retry-count"`
 	ExportUsedTimeNs int64 `statsd:"export-used-time-ns"`
 }
 
@@ -96,6 +99,7 @@ func NewPrometheusExporter(index int, config *exporters_cfg.ExporterCfg, univers
 		dataQueues:            dataQueues,
 		queueCount:            config.QueueCount,
 		requestFailedCounters: make([]int, config.QueueCount),
+		client:                &http.Client{Timeout: time.Duration(config.RemoteWrite.Timeout) * time.Second},
 		universalTagsManager:  universalTagsManager,
 		config:                config,
 		counter:               &Counter{},
@@ -138,22 +142,7 @@ func (e *PrometheusExporter) queueProcess(queueID int) {
 	batchs := make([]prompb.TimeSeries, 0, e.config.BatchSize)
 
 	doReq := func() {
-		batchCount := len(batchs)
-		if batchCount == 0 {
-			return
-		}
-		now := time.Now()
-		if err := e.sendRequest(queueID, batchs); err != nil {
-			if e.counter.DropCounter == 0 {
-				log.Warningf("failed to send promrw request,requestFaildCounter=%d, err: %v", e.requestFailedCounters[queueID], err)
-			}
-			e.counter.DropCounter += int64(batchCount)
-			e.counter.DropBatchCounter++
-		} else {
-			e.counter.SendCounter += int64(batchCount)
-			e.counter.SendBatchCounter++
-		}
-		e.counter.ExportUsedTimeNs += int64(time.Since(now))
+		e.flush(queueID, batchs)
 		batchs = batchs[:0]
 	}
 
@@ -180,6 +169,7 @@ func (e *PrometheusExporter) queueProcess(queueID int) {
 				continue
 			}
 			timeSeries := ts.([]prompb.TimeSeries)
+			e.relabel(timeSeries)
 			batchs = append(batchs, timeSeries...)
 			batchCount := len(batchs)
 			if batchCount >= e.config.BatchSize {
@@ -190,6 +180,43 @@ func (e *PrometheusExporter) queueProcess(queueID int) {
 	}
 }
 
+// countSamples returns the number of samples in the batch, SendCounter and DropCounter of flush are counted by samples
+func countSamples(batchs []prompb.TimeSeries) int {
+	count := 0
+	for i := range batchs {
+		count += len(batchs[i].Samples)
+	}
+	return count
+}
+
+// flush sends the batch and updates the counters, the batch is normalized for the remote-write protocol
+func (e *PrometheusExporter) flush(queueID int, batchs []prompb.TimeSeries) {
+	if len(batchs) == 0 {
+		return
+	}
+	if e.config.ExportProtocol == exporters_cfg.PROTOCOL_PROMETHEUS_REMOTE_WRITE {
+		var dropped int
+		batchs, dropped = normalizeTimeSeries(batchs)
+		e.counter.DropCounter += int64(dropped)
+		if len(batchs) == 0 {
+			return
+		}
+	}
+	sampleCount := countSamples(batchs)
+	now := time.Now()
+	if err := e.sendRequest(queueID, batchs); err != nil {
+		if e.counter.DropCounter == 0 {
+			log.Warningf("failed to send promrw request,requestFaildCounter=%d, err: %v", e.requestFailedCounters[queueID], err)
+		}
+		e.counter.DropCounter += int64(sampleCount)
+		e.counter.DropBatchCounter++
+	} else {
+		e.counter.SendCounter += int64(sampleCount)
+		e.counter.SendBatchCounter++
+	}
+	e.counter.ExportUsedTimeNs += int64(time.Since(now))
+}
+
 func (e *PrometheusExporter) HandleSimpleCommand(op uint16, arg string) string {
 	return fmt.Sprintf("promethues exporter %d last 10s counter: %+v", e.index, e.lastCounter)
 }
@@ -199,6 +226,56 @@ func (e *PrometheusExporter) getEndpont(queueID int) string {
 	return e.config.RandomEndpoints[e.requestFailedCounters[queueID]%l]
 }
 
+// relabel renames or drops the labels according to 'label-mapping', such as mapping 'pod_ns_id' to 'namespace'
+func (e *PrometheusExporter) relabel(timeSeries []prompb.TimeSeries) {
+	if len(e.config.LabelMapping) == 0 {
+		return
+	}
+	for i := range timeSeries {
+		labels := timeSeries[i].Labels[:0]
+		for _, l := range timeSeries[i].Labels {
+			if name, ok := e.config.LabelMapping[l.Name]; ok {
+				if name == "" {
+					continue
+				}
+				l.Name = name
+			}
+			labels = append(labels, l)
+		}
+		// labels must be sorted by name and unique after renaming
+		sort.SliceStable(labels, func(i, j int) bool {
+			return labels[i].Name < labels[j].Name
+		})
+		unique := labels[:0]
+		for j := range labels {
+			if j > 0 && labels[j].Name == labels[j-1].Name {
+				continue
+			}
+			unique = append(unique, labels[j])
+		}
+		timeSeries[i].Labels = unique
+	}
+}
+
+// backoff returns the waiting time before the next retry, the server's 'Retry-After' takes precedence
+func (e *PrometheusExporter) backoff(retry int, retryAfter time.Duration) time.Duration {
+	maxBackoff := time.Duration(e.config.RemoteWrite.MaxBackoff) * time.Millisecond
+	if retryAfter > 0 {
+		if retryAfter > maxBackoff {
+			return maxBackoff
+		}
+		return retryAfter
+	}
+	backoff := time.Duration(e.config.RemoteWrite.MinBackoff) * time.Millisecond
+	for i := 0; i < retry && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
 func (e *PrometheusExporter) sendRequest(queueID int, batchs []prompb.TimeSeries) error {
 	wr := &prompb.WriteRequest{Timeseries: batchs}
 	data, err := proto.Marshal(wr)
@@ -208,17 +285,34 @@ func (e *PrometheusExporter) sendRequest(queueID int, batchs []prompb.TimeSeries
 	buf := make([]byte, len(data), cap(data))
 	compressedData := snappy.Encode(buf, data)
 
+	for retry := 0; ; retry++ {
+		recoverable, retryAfter, err := e.doRequest(queueID, compressedData)
+		if err == nil || !recoverable || retry >= e.config.RemoteWrite.MaxRetries {
+			return err
+		}
+		e.counter.RetryCounter++
+		select {
+		case <-e.ctx.Done():
+			return err
+		case <-time.After(e.backoff(retry, retryAfter)):
+		}
+	}
+}
+
+// doRequest sends the compressed WriteRequest once, returns whether the error is recoverable
+func (e *PrometheusExporter) doRequest(queueID int, compressedData []byte) (bool, time.Duration, error) {
 	endpoint := e.getEndpont(queueID)
 	req, err := http.NewRequestWithContext(e.ctx, "POST", endpoint, bytes.NewReader(compressedData))
 	if err != nil {
 		e.requestFailedCounters[queueID]++
-		return err
+		return false, 0, err
 	}
 
 	// Add necessary headers specified by:
 	// https://cortexmetrics.io/docs/apis/#remote-api
 	req.Header.Add("Content-Encoding", "snappy")
 	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "deepflow-server")
 	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
 
 	// inject extra headers
@@ -226,23 +320,41 @@ func (e *PrometheusExporter) sendRequest(queueID int, batchs []prompb.TimeSeries
 		req.Header.Set(k, v)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := e.client.Do(req)
 	if err != nil {
+		// network errors are recoverable, and the next retry uses another endpoint
 		e.requestFailedCounters[queueID]++
-		return err
+		return true, 0, err
 	}
 	defer resp.Body.Close()
 
-	// 5xx errors are recoverable and the writer should retry?
+	// 429 and 5xx errors are recoverable and the writer should retry, other 4xx errors are not.
 	// Reference for different behavior according to status code:
 	// https://github.com/prometheus/prometheus/pull/2552/files#diff-ae8db9d16d8057358e49d694522e7186
 	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
-	if resp.StatusCode >= 400 {
-		e.requestFailedCounters[queueID]++
-		return fmt.Errorf("remote write returned HTTP status %v; err = %s: %s", resp.Status, err, body)
+	if resp.StatusCode/100 == 2 {
+		return false, 0, nil
 	}
+	e.requestFailedCounters[queueID]++
+	err = fmt.Errorf("remote write returned HTTP status %v; err = %s: %s", resp.Status, err, body)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true, parseRetryAfter(resp.Header.Get("Retry-After")), err
+	}
+	return resp.StatusCode/100 == 5, 0, err
+}
 
-	return nil
+// Retry-After is either the delay seconds or a http date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
 }
 
 var prompbTimeSeriesPool = pool.NewLockFreePool(func() *prompb.TimeSeries {
@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package prometheus_exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	"golang.org/x/net/context"
+
+	exporters_cfg "github.com/deepflowio/deepflow/server/ingester/exporters/config"
+)
+
+type remoteWriteServer struct {
+	*httptest.Server
+	statusCodes []int // status code of each request, 204 after all used
+	requests    []*prompb.WriteRequest
+}
+
+func newRemoteWriteServer(t *testing.T, statusCodes ...int) *remoteWriteServer {
+	s := &remoteWriteServer{statusCodes: statusCodes}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Content-Type") != "application/x-protobuf" ||
+			r.Header.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" {
+			t.Errorf("unexpected remote write headers %v", r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		data, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Errorf("snappy decode failed: %s", err)
+		}
+		wr := &prompb.WriteRequest{}
+		if err := proto.Unmarshal(data, wr); err != nil {
+			t.Errorf("unmarshal write request failed: %s", err)
+		}
+		s.requests = append(s.requests, wr)
+
+		statusCode := http.StatusNoContent
+		if len(s.requests) <= len(s.statusCodes) {
+			statusCode = s.statusCodes[len(s.requests)-1]
+		}
+		if statusCode == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(statusCode)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newTestExporter(t *testing.T, protocol exporters_cfg.ExportProtocol, endpoint string) *PrometheusExporter {
+	cfg := &exporters_cfg.ExporterCfg{
+		ExportProtocol:  protocol,
+		RandomEndpoints: []string{endpoint},
+		RemoteWrite:     exporters_cfg.RemoteWrite{MinBackoff: 1, MaxBackoff: 10},
+	}
+	cfg.RemoteWrite.Validate(protocol)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return &PrometheusExporter{
+		ctx:                   ctx,
+		cancel:                cancel,
+		requestFailedCounters: make([]int, 1),
+		client:                &http.Client{Timeout: time.Second},
+		config:                cfg,
+		counter:               &Counter{},
+	}
+}
+
+func loadBatch(t *testing.T) []prompb.TimeSeries {
+	data, err := os.ReadFile("testfiles/remote_write_batch.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var batch []prompb.TimeSeries
+	if err := json.Unmarshal(data, &batch); err != nil {
+		t.Fatal(err)
+	}
+	return batch
+}
+
+func TestRemoteWriteFlush(t *testing.T) {
+	server := newRemoteWriteServer(t, http.StatusInternalServerError, http.StatusTooManyRequests)
+	e := newTestExporter(t, exporters_cfg.PROTOCOL_PROMETHEUS_REMOTE_WRITE, server.URL)
+	e.flush(0, loadBatch(t))
+
+	if len(server.requests) != 3 || e.counter.RetryCounter != 2 {
+		t.Fatalf("expect 2 retries for 5xx and 429, got %d requests, counter %+v", len(server.requests), e.counter)
+	}
+	data, err := os.ReadFile("testfiles/remote_write_request.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := &prompb.WriteRequest{}
+	if err := json.Unmarshal(data, expect); err != nil {
+		t.Fatal(err)
+	}
+	expectData, _ := proto.Marshal(expect)
+	gotData, _ := proto.Marshal(server.requests[2])
+	if !bytes.Equal(expectData, gotData) {
+		got, _ := json.Marshal(server.requests[2])
+		t.Errorf("remote write request mismatch with the fixture, got:\n%s", got)
+	}
+	// 5 series with 5 samples, the series without metric name and the duplicated sample are dropped
+	if e.counter.SendCounter != 3 || e.counter.DropCounter != 2 || e.counter.SendBatchCounter != 1 {
+		t.Errorf("unexpected counter %+v", e.counter)
+	}
+}
+
+func TestRemoteWriteFlushCountSamples(t *testing.T) {
+	server := newRemoteWriteServer(t)
+	e := newTestExporter(t, exporters_cfg.PROTOCOL_PROMETHEUS_REMOTE_WRITE, server.URL)
+	name := prompb.Label{Name: "__name__", Value: "deepflow_metric"}
+	batch := []prompb.TimeSeries{
+		// the series without metric name is dropped with all its samples
+		{Labels: []prompb.Label{{Name: "host", Value: "a"}}, Samples: []prompb.Sample{{Value: 1, Timestamp: 1}, {Value: 2, Timestamp: 2}}},
+		{Labels: []prompb.Label{name}, Samples: []prompb.Sample{{Value: 1, Timestamp: 1}, {Value: 2, Timestamp: 2}}},
+		{Labels: []prompb.Label{name}, Samples: []prompb.Sample{{Value: 3, Timestamp: 2}}},
+	}
+	e.flush(0, batch)
+	if e.counter.SendCounter != 2 || e.counter.DropCounter != 3 {
+		t.Errorf("expect 2 samples sent and 3 dropped, got counter %+v", e.counter)
+	}
+}
+
+func TestRemoteWriteUnrecoverable(t *testing.T) {
+	server := newRemoteWriteServer(t, http.StatusBadRequest)
+	e := newTestExporter(t, exporters_cfg.PROTOCOL_PROMETHEUS_REMOTE_WRITE, server.URL)
+	e.flush(0, loadBatch(t))
+	if len(server.requests) != 1 || e.counter.RetryCounter != 0 || e.counter.DropBatchCounter != 1 {
+		t.Errorf("4xx should not be retried, got %d requests, counter %+v", len(server.requests), e.counter)
+	}
+}
+
+func TestPrometheusFlushWithoutNormalize(t *testing.T) {
+	server := newRemoteWriteServer(t, http.StatusInternalServerError)
+	e := newTestExporter(t, exporters_cfg.PROTOCOL_PROMETHEUS, server.URL)
+	batch := loadBatch(t)
+	e.flush(0, batch)
+	// the 'prometheus' protocol keeps the batch as it is and does not retry by default
+	if len(server.requests) != 1 || len(server.requests[0].Timeseries) != len(batch) {
+		t.Errorf("unexpected requests %+v", server.requests)
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	cases := []struct {
+		name, metricName, labelName string
+	}{
+		{"http_requests_total", "http_requests_total", "http_requests_total"},
+		{"job:rate5m", "job:rate5m", "job_rate5m"},
+		{"k8s.pod-name", "k8s_pod_name", "k8s_pod_name"},
+		{"0code", "_0code", "_0code"},
+	}
+	for _, c := range cases {
+		if got := sanitizeName(c.name, true); got != c.metricName {
+			t.Errorf("metric name %s sanitized as %s, expect %s", c.name, got, c.metricName)
+		}
+		if got := sanitizeName(c.name, false); got != c.labelName {
+			t.Errorf("label name %s sanitized as %s, expect %s", c.name, got, c.labelName)
+		}
+	}
+}
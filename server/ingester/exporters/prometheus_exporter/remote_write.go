@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package prometheus_exporter
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// sanitizeName replaces the invalid characters by '_', metric names match '[a-zA-Z_:][a-zA-Z0-9_:]*',
+// label names match '[a-zA-Z_][a-zA-Z0-9_]*'
+func sanitizeName(name string, isMetricName bool) string {
+	valid := func(i int, r rune) bool {
+		return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_' ||
+			(i > 0 && r >= '0' && r <= '9') || (isMetricName && r == ':')
+	}
+	for i, r := range name {
+		if !valid(i, r) {
+			var sb strings.Builder
+			for j, r := range name {
+				if valid(j, r) {
+					sb.WriteRune(r)
+				} else if j == 0 && r >= '0' && r <= '9' {
+					sb.WriteByte('_')
+					sb.WriteRune(r)
+				} else {
+					sb.WriteByte('_')
+				}
+			}
+			return sb.String()
+		}
+	}
+	return name
+}
+
+func labelsKey(labels []prompb.Label) string {
+	var sb strings.Builder
+	for _, l := range labels {
+		sb.WriteString(l.Name)
+		sb.WriteByte(0xff)
+		sb.WriteString(l.Value)
+		sb.WriteByte(0xff)
+	}
+	return sb.String()
+}
+
+// normalizeTimeSeries makes the batch conform to the remote-write v1 spec, refer to:
+// https://prometheus.io/docs/specs/remote_write_spec/
+//   - label names are sanitized, labels with empty values are dropped, label names are sorted and unique
+//   - series without metric name are dropped
+//   - series with the same labels are merged, and their samples are sorted by timestamp
+//
+// returns the normalized batch and the count of dropped samples
+func normalizeTimeSeries(batch []prompb.TimeSeries) ([]prompb.TimeSeries, int) {
+	dropped := 0
+	seriesIndex := make(map[string]int, len(batch))
+	normalized := batch[:0]
+	for _, ts := range batch {
+		labels := ts.Labels[:0]
+		hasName := false
+		for _, l := range ts.Labels {
+			if l.Value == "" {
+				continue
+			}
+			isMetricName := l.Name == model.MetricNameLabel
+			if isMetricName {
+				hasName = true
+				l.Value = sanitizeName(l.Value, true)
+			} else {
+				l.Name = sanitizeName(l.Name, false)
+			}
+			labels = append(labels, l)
+		}
+		if !hasName {
+			dropped += len(ts.Samples)
+			continue
+		}
+		sort.SliceStable(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+		unique := labels[:0]
+		for i := range labels {
+			if i > 0 && labels[i].Name == labels[i-1].Name {
+				continue
+			}
+			unique = append(unique, labels[i])
+		}
+		ts.Labels = unique
+
+		key := labelsKey(ts.Labels)
+		if i, ok := seriesIndex[key]; ok {
+			// the full slice expression avoids overwriting the samples of other series sharing the same array
+			samples := normalized[i].Samples
+			normalized[i].Samples = append(samples[:len(samples):len(samples)], ts.Samples...)
+			continue
+		}
+		seriesIndex[key] = len(normalized)
+		normalized = append(normalized, ts)
+	}
+
+	for i := range normalized {
+		samples := normalized[i].Samples
+		if len(samples) < 2 {
+			continue
+		}
+		sort.SliceStable(samples, func(i, j int) bool { return samples[i].Timestamp < samples[j].Timestamp })
+		// samples with the same timestamp are duplicated, keep the last one
+		unique := samples[:0]
+		for j := range samples {
+			if j+1 < len(samples) && samples[j].Timestamp == samples[j+1].Timestamp {
+				dropped++
+				continue
+			}
+			unique = append(unique, samples[j])
+		}
+		normalized[i].Samples = unique
+	}
+	return normalized, dropped
+}
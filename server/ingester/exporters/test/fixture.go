@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// CheckJSONFixture compares the encoded JSON with the fixture file, ignoring the field order and the whitespaces
+func CheckJSONFixture(t *testing.T, file string, got []byte) {
+	t.Helper()
+	expect, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotValue, expectValue interface{}
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(expect, &expectValue); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotValue, expectValue) {
+		t.Errorf("encoded result mismatch with %s, got:\n%s", file, got)
+	}
+}
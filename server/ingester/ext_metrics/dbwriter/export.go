@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dbwriter
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"unsafe"
+
+	"github.com/prometheus/prometheus/prompb"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/deepflowio/deepflow/server/ingester/exporters/common"
+	"github.com/deepflowio/deepflow/server/ingester/exporters/config"
+	utag "github.com/deepflowio/deepflow/server/ingester/exporters/universal_tag"
+	"github.com/deepflowio/deepflow/server/libs/datatype"
+	"github.com/deepflowio/deepflow/server/libs/utils"
+)
+
+// only the ext_metrics from telegraf are exported, deepflow stats are not
+func (m *ExtMetrics) DataSource() uint32 {
+	if m.MsgType != datatype.MESSAGE_TYPE_TELEGRAF {
+		return uint32(config.MAX_DATASOURCE_ID)
+	}
+	return uint32(config.EXT_METRICS)
+}
+
+func (m *ExtMetrics) TimestampUs() int64 {
+	return int64(m.Timestamp) * 1000000
+}
+
+func (m *ExtMetrics) GetFieldValueByOffsetAndKind(offset uintptr, kind reflect.Kind, dataType utils.DataType) interface{} {
+	return utils.GetValueByOffsetAndKind(uintptr(unsafe.Pointer(m)), offset, kind, dataType)
+}
+
+func (m *ExtMetrics) QueryUniversalTags(utags *utag.UniversalTagsManager) *utag.UniversalTags {
+	t := &m.UniversalTag
+	return utags.QueryUniversalTags(m.OrgId,
+		t.RegionID, t.AZID, t.HostID, t.PodNSID, t.PodClusterID, t.SubnetID, t.VTAPID,
+		uint8(t.L3DeviceType), t.AutoServiceType, t.AutoInstanceType,
+		t.L3DeviceID, t.AutoServiceID, t.AutoInstanceID, t.PodNodeID, t.PodGroupID, t.PodID, uint32(t.L3EpcID), t.GPID, t.ServiceID,
+		t.IsIPv6 == 0, t.IP, t.IP6)
+}
+
+func (m *ExtMetrics) EncodeTo(protocol config.ExportProtocol, utags *utag.UniversalTagsManager, cfg *config.ExporterCfg) (interface{}, error) {
+	if !m.IsValid() {
+		return nil, fmt.Errorf("ext_metrics %s is invalid", m.VTableName)
+	}
+	tags := m.QueryUniversalTags(utags)
+	switch protocol {
+	case config.PROTOCOL_OTLP:
+		return m.EncodeToOtlp(tags, cfg.ExportFieldCategoryBits), nil
+	case config.PROTOCOL_PROMETHEUS:
+		return m.EncodeToPrometheus(tags, cfg), nil
+	case config.PROTOCOL_KAFKA:
+		if tags == nil {
+			tags = &utag.UniversalTags{}
+		}
+		k8sLabels := utags.QueryCustomK8sLabels(m.OrgId, m.UniversalTag.PodID)
+		return common.EncodeToKafka(m, int(m.DataSource()), cfg, tags, tags, k8sLabels, k8sLabels), nil
+	default:
+		return nil, fmt.Errorf("ext_metrics unsupport export to %s", protocol)
+	}
+}
+
+// metric name is '<virtual_table_name>_<metrics_name>', such as 'influxdb_cpu_usage_idle'
+func (m *ExtMetrics) metricName(i int) string {
+	return common.SanitizePrometheusName(m.VTableName + "_" + m.MetricsFloatNames[i])
+}
+
+// each metric is exported as an otlp gauge with the tags as data point attributes
+func (m *ExtMetrics) EncodeToOtlp(tags *utag.UniversalTags, dataTypeBits uint64) interface{} {
+	metricSlice := pmetric.NewResourceMetricsSlice()
+	resMetric := metricSlice.AppendEmpty()
+	common.PutUniversalTags(resMetric.Resource().Attributes(), tags, dataTypeBits)
+
+	metrics := resMetric.ScopeMetrics().AppendEmpty().Metrics()
+	for i := range m.MetricsFloatNames {
+		metric := metrics.AppendEmpty()
+		metric.SetName(m.metricName(i))
+		dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetTimestamp(pcommon.Timestamp(m.TimestampUs() * 1000)) // us -> ns
+		dp.SetDoubleValue(m.MetricsFloatValues[i])
+		common.PutAttributes(dp.Attributes(), m.TagNames, m.TagValues, dataTypeBits)
+	}
+	return metricSlice
+}
+
+func (m *ExtMetrics) EncodeToPrometheus(tags *utag.UniversalTags, cfg *config.ExporterCfg) interface{} {
+	labels := make([]prompb.Label, 0, len(m.TagNames)+len(utag.UniversalTags{})+2)
+	labels = append(labels, prompb.Label{Name: "datasource", Value: config.EXT_METRICS.String()})
+	if cfg.ExportFieldCategoryBits&config.NATIVE_TAG != 0 {
+		for i := range m.TagNames {
+			labels = append(labels, prompb.Label{Name: common.SanitizePrometheusName(m.TagNames[i]), Value: m.TagValues[i]})
+		}
+	}
+	if cfg.ExportFieldCategoryBits&config.UNIVERSAL_TAG != 0 {
+		common.RangeUniversalTags(tags, func(name, value string) {
+			labels = append(labels, prompb.Label{Name: name, Value: value})
+		})
+	}
+
+	timestamp := m.TimestampUs() / 1000 // us -> ms
+	series := make([]prompb.TimeSeries, 0, len(m.MetricsFloatNames))
+	for i := range m.MetricsFloatNames {
+		ls := make([]prompb.Label, 0, len(labels)+1)
+		ls = append(ls, prompb.Label{Name: "__name__", Value: m.metricName(i)})
+		ls = append(ls, labels...)
+		sort.Slice(ls, func(i, j int) bool { return ls[i].Name < ls[j].Name })
+		series = append(series, prompb.TimeSeries{
+			Labels:  ls,
+			Samples: []prompb.Sample{{Value: m.MetricsFloatValues[i], Timestamp: timestamp}},
+		})
+	}
+	return series
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dbwriter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/deepflowio/deepflow/server/ingester/exporters/config"
+	exporterstest "github.com/deepflowio/deepflow/server/ingester/exporters/test"
+	utag "github.com/deepflowio/deepflow/server/ingester/exporters/universal_tag"
+	"github.com/deepflowio/deepflow/server/libs/datatype"
+)
+
+func testExtMetrics() (*ExtMetrics, *utag.UniversalTags) {
+	m := &ExtMetrics{
+		Timestamp:          1700000000,
+		MsgType:            datatype.MESSAGE_TYPE_TELEGRAF,
+		VTableName:         "influxdb.cpu",
+		TagNames:           []string{"cpu", "host.name"},
+		TagValues:          []string{"cpu-total", "node-1"},
+		MetricsFloatNames:  []string{"usage_idle", "usage-user"},
+		MetricsFloatValues: []float64{92.5, 3.25},
+	}
+	tags := &utag.UniversalTags{}
+	tags[utag.Region] = "region-1"
+	tags[utag.Vtap] = "agent-1"
+	return m, tags
+}
+
+func TestExtMetricsEncodeToOtlp(t *testing.T) {
+	m, tags := testExtMetrics()
+	metrics := pmetric.NewMetrics()
+	m.EncodeToOtlp(tags, config.UNIVERSAL_TAG|config.NATIVE_TAG).(pmetric.ResourceMetricsSlice).MoveAndAppendTo(metrics.ResourceMetrics())
+	got, err := (&pmetric.JSONMarshaler{}).MarshalMetrics(metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporterstest.CheckJSONFixture(t, "testfiles/ext_metrics_otlp.json", got)
+}
+
+func TestExtMetricsEncodeToPrometheus(t *testing.T) {
+	m, tags := testExtMetrics()
+	cfg := &config.ExporterCfg{ExportFieldCategoryBits: config.UNIVERSAL_TAG | config.NATIVE_TAG}
+	got, err := json.Marshal(m.EncodeToPrometheus(tags, cfg).([]prompb.TimeSeries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporterstest.CheckJSONFixture(t, "testfiles/ext_metrics_prometheus.json", got)
+
+	// 未开启 native_tag/universal_tag 时只保留 __name__ 和 datasource
+	cfg.ExportFieldCategoryBits = 0
+	for _, ts := range m.EncodeToPrometheus(tags, cfg).([]prompb.TimeSeries) {
+		if len(ts.Labels) != 2 {
+			t.Errorf("unexpected labels %v", ts.Labels)
+		}
+	}
+}
+
+func TestExtMetricsEncodeTo(t *testing.T) {
+	m, _ := testExtMetrics()
+	if m.DataSource() != uint32(config.EXT_METRICS) {
+		t.Errorf("telegraf metrics should be exported as ext_metrics")
+	}
+	m.MsgType = datatype.MESSAGE_TYPE_DFSTATS
+	if m.DataSource() != uint32(config.MAX_DATASOURCE_ID) {
+		t.Errorf("deepflow stats should not be exported")
+	}
+
+	m.TagValues = m.TagValues[:1]
+	cfg := &config.ExporterCfg{}
+	if _, err := m.EncodeTo(config.PROTOCOL_OTLP, &utag.UniversalTagsManager{}, cfg); err == nil {
+		t.Errorf("invalid ext_metrics should not be encoded")
+	}
+}
@@ -31,25 +31,27 @@ const (
 )
 
 type ExtMetrics struct {
-	Timestamp uint32 // s
+	pool.ReferenceCount
+
+	Timestamp uint32 `json:"time" category:"$tag" sub:"flow_info"` // s
 	MsgType   datatype.MessageType
 
 	UniversalTag flow_metrics.UniversalTag
 
-	VTableName string
+	VTableName string `json:"virtual_table_name" category:"$tag" sub:"flow_info"`
 
 	AgentID uint16
 
 	// Not stored, only determines which database to store in.
 	// When Orgid is 0 or 1, it is stored in database '<DatabaseName()>', otherwise stored in '<OrgId>_<DatabaseName()>'.
 	OrgId, RawOrgId uint16 // RawOrgId is read from server-stats message, only used to distinguish which database data is written to
-	TeamID          uint16
+	TeamID          uint16 `json:"team_id" category:"$tag" sub:"universal_tag"`
 
-	TagNames  []string
-	TagValues []string
+	TagNames  []string `json:"tag_names" category:"$tag" sub:"native_tag" data_type:"[]string"`
+	TagValues []string `json:"tag_values" category:"$tag" sub:"native_tag" data_type:"[]string"`
 
-	MetricsFloatNames  []string
-	MetricsFloatValues []float64
+	MetricsFloatNames  []string  `json:"metrics_float_names" category:"$metrics" data_type:"[]string"`
+	MetricsFloatValues []float64 `json:"metrics_float_values" category:"$metrics" data_type:"[]float64"`
 }
 
 func (m *ExtMetrics) IsValid() bool {
@@ -248,12 +250,17 @@ var extMetricsPool = pool.NewLockFreePool(func() *ExtMetrics {
 })
 
 func AcquireExtMetrics() *ExtMetrics {
-	return extMetricsPool.Get()
+	m := extMetricsPool.Get()
+	m.Reset()
+	return m
 }
 
 var emptyUniversalTag = flow_metrics.UniversalTag{}
 
 func ReleaseExtMetrics(m *ExtMetrics) {
+	if m.SubReferenceCount() {
+		return
+	}
 	m.UniversalTag = emptyUniversalTag
 	m.TagNames = m.TagNames[:0]
 	m.TagValues = m.TagValues[:0]
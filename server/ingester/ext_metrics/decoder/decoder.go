@@ -25,6 +25,8 @@ import (
 	logging "github.com/op/go-logging"
 
 	"github.com/deepflowio/deepflow/server/ingester/common"
+	"github.com/deepflowio/deepflow/server/ingester/exporters"
+	exportconfig "github.com/deepflowio/deepflow/server/ingester/exporters/config"
 	"github.com/deepflowio/deepflow/server/ingester/ext_metrics/config"
 	"github.com/deepflowio/deepflow/server/ingester/ext_metrics/dbwriter"
 	"github.com/deepflowio/deepflow/server/libs/ckdb"
@@ -61,6 +63,7 @@ type Decoder struct {
 	platformData      *grpc.PlatformInfoTable
 	inQueue           queue.QueueReader
 	extMetricsWriters [dbwriter.MAX_DB_ID]*dbwriter.ExtMetricsWriter
+	exporters         *exporters.Exporters
 	debugEnabled      bool
 	config            *config.Config
 
@@ -81,6 +84,7 @@ func NewDecoder(
 	platformData *grpc.PlatformInfoTable,
 	inQueue queue.QueueReader,
 	extMetricsWriters [dbwriter.MAX_DB_ID]*dbwriter.ExtMetricsWriter,
+	exporters *exporters.Exporters,
 	config *config.Config,
 ) *Decoder {
 	d := &Decoder{
@@ -90,6 +94,7 @@ func NewDecoder(
 		inQueue:           inQueue,
 		debugEnabled:      log.IsEnabledFor(logging.DEBUG),
 		extMetricsWriters: extMetricsWriters,
+		exporters:         exporters,
 		config:            config,
 		counter:           &Counter{},
 	}
@@ -119,6 +124,7 @@ func (d *Decoder) Run() {
 		n := d.inQueue.Gets(buffer)
 		for i := 0; i < n; i++ {
 			if buffer[i] == nil {
+				d.export(nil)
 				continue
 			}
 			d.counter.InCount++
@@ -175,10 +181,19 @@ func (d *Decoder) sendTelegraf(vtapID uint16, point models.Point) {
 		d.counter.ErrMetrics++
 		return
 	}
+	d.export(extMetrics)
 	d.extMetricsWriters[int(dbwriter.EXT_METRICS_DB_ID)].Write(extMetrics)
 	d.counter.OutCount++
 }
 
+// only the decoders of telegraf have exporters
+func (d *Decoder) export(item *dbwriter.ExtMetrics) {
+	if d.exporters == nil {
+		return
+	}
+	d.exporters.Put(uint32(exportconfig.EXT_METRICS), d.index, item)
+}
+
 func (d *Decoder) handleDeepflowStats(vtapID uint16, decoder *codec.SimpleDecoder) {
 	for !decoder.IsEnd() {
 		pbStats := &pb.Stats{}
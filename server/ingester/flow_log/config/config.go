@@ -35,6 +35,8 @@ const (
 	DefaultDecoderQueueSize  = 4096
 	DefaultBrokerQueueSize   = 1 << 14
 	DefaultFlowLogTTL        = 72 // hour
+
+	DefaultTraceSamplingSlowThresholdMs = 1000
 )
 
 type FlowLogTTL struct {
@@ -43,6 +45,19 @@ type FlowLogTTL struct {
 	L4Packet  int `yaml:"l4-packet"`
 }
 
+// TraceSampling 开启后，超过 throttle 的 l7 流日志按 trace_id 哈希进行采样，
+// 同一条 trace 的 span 会被一起保留或丢弃；错误及慢调用的 span 优先保留，但同样计入 throttle 且不超过 throttle。
+// 各数据源（eBPF、OpenTelemetry、SkyWalking、Datadog、Zipkin）的 l7 流日志共用 l7-throttle 的限制。
+// 超出配额时会降低所有 span 的采样比例，而不仅是对应协议或服务的 span，以保证 trace 的完整性
+type TraceSampling struct {
+	Enabled         bool `yaml:"enabled"`
+	SlowThresholdMs int  `yaml:"slow-threshold-ms"`
+	// 按 l7_protocol_str (如 HTTP, MySQL) 配置的每秒写入上限，0 或不配置表示不限制
+	L7ProtocolQuotas map[string]int `yaml:"l7-protocol-quotas"`
+	// 按 app_service 配置的每秒写入上限，0 或不配置表示不限制
+	AppServiceQuotas map[string]int `yaml:"app-service-quotas"`
+}
+
 type Config struct {
 	Base              *config.Config
 	CKWriterConfig    config.CKWriterConfig `yaml:"flowlog-ck-writer"`
@@ -50,6 +65,7 @@ type Config struct {
 	ThrottleBucket    int                   `yaml:"throttle-bucket"`
 	L4Throttle        int                   `yaml:"l4-throttle"`
 	L7Throttle        int                   `yaml:"l7-throttle"`
+	TraceSampling     TraceSampling         `yaml:"trace-sampling"`
 	FlowLogTTL        FlowLogTTL            `yaml:"flow-log-ttl-hour"`
 	DecoderQueueCount int                   `yaml:"flow-log-decoder-queue-count"`
 	DecoderQueueSize  int                   `yaml:"flow-log-decoder-queue-size"`
@@ -78,6 +94,10 @@ func (c *Config) Validate() error {
 		c.FlowLogTTL.L4Packet = DefaultFlowLogTTL
 	}
 
+	if c.TraceSampling.SlowThresholdMs <= 0 {
+		c.TraceSampling.SlowThresholdMs = DefaultTraceSamplingSlowThresholdMs
+	}
+
 	if c.TraceTreeEnabled == nil {
 		value := configdefaults.FLOG_LOG_TRACE_TREE_ENABLED_DEFAULT
 		c.TraceTreeEnabled = &value
@@ -96,6 +116,7 @@ func Load(base *config.Config, path string) *Config {
 			DecoderQueueSize:  DefaultDecoderQueueSize,
 			CKWriterConfig:    config.CKWriterConfig{QueueCount: 1, QueueSize: 256000, BatchSize: 128000, FlushTimeout: 10},
 			FlowLogTTL:        FlowLogTTL{DefaultFlowLogTTL, DefaultFlowLogTTL, DefaultFlowLogTTL},
+			TraceSampling:     TraceSampling{SlowThresholdMs: DefaultTraceSamplingSlowThresholdMs},
 		},
 	}
 	if _, err := os.Stat(path); os.IsNotExist(err) {
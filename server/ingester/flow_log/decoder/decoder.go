@@ -75,7 +75,7 @@ type Counter struct {
 	DropCount        int64 `statsd:"drop-count"`
 
 	TotalTime int64 `statsd:"total-time"`
-	AvgTime   int64 `statsd:"avg-time"`
+	AvgTime   int64 `statsd:"avg-time,gauge"`
 }
 
 type Decoder struct {
@@ -187,7 +187,9 @@ func (d *Decoder) Run() {
 			case datatype.MESSAGE_TYPE_SKYWALKING:
 				d.handleSkyWalking(decoder, pbThirdPartyTrace, false)
 			case datatype.MESSAGE_TYPE_DATADOG:
-				d.handleDatadog(decoder, pbThirdPartyTrace, false)
+				d.handleThirdPartyTrace(decoder, pbThirdPartyTrace, false, "datadog", dd_import.DDogDataToL7FlowLogs)
+			case datatype.MESSAGE_TYPE_ZIPKIN:
+				d.handleThirdPartyTrace(decoder, pbThirdPartyTrace, false, "zipkin", log_data.ZipkinDataToL7FlowLogs)
 			default:
 				log.Warningf("unknown msg type: %d", d.msgType)
 
@@ -335,7 +337,11 @@ func (d *Decoder) sendSkyWalking(segmentData, peerIP []byte, uri string) {
 	}
 }
 
-func (d *Decoder) handleDatadog(decoder *codec.SimpleDecoder, pbThirdPartyTrace *pb.ThirdPartyTrace, compressed bool) {
+// thirdPartyTraceToL7FlowLogs converts the data of a tracing protocol transferred by ThirdPartyTrace to l7 flow logs
+type thirdPartyTraceToL7FlowLogs func(vtapID, orgId, teamId uint16, data *pb.ThirdPartyTrace, platformData *grpc.PlatformInfoTable, cfg *config.Config) []*log_data.L7FlowLog
+
+// handleThirdPartyTrace handles the Datadog and Zipkin data, which differ only in the conversion to l7 flow logs
+func (d *Decoder) handleThirdPartyTrace(decoder *codec.SimpleDecoder, pbThirdPartyTrace *pb.ThirdPartyTrace, compressed bool, name string, toL7FlowLogs thirdPartyTraceToL7FlowLogs) {
 	var err error
 	buffer := log_data.GetBuffer()
 	for !decoder.IsEnd() {
@@ -353,22 +359,22 @@ func (d *Decoder) handleDatadog(decoder *codec.SimpleDecoder, pbThirdPartyTrace
 		}
 		if decoder.Failed() || err != nil {
 			if d.counter.ErrorCount == 0 {
-				log.Errorf("datadog data decode failed, offset=%d len=%d err: %s", decoder.Offset(), len(decoder.Bytes()), err)
+				log.Errorf("%s data decode failed, offset=%d len=%d err: %s", name, decoder.Offset(), len(decoder.Bytes()), err)
 			}
 			d.counter.ErrorCount++
 			continue
 		}
-		d.sendDatadog(pbThirdPartyTrace)
+		d.sendThirdPartyTrace(pbThirdPartyTrace, name, toL7FlowLogs)
 		log_data.PutBuffer(buffer)
 	}
 }
 
-func (d *Decoder) sendDatadog(ddogData *pb.ThirdPartyTrace) {
+func (d *Decoder) sendThirdPartyTrace(data *pb.ThirdPartyTrace, name string, toL7FlowLogs thirdPartyTraceToL7FlowLogs) {
 	if d.debugEnabled {
-		log.Debugf("decoder %d vtap %d recv datadog data length: %d", d.index, d.agentId, len(ddogData.Data))
+		log.Debugf("decoder %d vtap %d recv %s data length: %d", d.index, d.agentId, name, len(data.Data))
 	}
 	d.counter.Count++
-	ls := dd_import.DDogDataToL7FlowLogs(d.agentId, d.orgId, d.teamId, ddogData, d.platformData, d.cfg)
+	ls := toL7FlowLogs(d.agentId, d.orgId, d.teamId, data, d.platformData, d.cfg)
 	for _, l := range ls {
 		l.AddReferenceCount()
 		if !d.throttler.SendWithThrottling(l) {
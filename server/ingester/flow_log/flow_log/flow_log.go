@@ -56,6 +56,7 @@ type FlowLog struct {
 	L4PacketLogger       *Logger
 	SkyWalkingLogger     *Logger
 	DdogLogger           *Logger
+	ZipkinLogger         *Logger
 	Exporters            *exporters.Exporters
 	SpanWriter           *dbwriter.SpanWriter
 	TraceTreeWriter      *dbwriter.TraceTreeWriter
@@ -70,9 +71,10 @@ type Logger struct {
 
 func NewFlowLog(config *config.Config, traceTreeQueue *queue.OverwriteQueue, recv *receiver.Receiver, platformDataManager *grpc.PlatformDataManager, exporters *exporters.Exporters) (*FlowLog, error) {
 	manager := dropletqueue.NewManager(ingesterctl.INGESTERCTL_FLOW_LOG_QUEUE)
+	traceSampler := newL7TraceSampler(config)
 
 	if config.Base.StorageDisabled {
-		l7FlowLogger, err := NewL7FlowLogger(config, platformDataManager, manager, recv, nil, exporters, nil)
+		l7FlowLogger, err := NewL7FlowLogger(config, platformDataManager, manager, recv, nil, exporters, nil, traceSampler)
 		if err != nil {
 			return nil, err
 		}
@@ -104,27 +106,31 @@ func NewFlowLog(config *config.Config, traceTreeQueue *queue.OverwriteQueue, rec
 
 	l4FlowLogger := NewL4FlowLogger(config, platformDataManager, manager, recv, flowLogWriter, exporters)
 
-	l7FlowLogger, err := NewL7FlowLogger(config, platformDataManager, manager, recv, flowLogWriter, exporters, spanWriter)
+	l7FlowLogger, err := NewL7FlowLogger(config, platformDataManager, manager, recv, flowLogWriter, exporters, spanWriter, traceSampler)
 	if err != nil {
 		return nil, err
 	}
-	otelLogger, err := NewLogger(datatype.MESSAGE_TYPE_OPENTELEMETRY, config, platformDataManager, manager, recv, flowLogWriter, common.L7_FLOW_ID, nil, spanWriter)
+	otelLogger, err := NewLogger(datatype.MESSAGE_TYPE_OPENTELEMETRY, config, platformDataManager, manager, recv, flowLogWriter, common.L7_FLOW_ID, nil, spanWriter, traceSampler)
 	if err != nil {
 		return nil, err
 	}
-	otelCompressedLogger, err := NewLogger(datatype.MESSAGE_TYPE_OPENTELEMETRY_COMPRESSED, config, platformDataManager, manager, recv, flowLogWriter, common.L7_FLOW_ID, nil, spanWriter)
+	otelCompressedLogger, err := NewLogger(datatype.MESSAGE_TYPE_OPENTELEMETRY_COMPRESSED, config, platformDataManager, manager, recv, flowLogWriter, common.L7_FLOW_ID, nil, spanWriter, traceSampler)
 	if err != nil {
 		return nil, err
 	}
-	l4PacketLogger, err := NewLogger(datatype.MESSAGE_TYPE_PACKETSEQUENCE, config, nil, manager, recv, flowLogWriter, common.L4_PACKET_ID, nil, nil)
+	l4PacketLogger, err := NewLogger(datatype.MESSAGE_TYPE_PACKETSEQUENCE, config, nil, manager, recv, flowLogWriter, common.L4_PACKET_ID, nil, nil, nil)
 	if err != nil {
 		return nil, err
 	}
-	skywalkingLogger, err := NewLogger(datatype.MESSAGE_TYPE_SKYWALKING, config, platformDataManager, manager, recv, flowLogWriter, common.L7_FLOW_ID, nil, spanWriter)
+	skywalkingLogger, err := NewLogger(datatype.MESSAGE_TYPE_SKYWALKING, config, platformDataManager, manager, recv, flowLogWriter, common.L7_FLOW_ID, nil, spanWriter, traceSampler)
 	if err != nil {
 		return nil, err
 	}
-	ddogLogger, err := NewLogger(datatype.MESSAGE_TYPE_DATADOG, config, platformDataManager, manager, recv, flowLogWriter, common.L7_FLOW_ID, nil, spanWriter)
+	ddogLogger, err := NewLogger(datatype.MESSAGE_TYPE_DATADOG, config, platformDataManager, manager, recv, flowLogWriter, common.L7_FLOW_ID, nil, spanWriter, traceSampler)
+	if err != nil {
+		return nil, err
+	}
+	zipkinLogger, err := NewLogger(datatype.MESSAGE_TYPE_ZIPKIN, config, platformDataManager, manager, recv, flowLogWriter, common.L7_FLOW_ID, nil, spanWriter, traceSampler)
 	if err != nil {
 		return nil, err
 	}
@@ -137,13 +143,25 @@ func NewFlowLog(config *config.Config, traceTreeQueue *queue.OverwriteQueue, rec
 		L4PacketLogger:       l4PacketLogger,
 		SkyWalkingLogger:     skywalkingLogger,
 		DdogLogger:           ddogLogger,
+		ZipkinLogger:         zipkinLogger,
 		Exporters:            exporters,
 		SpanWriter:           spanWriter,
 		TraceTreeWriter:      traceTreeWriter,
 	}, nil
 }
 
-func NewLogger(msgType datatype.MessageType, config *config.Config, platformDataManager *grpc.PlatformDataManager, manager *dropletqueue.Manager, recv *receiver.Receiver, flowLogWriter *dbwriter.FlowLogWriter, flowLogId common.FlowLogID, exporters *exporters.Exporters, spanWriter *dbwriter.SpanWriter) (*Logger, error) {
+// 所有 L7 logger 的所有队列共用一个 TraceSampler，保证同一条 trace 的 span 无论来自哪种数据源、哪个队列，采样结果都一致，
+// 所有 L7 数据源共用 l7-throttle 的限制
+func newL7TraceSampler(config *config.Config) *throttler.TraceSampler {
+	throttle := config.Throttle
+	if config.L7Throttle != 0 {
+		throttle = config.L7Throttle
+	}
+	return throttler.NewTraceSampler(&config.TraceSampling, throttle, config.ThrottleBucket)
+}
+
+// traceSampler 仅用于 L7 flow log，其他类型传 nil
+func NewLogger(msgType datatype.MessageType, config *config.Config, platformDataManager *grpc.PlatformDataManager, manager *dropletqueue.Manager, recv *receiver.Receiver, flowLogWriter *dbwriter.FlowLogWriter, flowLogId common.FlowLogID, exporters *exporters.Exporters, spanWriter *dbwriter.SpanWriter, traceSampler *throttler.TraceSampler) (*Logger, error) {
 	queueCount := config.DecoderQueueCount
 	decodeQueues := manager.NewQueues(
 		"1-receive-to-decode-"+datatype.MessageTypeString[msgType],
@@ -173,6 +191,7 @@ func NewLogger(msgType datatype.MessageType, config *config.Config, platformData
 			flowLogWriter,
 			int(flowLogId),
 		)
+		throttlers[i].SetTraceSampler(traceSampler)
 		if platformDataManager != nil {
 			platformDatas[i], _ = platformDataManager.NewPlatformInfoTable("flow-log-" + datatype.MessageTypeString[msgType] + "-" + strconv.Itoa(i))
 			if i == 0 {
@@ -253,7 +272,7 @@ func NewL4FlowLogger(config *config.Config, platformDataManager *grpc.PlatformDa
 	}
 }
 
-func NewL7FlowLogger(config *config.Config, platformDataManager *grpc.PlatformDataManager, manager *dropletqueue.Manager, recv *receiver.Receiver, flowLogWriter *dbwriter.FlowLogWriter, exporters *exporters.Exporters, spanWriter *dbwriter.SpanWriter) (*Logger, error) {
+func NewL7FlowLogger(config *config.Config, platformDataManager *grpc.PlatformDataManager, manager *dropletqueue.Manager, recv *receiver.Receiver, flowLogWriter *dbwriter.FlowLogWriter, exporters *exporters.Exporters, spanWriter *dbwriter.SpanWriter, traceSampler *throttler.TraceSampler) (*Logger, error) {
 	queueSuffix := "-l7"
 	queueCount := config.DecoderQueueCount
 	msgType := datatype.MESSAGE_TYPE_PROTOCOLLOG
@@ -274,7 +293,6 @@ func NewL7FlowLogger(config *config.Config, platformDataManager *grpc.PlatformDa
 	}
 
 	throttlers := make([]*throttler.ThrottlingQueue, queueCount)
-
 	platformDatas := make([]*grpc.PlatformInfoTable, queueCount)
 	decoders := make([]*decoder.Decoder, queueCount)
 	var flowTagWriter *flow_tag.FlowTagWriter
@@ -297,6 +315,7 @@ func NewL7FlowLogger(config *config.Config, platformDataManager *grpc.PlatformDa
 			flowLogWriter,
 			int(common.L7_FLOW_ID),
 		)
+		throttlers[i].SetTraceSampler(traceSampler)
 		platformDatas[i], _ = platformDataManager.NewPlatformInfoTable("l7-flow-log-" + strconv.Itoa(i))
 		if i == 0 {
 			debug.ServerRegisterSimple(ingesterctl.CMD_PLATFORMDATA_FLOW_LOG, platformDatas[i])
@@ -374,6 +393,9 @@ func (s *FlowLog) Start() {
 	if s.DdogLogger != nil {
 		s.DdogLogger.Start()
 	}
+	if s.ZipkinLogger != nil {
+		s.ZipkinLogger.Start()
+	}
 	if s.SpanWriter != nil {
 		s.SpanWriter.Start()
 	}
@@ -404,6 +426,9 @@ func (s *FlowLog) Close() error {
 	if s.DdogLogger != nil {
 		s.DdogLogger.Close()
 	}
+	if s.ZipkinLogger != nil {
+		s.ZipkinLogger.Close()
+	}
 	if s.SpanWriter != nil {
 		s.SpanWriter.Close()
 	}
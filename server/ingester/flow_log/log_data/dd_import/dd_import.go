@@ -17,12 +17,588 @@
 package dd_import
 
 import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/google/gopacket/layers"
+	logging "github.com/op/go-logging"
+
 	flowlogCfg "github.com/deepflowio/deepflow/server/ingester/flow_log/config"
 	"github.com/deepflowio/deepflow/server/ingester/flow_log/log_data"
+	"github.com/deepflowio/deepflow/server/libs/datatype"
 	"github.com/deepflowio/deepflow/server/libs/datatype/pb"
+	flow_metrics "github.com/deepflowio/deepflow/server/libs/flow-metrics"
 	"github.com/deepflowio/deepflow/server/libs/grpc"
+	"github.com/deepflowio/deepflow/server/libs/utils"
+)
+
+var log = logging.MustGetLogger("flow_log.dd_import")
+
+const (
+	URI_V03 = "/v0.3/traces"
+	URI_V04 = "/v0.4/traces"
+	URI_V05 = "/v0.5/traces"
+
+	HEADER_CONTENT_TYPE = "Content-Type"
+	HEADER_CONTAINER_ID = "Datadog-Container-Id"
+
+	// the number of fields of a span in the v0.5 payload
+	V05_SPAN_FIELD_COUNT = 12
 )
 
+// refer to: https://github.com/DataDog/datadog-agent/blob/main/pkg/proto/datadog/trace/span.proto
+type ddSpan struct {
+	Service  string             `json:"service"`
+	Name     string             `json:"name"`
+	Resource string             `json:"resource"`
+	TraceID  uint64             `json:"trace_id"`
+	SpanID   uint64             `json:"span_id"`
+	ParentID uint64             `json:"parent_id"`
+	Start    int64              `json:"start"`    // ns
+	Duration int64              `json:"duration"` // ns
+	Error    int32              `json:"error"`
+	Meta     map[string]string  `json:"meta"`
+	Metrics  map[string]float64 `json:"metrics"`
+	Type     string             `json:"type"`
+}
+
 func DDogDataToL7FlowLogs(vtapID, orgId, teamId uint16, pbThirdPartyData *pb.ThirdPartyTrace, platformData *grpc.PlatformInfoTable, cfg *flowlogCfg.Config) []*log_data.L7FlowLog {
-	return []*log_data.L7FlowLog{}
+	headers := make(map[string]string, len(pbThirdPartyData.ExtendKeys))
+	for i, key := range pbThirdPartyData.ExtendKeys {
+		if i < len(pbThirdPartyData.ExtendValues) {
+			headers[key] = pbThirdPartyData.ExtendValues[i]
+		}
+	}
+
+	traces, err := decodeTraces(pbThirdPartyData.Data, pbThirdPartyData.Uri, headers[HEADER_CONTENT_TYPE])
+	if err != nil {
+		log.Debugf("datadog data (uri: %s) decode failed: %s", pbThirdPartyData.Uri, err)
+		return []*log_data.L7FlowLog{}
+	}
+
+	ret := []*log_data.L7FlowLog{}
+	for _, trace := range traces {
+		for _, span := range trace {
+			if span == nil {
+				continue
+			}
+			ret = append(ret, spanToL7FlowLog(vtapID, orgId, teamId, span, pbThirdPartyData.PeerIp, headers, platformData, cfg))
+		}
+	}
+	return ret
+}
+
+func decodeTraces(data []byte, uri, contentType string) ([][]*ddSpan, error) {
+	switch {
+	case strings.HasSuffix(uri, URI_V05):
+		return decodeV05(data)
+	case strings.HasSuffix(uri, URI_V03), strings.HasSuffix(uri, URI_V04):
+		if strings.Contains(contentType, "json") {
+			traces := [][]*ddSpan{}
+			err := json.Unmarshal(data, &traces)
+			return traces, err
+		}
+		return decodeV04(data)
+	default:
+		return nil, fmt.Errorf("unsupported datadog uri %s", uri)
+	}
+}
+
+// v0.4 payload is an array of traces, each trace is an array of spans, each span is a map
+func decodeV04(data []byte) ([][]*ddSpan, error) {
+	r := newMsgpReader(data)
+	traceCount, err := r.readArrayHeader()
+	if err != nil {
+		return nil, err
+	}
+	traces := make([][]*ddSpan, 0, traceCount)
+	for i := 0; i < traceCount; i++ {
+		spanCount, err := r.readArrayHeader()
+		if err != nil {
+			return nil, err
+		}
+		trace := make([]*ddSpan, 0, spanCount)
+		for j := 0; j < spanCount; j++ {
+			span, err := decodeV04Span(r)
+			if err != nil {
+				return nil, err
+			}
+			trace = append(trace, span)
+		}
+		traces = append(traces, trace)
+	}
+	return traces, nil
+}
+
+func decodeV04Span(r *msgpReader) (*ddSpan, error) {
+	fieldCount, err := r.readMapHeader()
+	if err != nil {
+		return nil, err
+	}
+	span := &ddSpan{}
+	for i := 0; i < fieldCount; i++ {
+		key, err := r.readStringBytes()
+		if err != nil {
+			return nil, err
+		}
+		switch string(key) {
+		case "service":
+			span.Service, err = r.readString()
+		case "name":
+			span.Name, err = r.readString()
+		case "resource":
+			span.Resource, err = r.readString()
+		case "trace_id":
+			span.TraceID, err = r.readUint64()
+		case "span_id":
+			span.SpanID, err = r.readUint64()
+		case "parent_id":
+			span.ParentID, err = r.readUint64()
+		case "start":
+			span.Start, err = r.readInt64()
+		case "duration":
+			span.Duration, err = r.readInt64()
+		case "error":
+			var v int64
+			v, err = r.readInt64()
+			span.Error = int32(v)
+		case "type":
+			span.Type, err = r.readString()
+		case "meta":
+			span.Meta, err = readStringMap(r)
+		case "metrics":
+			span.Metrics, err = readFloatMap(r)
+		default:
+			// meta_struct, span_links, etc.
+			err = r.skip()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode field %s failed: %s", key, err)
+		}
+	}
+	return span, nil
+}
+
+func readStringMap(r *msgpReader) (map[string]string, error) {
+	n, err := r.readMapHeader()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		k, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		v, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+func readFloatMap(r *msgpReader) (map[string]float64, error) {
+	n, err := r.readMapHeader()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]float64, n)
+	for i := 0; i < n; i++ {
+		k, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		v, err := r.readFloat64()
+		if err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+// v0.5 payload is an array of 2 elements: the string dictionary and the traces,
+// all strings of the spans are replaced by the index in the dictionary, and each span is an array of 12 elements:
+// [service, name, resource, trace_id, span_id, parent_id, start, duration, error, meta, metrics, type]
+func decodeV05(data []byte) ([][]*ddSpan, error) {
+	r := newMsgpReader(data)
+	n, err := r.readArrayHeader()
+	if err != nil {
+		return nil, err
+	}
+	if n != 2 {
+		return nil, fmt.Errorf("invalid v0.5 payload, expect 2 elements but got %d", n)
+	}
+	dictSize, err := r.readArrayHeader()
+	if err != nil {
+		return nil, err
+	}
+	dict := make([]string, 0, dictSize)
+	for i := 0; i < dictSize; i++ {
+		s, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		dict = append(dict, s)
+	}
+	lookup := func() (string, error) {
+		index, err := r.readUint64()
+		if err != nil {
+			return "", err
+		}
+		if index >= uint64(len(dict)) {
+			return "", fmt.Errorf("string index %d out of dictionary size %d", index, len(dict))
+		}
+		return dict[index], nil
+	}
+
+	traceCount, err := r.readArrayHeader()
+	if err != nil {
+		return nil, err
+	}
+	traces := make([][]*ddSpan, 0, traceCount)
+	for i := 0; i < traceCount; i++ {
+		spanCount, err := r.readArrayHeader()
+		if err != nil {
+			return nil, err
+		}
+		trace := make([]*ddSpan, 0, spanCount)
+		for j := 0; j < spanCount; j++ {
+			span, err := decodeV05Span(r, lookup)
+			if err != nil {
+				return nil, err
+			}
+			trace = append(trace, span)
+		}
+		traces = append(traces, trace)
+	}
+	return traces, nil
+}
+
+func decodeV05Span(r *msgpReader, lookup func() (string, error)) (*ddSpan, error) {
+	fieldCount, err := r.readArrayHeader()
+	if err != nil {
+		return nil, err
+	}
+	if fieldCount != V05_SPAN_FIELD_COUNT {
+		return nil, fmt.Errorf("invalid v0.5 span, expect %d fields but got %d", V05_SPAN_FIELD_COUNT, fieldCount)
+	}
+	span := &ddSpan{}
+	if span.Service, err = lookup(); err != nil {
+		return nil, err
+	}
+	if span.Name, err = lookup(); err != nil {
+		return nil, err
+	}
+	if span.Resource, err = lookup(); err != nil {
+		return nil, err
+	}
+	if span.TraceID, err = r.readUint64(); err != nil {
+		return nil, err
+	}
+	if span.SpanID, err = r.readUint64(); err != nil {
+		return nil, err
+	}
+	if span.ParentID, err = r.readUint64(); err != nil {
+		return nil, err
+	}
+	if span.Start, err = r.readInt64(); err != nil {
+		return nil, err
+	}
+	if span.Duration, err = r.readInt64(); err != nil {
+		return nil, err
+	}
+	errFlag, err := r.readInt64()
+	if err != nil {
+		return nil, err
+	}
+	span.Error = int32(errFlag)
+
+	n, err := r.readMapHeader()
+	if err != nil {
+		return nil, err
+	}
+	span.Meta = make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		k, err := lookup()
+		if err != nil {
+			return nil, err
+		}
+		v, err := lookup()
+		if err != nil {
+			return nil, err
+		}
+		span.Meta[k] = v
+	}
+
+	n, err = r.readMapHeader()
+	if err != nil {
+		return nil, err
+	}
+	span.Metrics = make(map[string]float64, n)
+	for i := 0; i < n; i++ {
+		k, err := lookup()
+		if err != nil {
+			return nil, err
+		}
+		v, err := r.readFloat64()
+		if err != nil {
+			return nil, err
+		}
+		span.Metrics[k] = v
+	}
+
+	if span.Type, err = lookup(); err != nil {
+		return nil, err
+	}
+	return span, nil
+}
+
+func spanToL7FlowLog(vtapID, orgId, teamId uint16, span *ddSpan, peerIP []byte, headers map[string]string, platformData *grpc.PlatformInfoTable, cfg *flowlogCfg.Config) *log_data.L7FlowLog {
+	h := log_data.AcquireL7FlowLog()
+	h.GenID(uint32((span.Start+span.Duration)/int64(time.Second)), platformData)
+	h.VtapID, h.OrgId, h.TeamID = vtapID, orgId, teamId
+	fillSpan(h, span, peerIP, headers, platformData, cfg)
+	return h
+}
+
+// the 'span.kind' in meta is preferred, otherwise it is determined by the span type
+func spanTapSide(span *ddSpan) (flow_metrics.TAPSideEnum, uint8) {
+	switch span.Meta["span.kind"] {
+	case "server":
+		return flow_metrics.ServerApp, 2 // SPAN_KIND_SERVER
+	case "consumer":
+		return flow_metrics.ServerApp, 5 // SPAN_KIND_CONSUMER
+	case "client":
+		return flow_metrics.ClientApp, 3 // SPAN_KIND_CLIENT
+	case "producer":
+		return flow_metrics.ClientApp, 4 // SPAN_KIND_PRODUCER
+	case "internal":
+		return flow_metrics.App, 1 // SPAN_KIND_INTERNAL
+	}
+	switch span.Type {
+	case "web":
+		return flow_metrics.ServerApp, 2
+	case "http", "grpc", "sql", "db", "cache", "redis", "memcached", "mongodb", "cassandra", "elasticsearch", "queue":
+		return flow_metrics.ClientApp, 3
+	default:
+		return flow_metrics.App, 1
+	}
+}
+
+// returns the l7 protocol string which can be parsed by log_data.ParseL7Protocol
+func spanL7ProtocolStr(span *ddSpan) string {
+	if system := span.Meta["db.system"]; system != "" {
+		return system
+	}
+	if system := span.Meta["messaging.system"]; system != "" {
+		return system
+	}
+	if system := span.Meta["rpc.system"]; system != "" {
+		return system
+	}
+	switch span.Type {
+	case "web", "http":
+		return datatype.L7_PROTOCOL_HTTP_1.String(false)
+	case "grpc":
+		return datatype.L7_PROTOCOL_GRPC.String(false)
+	case "sql", "db":
+		return span.Meta["db.type"]
+	case "redis", "mongodb":
+		return span.Type
+	}
+	if strings.HasPrefix(span.Name, "kafka.") {
+		return datatype.L7_PROTOCOL_KAFKA.String(false)
+	}
+	return ""
+}
+
+func parseIP(ip net.IP) (uint32, net.IP, bool) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return utils.IpToUint32(ip4), nil, true
+	}
+	return 0, ip, false
+}
+
+func fillIPs(h *log_data.L7FlowLog, appIP net.IP, span *ddSpan) {
+	h.IsIPv4 = true
+	isClient := h.TapSide == flow_metrics.ClientApp.String()
+	if len(appIP) == net.IPv4len || len(appIP) == net.IPv6len {
+		ip4, ip6, isIPv4 := parseIP(appIP)
+		h.IsIPv4 = isIPv4
+		if isClient {
+			h.IP40, h.IP60 = ip4, ip6
+		} else {
+			h.IP41, h.IP61 = ip4, ip6
+		}
+	}
+
+	var remote string
+	if isClient {
+		remote = span.Meta["network.destination.ip"]
+		if remote == "" {
+			remote = span.Meta["out.host"]
+		}
+		port := span.Meta["network.destination.port"]
+		if port == "" {
+			port = span.Meta["out.port"]
+		}
+		if port == "" {
+			if v, ok := span.Metrics["network.destination.port"]; ok {
+				port = strconv.Itoa(int(v))
+			} else if v, ok := span.Metrics["out.port"]; ok {
+				port = strconv.Itoa(int(v))
+			}
+		}
+		if p, err := strconv.Atoi(port); err == nil {
+			h.ServerPort = uint16(p)
+		}
+	} else {
+		remote = span.Meta["network.client.ip"]
+		if remote == "" {
+			remote = span.Meta["http.client_ip"]
+		}
+	}
+	ip := net.ParseIP(remote)
+	if ip == nil {
+		return
+	}
+	ip4, ip6, isIPv4 := parseIP(ip)
+	h.IsIPv4 = h.IsIPv4 && isIPv4
+	if isClient {
+		h.IP41, h.IP61 = ip4, ip6
+	} else {
+		h.IP40, h.IP60 = ip4, ip6
+	}
+}
+
+func fillMeta(h *log_data.L7FlowLog, span *ddSpan) {
+	keys := make([]string, 0, len(span.Meta))
+	for k := range span.Meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attributeNames, attributeValues := make([]string, 0, len(keys)+2), make([]string, 0, len(keys)+2)
+	httpURL := ""
+	for _, k := range keys {
+		v := span.Meta[k]
+		switch k {
+		case "http.method", "db.operation", "rpc.method", "messaging.operation":
+			h.RequestType = v
+		case "http.status_code":
+			if code, err := strconv.Atoi(v); err == nil {
+				h.SetResponseCode(int32(code))
+			}
+		case "http.url":
+			httpURL = v
+		case "http.host", "peer.hostname", "db.instance", "db.name", "messaging.destination", "kafka.topic":
+			if h.RequestDomain == "" {
+				h.RequestDomain = v
+			}
+		case "http.version":
+			h.Version = v
+		case "error.msg", "error.message":
+			h.ResponseException = v
+		}
+		attributeNames = append(attributeNames, k)
+		attributeValues = append(attributeValues, v)
+	}
+	if httpURL != "" {
+		if path, err := log_data.ParseUrlPath(httpURL); err == nil {
+			h.RequestResource = path
+		}
+	}
+	if h.RequestResource == "" && span.Type != "web" && span.Type != "http" {
+		// for db/cache/mq spans, the resource is the statement, command or topic
+		h.RequestResource = span.Resource
+	}
+	attributeNames = append(attributeNames, "dd.span.name", "dd.span.type")
+	attributeValues = append(attributeValues, span.Name, span.Type)
+	h.AttributeNames, h.AttributeValues = attributeNames, attributeValues
+
+	metricsNames, metricsValues := make([]string, 0, len(span.Metrics)), make([]float64, 0, len(span.Metrics))
+	for k := range span.Metrics {
+		metricsNames = append(metricsNames, k)
+	}
+	sort.Strings(metricsNames)
+	for _, k := range metricsNames {
+		metricsValues = append(metricsValues, span.Metrics[k])
+	}
+	h.MetricsNames, h.MetricsValues = metricsNames, metricsValues
+}
+
+func fillSpan(h *log_data.L7FlowLog, span *ddSpan, peerIP []byte, headers map[string]string, platformData *grpc.PlatformInfoTable, cfg *flowlogCfg.Config) {
+	fillSpanFields(h, span, peerIP, headers, cfg)
+	h.L7Base.KnowledgeGraph.FillOTel(h, platformData)
+	// only show data for services as 'server side'
+	if h.TapSide == flow_metrics.ServerApp.String() && h.ServerPort == 0 {
+		h.ServerPort = 65535
+	}
+}
+
+// fills the fields converted from the span, excluding the knowledge graph which depends on the platform data
+func fillSpanFields(h *log_data.L7FlowLog, span *ddSpan, peerIP []byte, headers map[string]string, cfg *flowlogCfg.Config) {
+	// Datadog data net protocol always set to TCP
+	h.Protocol = uint8(layers.IPProtocolTCP)
+	h.TapType = uint8(datatype.TAP_CLOUD)
+	h.Type = uint8(datatype.MSG_T_SESSION)
+	h.TapPortType = datatype.TAPPORT_FROM_OTEL
+	h.SignalSource = uint16(datatype.SIGNAL_SOURCE_OTEL)
+
+	// use decimal ids, which are the same as the values of the 'x-datadog-trace-id' and 'x-datadog-parent-id' headers
+	h.TraceId = strconv.FormatUint(span.TraceID, 10)
+	h.TraceIdIndex = log_data.ParseTraceIdIndex(h.TraceId, &cfg.Base.TraceIdWithIndex)
+	h.SpanId = strconv.FormatUint(span.SpanID, 10)
+	if span.ParentID != 0 {
+		h.ParentSpanId = strconv.FormatUint(span.ParentID, 10)
+	}
+
+	tapSide, spanKind := spanTapSide(span)
+	h.TapSideEnum = uint8(tapSide)
+	h.TapSide = tapSide.String()
+	h.SetSpanKind(spanKind)
+	h.Endpoint = span.Resource
+	h.AppService = span.Service
+	h.AppInstance = headers[HEADER_CONTAINER_ID]
+	if h.AppInstance == "" {
+		h.AppInstance = span.Meta["_dd.hostname"]
+	}
+
+	h.L7Base.StartTime = span.Start / int64(time.Microsecond)
+	h.L7Base.EndTime = (span.Start + span.Duration) / int64(time.Microsecond)
+	if h.L7Base.EndTime > h.L7Base.StartTime {
+		h.ResponseDuration = uint64(h.L7Base.EndTime - h.L7Base.StartTime)
+	}
+	h.L7Base.Time = uint32((span.Start + span.Duration) / int64(time.Second))
+
+	fillMeta(h, span)
+	h.L7ProtocolStr = spanL7ProtocolStr(span)
+	h.L7Protocol, h.IsTLS = log_data.ParseL7Protocol(h.L7ProtocolStr, h.Version)
+	fillIPs(h, net.IP(peerIP), span)
+
+	// the http status code is preferred
+	if code := h.GetResponseCode(); code != 0 {
+		h.ResponseStatus = uint8(log_data.HttpCodeToResponseStatus(code))
+		if h.ResponseException == "" && (h.ResponseStatus == uint8(datatype.STATUS_CLIENT_ERROR) ||
+			h.ResponseStatus == uint8(datatype.STATUS_SERVER_ERROR)) {
+			h.ResponseException = log_data.GetHTTPExceptionDesc(uint16(code))
+		}
+	} else {
+		h.ResponseStatus = uint8(datatype.STATUS_OK)
+	}
+	if span.Error != 0 {
+		if h.ResponseStatus == uint8(datatype.STATUS_OK) {
+			h.ResponseStatus = uint8(datatype.STATUS_SERVER_ERROR)
+		}
+	} else if h.ResponseStatus == uint8(datatype.STATUS_OK) {
+		h.ResponseException = ""
+	}
 }
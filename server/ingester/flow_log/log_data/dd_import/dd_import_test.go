@@ -0,0 +1,246 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dd_import
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/deepflowio/deepflow/server/ingester/config"
+	flowlogCfg "github.com/deepflowio/deepflow/server/ingester/flow_log/config"
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/log_data"
+	"github.com/deepflowio/deepflow/server/libs/datatype"
+)
+
+// mpWriter builds msgpack payloads for the test fixtures
+type mpWriter []byte
+
+func (w mpWriter) str(s string) mpWriter {
+	if len(s) < 32 {
+		w = append(w, 0xa0|byte(len(s)))
+	} else {
+		w = append(w, mpStr8, byte(len(s)))
+	}
+	return append(w, s...)
+}
+
+func (w mpWriter) uint(v uint64) mpWriter {
+	return binary.BigEndian.AppendUint64(append(w, mpUint64), v)
+}
+
+func (w mpWriter) int(v int64) mpWriter {
+	return binary.BigEndian.AppendUint64(append(w, mpInt64), uint64(v))
+}
+
+func (w mpWriter) float(v float64) mpWriter {
+	return binary.BigEndian.AppendUint64(append(w, mpFloat64), math.Float64bits(v))
+}
+
+func (w mpWriter) array(n int) mpWriter {
+	return append(w, 0x90|byte(n))
+}
+
+func (w mpWriter) mapHeader(n int) mpWriter {
+	return append(w, 0x80|byte(n))
+}
+
+var expectedSpan = &ddSpan{
+	Service:  "web",
+	Name:     "http.request",
+	Resource: "GET /users",
+	TraceID:  math.MaxUint64 - 1,
+	SpanID:   456,
+	ParentID: 123,
+	Start:    1700000000000000000,
+	Duration: 2500000,
+	Error:    1,
+	Meta:     map[string]string{"http.status_code": "500", "http.method": "GET"},
+	Metrics:  map[string]float64{"_sampling_priority_v1": 2},
+	Type:     "web",
+}
+
+func v04Payload() []byte {
+	w := mpWriter{}.array(1).array(1).mapHeader(13)
+	w = w.str("service").str("web")
+	w = w.str("name").str("http.request")
+	w = w.str("resource").str("GET /users")
+	w = w.str("trace_id").uint(math.MaxUint64 - 1)
+	w = w.str("span_id").uint(456)
+	w = w.str("parent_id").int(123)
+	w = w.str("start").int(1700000000000000000)
+	w = w.str("duration").int(2500000)
+	w = w.str("error").int(1)
+	w = w.str("type").str("web")
+	w = w.str("meta").mapHeader(2).str("http.status_code").str("500").str("http.method").str("GET")
+	w = w.str("metrics").mapHeader(1).str("_sampling_priority_v1").float(2)
+	// unknown fields are skipped
+	w = w.str("meta_struct").mapHeader(1).str("appsec").array(2).int(1).str("x")
+	return w
+}
+
+func v05Payload() []byte {
+	dict := []string{"", "web", "http.request", "GET /users", "http.status_code", "500", "http.method", "GET", "_sampling_priority_v1"}
+	w := mpWriter{}.array(2).array(len(dict))
+	for _, s := range dict {
+		w = w.str(s)
+	}
+	w = w.array(1).array(1).array(V05_SPAN_FIELD_COUNT)
+	w = w.uint(1).uint(2).uint(3)
+	w = w.uint(math.MaxUint64 - 1).uint(456).uint(123)
+	w = w.int(1700000000000000000).int(2500000).int(1)
+	w = w.mapHeader(2).uint(4).uint(5).uint(6).uint(7)
+	w = w.mapHeader(1).uint(8).float(2)
+	w = w.uint(1)
+	return w
+}
+
+func TestDecodeTraces(t *testing.T) {
+	json := `[[{"service":"web","name":"http.request","resource":"GET /users","trace_id":18446744073709551614,"span_id":456,"parent_id":123,
+		"start":1700000000000000000,"duration":2500000,"error":1,"meta":{"http.status_code":"500","http.method":"GET"},
+		"metrics":{"_sampling_priority_v1":2},"type":"web"}]]`
+	cases := []struct {
+		name, uri, contentType string
+		data                   []byte
+	}{
+		{"v0.3 json", URI_V03, "application/json", []byte(json)},
+		{"v0.4 msgpack", URI_V04, "application/msgpack", v04Payload()},
+		{"v0.5 msgpack", URI_V05, "application/msgpack", v05Payload()},
+	}
+	for _, c := range cases {
+		traces, err := decodeTraces(c.data, c.uri, c.contentType)
+		if err != nil {
+			t.Errorf("%s: decode failed: %s", c.name, err)
+			continue
+		}
+		if len(traces) != 1 || len(traces[0]) != 1 {
+			t.Errorf("%s: unexpected traces %v", c.name, traces)
+			continue
+		}
+		if !reflect.DeepEqual(traces[0][0], expectedSpan) {
+			t.Errorf("%s: expected %+v, got %+v", c.name, expectedSpan, traces[0][0])
+		}
+	}
+}
+
+func TestDecodeInvalidPayload(t *testing.T) {
+	v04, v05 := v04Payload(), v05Payload()
+	cases := []struct {
+		name, uri string
+		data      []byte
+	}{
+		{"v0.4 truncated", URI_V04, v04[:len(v04)-3]},
+		{"v0.5 truncated", URI_V05, v05[:len(v05)-3]},
+		{"v0.4 oversized trace count", URI_V04, []byte{mpArray32, 0xff, 0xff, 0xff, 0xff}},
+		{"v0.4 oversized span count", URI_V04, []byte{0x91, mpArray32, 0xff, 0xff, 0xff, 0xff, 0x80}},
+		{"v0.4 oversized meta count", URI_V04, append(mpWriter{}.array(1).array(1).mapHeader(1).str("meta"), mpMap32, 0xff, 0xff, 0xff, 0xff)},
+		{"v0.5 oversized dictionary", URI_V05, []byte{0x92, mpArray32, 0xff, 0xff, 0xff, 0xff, 0x90}},
+		{"v0.5 oversized meta count", URI_V05, append(mpWriter{}.array(2).array(1).str("").array(1).array(1).array(V05_SPAN_FIELD_COUNT).
+			uint(0).uint(0).uint(0).uint(1).uint(2).uint(0).int(0).int(0).int(0), mpMap32, 0xff, 0xff, 0xff, 0xff)},
+		{"v0.5 string index out of range", URI_V05, mpWriter{}.array(2).array(1).str("").array(1).array(1).array(V05_SPAN_FIELD_COUNT).uint(9)},
+	}
+	for _, c := range cases {
+		if _, err := decodeTraces(c.data, c.uri, "application/msgpack"); err == nil {
+			t.Errorf("%s: expected error", c.name)
+		}
+	}
+}
+
+func nestedArrays(depth int) mpWriter {
+	w := mpWriter{}
+	for i := 0; i < depth; i++ {
+		w = w.array(1)
+	}
+	return w.int(1)
+}
+
+func TestSkipMaxDepth(t *testing.T) {
+	if err := newMsgpReader(nestedArrays(maxSkipDepth - 1)).skip(); err != nil {
+		t.Errorf("expected no error, got %s", err)
+	}
+	if err := newMsgpReader(nestedArrays(maxSkipDepth)).skip(); err != errMaxDepth {
+		t.Errorf("expected %s, got %v", errMaxDepth, err)
+	}
+	// unknown fields of the span are skipped with the depth limit
+	data := append(mpWriter{}.array(1).array(1).mapHeader(1).str("meta_struct"), nestedArrays(1000)...)
+	if _, err := decodeTraces(data, URI_V04, "application/msgpack"); err == nil {
+		t.Error("expected error for deeply nested payload")
+	}
+}
+
+func TestFillSpanFields(t *testing.T) {
+	cfg := &flowlogCfg.Config{Base: &config.Config{TraceIdWithIndex: config.TraceIdWithIndex{Disabled: true}}}
+	peerIP := []byte{192, 168, 1, 1}
+
+	// a web span is a server span, the app ip is the server ip
+	h := &log_data.L7FlowLog{}
+	fillSpanFields(h, expectedSpan, peerIP, map[string]string{HEADER_CONTAINER_ID: "container-1"}, cfg)
+	if h.TraceId != "18446744073709551614" || h.SpanId != "456" || h.ParentSpanId != "123" {
+		t.Errorf("unexpected ids %s %s %s", h.TraceId, h.SpanId, h.ParentSpanId)
+	}
+	if h.TapSide != "s-app" || h.SpanKind != 2 {
+		t.Errorf("unexpected tap side %s, span kind %d", h.TapSide, h.SpanKind)
+	}
+	if h.Endpoint != "GET /users" || h.AppService != "web" || h.AppInstance != "container-1" {
+		t.Errorf("unexpected endpoint %s, app service %s, app instance %s", h.Endpoint, h.AppService, h.AppInstance)
+	}
+	if h.L7Base.StartTime != 1700000000000000 || h.ResponseDuration != 2500 || h.L7Base.Time != 1700000000 {
+		t.Errorf("unexpected start time %d, duration %d, time %d", h.L7Base.StartTime, h.ResponseDuration, h.L7Base.Time)
+	}
+	if h.L7Protocol != uint8(datatype.L7_PROTOCOL_HTTP_1) || h.RequestType != "GET" {
+		t.Errorf("unexpected l7 protocol %d, request type %s", h.L7Protocol, h.RequestType)
+	}
+	if h.GetResponseCode() != 500 || h.ResponseStatus != uint8(datatype.STATUS_SERVER_ERROR) ||
+		h.ResponseException != log_data.GetHTTPExceptionDesc(500) {
+		t.Errorf("unexpected response code %d, status %d, exception %s", h.GetResponseCode(), h.ResponseStatus, h.ResponseException)
+	}
+	if !h.IsIPv4 || h.IP41 != 0xc0a80101 || h.IP40 != 0 {
+		t.Errorf("unexpected ips %x %x", h.IP40, h.IP41)
+	}
+	if !reflect.DeepEqual(h.MetricsNames, []string{"_sampling_priority_v1"}) || !reflect.DeepEqual(h.MetricsValues, []float64{2}) {
+		t.Errorf("unexpected metrics %v %v", h.MetricsNames, h.MetricsValues)
+	}
+
+	// a db client span, the remote address is the server ip and port
+	span := &ddSpan{
+		Service:  "web",
+		Name:     "mysql.query",
+		Resource: "SELECT 1",
+		TraceID:  1,
+		SpanID:   2,
+		Start:    1700000000000000000,
+		Duration: 1000000,
+		Type:     "sql",
+		Meta:     map[string]string{"span.kind": "client", "db.system": "mysql", "out.host": "10.0.0.2", "_dd.hostname": "host-1"},
+		Metrics:  map[string]float64{"out.port": 3306},
+	}
+	h = &log_data.L7FlowLog{}
+	fillSpanFields(h, span, peerIP, nil, cfg)
+	if h.ParentSpanId != "" || h.TapSide != "c-app" || h.SpanKind != 3 || h.AppInstance != "host-1" {
+		t.Errorf("unexpected parent span id %s, tap side %s, span kind %d, app instance %s", h.ParentSpanId, h.TapSide, h.SpanKind, h.AppInstance)
+	}
+	if h.L7Protocol != uint8(datatype.L7_PROTOCOL_MYSQL) || h.RequestResource != "SELECT 1" {
+		t.Errorf("unexpected l7 protocol %d, request resource %s", h.L7Protocol, h.RequestResource)
+	}
+	if h.IP40 != 0xc0a80101 || h.IP41 != 0x0a000002 || h.ServerPort != 3306 {
+		t.Errorf("unexpected ips %x %x, server port %d", h.IP40, h.IP41, h.ServerPort)
+	}
+	if h.ResponseStatus != uint8(datatype.STATUS_OK) || h.ResponseException != "" {
+		t.Errorf("unexpected status %d, exception %s", h.ResponseStatus, h.ResponseException)
+	}
+}
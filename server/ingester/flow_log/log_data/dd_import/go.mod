@@ -1,3 +1,8 @@
 module github.com/deepflowio/deepflow/server/ingester/flow_log/log_data/dd_import
 
-go 1.18
\ No newline at end of file
+go 1.23
+
+require (
+	github.com/goccy/go-json v0.11.2
+	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7
+)
@@ -0,0 +1,356 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dd_import
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// a minimal msgpack reader which only supports the types used by the datadog trace payloads
+// refer to: https://github.com/msgpack/msgpack/blob/master/spec.md
+
+var (
+	errShortBuffer = errors.New("msgpack: short buffer")
+	errMaxDepth    = errors.New("msgpack: max nesting depth exceeded")
+)
+
+// the max nesting depth of the arrays and maps skipped, the span fields are nested no more than a few levels
+const maxSkipDepth = 32
+
+const (
+	mpNil     = 0xc0
+	mpFalse   = 0xc2
+	mpTrue    = 0xc3
+	mpBin8    = 0xc4
+	mpBin16   = 0xc5
+	mpBin32   = 0xc6
+	mpExt8    = 0xc7
+	mpExt16   = 0xc8
+	mpExt32   = 0xc9
+	mpFloat32 = 0xca
+	mpFloat64 = 0xcb
+	mpUint8   = 0xcc
+	mpUint16  = 0xcd
+	mpUint32  = 0xce
+	mpUint64  = 0xcf
+	mpInt8    = 0xd0
+	mpInt16   = 0xd1
+	mpInt32   = 0xd2
+	mpInt64   = 0xd3
+	mpFixExt1 = 0xd4
+	mpStr8    = 0xd9
+	mpStr16   = 0xda
+	mpStr32   = 0xdb
+	mpArray16 = 0xdc
+	mpArray32 = 0xdd
+	mpMap16   = 0xde
+	mpMap32   = 0xdf
+)
+
+type msgpReader struct {
+	buf    []byte
+	offset int
+}
+
+func newMsgpReader(buf []byte) *msgpReader {
+	return &msgpReader{buf: buf}
+}
+
+func (r *msgpReader) isEnd() bool {
+	return r.offset >= len(r.buf)
+}
+
+func (r *msgpReader) next(n int) ([]byte, error) {
+	if n < 0 || r.offset+n > len(r.buf) {
+		return nil, errShortBuffer
+	}
+	b := r.buf[r.offset : r.offset+n]
+	r.offset += n
+	return b, nil
+}
+
+func (r *msgpReader) readByte() (byte, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *msgpReader) peekByte() (byte, error) {
+	if r.offset >= len(r.buf) {
+		return 0, errShortBuffer
+	}
+	return r.buf[r.offset], nil
+}
+
+func (r *msgpReader) readUint(size int) (uint64, error) {
+	b, err := r.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+func (r *msgpReader) remaining() int {
+	return len(r.buf) - r.offset
+}
+
+// readHeader returns the number of elements of the array or map, each element takes at least minSize bytes,
+// so a count larger than the remaining bytes is rejected before the caller preallocates memory for it
+func (r *msgpReader) readHeader(fixMask, fixMax byte, code16, code32 byte, minSize int, name string) (int, error) {
+	c, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	switch {
+	case c == mpNil:
+		return 0, nil
+	case c >= fixMask && c <= fixMax:
+		return int(c - fixMask), nil
+	case c == code16:
+		n, err = r.readUint(2)
+	case c == code32:
+		n, err = r.readUint(4)
+	default:
+		return 0, fmt.Errorf("msgpack: unexpected code 0x%x for %s", c, name)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(r.remaining()/minSize) {
+		return 0, fmt.Errorf("msgpack: %s length %d exceeds the remaining %d bytes", name, n, r.remaining())
+	}
+	return int(n), nil
+}
+
+func (r *msgpReader) readArrayHeader() (int, error) {
+	return r.readHeader(0x90, 0x9f, mpArray16, mpArray32, 1, "array")
+}
+
+// each key-value pair of the map takes at least 2 bytes
+func (r *msgpReader) readMapHeader() (int, error) {
+	return r.readHeader(0x80, 0x8f, mpMap16, mpMap32, 2, "map")
+}
+
+func (r *msgpReader) readStringBytes() ([]byte, error) {
+	c, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	var n uint64
+	switch {
+	case c == mpNil:
+		return nil, nil
+	case c >= 0xa0 && c <= 0xbf:
+		n = uint64(c - 0xa0)
+	case c == mpStr8 || c == mpBin8:
+		n, err = r.readUint(1)
+	case c == mpStr16 || c == mpBin16:
+		n, err = r.readUint(2)
+	case c == mpStr32 || c == mpBin32:
+		n, err = r.readUint(4)
+	default:
+		// some tracers encode the numeric ids as string, and vice versa
+		r.offset--
+		v, err := r.readInt64()
+		if err != nil {
+			return nil, fmt.Errorf("msgpack: unexpected code 0x%x for string", c)
+		}
+		return []byte(strconv.FormatInt(v, 10)), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.next(int(n))
+}
+
+func (r *msgpReader) readString() (string, error) {
+	b, err := r.readStringBytes()
+	return string(b), err
+}
+
+func (r *msgpReader) readUint64() (uint64, error) {
+	c, err := r.peekByte()
+	if err != nil {
+		return 0, err
+	}
+	if c == mpUint64 {
+		r.offset++
+		return r.readUint(8)
+	}
+	v, err := r.readInt64()
+	return uint64(v), err
+}
+
+func (r *msgpReader) readInt64() (int64, error) {
+	c, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c == mpNil:
+		return 0, nil
+	case c == mpFalse:
+		return 0, nil
+	case c == mpTrue:
+		return 1, nil
+	case c == mpUint8:
+		u, err = r.readUint(1)
+	case c == mpUint16:
+		u, err = r.readUint(2)
+	case c == mpUint32:
+		u, err = r.readUint(4)
+	case c == mpUint64:
+		u, err = r.readUint(8)
+	case c == mpInt8:
+		u, err = r.readUint(1)
+		return int64(int8(u)), err
+	case c == mpInt16:
+		u, err = r.readUint(2)
+		return int64(int16(u)), err
+	case c == mpInt32:
+		u, err = r.readUint(4)
+		return int64(int32(u)), err
+	case c == mpInt64:
+		u, err = r.readUint(8)
+	case c == mpFloat32:
+		u, err = r.readUint(4)
+		return int64(math.Float32frombits(uint32(u))), err
+	case c == mpFloat64:
+		u, err = r.readUint(8)
+		return int64(math.Float64frombits(u)), err
+	default:
+		return 0, fmt.Errorf("msgpack: unexpected code 0x%x for integer", c)
+	}
+	return int64(u), err
+}
+
+func (r *msgpReader) readFloat64() (float64, error) {
+	c, err := r.peekByte()
+	if err != nil {
+		return 0, err
+	}
+	switch c {
+	case mpFloat32:
+		r.offset++
+		u, err := r.readUint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case mpFloat64:
+		r.offset++
+		u, err := r.readUint(8)
+		return math.Float64frombits(u), err
+	case mpUint64:
+		u, err := r.readUint64()
+		return float64(u), err
+	default:
+		v, err := r.readInt64()
+		return float64(v), err
+	}
+}
+
+// skip skips the next object, including all the elements of the array or map
+func (r *msgpReader) skip() error {
+	return r.skipDepth(1)
+}
+
+func (r *msgpReader) skipDepth(depth int) error {
+	if depth > maxSkipDepth {
+		return errMaxDepth
+	}
+	c, err := r.peekByte()
+	if err != nil {
+		return err
+	}
+	switch {
+	case c <= 0x7f || c >= 0xe0 || c == mpNil || c == mpFalse || c == mpTrue:
+		r.offset++
+		return nil
+	case (c >= 0xa0 && c <= 0xbf) || c == mpStr8 || c == mpStr16 || c == mpStr32 ||
+		c == mpBin8 || c == mpBin16 || c == mpBin32:
+		_, err = r.readStringBytes()
+		return err
+	case (c >= 0x90 && c <= 0x9f) || c == mpArray16 || c == mpArray32:
+		n, err := r.readArrayHeader()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := r.skipDepth(depth + 1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case (c >= 0x80 && c <= 0x8f) || c == mpMap16 || c == mpMap32:
+		n, err := r.readMapHeader()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n*2; i++ {
+			if err := r.skipDepth(depth + 1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case c == mpFloat32 || c == mpFloat64:
+		_, err = r.readFloat64()
+		return err
+	case c >= mpUint8 && c <= mpInt64:
+		_, err = r.readInt64()
+		return err
+	case c >= mpFixExt1 && c <= mpFixExt1+4:
+		_, err = r.next(2 + 1<<(c-mpFixExt1))
+		return err
+	case c == mpExt8 || c == mpExt16 || c == mpExt32:
+		r.offset++
+		var n uint64
+		switch c {
+		case mpExt8:
+			n, err = r.readUint(1)
+		case mpExt16:
+			n, err = r.readUint(2)
+		default:
+			n, err = r.readUint(4)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = r.next(int(n) + 1)
+		return err
+	default:
+		return fmt.Errorf("msgpack: unknown code 0x%x", c)
+	}
+}
@@ -467,6 +467,26 @@ func (h *L7FlowLog) SetID(id uint64) {
 	h._id = id
 }
 
+// GenID generates the '_id' for L7FlowLogs imported from third-party tracing data (SkyWalking, Datadog, etc.)
+func (h *L7FlowLog) GenID(endTimeSecond uint32, platformData *grpc.PlatformInfoTable) {
+	h._id = genID(endTimeSecond, &L7FlowLogCounter, platformData.QueryAnalyzerID())
+}
+
+// the following setters are used to fill the nullable columns outside of the package
+func (h *L7FlowLog) SetResponseCode(code int32) {
+	h.responseCode = code
+	h.ResponseCode = &h.responseCode
+}
+
+func (h *L7FlowLog) GetResponseCode() int32 {
+	return h.responseCode
+}
+
+func (h *L7FlowLog) SetSpanKind(kind uint8) {
+	h.SpanKind = kind
+	h.spanKind = &h.SpanKind
+}
+
 func (b *L7Base) Fill(log *pb.AppProtoLogsData, platformData *grpc.PlatformInfoTable) {
 	l := log.Base
 	// 网络层
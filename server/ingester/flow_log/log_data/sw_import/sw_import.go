@@ -17,11 +17,387 @@
 package sw_import
 
 import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/google/gopacket/layers"
+	logging "github.com/op/go-logging"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	agent "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+
 	flowlogCfg "github.com/deepflowio/deepflow/server/ingester/flow_log/config"
 	"github.com/deepflowio/deepflow/server/ingester/flow_log/log_data"
+	"github.com/deepflowio/deepflow/server/libs/datatype"
+	flow_metrics "github.com/deepflowio/deepflow/server/libs/flow-metrics"
 	"github.com/deepflowio/deepflow/server/libs/grpc"
+	"github.com/deepflowio/deepflow/server/libs/utils"
+)
+
+var log = logging.MustGetLogger("flow_log.sw_import")
+
+const (
+	// uri of http reporter, body is json array of SegmentObject
+	URI_HTTP_SEGMENTS = "/v3/segments"
+	// uri of http reporter, body is a json SegmentObject
+	URI_HTTP_SEGMENT = "/v3/segment"
+	// uri of grpc reporter, body is protobuf SegmentCollection
+	URI_GRPC_COLLECT_IN_SYNC = "collectInSync"
 )
 
+// SkyWalking component IDs which can not be identified by the span layer and tags,
+// refer to: https://github.com/apache/skywalking/blob/master/oap-server/server-starter/src/main/resources/component-libraries.yml
+var componentIdToL7Protocol = map[int32]string{
+	3:  "Dubbo",
+	5:  "MySQL",
+	7:  "Redis",
+	9:  "MongoDB",
+	22: "PostgreSQL",
+	23: "gRPC",
+	25: "RocketMQ",
+	27: "Kafka",
+	30: "Redis", // Jedis
+	33: "MySQL", // mysql-connector-java
+	37: "PostgreSQL",
+	38: "RocketMQ",
+	39: "RocketMQ",
+	40: "Kafka",
+	41: "Kafka",
+	42: "MongoDB",
+	43: "SofaRPC",
+	52: "AMQP", // RabbitMQ
+	53: "AMQP",
+	56: "Redis", // Redisson
+	57: "Redis", // Lettuce
+	73: "Pulsar",
+	74: "Pulsar",
+}
+
 func SkyWalkingDataToL7FlowLogs(vtapID, orgId, teamId uint16, segmentData, peerIP []byte, uri string, platformData *grpc.PlatformInfoTable, cfg *flowlogCfg.Config) []*log_data.L7FlowLog {
-	return []*log_data.L7FlowLog{}
+	segments, err := decodeSegments(segmentData, uri)
+	if err != nil {
+		log.Debugf("skywalking data (uri: %s) decode failed: %s", uri, err)
+		return []*log_data.L7FlowLog{}
+	}
+
+	ret := []*log_data.L7FlowLog{}
+	for _, segment := range segments {
+		for _, span := range segment.GetSpans() {
+			if span == nil {
+				continue
+			}
+			ret = append(ret, spanToL7FlowLog(vtapID, orgId, teamId, segment, span, peerIP, platformData, cfg))
+		}
+	}
+	return ret
+}
+
+func decodeSegments(data []byte, uri string) ([]*agent.SegmentObject, error) {
+	switch {
+	case strings.HasSuffix(uri, URI_HTTP_SEGMENTS):
+		rawSegments := []json.RawMessage{}
+		if err := json.Unmarshal(data, &rawSegments); err != nil {
+			return nil, err
+		}
+		segments := make([]*agent.SegmentObject, 0, len(rawSegments))
+		for _, raw := range rawSegments {
+			segment := &agent.SegmentObject{}
+			if err := protojson.Unmarshal(raw, segment); err != nil {
+				return nil, err
+			}
+			segments = append(segments, segment)
+		}
+		return segments, nil
+	case strings.HasSuffix(uri, URI_HTTP_SEGMENT):
+		segment := &agent.SegmentObject{}
+		if err := protojson.Unmarshal(data, segment); err != nil {
+			return nil, err
+		}
+		return []*agent.SegmentObject{segment}, nil
+	case strings.HasSuffix(uri, URI_GRPC_COLLECT_IN_SYNC):
+		collection := &agent.SegmentCollection{}
+		if err := proto.Unmarshal(data, collection); err != nil {
+			return nil, err
+		}
+		return collection.GetSegments(), nil
+	default:
+		// streaming grpc reporter ('collect'), each message is a SegmentObject
+		segment := &agent.SegmentObject{}
+		if err := proto.Unmarshal(data, segment); err != nil {
+			return nil, err
+		}
+		return []*agent.SegmentObject{segment}, nil
+	}
+}
+
+func spanToL7FlowLog(vtapID, orgId, teamId uint16, segment *agent.SegmentObject, span *agent.SpanObject, peerIP []byte, platformData *grpc.PlatformInfoTable, cfg *flowlogCfg.Config) *log_data.L7FlowLog {
+	h := log_data.AcquireL7FlowLog()
+	h.GenID(uint32(span.GetEndTime()/int64(time.Second/time.Millisecond)), platformData)
+	h.VtapID, h.OrgId, h.TeamID = vtapID, orgId, teamId
+	fillSpan(h, segment, span, peerIP, cfg)
+
+	h.L7Base.KnowledgeGraph.FillOTel(h, platformData)
+	// only show data for services as 'server side'
+	if h.TapSide == flow_metrics.ServerApp.String() && h.ServerPort == 0 {
+		h.ServerPort = 65535
+	}
+	return h
+}
+
+// SpanId format is 'SEGMENTID-SPANID', which is the same as the span id decoded from the sw8 header by the agent
+func swSpanId(segmentId string, spanId int32) string {
+	return segmentId + "-" + strconv.Itoa(int(spanId))
+}
+
+func spanTypeToTapSide(spanType agent.SpanType) flow_metrics.TAPSideEnum {
+	switch spanType {
+	case agent.SpanType_Entry:
+		return flow_metrics.ServerApp
+	case agent.SpanType_Exit:
+		return flow_metrics.ClientApp
+	default:
+		return flow_metrics.App
+	}
+}
+
+// converted to the SpanKind of OTel, to be consistent with spans of OTel
+func spanTypeToSpanKind(spanType agent.SpanType, spanLayer agent.SpanLayer) uint8 {
+	switch spanType {
+	case agent.SpanType_Entry:
+		if spanLayer == agent.SpanLayer_MQ {
+			return 5 // SPAN_KIND_CONSUMER
+		}
+		return 2 // SPAN_KIND_SERVER
+	case agent.SpanType_Exit:
+		if spanLayer == agent.SpanLayer_MQ {
+			return 4 // SPAN_KIND_PRODUCER
+		}
+		return 3 // SPAN_KIND_CLIENT
+	default:
+		return 1 // SPAN_KIND_INTERNAL
+	}
+}
+
+func parseIP(ip net.IP) (uint32, net.IP, bool) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return utils.IpToUint32(ip4), nil, true
+	}
+	return 0, ip, false
+}
+
+// fill the IP of the application (where the span is generated) and the IP of the remote peer
+func fillIPs(h *log_data.L7FlowLog, appIP net.IP, remote string) {
+	h.IsIPv4 = true
+	isClient := h.TapSide == flow_metrics.ClientApp.String()
+	if len(appIP) == net.IPv4len || len(appIP) == net.IPv6len {
+		ip4, ip6, isIPv4 := parseIP(appIP)
+		if !isIPv4 {
+			h.IsIPv4 = false
+		}
+		if isClient {
+			h.IP40, h.IP60 = ip4, ip6
+		} else {
+			h.IP41, h.IP61 = ip4, ip6
+		}
+	}
+
+	if remote == "" {
+		return
+	}
+	host, port, err := net.SplitHostPort(remote)
+	if err != nil {
+		host = remote
+	} else if p, err := strconv.Atoi(port); err == nil {
+		h.ServerPort = uint16(p)
+	}
+	if isClient && h.RequestDomain == "" {
+		h.RequestDomain = host
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return
+	}
+	ip4, ip6, isIPv4 := parseIP(ip)
+	if !isIPv4 {
+		h.IsIPv4 = false
+	}
+	// for the exit span, the remote is the server; for the entry span, the address used by the client is also the server
+	if isClient {
+		h.IP41, h.IP61 = ip4, ip6
+	} else if h.IP41 == 0 && len(h.IP61) == 0 {
+		h.IP41, h.IP61 = ip4, ip6
+	}
+}
+
+type spanLog struct {
+	TimeUnixNano int64             `json:"time_unix_nano"`
+	Name         string            `json:"name"`
+	Attributes   map[string]string `json:"attributes"`
+}
+
+func fillLogs(h *log_data.L7FlowLog, logs []*agent.Log) {
+	if len(logs) == 0 {
+		return
+	}
+	events := make([]spanLog, 0, len(logs))
+	for _, l := range logs {
+		event := spanLog{
+			TimeUnixNano: l.GetTime() * int64(time.Millisecond),
+			Attributes:   make(map[string]string, len(l.GetData())),
+		}
+		for _, kv := range l.GetData() {
+			event.Attributes[kv.GetKey()] = kv.GetValue()
+			switch kv.GetKey() {
+			case "event":
+				event.Name = kv.GetValue()
+			case "error.kind", "message":
+				if h.ResponseStatus == uint8(datatype.STATUS_SERVER_ERROR) && h.ResponseException == "" {
+					h.ResponseException = kv.GetValue()
+				}
+			}
+		}
+		events = append(events, event)
+	}
+	if eventsJSON, err := json.Marshal(events); err == nil {
+		h.Events = string(eventsJSON)
+	}
+}
+
+// returns the value of tag 'db.type' or 'cache.type'
+func fillTags(h *log_data.L7FlowLog, span *agent.SpanObject) string {
+	dbType := ""
+	attributeNames, attributeValues := []string{}, []string{}
+	httpURL := ""
+	for _, tag := range span.GetTags() {
+		key, value := tag.GetKey(), tag.GetValue()
+		switch key {
+		case "url":
+			httpURL = value
+		case "http.method":
+			h.RequestType = value
+		case "http.status_code", "status_code":
+			if code, err := strconv.Atoi(value); err == nil {
+				h.SetResponseCode(int32(code))
+			}
+		case "db.type", "cache.type":
+			dbType = value
+		case "db.instance":
+			h.RequestDomain = value
+		case "db.statement", "cache.cmd":
+			h.RequestResource = value
+		case "cache.op":
+			h.RequestType = value
+		case "mq.broker":
+			h.RequestDomain = value
+		case "mq.topic", "mq.queue":
+			h.RequestResource = value
+		}
+		attributeNames = append(attributeNames, key)
+		attributeValues = append(attributeValues, value)
+	}
+
+	if httpURL != "" {
+		if h.RequestDomain == "" {
+			h.RequestDomain = httpURL
+			if index := strings.Index(httpURL, "://"); index >= 0 {
+				h.RequestDomain = httpURL[index+3:]
+			}
+			if index := strings.IndexAny(h.RequestDomain, "/?"); index >= 0 {
+				h.RequestDomain = h.RequestDomain[:index]
+			}
+		}
+		if h.RequestResource == "" {
+			if path, err := log_data.ParseUrlPath(httpURL); err == nil {
+				h.RequestResource = path
+			} else {
+				h.RequestResource = httpURL
+			}
+		}
+	}
+	attributeNames = append(attributeNames, "sw8.component_id", "sw8.span_layer")
+	attributeValues = append(attributeValues, strconv.Itoa(int(span.GetComponentId())), span.GetSpanLayer().String())
+
+	h.AttributeNames = attributeNames
+	h.AttributeValues = attributeValues
+	return dbType
+}
+
+func fillL7Protocol(h *log_data.L7FlowLog, span *agent.SpanObject, dbType string) {
+	// the component is more accurate than 'db.type', e.g. 'db.type' of all JDBC spans is 'sql'
+	if protocol, ok := componentIdToL7Protocol[span.GetComponentId()]; ok {
+		h.L7ProtocolStr = protocol
+	} else if span.GetSpanLayer() == agent.SpanLayer_Http {
+		h.L7ProtocolStr = datatype.L7_PROTOCOL_HTTP_1.String(false)
+	} else {
+		h.L7ProtocolStr = dbType
+	}
+	h.L7Protocol, h.IsTLS = log_data.ParseL7Protocol(h.L7ProtocolStr, h.Version)
+}
+
+func fillSpan(h *log_data.L7FlowLog, segment *agent.SegmentObject, span *agent.SpanObject, peerIP []byte, cfg *flowlogCfg.Config) {
+	// SkyWalking data net protocol always set to TCP
+	h.Protocol = uint8(layers.IPProtocolTCP)
+	h.TapType = uint8(datatype.TAP_CLOUD)
+	h.Type = uint8(datatype.MSG_T_SESSION)
+	h.TapPortType = datatype.TAPPORT_FROM_OTEL
+	h.SignalSource = uint16(datatype.SIGNAL_SOURCE_OTEL)
+
+	h.TraceId = segment.GetTraceId()
+	h.TraceIdIndex = log_data.ParseTraceIdIndex(h.TraceId, &cfg.Base.TraceIdWithIndex)
+	h.SpanId = swSpanId(segment.GetTraceSegmentId(), span.GetSpanId())
+	remote := span.GetPeer()
+	if span.GetParentSpanId() >= 0 {
+		h.ParentSpanId = swSpanId(segment.GetTraceSegmentId(), span.GetParentSpanId())
+	}
+	for _, ref := range span.GetRefs() {
+		if ref.GetParentTraceSegmentId() == "" {
+			continue
+		}
+		// cross process or cross thread reference, the parent span is in another segment
+		if h.ParentSpanId == "" {
+			h.ParentSpanId = swSpanId(ref.GetParentTraceSegmentId(), ref.GetParentSpanId())
+		}
+		if remote == "" && ref.GetRefType() == agent.RefType_CrossProcess {
+			remote = ref.GetNetworkAddressUsedAtPeer()
+		}
+		break
+	}
+
+	h.TapSideEnum = uint8(spanTypeToTapSide(span.GetSpanType()))
+	h.TapSide = flow_metrics.TAPSideEnum(h.TapSideEnum).String()
+	h.SetSpanKind(spanTypeToSpanKind(span.GetSpanType(), span.GetSpanLayer()))
+	h.Endpoint = span.GetOperationName()
+	h.AppService = segment.GetService()
+	h.AppInstance = segment.GetServiceInstance()
+
+	h.L7Base.StartTime = span.GetStartTime() * int64(time.Millisecond/time.Microsecond)
+	h.L7Base.EndTime = span.GetEndTime() * int64(time.Millisecond/time.Microsecond)
+	if h.L7Base.EndTime > h.L7Base.StartTime {
+		h.ResponseDuration = uint64(h.L7Base.EndTime - h.L7Base.StartTime)
+	}
+	h.L7Base.Time = uint32(span.GetEndTime() / int64(time.Second/time.Millisecond))
+
+	dbType := fillTags(h, span)
+	fillL7Protocol(h, span, dbType)
+	fillIPs(h, net.IP(peerIP), remote)
+
+	// the http status code is preferred
+	if code := h.GetResponseCode(); code != 0 {
+		h.ResponseStatus = uint8(log_data.HttpCodeToResponseStatus(code))
+		if h.ResponseStatus == uint8(datatype.STATUS_CLIENT_ERROR) ||
+			h.ResponseStatus == uint8(datatype.STATUS_SERVER_ERROR) {
+			h.ResponseException = log_data.GetHTTPExceptionDesc(uint16(code))
+		}
+	} else if span.GetIsError() {
+		h.ResponseStatus = uint8(datatype.STATUS_SERVER_ERROR)
+	} else {
+		h.ResponseStatus = uint8(datatype.STATUS_OK)
+	}
+	if span.GetIsError() && h.ResponseStatus == uint8(datatype.STATUS_OK) {
+		h.ResponseStatus = uint8(datatype.STATUS_SERVER_ERROR)
+	}
+	fillLogs(h, span.GetLogs())
 }
@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sw_import
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	agent "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+
+	"github.com/deepflowio/deepflow/server/ingester/config"
+	flowlogCfg "github.com/deepflowio/deepflow/server/ingester/flow_log/config"
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/log_data"
+	"github.com/deepflowio/deepflow/server/libs/datatype"
+	"github.com/deepflowio/deepflow/server/libs/utils"
+)
+
+func loadSegments(t *testing.T) []byte {
+	data, err := os.ReadFile("testfiles/segments.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecodeSegments(t *testing.T) {
+	data := loadSegments(t)
+	segments, err := decodeSegments(data, "/v3/segments")
+	if err != nil {
+		t.Fatalf("decode json segments failed: %s", err)
+	}
+	if len(segments) != 1 || len(segments[0].GetSpans()) != 2 {
+		t.Fatalf("unexpected segments: %v", segments)
+	}
+
+	single, err := decodeSegments([]byte(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(string(data)), "["), "]")), "/v3/segment")
+	if err != nil || len(single) != 1 || single[0].GetTraceSegmentId() != "seg-1" {
+		t.Errorf("decode json segment failed: %v, %v", single, err)
+	}
+
+	collection, _ := proto.Marshal(&agent.SegmentCollection{Segments: segments})
+	fromGrpc, err := decodeSegments(collection, "skywalking.v3.TraceSegmentReportService/collectInSync")
+	if err != nil || len(fromGrpc) != 1 || len(fromGrpc[0].GetSpans()) != 2 {
+		t.Errorf("decode grpc segment collection failed: %v, %v", fromGrpc, err)
+	}
+
+	segment, _ := proto.Marshal(segments[0])
+	streamed, err := decodeSegments(segment, "skywalking.v3.TraceSegmentReportService/collect")
+	if err != nil || len(streamed) != 1 || streamed[0].GetService() != "frontend" {
+		t.Errorf("decode grpc segment failed: %v, %v", streamed, err)
+	}
+
+	if _, err := decodeSegments([]byte(`[{"spans": 1}]`), "/v3/segments"); err == nil {
+		t.Errorf("expected error for invalid segments")
+	}
+}
+
+func TestFillSpan(t *testing.T) {
+	segments, err := decodeSegments(loadSegments(t), "/v3/segments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &flowlogCfg.Config{Base: &config.Config{TraceIdWithIndex: config.TraceIdWithIndex{Disabled: true}}}
+	peerIP := net.ParseIP("10.0.0.7").To4()
+	segment := segments[0]
+
+	entry := &log_data.L7FlowLog{}
+	fillSpan(entry, segment, segment.GetSpans()[0], peerIP, cfg)
+	if entry.TraceId != "a1b2c3d4e5f60718" || entry.SpanId != "seg-1-0" || entry.ParentSpanId != "seg-0-2" {
+		t.Errorf("unexpected ids: trace %s, span %s, parent %s", entry.TraceId, entry.SpanId, entry.ParentSpanId)
+	}
+	if entry.TapSide != "s-app" || entry.SpanKind != 2 || entry.AppService != "frontend" || entry.AppInstance != "frontend-0" {
+		t.Errorf("unexpected entry span: tap side %s, kind %d, service %s/%s", entry.TapSide, entry.SpanKind, entry.AppService, entry.AppInstance)
+	}
+	if entry.L7ProtocolStr != datatype.L7_PROTOCOL_HTTP_1.String(false) || entry.RequestType != "GET" ||
+		entry.RequestDomain != "10.0.0.5:8080" || entry.RequestResource != "/api/orders?id=1" {
+		t.Errorf("unexpected http fields: %s %s %s %s", entry.L7ProtocolStr, entry.RequestType, entry.RequestDomain, entry.RequestResource)
+	}
+	if entry.GetResponseCode() != 200 || entry.ResponseStatus != uint8(datatype.STATUS_OK) || entry.ResponseDuration != 120000 {
+		t.Errorf("unexpected response: code %d, status %d, duration %d", entry.GetResponseCode(), entry.ResponseStatus, entry.ResponseDuration)
+	}
+	if entry.ServerPort != 8080 || entry.IP41 != utils.IpToUint32(peerIP) {
+		t.Errorf("unexpected server address: %d:%d", entry.IP41, entry.ServerPort)
+	}
+
+	exit := &log_data.L7FlowLog{}
+	fillSpan(exit, segment, segment.GetSpans()[1], peerIP, cfg)
+	if exit.TapSide != "c-app" || exit.SpanKind != 3 || exit.ParentSpanId != "seg-1-0" {
+		t.Errorf("unexpected exit span: tap side %s, kind %d, parent %s", exit.TapSide, exit.SpanKind, exit.ParentSpanId)
+	}
+	if exit.L7ProtocolStr != "MySQL" || exit.RequestDomain != "orders" || exit.RequestResource != "SELECT * FROM orders" {
+		t.Errorf("unexpected db fields: %s %s %s", exit.L7ProtocolStr, exit.RequestDomain, exit.RequestResource)
+	}
+	if exit.ResponseStatus != uint8(datatype.STATUS_SERVER_ERROR) || exit.ResponseException != "java.sql.SQLException" {
+		t.Errorf("unexpected error fields: status %d, exception %s", exit.ResponseStatus, exit.ResponseException)
+	}
+	if exit.IP40 != utils.IpToUint32(peerIP) || exit.IP41 != utils.IpToUint32(net.ParseIP("10.0.0.9").To4()) || exit.ServerPort != 3306 {
+		t.Errorf("unexpected addresses: %d -> %d:%d", exit.IP40, exit.IP41, exit.ServerPort)
+	}
+	if !strings.Contains(exit.Events, `"name":"error"`) {
+		t.Errorf("unexpected events: %s", exit.Events)
+	}
+}
@@ -0,0 +1,460 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package log_data
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/google/gopacket/layers"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	flowlogCfg "github.com/deepflowio/deepflow/server/ingester/flow_log/config"
+	"github.com/deepflowio/deepflow/server/libs/datatype"
+	"github.com/deepflowio/deepflow/server/libs/datatype/pb"
+	flow_metrics "github.com/deepflowio/deepflow/server/libs/flow-metrics"
+	"github.com/deepflowio/deepflow/server/libs/grpc"
+	"github.com/deepflowio/deepflow/server/libs/utils"
+)
+
+const (
+	ZIPKIN_HEADER_CONTENT_TYPE = "Content-Type"
+	ZIPKIN_CONTENT_TYPE_PROTO  = "application/x-protobuf"
+)
+
+// Zipkin v2 span, refer to: https://github.com/openzipkin/zipkin-api/blob/master/zipkin2-api.yaml
+type ZipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+	IPv4        string `json:"ipv4"`
+	IPv6        string `json:"ipv6"`
+	Port        int32  `json:"port"`
+}
+
+type ZipkinAnnotation struct {
+	Timestamp uint64 `json:"timestamp"` // us
+	Value     string `json:"value"`
+}
+
+type ZipkinSpan struct {
+	TraceID        string             `json:"traceId"`
+	ParentID       string             `json:"parentId"`
+	ID             string             `json:"id"`
+	Kind           string             `json:"kind"`
+	Name           string             `json:"name"`
+	Timestamp      uint64             `json:"timestamp"` // us
+	Duration       uint64             `json:"duration"`  // us
+	LocalEndpoint  *ZipkinEndpoint    `json:"localEndpoint"`
+	RemoteEndpoint *ZipkinEndpoint    `json:"remoteEndpoint"`
+	Annotations    []ZipkinAnnotation `json:"annotations"`
+	Tags           map[string]string  `json:"tags"`
+	Debug          bool               `json:"debug"`
+	Shared         bool               `json:"shared"`
+}
+
+func ZipkinDataToL7FlowLogs(vtapID, orgId, teamId uint16, zipkinData *pb.ThirdPartyTrace, platformData *grpc.PlatformInfoTable, cfg *flowlogCfg.Config) []*L7FlowLog {
+	contentType := ""
+	for i, key := range zipkinData.ExtendKeys {
+		if strings.EqualFold(key, ZIPKIN_HEADER_CONTENT_TYPE) && i < len(zipkinData.ExtendValues) {
+			contentType = zipkinData.ExtendValues[i]
+		}
+	}
+
+	spans, err := DecodeZipkinSpans(zipkinData.Data, contentType)
+	if err != nil {
+		log.Debugf("zipkin data (uri: %s, content-type: %s) decode failed: %s", zipkinData.Uri, contentType, err)
+		return []*L7FlowLog{}
+	}
+
+	ret := make([]*L7FlowLog, 0, len(spans))
+	for _, span := range spans {
+		if span == nil {
+			continue
+		}
+		ret = append(ret, zipkinSpanToL7FlowLog(vtapID, orgId, teamId, span, zipkinData.PeerIp, platformData, cfg))
+	}
+	return ret
+}
+
+// DecodeZipkinSpans decodes the v2 spans, the proto3 encoding is used for 'application/x-protobuf', otherwise JSON
+func DecodeZipkinSpans(data []byte, contentType string) ([]*ZipkinSpan, error) {
+	if strings.Contains(contentType, ZIPKIN_CONTENT_TYPE_PROTO) {
+		return DecodeZipkinProtoSpans(data)
+	}
+	var spans []*ZipkinSpan
+	err := json.Unmarshal(data, &spans)
+	return spans, err
+}
+
+// decode 'ListOfSpans' of zipkin.proto3, refer to: https://github.com/openzipkin/zipkin-api/blob/master/zipkin.proto
+func DecodeZipkinProtoSpans(data []byte) ([]*ZipkinSpan, error) {
+	spans := []*ZipkinSpan{}
+	err := walkProtoFields(data, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		span, err := decodeZipkinProtoSpan(value)
+		if err != nil {
+			return err
+		}
+		spans = append(spans, span)
+		return nil
+	})
+	return spans, err
+}
+
+var zipkinProtoKinds = [...]string{"", "CLIENT", "SERVER", "PRODUCER", "CONSUMER"}
+
+func decodeZipkinProtoSpan(data []byte) (*ZipkinSpan, error) {
+	span := &ZipkinSpan{}
+	err := walkProtoFields(data, func(num protowire.Number, typ protowire.Type, value []byte, v uint64) error {
+		switch num {
+		case 1:
+			span.TraceID = hex.EncodeToString(value)
+		case 2:
+			span.ParentID = hex.EncodeToString(value)
+		case 3:
+			span.ID = hex.EncodeToString(value)
+		case 4:
+			if v < uint64(len(zipkinProtoKinds)) {
+				span.Kind = zipkinProtoKinds[v]
+			}
+		case 5:
+			span.Name = string(value)
+		case 6:
+			span.Timestamp = v
+		case 7:
+			span.Duration = v
+		case 8, 9:
+			endpoint, err := decodeZipkinProtoEndpoint(value)
+			if err != nil {
+				return err
+			}
+			if num == 8 {
+				span.LocalEndpoint = endpoint
+			} else {
+				span.RemoteEndpoint = endpoint
+			}
+		case 10:
+			annotation := ZipkinAnnotation{}
+			if err := walkProtoFields(value, func(num protowire.Number, _ protowire.Type, value []byte, v uint64) error {
+				if num == 1 {
+					annotation.Timestamp = v
+				} else if num == 2 {
+					annotation.Value = string(value)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			span.Annotations = append(span.Annotations, annotation)
+		case 11:
+			var key, val string
+			if err := walkProtoFields(value, func(num protowire.Number, _ protowire.Type, value []byte, _ uint64) error {
+				if num == 1 {
+					key = string(value)
+				} else if num == 2 {
+					val = string(value)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			if span.Tags == nil {
+				span.Tags = make(map[string]string)
+			}
+			span.Tags[key] = val
+		case 12:
+			span.Debug = v != 0
+		case 13:
+			span.Shared = v != 0
+		}
+		return nil
+	})
+	return span, err
+}
+
+func decodeZipkinProtoEndpoint(data []byte) (*ZipkinEndpoint, error) {
+	endpoint := &ZipkinEndpoint{}
+	err := walkProtoFields(data, func(num protowire.Number, _ protowire.Type, value []byte, v uint64) error {
+		switch num {
+		case 1:
+			endpoint.ServiceName = string(value)
+		case 2:
+			if len(value) == net.IPv4len {
+				endpoint.IPv4 = net.IP(value).String()
+			}
+		case 3:
+			if len(value) == net.IPv6len {
+				endpoint.IPv6 = net.IP(value).String()
+			}
+		case 4:
+			endpoint.Port = int32(v)
+		}
+		return nil
+	})
+	return endpoint, err
+}
+
+// walkProtoFields calls fn for each field of the protobuf message, 'value' is set for the bytes type, and 'v' for the numeric types
+func walkProtoFields(data []byte, fn func(num protowire.Number, typ protowire.Type, value []byte, v uint64) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		var value []byte
+		var v uint64
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(data)
+		case protowire.Fixed32Type:
+			var v32 uint32
+			v32, n = protowire.ConsumeFixed32(data)
+			v = uint64(v32)
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return fmt.Errorf("field %d: %s", num, protowire.ParseError(n))
+		}
+		data = data[n:]
+		if err := fn(num, typ, value, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func zipkinSpanToL7FlowLog(vtapID, orgId, teamId uint16, span *ZipkinSpan, peerIP []byte, platformData *grpc.PlatformInfoTable, cfg *flowlogCfg.Config) *L7FlowLog {
+	h := AcquireL7FlowLog()
+	h.GenID(uint32((span.Timestamp+span.Duration)/uint64(time.Second/time.Microsecond)), platformData)
+	h.VtapID, h.OrgId, h.TeamID = vtapID, orgId, teamId
+	h.FillZipkin(span, peerIP, platformData, cfg)
+	return h
+}
+
+func zipkinKindToTapSide(kind string) (flow_metrics.TAPSideEnum, uint8) {
+	switch kind {
+	case "CLIENT":
+		return flow_metrics.ClientApp, 3 // SPAN_KIND_CLIENT
+	case "PRODUCER":
+		return flow_metrics.ClientApp, 4 // SPAN_KIND_PRODUCER
+	case "SERVER":
+		return flow_metrics.ServerApp, 2 // SPAN_KIND_SERVER
+	case "CONSUMER":
+		return flow_metrics.ServerApp, 5 // SPAN_KIND_CONSUMER
+	default:
+		return flow_metrics.App, 1 // SPAN_KIND_INTERNAL
+	}
+}
+
+func (e *ZipkinEndpoint) ip() net.IP {
+	if e == nil {
+		return nil
+	}
+	if e.IPv4 != "" {
+		return net.ParseIP(e.IPv4)
+	}
+	if e.IPv6 != "" {
+		return net.ParseIP(e.IPv6)
+	}
+	return nil
+}
+
+func (h *L7FlowLog) fillZipkinIP(ip net.IP, isServer bool) {
+	if ip == nil {
+		return
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		if isServer {
+			h.IP41 = utils.IpToUint32(ip4)
+		} else {
+			h.IP40 = utils.IpToUint32(ip4)
+		}
+	} else {
+		h.IsIPv4 = false
+		if isServer {
+			h.IP61 = ip
+		} else {
+			h.IP60 = ip
+		}
+	}
+}
+
+func (h *L7FlowLog) fillZipkinTags(span *ZipkinSpan) {
+	keys := make([]string, 0, len(span.Tags))
+	for k := range span.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attributeNames, attributeValues := make([]string, 0, len(keys)), make([]string, 0, len(keys))
+	isHttp := false
+	httpURL := ""
+	for _, key := range keys {
+		value := span.Tags[key]
+		if !isHttp && strings.HasPrefix(key, "http.") {
+			isHttp = true
+		}
+		switch key {
+		case "http.method", "rpc.method", "db.operation":
+			h.RequestType = value
+		case "http.path", "http.route", "db.statement", "sql.query", "rpc.service", "kafka.topic", "messaging.destination":
+			if h.RequestResource == "" || key == "http.path" {
+				h.RequestResource = value
+			}
+		case "http.url":
+			httpURL = value
+		case "http.host", "db.instance", "peer.service":
+			h.RequestDomain = value
+		case "http.status_code":
+			v, _ := strconv.Atoi(value)
+			h.SetResponseCode(int32(v))
+		case "grpc.status_code":
+			if h.L7ProtocolStr == "" {
+				h.L7ProtocolStr = datatype.L7_PROTOCOL_GRPC.String(false)
+			}
+		case "db.system", "rpc.system", "messaging.system":
+			h.L7ProtocolStr = value
+		case "error":
+			h.ResponseException = value
+		}
+		attributeNames = append(attributeNames, key)
+		attributeValues = append(attributeValues, value)
+	}
+
+	if h.RequestResource == "" && httpURL != "" {
+		parsedURLPath, err := ParseUrlPath(httpURL)
+		if err != nil {
+			log.Debugf("http.url (%s) parse failed: %s", httpURL, err)
+		} else {
+			h.RequestResource = parsedURLPath
+		}
+	}
+	if h.L7ProtocolStr == "" && isHttp {
+		h.L7ProtocolStr = datatype.L7_PROTOCOL_HTTP_1.String(false)
+	}
+	h.L7Protocol, h.IsTLS = ParseL7Protocol(h.L7ProtocolStr, h.Version)
+	if h.L7ProtocolStr == "" && span.RemoteEndpoint != nil && span.RemoteEndpoint.ServiceName != "" {
+		// Brave uses the remote service name to indicate the database or MQ, such as 'mysql', 'redis', 'kafka'
+		if l7Protocol, _ := ParseL7Protocol(span.RemoteEndpoint.ServiceName, ""); l7Protocol != uint8(datatype.L7_PROTOCOL_UNKNOWN) {
+			h.L7ProtocolStr = span.RemoteEndpoint.ServiceName
+			h.L7Protocol = l7Protocol
+		}
+	}
+	if span.RemoteEndpoint != nil && span.RemoteEndpoint.ServiceName != "" {
+		attributeNames = append(attributeNames, "zipkin.remote_service_name")
+		attributeValues = append(attributeValues, span.RemoteEndpoint.ServiceName)
+	}
+	h.AttributeNames = attributeNames
+	h.AttributeValues = attributeValues
+}
+
+type zipkinEvent struct {
+	TimeUnixNano uint64 `json:"time_unix_nano"`
+	Name         string `json:"name"`
+}
+
+func (h *L7FlowLog) FillZipkin(span *ZipkinSpan, peerIP []byte, platformData *grpc.PlatformInfoTable, cfg *flowlogCfg.Config) {
+	h.fillZipkinSpan(span, peerIP, cfg)
+	h.L7Base.KnowledgeGraph.FillOTel(h, platformData)
+	// only show data for services as 'server side'
+	if h.TapSide == flow_metrics.ServerApp.String() && h.ServerPort == 0 {
+		h.ServerPort = 65535
+	}
+}
+
+// fillZipkinSpan fills the fields converted from the span, excluding the knowledge graph which depends on the platform data
+func (h *L7FlowLog) fillZipkinSpan(span *ZipkinSpan, peerIP []byte, cfg *flowlogCfg.Config) {
+	// Zipkin data net protocol always set to TCP
+	h.Protocol = uint8(layers.IPProtocolTCP)
+	h.TapType = uint8(datatype.TAP_CLOUD)
+	h.Type = uint8(datatype.MSG_T_SESSION)
+	h.TapPortType = datatype.TAPPORT_FROM_OTEL
+	h.SignalSource = uint16(datatype.SIGNAL_SOURCE_OTEL)
+	// ids are lower-hex encoded, which are the same as the values of the B3 headers
+	h.TraceId = strings.ToLower(span.TraceID)
+	h.TraceIdIndex = ParseTraceIdIndex(h.TraceId, &cfg.Base.TraceIdWithIndex)
+	h.SpanId = strings.ToLower(span.ID)
+	h.ParentSpanId = strings.ToLower(span.ParentID)
+	tapSide, spanKind := zipkinKindToTapSide(span.Kind)
+	h.TapSideEnum = uint8(tapSide)
+	h.TapSide = tapSide.String()
+	h.SetSpanKind(spanKind)
+	h.Endpoint = span.Name
+	if span.LocalEndpoint != nil {
+		h.AppService = span.LocalEndpoint.ServiceName
+	}
+	h.L7Base.StartTime = int64(span.Timestamp)
+	h.L7Base.EndTime = int64(span.Timestamp + span.Duration)
+	h.ResponseDuration = span.Duration
+	h.L7Base.Time = uint32(h.L7Base.EndTime / int64(time.Second/time.Microsecond))
+
+	if len(span.Annotations) > 0 {
+		events := make([]zipkinEvent, 0, len(span.Annotations))
+		for _, a := range span.Annotations {
+			events = append(events, zipkinEvent{TimeUnixNano: a.Timestamp * uint64(time.Microsecond), Name: a.Value})
+		}
+		if eventsJSON, err := json.Marshal(events); err == nil {
+			h.Events = string(eventsJSON)
+		}
+	}
+
+	// the local endpoint is where the span is generated, and the remote endpoint is the peer
+	h.IsIPv4 = true
+	isClient := tapSide == flow_metrics.ClientApp
+	localIP := span.LocalEndpoint.ip()
+	if localIP == nil && (len(peerIP) == net.IPv4len || len(peerIP) == net.IPv6len) {
+		localIP = net.IP(peerIP)
+	}
+	if localIP != nil {
+		h.AppInstance = localIP.String()
+	}
+	h.fillZipkinIP(localIP, !isClient)
+	h.fillZipkinIP(span.RemoteEndpoint.ip(), isClient)
+	if isClient && span.RemoteEndpoint != nil {
+		h.ServerPort = uint16(span.RemoteEndpoint.Port)
+	} else if !isClient && span.LocalEndpoint != nil {
+		h.ServerPort = uint16(span.LocalEndpoint.Port)
+	}
+
+	h.fillZipkinTags(span)
+
+	// the http status code is preferred
+	if h.responseCode != 0 {
+		h.ResponseStatus = uint8(HttpCodeToResponseStatus(h.responseCode))
+		if h.ResponseException == "" && (h.ResponseStatus == uint8(datatype.STATUS_CLIENT_ERROR) ||
+			h.ResponseStatus == uint8(datatype.STATUS_SERVER_ERROR)) {
+			h.ResponseException = GetHTTPExceptionDesc(uint16(h.responseCode))
+		}
+	} else if _, ok := span.Tags["error"]; ok {
+		h.ResponseStatus = uint8(datatype.STATUS_SERVER_ERROR)
+	} else {
+		h.ResponseStatus = uint8(datatype.STATUS_OK)
+	}
+}
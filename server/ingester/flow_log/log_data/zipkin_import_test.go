@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package log_data
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/deepflowio/deepflow/server/ingester/config"
+	flowlogCfg "github.com/deepflowio/deepflow/server/ingester/flow_log/config"
+	"github.com/deepflowio/deepflow/server/libs/datatype"
+)
+
+func TestDecodeZipkinProtoSpans(t *testing.T) {
+	var endpoint []byte
+	endpoint = protowire.AppendTag(endpoint, 1, protowire.BytesType)
+	endpoint = protowire.AppendString(endpoint, "frontend")
+	endpoint = protowire.AppendTag(endpoint, 2, protowire.BytesType)
+	endpoint = protowire.AppendBytes(endpoint, []byte{10, 1, 2, 3})
+	endpoint = protowire.AppendTag(endpoint, 4, protowire.VarintType)
+	endpoint = protowire.AppendVarint(endpoint, 8080)
+
+	var tag []byte
+	tag = protowire.AppendTag(tag, 1, protowire.BytesType)
+	tag = protowire.AppendString(tag, "http.status_code")
+	tag = protowire.AppendTag(tag, 2, protowire.BytesType)
+	tag = protowire.AppendString(tag, "503")
+
+	var span []byte
+	span = protowire.AppendTag(span, 1, protowire.BytesType)
+	span = protowire.AppendBytes(span, []byte{0x5a, 0xf7, 0x18, 0x3f, 0xb1, 0xd4, 0xcf, 0x5f})
+	span = protowire.AppendTag(span, 3, protowire.BytesType)
+	span = protowire.AppendBytes(span, []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07})
+	span = protowire.AppendTag(span, 4, protowire.VarintType)
+	span = protowire.AppendVarint(span, 2)
+	span = protowire.AppendTag(span, 5, protowire.BytesType)
+	span = protowire.AppendString(span, "get /api")
+	span = protowire.AppendTag(span, 6, protowire.Fixed64Type)
+	span = protowire.AppendFixed64(span, 1700000000000000)
+	span = protowire.AppendTag(span, 7, protowire.VarintType)
+	span = protowire.AppendVarint(span, 1500)
+	span = protowire.AppendTag(span, 8, protowire.BytesType)
+	span = protowire.AppendBytes(span, endpoint)
+	span = protowire.AppendTag(span, 11, protowire.BytesType)
+	span = protowire.AppendBytes(span, tag)
+
+	var list []byte
+	list = protowire.AppendTag(list, 1, protowire.BytesType)
+	list = protowire.AppendBytes(list, span)
+
+	spans, err := DecodeZipkinProtoSpans(list)
+	if err != nil {
+		t.Fatalf("DecodeZipkinProtoSpans failed: %s", err)
+	}
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	s := spans[0]
+	if s.TraceID != "5af7183fb1d4cf5f" || s.ID != "0001020304050607" || s.ParentID != "" {
+		t.Errorf("unexpected ids: trace %s, span %s, parent %s", s.TraceID, s.ID, s.ParentID)
+	}
+	if s.Kind != "SERVER" || s.Name != "get /api" || s.Timestamp != 1700000000000000 || s.Duration != 1500 {
+		t.Errorf("unexpected span: %+v", s)
+	}
+	if s.LocalEndpoint == nil || s.LocalEndpoint.ServiceName != "frontend" || s.LocalEndpoint.IPv4 != "10.1.2.3" || s.LocalEndpoint.Port != 8080 {
+		t.Errorf("unexpected local endpoint: %+v", s.LocalEndpoint)
+	}
+	if s.Tags["http.status_code"] != "503" {
+		t.Errorf("unexpected tags: %v", s.Tags)
+	}
+
+	if _, err := DecodeZipkinProtoSpans([]byte{0x0a, 0x10, 0x01}); err == nil {
+		t.Errorf("expected error for truncated data")
+	}
+}
+
+const zipkinJSONSpans = `[{
+	"traceId": "5AF7183FB1D4CF5F", "parentId": "6b221d5bc9e6496c", "id": "352bff9a74ca9ad2", "kind": "CLIENT", "name": "get /api",
+	"timestamp": 1700000000000000, "duration": 1500, "shared": true,
+	"localEndpoint": {"serviceName": "frontend", "ipv4": "10.1.2.3"},
+	"remoteEndpoint": {"serviceName": "backend", "ipv4": "10.1.2.4", "port": 8080},
+	"annotations": [{"timestamp": 1700000000000100, "value": "ws"}],
+	"tags": {"http.method": "GET", "http.path": "/api", "http.status_code": "503"}
+}]`
+
+func TestDecodeZipkinJSONSpans(t *testing.T) {
+	spans, err := DecodeZipkinSpans([]byte(zipkinJSONSpans), "application/json")
+	if err != nil {
+		t.Fatalf("DecodeZipkinSpans failed: %s", err)
+	}
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	s := spans[0]
+	if s.TraceID != "5AF7183FB1D4CF5F" || s.ID != "352bff9a74ca9ad2" || s.ParentID != "6b221d5bc9e6496c" {
+		t.Errorf("unexpected ids: trace %s, span %s, parent %s", s.TraceID, s.ID, s.ParentID)
+	}
+	if s.Kind != "CLIENT" || s.Name != "get /api" || s.Timestamp != 1700000000000000 || s.Duration != 1500 || !s.Shared {
+		t.Errorf("unexpected span: %+v", s)
+	}
+	if s.RemoteEndpoint == nil || s.RemoteEndpoint.ServiceName != "backend" || s.RemoteEndpoint.IPv4 != "10.1.2.4" || s.RemoteEndpoint.Port != 8080 {
+		t.Errorf("unexpected remote endpoint: %+v", s.RemoteEndpoint)
+	}
+	if len(s.Annotations) != 1 || s.Annotations[0].Value != "ws" || len(s.Tags) != 3 {
+		t.Errorf("unexpected annotations %v, tags %v", s.Annotations, s.Tags)
+	}
+
+	if _, err := DecodeZipkinSpans([]byte(`[{"traceId": 1}]`), ""); err == nil {
+		t.Errorf("expected error for invalid json")
+	}
+}
+
+func TestFillZipkin(t *testing.T) {
+	cfg := &flowlogCfg.Config{Base: &config.Config{TraceIdWithIndex: config.TraceIdWithIndex{Disabled: true}}}
+	spans, err := DecodeZipkinSpans([]byte(zipkinJSONSpans), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a client span, the local endpoint is the client and the remote endpoint is the server
+	h := &L7FlowLog{}
+	h.fillZipkinSpan(spans[0], nil, cfg)
+	if h.TraceId != "5af7183fb1d4cf5f" || h.SpanId != "352bff9a74ca9ad2" || h.ParentSpanId != "6b221d5bc9e6496c" {
+		t.Errorf("unexpected ids: trace %s, span %s, parent %s", h.TraceId, h.SpanId, h.ParentSpanId)
+	}
+	if h.TapSide != "c-app" || h.SpanKind != 3 || h.Endpoint != "get /api" || h.AppService != "frontend" || h.AppInstance != "10.1.2.3" {
+		t.Errorf("unexpected tap side %s, span kind %d, endpoint %s, app service %s, app instance %s",
+			h.TapSide, h.SpanKind, h.Endpoint, h.AppService, h.AppInstance)
+	}
+	if !h.IsIPv4 || h.IP40 != 0x0a010203 || h.IP41 != 0x0a010204 || h.ServerPort != 8080 {
+		t.Errorf("unexpected ips %x %x, server port %d", h.IP40, h.IP41, h.ServerPort)
+	}
+	if h.L7Base.StartTime != 1700000000000000 || h.ResponseDuration != 1500 || h.L7Base.Time != 1700000000 {
+		t.Errorf("unexpected start time %d, duration %d, time %d", h.L7Base.StartTime, h.ResponseDuration, h.L7Base.Time)
+	}
+	if h.L7Protocol != uint8(datatype.L7_PROTOCOL_HTTP_1) || h.RequestType != "GET" || h.RequestResource != "/api" {
+		t.Errorf("unexpected l7 protocol %d, request type %s, request resource %s", h.L7Protocol, h.RequestType, h.RequestResource)
+	}
+	if h.responseCode != 503 || h.ResponseStatus != uint8(datatype.STATUS_SERVER_ERROR) || h.ResponseException != GetHTTPExceptionDesc(503) {
+		t.Errorf("unexpected response code %d, status %d, exception %s", h.responseCode, h.ResponseStatus, h.ResponseException)
+	}
+	if !strings.Contains(h.Events, `"name":"ws"`) {
+		t.Errorf("unexpected events %s", h.Events)
+	}
+
+	// a server span without endpoint ip, the peer ip is the server, and the 'error' tag marks the span as failed
+	span := &ZipkinSpan{
+		TraceID:       "5af7183fb1d4cf5f",
+		ID:            "6b221d5bc9e6496c",
+		Kind:          "SERVER",
+		Name:          "get /api",
+		LocalEndpoint: &ZipkinEndpoint{ServiceName: "backend", Port: 8080},
+		Tags:          map[string]string{"error": "timeout"},
+	}
+	h = &L7FlowLog{}
+	h.fillZipkinSpan(span, []byte{10, 1, 2, 4}, cfg)
+	if h.TapSide != "s-app" || h.SpanKind != 2 || h.ParentSpanId != "" || h.AppInstance != "10.1.2.4" {
+		t.Errorf("unexpected tap side %s, span kind %d, parent %s, app instance %s", h.TapSide, h.SpanKind, h.ParentSpanId, h.AppInstance)
+	}
+	if h.IP41 != 0x0a010204 || h.IP40 != 0 || h.ServerPort != 8080 {
+		t.Errorf("unexpected ips %x %x, server port %d", h.IP40, h.IP41, h.ServerPort)
+	}
+	if h.ResponseStatus != uint8(datatype.STATUS_SERVER_ERROR) || h.ResponseException != "timeout" {
+		t.Errorf("unexpected status %d, exception %s", h.ResponseStatus, h.ResponseException)
+	}
+}
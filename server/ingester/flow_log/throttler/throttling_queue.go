@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/deepflowio/deepflow/server/ingester/flow_log/dbwriter"
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/log_data"
 )
 
 const (
@@ -41,6 +42,11 @@ type ThrottlingQueue struct {
 	periodCount     int
 	periodEmitCount int
 
+	traceSampler          *TraceSampler
+	periodAlwaysKeptCount int
+	protocolCounts        map[string]int
+	serviceCounts         map[string]int
+
 	sampleItems    []interface{}
 	nonSampleItems []interface{}
 }
@@ -60,6 +66,17 @@ func NewThrottlingQueue(throttle, throttleBucket int, flowLogWriter *dbwriter.Fl
 	return thq
 }
 
+// SetTraceSampler switches the sampling of l7 flow logs from reservoir sampling to trace-aware sampling,
+// the sampler should be shared by all the queues of the logger
+func (thq *ThrottlingQueue) SetTraceSampler(ts *TraceSampler) {
+	if ts == nil || thq.SampleDisabled() {
+		return
+	}
+	thq.traceSampler = ts
+	thq.protocolCounts = make(map[string]int)
+	thq.serviceCounts = make(map[string]int)
+}
+
 func (thq *ThrottlingQueue) SampleDisabled() bool {
 	return thq.Throttle <= 0
 }
@@ -93,6 +110,9 @@ func (thq *ThrottlingQueue) SendWithThrottling(flow interface{}) bool {
 	now := time.Now().Unix()
 	if now/thq.throttleBucket != thq.lastFlush/thq.throttleBucket {
 		thq.flush()
+		if thq.traceSampler != nil {
+			thq.reportTraceSampling()
+		}
 		thq.lastFlush = now
 		thq.periodCount = 0
 		thq.periodEmitCount = 0
@@ -101,6 +121,12 @@ func (thq *ThrottlingQueue) SendWithThrottling(flow interface{}) bool {
 		return false
 	}
 
+	if thq.traceSampler != nil {
+		if l, ok := flow.(*log_data.L7FlowLog); ok {
+			return thq.sendWithTraceSampling(l)
+		}
+	}
+
 	// Reservoir Sampling
 	thq.periodCount++
 	if thq.periodEmitCount < thq.Throttle {
@@ -123,6 +149,38 @@ func (thq *ThrottlingQueue) SendWithThrottling(flow interface{}) bool {
 	}
 }
 
+func (thq *ThrottlingQueue) reportTraceSampling() {
+	if thq.periodCount > 0 {
+		thq.traceSampler.report(thq.lastFlush/thq.throttleBucket, thq.periodCount, thq.periodAlwaysKeptCount, thq.protocolCounts, thq.serviceCounts)
+	}
+	thq.periodAlwaysKeptCount = 0
+	for k := range thq.protocolCounts {
+		delete(thq.protocolCounts, k)
+	}
+	for k := range thq.serviceCounts {
+		delete(thq.serviceCounts, k)
+	}
+}
+
+// sendWithTraceSampling keeps the error and slow spans within the throttle, and keeps the others only by the hash of the trace_id.
+// Kept spans are never replaced or dropped later, so the decision of a trace is the same in all queues.
+func (thq *ThrottlingQueue) sendWithTraceSampling(l *log_data.L7FlowLog) bool {
+	thq.periodCount++
+	ts := thq.traceSampler
+	ts.countKeys(l, thq.protocolCounts, thq.serviceCounts)
+	if ts.alwaysKeep(l) && ts.acquireAlwaysKeep(thq.lastFlush/thq.throttleBucket) {
+		thq.periodAlwaysKeptCount++
+		thq.SendWithoutThrottling(l)
+		return true
+	}
+	if ts.keep(l.TraceId) {
+		thq.SendWithoutThrottling(l)
+		return true
+	}
+	l.Release()
+	return false
+}
+
 func (thq *ThrottlingQueue) SendWithoutThrottling(flow interface{}) {
 	if flow == nil || len(thq.nonSampleItems) >= QUEUE_BATCH {
 		if len(thq.nonSampleItems) > 0 {
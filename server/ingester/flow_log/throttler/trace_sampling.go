@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package throttler
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/config"
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/log_data"
+	"github.com/deepflowio/deepflow/server/libs/datatype"
+)
+
+// keep all spans when the threshold reaches it
+const keepAllThreshold = uint64(math.MaxUint32) + 1
+
+// TraceSampler is shared by all the ThrottlingQueues of the l7 loggers. Whether a span is kept is a pure function of
+// the hash of its trace_id and a common threshold, so all the spans of a trace are kept or dropped together,
+// no matter which queue they are in. The threshold is recalculated from the counts reported by all the queues
+// in the last complete period, so that the total throttle and the quotas are not multiplied by the queue count.
+// The error and slow spans are kept first, they are counted against the throttle and are bounded by it.
+type TraceSampler struct {
+	slowThresholdUs uint64
+	throttle        int // per throttle bucket, for all queues
+	protocolQuotas  map[string]int
+	serviceQuotas   map[string]int
+
+	threshold uint64 // atomic
+
+	mutex          sync.Mutex
+	period         int64
+	totalCount     int
+	alwaysKeptSum  int // the error and slow spans kept in the period reported by all the queues
+	protocolCounts map[string]int
+	serviceCounts  map[string]int
+
+	// the error and slow spans kept in the current period, shared by all the queues to bound them by the throttle
+	keptMutex  sync.Mutex
+	keptPeriod int64
+	keptCount  int
+}
+
+// quotas are configured per second, convert them to per throttle bucket
+func newQuotas(quotas map[string]int, throttleBucket int) map[string]int {
+	m := make(map[string]int, len(quotas))
+	for k, v := range quotas {
+		if v > 0 {
+			m[k] = v * throttleBucket
+		}
+	}
+	return m
+}
+
+// NewTraceSampler returns nil when the trace sampling or the throttle is disabled
+func NewTraceSampler(cfg *config.TraceSampling, throttle, throttleBucket int) *TraceSampler {
+	if cfg == nil || !cfg.Enabled || throttle <= 0 {
+		return nil
+	}
+	return &TraceSampler{
+		slowThresholdUs: uint64(cfg.SlowThresholdMs) * 1000,
+		throttle:        throttle * throttleBucket,
+		protocolQuotas:  newQuotas(cfg.L7ProtocolQuotas, throttleBucket),
+		serviceQuotas:   newQuotas(cfg.AppServiceQuotas, throttleBucket),
+		threshold:       keepAllThreshold,
+		protocolCounts:  make(map[string]int),
+		serviceCounts:   make(map[string]int),
+	}
+}
+
+// error and slow spans are kept unless the throttle of the period is used up
+func (ts *TraceSampler) alwaysKeep(l *log_data.L7FlowLog) bool {
+	if l.ResponseStatus == uint8(datatype.STATUS_SERVER_ERROR) ||
+		l.ResponseStatus == uint8(datatype.STATUS_CLIENT_ERROR) ||
+		l.ResponseStatus == uint8(datatype.STATUS_TIMEOUT) {
+		return true
+	}
+	return ts.slowThresholdUs > 0 && l.ResponseDuration >= ts.slowThresholdUs
+}
+
+// acquireAlwaysKeep counts an error or slow span against the throttle of the period, it returns false when the
+// throttle is used up, and the span is sampled by the hash of its trace_id as the other spans
+func (ts *TraceSampler) acquireAlwaysKeep(period int64) bool {
+	ts.keptMutex.Lock()
+	defer ts.keptMutex.Unlock()
+	if period > ts.keptPeriod {
+		ts.keptPeriod = period
+		ts.keptCount = 0
+	}
+	if ts.keptCount >= ts.throttle {
+		return false
+	}
+	ts.keptCount++
+	return true
+}
+
+// keep returns whether the spans of the trace are kept under the current threshold
+func (ts *TraceSampler) keep(traceId string) bool {
+	threshold := atomic.LoadUint64(&ts.threshold)
+	if threshold >= keepAllThreshold {
+		return true
+	}
+	if traceId == "" {
+		return uint64(rand.Uint32()) < threshold
+	}
+	return uint64(hashTraceId(traceId)) < threshold
+}
+
+// countKeys counts the spans of the quota keys in the local counters of a queue
+func (ts *TraceSampler) countKeys(l *log_data.L7FlowLog, protocolCounts, serviceCounts map[string]int) {
+	if _, ok := ts.protocolQuotas[l.L7ProtocolStr]; ok {
+		protocolCounts[l.L7ProtocolStr]++
+	}
+	if _, ok := ts.serviceQuotas[l.AppService]; ok {
+		serviceCounts[l.AppService]++
+	}
+}
+
+// report merges the counts of a queue in the period, the threshold is recalculated when the first report
+// of a new period arrives, and the counts of the previous period are complete at that time
+func (ts *TraceSampler) report(period int64, totalCount, alwaysKeptCount int, protocolCounts, serviceCounts map[string]int) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	if period > ts.period {
+		if ts.period != 0 {
+			atomic.StoreUint64(&ts.threshold, ts.calcThreshold())
+		}
+		ts.period = period
+		ts.totalCount = 0
+		ts.alwaysKeptSum = 0
+		for k := range ts.protocolCounts {
+			delete(ts.protocolCounts, k)
+		}
+		for k := range ts.serviceCounts {
+			delete(ts.serviceCounts, k)
+		}
+	}
+	ts.totalCount += totalCount
+	ts.alwaysKeptSum += alwaysKeptCount
+	for k, v := range protocolCounts {
+		ts.protocolCounts[k] += v
+	}
+	for k, v := range serviceCounts {
+		ts.serviceCounts[k] += v
+	}
+}
+
+// calcThreshold uses the smallest ratio of the throttle and the quotas. The error and slow spans kept are deducted
+// from the throttle, and the rest of the throttle is for the other spans. A quota lowers the ratio of all spans
+// instead of only the spans of its key, otherwise a trace would be partially kept when its spans have different
+// protocols or services.
+func (ts *TraceSampler) calcThreshold() uint64 {
+	ratio := 1.0
+	limit := func(quota, count int) {
+		if count > quota {
+			ratio = math.Min(ratio, float64(quota)/float64(count))
+		}
+	}
+	limit(ts.throttle-ts.alwaysKeptSum, ts.totalCount-ts.alwaysKeptSum)
+	for k, quota := range ts.protocolQuotas {
+		limit(quota, ts.protocolCounts[k])
+	}
+	for k, quota := range ts.serviceQuotas {
+		limit(quota, ts.serviceCounts[k])
+	}
+	if ratio >= 1 {
+		return keepAllThreshold
+	} else if ratio <= 0 {
+		return 0
+	}
+	return uint64(ratio * float64(keepAllThreshold))
+}
+
+// FNV-1a, inlined to avoid allocating a hash.Hash32 for each span
+func hashTraceId(traceId string) uint32 {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+	h := uint32(offset32)
+	for i := 0; i < len(traceId); i++ {
+		h ^= uint32(traceId[i])
+		h *= prime32
+	}
+	return h
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package throttler
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/config"
+	"github.com/deepflowio/deepflow/server/ingester/flow_log/log_data"
+	"github.com/deepflowio/deepflow/server/libs/datatype"
+)
+
+func keptRatio(ts *TraceSampler, count int) float64 {
+	kept := 0
+	for i := 0; i < count; i++ {
+		if ts.keep("trace-" + strconv.Itoa(i)) {
+			kept++
+		}
+	}
+	return float64(kept) / float64(count)
+}
+
+func TestTraceSamplerThreshold(t *testing.T) {
+	if NewTraceSampler(&config.TraceSampling{Enabled: false}, 100, 1) != nil {
+		t.Fatal("expected nil sampler when trace sampling is disabled")
+	}
+	cfg := &config.TraceSampling{Enabled: true, L7ProtocolQuotas: map[string]int{"HTTP": 50}}
+	ts := NewTraceSampler(cfg, 1000, 1)
+	if ratio := keptRatio(ts, 1000); ratio != 1 {
+		t.Errorf("expected all traces kept before the first period, got %f", ratio)
+	}
+
+	// two queues report the first period, the threshold takes effect when the next period starts
+	ts.report(1, 1500, 0, nil, nil)
+	ts.report(1, 1500, 0, nil, nil)
+	ts.report(2, 0, 0, nil, nil)
+	if ratio := keptRatio(ts, 20000); ratio < 0.30 || ratio > 0.37 {
+		t.Errorf("expected ratio about 1000/3000, got %f", ratio)
+	}
+
+	// the quota of HTTP lowers the ratio of all spans
+	ts.report(2, 500, 0, map[string]int{"HTTP": 100}, nil)
+	ts.report(2, 400, 0, map[string]int{"HTTP": 100}, nil)
+	ts.report(3, 0, 0, nil, nil)
+	if ratio := keptRatio(ts, 20000); ratio < 0.22 || ratio > 0.28 {
+		t.Errorf("expected ratio about 50/200, got %f", ratio)
+	}
+
+	// the error and slow spans kept are deducted from the throttle, 1000-600 for the other 2400-600 spans
+	ts.report(3, 1200, 300, nil, nil)
+	ts.report(3, 1200, 300, nil, nil)
+	ts.report(4, 0, 0, nil, nil)
+	if ratio := keptRatio(ts, 20000); ratio < 0.19 || ratio > 0.25 {
+		t.Errorf("expected ratio about 400/1800, got %f", ratio)
+	}
+
+	// the decision is a pure function of the trace_id
+	for i := 0; i < 1000; i++ {
+		traceId := "trace-" + strconv.Itoa(i)
+		if ts.keep(traceId) != ts.keep(traceId) {
+			t.Fatalf("inconsistent decision for %s", traceId)
+		}
+	}
+}
+
+func newSpan(traceId string, status datatype.LogMessageStatus) *log_data.L7FlowLog {
+	l := log_data.AcquireL7FlowLog()
+	l.TraceId = traceId
+	l.ResponseStatus = uint8(status)
+	return l
+}
+
+func TestQueuesShareTraceDecision(t *testing.T) {
+	ts := NewTraceSampler(&config.TraceSampling{Enabled: true}, 1000, 1)
+	ts.threshold = keepAllThreshold / 4
+	queues := []*ThrottlingQueue{NewThrottlingQueue(100, 1, nil, 0), NewThrottlingQueue(100, 1, nil, 0)}
+	for _, q := range queues {
+		q.SetTraceSampler(ts)
+	}
+
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		traceId := "trace-" + strconv.Itoa(i)
+		first := queues[0].sendWithTraceSampling(newSpan(traceId, datatype.STATUS_OK))
+		// spans of the same trace in another queue, and more spans after the first one is kept
+		for j := 0; j < 3; j++ {
+			if queues[1].sendWithTraceSampling(newSpan(traceId, datatype.STATUS_OK)) != first {
+				t.Fatalf("spans of %s are partially kept", traceId)
+			}
+		}
+		if first {
+			kept++
+		}
+		if !queues[1].sendWithTraceSampling(newSpan(traceId, datatype.STATUS_SERVER_ERROR)) {
+			t.Fatalf("error span of %s is dropped", traceId)
+		}
+	}
+	if kept < 200 || kept > 300 {
+		t.Errorf("expected about 250 traces kept, got %d", kept)
+	}
+	if queues[1].periodCount != 4000 {
+		t.Errorf("expected 4000 spans counted, got %d", queues[1].periodCount)
+	}
+}
+
+func TestAlwaysKeepBoundedByThrottle(t *testing.T) {
+	ts := NewTraceSampler(&config.TraceSampling{Enabled: true}, 100, 1)
+	ts.threshold = 0
+	queues := []*ThrottlingQueue{NewThrottlingQueue(100, 1, nil, 0), NewThrottlingQueue(100, 1, nil, 0)}
+	for _, q := range queues {
+		q.SetTraceSampler(ts)
+	}
+
+	// the error spans of all the queues share the throttle, the rest are sampled as the other spans
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		if queues[i%2].sendWithTraceSampling(newSpan("trace-"+strconv.Itoa(i), datatype.STATUS_SERVER_ERROR)) {
+			kept++
+		}
+	}
+	if kept != 100 {
+		t.Errorf("expected 100 error spans kept, got %d", kept)
+	}
+	if queues[0].periodAlwaysKeptCount+queues[1].periodAlwaysKeptCount != 100 {
+		t.Errorf("unexpected always kept counts %d %d", queues[0].periodAlwaysKeptCount, queues[1].periodAlwaysKeptCount)
+	}
+
+	// the quota is reset in the next period
+	if !ts.acquireAlwaysKeep(1) {
+		t.Error("expected error span kept in the next period")
+	}
+}
@@ -62,13 +62,13 @@ type Counter struct {
 	DocCount        int64 `statsd:"doc-count"`
 	ErrDocCount     int64 `statsd:"err-doc-count"`
 	AverageDelay    int64 `statsd:"average-delay"`
-	MaxDelay        int64 `statsd:"max-delay"`
-	MinDelay        int64 `statsd:"min-delay"`
+	MaxDelay        int64 `statsd:"max-delay,gauge"`
+	MinDelay        int64 `statsd:"min-delay,gauge"`
 	ExpiredDocCount int64 `statsd:"expired-doc-count"`
 	FutureDocCount  int64 `statsd:"future-doc-count"`
 	DropDocCount    int64 `statsd:"drop-doc-count"`
 	TotalTime       int64 `statsd:"total-time"`
-	AvgTime         int64 `statsd:"avg-time"`
+	AvgTime         int64 `statsd:"avg-time,gauge"`
 
 	FlowPortCount       int64 `statsd:"vtap-flow-port"`
 	FlowPort1sCount     int64 `statsd:"vtap-flow-port-1s"`
@@ -53,6 +53,7 @@ import (
 	flowmetrics "github.com/deepflowio/deepflow/server/ingester/flow_metrics/flow_metrics"
 	pcapcfg "github.com/deepflowio/deepflow/server/ingester/pcap/config"
 	"github.com/deepflowio/deepflow/server/ingester/pcap/pcap"
+	"github.com/deepflowio/deepflow/server/ingester/pkg/ckwriter"
 	profilecfg "github.com/deepflowio/deepflow/server/ingester/profile/config"
 	"github.com/deepflowio/deepflow/server/ingester/profile/profile"
 	prometheuscfg "github.com/deepflowio/deepflow/server/ingester/prometheus/config"
@@ -93,6 +94,8 @@ func Start(configPath string, shared *servercommon.ControllerIngesterShared) []i
 	stats.SetRemoteType(stats.REMOTE_TYPE_DFSTATSD)
 	stats.SetDFRemote(net.JoinHostPort("127.0.0.1", strconv.Itoa(int(cfg.ListenPort))))
 
+	ckwriter.SetSpoolConfig(&cfg.CKWriterSpool)
+
 	receiver := receiver.NewReceiver(int(cfg.ListenPort), cfg.UDPReadBuffer, cfg.TCPReadBuffer, cfg.TCPReaderBuffer)
 
 	ingesterOrgHandler := NewOrgHandler(cfg)
@@ -181,7 +184,7 @@ func Start(configPath string, shared *servercommon.ControllerIngesterShared) []i
 
 		if !cfg.StorageDisabled {
 			// 写ext_metrics数据
-			extMetrics, err := ext_metrics.NewExtMetrics(extMetricsConfig, receiver, platformDataManager)
+			extMetrics, err := ext_metrics.NewExtMetrics(extMetricsConfig, receiver, platformDataManager, exporters)
 			checkError(err)
 			extMetrics.Start()
 			closers = append(closers, extMetrics)
@@ -205,20 +208,20 @@ func Start(configPath string, shared *servercommon.ControllerIngesterShared) []i
 			closers = append(closers, pcaper)
 
 			// write profile data
-			profile, err := profile.NewProfile(profileConfig, receiver, platformDataManager)
+			profile, err := profile.NewProfile(profileConfig, receiver, platformDataManager, exporters)
 			checkError(err)
 			profile.Start()
 			closers = append(closers, profile)
 
 			// write prometheus data
-			prometheus, err := prometheus.NewPrometheusHandler(prometheusConfig, receiver, platformDataManager)
+			prometheus, err := prometheus.NewPrometheusHandler(prometheusConfig, receiver, platformDataManager, exporters)
 			checkError(err)
 			prometheus.Start()
 			closers = append(closers, prometheus)
 			ingesterOrgHandler.SetPromHandler(prometheus)
 
 			// write application log data
-			applicationLog, err := app_log.NewApplicationLogger(applicationLogConfig, receiver, platformDataManager)
+			applicationLog, err := app_log.NewApplicationLogger(applicationLogConfig, receiver, platformDataManager, exporters)
 			checkError(err)
 			applicationLog.Start()
 			closers = append(closers, applicationLog)
@@ -59,6 +59,7 @@ const (
 	CMD_CONTINUOUS_PROFILER
 	CMD_ORG_SWITCH
 	CMD_FREE_OS_MEMORY
+	CMD_ARCHIVE_EXPORTER
 )
 
 const (
@@ -18,6 +18,7 @@ package ckwriter
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"reflect"
@@ -121,6 +122,7 @@ type QueueContext struct {
 	conns           []*ch.Client
 	connCount       int
 	counter         Counter
+	spool           *spool // nil if spool is disabled
 }
 
 func (qc *QueueContext) EndpointsChange(addrs []string) {
@@ -398,6 +400,11 @@ func NewCKWriter(addrs []string, user, password, counterName, timeZone string, t
 		}
 	}
 	name := fmt.Sprintf("%s-%s-%s", table.Database, table.LocalName, counterName)
+	for i := range queueContexts {
+		if queueContexts[i].spool, err = newSpool(name, i); err != nil {
+			log.Warningf("ckwriter %s queue %d init spool failed, spool is disabled: %s", name, i, err)
+		}
+	}
 	dataQueues := queue.NewOverwriteQueues(
 		name, queue.HashKey(queueCount), queueSize,
 		queue.OptionFlushIndicator(time.Second),
@@ -452,6 +459,15 @@ type Counter struct {
 	RetryCount        int64 `statsd:"retry-count"`
 	RetryFailedCount  int64 `statsd:"retry-failed-count"`
 	OrgInvalidCount   int64 `statsd:"org-invalid-count"`
+
+	SpoolCount             int64 `statsd:"spool-count"`
+	SpoolBytes             int64 `statsd:"spool-bytes"`
+	SpoolFailedCount       int64 `statsd:"spool-failed-count"`
+	SpoolReplayCount       int64 `statsd:"spool-replay-count"`
+	SpoolReplayFailedCount int64 `statsd:"spool-replay-failed-count"`
+	SpoolExpiredCount      int64 `statsd:"spool-expired-count"`
+	SpoolEvictedCount      int64 `statsd:"spool-evicted-count"`
+	SpoolDroppedCount      int64 `statsd:"spool-dropped-count"`
 	utils.Closable
 }
 
@@ -487,6 +503,7 @@ type Cache struct {
 	lastWriteTime time.Time
 	tableCreated  bool
 	dropTime      uint32
+	spooled       bool // whether the last failed block is spooled
 }
 
 func (c *Cache) Release() {
@@ -543,6 +560,7 @@ func (w *CKWriter) queueProcess(queueID int) {
 						w.Write(queueID, cache)
 					}
 				}
+				w.replaySpool(queueID, now)
 			} else {
 				log.Warningf("get writer queue data type wrong %T", item)
 			}
@@ -563,15 +581,34 @@ func (c *Cache) Add(item CKItem) error {
 	return nil
 }
 
+// spoolBlock saves the column block to the spool before it is reset
+func (c *Cache) spoolBlock() bool {
+	qc := c.queueContext
+	if qc.spool == nil || c.size == 0 || IsNil(c.columnBlock) {
+		return false
+	}
+	c.protoInput = c.columnBlock.ToInput(c.protoInput[:0])
+	if err := qc.spool.put(c.orgID, c.protoInput, &qc.counter); err != nil {
+		if qc.counter.SpoolFailedCount == 0 {
+			log.Warningf("spool (%s) failed, drop (%d) items: %s", c.prepare, c.size, err)
+		}
+		qc.counter.SpoolFailedCount += int64(c.size)
+		return false
+	}
+	return true
+}
+
 func (c *Cache) Write() error {
 	if c.size == 0 {
 		return nil
 	}
+	c.spooled = false
 
 	connIndex := c.writeCounter % c.queueContext.connCount
 	conn := c.queueContext.conns[connIndex]
 	if conn == nil || conn.IsClosed() {
 		if err := c.queueContext.initConn(connIndex); err != nil {
+			c.spooled = c.spoolBlock()
 			c.writeCounter++
 			c.lastWriteTime = time.Now()
 			c.size = 0
@@ -588,6 +625,9 @@ func (c *Cache) Write() error {
 		Body:  c.prepare,
 		Input: input,
 	})
+	if err != nil {
+		c.spooled = c.spoolBlock()
+	}
 	c.writeCounter++
 	c.lastWriteTime = time.Now()
 	c.size = 0
@@ -622,7 +662,7 @@ func (w *CKWriter) Write(queueID int, cache *Cache) {
 	qc.EndpointsChange(w.addrs)
 	itemsLen := cache.size
 	// Prevent frequent log writing
-	logEnabled := qc.counter.WriteFailedCount == 0
+	logEnabled := qc.counter.WriteFailedCount == 0 && qc.counter.SpoolCount == 0
 	if !cache.OrgIdExists() {
 		if logEnabled {
 			log.Warningf("table (%s.%s) orgId is not exist, drop (%d) items", w.table.OrgDatabase(cache.orgID), w.table.LocalName, itemsLen)
@@ -634,25 +674,114 @@ func (w *CKWriter) Write(queueID int, cache *Cache) {
 	if !cache.tableCreated {
 		err := w.InitTable(queueID, cache.orgID)
 		if err != nil {
+			action := "drop"
+			spooled := cache.spoolBlock()
+			if spooled {
+				action = "spool"
+			}
 			if logEnabled {
-				log.Warningf("create table (%s.%s) failed, drop (%d) items: %s", w.table.OrgDatabase(cache.orgID), w.table.LocalName, itemsLen, err)
+				log.Warningf("create table (%s.%s) failed, %s (%d) items: %s", w.table.OrgDatabase(cache.orgID), w.table.LocalName, action, itemsLen, err)
+			}
+			// the spooled items are counted by SpoolCount, they are not lost
+			if !spooled {
+				qc.counter.WriteFailedCount += int64(itemsLen)
 			}
-			qc.counter.WriteFailedCount += int64(itemsLen)
 			cache.Release()
 			return
 		}
 		cache.tableCreated = true
 	}
 	if err := cache.Write(); err != nil {
+		action := "drop"
+		if cache.spooled {
+			action = "spool"
+		}
 		if logEnabled {
-			log.Warningf("write table (%s.%s) failed, drop (%d) items: %s", w.table.OrgDatabase(cache.orgID), w.table.LocalName, itemsLen, err)
+			log.Warningf("write table (%s.%s) failed, %s (%d) items: %s", w.table.OrgDatabase(cache.orgID), w.table.LocalName, action, itemsLen, err)
+		}
+		if !cache.spooled {
+			qc.counter.WriteFailedCount += int64(itemsLen)
 		}
-		qc.counter.WriteFailedCount += int64(itemsLen)
 	} else {
 		qc.counter.WriteSuccessCount += int64(itemsLen)
 	}
 }
 
+// replaySpool writes the spooled blocks to ClickHouse in order, stops at the first failure and retries after the replay interval
+func (w *CKWriter) replaySpool(queueID int, now time.Time) {
+	qc := w.queueContexts[queueID]
+	s := qc.spool
+	if s == nil || s.isEmpty() || now.Sub(s.lastReplay) < s.replayInterval {
+		return
+	}
+	s.lastReplay = now
+	s.expire(now, &qc.counter)
+	qc.EndpointsChange(w.addrs)
+
+	remaining, err := s.replay(&qc.counter, func(f *spoolFile, input proto.Input) error {
+		if w.exit {
+			return errors.New("ckwriter is closed")
+		}
+		cache := qc.orgCaches[f.orgID]
+		if !cache.OrgIdExists() {
+			log.Warningf("table (%s.%s) orgId is not exist, drop (%d) spooled items", w.table.OrgDatabase(f.orgID), w.table.LocalName, f.rows)
+			qc.counter.OrgInvalidCount += int64(f.rows)
+			return errSpoolDrop
+		}
+		if !cache.tableCreated {
+			if err := w.InitTable(queueID, f.orgID); err != nil {
+				return fmt.Errorf("create table failed: %s", err)
+			}
+			cache.tableCreated = true
+		}
+
+		connIndex := cache.writeCounter % qc.connCount
+		cache.writeCounter++
+		conn := qc.conns[connIndex]
+		if conn == nil || conn.IsClosed() {
+			if err := qc.initConn(connIndex); err != nil {
+				return fmt.Errorf("connect failed: %s", err)
+			}
+			conn = qc.conns[connIndex]
+		}
+		err := conn.Do(context.Background(), ch.Query{
+			Body:  fmt.Sprintf("INSERT INTO %s.`%s` %s VALUES", w.table.OrgDatabase(f.orgID), w.table.LocalName, input.Columns()),
+			Input: input,
+		})
+		if err != nil && !isSpoolRetryable(err) {
+			log.Warningf("replay ckwriter spool file %s to table (%s.%s) failed and can not be retried, drop (%d) items: %s", f.path, w.table.OrgDatabase(f.orgID), w.table.LocalName, f.rows, err)
+			qc.counter.SpoolDroppedCount += int64(f.rows)
+			return errSpoolDrop
+		}
+		return err
+	})
+	if err == nil && remaining && !w.exit {
+		// continue replaying at the next flush ticker, otherwise retry after the replay interval
+		s.lastReplay = time.Time{}
+	}
+}
+
+// spoolUnretryableErrors are the ClickHouse errors caused by the block itself, such as the schema or type mismatch,
+// the block will never be inserted successfully and would stall the spool until it expires
+var spoolUnretryableErrors = []proto.Error{
+	proto.ErrThereIsNoColumn,
+	proto.ErrSizesOfColumnsDoesntMatch,
+	proto.ErrNoSuchColumnInTable,
+	proto.ErrNumberOfColumnsDoesntMatch,
+	proto.ErrIllegalTypeOfArgument,
+	proto.ErrIllegalColumn,
+	proto.ErrUnknownType,
+	proto.ErrTypeMismatch,
+	proto.ErrCannotConvertType,
+	proto.ErrIncorrectData,
+	proto.ErrValueIsOutOfRangeOfDataType,
+	proto.ErrCannotInsertNullInOrdinaryColumn,
+}
+
+func isSpoolRetryable(err error) bool {
+	return !ch.IsErr(err, spoolUnretryableErrors...)
+}
+
 func IsNil(i interface{}) bool {
 	if i == nil {
 		return true
@@ -674,6 +803,9 @@ func (w *CKWriter) Close() {
 				qc.conns[i] = nil
 			}
 		}
+		if qc.spool != nil {
+			qc.spool.close()
+		}
 		qc.counter.Close()
 	}
 
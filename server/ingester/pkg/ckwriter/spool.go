@@ -0,0 +1,422 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ckwriter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/ch-go/proto"
+
+	"github.com/deepflowio/deepflow/server/ingester/config"
+	"github.com/deepflowio/deepflow/server/libs/ckdb"
+)
+
+const (
+	SPOOL_FILE_SUFFIX = ".blk"
+	SPOOL_TMP_SUFFIX  = ".tmp"
+	SPOOL_MAGIC       = "DFSP"
+	SPOOL_HEADER_LEN  = 8 // magic + protocol version
+	SPOOL_REPLAY_MAX  = 8 // the maximum blocks replayed each time, avoid blocking the queue for too long
+	SPOOL_READ_RETRY  = 3 // the spooled block is dropped after failing to read it several times
+)
+
+var (
+	spoolConfig *config.CKWriterSpool
+
+	// spoolLock protects the files of all the spools, they share the spoolConfig.MaxSize limit and
+	// evict the blocks of each other when the limit is exceeded
+	spoolLock      sync.Mutex
+	spools         = make(map[*spool]struct{})
+	spoolTotalSize int64
+)
+
+// SetSpoolConfig enables the spool of all the ckwriters created afterwards
+func SetSpoolConfig(cfg *config.CKWriterSpool) {
+	if cfg == nil || !cfg.Enabled {
+		spoolConfig = nil
+		return
+	}
+	spoolConfig = cfg
+}
+
+type spoolFile struct {
+	path       string
+	seq        uint64
+	orgID      uint16
+	rows       int
+	size       int64
+	createTime time.Time
+	readFailed int
+}
+
+// spool is the write-ahead spool of one ckwriter queue, every column block which failed to write is
+// saved as a file named '<seq>-<orgID>-<rows>.blk', and replayed in the order of seq.
+type spool struct {
+	dir            string
+	maxSize        int64
+	maxAge         time.Duration
+	replayInterval time.Duration
+	lastReplay     time.Time
+
+	// the following fields are protected by spoolLock, since other spools may evict the files
+	seq         uint64
+	files       []*spoolFile
+	size        int64
+	evictedRows int64 // rows evicted by other spools, not yet added to the counter
+}
+
+func newSpool(name string, queueID int) (*spool, error) {
+	cfg := spoolConfig
+	if cfg == nil {
+		return nil, nil
+	}
+	s := &spool{
+		dir:            filepath.Join(cfg.Dir, name, strconv.Itoa(queueID)),
+		maxSize:        int64(cfg.MaxSize) << 20,
+		maxAge:         time.Duration(cfg.MaxAge) * time.Minute,
+		replayInterval: time.Duration(cfg.ReplayInterval) * time.Second,
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if len(s.files) > 0 {
+		log.Infof("ckwriter spool %s loaded %d blocks", s.dir, len(s.files))
+	}
+	spoolLock.Lock()
+	spools[s] = struct{}{}
+	spoolTotalSize += s.size
+	spoolLock.Unlock()
+	return s, nil
+}
+
+// close unregisters the spool, the spooled files are kept and loaded again after restarting
+func (s *spool) close() {
+	spoolLock.Lock()
+	if _, ok := spools[s]; ok {
+		delete(spools, s)
+		spoolTotalSize -= s.size
+	}
+	spoolLock.Unlock()
+}
+
+// load the blocks spooled before restarting
+func (s *spool) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(s.dir, name)
+		if strings.HasSuffix(name, SPOOL_TMP_SUFFIX) {
+			os.Remove(path)
+			continue
+		}
+		if !strings.HasSuffix(name, SPOOL_FILE_SUFFIX) {
+			continue
+		}
+		fields := strings.Split(strings.TrimSuffix(name, SPOOL_FILE_SUFFIX), "-")
+		if len(fields) != 3 {
+			continue
+		}
+		seq, err1 := strconv.ParseUint(fields[0], 10, 64)
+		orgID, err2 := strconv.ParseUint(fields[1], 10, 16)
+		rows, err3 := strconv.Atoi(fields[2])
+		info, err4 := entry.Info()
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			log.Warningf("invalid ckwriter spool file %s, remove it", path)
+			os.Remove(path)
+			continue
+		}
+		if orgID > ckdb.MAX_ORG_ID {
+			log.Warningf("ckwriter spool file %s has invalid org id %d (max %d), remove it", path, orgID, ckdb.MAX_ORG_ID)
+			os.Remove(path)
+			continue
+		}
+		s.files = append(s.files, &spoolFile{
+			path:       path,
+			seq:        seq,
+			orgID:      uint16(orgID),
+			rows:       rows,
+			size:       info.Size(),
+			createTime: info.ModTime(),
+		})
+		s.size += info.Size()
+		if seq >= s.seq {
+			s.seq = seq + 1
+		}
+	}
+	sort.Slice(s.files, func(i, j int) bool { return s.files[i].seq < s.files[j].seq })
+	return nil
+}
+
+func (s *spool) isEmpty() bool {
+	spoolLock.Lock()
+	defer spoolLock.Unlock()
+	return len(s.files) == 0
+}
+
+// first returns the oldest spooled block, nil if the spool is empty
+func (s *spool) first() *spoolFile {
+	spoolLock.Lock()
+	defer spoolLock.Unlock()
+	if len(s.files) == 0 {
+		return nil
+	}
+	return s.files[0]
+}
+
+// takeEvicted returns the rows evicted by other spools since the last call
+func (s *spool) takeEvicted() int64 {
+	spoolLock.Lock()
+	defer spoolLock.Unlock()
+	rows := s.evictedRows
+	s.evictedRows = 0
+	return rows
+}
+
+// removeLocked deletes the file, returns false if it has been removed already, needs spoolLock
+func (s *spool) removeLocked(f *spoolFile) bool {
+	for i, file := range s.files {
+		if file != f {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			log.Warningf("remove ckwriter spool file %s failed: %s", f.path, err)
+		}
+		s.files = append(s.files[:i], s.files[i+1:]...)
+		s.size -= f.size
+		spoolTotalSize -= f.size
+		return true
+	}
+	return false
+}
+
+func (s *spool) remove(f *spoolFile) bool {
+	spoolLock.Lock()
+	defer spoolLock.Unlock()
+	return s.removeLocked(f)
+}
+
+// evictLocked drops the oldest block of the largest spool, so that the spool of a hot table
+// evicts its own blocks first instead of the blocks of other tables, needs spoolLock
+func evictLocked() bool {
+	var victim *spool
+	for sp := range spools {
+		if len(sp.files) == 0 {
+			continue
+		}
+		if victim == nil || sp.size > victim.size ||
+			(sp.size == victim.size && sp.files[0].createTime.Before(victim.files[0].createTime)) {
+			victim = sp
+		}
+	}
+	if victim == nil {
+		return false
+	}
+	f := victim.files[0]
+	victim.removeLocked(f)
+	victim.evictedRows += int64(f.rows)
+	log.Infof("ckwriter spool is full, evict file %s, drop (%d) items", f.path, f.rows)
+	return true
+}
+
+// put encodes the column block in ClickHouse native format and saves it to disk,
+// the oldest blocks of the largest spool are dropped if the total size exceeds the limit.
+func (s *spool) put(orgID uint16, input proto.Input, counter *Counter) error {
+	if len(input) == 0 {
+		return nil
+	}
+	rows := input[0].Data.Rows()
+	if rows == 0 {
+		return nil
+	}
+	buf := &proto.Buffer{}
+	buf.Buf = append(buf.Buf, SPOOL_MAGIC...)
+	buf.Buf = binary.LittleEndian.AppendUint32(buf.Buf, uint32(proto.Version))
+	block := proto.Block{Columns: len(input), Rows: rows}
+	if err := block.EncodeRawBlock(buf, proto.Version, input); err != nil {
+		return err
+	}
+	size := int64(len(buf.Buf))
+	if size > s.maxSize {
+		return fmt.Errorf("block size %d exceeds the spool max size %d", size, s.maxSize)
+	}
+
+	// reserve the size and seq under the lock, and write the file outside the lock to avoid blocking other spools
+	f, err := s.reserve(orgID, rows, size, counter)
+	if err != nil {
+		return err
+	}
+	tmpPath := f.path + SPOOL_TMP_SUFFIX
+	err = os.WriteFile(tmpPath, buf.Buf, 0644)
+	if err == nil {
+		err = os.Rename(tmpPath, f.path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	s.commit(f, err)
+	if err != nil {
+		return err
+	}
+	counter.SpoolCount += int64(rows)
+	counter.SpoolBytes += size
+	return nil
+}
+
+// reserve evicts blocks until the size fits in the limit, and adds the size to the total size so that
+// the concurrent puts of other spools do not exceed the limit
+func (s *spool) reserve(orgID uint16, rows int, size int64, counter *Counter) (*spoolFile, error) {
+	spoolLock.Lock()
+	defer func() {
+		counter.SpoolEvictedCount += s.evictedRows
+		s.evictedRows = 0
+		spoolLock.Unlock()
+	}()
+	for spoolTotalSize+size > s.maxSize {
+		if !evictLocked() {
+			return nil, fmt.Errorf("spool is full (%d bytes)", spoolTotalSize)
+		}
+	}
+	f := &spoolFile{
+		seq:        s.seq,
+		orgID:      orgID,
+		rows:       rows,
+		size:       size,
+		createTime: time.Now(),
+	}
+	f.path = filepath.Join(s.dir, fmt.Sprintf("%020d-%d-%d%s", f.seq, orgID, rows, SPOOL_FILE_SUFFIX))
+	s.seq++
+	spoolTotalSize += size
+	return f, nil
+}
+
+// commit adds the written file to the spool, or releases the reserved size if the write failed
+func (s *spool) commit(f *spoolFile, err error) {
+	spoolLock.Lock()
+	defer spoolLock.Unlock()
+	if err != nil {
+		spoolTotalSize -= f.size
+		return
+	}
+	// keep the files in the order of seq
+	i := len(s.files)
+	for i > 0 && s.files[i-1].seq > f.seq {
+		i--
+	}
+	s.files = append(s.files, nil)
+	copy(s.files[i+1:], s.files[i:])
+	s.files[i] = f
+	s.size += f.size
+}
+
+// read decodes the spooled block into columns which can be used as the input of insert
+func (s *spool) read(f *spoolFile) (proto.Input, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < SPOOL_HEADER_LEN || string(data[:len(SPOOL_MAGIC)]) != SPOOL_MAGIC {
+		return nil, errors.New("invalid spool file header")
+	}
+	version := int(binary.LittleEndian.Uint32(data[len(SPOOL_MAGIC):SPOOL_HEADER_LEN]))
+	var (
+		block   proto.Block
+		results proto.Results
+	)
+	if err := block.DecodeRawBlock(proto.NewReader(bytes.NewReader(data[SPOOL_HEADER_LEN:])), version, results.Auto()); err != nil {
+		return nil, err
+	}
+	input := make(proto.Input, 0, len(results))
+	for _, r := range results {
+		col, ok := r.Data.(proto.ColInput)
+		if !ok {
+			return nil, fmt.Errorf("column %s type %s can not be used as input", r.Name, r.Data.Type())
+		}
+		input = append(input, proto.InputColumn{Name: r.Name, Data: col})
+	}
+	return input, nil
+}
+
+// expire drops the blocks older than maxAge
+func (s *spool) expire(now time.Time, counter *Counter) {
+	spoolLock.Lock()
+	defer spoolLock.Unlock()
+	for len(s.files) > 0 && now.Sub(s.files[0].createTime) > s.maxAge {
+		f := s.files[0]
+		s.removeLocked(f)
+		counter.SpoolExpiredCount += int64(f.rows)
+		log.Infof("ckwriter spool file %s expired, drop (%d) items", f.path, f.rows)
+	}
+}
+
+// errSpoolDrop is returned by the insert function of replay if the block should be dropped
+var errSpoolDrop = errors.New("drop spooled block")
+
+// replay inserts at most SPOOL_REPLAY_MAX blocks in the order of seq, stops at the first failure and
+// keeps the failed block for the next retry. Returns whether there are blocks left and the error of the
+// failed block, the caller should wait for the replay interval before the next retry if err is not nil.
+func (s *spool) replay(counter *Counter, insert func(f *spoolFile, input proto.Input) error) (bool, error) {
+	counter.SpoolEvictedCount += s.takeEvicted()
+	for i := 0; i < SPOOL_REPLAY_MAX; i++ {
+		f := s.first()
+		if f == nil {
+			return false, nil
+		}
+		input, err := s.read(f)
+		if err != nil {
+			counter.SpoolReplayFailedCount++
+			f.readFailed++
+			if f.readFailed < SPOOL_READ_RETRY {
+				log.Warningf("read ckwriter spool file %s failed, will retry: %s", f.path, err)
+				return true, err
+			}
+			log.Warningf("read ckwriter spool file %s failed %d times, drop (%d) items: %s", f.path, f.readFailed, f.rows, err)
+			if s.remove(f) {
+				counter.SpoolDroppedCount += int64(f.rows)
+			}
+			continue
+		}
+		if err := insert(f, input); err != nil {
+			if err == errSpoolDrop {
+				s.remove(f)
+				continue
+			}
+			counter.SpoolReplayFailedCount++
+			log.Warningf("replay ckwriter spool file %s failed, will retry: %s", f.path, err)
+			return true, err
+		}
+		// the file may have been evicted while inserting
+		s.remove(f)
+		counter.SpoolReplayCount += int64(f.rows)
+	}
+	return !s.isEmpty(), nil
+}
@@ -0,0 +1,244 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ckwriter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ClickHouse/ch-go"
+	"github.com/ClickHouse/ch-go/proto"
+
+	"github.com/deepflowio/deepflow/server/ingester/config"
+	"github.com/deepflowio/deepflow/server/libs/ckdb"
+)
+
+func newTestSpool(t *testing.T, name string) *spool {
+	SetSpoolConfig(&config.CKWriterSpool{
+		Enabled:        true,
+		Dir:            t.TempDir(),
+		MaxSize:        1,
+		MaxAge:         60,
+		ReplayInterval: 10,
+	})
+	defer SetSpoolConfig(nil)
+	s, err := newSpool(name, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.close)
+	return s
+}
+
+func testInput(rows int) proto.Input {
+	col := proto.ColUInt64{}
+	for i := 0; i < rows; i++ {
+		col.Append(uint64(i))
+	}
+	return proto.Input{{Name: "id", Data: &col}}
+}
+
+func putBlocks(t *testing.T, s *spool, counter *Counter, count int) {
+	for i := 0; i < count; i++ {
+		if err := s.put(1, testInput(10), counter); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSpoolEvictFair(t *testing.T) {
+	hot, cold := newTestSpool(t, "hot"), newTestSpool(t, "cold")
+	var hotCounter, coldCounter Counter
+	putBlocks(t, cold, &coldCounter, 1)
+	putBlocks(t, hot, &hotCounter, 3)
+	blockSize := cold.files[0].size
+
+	// 总大小只能容纳 4 个数据块，热表继续写入时应淘汰自己最旧的数据块
+	hot.maxSize = blockSize * 4
+	cold.maxSize = blockSize * 4
+	oldest := hot.files[0]
+	putBlocks(t, hot, &hotCounter, 2)
+
+	if len(cold.files) != 1 {
+		t.Fatalf("the only block of the cold spool is evicted, files: %d", len(cold.files))
+	}
+	if len(hot.files) != 3 || hot.files[0] == oldest {
+		t.Fatalf("expect the oldest hot blocks to be evicted, files: %d", len(hot.files))
+	}
+	if _, err := os.Stat(oldest.path); !os.IsNotExist(err) {
+		t.Fatalf("evicted file %s still exists", oldest.path)
+	}
+	if hotCounter.SpoolEvictedCount != 20 || coldCounter.SpoolEvictedCount != 0 || hotCounter.SpoolExpiredCount != 0 {
+		t.Fatalf("unexpected evicted count hot %d cold %d", hotCounter.SpoolEvictedCount, coldCounter.SpoolEvictedCount)
+	}
+
+	// 冷表的数据块比热表大时，淘汰冷表的数据块，被淘汰的行数在冷表下次 replay 时计入
+	hot.maxSize = blockSize * 5
+	cold.maxSize = blockSize * 5
+	putBlocks(t, cold, &coldCounter, 2)
+	hot.maxSize = blockSize * 6
+	cold.maxSize = blockSize * 6
+	putBlocks(t, cold, &coldCounter, 1)
+	putBlocks(t, hot, &hotCounter, 1)
+	if len(hot.files) != 3 || len(cold.files) != 3 {
+		t.Fatalf("unexpected files hot %d cold %d", len(hot.files), len(cold.files))
+	}
+	cold.replay(&coldCounter, func(*spoolFile, proto.Input) error { return errors.New("unavailable") })
+	if coldCounter.SpoolEvictedCount != 10 {
+		t.Fatalf("expect the evicted rows to be counted by the cold spool, got %d", coldCounter.SpoolEvictedCount)
+	}
+	if spoolTotalSize != hot.size+cold.size {
+		t.Fatalf("total size %d mismatch with hot %d cold %d", spoolTotalSize, hot.size, cold.size)
+	}
+}
+
+func TestSpoolPutFailed(t *testing.T) {
+	s := newTestSpool(t, "failed")
+	var counter Counter
+	putBlocks(t, s, &counter, 1)
+	totalSize := spoolTotalSize
+
+	// 写文件失败时应释放预留的大小
+	if err := os.RemoveAll(s.dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.put(1, testInput(10), &counter); err == nil {
+		t.Fatal("expect put to fail after the spool dir is removed")
+	}
+	if spoolTotalSize != totalSize || len(s.files) != 1 || counter.SpoolCount != 10 {
+		t.Fatalf("unexpected total size %d files %d spool count %d", spoolTotalSize, len(s.files), counter.SpoolCount)
+	}
+}
+
+func TestSpoolReplay(t *testing.T) {
+	s := newTestSpool(t, "replay")
+	var counter Counter
+	putBlocks(t, s, &counter, 3)
+
+	// 写入失败时保留文件，等待下次重试
+	failed := errors.New("connection refused")
+	if remaining, err := s.replay(&counter, func(*spoolFile, proto.Input) error { return failed }); !remaining || err != failed {
+		t.Fatalf("expect blocks left and the insert error returned after replay failed, remaining %v err %v", remaining, err)
+	}
+	if len(s.files) != 3 || counter.SpoolReplayFailedCount != 1 || counter.SpoolReplayCount != 0 {
+		t.Fatalf("unexpected state after replay failed, files %d counter %+v", len(s.files), counter)
+	}
+
+	var replayed []uint64
+	remaining, err := s.replay(&counter, func(f *spoolFile, input proto.Input) error {
+		if len(input) != 1 || input[0].Name != "id" || input[0].Data.Rows() != f.rows {
+			t.Fatalf("unexpected replayed input %+v", input)
+		}
+		replayed = append(replayed, f.seq)
+		return nil
+	})
+	if remaining || err != nil || !s.isEmpty() {
+		t.Fatalf("expect all blocks replayed, err %v", err)
+	}
+	if len(replayed) != 3 || replayed[0] != 0 || replayed[1] != 1 || replayed[2] != 2 {
+		t.Fatalf("blocks are not replayed in order: %v", replayed)
+	}
+	if counter.SpoolReplayCount != 30 {
+		t.Fatalf("expect 30 rows replayed, got %d", counter.SpoolReplayCount)
+	}
+}
+
+func TestSpoolReplayReadFailed(t *testing.T) {
+	s := newTestSpool(t, "corrupt")
+	var counter Counter
+	putBlocks(t, s, &counter, 2)
+	corrupt := s.files[0]
+	if err := os.WriteFile(corrupt.path, []byte("invalid"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	inserted := 0
+	insert := func(*spoolFile, proto.Input) error {
+		inserted++
+		return nil
+	}
+	for i := 1; i < SPOOL_READ_RETRY; i++ {
+		if _, err := s.replay(&counter, insert); err == nil {
+			t.Fatal("expect the read error returned")
+		}
+		if len(s.files) != 2 || inserted != 0 {
+			t.Fatalf("expect the unreadable block to be kept for retry, files %d", len(s.files))
+		}
+	}
+	if _, err := s.replay(&counter, insert); err != nil {
+		t.Fatalf("unexpected replay error: %s", err)
+	}
+	if !s.isEmpty() || inserted != 1 {
+		t.Fatalf("expect the unreadable block dropped and the next replayed, files %d inserted %d", len(s.files), inserted)
+	}
+	if counter.SpoolReplayFailedCount != SPOOL_READ_RETRY || counter.SpoolDroppedCount != 10 {
+		t.Fatalf("unexpected counter %+v", counter)
+	}
+}
+
+func TestSpoolReplayDrop(t *testing.T) {
+	s := newTestSpool(t, "drop")
+	var counter Counter
+	putBlocks(t, s, &counter, 2)
+
+	// 无法重试的 block 被丢弃，不阻塞后续 block
+	var replayed []uint64
+	remaining, err := s.replay(&counter, func(f *spoolFile, input proto.Input) error {
+		if f.seq == 0 {
+			return errSpoolDrop
+		}
+		replayed = append(replayed, f.seq)
+		return nil
+	})
+	if remaining || err != nil || !s.isEmpty() || len(replayed) != 1 || replayed[0] != 1 {
+		t.Fatalf("expect the dropped block skipped, remaining %v err %v replayed %v", remaining, err, replayed)
+	}
+
+	if isSpoolRetryable(fmt.Errorf("insert failed: %w", &ch.Exception{Code: proto.ErrTypeMismatch})) {
+		t.Error("expect type mismatch not retryable")
+	}
+	if !isSpoolRetryable(&ch.Exception{Code: proto.ErrTooManyParts}) || !isSpoolRetryable(errors.New("connection refused")) {
+		t.Error("expect too many parts and connection errors retryable")
+	}
+}
+
+func TestSpoolLoad(t *testing.T) {
+	s := newTestSpool(t, "load")
+	var counter Counter
+	putBlocks(t, s, &counter, 2)
+	os.WriteFile(s.files[0].path+SPOOL_TMP_SUFFIX, []byte("partial"), 0644)
+	invalidOrgPath := filepath.Join(s.dir, fmt.Sprintf("%d-%d-10%s", 100, ckdb.MAX_ORG_ID+1, SPOOL_FILE_SUFFIX))
+	os.WriteFile(invalidOrgPath, []byte("block"), 0644)
+	s.close()
+
+	loaded := &spool{dir: s.dir}
+	if err := loaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.files) != 2 || loaded.seq != 2 || loaded.size != s.size {
+		t.Fatalf("unexpected loaded spool files %d seq %d size %d", len(loaded.files), loaded.seq, loaded.size)
+	}
+	if _, err := os.Stat(s.files[0].path + SPOOL_TMP_SUFFIX); !os.IsNotExist(err) {
+		t.Fatal("expect the temporary file to be removed")
+	}
+	if _, err := os.Stat(invalidOrgPath); !os.IsNotExist(err) {
+		t.Fatal("expect the file with invalid org id to be removed")
+	}
+}
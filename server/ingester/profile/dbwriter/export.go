@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dbwriter
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	exportercommon "github.com/deepflowio/deepflow/server/ingester/exporters/common"
+	exporterconfig "github.com/deepflowio/deepflow/server/ingester/exporters/config"
+	utag "github.com/deepflowio/deepflow/server/ingester/exporters/universal_tag"
+	"github.com/deepflowio/deepflow/server/libs/utils"
+)
+
+func (p *InProcessProfile) DataSource() uint32 {
+	return uint32(exporterconfig.PROFILE)
+}
+
+func (p *InProcessProfile) TimestampUs() int64 {
+	return int64(p.Time) * 1000000
+}
+
+func (p *InProcessProfile) GetFieldValueByOffsetAndKind(offset uintptr, kind reflect.Kind, dataType utils.DataType) interface{} {
+	return utils.GetValueByOffsetAndKind(uintptr(unsafe.Pointer(p)), offset, kind, dataType)
+}
+
+func (p *InProcessProfile) QueryUniversalTags(utags *utag.UniversalTagsManager) *utag.UniversalTags {
+	return utags.QueryUniversalTags(p.OrgId,
+		p.RegionID, p.AZID, p.HostID, p.PodNSID, p.PodClusterID, p.SubnetID, p.VtapID,
+		p.L3DeviceType, p.AutoServiceType, p.AutoInstanceType,
+		p.L3DeviceID, p.AutoServiceID, p.AutoInstanceID, p.PodNodeID, p.PodGroupID, p.PodID, uint32(p.L3EpcID), p.GPID, p.ServiceID,
+		p.IsIPv4, p.IP4, p.IP6)
+}
+
+// the profile_location_str may be compressed, refer to compression_algo
+func (p *InProcessProfile) EncodeTo(protocol exporterconfig.ExportProtocol, utags *utag.UniversalTagsManager, cfg *exporterconfig.ExporterCfg) (interface{}, error) {
+	switch protocol {
+	case exporterconfig.PROTOCOL_KAFKA:
+		tags := p.QueryUniversalTags(utags)
+		if tags == nil {
+			tags = &utag.UniversalTags{}
+		}
+		k8sLabels := utags.QueryCustomK8sLabels(p.OrgId, p.PodID)
+		return exportercommon.EncodeToKafka(p, int(p.DataSource()), cfg, tags, tags, k8sLabels, k8sLabels), nil
+	default:
+		return nil, fmt.Errorf("profile unsupport export to %s", protocol)
+	}
+}
@@ -26,6 +26,8 @@ import (
 	"time"
 
 	"github.com/deepflowio/deepflow/server/ingester/common"
+	"github.com/deepflowio/deepflow/server/ingester/exporters"
+	exporterconfig "github.com/deepflowio/deepflow/server/ingester/exporters/config"
 	"github.com/deepflowio/deepflow/server/ingester/flow_tag"
 	profile_common "github.com/deepflowio/deepflow/server/ingester/profile/common"
 	"github.com/deepflowio/deepflow/server/ingester/profile/dbwriter"
@@ -64,7 +66,7 @@ type Counter struct {
 	CompressedSize int64 `statsd:"compressed-size"`
 
 	TotalTime int64 `statsd:"total-time"`
-	AvgTime   int64 `statsd:"avg-time"`
+	AvgTime   int64 `statsd:"avg-time,gauge"`
 
 	OffCpuSplitCount     int64 `statsd:"off-cpu-split-count"`
 	OffCpuSplitIntoCount int64 `statsd:"off-cpu-split-into-count"`
@@ -104,6 +106,7 @@ type Decoder struct {
 	inQueue             queue.QueueReader
 	profileWriter       *dbwriter.ProfileWriter
 	appServiceTagWriter *flow_tag.AppServiceTagWriter
+	exporters           *exporters.Exporters
 	compressionAlgo     string
 
 	offCpuSplittingGranularity int
@@ -120,7 +123,8 @@ func NewDecoder(index int, msgType datatype.MessageType, compressionAlgo string,
 	platformData *grpc.PlatformInfoTable,
 	inQueue queue.QueueReader,
 	profileWriter *dbwriter.ProfileWriter,
-	appServiceTagWriter *flow_tag.AppServiceTagWriter) *Decoder {
+	appServiceTagWriter *flow_tag.AppServiceTagWriter,
+	exporters *exporters.Exporters) *Decoder {
 	return &Decoder{
 		index:                      index,
 		msgType:                    msgType,
@@ -128,6 +132,7 @@ func NewDecoder(index int, msgType datatype.MessageType, compressionAlgo string,
 		inQueue:                    inQueue,
 		profileWriter:              profileWriter,
 		appServiceTagWriter:        appServiceTagWriter,
+		exporters:                  exporters,
 		compressionAlgo:            compressionAlgo,
 		offCpuSplittingGranularity: offCpuSplittingGranularity,
 		counter:                    &Counter{},
@@ -154,6 +159,7 @@ func (d *Decoder) Run() {
 		start := time.Now()
 		for i := 0; i < n; i++ {
 			if buffer[i] == nil {
+				d.export(nil)
 				continue
 			}
 			atomic.AddInt64(&d.counter.RawCount, 1)
@@ -185,6 +191,23 @@ func (d *Decoder) appServiceTagWrite(p *dbwriter.InProcessProfile) {
 	d.appServiceTagWriter.Write(p.Time, dbwriter.PROFILE_TABLE, p.AppService, p.AppInstance, p.OrgId, p.TeamID)
 }
 
+// export the profiles before writing, since the writer releases them after writing
+func (d *Decoder) profileWrite(items []interface{}) {
+	if d.exporters != nil {
+		for _, item := range items {
+			d.export(item.(*dbwriter.InProcessProfile))
+		}
+	}
+	d.profileWriter.Write(items)
+}
+
+func (d *Decoder) export(item *dbwriter.InProcessProfile) {
+	if d.exporters == nil {
+		return
+	}
+	d.exporters.Put(uint32(exporterconfig.PROFILE), d.index, item)
+}
+
 func (d *Decoder) handleProfileData(vtapID uint16, decoder *codec.SimpleDecoder) {
 	for !decoder.IsEnd() {
 		profile := &pb.Profile{}
@@ -199,7 +222,7 @@ func (d *Decoder) handleProfileData(vtapID uint16, decoder *codec.SimpleDecoder)
 			orgId:                       d.orgId,
 			teamId:                      d.teamId,
 			inTimestamp:                 time.Now(),
-			profileWriterCallback:       d.profileWriter.Write,
+			profileWriterCallback:       d.profileWrite,
 			appServiceTagWriterCallback: d.appServiceTagWrite,
 			platformData:                d.platformData,
 			IP:                          make([]byte, len(profile.Ip)),
@@ -21,6 +21,7 @@ import (
 	"time"
 
 	dropletqueue "github.com/deepflowio/deepflow/server/ingester/droplet/queue"
+	"github.com/deepflowio/deepflow/server/ingester/exporters"
 	"github.com/deepflowio/deepflow/server/ingester/flow_tag"
 	"github.com/deepflowio/deepflow/server/ingester/ingesterctl"
 	"github.com/deepflowio/deepflow/server/ingester/profile/config"
@@ -44,9 +45,9 @@ type Profiler struct {
 	PlatformDatas []*grpc.PlatformInfoTable
 }
 
-func NewProfile(config *config.Config, recv *receiver.Receiver, platformDataManager *grpc.PlatformDataManager) (*Profile, error) {
+func NewProfile(config *config.Config, recv *receiver.Receiver, platformDataManager *grpc.PlatformDataManager, exporters *exporters.Exporters) (*Profile, error) {
 	manager := dropletqueue.NewManager(ingesterctl.INGESTERCTL_PROFILE_QUEUE)
-	profiler, err := NewProfiler(datatype.MESSAGE_TYPE_PROFILE, config, platformDataManager, manager, recv)
+	profiler, err := NewProfiler(datatype.MESSAGE_TYPE_PROFILE, config, platformDataManager, manager, recv, exporters)
 	if err != nil {
 		return nil, err
 	}
@@ -55,7 +56,7 @@ func NewProfile(config *config.Config, recv *receiver.Receiver, platformDataMana
 	}, nil
 }
 
-func NewProfiler(msgType datatype.MessageType, config *config.Config, platformDataManager *grpc.PlatformDataManager, manager *dropletqueue.Manager, recv *receiver.Receiver) (*Profiler, error) {
+func NewProfiler(msgType datatype.MessageType, config *config.Config, platformDataManager *grpc.PlatformDataManager, manager *dropletqueue.Manager, recv *receiver.Receiver, exporters *exporters.Exporters) (*Profiler, error) {
 	decodeQueues := manager.NewQueues(
 		"1-receive-to-decode-"+msgType.String(),
 		config.DecoderQueueSize,
@@ -93,6 +94,7 @@ func NewProfiler(msgType datatype.MessageType, config *config.Config, platformDa
 			queue.QueueReader(decodeQueues.FixedMultiQueue[i]),
 			profileWriter,
 			appServiceTagWriter,
+			exporters,
 		)
 	}
 	return &Profiler{
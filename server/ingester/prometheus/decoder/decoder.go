@@ -28,6 +28,8 @@ import (
 	"github.com/prometheus/common/model"
 
 	"github.com/deepflowio/deepflow/server/ingester/common"
+	"github.com/deepflowio/deepflow/server/ingester/exporters"
+	exporterconfig "github.com/deepflowio/deepflow/server/ingester/exporters/config"
 	"github.com/deepflowio/deepflow/server/ingester/prometheus/config"
 	"github.com/deepflowio/deepflow/server/ingester/prometheus/dbwriter"
 	"github.com/deepflowio/deepflow/server/libs/ckdb"
@@ -138,12 +140,14 @@ type Decoder struct {
 	inQueue          queue.QueueReader
 	slowDecodeQueue  queue.QueueWriter
 	prometheusWriter *dbwriter.PrometheusWriter
+	exporters        *exporters.Exporters
 	debugEnabled     bool
 	config           *config.Config
 
 	orgId, teamId uint16
 
 	samplesBuilder *PrometheusSamplesBuilder
+	exportSamples  []*ExportSample
 
 	counter *Counter
 	utils.Closable
@@ -156,6 +160,7 @@ func NewDecoder(
 	inQueue queue.QueueReader,
 	slowDecodeQueue queue.QueueWriter,
 	prometheusWriter *dbwriter.PrometheusWriter,
+	exporters *exporters.Exporters,
 	config *config.Config,
 ) *Decoder {
 	return &Decoder{
@@ -165,6 +170,7 @@ func NewDecoder(
 		slowDecodeQueue:  slowDecodeQueue,
 		debugEnabled:     log.IsEnabledFor(logging.DEBUG),
 		prometheusWriter: prometheusWriter,
+		exporters:        exporters,
 		config:           config,
 		counter:          &Counter{},
 	}
@@ -190,6 +196,7 @@ func (d *Decoder) Run() {
 		n := d.inQueue.Gets(buffer)
 		for i := 0; i < n; i++ {
 			if buffer[i] == nil {
+				d.export(0, nil, nil)
 				continue
 			}
 			d.counter.InCount++
@@ -278,6 +285,7 @@ func (d *Decoder) sendPrometheus(vtapID uint16, ts *prompb.TimeSeries, extraLabe
 	if d.debugEnabled {
 		log.Debugf("decoder %d vtap %d recv promtheus timeseries: %v", d.index, vtapID, ts)
 	}
+	d.export(vtapID, ts, extraLabels)
 
 	epcId, podClusterId, err := d.samplesBuilder.GetEpcPodClusterId(d.orgId, vtapID)
 	if err != nil {
@@ -308,6 +316,23 @@ func (d *Decoder) sendPrometheus(vtapID uint16, ts *prompb.TimeSeries, extraLabe
 	d.counter.TimeSeriesOut++
 }
 
+// export the samples before they are converted to label ids, flush the exporters if ts is nil
+func (d *Decoder) export(vtapID uint16, ts *prompb.TimeSeries, extraLabels []prompb.Label) {
+	if !d.exporters.IsDataSourceExported(uint32(exporterconfig.PROMETHEUS)) {
+		return
+	}
+	if ts == nil {
+		d.exporters.Put(uint32(exporterconfig.PROMETHEUS), d.index, nil)
+		return
+	}
+	d.exportSamples = AcquireExportSamples(vtapID, d.orgId, d.teamId, ts, extraLabels, d.exportSamples[:0])
+	for _, s := range d.exportSamples {
+		d.exporters.Put(uint32(exporterconfig.PROMETHEUS), d.index, s)
+		// release the reference held by the decoder, the exporters hold their own references
+		s.Release()
+	}
+}
+
 func (b *PrometheusSamplesBuilder) GetEpcPodClusterId(orgId, vtapID uint16) (uint16, uint16, error) {
 	epcId, podClusterId := int32(0), uint16(0)
 	if vtapInfo := b.platformData.QueryVtapInfo(orgId, vtapID); vtapInfo != nil {
@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package decoder
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unsafe"
+
+	"github.com/prometheus/common/model"
+	promremote "github.com/prometheus/prometheus/prompb"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	exportercommon "github.com/deepflowio/deepflow/server/ingester/exporters/common"
+	exporterconfig "github.com/deepflowio/deepflow/server/ingester/exporters/config"
+	utag "github.com/deepflowio/deepflow/server/ingester/exporters/universal_tag"
+	"github.com/deepflowio/deepflow/server/libs/datatype/prompb"
+	"github.com/deepflowio/deepflow/server/libs/pool"
+	"github.com/deepflowio/deepflow/server/libs/utils"
+)
+
+// ExportSample is a single sample of a prometheus time series, labels are stored by name rather than by id
+type ExportSample struct {
+	pool.ReferenceCount
+
+	Time        uint32 `json:"time" category:"$tag" sub:"flow_info"` // s
+	TimestampMs int64
+	MetricName  string `json:"metric_name" category:"$tag" sub:"flow_info"`
+	AgentID     uint16 `json:"agent_id" category:"$tag" sub:"universal_tag"`
+	OrgId       uint16
+	TeamID      uint16 `json:"team_id" category:"$tag" sub:"universal_tag"`
+
+	LabelNames  []string `json:"label_names" category:"$tag" sub:"native_tag" data_type:"[]string"`
+	LabelValues []string `json:"label_values" category:"$tag" sub:"native_tag" data_type:"[]string"`
+
+	Value float64 `json:"value" category:"$metrics"`
+}
+
+var exportSamplePool = pool.NewLockFreePool(func() *ExportSample {
+	return &ExportSample{}
+})
+
+func AcquireExportSample() *ExportSample {
+	s := exportSamplePool.Get()
+	s.Reset()
+	return s
+}
+
+func ReleaseExportSample(s *ExportSample) {
+	if s == nil || s.SubReferenceCount() {
+		return
+	}
+	labelNames, labelValues := s.LabelNames[:0], s.LabelValues[:0]
+	*s = ExportSample{}
+	s.LabelNames, s.LabelValues = labelNames, labelValues
+	exportSamplePool.Put(s)
+}
+
+// AcquireExportSamples converts each sample of the time series to an ExportSample
+func AcquireExportSamples(agentID, orgId, teamID uint16, ts *prompb.TimeSeries, extraLabels []prompb.Label, samples []*ExportSample) []*ExportSample {
+	for i := range ts.Samples {
+		s := AcquireExportSample()
+		s.Time = uint32(model.Time(ts.Samples[i].Timestamp).Unix())
+		s.TimestampMs = ts.Samples[i].Timestamp
+		s.AgentID, s.OrgId, s.TeamID = agentID, orgId, teamID
+		s.Value = ts.Samples[i].Value
+		s.fillLabels(ts, extraLabels)
+		samples = append(samples, s)
+	}
+	return samples
+}
+
+// the labels of ts are from temporary memory, so they need to be cloned
+func (s *ExportSample) fillLabels(ts *prompb.TimeSeries, extraLabels []prompb.Label) {
+	for _, labels := range [][]prompb.Label{extraLabels, ts.Labels} {
+		for _, l := range labels {
+			if l.Name == model.MetricNameLabel {
+				s.MetricName = strings.Clone(l.Value)
+				continue
+			}
+			s.LabelNames = append(s.LabelNames, strings.Clone(l.Name))
+			s.LabelValues = append(s.LabelValues, strings.Clone(l.Value))
+		}
+	}
+}
+
+func (s *ExportSample) DataSource() uint32 {
+	return uint32(exporterconfig.PROMETHEUS)
+}
+
+func (s *ExportSample) TimestampUs() int64 {
+	return s.TimestampMs * 1000
+}
+
+func (s *ExportSample) OrgID() uint16 {
+	return s.OrgId
+}
+
+func (s *ExportSample) Release() {
+	ReleaseExportSample(s)
+}
+
+func (s *ExportSample) GetFieldValueByOffsetAndKind(offset uintptr, kind reflect.Kind, dataType utils.DataType) interface{} {
+	return utils.GetValueByOffsetAndKind(uintptr(unsafe.Pointer(s)), offset, kind, dataType)
+}
+
+// only the agent of the prometheus samples is known here
+func (s *ExportSample) QueryUniversalTags(utags *utag.UniversalTagsManager) *utag.UniversalTags {
+	return utags.QueryUniversalTags(s.OrgId,
+		0, 0, 0, 0, 0, 0, s.AgentID,
+		0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0,
+		true, 0, nil)
+}
+
+func (s *ExportSample) EncodeTo(protocol exporterconfig.ExportProtocol, utags *utag.UniversalTagsManager, cfg *exporterconfig.ExporterCfg) (interface{}, error) {
+	tags := s.QueryUniversalTags(utags)
+	switch protocol {
+	case exporterconfig.PROTOCOL_OTLP:
+		return s.EncodeToOtlp(tags, cfg.ExportFieldCategoryBits), nil
+	case exporterconfig.PROTOCOL_PROMETHEUS:
+		return s.EncodeToPrometheus(tags, cfg.ExportFieldCategoryBits), nil
+	case exporterconfig.PROTOCOL_KAFKA:
+		if tags == nil {
+			tags = &utag.UniversalTags{}
+		}
+		return exportercommon.EncodeToKafka(s, int(s.DataSource()), cfg, tags, tags, nil, nil), nil
+	default:
+		return nil, fmt.Errorf("prometheus sample unsupport export to %s", protocol)
+	}
+}
+
+func (s *ExportSample) EncodeToOtlp(tags *utag.UniversalTags, dataTypeBits uint64) interface{} {
+	metricSlice := pmetric.NewResourceMetricsSlice()
+	resMetric := metricSlice.AppendEmpty()
+	exportercommon.PutUniversalTags(resMetric.Resource().Attributes(), tags, dataTypeBits)
+
+	metric := resMetric.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	metric.SetName(s.MetricName)
+	dp := metric.SetEmptyGauge().DataPoints().AppendEmpty()
+	dp.SetTimestamp(pcommon.Timestamp(s.TimestampMs * 1000000)) // ms -> ns
+	dp.SetDoubleValue(s.Value)
+	exportercommon.PutAttributes(dp.Attributes(), s.LabelNames, s.LabelValues, dataTypeBits)
+	return metricSlice
+}
+
+func (s *ExportSample) EncodeToPrometheus(tags *utag.UniversalTags, dataTypeBits uint64) interface{} {
+	labels := make([]promremote.Label, 0, len(s.LabelNames)+2)
+	labels = append(labels, promremote.Label{Name: model.MetricNameLabel, Value: s.MetricName})
+	if dataTypeBits&exporterconfig.NATIVE_TAG != 0 {
+		for i := range s.LabelNames {
+			labels = append(labels, promremote.Label{Name: s.LabelNames[i], Value: s.LabelValues[i]})
+		}
+	}
+	if dataTypeBits&exporterconfig.UNIVERSAL_TAG != 0 {
+		exportercommon.RangeUniversalTags(tags, func(name, value string) {
+			labels = append(labels, promremote.Label{Name: name, Value: value})
+		})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	return []promremote.TimeSeries{{
+		Labels:  labels,
+		Samples: []promremote.Sample{{Value: s.Value, Timestamp: s.TimestampMs}},
+	}}
+}
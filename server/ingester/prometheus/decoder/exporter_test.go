@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package decoder
+
+import (
+	"encoding/json"
+	"testing"
+
+	promremote "github.com/prometheus/prometheus/prompb"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	exporterconfig "github.com/deepflowio/deepflow/server/ingester/exporters/config"
+	exporterstest "github.com/deepflowio/deepflow/server/ingester/exporters/test"
+	utag "github.com/deepflowio/deepflow/server/ingester/exporters/universal_tag"
+	"github.com/deepflowio/deepflow/server/libs/datatype/prompb"
+)
+
+func testExportSamples(t *testing.T) []*ExportSample {
+	ts := &prompb.TimeSeries{
+		Labels: []prompb.Label{
+			{Name: "__name__", Value: "http_requests_total"},
+			{Name: "method", Value: "GET"},
+			{Name: "code", Value: "200"},
+		},
+		Samples: []prompb.Sample{
+			{Value: 10, Timestamp: 1700000000123},
+			{Value: 12, Timestamp: 1700000015123},
+		},
+	}
+	extraLabels := []prompb.Label{{Name: "job", Value: "api"}}
+	samples := AcquireExportSamples(1, 2, 3, ts, extraLabels, nil)
+
+	// labels 是临时内存，需要拷贝
+	ts.Labels[1].Value = "POST"
+	if len(samples) != 2 || samples[0].MetricName != "http_requests_total" || samples[0].LabelValues[1] != "GET" {
+		t.Fatalf("unexpected samples %+v", samples)
+	}
+	if samples[1].Time != 1700000015 || samples[1].TimestampUs() != 1700000015123000 {
+		t.Fatalf("unexpected sample time %d %d", samples[1].Time, samples[1].TimestampUs())
+	}
+	return samples
+}
+
+func testUniversalTags() *utag.UniversalTags {
+	tags := &utag.UniversalTags{}
+	tags[utag.Vtap] = "agent-1"
+	return tags
+}
+
+func TestExportSampleEncodeToOtlp(t *testing.T) {
+	samples := testExportSamples(t)
+	metrics := pmetric.NewMetrics()
+	for _, s := range samples {
+		s.EncodeToOtlp(testUniversalTags(), exporterconfig.UNIVERSAL_TAG|exporterconfig.NATIVE_TAG).(pmetric.ResourceMetricsSlice).MoveAndAppendTo(metrics.ResourceMetrics())
+	}
+	got, err := (&pmetric.JSONMarshaler{}).MarshalMetrics(metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporterstest.CheckJSONFixture(t, "testfiles/prometheus_otlp.json", got)
+}
+
+func TestExportSampleEncodeToPrometheus(t *testing.T) {
+	samples := testExportSamples(t)
+	var series []promremote.TimeSeries
+	for _, s := range samples {
+		series = append(series, s.EncodeToPrometheus(testUniversalTags(), exporterconfig.UNIVERSAL_TAG|exporterconfig.NATIVE_TAG).([]promremote.TimeSeries)...)
+	}
+	got, err := json.Marshal(series)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporterstest.CheckJSONFixture(t, "testfiles/prometheus_series.json", got)
+
+	for _, s := range samples {
+		ReleaseExportSample(s)
+	}
+	s := AcquireExportSample()
+	if s.MetricName != "" || len(s.LabelNames) != 0 || len(s.LabelValues) != 0 {
+		t.Errorf("released sample is not reset: %+v", s)
+	}
+}
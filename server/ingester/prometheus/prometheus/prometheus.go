@@ -24,6 +24,7 @@ import (
 	_ "google.golang.org/grpc"
 
 	dropletqueue "github.com/deepflowio/deepflow/server/ingester/droplet/queue"
+	"github.com/deepflowio/deepflow/server/ingester/exporters"
 	"github.com/deepflowio/deepflow/server/ingester/ingesterctl"
 	"github.com/deepflowio/deepflow/server/ingester/prometheus/config"
 	"github.com/deepflowio/deepflow/server/ingester/prometheus/dbwriter"
@@ -46,7 +47,7 @@ type PrometheusHandler struct {
 	prometheusLabelTable *decoder.PrometheusLabelTable
 }
 
-func NewPrometheusHandler(config *config.Config, recv *receiver.Receiver, platformDataManager *grpc.PlatformDataManager) (*PrometheusHandler, error) {
+func NewPrometheusHandler(config *config.Config, recv *receiver.Receiver, platformDataManager *grpc.PlatformDataManager, exporters *exporters.Exporters) (*PrometheusHandler, error) {
 	manager := dropletqueue.NewManager(ingesterctl.INGESTERCTL_PROMETHEUS_QUEUE)
 	queueCount := config.DecoderQueueCount
 	msgType := datatype.MESSAGE_TYPE_PROMETHEUS
@@ -100,6 +101,7 @@ func NewPrometheusHandler(config *config.Config, recv *receiver.Receiver, platfo
 			queue.QueueReader(decodeQueues.FixedMultiQueue[i]),
 			queue.QueueWriter(slowDecodeQueues.FixedMultiQueue[i]),
 			metricsWriter,
+			exporters,
 			config,
 		)
 		slowMetricsWriter, err := dbwriter.NewPrometheusWriter(i, initAppLabelColumnCount, "slow-prometheus", dbwriter.PROMETHEUS_DB, config)
@@ -0,0 +1,259 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/deepflowio/deepflow/server/libs/logger"
+)
+
+var log = logger.MustGetLogger("auth")
+
+const (
+	HEADER_KEY_AUTHORIZATION = "Authorization"
+	HEADER_KEY_X_ORG_ID      = "X-Org-Id"
+	HEADER_KEY_X_USER_ID     = "X-User-Id"
+	HEADER_KEY_X_USER_TYPE   = "X-User-Type"
+	BEARER_PREFIX            = "Bearer "
+
+	// 认证失败及权限不足时的 OPT_STATUS，与 controller 和 querier 的响应格式一致
+	STATUS_UNAUTHORIZED        = "UNAUTHORIZED"
+	STATUS_NO_PERMISSIONS      = "NO_PERMISSIONS"
+	STATUS_SERVICE_UNAVAILABLE = "SERVICE_UNAVAILABLE"
+
+	GIN_CONTEXT_KEY_IDENTITY = "auth_identity"
+)
+
+var (
+	initOnce      sync.Once
+	globalConfig  Config
+	internalToken string
+	verifier      *oidcVerifier
+)
+
+// Init 在进程启动时调用一次，controller、querier 和 mcp 共用同一份认证配置，调用前需通过 Config.Validate 校验
+func Init(cfg Config) {
+	initOnce.Do(func() {
+		globalConfig = cfg
+		if !cfg.Enabled {
+			return
+		}
+		internalToken = cfg.InternalToken
+		if cfg.OIDC.Enabled {
+			verifier = newOIDCVerifier(cfg.OIDC)
+		}
+		log.Infof("auth enabled, oidc enabled: %t", cfg.OIDC.Enabled)
+	})
+}
+
+func Enabled() bool {
+	return globalConfig.Enabled
+}
+
+func GetConfig() Config {
+	return globalConfig
+}
+
+// SetInternalAuthorization 为组件间调用的请求设置内部 token，请求中已有 Authorization 时不做修改
+// 内部 token 拥有 super admin 权限，只能在调用 controller、querier 等 deepflow-server 组件时使用，
+// 不能用于 webhook、用户配置的外部地址等请求
+func SetInternalAuthorization(req *http.Request) {
+	if !Enabled() || req.Header.Get(HEADER_KEY_AUTHORIZATION) != "" {
+		return
+	}
+	req.Header.Set(HEADER_KEY_AUTHORIZATION, BEARER_PREFIX+internalToken)
+}
+
+type authError struct {
+	httpCode int
+	status   string
+	message  string
+}
+
+func (e *authError) Error() string {
+	return e.message
+}
+
+func newAuthError(httpCode int, status, format string, a ...interface{}) *authError {
+	return &authError{httpCode: httpCode, status: status, message: fmt.Sprintf(format, a...)}
+}
+
+// Authenticator 校验请求携带的 Bearer token 并按路由规则鉴权
+type Authenticator struct {
+	store       TokenStore
+	rules       []RouteRule
+	publicPaths []string
+}
+
+// NewAuthenticator store 用于校验静态 token，rules 为各路由分组要求的角色，publicPaths 中的路径无需认证
+func NewAuthenticator(store TokenStore, rules []RouteRule, publicPaths ...string) *Authenticator {
+	return &Authenticator{
+		store:       NewCachedTokenStore(store, globalConfig.TokenCacheTTL),
+		rules:       rules,
+		publicPaths: publicPaths,
+	}
+}
+
+func bearerToken(req *http.Request) string {
+	return parseBearer(req.Header.Get(HEADER_KEY_AUTHORIZATION))
+}
+
+func parseBearer(header string) string {
+	if len(header) < len(BEARER_PREFIX) || !strings.EqualFold(header[:len(BEARER_PREFIX)], BEARER_PREFIX) {
+		return ""
+	}
+	return strings.TrimSpace(header[len(BEARER_PREFIX):])
+}
+
+// Authenticate 返回请求对应的身份，内部 token 的 Method 为 internal，鉴权时沿用请求头中的身份
+func (a *Authenticator) Authenticate(req *http.Request) (*Identity, error) {
+	return a.authenticateToken(bearerToken(req))
+}
+
+func (a *Authenticator) authenticateToken(token string) (*Identity, error) {
+	if token == "" {
+		return nil, newAuthError(http.StatusUnauthorized, STATUS_UNAUTHORIZED, "missing bearer token")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(internalToken)) == 1 {
+		return &Identity{Role: ROLE_SUPER_ADMIN, Method: AUTH_METHOD_INTERNAL}, nil
+	}
+	if isJWT(token) {
+		if verifier == nil {
+			return nil, newAuthError(http.StatusUnauthorized, STATUS_UNAUTHORIZED, "oidc is not enabled")
+		}
+		identity, err := verifier.Verify(token)
+		if err != nil {
+			return nil, newAuthError(http.StatusUnauthorized, STATUS_UNAUTHORIZED, "invalid jwt: %s", err)
+		}
+		return identity, nil
+	}
+	if !IsAPIToken(token) {
+		return nil, newAuthError(http.StatusUnauthorized, STATUS_UNAUTHORIZED, "%s", ErrInvalidToken)
+	}
+	identity, err := a.store.LookupToken(token)
+	if errors.Is(err, ErrInvalidToken) {
+		return nil, newAuthError(http.StatusUnauthorized, STATUS_UNAUTHORIZED, "%s", err)
+	} else if err != nil {
+		log.Errorf("lookup api token %s failed: %s", DisplayToken(token), err)
+		return nil, newAuthError(http.StatusServiceUnavailable, STATUS_SERVICE_UNAVAILABLE, "verify token failed")
+	}
+	return identity, nil
+}
+
+func (a *Authenticator) isPublic(path string) bool {
+	for _, p := range a.publicPaths {
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize 认证并鉴权，成功后用认证得到的身份覆盖请求头中的 X-Org-Id/X-User-Id/X-User-Type，
+// 下游仍按原有方式读取请求头，客户端无法再通过伪造请求头提升权限
+func (a *Authenticator) authorize(req *http.Request) (*Identity, error) {
+	identity, err := a.Authenticate(req)
+	if err != nil {
+		return nil, err
+	}
+	if identity.Method == AUTH_METHOD_INTERNAL {
+		return identity, nil
+	}
+	required := RequiredRole(a.rules, req.Method, req.URL.Path)
+	if !identity.Role.Covers(required) {
+		return nil, newAuthError(http.StatusForbidden, STATUS_NO_PERMISSIONS, "role %s is required, current role is %s", required, identity.Role)
+	}
+	// super_admin 可以通过 X-Org-Id 访问其他组织
+	if identity.Role != ROLE_SUPER_ADMIN || req.Header.Get(HEADER_KEY_X_ORG_ID) == "" {
+		req.Header.Set(HEADER_KEY_X_ORG_ID, strconv.Itoa(identity.ORGID))
+	}
+	req.Header.Set(HEADER_KEY_X_USER_ID, strconv.Itoa(identity.UserID))
+	req.Header.Set(HEADER_KEY_X_USER_TYPE, strconv.Itoa(identity.Role.UserType()))
+	return identity, nil
+}
+
+// GinMiddleware 需在读取 X-Org-Id 等请求头的中间件之前注册
+func (a *Authenticator) GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !Enabled() || a.isPublic(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		identity, err := a.authorize(c.Request)
+		if err != nil {
+			e := err.(*authError)
+			c.AbortWithStatusJSON(e.httpCode, gin.H{"OPT_STATUS": e.status, "DESCRIPTION": e.message})
+			return
+		}
+		c.Set(GIN_CONTEXT_KEY_IDENTITY, identity)
+		c.Next()
+	}
+}
+
+// HTTPMiddleware 用于非 gin 的 http 服务，如 mcp server
+func (a *Authenticator) HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Enabled() || a.isPublic(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		identity, err := a.authorize(r)
+		if err != nil {
+			e := err.(*authError)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(e.httpCode)
+			json.NewEncoder(w).Encode(map[string]string{"OPT_STATUS": e.status, "DESCRIPTION": e.message})
+			return
+		}
+		log.Debugf("%s %s authorized as %s (%s)", r.Method, r.URL.Path, identity.Subject, identity.Role)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GetIdentity 返回 GinMiddleware 认证得到的身份，未开启认证时返回 nil
+func GetIdentity(c *gin.Context) *Identity {
+	if v, ok := c.Get(GIN_CONTEXT_KEY_IDENTITY); ok {
+		return v.(*Identity)
+	}
+	return nil
+}
+
+type authorizationKey struct{}
+
+// WithAuthorization 保存请求的 Authorization，用于调用下游服务时透传调用方身份
+func WithAuthorization(ctx context.Context, r *http.Request) context.Context {
+	if header := r.Header.Get(HEADER_KEY_AUTHORIZATION); header != "" {
+		return context.WithValue(ctx, authorizationKey{}, header)
+	}
+	return ctx
+}
+
+func AuthorizationFromContext(ctx context.Context) string {
+	header, _ := ctx.Value(authorizationKey{}).(string)
+	return header
+}
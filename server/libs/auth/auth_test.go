@@ -0,0 +1,427 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const testIssuer = "https://idp.example.com"
+
+func signJWT(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	h := signingHashes[alg].New()
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, signingHashes[alg], digest); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func encodeBigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func newTestVerifier(t *testing.T) (*oidcVerifier, *rsa.PrivateKey, *ecdsa.PrivateKey) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := map[string]interface{}{
+		"keys": []jwk{
+			{Kty: "RSA", Kid: "rsa", Use: "sig", N: encodeBigInt(rsaKey.N), E: encodeBigInt(big.NewInt(int64(rsaKey.E)))},
+			{Kty: "EC", Kid: "ec", Crv: "P-256", X: encodeBigInt(ecKey.X), Y: encodeBigInt(ecKey.Y)},
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := DefaultConfig().OIDC
+	cfg.Enabled = true
+	cfg.Issuer = testIssuer
+	cfg.JWKSURL = server.URL
+	cfg.Audience = "deepflow"
+	cfg.RoleMapping = map[string]string{"deepflow-admins": string(ROLE_ADMIN)}
+	return newOIDCVerifier(cfg), rsaKey, ecKey
+}
+
+func TestOIDCVerify(t *testing.T) {
+	v, rsaKey, ecKey := newTestVerifier(t)
+	now := time.Now().Unix()
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss": testIssuer, "aud": []string{"deepflow"}, "sub": "alice",
+			"exp": now + 300, "org_id": "3", "user_id": 12, "role": []string{"viewer", "deepflow-admins"},
+		}
+	}
+
+	identity, err := v.Verify(signJWT(t, "RS256", "rsa", rsaKey, validClaims()))
+	if err != nil {
+		t.Fatalf("verify RS256 jwt failed: %s", err)
+	}
+	expected := Identity{ORGID: 3, UserID: 12, Role: ROLE_ADMIN, Subject: "alice", Method: AUTH_METHOD_OIDC}
+	if *identity != expected {
+		t.Errorf("unexpected identity %+v, expected %+v", *identity, expected)
+	}
+	if _, err := v.Verify(signJWT(t, "ES256", "ec", ecKey, validClaims())); err != nil {
+		t.Errorf("verify ES256 jwt failed: %s", err)
+	}
+
+	invalid := map[string]func(map[string]interface{}){
+		"expired":        func(c map[string]interface{}) { c["exp"] = now - 3600 },
+		"wrong issuer":   func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" },
+		"wrong audience": func(c map[string]interface{}) { c["aud"] = "other" },
+		"no exp":         func(c map[string]interface{}) { delete(c, "exp") },
+	}
+	for name, modify := range invalid {
+		claims := validClaims()
+		modify(claims)
+		if _, err := v.Verify(signJWT(t, "RS256", "rsa", rsaKey, claims)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	// 配置 role-mapping 后不接受映射之外的角色，default-role 为空时拒绝访问
+	claims := validClaims()
+	claims["role"] = "admin"
+	if _, err := v.Verify(signJWT(t, "RS256", "rsa", rsaKey, claims)); err == nil {
+		t.Error("unmapped role: expected error")
+	}
+
+	// 使用 RSA key 签名但声明为 EC 的 kid
+	if _, err := v.Verify(signJWT(t, "RS256", "ec", rsaKey, validClaims())); err == nil {
+		t.Error("mismatched key type: expected error")
+	}
+	token := signJWT(t, "RS256", "rsa", rsaKey, validClaims())
+	if _, err := v.Verify(token[:len(token)-4] + "AAAA"); err == nil {
+		t.Error("tampered signature: expected error")
+	}
+}
+
+func TestOIDCKeyRefresh(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches, failed int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		if atomic.LoadInt32(&failed) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []jwk{{Kty: "RSA", Kid: "rsa", N: encodeBigInt(rsaKey.N), E: encodeBigInt(big.NewInt(int64(rsaKey.E)))}},
+		})
+	}))
+	defer server.Close()
+	cfg := DefaultConfig().OIDC
+	cfg.JWKSURL = server.URL
+	v := newOIDCVerifier(cfg)
+
+	if _, err := v.getKey("rsa"); err != nil || atomic.LoadInt32(&fetches) != 1 {
+		t.Fatalf("get key failed: %v, fetches %d", err, fetches)
+	}
+
+	// key 过期后 IdP 不可用，只拉取一次，期间继续使用已有的 key
+	atomic.StoreInt32(&failed, 1)
+	v.mutex.Lock()
+	v.fetchedAt = v.fetchedAt.Add(-time.Duration(cfg.JWKSRefreshInterval+1) * time.Second)
+	v.attemptedAt = v.fetchedAt
+	v.mutex.Unlock()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := v.getKey("rsa"); err != nil {
+				t.Errorf("expired key should be used when refresh failed: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("expected 2 fetches, got %d", n)
+	}
+
+	// 拉取失败后在最小间隔内不再重试
+	if _, err := v.getKey("unknown"); err == nil {
+		t.Error("unknown kid: expected error")
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("failed fetch should not be retried within the min interval, fetches %d", n)
+	}
+}
+
+func TestRequiredRole(t *testing.T) {
+	rules := []RouteRule{
+		{PathPrefix: "/v1/controllers/", ReadRole: ROLE_ADMIN, WriteRole: ROLE_ADMIN},
+		{PathPrefix: "/v1/org/", ReadRole: ROLE_ADMIN, WriteRole: ROLE_SUPER_ADMIN},
+	}
+	cases := []struct {
+		method, path string
+		expected     Role
+	}{
+		{http.MethodGet, "/v1/vtaps/", ROLE_VIEWER},
+		{http.MethodPatch, "/v1/vtaps/1/", ROLE_EDITOR},
+		{http.MethodGet, "/v1/controllers/", ROLE_ADMIN},
+		{http.MethodDelete, "/v1/org/2/", ROLE_SUPER_ADMIN},
+		{http.MethodGet, "/v1/orgs/", ROLE_VIEWER},
+	}
+	for _, c := range cases {
+		if role := RequiredRole(rules, c.method, c.path); role != c.expected {
+			t.Errorf("%s %s: expected %s, got %s", c.method, c.path, c.expected, role)
+		}
+	}
+}
+
+type mapTokenStore map[string]*Identity
+
+func (s mapTokenStore) LookupToken(token string) (*Identity, error) {
+	if identity, ok := s[token]; ok {
+		return identity, nil
+	}
+	return nil, ErrInvalidToken
+}
+
+type countingTokenStore struct {
+	mapTokenStore
+	lookups int
+}
+
+func (s *countingTokenStore) LookupToken(token string) (*Identity, error) {
+	s.lookups++
+	return s.mapTokenStore.LookupToken(token)
+}
+
+func TestCachedTokenStore(t *testing.T) {
+	validToken, _ := GenerateToken()
+	store := &countingTokenStore{mapTokenStore: mapTokenStore{validToken: {ORGID: 2, Role: ROLE_VIEWER}}}
+	s := newCachedTokenStore(store, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.LookupToken(validToken); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if store.lookups != 1 {
+		t.Errorf("valid token should be cached, lookups %d", store.lookups)
+	}
+
+	// 无效 token 的缓存容量有限，不影响有效 token 的缓存
+	for i := 0; i < INVALID_TOKEN_CACHE_SIZE*2; i++ {
+		if _, err := s.LookupToken(fmt.Sprintf("dfk_random_%d", i)); err != ErrInvalidToken {
+			t.Fatalf("expected invalid token, got %v", err)
+		}
+	}
+	if s.invalid.Len() != INVALID_TOKEN_CACHE_SIZE || s.valid.Len() != 1 {
+		t.Errorf("unexpected cache size, invalid %d valid %d", s.invalid.Len(), s.valid.Len())
+	}
+
+	s.sweep(time.Now().Add(time.Minute))
+	if s.invalid.Len() != 0 || s.valid.Len() != 0 {
+		t.Errorf("expired entries should be swept, invalid %d valid %d", s.invalid.Len(), s.valid.Len())
+	}
+}
+
+func TestGinMiddleware(t *testing.T) {
+	globalConfig = Config{Enabled: true}
+	internalToken = "dfk_internal"
+	defer func() { globalConfig, internalToken = Config{}, "" }()
+
+	viewerToken, _ := GenerateToken()
+	store := mapTokenStore{viewerToken: {ORGID: 2, UserID: 5, Role: ROLE_VIEWER, Method: AUTH_METHOD_TOKEN}}
+	a := NewAuthenticator(store, nil, "/v1/health/")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(a.GinMiddleware())
+	echo := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"org":  c.Request.Header.Get(HEADER_KEY_X_ORG_ID),
+			"type": c.Request.Header.Get(HEADER_KEY_X_USER_TYPE),
+		})
+	}
+	r.GET("/v1/health/", echo)
+	r.GET("/v1/vtaps/", echo)
+	r.POST("/v1/vtaps/", echo)
+
+	cases := []struct {
+		name, method, path, token string
+		expectedCode              int
+		expectedBody              string
+	}{
+		{"public", http.MethodGet, "/v1/health/", "", http.StatusOK, ""},
+		{"missing token", http.MethodGet, "/v1/vtaps/", "", http.StatusUnauthorized, ""},
+		{"unknown token", http.MethodGet, "/v1/vtaps/", "dfk_unknown", http.StatusUnauthorized, ""},
+		{"viewer read", http.MethodGet, "/v1/vtaps/", viewerToken, http.StatusOK, `{"org":"2","type":"3"}`},
+		{"viewer write", http.MethodPost, "/v1/vtaps/", viewerToken, http.StatusForbidden, ""},
+		{"internal", http.MethodPost, "/v1/vtaps/", "dfk_internal", http.StatusOK, `{"org":"7","type":"1"}`},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		// 伪造的请求头需被认证得到的身份覆盖，内部调用则沿用请求头
+		req.Header.Set(HEADER_KEY_X_ORG_ID, "7")
+		req.Header.Set(HEADER_KEY_X_USER_TYPE, "1")
+		if c.token != "" {
+			req.Header.Set(HEADER_KEY_AUTHORIZATION, BEARER_PREFIX+c.token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != c.expectedCode {
+			t.Errorf("%s: expected code %d, got %d, body %s", c.name, c.expectedCode, w.Code, w.Body.String())
+		}
+		if c.expectedBody != "" && w.Body.String() != c.expectedBody {
+			t.Errorf("%s: expected body %s, got %s", c.name, c.expectedBody, w.Body.String())
+		}
+	}
+}
+
+func TestGRPCUnaryInterceptor(t *testing.T) {
+	globalConfig = Config{Enabled: true}
+	internalToken = "dfk_internal"
+	defer func() { globalConfig, internalToken = Config{}, "" }()
+
+	viewerToken, _ := GenerateToken()
+	store := mapTokenStore{viewerToken: {ORGID: 2, UserID: 5, Role: ROLE_VIEWER, Method: AUTH_METHOD_TOKEN}}
+	interceptor := NewAuthenticator(store, nil).GRPCUnaryInterceptor()
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return GRPCOrgID(ctx), nil
+	}
+
+	cases := []struct {
+		name, token  string
+		expectedCode codes.Code
+		expectedOrg  string
+	}{
+		{"missing token", "", codes.Unauthenticated, ""},
+		{"viewer", viewerToken, codes.OK, "2"},
+		{"internal", "dfk_internal", codes.OK, "7"},
+	}
+	for _, c := range cases {
+		// 伪造的 x-org-id 需被认证得到的组织覆盖，内部调用则沿用 metadata
+		md := metadata.Pairs(strings.ToLower(HEADER_KEY_X_ORG_ID), "7")
+		if c.token != "" {
+			md.Set(strings.ToLower(HEADER_KEY_AUTHORIZATION), BEARER_PREFIX+c.token)
+		}
+		org, err := interceptor(metadata.NewIncomingContext(context.Background(), md), nil, &grpc.UnaryServerInfo{}, handler)
+		if status.Code(err) != c.expectedCode {
+			t.Errorf("%s: expected code %s, got %v", c.name, c.expectedCode, err)
+		}
+		if err == nil && org != c.expectedOrg {
+			t.Errorf("%s: expected org %s, got %v", c.name, c.expectedOrg, org)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := DefaultConfig()
+	valid.Enabled = true
+	valid.InternalToken = "dfk_internal"
+	valid.OIDC.Enabled = true
+	valid.OIDC.Issuer = testIssuer
+	valid.OIDC.Audience = "deepflow"
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("validate config failed: %s", err)
+	}
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Errorf("validate disabled config failed: %s", err)
+	}
+
+	invalid := map[string]func(*Config){
+		"no internal token":    func(c *Config) { c.InternalToken = "" },
+		"no audience":          func(c *Config) { c.OIDC.Audience = "" },
+		"no issuer":            func(c *Config) { c.OIDC.Issuer = "" },
+		"invalid mapping role": func(c *Config) { c.OIDC.RoleMapping = map[string]string{"admins": "root"} },
+		"invalid default role": func(c *Config) { c.OIDC.DefaultRole = "root" },
+	}
+	for name, modify := range invalid {
+		cfg := valid
+		modify(&cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestSetInternalAuthorization(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://127.0.0.1:20417/v1/orgs/", nil)
+	SetInternalAuthorization(req)
+	if header := req.Header.Get(HEADER_KEY_AUTHORIZATION); header != "" {
+		t.Errorf("auth disabled: unexpected authorization %s", header)
+	}
+
+	globalConfig = Config{Enabled: true}
+	internalToken = "dfk_internal"
+	defer func() { globalConfig, internalToken = Config{}, "" }()
+	SetInternalAuthorization(req)
+	if header := req.Header.Get(HEADER_KEY_AUTHORIZATION); header != BEARER_PREFIX+"dfk_internal" {
+		t.Errorf("unexpected authorization %s", header)
+	}
+	// 已携带用户的 token 时不替换
+	req.Header.Set(HEADER_KEY_AUTHORIZATION, BEARER_PREFIX+"dfk_user")
+	SetInternalAuthorization(req)
+	if header := req.Header.Get(HEADER_KEY_AUTHORIZATION); header != BEARER_PREFIX+"dfk_user" {
+		t.Errorf("unexpected authorization %s", header)
+	}
+}
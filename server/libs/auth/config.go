@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	DEFAULT_TOKEN_CACHE_TTL       = 60
+	DEFAULT_JWKS_REFRESH_INTERVAL = 3600
+)
+
+// Config 对应 server.yaml 中的 auth 配置，controller、querier 和 mcp 共用
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// 组件间调用（如 controller 之间、querier 调用 controller）使用的内部 token，
+	// 开启认证时必须配置，多个 deepflow-server 之间需配置为相同的值
+	InternalToken string     `yaml:"internal-token"`
+	TokenCacheTTL int        `yaml:"token-cache-ttl"` // 单位：秒，静态 token 校验结果的缓存时间
+	OIDC          OIDCConfig `yaml:"oidc"`
+}
+
+type OIDCConfig struct {
+	Enabled             bool              `yaml:"enabled"`
+	Issuer              string            `yaml:"issuer"`
+	JWKSURL             string            `yaml:"jwks-url"` // 为空时通过 issuer 的 /.well-known/openid-configuration 获取
+	Audience            string            `yaml:"audience"` // 开启 oidc 时必须配置
+	OrgClaim            string            `yaml:"org-claim"`
+	RoleClaim           string            `yaml:"role-claim"`
+	UserIDClaim         string            `yaml:"user-id-claim"`
+	RoleMapping         map[string]string `yaml:"role-mapping"` // IdP 中的角色或分组名称到 deepflow 角色的映射，配置后只接受映射中的角色
+	DefaultRole         string            `yaml:"default-role"` // token 中没有可识别角色时使用，默认为空即拒绝访问
+	JWKSRefreshInterval int               `yaml:"jwks-refresh-interval"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enabled:       false,
+		TokenCacheTTL: DEFAULT_TOKEN_CACHE_TTL,
+		OIDC: OIDCConfig{
+			OrgClaim:            "org_id",
+			RoleClaim:           "role",
+			UserIDClaim:         "user_id",
+			JWKSRefreshInterval: DEFAULT_JWKS_REFRESH_INTERVAL,
+		},
+	}
+}
+
+// Validate 在进程启动时校验认证配置，校验失败时 deepflow-server 不能启动
+func (c Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.InternalToken == "" {
+		return errors.New("auth internal-token is required when auth is enabled")
+	}
+	if !c.OIDC.Enabled {
+		return nil
+	}
+	if c.OIDC.Issuer == "" {
+		return errors.New("auth oidc issuer is required when oidc is enabled")
+	}
+	if c.OIDC.Audience == "" {
+		return errors.New("auth oidc audience is required when oidc is enabled")
+	}
+	for name, role := range c.OIDC.RoleMapping {
+		if !Role(role).Valid() {
+			return fmt.Errorf("auth oidc role-mapping %s has invalid role %s", name, role)
+		}
+	}
+	if c.OIDC.DefaultRole != "" && !Role(c.OIDC.DefaultRole).Valid() {
+		return fmt.Errorf("auth oidc default-role %s is invalid", c.OIDC.DefaultRole)
+	}
+	return nil
+}
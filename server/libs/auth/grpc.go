@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type identityKey struct{}
+
+// withIdentity 保存 gRPC 请求认证得到的身份，其中的 ORGID 为请求实际访问的组织
+func withIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext 返回 gRPC 拦截器认证得到的身份，未开启认证时返回 nil
+func IdentityFromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityKey{}).(*Identity)
+	return identity
+}
+
+func metadataValue(md metadata.MD, key string) string {
+	if values := md.Get(strings.ToLower(key)); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// GRPCOrgID 返回 gRPC 请求访问的组织，开启认证时使用认证得到的组织，未开启认证时使用 metadata 中的 x-org-id，
+// 返回空字符串时访问默认组织
+func GRPCOrgID(ctx context.Context) string {
+	if identity := IdentityFromContext(ctx); identity != nil {
+		if identity.ORGID > 0 {
+			return strconv.Itoa(identity.ORGID)
+		}
+		return ""
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return metadataValue(md, HEADER_KEY_X_ORG_ID)
+}
+
+// authorizeGRPC 校验 metadata 中的 authorization，gRPC 接口均为只读接口，需要 viewer 角色，
+// 成功后返回保存了调用方身份的 context
+func (a *Authenticator) authorizeGRPC(ctx context.Context) (context.Context, error) {
+	if !Enabled() {
+		return ctx, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	identity, err := a.authenticateToken(parseBearer(metadataValue(md, HEADER_KEY_AUTHORIZATION)))
+	if err != nil {
+		e := err.(*authError)
+		if e.httpCode == http.StatusServiceUnavailable {
+			return nil, status.Error(codes.Unavailable, e.message)
+		}
+		return nil, status.Error(codes.Unauthenticated, e.message)
+	}
+	if !identity.Role.Covers(ROLE_VIEWER) {
+		return nil, status.Errorf(codes.PermissionDenied, "role %s is required", ROLE_VIEWER)
+	}
+	// 与 HTTP 接口一致，super_admin 和内部调用可以通过 x-org-id 访问其他组织
+	caller := *identity
+	if caller.Role == ROLE_SUPER_ADMIN {
+		if orgID, err := strconv.Atoi(metadataValue(md, HEADER_KEY_X_ORG_ID)); err == nil && orgID > 0 {
+			caller.ORGID = orgID
+		}
+	}
+	return withIdentity(ctx, &caller), nil
+}
+
+func (a *Authenticator) GRPCUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := a.authorizeGRPC(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// identityServerStream 将认证得到的身份传递给 stream 接口
+type identityServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identityServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (a *Authenticator) GRPCStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authorizeGRPC(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &identityServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
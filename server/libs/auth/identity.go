@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"net/http"
+	"strings"
+)
+
+type Role string
+
+const (
+	ROLE_VIEWER      Role = "viewer"
+	ROLE_EDITOR      Role = "editor"
+	ROLE_ADMIN       Role = "admin"
+	ROLE_SUPER_ADMIN Role = "super_admin"
+)
+
+var roleLevels = map[Role]int{
+	ROLE_VIEWER:      1,
+	ROLE_EDITOR:      2,
+	ROLE_ADMIN:       3,
+	ROLE_SUPER_ADMIN: 4,
+}
+
+// 与 controller 中 X-User-Type 的取值保持一致
+const (
+	USER_TYPE_SUPER_ADMIN = 1
+	USER_TYPE_ADMIN       = 2
+	USER_TYPE_USER        = 3
+
+	USER_ID_SUPER_ADMIN = 1
+	DEFAULT_ORG_ID      = 1
+)
+
+func (r Role) Valid() bool {
+	_, ok := roleLevels[r]
+	return ok
+}
+
+// Covers 判断 r 是否拥有 required 角色的全部权限
+func (r Role) Covers(required Role) bool {
+	return roleLevels[r] >= roleLevels[required]
+}
+
+func (r Role) UserType() int {
+	switch r {
+	case ROLE_SUPER_ADMIN:
+		return USER_TYPE_SUPER_ADMIN
+	case ROLE_ADMIN:
+		return USER_TYPE_ADMIN
+	default:
+		return USER_TYPE_USER
+	}
+}
+
+// RoleFromUserType 用于未开启认证时，将请求头中的 X-User-Type 转换为角色
+func RoleFromUserType(userType int) Role {
+	switch userType {
+	case USER_TYPE_SUPER_ADMIN:
+		return ROLE_SUPER_ADMIN
+	case USER_TYPE_ADMIN:
+		return ROLE_ADMIN
+	default:
+		return ROLE_EDITOR
+	}
+}
+
+const (
+	AUTH_METHOD_INTERNAL = "internal"
+	AUTH_METHOD_TOKEN    = "token"
+	AUTH_METHOD_OIDC     = "oidc"
+)
+
+// Identity 为认证通过后的调用方身份
+type Identity struct {
+	ORGID   int    `json:"ORG_ID"`
+	UserID  int    `json:"USER_ID"`
+	Role    Role   `json:"ROLE"`
+	Subject string `json:"SUBJECT"` // 静态 token 为 token 名称，OIDC 为 sub
+	Method  string `json:"METHOD"`
+}
+
+// RouteRule 按路径前缀配置访问所需的角色，GET/HEAD/OPTIONS 使用 ReadRole，其他方法使用 WriteRole
+type RouteRule struct {
+	PathPrefix string
+	ReadRole   Role
+	WriteRole  Role
+}
+
+var defaultRouteRule = RouteRule{ReadRole: ROLE_VIEWER, WriteRole: ROLE_EDITOR}
+
+// RequiredRole 返回最长匹配前缀规则要求的角色，没有匹配的规则时读操作需要 viewer，写操作需要 editor
+func RequiredRole(rules []RouteRule, method, path string) Role {
+	rule := defaultRouteRule
+	matched := -1
+	for _, r := range rules {
+		if strings.HasPrefix(path, r.PathPrefix) && len(r.PathPrefix) > matched {
+			rule, matched = r, len(r.PathPrefix)
+		}
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return rule.ReadRole
+	default:
+		return rule.WriteRole
+	}
+}
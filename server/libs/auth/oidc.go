@@ -0,0 +1,424 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 允许的时钟偏差
+	CLOCK_SKEW = time.Minute
+	// 两次拉取 JWKS 的最小间隔，拉取失败时同样生效，避免 IdP 异常时每个请求都重新拉取
+	JWKS_MIN_REFRESH_INTERVAL = time.Minute
+)
+
+var signingHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// oidcVerifier 使用 issuer 的 JWKS 校验 JWT，仅支持 RSA 和 ECDSA 签名算法
+type oidcVerifier struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	// mutex 仅保护以下字段，拉取 JWKS 时不持有
+	mutex       sync.Mutex
+	jwksURL     string
+	keys        map[string]crypto.PublicKey // 最近一次拉取成功的 key，拉取失败时继续使用
+	fetchedAt   time.Time                   // 最近一次拉取成功的时间
+	attemptedAt time.Time                   // 最近一次开始拉取的时间，包括失败的拉取
+	refreshing  chan struct{}               // 正在拉取时不为 nil，拉取结束后关闭
+}
+
+func newOIDCVerifier(cfg OIDCConfig) *oidcVerifier {
+	if cfg.JWKSRefreshInterval <= 0 {
+		cfg.JWKSRefreshInterval = DEFAULT_JWKS_REFRESH_INTERVAL
+	}
+	return &oidcVerifier{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		jwksURL: cfg.JWKSURL,
+	}
+}
+
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Verify 校验 JWT 签名及 exp/nbf/iss/aud，返回 token 对应的身份
+func (v *oidcVerifier) Verify(token string) (*Identity, error) {
+	claims, err := v.verifyClaims(token)
+	if err != nil {
+		return nil, err
+	}
+	return v.identityFromClaims(claims)
+}
+
+func (v *oidcVerifier) verifyClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed jwt")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("decode jwt header failed: %s", err)
+	}
+	hash, ok := signingHashes[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported jwt alg: %s", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("decode jwt signature failed: %s", err)
+	}
+	key, err := v.getKey(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if err := verifySignature(header.Alg, hash, key, h.Sum(nil), signature); err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]interface{})
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("decode jwt claims failed: %s", err)
+	}
+	if err := v.validateClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func verifySignature(alg string, hash crypto.Hash, key crypto.PublicKey, digest, signature []byte) error {
+	switch alg[:2] {
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("jwt alg %s does not match key type", alg)
+		}
+		if alg[:2] == "PS" {
+			return rsa.VerifyPSS(pub, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		return rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("jwt alg %s does not match key type", alg)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid jwt signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("invalid jwt signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported jwt alg: %s", alg)
+}
+
+func (v *oidcVerifier) validateClaims(claims map[string]interface{}, now time.Time) error {
+	exp, ok := numericClaim(claims, "exp")
+	if !ok {
+		return errors.New("jwt exp is required")
+	}
+	if now.After(time.Unix(exp, 0).Add(CLOCK_SKEW)) {
+		return errors.New("jwt is expired")
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(CLOCK_SKEW).Before(time.Unix(nbf, 0)) {
+		return errors.New("jwt is not valid yet")
+	}
+	if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+		return fmt.Errorf("unexpected jwt issuer: %s", iss)
+	}
+	if v.cfg.Audience == "" || !containsString(claims["aud"], v.cfg.Audience) {
+		return fmt.Errorf("jwt audience does not contain %s", v.cfg.Audience)
+	}
+	return nil
+}
+
+func (v *oidcVerifier) identityFromClaims(claims map[string]interface{}) (*Identity, error) {
+	identity := &Identity{ORGID: DEFAULT_ORG_ID, Method: AUTH_METHOD_OIDC}
+	identity.Subject, _ = claims["sub"].(string)
+	if orgID, ok := numericClaim(claims, v.cfg.OrgClaim); ok {
+		identity.ORGID = int(orgID)
+	}
+	if userID, ok := numericClaim(claims, v.cfg.UserIDClaim); ok {
+		identity.UserID = int(userID)
+	}
+
+	// role claim 可以是字符串或字符串数组，取其中权限最高的角色
+	var values []string
+	switch r := claims[v.cfg.RoleClaim].(type) {
+	case string:
+		values = []string{r}
+	case []interface{}:
+		for _, item := range r {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	// 配置了 role-mapping 时只接受映射中的角色，避免 IdP 中同名的角色或分组直接获得权限
+	for _, value := range values {
+		role := Role(value)
+		if len(v.cfg.RoleMapping) > 0 {
+			mapped, ok := v.cfg.RoleMapping[value]
+			if !ok {
+				continue
+			}
+			role = Role(mapped)
+		}
+		if role.Valid() && !identity.Role.Covers(role) {
+			identity.Role = role
+		}
+	}
+	if identity.Role == "" {
+		identity.Role = Role(v.cfg.DefaultRole)
+	}
+	if !identity.Role.Valid() {
+		return nil, fmt.Errorf("no valid role in jwt claim %s", v.cfg.RoleClaim)
+	}
+	return identity, nil
+}
+
+// numericClaim 支持数字及数字字符串形式的 claim
+func numericClaim(claims map[string]interface{}, name string) (int64, bool) {
+	switch c := claims[name].(type) {
+	case json.Number:
+		if i, err := c.Int64(); err == nil {
+			return i, true
+		}
+		if f, err := c.Float64(); err == nil {
+			return int64(f), true
+		}
+	case string:
+		if i, err := strconv.ParseInt(c, 10, 64); err == nil {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func containsString(claim interface{}, expected string) bool {
+	switch c := claim.(type) {
+	case string:
+		return c == expected
+	case []interface{}:
+		for _, item := range c {
+			if s, ok := item.(string); ok && s == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getKey 返回 kid 对应的 key，key 过期或未找到时拉取 JWKS，同一时间只有一个请求拉取，
+// 其他请求使用已有的 key，已有的 key 中没有 kid 时等待拉取完成
+func (v *oidcVerifier) getKey(kid string) (crypto.PublicKey, error) {
+	v.mutex.Lock()
+	key, found := v.lookupKey(kid)
+	expired := time.Since(v.fetchedAt) > time.Duration(v.cfg.JWKSRefreshInterval)*time.Second
+	if (expired || !found) && v.refreshing == nil && time.Since(v.attemptedAt) > JWKS_MIN_REFRESH_INTERVAL {
+		done := make(chan struct{})
+		v.refreshing = done
+		v.attemptedAt = time.Now()
+		jwksURL := v.jwksURL
+		v.mutex.Unlock()
+
+		jwksURL, keys, err := v.fetchKeys(jwksURL)
+
+		v.mutex.Lock()
+		if err != nil {
+			// 拉取失败时继续使用已有的 key
+			log.Warningf("refresh oidc jwks failed: %s", err)
+		} else {
+			v.jwksURL, v.keys, v.fetchedAt = jwksURL, keys, time.Now()
+			key, found = v.lookupKey(kid)
+		}
+		v.refreshing = nil
+		close(done)
+	} else if !found && v.refreshing != nil {
+		done := v.refreshing
+		v.mutex.Unlock()
+		<-done
+		v.mutex.Lock()
+		key, found = v.lookupKey(kid)
+	}
+	v.mutex.Unlock()
+	if !found {
+		return nil, fmt.Errorf("jwt signing key %s not found", kid)
+	}
+	return key, nil
+}
+
+// lookupKey 在 jwt 未指定 kid 且 JWKS 只有一个 key 时使用该 key，需持有 v.mutex
+func (v *oidcVerifier) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+// fetchKeys 拉取 JWKS，jwksURL 为空时先通过 openid-configuration 获取，返回使用的 jwksURL 及其中的签名 key
+func (v *oidcVerifier) fetchKeys(jwksURL string) (string, map[string]crypto.PublicKey, error) {
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.getJSON(strings.TrimSuffix(v.cfg.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+			return "", nil, err
+		}
+		if discovery.JWKSURI == "" {
+			return "", nil, errors.New("jwks_uri not found in openid configuration")
+		}
+		jwksURL = discovery.JWKSURI
+	}
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.getJSON(jwksURL, &jwks); err != nil {
+		return "", nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.Warningf("skip oidc jwk %s: %s", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return jwksURL, keys, nil
+}
+
+func (v *oidcVerifier) getJSON(url string, result interface{}) error {
+	resp, err := v.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get %s failed, status code %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid rsa exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("ec point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deepflowio/deepflow/server/libs/lru"
+)
+
+const (
+	API_TOKEN_PREFIX = "dfk_"
+	// 用于展示及定位 token，不足以还原 token
+	API_TOKEN_DISPLAY_LEN = 12
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// GenerateToken 生成静态 API token，metadb 中只保存其 sha256
+func GenerateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return API_TOKEN_PREFIX + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func DisplayToken(token string) string {
+	if len(token) <= API_TOKEN_DISPLAY_LEN {
+		return token
+	}
+	return token[:API_TOKEN_DISPLAY_LEN]
+}
+
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, API_TOKEN_PREFIX)
+}
+
+// TokenStore 根据静态 token 查询调用方身份，token 不存在或已过期时返回 ErrInvalidToken
+type TokenStore interface {
+	LookupToken(token string) (*Identity, error)
+}
+
+type cachedIdentity struct {
+	identity *Identity
+	err      error
+	expireAt time.Time
+}
+
+const (
+	// 有效 token 与无效 token 分别缓存，无效 token 可由客户端任意构造，使用更小的容量
+	TOKEN_CACHE_SIZE         = 10000
+	INVALID_TOKEN_CACHE_SIZE = 1000
+)
+
+// cachedTokenStore 缓存 token 的校验结果，token 被删除后最长 ttl 后失效，
+// 缓存按 LRU 淘汰，过期的结果在查询时忽略并由定时清理删除
+type cachedTokenStore struct {
+	store TokenStore
+	ttl   time.Duration
+
+	mutex   sync.Mutex
+	valid   *lru.Cache[string, *cachedIdentity]
+	invalid *lru.Cache[string, *cachedIdentity]
+}
+
+func NewCachedTokenStore(store TokenStore, ttlSeconds int) TokenStore {
+	if ttlSeconds <= 0 {
+		return store
+	}
+	s := newCachedTokenStore(store, time.Duration(ttlSeconds)*time.Second)
+	go func() {
+		for range time.Tick(s.ttl) {
+			s.sweep(time.Now())
+		}
+	}()
+	return s
+}
+
+func newCachedTokenStore(store TokenStore, ttl time.Duration) *cachedTokenStore {
+	return &cachedTokenStore{
+		store:   store,
+		ttl:     ttl,
+		valid:   lru.NewCache[string, *cachedIdentity](TOKEN_CACHE_SIZE),
+		invalid: lru.NewCache[string, *cachedIdentity](INVALID_TOKEN_CACHE_SIZE),
+	}
+}
+
+func (s *cachedTokenStore) LookupToken(token string) (*Identity, error) {
+	key := HashToken(token)
+	now := time.Now()
+	s.mutex.Lock()
+	for _, cache := range []*lru.Cache[string, *cachedIdentity]{s.valid, s.invalid} {
+		if c, ok := cache.Get(key); ok && now.Before(c.expireAt) {
+			s.mutex.Unlock()
+			return c.identity, c.err
+		}
+	}
+	s.mutex.Unlock()
+
+	identity, err := s.store.LookupToken(token)
+	if err != nil && !errors.Is(err, ErrInvalidToken) {
+		// 查询失败时不缓存，避免后端短暂不可用导致 token 在 ttl 内均无法使用
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	c := &cachedIdentity{identity: identity, err: err, expireAt: now.Add(s.ttl)}
+	if err != nil {
+		s.invalid.Add(key, c)
+	} else {
+		s.valid.Add(key, c)
+	}
+	return identity, err
+}
+
+// sweep 删除已过期的缓存
+func (s *cachedTokenStore) sweep(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, cache := range []*lru.Cache[string, *cachedIdentity]{s.valid, s.invalid} {
+		for _, key := range cache.Keys() {
+			if c, ok := cache.Peek(key); ok && !now.Before(c.expireAt) {
+				cache.Remove(key)
+			}
+		}
+	}
+}
+
+// remoteTokenStore 通过 controller 的 /v1/auth/identity/ 接口校验静态 token，供 querier 和 mcp 使用
+type remoteTokenStore struct {
+	url    string
+	client *http.Client
+}
+
+func NewRemoteTokenStore(controllerPort int) TokenStore {
+	return &remoteTokenStore{
+		url:    fmt.Sprintf("http://localhost:%d/v1/auth/identity/", controllerPort),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *remoteTokenStore) LookupToken(token string) (*Identity, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(HEADER_KEY_AUTHORIZATION, BEARER_PREFIX+token)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, ErrInvalidToken
+	default:
+		return nil, fmt.Errorf("verify token by %s failed, status code %d, response: %s", s.url, resp.StatusCode, body)
+	}
+	var result struct {
+		Data *Identity `json:"DATA"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	if result.Data == nil {
+		return nil, fmt.Errorf("verify token by %s failed, empty response", s.url)
+	}
+	return result.Data, nil
+}
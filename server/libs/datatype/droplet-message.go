@@ -57,6 +57,7 @@ const (
 	MESSAGE_TYPE_AGENT_LOG
 	MESSAGE_TYPE_SKYWALKING
 	MESSAGE_TYPE_DATADOG // 20
+	MESSAGE_TYPE_ZIPKIN
 	MESSAGE_TYPE_MAX
 )
 
@@ -84,6 +85,7 @@ var MessageTypeString = [MESSAGE_TYPE_MAX]string{
 	MESSAGE_TYPE_AGENT_LOG:                "agent_log",
 	MESSAGE_TYPE_SKYWALKING:               "skywalking",
 	MESSAGE_TYPE_DATADOG:                  "datadog",
+	MESSAGE_TYPE_ZIPKIN:                   "zipkin",
 }
 
 func (m MessageType) String() string {
@@ -129,6 +131,7 @@ var MessageHeaderTypes = [MESSAGE_TYPE_MAX]MessageHeaderType{
 	MESSAGE_TYPE_AGENT_LOG:                HEADER_TYPE_LT_VTAP,
 	MESSAGE_TYPE_SKYWALKING:               HEADER_TYPE_LT_VTAP,
 	MESSAGE_TYPE_DATADOG:                  HEADER_TYPE_LT_VTAP,
+	MESSAGE_TYPE_ZIPKIN:                   HEADER_TYPE_LT_VTAP,
 }
 
 func (m MessageType) HeaderType() MessageHeaderType {
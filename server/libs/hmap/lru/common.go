@@ -38,9 +38,9 @@ func minPowerOfTwo(v int) (int, int) {
 }
 
 type Counter struct {
-	Max     int `statsd:"max-bucket"` // 统计Get扫描到的最大值
-	Size    int `statsd:"size"`
-	AvgScan int `statsd:"avg-scan"` // 平均扫描次数
+	Max     int `statsd:"max-bucket,gauge"` // 统计Get扫描到的最大值
+	Size    int `statsd:"size,gauge"`
+	AvgScan int `statsd:"avg-scan,gauge"` // 平均扫描次数
 	Hit     int `statsd:"hit"`
 	Miss    int `statsd:"miss"`
 
@@ -48,11 +48,11 @@ type Counter struct {
 }
 
 type DoubleKeyLRUCounter struct {
-	Max            int `statsd:"max-bucket"`       // 目前仅统计Get扫描到的最大冲突值
-	MaxShortBucket int `statsd:"max-short-bucket"` // 目前仅统计GetByShortKey扫描到的最大冲突值
-	Size           int `statsd:"size"`
-	MaxLongBucket  int `statsd:"max-long-bucket"` // 目前通过shortKey删除的含有最多的成员数值
-	AvgScan        int `statsd:"avg-scan"`        // 平均扫描次数
+	Max            int `statsd:"max-bucket,gauge"`       // 目前仅统计Get扫描到的最大冲突值
+	MaxShortBucket int `statsd:"max-short-bucket,gauge"` // 目前仅统计GetByShortKey扫描到的最大冲突值
+	Size           int `statsd:"size,gauge"`
+	MaxLongBucket  int `statsd:"max-long-bucket,gauge"` // 目前通过shortKey删除的含有最多的成员数值
+	AvgScan        int `statsd:"avg-scan,gauge"`        // 平均扫描次数
 	Hit            int `statsd:"hit"`
 	Miss           int `statsd:"miss"`
 
@@ -123,13 +123,13 @@ type PolicyCounter struct {
 	Acl                  uint32 `statsd:"acl"`
 	FirstHit             uint64 `statsd:"first_hit"`
 	FastHit              uint64 `statsd:"fast_hit"`
-	AclHitMax            uint32 `statsd:"acl_hit_max"`
+	AclHitMax            uint32 `statsd:"acl_hit_max,gauge"`
 	FastPath             uint32 `statsd:"fast_path"`
 	FastPathMacCount     uint32 `statsd:"fast_path_mac_count"`
 	FastPathPolicyCount  uint32 `statsd:"fast_path_policy_count"`
 	UnmatchedPacketCount uint64 `statsd:"unmatched_packet_count"`
 	FirstPathItems       uint64 `statsd:"first_path_items"`
-	FirstPathMaxBucket   uint32 `statsd:"first_path_max_bucket"`
+	FirstPathMaxBucket   uint32 `statsd:"first_path_max_bucket,gauge"`
 }
 
 func getAvailableMapSize(queueCount int, mapSize uint32) uint32 {
@@ -409,12 +409,12 @@ type ReceiverCounter struct {
 	Invalid         uint64 `statsd:"invalid"`
 	Unregistered    uint64 `statsd:"unregistered"`
 	RxPackets       uint64 `statsd:"rx_packets"`
-	MaxDelay        int64  `statsd:"max_delay"`
-	MinDelay        int64  `statsd:"min_delay"`
+	MaxDelay        int64  `statsd:"max_delay,gauge"`
+	MinDelay        int64  `statsd:"min_delay,gauge"`
 	UDPDropped      uint64 `statsd:"udp_dropped"`
-	UDPDisorder     uint64 `statsd:"udp_disorder"`      // 乱序个数
-	UDPDisorderSize uint64 `statsd:"udp_disorder_size"` // 乱序最大范围
-	NewBufferCount  uint64 `statsd:"new_buffer_count"`  // If the received data is large, you need to alloc memory, record the times.
+	UDPDisorder     uint64 `statsd:"udp_disorder"`            // 乱序个数
+	UDPDisorderSize uint64 `statsd:"udp_disorder_size,gauge"` // 乱序最大范围
+	NewBufferCount  uint64 `statsd:"new_buffer_count"`        // If the received data is large, you need to alloc memory, record the times.
 }
 
 func NewReceiver(
@@ -0,0 +1,28 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stats
+
+// 供 stats_test 包中的测试调用，避免与依赖 stats 的包产生循环引用
+var (
+	ResetPromSources  = resetPromSources
+	CollectPromSource = collectPromSource
+)
+
+func NewTestStatSource(module string, tags OptionStatTags) *StatSource {
+	processName, processNameJoiner = "deepflow_server", "_"
+	return &StatSource{module: module, tags: tags}
+}
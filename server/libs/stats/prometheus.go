@@ -0,0 +1,305 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stats
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/influxdata/influxdb/models"
+)
+
+const (
+	METRICS_PATH = "/metrics"
+
+	OPENMETRICS_CONTENT_TYPE = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	PROMETHEUS_CONTENT_TYPE  = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+type promMetricType uint8
+
+const (
+	PROM_METRIC_GAUGE promMetricType = iota
+	PROM_METRIC_COUNTER
+)
+
+func (t promMetricType) String() string {
+	if t == PROM_METRIC_COUNTER {
+		return "counter"
+	}
+	return "gauge"
+}
+
+// promSource 保存一个 StatSource 最近一次采集的结果
+// Countable 读取后会清零，字段默认按 counter 累加，statsd 标签为 gauge 的字段（如 `statsd:"pending,gauge"`）保存最近一个周期的值
+type promSource struct {
+	labels string
+	values map[string]float64
+	types  map[string]promMetricType
+}
+
+var (
+	promLock      sync.Mutex
+	promSources   = make(map[*StatSource]*promSource)
+	promConflicts = make(map[string]struct{}) // 已告警过类型冲突的 metric
+)
+
+func removePromSource(source *StatSource) {
+	promLock.Lock()
+	delete(promSources, source)
+	promLock.Unlock()
+}
+
+// promName 将 module/field 转换为合法的 metric 名称或 label 名称，非法字符替换为 _
+func promName(name string, allowColon bool) string {
+	b := []byte(name)
+	for i, c := range b {
+		valid := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+			(i > 0 && c >= '0' && c <= '9') || (allowColon && c == ':')
+		if !valid {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+func escapeLabelValue(value string) string {
+	if !strings.ContainsAny(value, "\\\"\n") {
+		return value
+	}
+	return strings.NewReplacer("\\", `\\`, "\"", `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name)
+		sb.WriteString(`="`)
+		sb.WriteString(escapeLabelValue(labels[name]))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// metricTypes 根据 statsd 标签的第二项确定字段类型，未标记为 gauge 的字段均为 counter
+func metricTypes(counter interface{}) map[string]promMetricType {
+	types := make(map[string]promMetricType)
+	if _, ok := counter.([]StatItem); ok {
+		return types
+	}
+	val := reflect.Indirect(reflect.ValueOf(counter))
+	if val.Kind() != reflect.Struct {
+		return types
+	}
+	for i := 0; i < val.Type().NumField(); i++ {
+		statsOpts := strings.Split(val.Type().Field(i).Tag.Get("statsd"), ",")
+		if len(statsOpts) > 1 && statsOpts[1] == "gauge" {
+			types[statsOpts[0]] = PROM_METRIC_GAUGE
+		}
+	}
+	return types
+}
+
+func fieldType(types map[string]promMetricType, field string) promMetricType {
+	if t, ok := types[field]; ok {
+		return t
+	}
+	return PROM_METRIC_COUNTER
+}
+
+func fieldToFloat64(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Bool:
+		if v.Bool() {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// updatePromSource 在 collectBatchPoints 中调用，需持有 lock
+func updatePromSource(source *StatSource, counter interface{}, fields models.Fields) {
+	name := promName(processName+processNameJoiner+source.modulePrefix+source.module, true)
+	labels := make(map[string]string, len(source.tags))
+	for k, v := range source.tags {
+		labels[promName(k, false)] = v
+	}
+	// 与 dfstats 一致，字符串类型的字段作为 label
+	for k, v := range fields {
+		if s, ok := v.(string); ok {
+			labels[promName(k, false)] = s
+		}
+	}
+	types := metricTypes(counter)
+
+	promLock.Lock()
+	defer promLock.Unlock()
+	s, ok := promSources[source]
+	if !ok {
+		s = &promSource{values: make(map[string]float64), types: make(map[string]promMetricType)}
+		promSources[source] = s
+	}
+	s.labels = formatLabels(labels)
+	for k, v := range fields {
+		value, ok := fieldToFloat64(v)
+		if !ok {
+			continue
+		}
+		metric := name + "_" + promName(k, true)
+		metricType := fieldType(types, k)
+		if metricType == PROM_METRIC_COUNTER {
+			metric = strings.TrimSuffix(metric, "_total")
+			s.values[metric] += value
+		} else {
+			s.values[metric] = value
+		}
+		s.types[metric] = metricType
+	}
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+type promFamily struct {
+	metricType promMetricType
+	samples    map[string]float64 // labels -> value
+}
+
+// WriteMetrics 输出所有 Countable 的 Prometheus 文本格式，openMetrics 为 true 时输出 OpenMetrics 格式
+// metric 名称为 <进程名>_<module>_<field>，StatSource 的 tags 作为 label
+// 多个 StatSource 的 module 和 tags 相同时，同一 metric 的值相加后输出为一个 series
+// 同名 metric 在不同 StatSource 中类型不同时，gauge 改名为 <metric>_gauge 输出
+func WriteMetrics(w io.Writer, openMetrics bool) error {
+	families := make(map[string]*promFamily)
+	addSample := func(name string, metricType promMetricType, labels string, value float64) {
+		family, ok := families[name]
+		if !ok {
+			family = &promFamily{metricType: metricType, samples: make(map[string]float64)}
+			families[name] = family
+		}
+		family.samples[labels] += value
+	}
+	conflicts := make(map[string]bool)
+	promLock.Lock()
+	types := make(map[string]promMetricType)
+	for _, s := range promSources {
+		for metric, metricType := range s.types {
+			if t, ok := types[metric]; ok && t != metricType {
+				conflicts[metric] = true
+				if _, ok := promConflicts[metric]; !ok {
+					promConflicts[metric] = struct{}{}
+					log.Warningf("metric %s is both counter and gauge, the gauge is exported as %s_gauge", metric, metric)
+				}
+			}
+			types[metric] = metricType
+		}
+	}
+	for _, s := range promSources {
+		for metric, value := range s.values {
+			name := metric
+			if conflicts[metric] && s.types[metric] == PROM_METRIC_GAUGE {
+				name += "_gauge"
+			}
+			addSample(name, s.types[metric], s.labels, value)
+		}
+	}
+	promLock.Unlock()
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		family := families[name]
+		sampleName := name
+		typeName := name
+		if family.metricType == PROM_METRIC_COUNTER {
+			sampleName += "_total"
+			if !openMetrics {
+				typeName += "_total"
+			}
+		}
+		bw.WriteString("# TYPE " + typeName + " " + family.metricType.String() + "\n")
+		labels := make([]string, 0, len(family.samples))
+		for l := range family.samples {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+		for _, l := range labels {
+			bw.WriteString(sampleName + l + " " + formatValue(family.samples[l]) + "\n")
+		}
+	}
+	if openMetrics {
+		bw.WriteString("# EOF\n")
+	}
+	return bw.Flush()
+}
+
+// MetricsHandler 提供 /metrics 接口，根据 Accept 请求头选择 OpenMetrics 或 Prometheus 文本格式
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+		if openMetrics {
+			w.Header().Set("Content-Type", OPENMETRICS_CONTENT_TYPE)
+		} else {
+			w.Header().Set("Content-Type", PROMETHEUS_CONTENT_TYPE)
+		}
+		if err := WriteMetrics(w, openMetrics); err != nil {
+			log.Warningf("write metrics failed: %s", err)
+		}
+	})
+}
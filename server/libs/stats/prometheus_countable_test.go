@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stats_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/deepflowio/deepflow/server/libs/hmap/lru"
+	"github.com/deepflowio/deepflow/server/libs/stats"
+)
+
+func TestWriteMetricsLRUCounter(t *testing.T) {
+	stats.ResetPromSources()
+	defer stats.ResetPromSources()
+
+	// lru 的 max-bucket/size/avg-scan 为周期内的瞬时值，两个周期后应为第二个周期的值而不是累加值
+	source := stats.NewTestStatSource("lru", stats.OptionStatTags{"module": "flow"})
+	stats.CollectPromSource(source, &lru.Counter{Max: 5, Size: 100, AvgScan: 2, Hit: 10, Miss: 1})
+	stats.CollectPromSource(source, &lru.Counter{Max: 3, Size: 120, AvgScan: 1, Hit: 5, Miss: 2})
+
+	expected := `# TYPE deepflow_server_lru_avg_scan gauge
+deepflow_server_lru_avg_scan{module="flow"} 1
+# TYPE deepflow_server_lru_hit_total counter
+deepflow_server_lru_hit_total{module="flow"} 15
+# TYPE deepflow_server_lru_max_bucket gauge
+deepflow_server_lru_max_bucket{module="flow"} 3
+# TYPE deepflow_server_lru_miss_total counter
+deepflow_server_lru_miss_total{module="flow"} 3
+# TYPE deepflow_server_lru_size gauge
+deepflow_server_lru_size{module="flow"} 120
+`
+	var buf bytes.Buffer
+	if err := stats.WriteMetrics(&buf, false); err != nil {
+		t.Fatal(err)
+	}
+	if output := buf.String(); output != expected {
+		t.Errorf("unexpected prometheus text output:\n%s\nexpected:\n%s", output, expected)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stats
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testCounter struct {
+	In      uint64  `statsd:"in"`
+	Drop    uint64  `statsd:"drop_total,count"`
+	Pending uint64  `statsd:"pending,gauge"`
+	Ratio   float64 `statsd:"ratio,gauge"`
+}
+
+func resetPromSources() {
+	promLock.Lock()
+	promSources = make(map[*StatSource]*promSource)
+	promConflicts = make(map[string]struct{})
+	promLock.Unlock()
+}
+
+func collectPromSource(source *StatSource, counter interface{}) {
+	updatePromSource(source, counter, counterToFields(counter))
+}
+
+func writeMetrics(t *testing.T, openMetrics bool) string {
+	var buf bytes.Buffer
+	if err := WriteMetrics(&buf, openMetrics); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestWriteMetrics(t *testing.T) {
+	processName, processNameJoiner = "deepflow_server", "_"
+	resetPromSources()
+	defer resetPromSources()
+
+	source := &StatSource{module: "queue", tags: OptionStatTags{"host": "node-1", "index": "0"}}
+	collectPromSource(source, &testCounter{In: 10, Drop: 1, Pending: 5, Ratio: 0.5})
+	// 未标记 gauge 的字段按 counter 累加，gauge 保存最近一个周期的值
+	collectPromSource(source, &testCounter{In: 20, Drop: 2, Pending: 3, Ratio: 0.25})
+
+	expected := `# TYPE deepflow_server_queue_drop_total counter
+deepflow_server_queue_drop_total{host="node-1",index="0"} 3
+# TYPE deepflow_server_queue_in_total counter
+deepflow_server_queue_in_total{host="node-1",index="0"} 30
+# TYPE deepflow_server_queue_pending gauge
+deepflow_server_queue_pending{host="node-1",index="0"} 3
+# TYPE deepflow_server_queue_ratio gauge
+deepflow_server_queue_ratio{host="node-1",index="0"} 0.25
+`
+	if output := writeMetrics(t, false); output != expected {
+		t.Errorf("unexpected prometheus text output:\n%s\nexpected:\n%s", output, expected)
+	}
+
+	expected = `# TYPE deepflow_server_queue_drop counter
+deepflow_server_queue_drop_total{host="node-1",index="0"} 3
+# TYPE deepflow_server_queue_in counter
+deepflow_server_queue_in_total{host="node-1",index="0"} 30
+# TYPE deepflow_server_queue_pending gauge
+deepflow_server_queue_pending{host="node-1",index="0"} 3
+# TYPE deepflow_server_queue_ratio gauge
+deepflow_server_queue_ratio{host="node-1",index="0"} 0.25
+# EOF
+`
+	if output := writeMetrics(t, true); output != expected {
+		t.Errorf("unexpected openmetrics output:\n%s\nexpected:\n%s", output, expected)
+	}
+}
+
+func TestWriteMetricsMerge(t *testing.T) {
+	processName, processNameJoiner = "deepflow_server", "_"
+	resetPromSources()
+	defer resetPromSources()
+
+	// module 和 tags 相同的 StatSource 合并为一个 series
+	tags := OptionStatTags{"host": "node-1"}
+	collectPromSource(&StatSource{module: "decoder", tags: tags}, []StatItem{{Name: "in", Value: uint64(3)}})
+	collectPromSource(&StatSource{module: "decoder", tags: tags}, []StatItem{{Name: "in", Value: uint64(4)}})
+	// 同名 metric 类型冲突时 gauge 改名输出
+	collectPromSource(&StatSource{module: "queue", tags: tags}, &testCounter{Pending: 2})
+	collectPromSource(&StatSource{module: "queue", tags: OptionStatTags{"host": "node-2"}}, []StatItem{{Name: "pending", Value: 7}, {Name: "name", Value: "a\"b"}})
+
+	expected := `# TYPE deepflow_server_decoder_in counter
+deepflow_server_decoder_in_total{host="node-1"} 7
+# TYPE deepflow_server_queue_drop counter
+deepflow_server_queue_drop_total{host="node-1"} 0
+# TYPE deepflow_server_queue_in counter
+deepflow_server_queue_in_total{host="node-1"} 0
+# TYPE deepflow_server_queue_pending counter
+deepflow_server_queue_pending_total{host="node-2",name="a\"b"} 7
+# TYPE deepflow_server_queue_pending_gauge gauge
+deepflow_server_queue_pending_gauge{host="node-1"} 2
+# TYPE deepflow_server_queue_ratio gauge
+deepflow_server_queue_ratio{host="node-1"} 0
+# EOF
+`
+	if output := writeMetrics(t, true); output != expected {
+		t.Errorf("unexpected openmetrics output:\n%s\nexpected:\n%s", output, expected)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	resetPromSources()
+	cases := map[string]string{
+		"":           PROMETHEUS_CONTENT_TYPE,
+		"text/plain": PROMETHEUS_CONTENT_TYPE,
+		"application/openmetrics-text; version=1.0.0": OPENMETRICS_CONTENT_TYPE,
+	}
+	for accept, contentType := range cases {
+		req := httptest.NewRequest(http.MethodGet, METRICS_PATH, nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		MetricsHandler().ServeHTTP(w, req)
+		if got := w.Header().Get("Content-Type"); got != contentType {
+			t.Errorf("accept %q: expected content type %s, got %s", accept, contentType, got)
+		}
+	}
+}
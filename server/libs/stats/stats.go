@@ -116,7 +116,11 @@ func registerCountable(modulePrefix, module string, countable Countable, opts ..
 		if !closed && equal {
 			log.Warningf("Possible memory leak! countable %v is not correctly closed.", &source)
 		}
-		return closed || equal
+		if closed || equal {
+			removePromSource(x.(*StatSource))
+			return true
+		}
+		return false
 	})
 	statSources.PushBack(&source)
 	lock.Unlock()
@@ -161,7 +165,11 @@ func collectBatchPoints(timestamp time.Time) client.BatchPoints {
 	bp, _ := client.NewBatchPoints(client.BatchPointsConfig{Precision: "s"})
 	lock.Lock()
 	statSources.Remove(func(x interface{}) bool {
-		return x.(*StatSource).countable.Closed()
+		if x.(*StatSource).countable.Closed() {
+			removePromSource(x.(*StatSource))
+			return true
+		}
+		return false
 	})
 	for it := statSources.Iterator(); !it.Empty(); it.Next() {
 		statSource := it.Value().(*StatSource)
@@ -178,7 +186,9 @@ func collectBatchPoints(timestamp time.Time) client.BatchPoints {
 		}
 		statSource.skip = int(max(statSource.interval, MinInterval) / TICK_CYCLE)
 
-		fields := counterToFields(statSource.countable.GetCounter())
+		counter := statSource.countable.GetCounter()
+		fields := counterToFields(counter)
+		updatePromSource(statSource, counter, fields)
 		point, _ := client.NewPoint(processName+processNameJoiner+statSource.modulePrefix+statSource.module, statSource.tags, fields, timestamp)
 		bp.AddPoint(point)
 	}
@@ -26,20 +26,66 @@ var TEXT_CN_TO_EN = map[string]string{
 	"自身耗时":  "Self Time",
 	"总耗时":   "Total Time",
 	"调用关系图": "Call Relationship Diagram",
-	"显示了 %d 个函数，%d 条调用关系": "Showing %d functions, %d call relationships",
-	"commit_id 参数不能为空":    "commit_id parameter cannot be empty",
-	"解析开始时间失败":            "Failed to parse start time",
-	"解析结束时间失败":            "Failed to parse end time",
-	"获取profile数据失败":       "Failed to get profile data",
-	"commit ID 验证失败":      "Commit ID validation failed",
-	"commit ID 长度超过限制":    "Commit ID length exceeds limit",
-	"commit ID 包含异常字符":    "Commit ID contains invalid characters",
-	"无法转换类型":              "Cannot convert type",
-	"无法解析时间格式":            "Cannot parse time format",
-	"转换selfTime失败":        "Failed to convert selfTime",
-	"转换totalTime失败":       "Failed to convert totalTime",
-	"正则表达式验证失败":           "Regular expression validation failed",
-	KNOWLEDGE_TEXT:        "\n * Background Knowledge:\n - Node names starting with [t] represent threads, [p] represents processes, [k] represents Linux kernel functions, [l] represents functions in dynamic link libraries\n Self time is the time consumed by the node itself, total time is the time consumed by the node itself + child nodes\n - Call relationship diagram shows the calling relationships between nodes, from parent nodes to child nodes\n\n * Note:\n When interpreting results:\n 1. Top 10 functions are presented in table format\n 2. Display the complete call relationship diagram above using Diagram\n 3. Analyze possible bottlenecks and issues, and provide a brief summary\n ",
+	"显示了 %d 个函数，%d 条调用关系":          "Showing %d functions, %d call relationships",
+	"commit_id 参数不能为空":             "commit_id parameter cannot be empty",
+	"解析开始时间失败":                     "Failed to parse start time",
+	"解析结束时间失败":                     "Failed to parse end time",
+	"获取profile数据失败":                "Failed to get profile data",
+	"commit ID 验证失败":               "Commit ID validation failed",
+	"commit ID 长度超过限制":             "Commit ID length exceeds limit",
+	"commit ID 包含异常字符":             "Commit ID contains invalid characters",
+	"无法转换类型":                       "Cannot convert type",
+	"无法解析时间格式":                     "Cannot parse time format",
+	"转换selfTime失败":                 "Failed to convert selfTime",
+	"转换totalTime失败":                "Failed to convert totalTime",
+	"正则表达式验证失败":                    "Regular expression validation failed",
+	"org_id 不合法":                   "Invalid org_id",
+	"sql 参数不能为空":                   "sql parameter cannot be empty",
+	"sql 长度超过限制":                   "SQL length exceeds limit",
+	"仅支持 SELECT 和 SHOW 语句":         "Only SELECT and SHOW statements are supported",
+	"不支持多条语句":                      "Multiple statements are not supported",
+	"SQL 解析失败":                     "Failed to parse SQL",
+	"数据库名称不合法":                     "Invalid database name",
+	"表名不合法":                        "Invalid table name",
+	"query 参数不能为空":                 "query parameter cannot be empty",
+	"PromQL 长度超过限制":                "PromQL length exceeds limit",
+	"step 不合法":                     "Invalid step",
+	"trace_id 参数不能为空":              "trace_id parameter cannot be empty",
+	"trace_id 包含异常字符":              "trace_id contains invalid characters",
+	"service 参数不能为空":               "service parameter cannot be empty",
+	"service 包含异常字符":               "service contains invalid characters",
+	"order_by 仅支持 latency 和 error": "order_by only supports latency and error",
+	"limit 超出范围":                   "limit is out of range",
+	"开始时间不能晚于结束时间":                 "Start time cannot be later than end time",
+	"查询失败":                         "Query failed",
+	"查询结果":                         "Query Result",
+	"无数据":                          "No data",
+	"结果已截断，共 %d 行，仅显示前 %d 行":       "Result truncated: %d rows in total, only the first %d are shown",
+	"结果已截断，超过 %d 字节":               "Result truncated: exceeds %d bytes",
+	"共 %d 条序列，仅显示前 %d 条":           "%d series in total, only the first %d are shown",
+	"共 %d 个点，仅显示最后 %d 个":           "%d points in total, only the last %d are shown",
+	"点数":                           "Points",
+	"最小值":                          "Min",
+	"最大值":                          "Max",
+	"最新值":                          "Last",
+	"时间":                           "Time",
+	"值":                            "Value",
+	"调用链":                          "Distributed Trace",
+	"共 %d 个 span":                  "%d spans in total",
+	"服务":                           "Service",
+	"端点":                           "Endpoint",
+	"协议":                           "Protocol",
+	"观测点":                          "Observation Point",
+	"状态":                           "Status",
+	"时延":                           "Latency",
+	"Top %d 慢端点（按平均时延排序）":          "Top %d Slow Endpoints (Sorted by Avg Latency)",
+	"Top %d 错误端点（按错误数排序）":          "Top %d Erroring Endpoints (Sorted by Error Count)",
+	"请求数":                          "Requests",
+	"平均时延":                         "Avg Latency",
+	"最大时延":                         "Max Latency",
+	"错误数":                          "Errors",
+	"错误率":                          "Error Ratio",
+	KNOWLEDGE_TEXT:                 "\n * Background Knowledge:\n - Node names starting with [t] represent threads, [p] represents processes, [k] represents Linux kernel functions, [l] represents functions in dynamic link libraries\n Self time is the time consumed by the node itself, total time is the time consumed by the node itself + child nodes\n - Call relationship diagram shows the calling relationships between nodes, from parent nodes to child nodes\n\n * Note:\n When interpreting results:\n 1. Top 10 functions are presented in table format\n 2. Display the complete call relationship diagram above using Diagram\n 3. Analyze possible bottlenecks and issues, and provide a brief summary\n ",
 }
 
 const (
@@ -48,9 +94,29 @@ const (
 	MAX_NODES_IN_TREE          = 100
 	TOP_FUNCTIONS_COUNT        = 10
 
+	MCP_ENDPOINT_PATH = "/mcp" // 与 mcp-go StreamableHTTPServer 的默认路径一致
+
 	DEFAULT_REGION_NAME    = "系统默认"
 	PROFILE_API_URL_FORMAT = "http://127.0.0.1:%d/v1/profile/ProfileTracing"
 
+	QUERIER_SQL_API_URL_FORMAT      = "http://127.0.0.1:%d/v1/query/"
+	PROM_QUERY_API_URL_FORMAT       = "http://127.0.0.1:%d/prom/api/v1/query"
+	PROM_QUERY_RANGE_API_URL_FORMAT = "http://127.0.0.1:%d/prom/api/v1/query_range"
+
+	DEFAULT_QUERY_DB            = "flow_log"
+	MAX_SQL_LENGTH              = 8192
+	MAX_PROMQL_LENGTH           = 4096
+	MAX_RESULT_ROWS             = 200   // 单次返回给模型的最大行数
+	MAX_RESULT_BYTES            = 65536 // 单次返回给模型的最大字节数
+	MAX_PROM_SERIES             = 50
+	MAX_PROM_POINTS             = 60
+	MAX_TRACE_SPANS             = 500
+	DEFAULT_TRACE_RANGE_MINUTES = 60
+	DEFAULT_TOP_ENDPOINTS       = 10
+	MAX_TOP_ENDPOINTS           = 100
+	MAX_TRACE_ID_LENGTH         = 128
+	MAX_SERVICE_NAME_LENGTH     = 256
+
 	KNOWLEDGE_TEXT = `
 * 背景知识：
 - 节点名以 [t] 开头表示一个线程，以 [p] 开头表示一个进程, 以 [k] 开头表示一个 Linux 内核函数, 以 [l] 开头表示一个动态链接库中的函数
@@ -31,11 +31,13 @@ type MCPConfig struct {
 	ListenPort      int `default:"20080" yaml:"listen-port"`
 	QuerierPort     int
 	QuerierLanguage string
+	ControllerPort  int
 }
 
 type Config struct {
-	MCPConfig     MCPConfig            `yaml:"mcp"`
-	QuerierConfig config.QuerierConfig `yaml:"querier"`
+	MCPConfig        MCPConfig               `yaml:"mcp"`
+	QuerierConfig    config.QuerierConfig    `yaml:"querier"`
+	ControllerConfig config.ControllerConfig `yaml:"controller"`
 }
 
 func (c *Config) Load(path string) {
@@ -52,6 +54,7 @@ func (c *Config) Load(path string) {
 
 	c.MCPConfig.QuerierPort = c.QuerierConfig.ListenPort
 	c.MCPConfig.QuerierLanguage = c.QuerierConfig.Language
+	c.MCPConfig.ControllerPort = c.ControllerConfig.ListenPort
 
 	MConfig = &c.MCPConfig
 }
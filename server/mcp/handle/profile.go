@@ -60,7 +60,7 @@ func FetchAndAnalyzeProfileData(ctx context.Context, request mcp.CallToolRequest
 	}
 
 	// 获取profile数据
-	profileData, err := getProfileData(commitID, startTime, endTime)
+	profileData, err := getProfileData(ctx, commitID, startTime, endTime)
 	if err != nil {
 		return nil, fmt.Errorf(translation("获取profile数据失败")+": %w", err)
 	}
@@ -136,7 +136,7 @@ func getDefaultTimeRange() (int64, int64) {
 }
 
 // getProfileData 获取profile数据
-func getProfileData(commitID string, startTime, endTime int64) (*model.ProfileData, error) {
+func getProfileData(ctx context.Context, commitID string, startTime, endTime int64) (*model.ProfileData, error) {
 	if err := validateCommitID(commitID); err != nil {
 		return nil, fmt.Errorf(translation("commit ID 验证失败")+": %w", err)
 	}
@@ -157,7 +157,7 @@ func getProfileData(commitID string, startTime, endTime int64) (*model.ProfileDa
 	log.Debugf("profile tracing request: %#v", apiTemplate)
 
 	profileURL := fmt.Sprintf(common.PROFILE_API_URL_FORMAT, config.MConfig.QuerierPort)
-	respJson, err := ccommon.CURLPerform("POST", profileURL, apiTemplate)
+	respJson, err := ccommon.CURLPerform("POST", profileURL, apiTemplate, authOptions(ctx)...)
 	if err != nil {
 		log.Errorf("获取profile数据失败: %v", err)
 		return nil, err
@@ -534,7 +534,7 @@ func generateFunctionMermaidDiagram(profileData *model.ProfileData) string {
 	}
 
 	// 添加统计信息
-	builder.WriteString(fmt.Sprintf("\n    info[\"%s\"]\n", translation("显示了 %d 个函数，%d 条调用关系"), len(functionInfos), relationCount))
+	builder.WriteString(fmt.Sprintf("\n    info[\"%s\"]\n", fmt.Sprintf(translation("显示了 %d 个函数，%d 条调用关系"), len(functionInfos), relationCount)))
 	builder.WriteString("    style info fill:#e1f5fe,stroke:#01579b\n")
 
 	builder.WriteString("```\n")
@@ -0,0 +1,231 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package handle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitly/go-simplejson"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	ccommon "github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/mcp/common"
+	"github.com/deepflowio/deepflow/server/mcp/config"
+)
+
+// PromQLQuery 执行 PromQL 瞬时查询
+func PromQLQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	options, err := orgOptions(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	query, err := validatePromQL(request.GetString("query", ""))
+	if err != nil {
+		return nil, err
+	}
+	queryTime, err := parseTimeToUnix(request.GetString("time", "0"))
+	if err != nil {
+		return nil, fmt.Errorf(translation("无法解析时间格式")+": %w", err)
+	}
+	if queryTime == 0 {
+		queryTime = time.Now().Unix()
+	}
+
+	values := url.Values{}
+	values.Set("query", query)
+	values.Set("time", strconv.FormatInt(queryTime, 10))
+	return promRequest(common.PROM_QUERY_API_URL_FORMAT, query, values, options)
+}
+
+// PromQLRangeQuery 执行 PromQL 区间查询，未指定 step 时按 MAX_PROM_POINTS 个点自动计算
+func PromQLRangeQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	options, err := orgOptions(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	query, err := validatePromQL(request.GetString("query", ""))
+	if err != nil {
+		return nil, err
+	}
+	startTime, endTime, err := parseTimeRange(request, common.DEFAULT_TIME_RANGE_MINUTES)
+	if err != nil {
+		return nil, err
+	}
+	step := int64(math.Max(1, math.Ceil(float64(endTime-startTime)/common.MAX_PROM_POINTS)))
+	if stepStr := request.GetString("step", ""); stepStr != "" {
+		duration, err := time.ParseDuration(stepStr)
+		if err != nil {
+			seconds, convErr := strconv.ParseInt(stepStr, 10, 64)
+			if convErr != nil {
+				return nil, fmt.Errorf(translation("step 不合法")+": %s", stepStr)
+			}
+			duration = time.Duration(seconds) * time.Second
+		}
+		if duration < time.Second {
+			return nil, fmt.Errorf(translation("step 不合法")+": %s", stepStr)
+		}
+		step = int64(duration / time.Second)
+	}
+
+	values := url.Values{}
+	values.Set("query", query)
+	values.Set("start", strconv.FormatInt(startTime, 10))
+	values.Set("end", strconv.FormatInt(endTime, 10))
+	values.Set("step", strconv.FormatInt(step, 10))
+	return promRequest(common.PROM_QUERY_RANGE_API_URL_FORMAT, query, values, options)
+}
+
+func validatePromQL(query string) (string, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return "", errors.New(translation("query 参数不能为空"))
+	}
+	if len(query) > common.MAX_PROMQL_LENGTH {
+		return "", fmt.Errorf(translation("PromQL 长度超过限制")+" (%d)", common.MAX_PROMQL_LENGTH)
+	}
+	return query, nil
+}
+
+func promRequest(urlFormat, query string, values url.Values, options []ccommon.HeaderOption) (*mcp.CallToolResult, error) {
+	log.Debugf("promql request: %+v", values)
+	promURL := fmt.Sprintf(urlFormat, config.MConfig.QuerierPort)
+	respJson, err := ccommon.CURLForm("POST", promURL, values, options...)
+	if err != nil {
+		log.Errorf("promql request failed: %v", err)
+		return nil, fmt.Errorf(translation("查询失败")+": %w", err)
+	}
+
+	var report strings.Builder
+	report.WriteString(fmt.Sprintf("# %s\n\n", translation("查询结果")))
+	report.WriteString(fmt.Sprintf("**PromQL**: `%s`\n\n", query))
+	formatPromData(&report, respJson.Get("data"))
+	return mcp.NewToolResultText(truncateText(report.String())), nil
+}
+
+// formatPromData 按 resultType 格式化 Prometheus 查询结果
+func formatPromData(report *strings.Builder, data *simplejson.Json) {
+	result := data.Get("result")
+	switch data.Get("resultType").MustString() {
+	case "scalar", "string":
+		report.WriteString(fmt.Sprintf("%s: %s\n", translation("值"), promSampleValue(result)))
+		return
+	case "vector":
+		series := result.MustArray()
+		if len(series) == 0 {
+			report.WriteString(translation("无数据") + "\n")
+			return
+		}
+		report.WriteString(fmt.Sprintf("| Series | %s |\n|---|---|\n", translation("值")))
+		for i := range series {
+			if i >= common.MAX_PROM_SERIES {
+				break
+			}
+			item := result.GetIndex(i)
+			report.WriteString(fmt.Sprintf("| %s | %s |\n", formatCell(promSeriesName(item.Get("metric"))), promSampleValue(item.Get("value"))))
+		}
+		writeSeriesTruncation(report, len(series))
+	case "matrix":
+		series := result.MustArray()
+		if len(series) == 0 {
+			report.WriteString(translation("无数据") + "\n")
+			return
+		}
+		for i := range series {
+			if i >= common.MAX_PROM_SERIES {
+				break
+			}
+			item := result.GetIndex(i)
+			formatPromMatrixSeries(report, promSeriesName(item.Get("metric")), item.Get("values"))
+		}
+		writeSeriesTruncation(report, len(series))
+	default:
+		report.WriteString(translation("无数据") + "\n")
+	}
+}
+
+// formatPromMatrixSeries 输出一条序列的统计值和最近 MAX_PROM_POINTS 个点
+func formatPromMatrixSeries(report *strings.Builder, name string, points *simplejson.Json) {
+	count := len(points.MustArray())
+	report.WriteString(fmt.Sprintf("## %s\n\n", name))
+	if count == 0 {
+		report.WriteString(translation("无数据") + "\n\n")
+		return
+	}
+	minValue, maxValue := math.Inf(1), math.Inf(-1)
+	for i := 0; i < count; i++ {
+		if v, err := strconv.ParseFloat(points.GetIndex(i).GetIndex(1).MustString(), 64); err == nil {
+			minValue = math.Min(minValue, v)
+			maxValue = math.Max(maxValue, v)
+		}
+	}
+	report.WriteString(fmt.Sprintf("%s: %d, %s: %g, %s: %g, %s: %s\n\n",
+		translation("点数"), count, translation("最小值"), minValue, translation("最大值"), maxValue,
+		translation("最新值"), promSampleValue(points.GetIndex(count-1))))
+
+	report.WriteString(fmt.Sprintf("| %s | %s |\n|---|---|\n", translation("时间"), translation("值")))
+	start := 0
+	if count > common.MAX_PROM_POINTS {
+		start = count - common.MAX_PROM_POINTS
+	}
+	for i := start; i < count; i++ {
+		point := points.GetIndex(i)
+		timestamp, _ := convertToFloat64(point.GetIndex(0).Interface())
+		report.WriteString(fmt.Sprintf("| %s | %s |\n",
+			time.Unix(int64(timestamp), 0).Format("2006-01-02 15:04:05"), promSampleValue(point)))
+	}
+	if start > 0 {
+		report.WriteString("\n> " + fmt.Sprintf(translation("共 %d 个点，仅显示最后 %d 个"), count, common.MAX_PROM_POINTS) + "\n")
+	}
+	report.WriteString("\n")
+}
+
+func writeSeriesTruncation(report *strings.Builder, count int) {
+	if count > common.MAX_PROM_SERIES {
+		report.WriteString("\n> " + fmt.Sprintf(translation("共 %d 条序列，仅显示前 %d 条"), count, common.MAX_PROM_SERIES) + "\n")
+	}
+}
+
+// promSeriesName 将 metric 标签格式化为 name{k="v",...}
+func promSeriesName(metric *simplejson.Json) string {
+	labels := metric.MustMap()
+	name, _ := labels["__name__"].(string)
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		if k != "__name__" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", k, fmt.Sprintf("%v", labels[k])))
+	}
+	return name + "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// promSampleValue 取 [timestamp, "value"] 中的值
+func promSampleValue(sample *simplejson.Json) string {
+	return sample.GetIndex(1).MustString()
+}
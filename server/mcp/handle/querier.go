@@ -0,0 +1,197 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package handle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	ccommon "github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/libs/auth"
+	"github.com/deepflowio/deepflow/server/mcp/common"
+	"github.com/deepflowio/deepflow/server/mcp/config"
+	"github.com/deepflowio/deepflow/server/mcp/model"
+)
+
+var (
+	orgIDPattern     = regexp.MustCompile(`^[0-9]{1,4}$`)
+	dbNamePattern    = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+	tableNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z0-9_]+)*$`)
+)
+
+// authOptions 透传 mcp 调用方的 Authorization，由 querier 按调用方的身份鉴权
+func authOptions(ctx context.Context) []ccommon.HeaderOption {
+	if header := auth.AuthorizationFromContext(ctx); header != "" {
+		return []ccommon.HeaderOption{ccommon.WithHeader(auth.HEADER_KEY_AUTHORIZATION, header)}
+	}
+	return nil
+}
+
+// orgOptions 将 org_id 参数转换为调用 querier 时携带的 X-Org-Id 请求头，为空时使用 querier 的默认组织
+func orgOptions(ctx context.Context, request mcp.CallToolRequest) ([]ccommon.HeaderOption, error) {
+	options := authOptions(ctx)
+	orgID := strings.TrimSpace(request.GetString("org_id", ""))
+	if orgID == "" {
+		return options, nil
+	}
+	if !orgIDPattern.MatchString(orgID) {
+		return nil, errors.New(translation("org_id 不合法"))
+	}
+	return append(options, ccommon.WithORGHeader(orgID)), nil
+}
+
+// parseTimeRange 解析 start_time/end_time 参数，未指定时取最近 defaultMinutes 分钟
+func parseTimeRange(request mcp.CallToolRequest, defaultMinutes int64) (int64, int64, error) {
+	startTime, err := parseTimeToUnix(request.GetString("start_time", "0"))
+	if err != nil {
+		return 0, 0, fmt.Errorf(translation("解析开始时间失败")+": %w", err)
+	}
+	endTime, err := parseTimeToUnix(request.GetString("end_time", "0"))
+	if err != nil {
+		return 0, 0, fmt.Errorf(translation("解析结束时间失败")+": %w", err)
+	}
+	if endTime == 0 {
+		endTime = time.Now().Unix()
+	}
+	if startTime == 0 {
+		startTime = endTime - defaultMinutes*60
+	}
+	if startTime > endTime {
+		return 0, 0, errors.New(translation("开始时间不能晚于结束时间"))
+	}
+	return startTime, endTime, nil
+}
+
+// parseLimit 解析 limit 参数并校验范围
+func parseLimit(request mcp.CallToolRequest, defaultLimit, maxLimit int) (int, error) {
+	limit := request.GetInt("limit", defaultLimit)
+	if limit < 1 || limit > maxLimit {
+		return 0, fmt.Errorf(translation("limit 超出范围")+" [1, %d]", maxLimit)
+	}
+	return limit, nil
+}
+
+func validateDBName(db string) error {
+	if !dbNamePattern.MatchString(db) {
+		return fmt.Errorf(translation("数据库名称不合法")+": %s", db)
+	}
+	return nil
+}
+
+func validateTableName(table string) error {
+	if !tableNamePattern.MatchString(table) {
+		return fmt.Errorf(translation("表名不合法")+": %s", table)
+	}
+	return nil
+}
+
+// querySQL 调用 querier SQL API，返回 result 中的 columns 和 values
+func querySQL(db, sql string, options []ccommon.HeaderOption) (model.DataFrame, error) {
+	values := url.Values{}
+	values.Set("db", db)
+	values.Set("sql", sql)
+	log.Debugf("querier sql request: db=%s, sql=%s", db, sql)
+
+	queryURL := fmt.Sprintf(common.QUERIER_SQL_API_URL_FORMAT, config.MConfig.QuerierPort)
+	respJson, err := ccommon.CURLForm("POST", queryURL, values, options...)
+	if err != nil {
+		log.Errorf("querier sql request failed: %v", err)
+		return model.DataFrame{}, err
+	}
+	return parseDataFrame(respJson.Get("result")), nil
+}
+
+// selectColumns 仅保留指定的列，用于裁剪 show 语句返回的大量描述列，缺失的列填充为空
+func selectColumns(df model.DataFrame, columns ...string) model.DataFrame {
+	indexes := make([]int, len(columns))
+	for i, column := range columns {
+		indexes[i] = -1
+		for j, c := range df.Columns {
+			if c == column {
+				indexes[i] = j
+				break
+			}
+		}
+	}
+	result := model.DataFrame{Columns: columns, Values: make([][]interface{}, 0, len(df.Values))}
+	for _, row := range df.Values {
+		newRow := make([]interface{}, len(indexes))
+		for i, index := range indexes {
+			if index >= 0 && index < len(row) {
+				newRow[i] = row[index]
+			}
+		}
+		result.Values = append(result.Values, newRow)
+	}
+	return result
+}
+
+// formatDataFrame 将查询结果转换为 Markdown 表格，超过 maxRows 的行被截断
+func formatDataFrame(df model.DataFrame, maxRows int) string {
+	if len(df.Values) == 0 {
+		return translation("无数据") + "\n"
+	}
+	var table strings.Builder
+	table.WriteString("| " + strings.Join(df.Columns, " | ") + " |\n")
+	table.WriteString("|" + strings.Repeat("---|", len(df.Columns)) + "\n")
+	for i, row := range df.Values {
+		if i >= maxRows {
+			break
+		}
+		cells := make([]string, len(df.Columns))
+		for j := range cells {
+			if j < len(row) {
+				cells[j] = formatCell(row[j])
+			}
+		}
+		table.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+	if len(df.Values) > maxRows {
+		table.WriteString("\n> " + fmt.Sprintf(translation("结果已截断，共 %d 行，仅显示前 %d 行"), len(df.Values), maxRows) + "\n")
+	}
+	return table.String()
+}
+
+func formatCell(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	cell := fmt.Sprintf("%v", value)
+	cell = strings.ReplaceAll(cell, "|", "\\|")
+	cell = strings.ReplaceAll(cell, "\n", " ")
+	return strings.ReplaceAll(cell, "\r", " ")
+}
+
+// truncateText 限制返回给模型的文本长度，截断时保证 UTF-8 完整
+func truncateText(text string) string {
+	if len(text) <= common.MAX_RESULT_BYTES {
+		return text
+	}
+	end := common.MAX_RESULT_BYTES
+	for end > 0 && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	return text[:end] + "\n\n> " + fmt.Sprintf(translation("结果已截断，超过 %d 字节"), common.MAX_RESULT_BYTES) + "\n"
+}
@@ -0,0 +1,178 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package handle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/xwb1989/sqlparser"
+
+	ccommon "github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/mcp/common"
+	"github.com/deepflowio/deepflow/server/mcp/model"
+)
+
+var (
+	readOnlySQLPattern = regexp.MustCompile(`(?is)^(select|show)\s`)
+	selectSQLPattern   = regexp.MustCompile(`(?is)^select\s`)
+)
+
+// QuerySQL 执行只读的 querier SQL，未指定顶层 LIMIT 的 SELECT 语句自动追加 LIMIT
+func QuerySQL(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	options, err := orgOptions(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	db := request.GetString("db", common.DEFAULT_QUERY_DB)
+	if err := validateDBName(db); err != nil {
+		return nil, err
+	}
+	sql, err := validateSQL(request.GetString("sql", ""))
+	if err != nil {
+		return nil, err
+	}
+	if sql, err = limitSQL(sql); err != nil {
+		return nil, err
+	}
+	return executeAndFormat(db, sql, options)
+}
+
+// limitSQL 解析 SELECT 语句，顶层未指定 LIMIT 时追加 LIMIT，子查询和字符串中的 LIMIT 不算
+func limitSQL(sql string) (string, error) {
+	if !selectSQLPattern.MatchString(sql) {
+		return sql, nil
+	}
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		return "", fmt.Errorf(translation("SQL 解析失败")+": %w", err)
+	}
+	switch stmt := stmt.(type) {
+	case *sqlparser.Select:
+		if stmt.Limit != nil {
+			return sql, nil
+		}
+	case *sqlparser.Union:
+		if stmt.Limit != nil {
+			return sql, nil
+		}
+	default:
+		return "", errors.New(translation("仅支持 SELECT 和 SHOW 语句"))
+	}
+	return fmt.Sprintf("%s LIMIT %d", sql, common.MAX_RESULT_ROWS+1), nil
+}
+
+// ShowTables 列出数据库中的表
+func ShowTables(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	options, err := orgOptions(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	db := request.GetString("db", common.DEFAULT_QUERY_DB)
+	if err := validateDBName(db); err != nil {
+		return nil, err
+	}
+	return executeAndFormat(db, "show tables", options)
+}
+
+// ShowTags 列出表中可查询的 tag（维度）
+func ShowTags(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return showTableSchema(ctx, request, "show tags from %s", "name", "client_name", "server_name", "type", "category", "description")
+}
+
+// ShowMetrics 列出表中可查询的 metric（指标）
+func ShowMetrics(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return showTableSchema(ctx, request, "show metrics from %s", "name", "unit", "type", "category", "description")
+}
+
+func showTableSchema(ctx context.Context, request mcp.CallToolRequest, sqlFormat string, columns ...string) (*mcp.CallToolResult, error) {
+	options, err := orgOptions(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	db := request.GetString("db", common.DEFAULT_QUERY_DB)
+	if err := validateDBName(db); err != nil {
+		return nil, err
+	}
+	table := request.GetString("table", "")
+	if err := validateTableName(table); err != nil {
+		return nil, err
+	}
+	sql := fmt.Sprintf(sqlFormat, table)
+	df, err := querySQL(db, sql, options)
+	if err != nil {
+		return nil, fmt.Errorf(translation("查询失败")+": %w", err)
+	}
+	// show 语句返回的描述列很多，仅保留对理解 schema 有用的列，且不按行数截断
+	return mcp.NewToolResultText(formatQueryReport(db, sql, selectColumns(df, columns...), len(df.Values))), nil
+}
+
+func executeAndFormat(db, sql string, options []ccommon.HeaderOption) (*mcp.CallToolResult, error) {
+	df, err := querySQL(db, sql, options)
+	if err != nil {
+		return nil, fmt.Errorf(translation("查询失败")+": %w", err)
+	}
+	return mcp.NewToolResultText(formatQueryReport(db, sql, df, common.MAX_RESULT_ROWS)), nil
+}
+
+func formatQueryReport(db, sql string, df model.DataFrame, maxRows int) string {
+	var report strings.Builder
+	report.WriteString(fmt.Sprintf("# %s\n\n", translation("查询结果")))
+	report.WriteString(fmt.Sprintf("**DB**: %s\n", db))
+	report.WriteString(fmt.Sprintf("**SQL**: `%s`\n\n", sql))
+	report.WriteString(formatDataFrame(df, maxRows))
+	return truncateText(report.String())
+}
+
+// validateSQL 仅允许单条 SELECT/SHOW 语句
+func validateSQL(sql string) (string, error) {
+	sql = strings.TrimSuffix(strings.TrimSpace(sql), ";")
+	if sql == "" {
+		return "", errors.New(translation("sql 参数不能为空"))
+	}
+	if len(sql) > common.MAX_SQL_LENGTH {
+		return "", fmt.Errorf(translation("sql 长度超过限制")+" (%d)", common.MAX_SQL_LENGTH)
+	}
+	if hasMultipleStatements(sql) {
+		return "", errors.New(translation("不支持多条语句"))
+	}
+	if !readOnlySQLPattern.MatchString(sql) {
+		return "", errors.New(translation("仅支持 SELECT 和 SHOW 语句"))
+	}
+	return sql, nil
+}
+
+// hasMultipleStatements 使用 sqlparser 的词法分析查找语句分隔符，忽略字符串常量、标识符和注释中的 ;
+// 词法分析失败时无法判断 ; 的位置，只要包含 ; 即视为多条语句
+func hasMultipleStatements(sql string) bool {
+	tokenizer := sqlparser.NewStringTokenizer(sql)
+	for {
+		typ, _ := tokenizer.Scan()
+		switch typ {
+		case 0:
+			return false
+		case ';':
+			return true
+		case sqlparser.LEX_ERROR:
+			return strings.Contains(sql, ";")
+		}
+	}
+}
@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package handle
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	ccommon "github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/mcp/common"
+	"github.com/deepflowio/deepflow/server/mcp/config"
+)
+
+// newTestQuerier 启动模拟的 querier，记录收到的请求并返回 response
+func newTestQuerier(t *testing.T, response string) *[]*http.Request {
+	requests := []*http.Request{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		requests = append(requests, r)
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	serverURL, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(serverURL.Port())
+	mConfig := config.MConfig
+	config.MConfig = &config.MCPConfig{QuerierPort: port, QuerierLanguage: "en"}
+	t.Cleanup(func() { config.MConfig = mConfig })
+	return &requests
+}
+
+func newToolRequest(arguments map[string]any) mcp.CallToolRequest {
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = arguments
+	return request
+}
+
+func resultText(t *testing.T, result *mcp.CallToolResult) string {
+	if result == nil || len(result.Content) != 1 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	return result.Content[0].(mcp.TextContent).Text
+}
+
+func TestLimitSQL(t *testing.T) {
+	limit := " LIMIT " + strconv.Itoa(common.MAX_RESULT_ROWS+1)
+	var cases = []struct {
+		input  string
+		output string
+	}{{
+		input:  "SELECT a FROM t",
+		output: "SELECT a FROM t" + limit,
+	}, {
+		input:  "select a from t limit 10",
+		output: "select a from t limit 10",
+	}, {
+		input:  "SELECT a FROM (SELECT a FROM t LIMIT 10000) AS s WHERE b='limit 5'",
+		output: "SELECT a FROM (SELECT a FROM t LIMIT 10000) AS s WHERE b='limit 5'" + limit,
+	}, {
+		input:  "SELECT a FROM t1 UNION ALL SELECT a FROM t2",
+		output: "SELECT a FROM t1 UNION ALL SELECT a FROM t2" + limit,
+	}, {
+		input:  "show tables",
+		output: "show tables",
+	}}
+	for _, c := range cases {
+		output, err := limitSQL(c.input)
+		if err != nil || output != c.output {
+			t.Errorf("\nInput: %s\nExpect: %s\nActual: %s %v", c.input, c.output, output, err)
+		}
+	}
+	if _, err := limitSQL("SELECT a FROM"); err == nil {
+		t.Error("invalid sql should fail")
+	}
+}
+
+func TestValidateSQL(t *testing.T) {
+	var cases = []struct {
+		input  string
+		output string
+		fail   bool
+	}{
+		{input: "SELECT a FROM t WHERE x = 'a;b';", output: "SELECT a FROM t WHERE x = 'a;b'"},
+		{input: "SELECT `a;b` FROM t /* ; */", output: "SELECT `a;b` FROM t /* ; */"},
+		{input: "SELECT 1; SELECT 2", fail: true},
+		{input: "SELECT 1;;", fail: true},
+		{input: "SELECT 'a;b", fail: true},
+		{input: "DROP TABLE t", fail: true},
+		{input: " ; ", fail: true},
+	}
+	for _, c := range cases {
+		output, err := validateSQL(c.input)
+		if c.fail != (err != nil) || output != c.output {
+			t.Errorf("\nInput: %s\nExpect: %s %t\nActual: %s %v", c.input, c.output, c.fail, output, err)
+		}
+	}
+}
+
+func TestQuerySQL(t *testing.T) {
+	requests := newTestQuerier(t, `{"OPT_STATUS": "SUCCESS", "result": {"columns": ["a", "b"], "values": [[1, "x|y"], [2, null]]}}`)
+	result, err := QuerySQL(context.Background(), newToolRequest(map[string]any{
+		"db": "flow_metrics", "sql": "SELECT a, b FROM (SELECT a, b FROM t LIMIT 10) AS s;", "org_id": "2",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("unexpected requests %d", len(*requests))
+	}
+	r := (*requests)[0]
+	expectSQL := "SELECT a, b FROM (SELECT a, b FROM t LIMIT 10) AS s LIMIT " + strconv.Itoa(common.MAX_RESULT_ROWS+1)
+	if r.PostForm.Get("db") != "flow_metrics" || r.PostForm.Get("sql") != expectSQL || r.Header.Get(ccommon.HEADER_KEY_X_ORG_ID) != "2" {
+		t.Errorf("unexpected request %v %v", r.PostForm, r.Header)
+	}
+	text := resultText(t, result)
+	if !strings.Contains(text, "| a | b |\n|---|---|\n| 1 | x\\|y |\n| 2 |  |\n") {
+		t.Errorf("unexpected report:\n%s", text)
+	}
+
+	for _, arguments := range []map[string]any{
+		{"sql": "DROP TABLE t"},
+		{"sql": "SELECT 1; SELECT 2"},
+		{"sql": "SELECT 1", "db": "flow_log; drop"},
+		{"sql": "SELECT 1", "org_id": "a"},
+	} {
+		if _, err := QuerySQL(context.Background(), newToolRequest(arguments)); err == nil {
+			t.Errorf("query %v should fail", arguments)
+		}
+	}
+	if len(*requests) != 1 {
+		t.Errorf("invalid queries should not be sent to querier")
+	}
+}
+
+func TestPromQLRangeQuery(t *testing.T) {
+	requests := newTestQuerier(t, `{"status": "success", "data": {"resultType": "matrix", "result": [
+		{"metric": {"__name__": "up", "job": "a"}, "values": [[1700000000, "1"], [1700000060, "3"]]}
+	]}}`)
+	result, err := PromQLRangeQuery(context.Background(), newToolRequest(map[string]any{
+		"query": "up", "start_time": "1700000000", "end_time": "1700003600",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 未指定 step 时按 MAX_PROM_POINTS 个点计算
+	form := (*requests)[0].PostForm
+	if form.Get("start") != "1700000000" || form.Get("end") != "1700003600" || form.Get("step") != "60" {
+		t.Errorf("unexpected request %v", form)
+	}
+	text := resultText(t, result)
+	if !strings.Contains(text, `## up{job="a"}`) || !strings.Contains(text, "Points: 2, Min: 1, Max: 3, Last: 3") {
+		t.Errorf("unexpected report:\n%s", text)
+	}
+
+	if _, err := PromQLRangeQuery(context.Background(), newToolRequest(map[string]any{"query": "up", "step": "0.5s"})); err == nil {
+		t.Error("step less than 1s should fail")
+	}
+}
+
+func TestGetTrace(t *testing.T) {
+	requests := newTestQuerier(t, `{"OPT_STATUS": "SUCCESS", "result": {
+		"columns": ["start_time", "response_duration", "app_service", "endpoint", "response_status", "response_code", "span_id", "parent_span_id"],
+		"values": [
+			["t0", 2000, "a", "GET /", "Success", 200, "s1", ""],
+			["t1", 500, "b", "GET /b", "Server Error", 500, "s2", "s1"]
+		]}}`)
+	result, err := GetTrace(context.Background(), newToolRequest(map[string]any{"trace_id": "abc'1", "start_time": "1700000000"}))
+	if err == nil {
+		t.Fatal("trace_id with quote should fail")
+	}
+	result, err = GetTrace(context.Background(), newToolRequest(map[string]any{
+		"trace_id": "abc-1", "start_time": "1700000000", "end_time": "1700003600",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sql := (*requests)[0].PostForm.Get("sql"); !strings.Contains(sql, "trace_id='abc-1' AND time>=1700000000 AND time<=1700003600") {
+		t.Errorf("unexpected sql %s", sql)
+	}
+	text := resultText(t, result)
+	if !strings.Contains(text, "| t1 | b | ── GET /b |") || !strings.Contains(text, "Server Error (500)") {
+		t.Errorf("unexpected report:\n%s", text)
+	}
+}
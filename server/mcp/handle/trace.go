@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package handle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/deepflowio/deepflow/server/mcp/common"
+	"github.com/deepflowio/deepflow/server/mcp/model"
+	querier_common "github.com/deepflowio/deepflow/server/querier/common"
+)
+
+var (
+	traceIDPattern     = regexp.MustCompile(`^[a-zA-Z0-9_.:-]+$`)
+	serviceNamePattern = regexp.MustCompile(`^[^'"\\\x00-\x1f]+$`)
+)
+
+// GetTrace 按 trace_id 查询完整的分布式调用链，按 parent_span_id 缩进展示调用层级
+func GetTrace(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	options, err := orgOptions(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	traceID := strings.TrimSpace(request.GetString("trace_id", ""))
+	if traceID == "" {
+		return nil, errors.New(translation("trace_id 参数不能为空"))
+	}
+	if len(traceID) > common.MAX_TRACE_ID_LENGTH || !traceIDPattern.MatchString(traceID) {
+		return nil, errors.New(translation("trace_id 包含异常字符"))
+	}
+	startTime, endTime, err := parseTimeRange(request, common.DEFAULT_TRACE_RANGE_MINUTES)
+	if err != nil {
+		return nil, err
+	}
+
+	sql := fmt.Sprintf("SELECT start_time, response_duration, app_service, auto_service_0, auto_service_1, endpoint, request_resource, "+
+		"l7_protocol_str, Enum(observation_point) AS observation_point, Enum(response_status) AS response_status, response_code, "+
+		"span_id, parent_span_id FROM l7_flow_log WHERE trace_id=%s AND time>=%d AND time<=%d ORDER BY start_time LIMIT %d",
+		querier_common.QuoteString(traceID), startTime, endTime, common.MAX_TRACE_SPANS+1)
+	df, err := querySQL("flow_log", sql, options)
+	if err != nil {
+		return nil, fmt.Errorf(translation("查询失败")+": %w", err)
+	}
+
+	var report strings.Builder
+	report.WriteString(fmt.Sprintf("# %s\n\n", translation("调用链")))
+	report.WriteString(fmt.Sprintf("**Trace ID**: %s\n", traceID))
+	report.WriteString(fmt.Sprintf(translation("共 %d 个 span")+"\n\n", len(df.Values)))
+	report.WriteString(formatDataFrame(traceSpanTable(df), common.MAX_TRACE_SPANS))
+	return mcp.NewToolResultText(truncateText(report.String())), nil
+}
+
+// traceSpanTable 将 l7_flow_log 的行整理为调用链表格，endpoint 列按 span 深度加前缀
+func traceSpanTable(df model.DataFrame) model.DataFrame {
+	index := make(map[string]int, len(df.Columns))
+	for i, column := range df.Columns {
+		index[column] = i
+	}
+	get := func(row []interface{}, column string) string {
+		if i, ok := index[column]; ok && i < len(row) && row[i] != nil {
+			return fmt.Sprintf("%v", row[i])
+		}
+		return ""
+	}
+
+	parents := make(map[string]string, len(df.Values))
+	for _, row := range df.Values {
+		if spanID := get(row, "span_id"); spanID != "" {
+			parents[spanID] = get(row, "parent_span_id")
+		}
+	}
+	depth := func(spanID string) int {
+		d := 0
+		// 限制遍历深度，避免异常数据形成环
+		for parent := parents[spanID]; parent != "" && d < len(parents); parent = parents[parent] {
+			if _, ok := parents[parent]; !ok {
+				break
+			}
+			d++
+		}
+		return d
+	}
+
+	table := model.DataFrame{
+		Columns: []string{translation("时间"), translation("服务"), translation("端点"), translation("协议"),
+			translation("观测点"), translation("状态"), translation("时延"), "span_id", "parent_span_id"},
+	}
+	for _, row := range df.Values {
+		service := get(row, "app_service")
+		if service == "" {
+			service = get(row, "auto_service_1")
+		}
+		if service == "" {
+			service = get(row, "auto_service_0")
+		}
+		endpoint := get(row, "endpoint")
+		if endpoint == "" {
+			endpoint = get(row, "request_resource")
+		}
+		status := get(row, "response_status")
+		if code := get(row, "response_code"); code != "" {
+			status = fmt.Sprintf("%s (%s)", status, code)
+		}
+		duration, _ := convertToFloat64(get(row, "response_duration"))
+		spanID := get(row, "span_id")
+		if d := depth(spanID); d > 0 {
+			endpoint = strings.Repeat("─", d*2) + " " + endpoint
+		}
+		table.Values = append(table.Values, []interface{}{
+			get(row, "start_time"), service, endpoint, get(row, "l7_protocol_str"),
+			get(row, "observation_point"), status, formatDuration(duration), spanID, get(row, "parent_span_id"),
+		})
+	}
+	return table
+}
+
+// TopEndpoints 查询服务端视角下指定服务最慢或错误最多的 N 个端点
+func TopEndpoints(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	options, err := orgOptions(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	service := strings.TrimSpace(request.GetString("service", ""))
+	if service == "" {
+		return nil, errors.New(translation("service 参数不能为空"))
+	}
+	if len(service) > common.MAX_SERVICE_NAME_LENGTH || !serviceNamePattern.MatchString(service) {
+		return nil, errors.New(translation("service 包含异常字符"))
+	}
+	orderBy := request.GetString("order_by", "latency")
+	var title, orderColumn string
+	switch orderBy {
+	case "latency":
+		title, orderColumn = "Top %d 慢端点（按平均时延排序）", "avg_rrt"
+	case "error":
+		title, orderColumn = "Top %d 错误端点（按错误数排序）", "error_count"
+	default:
+		return nil, errors.New(translation("order_by 仅支持 latency 和 error"))
+	}
+	limit, err := parseLimit(request, common.DEFAULT_TOP_ENDPOINTS, common.MAX_TOP_ENDPOINTS)
+	if err != nil {
+		return nil, err
+	}
+	startTime, endTime, err := parseTimeRange(request, common.DEFAULT_TIME_RANGE_MINUTES)
+	if err != nil {
+		return nil, err
+	}
+
+	// role=1 为服务端视角，避免同一请求在客户端和服务端被重复统计
+	sql := fmt.Sprintf("SELECT endpoint, Sum(request) AS request_count, Avg(rrt) AS avg_rrt, Max(rrt_max) AS max_rrt, "+
+		"Sum(error) AS error_count, Avg(error_ratio) AS error_ratio FROM `application.1m` "+
+		"WHERE (app_service=%s OR auto_service=%s) AND role=1 AND time>=%d AND time<=%d "+
+		"GROUP BY endpoint ORDER BY %s DESC LIMIT %d",
+		querier_common.QuoteString(service), querier_common.QuoteString(service), startTime, endTime, orderColumn, limit)
+	df, err := querySQL("flow_metrics", sql, options)
+	if err != nil {
+		return nil, fmt.Errorf(translation("查询失败")+": %w", err)
+	}
+
+	var report strings.Builder
+	report.WriteString(fmt.Sprintf("# "+translation(title)+"\n\n", limit))
+	report.WriteString(fmt.Sprintf("**%s**: %s\n\n", translation("服务"), service))
+	report.WriteString(formatDataFrame(endpointTable(df), limit))
+	return mcp.NewToolResultText(truncateText(report.String())), nil
+}
+
+func endpointTable(df model.DataFrame) model.DataFrame {
+	table := model.DataFrame{
+		Columns: []string{translation("端点"), translation("请求数"), translation("平均时延"), translation("最大时延"),
+			translation("错误数"), translation("错误率")},
+	}
+	df = selectColumns(df, "endpoint", "request_count", "avg_rrt", "max_rrt", "error_count", "error_ratio")
+	for _, row := range df.Values {
+		avgRRT, _ := convertToFloat64(row[2])
+		maxRRT, _ := convertToFloat64(row[3])
+		errorRatio, _ := convertToFloat64(row[5])
+		table.Values = append(table.Values, []interface{}{
+			row[0], row[1], formatDuration(avgRRT), formatDuration(maxRRT), row[4], fmt.Sprintf("%.2f%%", errorRatio),
+		})
+	}
+	return table
+}
@@ -17,13 +17,17 @@
 package mcp
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 
+	"github.com/deepflowio/deepflow/server/libs/auth"
 	"github.com/deepflowio/deepflow/server/libs/logger"
+	"github.com/deepflowio/deepflow/server/mcp/common"
 	"github.com/deepflowio/deepflow/server/mcp/config"
 	"github.com/deepflowio/deepflow/server/mcp/handle"
 )
@@ -32,8 +36,9 @@ var defaultRegion string
 var log = logger.MustGetLogger("mcp")
 
 type MCPServer struct {
-	port   int
-	server *server.MCPServer
+	port           int
+	controllerPort int
+	server         *server.MCPServer
 }
 
 func NewMCPServer(configPath string) *MCPServer {
@@ -57,17 +62,96 @@ func NewMCPServer(configPath string) *MCPServer {
 			mcp.WithString("end_time", mcp.DefaultString("0")),
 		), handle.FetchAndAnalyzeProfileData)
 
+	orgID := mcp.WithString("org_id", mcp.Description("组织 ID，作为 X-Org-Id 请求头传给 querier，为空时使用默认组织"))
+	db := mcp.WithString("db", mcp.DefaultString(common.DEFAULT_QUERY_DB), mcp.Description("数据库名称，如 flow_log、flow_metrics、profile、event、prometheus"))
+	table := mcp.WithString("table", mcp.Required(), mcp.Description("表名，如 l7_flow_log、application.1m，可通过 showTables 获取"))
+	startTime := mcp.WithString("start_time", mcp.DefaultString("0"), mcp.Description("开始时间，支持时间戳、时间字符串或相对时间（如 -1h）"))
+	endTime := mcp.WithString("end_time", mcp.DefaultString("0"), mcp.Description("结束时间，格式同 start_time，为空时取当前时间"))
+
+	mcpServer.AddTool(
+		mcp.NewTool(
+			"showTables",
+			mcp.WithDescription("列出 DeepFlow 数据库中可查询的表"),
+			db, orgID,
+		), handle.ShowTables)
+	mcpServer.AddTool(
+		mcp.NewTool(
+			"showTags",
+			mcp.WithDescription("列出表中可用于 SELECT/WHERE/GROUP BY 的 tag（维度）及其说明"),
+			db, table, orgID,
+		), handle.ShowTags)
+	mcpServer.AddTool(
+		mcp.NewTool(
+			"showMetrics",
+			mcp.WithDescription("列出表中可查询的 metric（指标）及其单位和说明"),
+			db, table, orgID,
+		), handle.ShowMetrics)
+	mcpServer.AddTool(
+		mcp.NewTool(
+			"querySQL",
+			mcp.WithDescription(fmt.Sprintf("执行只读的 DeepFlow querier SQL（仅支持 SELECT 和 SHOW），时间过滤使用 time>=秒级时间戳，未指定 LIMIT 时最多返回 %d 行", common.MAX_RESULT_ROWS)),
+			db,
+			mcp.WithString("sql", mcp.Required(), mcp.Description("querier SQL，表名和字段可通过 showTables/showTags/showMetrics 获取")),
+			orgID,
+		), handle.QuerySQL)
+	mcpServer.AddTool(
+		mcp.NewTool(
+			"promQLQuery",
+			mcp.WithDescription("执行 PromQL 瞬时查询"),
+			mcp.WithString("query", mcp.Required(), mcp.Description("PromQL 表达式")),
+			mcp.WithString("time", mcp.DefaultString("0"), mcp.Description("查询时间，为空时取当前时间")),
+			orgID,
+		), handle.PromQLQuery)
+	mcpServer.AddTool(
+		mcp.NewTool(
+			"promQLRangeQuery",
+			mcp.WithDescription("执行 PromQL 区间查询，默认查询最近5分钟"),
+			mcp.WithString("query", mcp.Required(), mcp.Description("PromQL 表达式")),
+			startTime, endTime,
+			mcp.WithString("step", mcp.Description("步长，如 30s、1m，为空时自动计算")),
+			orgID,
+		), handle.PromQLRangeQuery)
+	mcpServer.AddTool(
+		mcp.NewTool(
+			"getTrace",
+			mcp.WithDescription("按 trace_id 查询完整的分布式调用链，默认查询最近1小时"),
+			mcp.WithString("trace_id", mcp.Required()),
+			startTime, endTime, orgID,
+		), handle.GetTrace)
+	mcpServer.AddTool(
+		mcp.NewTool(
+			"topEndpoints",
+			mcp.WithDescription("查询服务最慢或错误最多的 Top N 端点，默认查询最近5分钟"),
+			mcp.WithString("service", mcp.Required(), mcp.Description("服务名，匹配 app_service 或 auto_service")),
+			mcp.WithString("order_by", mcp.DefaultString("latency"), mcp.Enum("latency", "error"), mcp.Description("latency 按平均时延排序，error 按错误数排序")),
+			mcp.WithNumber("limit", mcp.DefaultNumber(common.DEFAULT_TOP_ENDPOINTS), mcp.Max(common.MAX_TOP_ENDPOINTS)),
+			startTime, endTime, orgID,
+		), handle.TopEndpoints)
+
 	return &MCPServer{
-		port:   cfg.MCPConfig.ListenPort,
-		server: mcpServer,
+		port:           cfg.MCPConfig.ListenPort,
+		controllerPort: cfg.MCPConfig.ControllerPort,
+		server:         mcpServer,
 	}
 }
 
 func (s *MCPServer) Start() {
 	log.Info("==================== Launching DeepFlow MCP Server ====================")
 
-	httpServer := server.NewStreamableHTTPServer(s.server)
-	if err := httpServer.Start(fmt.Sprintf(":%d", s.port)); err != nil {
+	// 调用方的 Authorization 保存在 context 中，tool 调用 querier 时透传，由 querier 按调用方的身份鉴权
+	httpServer := server.NewStreamableHTTPServer(
+		s.server,
+		server.WithHTTPContextFunc(func(ctx context.Context, r *http.Request) context.Context {
+			return auth.WithAuthorization(ctx, r)
+		}),
+	)
+	authenticator := auth.NewAuthenticator(
+		auth.NewRemoteTokenStore(s.controllerPort),
+		[]auth.RouteRule{{PathPrefix: "/", ReadRole: auth.ROLE_VIEWER, WriteRole: auth.ROLE_VIEWER}},
+	)
+	mux := http.NewServeMux()
+	mux.Handle(common.MCP_ENDPOINT_PATH, authenticator.HTTPMiddleware(httpServer))
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", s.port), mux); err != nil {
 		log.Errorf("failed to start mcp server: %s", err.Error())
 		os.Exit(1)
 	}
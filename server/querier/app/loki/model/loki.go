@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	RESULT_TYPE_STREAMS = "streams"
+	RESULT_TYPE_MATRIX  = "matrix"
+	RESULT_TYPE_VECTOR  = "vector"
+
+	DIRECTION_BACKWARD = "backward"
+	DIRECTION_FORWARD  = "forward"
+)
+
+type LokiQueryParams struct {
+	Query     string
+	Matches   []string // series接口的match[]
+	LabelName string
+	Start     time.Time
+	End       time.Time
+	Step      time.Duration
+	Limit     int
+	Direction string
+	Debug     bool
+	OrgID     string
+	Context   context.Context
+}
+
+type LokiResponse struct {
+	Status string      `json:"status"`
+	Data   interface{} `json:"data,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+type LokiQueryData struct {
+	ResultType string                 `json:"resultType"`
+	Result     interface{}            `json:"result"`
+	Stats      map[string]interface{} `json:"stats"`
+}
+
+// Stream 日志流，values中每一项为[纳秒时间戳字符串, 日志内容]
+type Stream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// Series 指标查询的时序，values中每一项为[秒级时间戳, 值字符串]
+type Series struct {
+	Metric map[string]string `json:"metric"`
+	Values [][2]interface{}  `json:"values"`
+}
+
+type Sample struct {
+	Metric map[string]string `json:"metric"`
+	Value  [2]interface{}    `json:"value"`
+}
+
+type TailResponse struct {
+	Streams        []*Stream     `json:"streams"`
+	DroppedEntries []interface{} `json:"dropped_entries"`
+}
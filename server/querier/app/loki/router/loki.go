@@ -0,0 +1,281 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package router
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+
+	"github.com/deepflowio/deepflow/server/querier/app/loki/model"
+	"github.com/deepflowio/deepflow/server/querier/app/loki/service"
+	"github.com/deepflowio/deepflow/server/querier/common"
+)
+
+const (
+	_STATUS_SUCCESS = "success"
+	_STATUS_ERROR   = "error"
+
+	DEFAULT_LIMIT      = 100
+	DEFAULT_LOOKBACK   = time.Hour
+	DEFAULT_MAX_POINTS = 250
+	TAIL_POLL_INTERVAL = time.Second
+	TAIL_MAX_DELAY_FOR = 5 * time.Second
+	TAIL_DEFAULT_LIMIT = 100
+	TAIL_MAX_DURATION  = time.Hour
+)
+
+func lokiResponse(c *gin.Context, data interface{}, err error) {
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.LokiResponse{Status: _STATUS_ERROR, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, model.LokiResponse{Status: _STATUS_SUCCESS, Data: data})
+}
+
+// parseTime 支持纳秒时间戳、浮点秒时间戳及RFC3339格式
+func parseTime(value string, defaultTime time.Time) (time.Time, error) {
+	if value == "" {
+		return defaultTime, nil
+	}
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		// 位数不足纳秒时间戳时按秒处理
+		if i < 1e12 {
+			return time.Unix(i, 0), nil
+		}
+		return time.Unix(0, i), nil
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q to a valid timestamp", value)
+}
+
+// parseStep 支持duration格式及浮点秒
+func parseStep(value string) (time.Duration, error) {
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(f * float64(time.Second)), nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return d, nil
+	}
+	return 0, fmt.Errorf("cannot parse %q to a valid duration", value)
+}
+
+func parseLokiParams(c *gin.Context, args *model.LokiQueryParams) error {
+	var err error
+	args.OrgID = c.Request.Header.Get(common.HEADER_KEY_X_ORG_ID)
+	args.Context = c.Request.Context()
+	args.Query = c.Request.FormValue("query")
+	args.Debug, _ = strconv.ParseBool(c.Request.FormValue("debug"))
+	now := time.Now()
+	if args.End, err = parseTime(c.Request.FormValue("end"), now); err != nil {
+		return err
+	}
+	if args.Start, err = parseTime(c.Request.FormValue("start"), args.End.Add(-DEFAULT_LOOKBACK)); err != nil {
+		return err
+	}
+	if since := c.Request.FormValue("since"); since != "" && c.Request.FormValue("start") == "" {
+		d, err := time.ParseDuration(since)
+		if err != nil {
+			return fmt.Errorf("cannot parse since %q", since)
+		}
+		args.Start = args.End.Add(-d)
+	}
+	args.Limit = DEFAULT_LIMIT
+	if limit := c.Request.FormValue("limit"); limit != "" {
+		if args.Limit, err = strconv.Atoi(limit); err != nil || args.Limit <= 0 {
+			return fmt.Errorf("invalid limit %q", limit)
+		}
+	}
+	args.Direction = model.DIRECTION_BACKWARD
+	if direction := c.Request.FormValue("direction"); direction != "" {
+		if direction != model.DIRECTION_BACKWARD && direction != model.DIRECTION_FORWARD {
+			return fmt.Errorf("invalid direction %q", direction)
+		}
+		args.Direction = direction
+	}
+	// 与loki一致，未指定step时使用max(1s, (end-start)/250)
+	args.Step = args.End.Sub(args.Start) / DEFAULT_MAX_POINTS
+	if args.Step < time.Second {
+		args.Step = time.Second
+	}
+	if step := c.Request.FormValue("step"); step != "" {
+		if args.Step, err = parseStep(step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func lokiQuery() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args := model.LokiQueryParams{}
+		if err := parseLokiParams(c, &args); err != nil {
+			lokiResponse(c, nil, err)
+			return
+		}
+		if t := c.Request.FormValue("time"); t != "" {
+			var err error
+			if args.End, err = parseTime(t, time.Now()); err != nil {
+				lokiResponse(c, nil, err)
+				return
+			}
+			args.Start = args.End.Add(-DEFAULT_LOOKBACK)
+		}
+		data, err := service.Query(&args)
+		lokiResponse(c, data, err)
+	})
+}
+
+func lokiQueryRange() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args := model.LokiQueryParams{}
+		if err := parseLokiParams(c, &args); err != nil {
+			lokiResponse(c, nil, err)
+			return
+		}
+		data, err := service.QueryRange(&args)
+		lokiResponse(c, data, err)
+	})
+}
+
+func lokiLabels() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args := model.LokiQueryParams{}
+		if err := parseLokiParams(c, &args); err != nil {
+			lokiResponse(c, nil, err)
+			return
+		}
+		lokiResponse(c, service.Labels(&args), nil)
+	})
+}
+
+func lokiLabelValues() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args := model.LokiQueryParams{}
+		if err := parseLokiParams(c, &args); err != nil {
+			lokiResponse(c, nil, err)
+			return
+		}
+		args.LabelName = c.Param("labelName")
+		values, err := service.LabelValues(&args)
+		lokiResponse(c, values, err)
+	})
+}
+
+func lokiSeries() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args := model.LokiQueryParams{}
+		if err := parseLokiParams(c, &args); err != nil {
+			lokiResponse(c, nil, err)
+			return
+		}
+		c.Request.ParseForm()
+		args.Matches = c.Request.Form["match[]"]
+		if len(args.Matches) == 0 {
+			lokiResponse(c, nil, fmt.Errorf("at least one match[] argument is required"))
+			return
+		}
+		series, err := service.Series(&args)
+		lokiResponse(c, series, err)
+	})
+}
+
+// checkTailOrigin 浏览器发起的websocket请求需与querier同源，防止跨站劫持；
+// logcli、grafana后端等非浏览器客户端不携带Origin
+func checkTailOrigin(config *websocket.Config, req *http.Request) error {
+	if req.Header.Get("Origin") == "" {
+		return nil
+	}
+	origin, err := websocket.Origin(config, req)
+	if err != nil {
+		return err
+	}
+	if origin == nil || !strings.EqualFold(origin.Host, req.Host) {
+		return fmt.Errorf("origin %s is not allowed", req.Header.Get("Origin"))
+	}
+	config.Origin = origin
+	return nil
+}
+
+// lokiTail 通过websocket推送新日志，每秒轮询一次，delay_for用于等待延迟写入的日志
+func lokiTail() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args := model.LokiQueryParams{}
+		if err := parseLokiParams(c, &args); err != nil {
+			lokiResponse(c, nil, err)
+			return
+		}
+		args.Limit = TAIL_DEFAULT_LIMIT
+		if limit := c.Request.FormValue("limit"); limit != "" {
+			args.Limit, _ = strconv.Atoi(limit)
+		}
+		var delayFor time.Duration
+		if delay := c.Request.FormValue("delay_for"); delay != "" {
+			seconds, err := strconv.Atoi(delay)
+			if err != nil || time.Duration(seconds)*time.Second > TAIL_MAX_DELAY_FOR {
+				lokiResponse(c, nil, fmt.Errorf("delay_for must be an integer no larger than %d", int(TAIL_MAX_DELAY_FOR.Seconds())))
+				return
+			}
+			delayFor = time.Duration(seconds) * time.Second
+		}
+		if c.Request.FormValue("start") == "" {
+			args.Start = time.Now().Add(-delayFor)
+		}
+		server := websocket.Server{
+			Handshake: checkTailOrigin,
+			Handler: func(conn *websocket.Conn) {
+				defer conn.Close()
+				cursor := service.NewTailCursor(args.Start)
+				deadline := time.Now().Add(TAIL_MAX_DURATION)
+				ticker := time.NewTicker(TAIL_POLL_INTERVAL)
+				defer ticker.Stop()
+				for time.Now().Before(deadline) {
+					queryArgs := args
+					queryArgs.End = time.Now().Add(-delayFor)
+					streams, err := service.Tail(&queryArgs, cursor)
+					if err != nil {
+						websocket.Message.Send(conn, err.Error())
+						return
+					}
+					if len(streams) > 0 {
+						if err := websocket.JSON.Send(conn, model.TailResponse{Streams: streams, DroppedEntries: []interface{}{}}); err != nil {
+							return
+						}
+					}
+					select {
+					case <-c.Request.Context().Done():
+						return
+					case <-ticker.C:
+					}
+				}
+			},
+		}
+		server.ServeHTTP(c.Writer, c.Request)
+	})
+}
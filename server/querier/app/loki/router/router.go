@@ -0,0 +1,38 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// LokiRouter 提供兼容loki的LogQL查询接口，数据来源为application_log.log
+func LokiRouter(e *gin.Engine) {
+	lokiGroup := e.Group("/loki/api/v1")
+	{
+		lokiGroup.GET("/query", lokiQuery())
+		lokiGroup.POST("/query", lokiQuery())
+		lokiGroup.GET("/query_range", lokiQueryRange())
+		lokiGroup.POST("/query_range", lokiQueryRange())
+		lokiGroup.GET("/labels", lokiLabels())
+		lokiGroup.POST("/labels", lokiLabels())
+		lokiGroup.GET("/label/:labelName/values", lokiLabelValues())
+		lokiGroup.GET("/series", lokiSeries())
+		lokiGroup.POST("/series", lokiSeries())
+		lokiGroup.GET("/tail", lokiTail())
+	}
+}
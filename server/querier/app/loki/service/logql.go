@@ -0,0 +1,477 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// LogQL语法参考 https://grafana.com/docs/loki/latest/query/
+// 支持的子集：
+//   - 日志流选择：{service_name="a", level=~"error|warn"}
+//   - 行过滤：|= != |~ !~
+//   - 解析器：| json、| logfmt，以及其后的标签过滤 | status >= 500
+//   - 指标查询：rate/count_over_time/bytes_over_time/bytes_rate，外层可使用sum/count/avg/min/max by/without聚合
+
+const (
+	logQLTokenEOF = iota
+	logQLTokenIdent
+	logQLTokenString
+	logQLTokenNumber
+	logQLTokenDuration
+	logQLTokenOp
+)
+
+type logQLToken struct {
+	typ   int
+	value string
+	pos   int
+}
+
+// 按长度降序排列，保证优先匹配双字符运算符
+var LOGQL_OPERATORS = []string{
+	"|=", "|~", "!=", "!~", "=~", "==", ">=", "<=",
+	"{", "}", "(", ")", "[", "]", ",", "|", "=", ">", "<",
+}
+
+var LOGQL_RANGE_FUNCS = []string{"rate", "count_over_time", "bytes_over_time", "bytes_rate"}
+var LOGQL_VECTOR_OPS = []string{"sum", "count", "avg", "min", "max"}
+var LOGQL_PARSERS = []string{"json", "logfmt"}
+var LOGQL_LABEL_FILTER_OPS = map[string]bool{
+	"=": true, "==": true, "!=": true, "=~": true, "!~": true, ">": true, ">=": true, "<": true, "<=": true,
+}
+
+func isLogQLIdentChar(c byte, first bool) bool {
+	if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+		return true
+	}
+	return !first && (c == '.' || (c >= '0' && c <= '9'))
+}
+
+func lexLogQL(query string) ([]logQLToken, error) {
+	tokens := []logQLToken{}
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(query) && query[j] != c; j++ {
+				if c == '"' && query[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(query) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			value := query[i+1 : j]
+			if c == '"' {
+				unquoted, err := strconv.Unquote(query[i : j+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid string %s at position %d", query[i:j+1], i)
+				}
+				value = unquoted
+			}
+			tokens = append(tokens, logQLToken{typ: logQLTokenString, value: value, pos: i})
+			i = j + 1
+		case c >= '0' && c <= '9':
+			j := i + 1
+			for ; j < len(query) && ((query[j] >= '0' && query[j] <= '9') || query[j] == '.' || (query[j] >= 'a' && query[j] <= 'z')); j++ {
+			}
+			value := query[i:j]
+			if _, err := strconv.ParseFloat(value, 64); err == nil {
+				tokens = append(tokens, logQLToken{typ: logQLTokenNumber, value: value, pos: i})
+			} else if _, err := model.ParseDuration(value); err == nil {
+				tokens = append(tokens, logQLToken{typ: logQLTokenDuration, value: value, pos: i})
+			} else if _, err := time.ParseDuration(value); err == nil {
+				tokens = append(tokens, logQLToken{typ: logQLTokenDuration, value: value, pos: i})
+			} else {
+				return nil, fmt.Errorf("invalid number or duration %s at position %d", value, i)
+			}
+			i = j
+		case isLogQLIdentChar(c, true):
+			j := i + 1
+			for ; j < len(query) && isLogQLIdentChar(query[j], false); j++ {
+			}
+			tokens = append(tokens, logQLToken{typ: logQLTokenIdent, value: query[i:j], pos: i})
+			i = j
+		default:
+			matched := false
+			for _, op := range LOGQL_OPERATORS {
+				if strings.HasPrefix(query[i:], op) {
+					tokens = append(tokens, logQLToken{typ: logQLTokenOp, value: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+		}
+	}
+	tokens = append(tokens, logQLToken{typ: logQLTokenEOF, pos: len(query)})
+	return tokens, nil
+}
+
+func parseLogQLDuration(value string) (time.Duration, error) {
+	if d, err := model.ParseDuration(value); err == nil {
+		return time.Duration(d), nil
+	}
+	return time.ParseDuration(value)
+}
+
+type LogQLExpr interface {
+	isExpr()
+}
+
+type LabelMatcher struct {
+	Name  string
+	Op    string // = != =~ !~
+	Value string
+}
+
+type LogQLStage interface {
+	isStage()
+}
+
+// LineFilter 行过滤，Op为|= != |~ !~
+type LineFilter struct {
+	Op    string
+	Value string
+}
+
+// ParserStage | json 或 | logfmt
+type ParserStage struct {
+	Type string
+}
+
+// LabelFilter 标签过滤，数值比较时IsNumber为true，duration的值会转换为秒
+type LabelFilter struct {
+	Name     string
+	Op       string
+	Value    string
+	IsNumber bool
+}
+
+func (s *LineFilter) isStage()  {}
+func (s *ParserStage) isStage() {}
+func (s *LabelFilter) isStage() {}
+
+type LogSelectorExpr struct {
+	Matchers []*LabelMatcher
+	Stages   []LogQLStage
+}
+
+type RangeAggregationExpr struct {
+	Func  string
+	Range time.Duration
+	Log   *LogSelectorExpr
+}
+
+type VectorAggregationExpr struct {
+	Op       string
+	Grouping []string
+	Without  bool
+	Inner    LogQLExpr
+}
+
+func (e *LogSelectorExpr) isExpr()       {}
+func (e *RangeAggregationExpr) isExpr()  {}
+func (e *VectorAggregationExpr) isExpr() {}
+
+// HasParser 是否包含json/logfmt解析器，包含时解析器之后的标签过滤需在查询结果上计算
+func (e *LogSelectorExpr) HasParser() bool {
+	for _, s := range e.Stages {
+		if _, ok := s.(*ParserStage); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type logQLParser struct {
+	tokens []logQLToken
+	pos    int
+}
+
+func (p *logQLParser) peek() logQLToken {
+	return p.tokens[p.pos]
+}
+
+func (p *logQLParser) next() logQLToken {
+	t := p.tokens[p.pos]
+	if t.typ != logQLTokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *logQLParser) isOp(ops ...string) bool {
+	t := p.peek()
+	if t.typ != logQLTokenOp {
+		return false
+	}
+	for _, op := range ops {
+		if t.value == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *logQLParser) isIdent(names ...string) bool {
+	t := p.peek()
+	if t.typ != logQLTokenIdent {
+		return false
+	}
+	for _, name := range names {
+		if t.value == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *logQLParser) expect(op string) error {
+	t := p.next()
+	if t.typ != logQLTokenOp || t.value != op {
+		return p.errorf(t, "expected %s", op)
+	}
+	return nil
+}
+
+func (p *logQLParser) errorf(t logQLToken, format string, a ...interface{}) error {
+	found := t.value
+	if t.typ == logQLTokenEOF {
+		found = "end of query"
+	}
+	return fmt.Errorf("parse error at position %d: %s, found %s", t.pos, fmt.Sprintf(format, a...), found)
+}
+
+func ParseLogQL(query string) (LogQLExpr, error) {
+	tokens, err := lexLogQL(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &logQLParser{tokens: tokens}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.typ != logQLTokenEOF {
+		return nil, p.errorf(t, "unexpected token")
+	}
+	return expr, nil
+}
+
+func (p *logQLParser) parseExpr() (LogQLExpr, error) {
+	switch {
+	case p.isOp("{"):
+		return p.parseLogSelector()
+	case p.isOp("("):
+		p.next()
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	case p.isIdent(LOGQL_RANGE_FUNCS...):
+		return p.parseRangeAggregation()
+	case p.isIdent(LOGQL_VECTOR_OPS...):
+		return p.parseVectorAggregation()
+	}
+	return nil, p.errorf(p.peek(), "expected log selector or aggregation")
+}
+
+func (p *logQLParser) parseGrouping(expr *VectorAggregationExpr) error {
+	expr.Without = p.next().value == "without"
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	for !p.isOp(")") {
+		t := p.next()
+		if t.typ != logQLTokenIdent {
+			return p.errorf(t, "expected label")
+		}
+		expr.Grouping = append(expr.Grouping, t.value)
+		if !p.isOp(")") {
+			if err := p.expect(","); err != nil {
+				return err
+			}
+		}
+	}
+	return p.expect(")")
+}
+
+func (p *logQLParser) parseVectorAggregation() (LogQLExpr, error) {
+	expr := &VectorAggregationExpr{Op: p.next().value}
+	if p.isIdent("by", "without") {
+		if err := p.parseGrouping(expr); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	inner, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := inner.(*LogSelectorExpr); ok {
+		return nil, fmt.Errorf("%s aggregation requires a range aggregation, e.g. %s(rate({...}[1m]))", expr.Op, expr.Op)
+	}
+	expr.Inner = inner
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if expr.Grouping == nil && p.isIdent("by", "without") {
+		if err := p.parseGrouping(expr); err != nil {
+			return nil, err
+		}
+	}
+	return expr, nil
+}
+
+func (p *logQLParser) parseRangeAggregation() (LogQLExpr, error) {
+	expr := &RangeAggregationExpr{Func: p.next().value}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	log, err := p.parseLogSelector()
+	if err != nil {
+		return nil, err
+	}
+	expr.Log = log
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	t := p.next()
+	if t.typ != logQLTokenDuration {
+		return nil, p.errorf(t, "expected range duration")
+	}
+	if expr.Range, err = parseLogQLDuration(t.value); err != nil || expr.Range <= 0 {
+		return nil, p.errorf(t, "invalid range duration")
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	return expr, p.expect(")")
+}
+
+func (p *logQLParser) parseLogSelector() (*LogSelectorExpr, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	expr := &LogSelectorExpr{}
+	for !p.isOp("}") {
+		name := p.next()
+		if name.typ != logQLTokenIdent {
+			return nil, p.errorf(name, "expected label name")
+		}
+		op := p.next()
+		if op.typ != logQLTokenOp || (op.value != "=" && op.value != "!=" && op.value != "=~" && op.value != "!~") {
+			return nil, p.errorf(op, "expected label matcher operator")
+		}
+		value := p.next()
+		if value.typ != logQLTokenString {
+			return nil, p.errorf(value, "expected string")
+		}
+		expr.Matchers = append(expr.Matchers, &LabelMatcher{Name: name.value, Op: op.value, Value: value.value})
+		if !p.isOp("}") {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	p.next()
+	if len(expr.Matchers) == 0 {
+		return nil, fmt.Errorf("stream selector must contain at least one label matcher")
+	}
+	for {
+		switch {
+		case p.isOp("|=", "!=", "|~", "!~"):
+			op := p.next().value
+			value := p.next()
+			if value.typ != logQLTokenString {
+				return nil, p.errorf(value, "expected string")
+			}
+			expr.Stages = append(expr.Stages, &LineFilter{Op: op, Value: value.value})
+		case p.isOp("|"):
+			p.next()
+			if err := p.parseStage(expr); err != nil {
+				return nil, err
+			}
+		default:
+			return expr, nil
+		}
+	}
+}
+
+// parseStage 解析器或以and/,连接的标签过滤
+func (p *logQLParser) parseStage(expr *LogSelectorExpr) error {
+	if p.isIdent(LOGQL_PARSERS...) {
+		expr.Stages = append(expr.Stages, &ParserStage{Type: p.next().value})
+		return nil
+	}
+	for {
+		name := p.next()
+		if name.typ != logQLTokenIdent {
+			return p.errorf(name, "expected parser or label filter")
+		}
+		op := p.next()
+		if op.typ != logQLTokenOp || !LOGQL_LABEL_FILTER_OPS[op.value] {
+			return p.errorf(op, "expected label filter operator")
+		}
+		filter := &LabelFilter{Name: name.value, Op: op.value}
+		if filter.Op == "==" {
+			filter.Op = "="
+		}
+		value := p.next()
+		switch value.typ {
+		case logQLTokenString:
+			filter.Value = value.value
+		case logQLTokenNumber:
+			filter.Value = value.value
+			filter.IsNumber = true
+		case logQLTokenDuration:
+			d, _ := parseLogQLDuration(value.value)
+			filter.Value = strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+			filter.IsNumber = true
+		default:
+			return p.errorf(value, "expected label filter value")
+		}
+		if filter.IsNumber && (filter.Op == "=~" || filter.Op == "!~") {
+			return p.errorf(op, "regex operator requires a string value")
+		}
+		if !filter.IsNumber && filter.Op != "=" && filter.Op != "!=" && filter.Op != "=~" && filter.Op != "!~" {
+			return p.errorf(op, "operator requires a number or duration value")
+		}
+		expr.Stages = append(expr.Stages, filter)
+		if p.isOp(",") || p.isIdent("and") {
+			p.next()
+			continue
+		}
+		return nil
+	}
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deepflowio/deepflow/server/querier/app/loki/model"
+	"github.com/deepflowio/deepflow/server/querier/common"
+)
+
+func TestLogQLToSQL(t *testing.T) {
+	var cases = []struct {
+		input  string
+		output string
+	}{{
+		input:  `{service_name="frontend"}`,
+		output: `app_service='frontend'`,
+	}, {
+		input:  `{namespace=~"prod|test", level!="debug"} |= "GET /api" != "it's"`,
+		output: `pod_ns regexp '^(?:prod|test)$' AND severity_number IN (2,3,4,5,7,8) AND body regexp 'GET /api' AND body not regexp 'it\'s'`,
+	}, {
+		input:  `{level=~"error|fatal", k8s_app="web"} |~ "time(out)?" | status >= 500`,
+		output: "severity_number IN (2,3) AND `attribute.k8s_app`='web' AND body regexp 'time(out)?' AND toFloat64OrNull(`attribute.status`) >= 500",
+	}, {
+		input:  `{pod="a.b"} |= "x.y" | json | status >= 500`,
+		output: `pod='a.b' AND body regexp 'x\\.y'`,
+	}}
+	start, end := time.Unix(1700000000, 0), time.Unix(1700003600, 0)
+	for _, c := range cases {
+		expr, err := ParseLogQL(c.input)
+		if err != nil {
+			t.Errorf("parse %s failed: %v", c.input, err)
+			continue
+		}
+		filters, err := logFilters(expr.(*LogSelectorExpr), start, end)
+		if err != nil {
+			t.Errorf("translate %s failed: %v", c.input, err)
+			continue
+		}
+		actual := strings.Join(filters[2:], " AND ")
+		if actual != c.output {
+			t.Errorf("\nInput: %s\nExpect: %s\nActual: %s", c.input, c.output, actual)
+		}
+	}
+}
+
+func TestParseLogQLError(t *testing.T) {
+	for _, input := range []string{
+		`{}`,
+		`{service_name="a"`,
+		`{service_name="a"} | status =~ 500`,
+		`sum(rate({service_name="a"}))`,
+		`sum({service_name="a"})`,
+		`rate({service_name="a"}[0s])`,
+	} {
+		if _, err := ParseLogQL(input); err == nil {
+			t.Errorf("parse %s should fail", input)
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	expr, _ := ParseLogQL(`{service_name="a"} | logfmt | level_extracted="warn", latency > 100ms |= "slow"`)
+	selector := expr.(*LogSelectorExpr)
+	entry := &logEntry{line: `level=warn msg="slow query" latency=250ms`, labels: map[string]string{"level": "info"}}
+	if !pipeline(selector, entry, `{"host.name":"h1"}`) {
+		t.Errorf("entry should be kept, labels: %v", entry.labels)
+	}
+	if entry.labels["msg"] != "slow query" || entry.labels["host_name"] != "h1" || entry.labels["level"] != "info" {
+		t.Errorf("unexpected labels: %v", entry.labels)
+	}
+	entry = &logEntry{line: `level=warn msg="fast query" latency=50ms`, labels: map[string]string{}}
+	if pipeline(selector, entry, "") {
+		t.Errorf("entry should be dropped")
+	}
+}
+
+func TestMetricQuery(t *testing.T) {
+	var sqls []string
+	executeQuery = func(sql string, args *model.LokiQueryParams) (*common.Result, error) {
+		sqls = append(sqls, sql)
+		return &common.Result{
+			Columns: []interface{}{"time_60", "app_service", "severity_number", "log_count"},
+			Values: []interface{}{
+				[]interface{}{int64(1700000000), "a", 3, int64(6)},
+				[]interface{}{int64(1700000060), "a", 3, int64(12)},
+				[]interface{}{int64(1700000060), "b", 5, int64(30)},
+			},
+		}, nil
+	}
+	args := &model.LokiQueryParams{
+		Query: `sum by (level) (rate({namespace="prod"}[2m]))`,
+		Start: time.Unix(1700000060, 0),
+		End:   time.Unix(1700000180, 0),
+		Step:  time.Minute,
+	}
+	data, err := QueryRange(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sqls) != 1 || !strings.Contains(sqls[0], "time(time, 60) AS time_60") || !strings.Contains(sqls[0], "time>=1699999940") {
+		t.Errorf("unexpected sql: %v", sqls)
+	}
+	matrix := data.Result.([]*model.Series)
+	if len(matrix) != 2 || matrix[0].Metric["level"] != "error" || matrix[1].Metric["level"] != "info" {
+		t.Fatalf("unexpected result: %+v", matrix)
+	}
+	// 1700000120时刻的窗口为(1700000000, 1700000120]，包含两个分组
+	expect := [][2]interface{}{{1700000060.0, "0.05"}, {1700000120.0, "0.15"}, {1700000180.0, "0.1"}}
+	for i, v := range matrix[0].Values {
+		if i >= len(expect) || v != expect[i] {
+			t.Errorf("unexpected values: %v", matrix[0].Values)
+			break
+		}
+	}
+}
+
+// 同一时刻的日志被limit截断时，下次tail应补齐剩余的日志且不重复推送
+func TestTail(t *testing.T) {
+	polls := [][]interface{}{{
+		[]interface{}{int64(1000), "user=bob a", "{}", "a"},
+		[]interface{}{int64(2000), "user=bob b", "{}", "a"},
+		[]interface{}{int64(2000), "user=eve c", "{}", "a"},
+	}, {
+		[]interface{}{int64(2000), "user=bob b", "{}", "a"},
+		[]interface{}{int64(2000), "user=eve c", "{}", "a"},
+		[]interface{}{int64(2000), "user=bob d", "{}", "a"},
+		[]interface{}{int64(3000), "user=bob e", "{}", "a"},
+	}}
+	var sqls []string
+	executeQuery = func(sql string, args *model.LokiQueryParams) (*common.Result, error) {
+		sqls = append(sqls, sql)
+		return &common.Result{
+			Columns: []interface{}{"timestamp_us", "body", "attribute", "app_service"},
+			Values:  polls[len(sqls)-1],
+		}, nil
+	}
+	args := &model.LokiQueryParams{Query: `{service_name="a"} | logfmt | user="bob"`, End: time.Unix(1, 0), Limit: 3}
+	cursor := NewTailCursor(time.Unix(0, 1000000))
+	expect := [][]string{{"user=bob a", "user=bob b"}, {"user=bob d", "user=bob e"}}
+	for i := range polls {
+		streams, err := Tail(args, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := []string{}
+		for _, stream := range streams {
+			for _, v := range stream.Values {
+				lines = append(lines, v[1])
+			}
+		}
+		if strings.Join(lines, ",") != strings.Join(expect[i], ",") {
+			t.Errorf("poll %d expect %v, got %v", i, expect[i], lines)
+		}
+	}
+	if !strings.HasSuffix(sqls[0], "LIMIT 3") || !strings.HasSuffix(sqls[1], "LIMIT 5") {
+		t.Errorf("unexpected sql: %v", sqls)
+	}
+	if cursor.Timestamp != 3000000 {
+		t.Errorf("unexpected cursor %d", cursor.Timestamp)
+	}
+}
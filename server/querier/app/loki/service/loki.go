@@ -0,0 +1,622 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	logging "github.com/op/go-logging"
+
+	"github.com/deepflowio/deepflow/server/querier/app/loki/model"
+	"github.com/deepflowio/deepflow/server/querier/common"
+	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse"
+)
+
+var log = logging.MustGetLogger("loki")
+
+const (
+	LOKI_DB    = "application_log"
+	LOKI_TABLE = "log"
+
+	// 包含解析器或bytes类函数的指标查询需要拉取原始日志计算，限制单次查询的最大日志条数
+	LOKI_METRIC_ROW_LIMIT = 100000
+	// 指标查询的最大点数，与loki的默认max_points一致
+	LOKI_MAX_POINTS   = 11000
+	LOKI_SERIES_LIMIT = 10000
+)
+
+// 日志流标签与application_log.log中列的对应关系，未在此列出的标签对应attribute.<label>
+var LOKI_LABEL_COLUMNS = map[string]string{
+	"service_name":  "app_service",
+	"level":         "severity_number",
+	"namespace":     "pod_ns",
+	"cluster":       "pod_cluster",
+	"node":          "pod_node",
+	"pod":           "pod",
+	"pod_service":   "pod_service",
+	"pod_group":     "pod_group",
+	"chost":         "chost",
+	"auto_instance": "auto_instance",
+	"auto_service":  "auto_service",
+	"agent":         "agent",
+	"trace_id":      "trace_id",
+	"span_id":       "span_id",
+}
+
+// 作为日志流标签返回的列，trace_id/span_id基数过高，仅可用于过滤
+var LOKI_STREAM_LABELS = []string{
+	"service_name", "level", "namespace", "cluster", "node", "pod", "pod_service",
+	"pod_group", "chost", "auto_instance", "auto_service", "agent",
+}
+
+var LOKI_LEVEL_MAP = map[int]string{
+	2: "fatal",
+	3: "error",
+	4: "warn",
+	5: "info",
+	6: "debug",
+	7: "trace",
+	8: "unknown",
+}
+
+var executeQuery = func(sql string, args *model.LokiQueryParams) (*common.Result, error) {
+	querierArgs := common.QuerierParams{
+		DB:         LOKI_DB,
+		Sql:        sql,
+		DataSource: "",
+		Debug:      strconv.FormatBool(args.Debug),
+		QueryUUID:  uuid.New().String(),
+		Context:    args.Context,
+		ORGID:      args.OrgID,
+	}
+	ckEngine := &clickhouse.CHEngine{DB: querierArgs.DB, DataSource: querierArgs.DataSource}
+	ckEngine.Init()
+	result, debug, err := ckEngine.ExecuteQuery(&querierArgs)
+	if err != nil {
+		log.Errorf("%v %v", debug, err)
+	}
+	return result, err
+}
+
+func labelColumn(label string) string {
+	if column, ok := LOKI_LABEL_COLUMNS[label]; ok {
+		return column
+	}
+	return "`attribute." + label + "`"
+}
+
+func levelName(value interface{}) string {
+	var number int
+	switch v := value.(type) {
+	case int:
+		number = v
+	case int64:
+		number = int(v)
+	case uint8:
+		number = int(v)
+	case uint64:
+		number = int(v)
+	case float64:
+		number = int(v)
+	case string:
+		return v
+	default:
+		return ""
+	}
+	if name, ok := LOKI_LEVEL_MAP[number]; ok {
+		return name
+	}
+	return LOKI_LEVEL_MAP[8]
+}
+
+// levelNumbers 返回满足匹配条件的日志级别
+func levelNumbers(op, value string) ([]string, error) {
+	var re *regexp.Regexp
+	if op == "=~" || op == "!~" {
+		var err error
+		if re, err = regexp.Compile("^(?:" + value + ")$"); err != nil {
+			return nil, fmt.Errorf("invalid regex %s: %s", value, err)
+		}
+	}
+	numbers := []string{}
+	for number, name := range LOKI_LEVEL_MAP {
+		var matched bool
+		switch op {
+		case "=":
+			matched = name == value
+		case "!=":
+			matched = name != value
+		case "=~":
+			matched = re.MatchString(name)
+		case "!~":
+			matched = !re.MatchString(name)
+		}
+		if matched {
+			numbers = append(numbers, strconv.Itoa(number))
+		}
+	}
+	sort.Strings(numbers)
+	return numbers, nil
+}
+
+// matcherToSQL 转换日志流选择器及解析器之前的字符串标签过滤
+func matcherToSQL(label, op, value string) (string, error) {
+	if label == "level" {
+		numbers, err := levelNumbers(op, value)
+		if err != nil {
+			return "", err
+		}
+		if len(numbers) == 0 {
+			return "1!=1", nil
+		}
+		return fmt.Sprintf("severity_number IN (%s)", strings.Join(numbers, ",")), nil
+	}
+	column := labelColumn(label)
+	switch op {
+	case "=", "!=":
+		return fmt.Sprintf("%s%s%s", column, op, common.QuoteString(value)), nil
+	case "=~", "!~":
+		if _, err := regexp.Compile(value); err != nil {
+			return "", fmt.Errorf("invalid regex %s: %s", value, err)
+		}
+		// loki的正则匹配为全匹配
+		sqlOp := "regexp"
+		if op == "!~" {
+			sqlOp = "not regexp"
+		}
+		return fmt.Sprintf("%s %s %s", column, sqlOp, common.QuoteString("^(?:"+value+")$")), nil
+	}
+	return "", fmt.Errorf("unsupported matcher operator %s", op)
+}
+
+func lineFilterToSQL(f *LineFilter) (string, error) {
+	pattern := f.Value
+	switch f.Op {
+	case "|=", "!=":
+		pattern = regexp.QuoteMeta(f.Value)
+	default:
+		if _, err := regexp.Compile(f.Value); err != nil {
+			return "", fmt.Errorf("invalid regex %s: %s", f.Value, err)
+		}
+	}
+	if f.Op == "|=" || f.Op == "|~" {
+		return fmt.Sprintf("body regexp %s", common.QuoteString(pattern)), nil
+	}
+	return fmt.Sprintf("body not regexp %s", common.QuoteString(pattern)), nil
+}
+
+// logFilters 生成日志查询的过滤条件，解析器之后的标签过滤在查询结果上计算，不下推
+func logFilters(expr *LogSelectorExpr, start, end time.Time) ([]string, error) {
+	filters := []string{
+		fmt.Sprintf("time>=%d", start.Unix()),
+		fmt.Sprintf("time<=%d", end.Unix()),
+	}
+	for _, m := range expr.Matchers {
+		filter, err := matcherToSQL(m.Name, m.Op, m.Value)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	for _, stage := range expr.Stages {
+		switch s := stage.(type) {
+		case *ParserStage:
+			return filters, nil
+		case *LineFilter:
+			filter, err := lineFilterToSQL(s)
+			if err != nil {
+				return nil, err
+			}
+			filters = append(filters, filter)
+		case *LabelFilter:
+			if s.IsNumber {
+				if s.Name == "level" {
+					return nil, fmt.Errorf("label level does not support numeric comparison")
+				}
+				// 标签列均为字符串，转换为数值后比较
+				filters = append(filters, fmt.Sprintf("toFloat64OrNull(%s) %s %s", labelColumn(s.Name), s.Op, s.Value))
+				continue
+			}
+			filter, err := matcherToSQL(s.Name, s.Op, s.Value)
+			if err != nil {
+				return nil, err
+			}
+			filters = append(filters, filter)
+		}
+	}
+	return filters, nil
+}
+
+func streamLabelColumns() []string {
+	columns := make([]string, 0, len(LOKI_STREAM_LABELS))
+	for _, label := range LOKI_STREAM_LABELS {
+		columns = append(columns, LOKI_LABEL_COLUMNS[label])
+	}
+	return columns
+}
+
+func buildLogSQL(expr *LogSelectorExpr, start, end time.Time, limit int, direction string) (string, error) {
+	filters, err := logFilters(expr, start, end)
+	if err != nil {
+		return "", err
+	}
+	order := "DESC"
+	if direction == model.DIRECTION_FORWARD {
+		order = "ASC"
+	}
+	selects := append([]string{"toUnixTimestamp64Micro(timestamp) AS timestamp_us", "body", "attribute"}, streamLabelColumns()...)
+	return fmt.Sprintf(
+		"SELECT %s FROM %s WHERE %s ORDER BY timestamp %s LIMIT %d",
+		strings.Join(selects, ", "), LOKI_TABLE, strings.Join(filters, " AND "), order, limit,
+	), nil
+}
+
+type logEntry struct {
+	timestamp int64 // 纳秒
+	line      string
+	labels    map[string]string
+	key       string // 解析前的标签、attribute和日志内容，用于tail时去重
+	matched   bool
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toInt64(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case uint64:
+		return int64(v)
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	case string:
+		i, _ := strconv.ParseInt(v, 10, 64)
+		return i
+	}
+	return 0
+}
+
+func toFloat64(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case int:
+		return float64(v)
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	}
+	return 0
+}
+
+// streamLabels 生成日志流标签，忽略空值
+func streamLabels(row []interface{}, columnIndex map[string]int) map[string]string {
+	labels := map[string]string{}
+	for _, label := range LOKI_STREAM_LABELS {
+		index, ok := columnIndex[LOKI_LABEL_COLUMNS[label]]
+		if !ok {
+			continue
+		}
+		value := toString(row[index])
+		if label == "level" {
+			value = levelName(row[index])
+		}
+		if value != "" {
+			labels[label] = value
+		}
+	}
+	return labels
+}
+
+func columnIndexes(result *common.Result) map[string]int {
+	indexes := map[string]int{}
+	for i, column := range result.Columns {
+		indexes[strings.Trim(toString(column), "`")] = i
+	}
+	return indexes
+}
+
+func queryLogs(expr *LogSelectorExpr, args *model.LokiQueryParams, limit int, direction string) ([]*logEntry, error) {
+	rows, err := queryLogRows(expr, args, limit, direction)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*logEntry, 0, len(rows))
+	for _, entry := range rows {
+		if entry.matched {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// queryLogRows 返回查询到的所有日志，matched标记是否通过解析器之后的过滤
+func queryLogRows(expr *LogSelectorExpr, args *model.LokiQueryParams, limit int, direction string) ([]*logEntry, error) {
+	sql, err := buildLogSQL(expr, args.Start, args.End, limit, direction)
+	if err != nil {
+		return nil, err
+	}
+	result, err := executeQuery(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	indexes := columnIndexes(result)
+	entries := make([]*logEntry, 0, len(result.Values))
+	for _, value := range result.Values {
+		row := value.([]interface{})
+		entry := &logEntry{
+			timestamp: toInt64(row[indexes["timestamp_us"]]) * 1000,
+			line:      toString(row[indexes["body"]]),
+			labels:    streamLabels(row, indexes),
+		}
+		attribute := toString(row[indexes["attribute"]])
+		entry.key = labelsKey(entry.labels) + attribute + entry.line
+		entry.matched = pipeline(expr, entry, attribute)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// pipeline 在查询结果上执行解析器及其之后的过滤，返回是否保留该日志
+func pipeline(expr *LogSelectorExpr, entry *logEntry, attribute string) bool {
+	parsed := false
+	for _, stage := range expr.Stages {
+		switch s := stage.(type) {
+		case *ParserStage:
+			if !parsed && attribute != "" && attribute != "{}" {
+				attributes := map[string]interface{}{}
+				if json.Unmarshal([]byte(attribute), &attributes) == nil {
+					addExtractedLabels(entry.labels, flattenJSON("", attributes))
+				}
+			}
+			parsed = true
+			switch s.Type {
+			case "json":
+				addExtractedLabels(entry.labels, parseJSONLine(entry.line))
+			case "logfmt":
+				addExtractedLabels(entry.labels, parseLogfmtLine(entry.line))
+			}
+		case *LineFilter:
+			if parsed && !matchLine(s, entry.line) {
+				return false
+			}
+		case *LabelFilter:
+			if parsed && !matchLabel(s, entry.labels[s.Name]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchLine(f *LineFilter, line string) bool {
+	switch f.Op {
+	case "|=":
+		return strings.Contains(line, f.Value)
+	case "!=":
+		return !strings.Contains(line, f.Value)
+	}
+	re, err := regexp.Compile(f.Value)
+	if err != nil {
+		return false
+	}
+	if f.Op == "|~" {
+		return re.MatchString(line)
+	}
+	return !re.MatchString(line)
+}
+
+func matchLabel(f *LabelFilter, value string) bool {
+	if f.IsNumber {
+		actual, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			if d, derr := parseLogQLDuration(value); derr == nil {
+				actual = d.Seconds()
+			} else {
+				return false
+			}
+		}
+		expected, _ := strconv.ParseFloat(f.Value, 64)
+		switch f.Op {
+		case "=":
+			return actual == expected
+		case "!=":
+			return actual != expected
+		case ">":
+			return actual > expected
+		case ">=":
+			return actual >= expected
+		case "<":
+			return actual < expected
+		case "<=":
+			return actual <= expected
+		}
+		return false
+	}
+	switch f.Op {
+	case "=":
+		return value == f.Value
+	case "!=":
+		return value != f.Value
+	}
+	re, err := regexp.Compile("^(?:" + f.Value + ")$")
+	if err != nil {
+		return false
+	}
+	if f.Op == "=~" {
+		return re.MatchString(value)
+	}
+	return !re.MatchString(value)
+}
+
+// addExtractedLabels 解析出的标签与日志流标签重名时添加_extracted后缀
+func addExtractedLabels(labels, extracted map[string]string) {
+	for k, v := range extracted {
+		if _, ok := labels[k]; ok {
+			if _, isStream := LOKI_LABEL_COLUMNS[k]; isStream {
+				k += "_extracted"
+			}
+		}
+		labels[k] = v
+	}
+}
+
+func sanitizeLabel(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func flattenJSON(prefix string, data map[string]interface{}) map[string]string {
+	labels := map[string]string{}
+	for k, v := range data {
+		name := sanitizeLabel(k)
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		switch value := v.(type) {
+		case map[string]interface{}:
+			for nk, nv := range flattenJSON(name, value) {
+				labels[nk] = nv
+			}
+		case []interface{}:
+			// 与loki一致，忽略数组
+		case string:
+			labels[name] = value
+		case nil:
+			labels[name] = ""
+		default:
+			b, _ := json.Marshal(value)
+			labels[name] = string(b)
+		}
+	}
+	return labels
+}
+
+func parseJSONLine(line string) map[string]string {
+	data := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(line), &data); err != nil {
+		return map[string]string{"__error__": "JSONParserErr"}
+	}
+	return flattenJSON("", data)
+}
+
+// parseLogfmtLine 解析key=value或key="value"格式的日志
+func parseLogfmtLine(line string) map[string]string {
+	labels := map[string]string{}
+	for i := 0; i < len(line); {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' {
+			i++
+		}
+		key := line[start:i]
+		value := ""
+		if i < len(line) && line[i] == '=' {
+			i++
+			if i < len(line) && line[i] == '"' {
+				j := i + 1
+				for ; j < len(line) && line[j] != '"'; j++ {
+					if line[j] == '\\' {
+						j++
+					}
+				}
+				if j >= len(line) {
+					return map[string]string{"__error__": "LogfmtParserErr"}
+				}
+				if unquoted, err := strconv.Unquote(line[i : j+1]); err == nil {
+					value = unquoted
+				} else {
+					value = line[i+1 : j]
+				}
+				i = j + 1
+			} else {
+				start = i
+				for i < len(line) && line[i] != ' ' {
+					i++
+				}
+				value = line[start:i]
+			}
+		}
+		if key != "" {
+			labels[sanitizeLabel(key)] = value
+		}
+	}
+	return labels
+}
+
+func labelsKey(labels map[string]string) string {
+	keys := sortedKeys(labels)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+strconv.Quote(labels[k]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// entriesToStreams 按标签将日志划分为日志流，流内日志保持查询方向的顺序
+func entriesToStreams(entries []*logEntry) []*model.Stream {
+	streams := []*model.Stream{}
+	streamMap := map[string]*model.Stream{}
+	for _, entry := range entries {
+		key := labelsKey(entry.labels)
+		stream, ok := streamMap[key]
+		if !ok {
+			stream = &model.Stream{Stream: entry.labels, Values: [][2]string{}}
+			streamMap[key] = stream
+			streams = append(streams, stream)
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(entry.timestamp, 10), entry.line})
+	}
+	return streams
+}
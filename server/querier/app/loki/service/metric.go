@@ -0,0 +1,288 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deepflowio/deepflow/server/querier/app/loki/model"
+)
+
+// timeSeries 指标查询的中间结果，points的key为毫秒时间戳
+type timeSeries struct {
+	labels map[string]string
+	points map[int64]float64
+}
+
+// sample 时间窗口内的一个数据点，count为日志条数，bytes为日志长度之和
+type sample struct {
+	timestamp int64 // 毫秒
+	count     float64
+	bytes     float64
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// evalSteps 返回[start, end]内按step对齐的计算时间点，单位为毫秒
+func evalSteps(start, end time.Time, step time.Duration) []int64 {
+	if step <= 0 {
+		return []int64{end.UnixMilli()}
+	}
+	steps := []int64{}
+	for t := start.UnixMilli(); t <= end.UnixMilli(); t += step.Milliseconds() {
+		steps = append(steps, t)
+	}
+	return steps
+}
+
+// canPushDown 不含解析器的count_over_time/rate可以直接使用log_count按时间分组聚合
+func canPushDown(expr *RangeAggregationExpr) bool {
+	return !expr.Log.HasParser() && (expr.Func == "count_over_time" || expr.Func == "rate")
+}
+
+// buildMetricSQL 按interval秒分组统计各日志流的日志条数
+func buildMetricSQL(expr *RangeAggregationExpr, start, end time.Time, interval int64) (string, error) {
+	filters, err := logFilters(expr.Log, start, end)
+	if err != nil {
+		return "", err
+	}
+	bucket := fmt.Sprintf("time_%d", interval)
+	groups := append([]string{bucket}, streamLabelColumns()...)
+	return fmt.Sprintf(
+		"SELECT time(time, %d) AS %s, %s, Sum(log_count) AS log_count FROM %s WHERE %s GROUP BY %s LIMIT %d",
+		interval, bucket, strings.Join(streamLabelColumns(), ", "), LOKI_TABLE,
+		strings.Join(filters, " AND "), strings.Join(groups, ", "), LOKI_METRIC_ROW_LIMIT,
+	), nil
+}
+
+func querySamples(expr *RangeAggregationExpr, args *model.LokiQueryParams, step time.Duration) (map[string][]*sample, map[string]map[string]string, error) {
+	queryArgs := *args
+	queryArgs.Start = args.Start.Add(-expr.Range)
+	samples := map[string][]*sample{}
+	labelsMap := map[string]map[string]string{}
+	if canPushDown(expr) {
+		interval := int64(expr.Range.Seconds())
+		if step >= time.Second {
+			interval = gcd(interval, int64(step.Seconds()))
+		}
+		if interval <= 0 {
+			interval = 1
+		}
+		sql, err := buildMetricSQL(expr, queryArgs.Start, queryArgs.End, interval)
+		if err != nil {
+			return nil, nil, err
+		}
+		result, err := executeQuery(sql, &queryArgs)
+		if err != nil {
+			return nil, nil, err
+		}
+		indexes := columnIndexes(result)
+		bucketIndex := indexes[fmt.Sprintf("time_%d", interval)]
+		for _, value := range result.Values {
+			row := value.([]interface{})
+			labels := streamLabels(row, indexes)
+			key := labelsKey(labels)
+			labelsMap[key] = labels
+			// 以时间分组的最后一毫秒作为数据点时间，使分组完整落在[t-range, t)内时才计入窗口
+			samples[key] = append(samples[key], &sample{
+				timestamp: (toInt64(row[bucketIndex])+interval)*1000 - 1,
+				count:     toFloat64(row[indexes["log_count"]]),
+			})
+		}
+		return samples, labelsMap, nil
+	}
+
+	entries, err := queryLogs(expr.Log, &queryArgs, LOKI_METRIC_ROW_LIMIT, model.DIRECTION_FORWARD)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(entries) >= LOKI_METRIC_ROW_LIMIT {
+		return nil, nil, fmt.Errorf("the query matches more than %d log lines, please narrow the time range or add filters", LOKI_METRIC_ROW_LIMIT)
+	}
+	for _, entry := range entries {
+		key := labelsKey(entry.labels)
+		labelsMap[key] = entry.labels
+		samples[key] = append(samples[key], &sample{timestamp: entry.timestamp / 1e6, count: 1, bytes: float64(len(entry.line))})
+	}
+	return samples, labelsMap, nil
+}
+
+// evalRangeAggregation 计算每个时间点t在(t-range, t]窗口内的聚合值，窗口内无数据时不输出该点
+func evalRangeAggregation(expr *RangeAggregationExpr, samples []*sample, steps []int64) map[int64]float64 {
+	sort.Slice(samples, func(i, j int) bool { return samples[i].timestamp < samples[j].timestamp })
+	rangeMs := expr.Range.Milliseconds()
+	points := map[int64]float64{}
+	for _, t := range steps {
+		lo := sort.Search(len(samples), func(i int) bool { return samples[i].timestamp > t-rangeMs })
+		hi := sort.Search(len(samples), func(i int) bool { return samples[i].timestamp > t })
+		if lo >= hi {
+			continue
+		}
+		var count, bytes float64
+		for _, s := range samples[lo:hi] {
+			count += s.count
+			bytes += s.bytes
+		}
+		switch expr.Func {
+		case "count_over_time":
+			points[t] = count
+		case "rate":
+			points[t] = count / expr.Range.Seconds()
+		case "bytes_over_time":
+			points[t] = bytes
+		case "bytes_rate":
+			points[t] = bytes / expr.Range.Seconds()
+		}
+	}
+	return points
+}
+
+func evalMetric(expr LogQLExpr, args *model.LokiQueryParams, steps []int64) ([]*timeSeries, error) {
+	switch e := expr.(type) {
+	case *RangeAggregationExpr:
+		step := time.Duration(0)
+		if len(steps) > 1 {
+			step = time.Duration(steps[1]-steps[0]) * time.Millisecond
+		}
+		samples, labelsMap, err := querySamples(e, args, step)
+		if err != nil {
+			return nil, err
+		}
+		series := []*timeSeries{}
+		for _, key := range sortedKeys(samples) {
+			points := evalRangeAggregation(e, samples[key], steps)
+			if len(points) > 0 {
+				series = append(series, &timeSeries{labels: labelsMap[key], points: points})
+			}
+		}
+		return series, nil
+	case *VectorAggregationExpr:
+		inner, err := evalMetric(e.Inner, args, steps)
+		if err != nil {
+			return nil, err
+		}
+		return evalVectorAggregation(e, inner), nil
+	}
+	return nil, fmt.Errorf("log selector is not a metric query")
+}
+
+func groupLabels(expr *VectorAggregationExpr, labels map[string]string) map[string]string {
+	grouped := map[string]string{}
+	if expr.Without {
+		for k, v := range labels {
+			grouped[k] = v
+		}
+		for _, name := range expr.Grouping {
+			delete(grouped, name)
+		}
+		return grouped
+	}
+	for _, name := range expr.Grouping {
+		if v, ok := labels[name]; ok {
+			grouped[name] = v
+		}
+	}
+	return grouped
+}
+
+func evalVectorAggregation(expr *VectorAggregationExpr, inner []*timeSeries) []*timeSeries {
+	groups := map[string]*timeSeries{}
+	counts := map[string]map[int64]float64{}
+	for _, s := range inner {
+		labels := groupLabels(expr, s.labels)
+		key := labelsKey(labels)
+		group, ok := groups[key]
+		if !ok {
+			group = &timeSeries{labels: labels, points: map[int64]float64{}}
+			groups[key] = group
+			counts[key] = map[int64]float64{}
+		}
+		for t, v := range s.points {
+			current, exists := group.points[t]
+			counts[key][t]++
+			switch {
+			case !exists:
+				group.points[t] = v
+			case expr.Op == "sum" || expr.Op == "avg":
+				group.points[t] = current + v
+			case expr.Op == "min" && v < current:
+				group.points[t] = v
+			case expr.Op == "max" && v > current:
+				group.points[t] = v
+			}
+		}
+	}
+	series := []*timeSeries{}
+	for _, key := range sortedKeys(groups) {
+		group := groups[key]
+		for t := range group.points {
+			switch expr.Op {
+			case "count":
+				group.points[t] = counts[key][t]
+			case "avg":
+				group.points[t] /= counts[key][t]
+			}
+		}
+		series = append(series, group)
+	}
+	return series
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func toMatrix(series []*timeSeries) []*model.Series {
+	matrix := make([]*model.Series, 0, len(series))
+	for _, s := range series {
+		timestamps := sortedPointKeys(s.points)
+		values := make([][2]interface{}, 0, len(timestamps))
+		for _, t := range timestamps {
+			values = append(values, [2]interface{}{float64(t) / 1000, formatValue(s.points[t])})
+		}
+		matrix = append(matrix, &model.Series{Metric: s.labels, Values: values})
+	}
+	return matrix
+}
+
+func toVector(series []*timeSeries, t int64) []*model.Sample {
+	vector := []*model.Sample{}
+	for _, s := range series {
+		if v, ok := s.points[t]; ok {
+			vector = append(vector, &model.Sample{Metric: s.labels, Value: [2]interface{}{float64(t) / 1000, formatValue(v)}})
+		}
+	}
+	return vector
+}
+
+func sortedPointKeys(points map[int64]float64) []int64 {
+	keys := make([]int64, 0, len(points))
+	for k := range points {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,215 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deepflowio/deepflow/server/querier/app/loki/model"
+)
+
+func emptyStats() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+func parseLogSelector(query string) (*LogSelectorExpr, error) {
+	expr, err := ParseLogQL(query)
+	if err != nil {
+		return nil, err
+	}
+	selector, ok := expr.(*LogSelectorExpr)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a log selector", query)
+	}
+	return selector, nil
+}
+
+// QueryRange 对应/loki/api/v1/query_range，日志查询返回streams，指标查询返回matrix
+func QueryRange(args *model.LokiQueryParams) (*model.LokiQueryData, error) {
+	expr, err := ParseLogQL(args.Query)
+	if err != nil {
+		return nil, err
+	}
+	if args.End.Before(args.Start) {
+		return nil, fmt.Errorf("end timestamp must not be before start time")
+	}
+	if selector, ok := expr.(*LogSelectorExpr); ok {
+		entries, err := queryLogs(selector, args, args.Limit, args.Direction)
+		if err != nil {
+			return nil, err
+		}
+		return &model.LokiQueryData{ResultType: model.RESULT_TYPE_STREAMS, Result: entriesToStreams(entries), Stats: emptyStats()}, nil
+	}
+	if args.Step <= 0 {
+		return nil, fmt.Errorf("zero or negative query resolution step widths are not accepted")
+	}
+	if args.End.Sub(args.Start)/args.Step > LOKI_MAX_POINTS {
+		return nil, fmt.Errorf("exceeded maximum resolution of %d points per timeseries, try decreasing the query resolution (?step=XX)", LOKI_MAX_POINTS)
+	}
+	series, err := evalMetric(expr, args, evalSteps(args.Start, args.End, args.Step))
+	if err != nil {
+		return nil, err
+	}
+	return &model.LokiQueryData{ResultType: model.RESULT_TYPE_MATRIX, Result: toMatrix(series), Stats: emptyStats()}, nil
+}
+
+// Query 对应/loki/api/v1/query，指标查询在args.End时刻计算并返回vector
+func Query(args *model.LokiQueryParams) (*model.LokiQueryData, error) {
+	expr, err := ParseLogQL(args.Query)
+	if err != nil {
+		return nil, err
+	}
+	if selector, ok := expr.(*LogSelectorExpr); ok {
+		entries, err := queryLogs(selector, args, args.Limit, args.Direction)
+		if err != nil {
+			return nil, err
+		}
+		return &model.LokiQueryData{ResultType: model.RESULT_TYPE_STREAMS, Result: entriesToStreams(entries), Stats: emptyStats()}, nil
+	}
+	queryArgs := *args
+	queryArgs.Start = args.End
+	t := args.End.UnixMilli()
+	series, err := evalMetric(expr, &queryArgs, []int64{t})
+	if err != nil {
+		return nil, err
+	}
+	return &model.LokiQueryData{ResultType: model.RESULT_TYPE_VECTOR, Result: toVector(series, t), Stats: emptyStats()}, nil
+}
+
+func Labels(args *model.LokiQueryParams) []string {
+	labels := append([]string{}, LOKI_STREAM_LABELS...)
+	sort.Strings(labels)
+	return labels
+}
+
+// LabelValues 对应/loki/api/v1/label/:name/values，指定query时仅返回匹配日志中的取值
+func LabelValues(args *model.LokiQueryParams) ([]string, error) {
+	if _, ok := LOKI_LABEL_COLUMNS[args.LabelName]; !ok {
+		return []string{}, nil
+	}
+	selector := &LogSelectorExpr{}
+	if args.Query != "" {
+		var err error
+		if selector, err = parseLogSelector(args.Query); err != nil {
+			return nil, err
+		}
+	}
+	filters, err := logFilters(selector, args.Start, args.End)
+	if err != nil {
+		return nil, err
+	}
+	column := LOKI_LABEL_COLUMNS[args.LabelName]
+	sql := fmt.Sprintf(
+		"SELECT %s FROM %s WHERE %s GROUP BY %s LIMIT %d",
+		column, LOKI_TABLE, strings.Join(filters, " AND "), column, LOKI_SERIES_LIMIT,
+	)
+	result, err := executeQuery(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	values := []string{}
+	for _, value := range result.Values {
+		v := value.([]interface{})[0]
+		label := toString(v)
+		if args.LabelName == "level" {
+			label = levelName(v)
+		}
+		if label != "" {
+			values = append(values, label)
+		}
+	}
+	sort.Strings(values)
+	return values, nil
+}
+
+// Series 对应/loki/api/v1/series，返回各match[]匹配到的日志流标签
+func Series(args *model.LokiQueryParams) ([]map[string]string, error) {
+	series := []map[string]string{}
+	exists := map[string]bool{}
+	columns := strings.Join(streamLabelColumns(), ", ")
+	for _, match := range args.Matches {
+		selector, err := parseLogSelector(match)
+		if err != nil {
+			return nil, err
+		}
+		filters, err := logFilters(selector, args.Start, args.End)
+		if err != nil {
+			return nil, err
+		}
+		sql := fmt.Sprintf(
+			"SELECT %s FROM %s WHERE %s GROUP BY %s LIMIT %d",
+			columns, LOKI_TABLE, strings.Join(filters, " AND "), columns, LOKI_SERIES_LIMIT,
+		)
+		result, err := executeQuery(sql, args)
+		if err != nil {
+			return nil, err
+		}
+		indexes := columnIndexes(result)
+		for _, value := range result.Values {
+			labels := streamLabels(value.([]interface{}), indexes)
+			if key := labelsKey(labels); !exists[key] {
+				exists[key] = true
+				series = append(series, labels)
+			}
+		}
+	}
+	return series, nil
+}
+
+// TailCursor 记录tail已推送到的位置，Timestamp(纳秒)时刻已推送的日志(包括被过滤的)用于去重
+type TailCursor struct {
+	Timestamp int64
+	pushed    map[string]bool
+}
+
+func NewTailCursor(start time.Time) *TailCursor {
+	return &TailCursor{Timestamp: start.UnixNano(), pushed: map[string]bool{}}
+}
+
+// Tail 查询cursor之后的新日志并更新cursor。同一时刻的日志可能被limit截断，
+// 因此从cursor.Timestamp开始查询并去掉已推送的日志，limit加上已推送的数量以保证每次都有进展
+func Tail(args *model.LokiQueryParams, cursor *TailCursor) ([]*model.Stream, error) {
+	selector, err := parseLogSelector(args.Query)
+	if err != nil {
+		return nil, err
+	}
+	queryArgs := *args
+	queryArgs.Start = time.Unix(0, cursor.Timestamp)
+	rows, err := queryLogRows(selector, &queryArgs, args.Limit+len(cursor.pushed), model.DIRECTION_FORWARD)
+	if err != nil {
+		return nil, err
+	}
+	// time过滤为秒级，需要去掉cursor之前的日志
+	newEntries := make([]*logEntry, 0, len(rows))
+	for _, entry := range rows {
+		if entry.timestamp < cursor.Timestamp || entry.timestamp == cursor.Timestamp && cursor.pushed[entry.key] {
+			continue
+		}
+		if entry.timestamp > cursor.Timestamp {
+			cursor.Timestamp = entry.timestamp
+			cursor.pushed = map[string]bool{}
+		}
+		cursor.pushed[entry.key] = true
+		if entry.matched {
+			newEntries = append(newEntries, entry)
+		}
+	}
+	return entriesToStreams(newEntries), nil
+}
@@ -849,7 +849,7 @@ func (p *prometheusExecutor) beforePrometheusCalculate(q promql.Query, f func(e
 
 func (p *prometheusExecutor) getAllOrganizations() []string {
 	getOrgUrl := fmt.Sprintf("http://localhost:%d/v1/orgs/", config.ControllerCfg.ListenPort)
-	resp, err := common.CURLPerform("GET", getOrgUrl, nil)
+	resp, err := common.CURLPerform("GET", getOrgUrl, nil, common.WithInternalAuthorization())
 	if err != nil {
 		log.Errorf("request controller failed: %s, URL: %s", resp, getOrgUrl)
 		return nil
@@ -27,6 +27,7 @@ const (
 	SERVER_ERROR                    = "SERVER_ERROR"
 	RESOURCE_NUM_EXCEEDED           = "RESOURCE_NUM_EXCEEDED"
 	SELECTED_RESOURCES_NUM_EXCEEDED = "SELECTED_RESOURCES_NUM_EXCEEDED"
+	QUOTA_EXCEEDED                  = "QUOTA_EXCEEDED"
 )
 
 const (
@@ -46,9 +47,10 @@ const (
 )
 
 const (
-	HEADER_KEY_LANGUAGE = "X-Language"
-	HEADER_KEY_X_ORG_ID = "X-Org-Id"
-	DEFAULT_ORG_ID      = "1"
+	HEADER_KEY_LANGUAGE  = "X-Language"
+	HEADER_KEY_X_ORG_ID  = "X-Org-Id"
+	HEADER_KEY_X_USER_ID = "X-User-Id"
+	DEFAULT_ORG_ID       = "1"
 )
 
 const NO_LIMIT = "-1"
@@ -35,19 +35,24 @@ type QuerierParams struct {
 	ORGID         string
 	SimpleSql     bool
 	Language      string
+	UserID        string
 }
 
 type TempoParams struct {
-	TraceId     string
-	StartTime   string
-	EndTime     string
-	TagName     string
-	MinDuration string
-	MaxDuration string
-	Limit       string
-	Debug       string
-	Filters     []*KeyValue
-	Context     context.Context
+	TraceId         string
+	StartTime       int64 // 秒级时间戳，0 表示不限制
+	EndTime         int64
+	TagName         string
+	MinDuration     string
+	MaxDuration     string
+	Limit           string
+	Debug           string
+	Filters         []*KeyValue
+	Query           string // TraceQL
+	SpansPerSpanSet string
+	Scope           string
+	OrgID           string
+	Context         context.Context
 }
 
 func (p *TempoParams) SetFilters(filterStr string) {
@@ -71,6 +76,23 @@ type KeyValue struct {
 	Value string
 }
 
+// JaegerParams 时间单位均为微秒
+type JaegerParams struct {
+	TraceId     string
+	Service     string
+	Operation   string
+	SpanKind    string
+	Tags        map[string]string
+	StartTime   int64
+	EndTime     int64
+	MinDuration int64
+	MaxDuration int64
+	Limit       int
+	Debug       string
+	OrgID       string
+	Context     context.Context
+}
+
 type EntryKey struct {
 	ORGID  string
 	Filter string
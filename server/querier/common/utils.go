@@ -23,6 +23,13 @@ import (
 	"strings"
 )
 
+var sqlStringReplacer = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// QuoteString 将字符串转义为 SQL 字符串常量
+func QuoteString(s string) string {
+	return "'" + sqlStringReplacer.Replace(s) + "'"
+}
+
 func IsValueInSliceString(value string, list []string) bool {
 	for _, item := range list {
 		if value == item {
@@ -46,6 +46,7 @@ type QuerierConfig struct {
 	LogFile                         string                        `default:"/var/log/querier.log" yaml:"log-file"`
 	LogLevel                        string                        `default:"info" yaml:"log-level"`
 	ListenPort                      int                           `default:"20416" yaml:"listen-port"`
+	JaegerGrpcPort                  int                           `default:"0" yaml:"jaeger-grpc-port"`
 	Clickhouse                      Clickhouse                    `yaml:"clickhouse"`
 	Profile                         profile.ProfileConfig         `yaml:"profile"`
 	Tracemap                        tracemap.TraceMapConfig       `yaml:"trace-map"`
@@ -61,6 +62,8 @@ type QuerierConfig struct {
 	MaxPrometheusIdSubqueryLruEntry int                           `default:"8000" yaml:"max-prometheus-id-subquery-lru-entry"`
 	PrometheusIdSubqueryLruTimeout  int                           `default:"60" yaml:"prometheus-id-subquery-lru-timeout"`
 	AutoCustomTags                  []AutoCustomTags              `yaml:"auto-custom-tags" binding:"omitempty,dive"`
+	AsyncQuery                      AsyncQuery                    `yaml:"async-query"`
+	Quota                           Quota                         `yaml:"quota"`
 }
 
 type DeepflowApp struct {
@@ -85,6 +88,8 @@ type Clickhouse struct {
 	Password       string `default:"" yaml:"user-password"`
 	Host           string `default:"clickhouse" yaml:"host"`
 	Port           int    `default:"9000" yaml:"port"`
+	HttpPort       int    `default:"8123" yaml:"http-port"`
+	ClusterName    string `default:"df_cluster" yaml:"cluster-name"`
 	Timeout        int    `default:"60" yaml:"timeout"`
 	ConnectTimeout int    `default:"2" yaml:"connect-timeout"`
 	MaxConnection  int    `default:"20" yaml:"max-connection"`
@@ -92,6 +97,40 @@ type Clickhouse struct {
 	QueryCacheTTL  string `default:"600" yaml:"query-cache-ttl"`
 }
 
+type AsyncQuery struct {
+	ResultDir      string `default:"/tmp/deepflow-querier/async-query" yaml:"result-dir"`
+	MaxRunningJobs int    `default:"4" yaml:"max-running-jobs"`
+	ResultTTL      int    `default:"3600" yaml:"result-ttl"`
+}
+
+type Quota struct {
+	Enabled bool        `default:"false" yaml:"enabled"`
+	Default QuotaLimits `yaml:"default"`
+	Orgs    []OrgQuota  `yaml:"orgs"`
+	Users   []UserQuota `yaml:"users"`
+}
+
+// QuotaLimits 各项为 0 时表示不限制
+type QuotaLimits struct {
+	MaxTimeRange         map[string]int `yaml:"max-time-range"` // 表名 -> 秒，* 表示所有表
+	MaxRowsRead          uint64         `yaml:"max-rows-read"`
+	MaxResultRows        uint64         `yaml:"max-result-rows"`
+	MaxConcurrentQueries int            `yaml:"max-concurrent-queries"` // 每个 querier 进程内单独计数
+	MaxQueriesPerMinute  int            `yaml:"max-queries-per-minute"` // 每个 querier 进程内单独计数
+}
+
+type OrgQuota struct {
+	OrgID       string `yaml:"org-id"`
+	QuotaLimits `yaml:",inline"`
+}
+
+// UserQuota 用户 ID 仅在组织内唯一，OrgID 为空时表示默认组织
+type UserQuota struct {
+	OrgID       string `yaml:"org-id"`
+	UserID      string `yaml:"user-id"`
+	QuotaLimits `yaml:",inline"`
+}
+
 type AutoCustomTags struct {
 	TagName     string   `default:"" yaml:"tag-name"`
 	TagFields   []string `yaml:"tag-fields" binding:"omitempty,dive"`
@@ -41,6 +41,7 @@ import (
 	tagdescription "github.com/deepflowio/deepflow/server/querier/engine/clickhouse/tag"
 	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse/view"
 	"github.com/deepflowio/deepflow/server/querier/parse"
+	"github.com/deepflowio/deepflow/server/querier/quota"
 )
 
 var log = logging.MustGetLogger("clickhouse")
@@ -103,6 +104,7 @@ type CHEngine struct {
 	IsDerivative       bool
 	DerivativeGroupBy  []string
 	ORGID              string
+	UserID             string
 	Language           string
 	NativeField        map[string]*metrics.Metrics
 }
@@ -126,6 +128,7 @@ func (e *CHEngine) ExecuteQuery(args *common.QuerierParams) (*common.Result, map
 	if args.ORGID != "" {
 		e.ORGID = args.ORGID
 	}
+	e.UserID = args.UserID
 	query_uuid := args.QueryUUID // FIXME: should be queryUUID
 	debug_info := &client.DebugInfo{}
 	// Parse withSql
@@ -140,6 +143,18 @@ func (e *CHEngine) ExecuteQuery(args *common.QuerierParams) (*common.Result, map
 		debug_info.Debug = append(debug_info.Debug, *withDebug)
 		return withResult, debug_info.Get(), err
 	}
+	// Parse joinSql
+	joinResult, joinDebug, err := e.QueryJoinSql(sql, args)
+	if err != nil {
+		if joinDebug != nil {
+			debug_info.Debug = append(debug_info.Debug, *joinDebug)
+		}
+		return nil, debug_info.Get(), err
+	}
+	if joinResult != nil {
+		debug_info.Debug = append(debug_info.Debug, *joinDebug)
+		return joinResult, debug_info.Get(), err
+	}
 	// Parse slimitSql
 	slimitResult, slimitDebug, err := e.QuerySlimitSql(sql, args)
 	if err != nil {
@@ -204,6 +219,12 @@ func (e *CHEngine) ExecuteQuery(args *common.QuerierParams) (*common.Result, map
 			log.Error(errorMessage)
 			return nil, nil, err
 		}
+		if !isShow {
+			err = usedEngine.CheckTimeRangeQuota()
+			if err != nil {
+				return nil, nil, err
+			}
+		}
 		// To do
 		for _, stmt := range usedEngine.Statements {
 			stmt.Format(usedEngine.Model)
@@ -229,9 +250,11 @@ func (e *CHEngine) ExecuteQuery(args *common.QuerierParams) (*common.Result, map
 			QueryUUID:       query_uuid,
 			ColumnSchemaMap: ColumnSchemaMap,
 			ORGID:           args.ORGID,
+			UserID:          args.UserID,
 		}
 		if !isShow {
 			params.Callbacks = callbacks
+			params.EnableQuota = true
 		}
 		result, err := chClient.DoQuery(params)
 		if err != nil {
@@ -252,6 +275,55 @@ func (e *CHEngine) ExecuteQuery(args *common.QuerierParams) (*common.Result, map
 
 }
 
+// ParseQuerySql 仅将 sql 翻译为 clickhouse-sql 而不执行，用于异步查询导出，同时返回需要在结果上执行的 callbacks，不支持 show 语句
+func (e *CHEngine) ParseQuerySql(args *common.QuerierParams) (string, map[string]func(*common.Result) error, map[string]*common.ColumnSchema, error) {
+	sql := args.Sql
+	e.Context = args.Context
+	e.NoPreWhere = args.NoPreWhere
+	e.Language = args.Language
+	e.ORGID = common.DEFAULT_ORG_ID
+	if args.ORGID != "" {
+		e.ORGID = args.ORGID
+	}
+	e.UserID = args.UserID
+	if strings.HasPrefix(strings.TrimSpace(strings.ToUpper(sql)), "SHOW") {
+		return "", nil, nil, common.NewError(common.INVALID_PARAMETERS, "show sql is not supported in async query")
+	}
+	withSql, callbacks, columnSchemaMap, err := e.ParseWithSql(sql)
+	if err != nil || withSql != "" {
+		return withSql, callbacks, columnSchemaMap, err
+	}
+	joinSql, callbacks, columnSchemaMap, err := e.ParseJoinSql(sql)
+	if err != nil || joinSql != "" {
+		return joinSql, callbacks, columnSchemaMap, err
+	}
+	slimitSql, callbacks, columnSchemaMap, err := e.ParseSlimitSql(sql, args)
+	if err != nil || slimitSql != "" {
+		return slimitSql, callbacks, columnSchemaMap, err
+	}
+	parser := parse.Parser{Engine: e}
+	err = parser.ParseSQL(sql)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	err = e.CheckTimeRangeQuota()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	for _, stmt := range e.Statements {
+		stmt.Format(e.Model)
+	}
+	FormatModel(e.Model)
+	// 使用Model生成View
+	e.View = view.NewView(e.Model)
+	e.View.NoPreWhere = e.NoPreWhere
+	columnSchemaMap = make(map[string]*common.ColumnSchema)
+	for _, columnSchema := range e.ColumnSchemas {
+		columnSchemaMap[columnSchema.Name] = columnSchema
+	}
+	return e.ToSQLString(), e.View.GetCallbacks(), columnSchemaMap, nil
+}
+
 func ShowTagTypeMetrics(tagDescriptions, result *common.Result, db, table string) {
 	for _, tagValue := range tagDescriptions.Values {
 		tagSlice := tagValue.([]interface{})
@@ -569,6 +641,8 @@ func (e *CHEngine) QuerySlimitSql(sql string, args *common.QuerierParams) (*comm
 		QueryUUID:       query_uuid,
 		ColumnSchemaMap: columnSchemaMap,
 		ORGID:           args.ORGID,
+		UserID:          args.UserID,
+		EnableQuota:     true,
 	}
 	rst, err := chClient.DoQuery(params)
 	if err != nil {
@@ -835,7 +909,7 @@ func (e *CHEngine) ParseSlimitSql(sql string, args *common.QuerierParams) (strin
 				}
 			}
 		}
-		innerEngine := &CHEngine{DB: e.DB, DataSource: e.DataSource, Context: e.Context, ORGID: e.ORGID}
+		innerEngine := &CHEngine{DB: e.DB, DataSource: e.DataSource, Context: e.Context, ORGID: e.ORGID, UserID: e.UserID}
 		innerEngine.Init()
 		if strings.Contains(innerSql, "Derivative") {
 			innerEngine.IsDerivative = true
@@ -855,7 +929,7 @@ func (e *CHEngine) ParseSlimitSql(sql string, args *common.QuerierParams) (strin
 		innerEngine.View = view.NewView(innerEngine.Model)
 		innerTransSql = innerEngine.ToSQLString()
 	}
-	outerEngine := &CHEngine{DB: e.DB, DataSource: e.DataSource, Context: e.Context, ORGID: e.ORGID}
+	outerEngine := &CHEngine{DB: e.DB, DataSource: e.DataSource, Context: e.Context, ORGID: e.ORGID, UserID: e.UserID}
 	outerEngine.Init()
 	if strings.Contains(newSql, "Derivative") {
 		outerEngine.IsDerivative = true
@@ -867,6 +941,10 @@ func (e *CHEngine) ParseSlimitSql(sql string, args *common.QuerierParams) (strin
 	if err != nil {
 		return "", nil, nil, fmt.Errorf("sql: %s; parse error: %s", innerSql, err.Error())
 	}
+	err = outerEngine.CheckTimeRangeQuota()
+	if err != nil {
+		return "", nil, nil, err
+	}
 	for _, stmt := range outerEngine.Statements {
 		stmt.Format(outerEngine.Model)
 	}
@@ -947,6 +1025,8 @@ func (e *CHEngine) QueryWithSql(sql string, args *common.QuerierParams) (*common
 		QueryUUID:       query_uuid,
 		ColumnSchemaMap: columnSchemaMap,
 		ORGID:           args.ORGID,
+		UserID:          args.UserID,
+		EnableQuota:     true,
 	}
 	rst, err := chClient.DoQuery(params)
 	if err != nil {
@@ -968,13 +1048,17 @@ func (e *CHEngine) ParseWithSql(sql string) (string, map[string]func(*common.Res
 	for _, match := range subMatches {
 		match = strings.TrimPrefix(match, "(")
 		match = strings.TrimSuffix(match, ")")
-		matchEngine := &CHEngine{DB: e.DB, DataSource: e.DataSource, Context: e.Context, ORGID: e.ORGID}
+		matchEngine := &CHEngine{DB: e.DB, DataSource: e.DataSource, Context: e.Context, ORGID: e.ORGID, UserID: e.UserID}
 		matchEngine.Init()
 		matchParser := parse.Parser{Engine: matchEngine}
 		err := matchParser.ParseSQL(match)
 		if err != nil {
 			return "", nil, nil, err
 		}
+		err = matchEngine.CheckTimeRangeQuota()
+		if err != nil {
+			return "", nil, nil, err
+		}
 		for _, stmt := range matchEngine.Statements {
 			stmt.Format(matchEngine.Model)
 		}
@@ -1254,7 +1338,7 @@ func (e *CHEngine) TransFrom(froms sqlparser.TableExprs) error {
 			if config.ControllerCfg.DFWebService.Enabled && slices.Contains([]string{chCommon.DB_NAME_DEEPFLOW_ADMIN, chCommon.DB_NAME_DEEPFLOW_TENANT, chCommon.DB_NAME_APPLICATION_LOG, chCommon.DB_NAME_EXT_METRICS}, e.DB) || slices.Contains([]string{chCommon.TABLE_NAME_L7_FLOW_LOG, chCommon.TABLE_NAME_EVENT, chCommon.TABLE_NAME_PERF_EVENT}, e.Table) {
 				e.NativeField = map[string]*metrics.Metrics{}
 				getNativeUrl := fmt.Sprintf("http://localhost:%d/v1/native-fields/?db=%s&table_name=%s", config.ControllerCfg.ListenPort, e.DB, e.Table)
-				resp, err := ctlcommon.CURLPerform("GET", getNativeUrl, nil, ctlcommon.WithHeader(ctlcommon.HEADER_KEY_X_ORG_ID, e.ORGID))
+				resp, err := ctlcommon.CURLPerform("GET", getNativeUrl, nil, ctlcommon.WithHeader(ctlcommon.HEADER_KEY_X_ORG_ID, e.ORGID), ctlcommon.WithInternalAuthorization())
 				if err != nil {
 					log.Errorf("request controller failed: %s, URL: %s", resp, getNativeUrl)
 				} else {
@@ -1419,6 +1503,11 @@ func (e *CHEngine) TransLimit(limit *sqlparser.Limit) error {
 	return nil
 }
 
+// CheckTimeRangeQuota 按表检查查询时间范围是否超出配额
+func (e *CHEngine) CheckTimeRangeQuota() error {
+	return quota.CheckTimeRange(e.ORGID, e.UserID, e.Table, e.Model.Time.TimeStart, e.Model.Time.TimeEnd)
+}
+
 // 原始sql转为clickhouse-sql
 func (e *CHEngine) ToSQLString() string {
 	if e.View == nil {
@@ -603,6 +603,42 @@ var (
 		db:     "event",
 		input:  "SELECT Count(row), alert_policy, alert_policy_id, event_level, auto_service_0, auto_service_type_0, auto_service_type, auto_service FROM alert_event where auto_service='abc' AND auto_service_type_1=1 GROUP BY alert_policy, alert_policy_id, event_level, auto_service_0, auto_service_type_0, auto_service_type, auto_service LIMIT 1",
 		output: []string{"SELECT dictGet('flow_tag.alarm_policy_map', 'name', (toUInt64(policy_id))) AS `alert_policy`, policy_id AS `alert_policy_id`, event_level, tag_string_values[indexOf(tag_string_names,'auto_service_0')] AS `auto_service_0`, tag_int_values[indexOf(tag_int_names,'auto_service_type_0')] AS `auto_service_type_0`, tag_int_values[indexOf(tag_int_names,'auto_service_type')] AS `auto_service_type`, tag_string_values[indexOf(tag_string_names,'auto_service')] AS `auto_service`, COUNT(1) AS `Count(row)` FROM event.`alert_event` WHERE if(indexOf(tag_string_names,'auto_service')=0 AND indexOf(tag_string_names,'auto_service_0')=0 AND indexOf(tag_string_names,'auto_service_1')=0,1!=1,(tag_string_values[indexOf(tag_string_names,'auto_service')] = 'abc' OR tag_string_values[indexOf(tag_string_names,'auto_service_0')] = 'abc' OR tag_string_values[indexOf(tag_string_names,'auto_service_1')] = 'abc')) AND if(indexOf(tag_int_names,'auto_service_type_1')=0,NULL,tag_int_values[indexOf(tag_int_names,'auto_service_type_1')]) = 1 GROUP BY `policy_id`, `event_level`, `auto_service_0`, `auto_service_type_0`, `auto_service_type`, `auto_service` LIMIT 1"},
+	}, {
+		name:   "test_join",
+		input:  "SELECT a.pod_service_id_0 FROM (select pod_service_id_0 from l7_flow_log where pod_service_id_0 !=3 group by pod_service_id_0) AS a INNER JOIN (select pod_service_id_0 from flow_log.l7_flow_log where pod_service_id_0 !=3 group by pod_service_id_0) AS b ON a.pod_service_id_0 = b.pod_service_id_0",
+		output: []string{"select a.pod_service_id_0 from (SELECT service_id_0 AS `pod_service_id_0` FROM flow_log.`l7_flow_log` WHERE (not(service_id_0 = 3)) GROUP BY `service_id_0` LIMIT 10000) as a join (SELECT service_id_0 AS `pod_service_id_0` FROM flow_log.`l7_flow_log` WHERE (not(service_id_0 = 3)) GROUP BY `service_id_0` LIMIT 10000) as b on a.pod_service_id_0 = b.pod_service_id_0"},
+	}, {
+		name:   "test_join_literal_like_subquery",
+		input:  "SELECT a.pod_service_id_0 FROM (select pod_service_id_0 from l7_flow_log group by pod_service_id_0) AS a INNER JOIN (select pod_service_id_0 from l4_flow_log group by pod_service_id_0) AS b ON a.pod_service_id_0 = b.pod_service_id_0 WHERE a.pod_service_id_0 = 'deepflow_subquery_0'",
+		output: []string{"select a.pod_service_id_0 from (SELECT service_id_0 AS `pod_service_id_0` FROM flow_log.`l7_flow_log` GROUP BY `service_id_0` LIMIT 10000) as a join (SELECT service_id_0 AS `pod_service_id_0` FROM flow_log.`l4_flow_log` GROUP BY `service_id_0` LIMIT 10000) as b on a.pod_service_id_0 = b.pod_service_id_0 where a.pod_service_id_0 = 'deepflow_subquery_0'"},
+	}, {
+		name:    "test_join_not_universal_tag",
+		input:   "SELECT a.pod_service_id_0 FROM (select pod_service_id_0 from l7_flow_log where pod_service_id_0 !=3 group by pod_service_id_0) AS a LEFT JOIN (select pod_service_id_0 from l7_flow_log where pod_service_id_0 !=3 group by pod_service_id_0) AS b ON a.pod_service_id_0 = b.l7_protocol",
+		wantErr: `{"Status":"INVALID_PARAMETERS","Message":"join column b.l7_protocol is not a universal tag"}`,
+	}, {
+		name:   "test_union",
+		input:  "select Sum(packet_count) as count from l4_packet UNION ALL select Sum(packet_count) as count from l7_packet",
+		output: []string{"(SELECT SUM(packet_count) AS `count` FROM flow_log.`l4_packet` LIMIT 10000) UNION ALL (SELECT SUM(packet_count) AS `count` FROM flow_log.`l7_packet` LIMIT 10000)"},
+	}, {
+		name:   "test_union_order_limit",
+		input:  "select Sum(packet_count) as count from l4_packet UNION ALL select Sum(packet_count) as count from l7_packet ORDER BY count DESC LIMIT 5",
+		output: []string{"SELECT * FROM ((SELECT SUM(packet_count) AS `count` FROM flow_log.`l4_packet` LIMIT 10000) UNION ALL (SELECT SUM(packet_count) AS `count` FROM flow_log.`l7_packet` LIMIT 10000)) order by count desc limit 5"},
+	}, {
+		name:    "test_join_outer_system_tables",
+		input:   "SELECT a.pod_service_id_0 FROM (select pod_service_id_0 from l7_flow_log group by pod_service_id_0) AS a INNER JOIN (select pod_service_id_0 from l4_flow_log group by pod_service_id_0) AS b ON a.pod_service_id_0 = b.pod_service_id_0 WHERE a.pod_service_id_0 IN (select name from system.tables)",
+		wantErr: `{"Status":"INVALID_PARAMETERS","Message":"outer condition (select name from system.` + "`tables`" + `) is not supported"}`,
+	}, {
+		name:    "test_join_outer_qualified_table",
+		input:   "SELECT system.tables.name FROM (select pod_service_id_0 from l7_flow_log group by pod_service_id_0) AS a INNER JOIN (select pod_service_id_0 from l4_flow_log group by pod_service_id_0) AS b ON a.pod_service_id_0 = b.pod_service_id_0",
+		wantErr: `{"Status":"INVALID_PARAMETERS","Message":"outer column system.` + "`tables`" + `.name must be qualified by subquery alias"}`,
+	}, {
+		name:    "test_join_outer_function",
+		input:   "SELECT a.pod_service_id_0, dictGet('flow_tag.pod_service_map', 'name', toUInt64(1)) AS name FROM (select pod_service_id_0 from l7_flow_log group by pod_service_id_0) AS a INNER JOIN (select pod_service_id_0 from l4_flow_log group by pod_service_id_0) AS b ON a.pod_service_id_0 = b.pod_service_id_0",
+		wantErr: `{"Status":"INVALID_PARAMETERS","Message":"outer select dictGet('flow_tag.pod_service_map', 'name', toUInt64(1)) as name must be a subquery column"}`,
+	}, {
+		name:    "test_union_order_by_function",
+		input:   "select Sum(packet_count) as count from l4_packet UNION ALL select Sum(packet_count) as count from l7_packet ORDER BY (select 1 from system.tables) DESC",
+		wantErr: `{"Status":"INVALID_PARAMETERS","Message":"union order by (select 1 from system.` + "`tables`" + `) must be a result column"}`,
 	}}
 )
 
@@ -643,6 +679,9 @@ func TestGetSql(t *testing.T) {
 		if strings.HasPrefix(pcase.input, "WITH") {
 			outSql, _, _, err = e.ParseWithSql(pcase.input)
 			out = append(out, outSql)
+		} else if strings.HasPrefix(pcase.name, "test_join") || strings.HasPrefix(pcase.name, "test_union") {
+			outSql, _, _, err = e.ParseJoinSql(pcase.input)
+			out = append(out, outSql)
 		} else if strings.Contains(pcase.input, "SLIMIT") || strings.Contains(pcase.input, "slimit") {
 			outSql, _, _, err = e.ParseSlimitSql(pcase.input, args)
 			out = append(out, outSql)
@@ -686,6 +725,32 @@ func TestGetSql(t *testing.T) {
 	}
 }
 
+func TestParseJoinSqlCallbacks(t *testing.T) {
+	Load()
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	mockDatasources()
+	mockNativeFields()
+
+	e := CHEngine{DB: "flow_log", Language: "en", Context: context.Background()}
+	e.Init()
+	sql := "SELECT a.capture_nic, b.tunnel_tx_mac_0 FROM (select pod_service_id_0, capture_nic from l7_flow_log group by pod_service_id_0, capture_nic) AS a INNER JOIN (select pod_service_id_0, tunnel_tx_mac_0 from l4_flow_log group by pod_service_id_0, tunnel_tx_mac_0) AS b ON a.pod_service_id_0 = b.pod_service_id_0"
+	_, callbacks, columnSchemaMap, err := e.ParseJoinSql(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, column := range []string{"capture_nic", "tunnel_tx_mac_0"} {
+		if _, ok := callbacks[column]; !ok {
+			t.Errorf("callback of %s not found, got %v", column, callbacks)
+		}
+	}
+	for _, column := range []string{"a.pod_service_id_0", "b.pod_service_id_0", "a.capture_nic", "b.tunnel_tx_mac_0"} {
+		if _, ok := columnSchemaMap[column]; !ok {
+			t.Errorf("column schema of %s not found", column)
+		}
+	}
+}
+
 /* func TestGetSqltest(t *testing.T) {
 	 for _, pcase := range parsetest {
 		 e := CHEngine{DB: "flow_log"}
@@ -32,6 +32,7 @@ import (
 	ctrCommon "github.com/deepflowio/deepflow/server/controller/common"
 	"github.com/deepflowio/deepflow/server/querier/common"
 	"github.com/deepflowio/deepflow/server/querier/config"
+	"github.com/deepflowio/deepflow/server/querier/quota"
 	"github.com/deepflowio/deepflow/server/querier/statsd"
 	"github.com/google/uuid"
 	logging "github.com/op/go-logging"
@@ -48,6 +49,8 @@ type QueryParams struct {
 	ColumnSchemaMap map[string]*common.ColumnSchema
 	ORGID           string
 	SimpleSql       bool
+	UserID          string
+	EnableQuota     bool // 是否启用查询配额检查，仅用于用户查询
 }
 
 // All ClickHouse Client share one connection
@@ -113,39 +116,16 @@ func (c *Client) Close() error {
 }
 
 func (c *Client) DoQuery(params *QueryParams) (result *common.Result, err error) {
-	sqlstr, callbacks, query_uuid, columnSchemaMap, simpleSql := params.Sql, params.Callbacks, params.QueryUUID, params.ColumnSchemaMap, params.SimpleSql
-	queryCacheStr := ""
-	if params.UseQueryCache {
-		queryCacheStr = " SETTINGS use_query_cache = true"
-		if version > ctrCommon.CLICK_HOUSE_VERSION {
-			queryCacheStr += ", query_cache_nondeterministic_function_handling = 'save'"
-		} else {
-			queryCacheStr += ", query_cache_store_results_of_queries_with_nondeterministic_functions = 1"
-		}
-		if params.QueryCacheTTL != "" {
-			queryCacheStr += fmt.Sprintf(", query_cache_ttl = %s", params.QueryCacheTTL)
-		}
-		sqlstr += queryCacheStr
-	}
-	// ORGID
-	if !simpleSql && params.ORGID != common.DEFAULT_ORG_ID && params.ORGID != "" {
-		orgIDInt, err := strconv.Atoi(params.ORGID)
-		if err != nil {
-			return nil, err
-		}
-		sqlstr = strings.ReplaceAll(sqlstr, "flow_tag", fmt.Sprintf("%04d_flow_tag", orgIDInt))
-	}
-	// live view
-	if version > ctrCommon.CLICK_HOUSE_VERSION {
-		sqlstr = strings.ReplaceAll(sqlstr, "app_label_live_view", "app_label_map")
-		sqlstr = strings.ReplaceAll(sqlstr, "target_label_live_view", "target_label_map")
-	}
-
+	callbacks, query_uuid, columnSchemaMap := params.Callbacks, params.QueryUUID, params.ColumnSchemaMap
 	err = c.init(query_uuid)
 	if err != nil {
 		return nil, err
 	}
 	defer c.Close()
+	sqlstr, err := c.transSql(params)
+	if err != nil {
+		return nil, err
+	}
 
 	start := time.Now()
 	ctx := c.Context
@@ -226,6 +206,96 @@ func (c *Client) DoQuery(params *QueryParams) (result *common.Result, err error)
 	return result, nil
 }
 
+// 补充多租户 flow_tag 库名、live view 表名、查询配额及查询缓存设置，需在 init 之后调用以获取 ClickHouse 版本
+func (c *Client) transSql(params *QueryParams) (string, error) {
+	sqlstr, simpleSql := params.Sql, params.SimpleSql
+	// ORGID
+	if !simpleSql && params.ORGID != common.DEFAULT_ORG_ID && params.ORGID != "" {
+		orgIDInt, err := strconv.Atoi(params.ORGID)
+		if err != nil {
+			return "", err
+		}
+		sqlstr = strings.ReplaceAll(sqlstr, "flow_tag", fmt.Sprintf("%04d_flow_tag", orgIDInt))
+	}
+	// live view
+	if version > ctrCommon.CLICK_HOUSE_VERSION {
+		sqlstr = strings.ReplaceAll(sqlstr, "app_label_live_view", "app_label_map")
+		sqlstr = strings.ReplaceAll(sqlstr, "target_label_live_view", "target_label_map")
+	}
+	settings := []string{}
+	// quota
+	if params.EnableQuota {
+		maxRowsRead, maxResultRows := quota.GetRowsLimits(params.ORGID, params.UserID)
+		if maxRowsRead > 0 {
+			err := c.checkEstimatedRows(sqlstr, params)
+			if err != nil {
+				return "", err
+			}
+			settings = append(settings, fmt.Sprintf("max_rows_to_read = %d", maxRowsRead), "read_overflow_mode = 'throw'")
+		}
+		if maxResultRows > 0 {
+			settings = append(settings, fmt.Sprintf("max_result_rows = %d", maxResultRows), "result_overflow_mode = 'throw'")
+		}
+	}
+	if params.UseQueryCache {
+		settings = append(settings, "use_query_cache = true")
+		if version > ctrCommon.CLICK_HOUSE_VERSION {
+			settings = append(settings, "query_cache_nondeterministic_function_handling = 'save'")
+		} else {
+			settings = append(settings, "query_cache_store_results_of_queries_with_nondeterministic_functions = 1")
+		}
+		if params.QueryCacheTTL != "" {
+			settings = append(settings, fmt.Sprintf("query_cache_ttl = %s", params.QueryCacheTTL))
+		}
+	}
+	if len(settings) > 0 {
+		sqlstr += " SETTINGS " + strings.Join(settings, ", ")
+	}
+	return sqlstr, nil
+}
+
+// checkEstimatedRows 执行前通过 EXPLAIN ESTIMATE 预估读取行数，预估失败时不拦截查询，由 max_rows_to_read 兜底
+func (c *Client) checkEstimatedRows(sqlstr string, params *QueryParams) error {
+	ctx := c.Context
+	if c.Context == nil {
+		ctx = context.Background()
+	}
+	rows, err := c.connection.Query(ctx, "EXPLAIN ESTIMATE "+sqlstr)
+	if err != nil {
+		log.Warningf("estimate query failed: %s, sql: %s, query_uuid: %s", err, sqlstr, params.QueryUUID)
+		return nil
+	}
+	defer rows.Close()
+	columns := rows.ColumnTypes()
+	rowsIndex := -1
+	columnValues := make([]interface{}, len(columns))
+	for i, column := range columns {
+		if column.Name() == "rows" {
+			rowsIndex = i
+		}
+		columnValues[i] = reflect.New(column.ScanType()).Interface()
+	}
+	if rowsIndex < 0 {
+		return nil
+	}
+	var estimatedRows uint64
+	for rows.Next() {
+		if err := rows.Scan(columnValues...); err != nil {
+			log.Warningf("estimate query failed: %s, sql: %s, query_uuid: %s", err, sqlstr, params.QueryUUID)
+			return nil
+		}
+		value := reflect.Indirect(reflect.ValueOf(columnValues[rowsIndex]))
+		switch value.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			estimatedRows += value.Uint()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			estimatedRows += uint64(value.Int())
+		}
+	}
+	c.Debug.EstimatedRows = estimatedRows
+	return quota.CheckEstimatedRows(params.ORGID, params.UserID, estimatedRows)
+}
+
 func (c *Client) GetVersion() (version string, err error) {
 	defer c.Close()
 	ctx := c.Context
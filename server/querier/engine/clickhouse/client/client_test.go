@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+
+	"github.com/deepflowio/deepflow/server/querier/common"
+	"github.com/deepflowio/deepflow/server/querier/config"
+)
+
+// 仅实现 EXPLAIN ESTIMATE 用到的方法
+type estimateConn struct {
+	driver.Conn
+	sql  string
+	rows []uint64
+	err  error
+}
+
+func (c *estimateConn) Query(ctx context.Context, query string, args ...interface{}) (driver.Rows, error) {
+	c.sql = query
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &estimateRows{rows: c.rows, index: -1}, nil
+}
+
+type estimateRows struct {
+	driver.Rows
+	rows  []uint64
+	index int
+}
+
+func (r *estimateRows) ColumnTypes() []driver.ColumnType {
+	return []driver.ColumnType{&estimateColumn{name: "table", scanType: reflect.TypeOf("")}, &estimateColumn{name: "rows", scanType: reflect.TypeOf(uint64(0))}}
+}
+
+func (r *estimateRows) Next() bool {
+	r.index++
+	return r.index < len(r.rows)
+}
+
+func (r *estimateRows) Scan(dest ...interface{}) error {
+	*dest[0].(*string) = "l7_flow_log_local"
+	*dest[1].(*uint64) = r.rows[r.index]
+	return nil
+}
+
+func (r *estimateRows) Close() error { return nil }
+
+type estimateColumn struct {
+	driver.ColumnType
+	name     string
+	scanType reflect.Type
+}
+
+func (c *estimateColumn) Name() string           { return c.name }
+func (c *estimateColumn) ScanType() reflect.Type { return c.scanType }
+
+func TestCheckEstimatedRows(t *testing.T) {
+	config.Cfg = &config.QuerierConfig{Quota: config.Quota{Enabled: true, Default: config.QuotaLimits{MaxRowsRead: 1000}}}
+	params := &QueryParams{ORGID: "1", QueryUUID: "q1"}
+	sql := "SELECT 1 FROM flow_log.l7_flow_log"
+
+	// 各分片预估行数累加后超出配额
+	conn := &estimateConn{rows: []uint64{600, 500}}
+	c := &Client{connection: conn, Debug: &Debug{}}
+	err := c.checkEstimatedRows(sql, params)
+	if e, ok := err.(*common.ServiceError); !ok || e.Status != common.QUOTA_EXCEEDED {
+		t.Errorf("estimated rows exceeded got %v", err)
+	}
+	if conn.sql != "EXPLAIN ESTIMATE "+sql || c.Debug.EstimatedRows != 1100 {
+		t.Errorf("estimate got sql %q, rows %d", conn.sql, c.Debug.EstimatedRows)
+	}
+
+	c = &Client{connection: &estimateConn{rows: []uint64{600, 400}}, Debug: &Debug{}}
+	if err := c.checkEstimatedRows(sql, params); err != nil {
+		t.Errorf("estimated rows within quota got %v", err)
+	}
+
+	// 预估失败时不拦截查询
+	c = &Client{connection: &estimateConn{err: errors.New("estimate failed")}, Debug: &Debug{}}
+	if err := c.checkEstimatedRows(sql, params); err != nil {
+		t.Errorf("estimate failed got %v", err)
+	}
+
+	// transSql 追加 max_rows_to_read 兜底
+	c = &Client{connection: &estimateConn{rows: []uint64{10}}, Debug: &Debug{}}
+	sqlstr, err := c.transSql(&QueryParams{Sql: sql, ORGID: "1", EnableQuota: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(sqlstr, " SETTINGS max_rows_to_read = 1000, read_overflow_mode = 'throw'") {
+		t.Errorf("transSql got %q", sqlstr)
+	}
+}
@@ -29,6 +29,8 @@ type Debug struct {
 	QueryTime string
 	QueryUUID string
 	Error     string
+	// EXPLAIN ESTIMATE 预估读取行数，仅在启用查询配额时有值
+	EstimatedRows uint64
 }
 
 type DebugInfo struct {
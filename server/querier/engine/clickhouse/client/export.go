@@ -0,0 +1,294 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	clickhouse "github.com/ClickHouse/clickhouse-go/v2"
+
+	"github.com/deepflowio/deepflow/server/querier/common"
+	"github.com/deepflowio/deepflow/server/querier/config"
+)
+
+const (
+	EXPORT_FORMAT_CSV    = "csv"
+	EXPORT_FORMAT_NDJSON = "ndjson"
+	EXPORT_FORMAT_ARROW  = "arrow"
+)
+
+// 导出格式与 ClickHouse 输出格式的对应关系
+var EXPORT_FORMAT_MAP = map[string]string{
+	EXPORT_FORMAT_CSV:    "CSVWithNames",
+	EXPORT_FORMAT_NDJSON: "JSONEachRow",
+	EXPORT_FORMAT_ARROW:  "ArrowStream",
+}
+
+var EXPORT_CONTENT_TYPE_MAP = map[string]string{
+	EXPORT_FORMAT_CSV:    "text/csv; charset=utf-8",
+	EXPORT_FORMAT_NDJSON: "application/x-ndjson",
+	EXPORT_FORMAT_ARROW:  "application/vnd.apache.arrow.stream",
+}
+
+// Export 通过 ClickHouse HTTP 接口执行查询，由 ClickHouse 完成格式转换，结果按块流式写入 w，
+// querier 不在内存中保留结果集；query_id 使用 QueryUUID，便于 KillQuery 取消
+// 存在 callbacks 时需与同步查询接口保持一致，改为查询完整结果并执行 callbacks 后由 querier 编码，不支持 arrow 格式
+func (c *Client) Export(params *QueryParams, format string, w io.Writer) (int64, error) {
+	chFormat, ok := EXPORT_FORMAT_MAP[format]
+	if !ok {
+		return 0, fmt.Errorf("unsupported export format: %s", format)
+	}
+	if len(params.Callbacks) > 0 {
+		return c.exportWithCallbacks(params, format, w)
+	}
+	err := c.init(params.QueryUUID)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+	sqlstr, err := c.transSql(params)
+	if err != nil {
+		return 0, err
+	}
+	c.Debug.Sql = sqlstr
+
+	ctx := c.Context
+	if c.Context == nil {
+		ctx = context.Background()
+	}
+	query := url.Values{}
+	query.Set("query_id", params.QueryUUID)
+	query.Set("default_format", chFormat)
+	query.Set("database", "default")
+	reqUrl := fmt.Sprintf("http://%s/?%s", net.JoinHostPort(c.Host, strconv.Itoa(config.Cfg.Clickhouse.HttpPort)), query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqUrl, strings.NewReader(sqlstr))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("X-ClickHouse-User", c.UserName)
+	req.Header.Set("X-ClickHouse-Key", c.Password)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Errorf("export clickhouse Error: %s, sql: %s, query_uuid: %s", err, sqlstr, params.QueryUUID)
+		c.Debug.Error = fmt.Sprintf("%s", err)
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		err = fmt.Errorf("clickhouse response %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		log.Errorf("export clickhouse Error: %s, sql: %s, query_uuid: %s", err, sqlstr, params.QueryUUID)
+		c.Debug.Error = fmt.Sprintf("%s", err)
+		return 0, err
+	}
+	written, err := io.Copy(w, resp.Body)
+	if err != nil {
+		c.Debug.Error = fmt.Sprintf("%s", err)
+		return written, err
+	}
+	log.Infof("query_uuid: %s. export statistics: %d bytes, format %s", params.QueryUUID, written, format)
+	return written, nil
+}
+
+func (c *Client) exportWithCallbacks(params *QueryParams, format string, w io.Writer) (int64, error) {
+	if format == EXPORT_FORMAT_ARROW {
+		return 0, common.NewError(common.INVALID_PARAMETERS, "arrow format is not supported for queries with result callbacks")
+	}
+	ctx := c.Context
+	if c.Context == nil {
+		ctx = context.Background()
+	}
+	c.Context = clickhouse.Context(ctx, clickhouse.WithQueryID(params.QueryUUID))
+	result, err := c.DoQuery(params)
+	if err != nil {
+		return 0, err
+	}
+	counter := &countWriter{w: w}
+	buf := bufio.NewWriter(counter)
+	if format == EXPORT_FORMAT_CSV {
+		err = EncodeCSV(result, buf)
+	} else {
+		err = EncodeNDJSON(result, buf)
+	}
+	if err == nil {
+		err = buf.Flush()
+	}
+	if err != nil {
+		c.Debug.Error = fmt.Sprintf("%s", err)
+		return counter.written, err
+	}
+	log.Infof("query_uuid: %s. export statistics: %d bytes, format %s", params.QueryUUID, counter.written, format)
+	return counter.written, nil
+}
+
+type countWriter struct {
+	w       io.Writer
+	written int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// EncodeCSV 按 CSVWithNames 格式输出，首行为列名
+func EncodeCSV(result *common.Result, w io.Writer) error {
+	csvWriter := csv.NewWriter(w)
+	record := make([]string, len(result.Columns))
+	for i, column := range result.Columns {
+		record[i] = fmt.Sprint(column)
+	}
+	if err := csvWriter.Write(record); err != nil {
+		return err
+	}
+	for _, value := range result.Values {
+		for i, v := range value.([]interface{}) {
+			record[i] = formatCSVValue(v)
+		}
+		if err := csvWriter.Write(record); err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+func formatCSVValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	case net.IP:
+		return v.String()
+	}
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return ""
+		}
+		return formatCSVValue(rv.Elem().Interface())
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(b)
+}
+
+// EncodeNDJSON 按 JSONEachRow 格式输出，每行一个按列顺序排列的 json 对象
+func EncodeNDJSON(result *common.Result, w io.Writer) error {
+	columns := make([][]byte, len(result.Columns))
+	for i, column := range result.Columns {
+		b, err := json.Marshal(fmt.Sprint(column))
+		if err != nil {
+			return err
+		}
+		columns[i] = b
+	}
+	for _, value := range result.Values {
+		line := []byte{'{'}
+		for i, v := range value.([]interface{}) {
+			if t, ok := v.(time.Time); ok {
+				v = t.Format("2006-01-02 15:04:05")
+			}
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				line = append(line, ',')
+			}
+			line = append(line, columns[i]...)
+			line = append(line, ':')
+			line = append(line, b...)
+		}
+		line = append(line, '}', '\n')
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func onCluster() string {
+	if config.Cfg.Clickhouse.ClusterName == "" {
+		return ""
+	}
+	return fmt.Sprintf(" ON CLUSTER `%s`", config.Cfg.Clickhouse.ClusterName)
+}
+
+func processesTable() string {
+	if config.Cfg.Clickhouse.ClusterName == "" {
+		return "system.processes"
+	}
+	return fmt.Sprintf("clusterAllReplicas(%s, system.processes)", common.QuoteString(config.Cfg.Clickhouse.ClusterName))
+}
+
+// KillQuery 终止 query_id 对应的 ClickHouse 查询，集群模式下在所有节点上终止该查询及其分布式子查询
+func (c *Client) KillQuery(queryUUID string) error {
+	err := c.init(queryUUID)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	ctx := c.Context
+	if c.Context == nil {
+		ctx = context.Background()
+	}
+	err = c.connection.Exec(ctx, fmt.Sprintf("KILL QUERY%s WHERE initial_query_id = ? ASYNC", onCluster()), queryUUID)
+	if err != nil {
+		log.Errorf("kill query failed: %s, query_uuid: %s", err, queryUUID)
+	}
+	return err
+}
+
+// GetQueryProgress 从 system.processes 获取正在执行的查询已读取的行数及预估总行数，集群模式下查询所有节点以找到发起查询的节点
+func (c *Client) GetQueryProgress(queryUUID string) (readRows uint64, totalRows uint64, err error) {
+	err = c.init(queryUUID)
+	if err != nil {
+		return
+	}
+	defer c.Close()
+	ctx := c.Context
+	if c.Context == nil {
+		ctx = context.Background()
+	}
+	row := c.connection.QueryRow(ctx, fmt.Sprintf("SELECT read_rows, total_rows_approx FROM %s WHERE query_id = ? LIMIT 1", processesTable()), queryUUID)
+	err = row.Scan(&readRows, &totalRows)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	return
+}
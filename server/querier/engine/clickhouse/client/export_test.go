@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/deepflowio/deepflow/server/querier/common"
+	"github.com/deepflowio/deepflow/server/querier/config"
+)
+
+func TestEncode(t *testing.T) {
+	var nullFloat *float64
+	result := &common.Result{
+		Columns: []interface{}{"time", "ip", "name", "count", "avg", "tags"},
+		Values: []interface{}{
+			[]interface{}{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), net.ParseIP("10.1.2.3"), `a,"b"`, uint64(3), nullFloat, []string{"x", "y"}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := EncodeCSV(result, &buf); err != nil {
+		t.Fatal(err)
+	}
+	wantCSV := "time,ip,name,count,avg,tags\n2024-01-02 03:04:05,10.1.2.3,\"a,\"\"b\"\"\",3,,\"[\"\"x\"\",\"\"y\"\"]\"\n"
+	if buf.String() != wantCSV {
+		t.Errorf("EncodeCSV got %q, want %q", buf.String(), wantCSV)
+	}
+
+	buf.Reset()
+	if err := EncodeNDJSON(result, &buf); err != nil {
+		t.Fatal(err)
+	}
+	wantNDJSON := `{"time":"2024-01-02 03:04:05","ip":"10.1.2.3","name":"a,\"b\"","count":3,"avg":null,"tags":["x","y"]}` + "\n"
+	if buf.String() != wantNDJSON {
+		t.Errorf("EncodeNDJSON got %q, want %q", buf.String(), wantNDJSON)
+	}
+}
+
+func TestExportWithCallbacksArrow(t *testing.T) {
+	c := &Client{}
+	params := &QueryParams{Callbacks: map[string]func(*common.Result) error{"time": func(*common.Result) error { return nil }}}
+	if _, err := c.Export(params, EXPORT_FORMAT_ARROW, &bytes.Buffer{}); err == nil {
+		t.Error("export arrow with callbacks should fail")
+	}
+}
+
+func TestClusterSql(t *testing.T) {
+	config.Cfg = &config.QuerierConfig{}
+	if onCluster() != "" || processesTable() != "system.processes" {
+		t.Errorf("single node got %q, %q", onCluster(), processesTable())
+	}
+	config.Cfg.Clickhouse.ClusterName = "df_cluster"
+	if onCluster() != " ON CLUSTER `df_cluster`" || processesTable() != "clusterAllReplicas('df_cluster', system.processes)" {
+		t.Errorf("cluster got %q, %q", onCluster(), processesTable())
+	}
+}
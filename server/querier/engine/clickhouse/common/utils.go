@@ -28,6 +28,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/deepflowio/deepflow/server/libs/auth"
 	"github.com/deepflowio/deepflow/server/querier/config"
 	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse/client"
 	logging "github.com/op/go-logging"
@@ -126,6 +127,7 @@ func GetDatasources(db string, table string, orgID string) ([]string, error) {
 			return datasources, err
 		}
 		request.Header.Set("X-Org-Id", orgID)
+		auth.SetInternalAuthorization(request)
 		response, err := client.Do(request)
 		if err != nil {
 			return datasources, err
@@ -184,6 +186,7 @@ func GetDatasourceInterval(db string, table string, name string, orgID string) (
 		return 1, err
 	}
 	reqest.Header.Set("X-Org-Id", orgID)
+	auth.SetInternalAuthorization(reqest)
 	response, err := client.Do(reqest)
 	if err != nil {
 		return 1, err
@@ -0,0 +1,507 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clickhouse
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+
+	"github.com/deepflowio/deepflow/server/querier/common"
+	"github.com/deepflowio/deepflow/server/querier/config"
+	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse/client"
+	chCommon "github.com/deepflowio/deepflow/server/querier/engine/clickhouse/common"
+	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse/view"
+	"github.com/deepflowio/deepflow/server/querier/parse"
+)
+
+var checkJoinSqlRegexp = regexp.MustCompile(`(?i)(\s(JOIN|UNION)\s|FROM\s*\()`)
+
+// JOIN 只允许在通用标签上关联，保证两侧的资源含义一致
+var JOIN_UNIVERSAL_TAGS = []string{
+	"time", "ip",
+	"region", "region_id", "az", "az_id", "host", "host_id", "chost", "chost_id",
+	"vpc", "vpc_id", "l3_epc", "l3_epc_id", "subnet", "subnet_id",
+	"pod_cluster", "pod_cluster_id", "pod_ns", "pod_ns_id", "pod_node", "pod_node_id",
+	"pod_group", "pod_group_id", "pod_service", "pod_service_id", "pod", "pod_id",
+	"pod_ingress", "pod_ingress_id", "gprocess", "gprocess_id",
+	"auto_instance", "auto_instance_id", "auto_instance_type",
+	"auto_service", "auto_service_id", "auto_service_type",
+}
+
+// 子查询翻译结果
+type subqueryResult struct {
+	sql    string
+	alias  string
+	from   *sqlparser.AliasedTableExpr // JOIN 时外层 FROM 中对应的节点，UNION 时为 nil
+	engine *CHEngine
+}
+
+func (e *CHEngine) QueryJoinSql(sql string, args *common.QuerierParams) (*common.Result, *client.Debug, error) {
+	sql, callbacks, columnSchemaMap, err := e.ParseJoinSql(sql)
+	if err != nil {
+		log.Error(err)
+		return nil, nil, err
+	}
+	if sql == "" {
+		return nil, nil, nil
+	}
+
+	query_uuid := args.QueryUUID
+	debug := &client.Debug{
+		IP:        config.Cfg.Clickhouse.Host,
+		QueryUUID: query_uuid,
+	}
+	debug.Sql = sql
+	chClient := client.Client{
+		Host:     config.Cfg.Clickhouse.Host,
+		Port:     config.Cfg.Clickhouse.Port,
+		UserName: config.Cfg.Clickhouse.User,
+		Password: config.Cfg.Clickhouse.Password,
+		DB:       e.DB,
+		Debug:    debug,
+		Context:  e.Context,
+	}
+	params := &client.QueryParams{
+		Sql:             sql,
+		UseQueryCache:   args.UseQueryCache,
+		QueryCacheTTL:   args.QueryCacheTTL,
+		Callbacks:       callbacks,
+		QueryUUID:       query_uuid,
+		ColumnSchemaMap: columnSchemaMap,
+		ORGID:           args.ORGID,
+		UserID:          args.UserID,
+		EnableQuota:     true,
+	}
+	rst, err := chClient.DoQuery(params)
+	if err != nil {
+		log.Error(err)
+		return nil, debug, err
+	}
+	return rst, debug, err
+}
+
+// ParseJoinSql 解析 FROM 中包含子查询、JOIN 以及 UNION ALL 的 sql
+// 每个子查询使用独立的 CHEngine 翻译，tag 翻译与字典查询在各自的表上生效；
+// 外层 SELECT/WHERE/ORDER BY/LIMIT 直接引用子查询的结果列，不再做翻译，因此只允许出现子查询别名下的列、常量与简单的逻辑比较，
+// 禁止函数与子查询，避免绕过 tag 翻译、数据库白名单与租户隔离访问 system 等库
+// 子查询可通过 <db>.<table> 指定数据库，例如 prometheus.node_cpu_seconds_total、flow_metrics.`application.1m`
+func (e *CHEngine) ParseJoinSql(sql string) (string, map[string]func(*common.Result) error, map[string]*common.ColumnSchema, error) {
+	if !checkJoinSqlRegexp.MatchString(sql) || strings.HasPrefix(strings.TrimSpace(strings.ToUpper(sql)), "SHOW") {
+		return "", nil, nil, nil
+	}
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		return "", nil, nil, nil
+	}
+	subqueries := []*subqueryResult{}
+	var outerSql string
+	switch stmt := stmt.(type) {
+	case *sqlparser.Union:
+		outerSql, err = e.parseUnion(stmt, &subqueries)
+	case *sqlparser.Select:
+		if !hasSubqueryFrom(stmt.From) {
+			return "", nil, nil, nil
+		}
+		aliases := []string{}
+		for _, from := range stmt.From {
+			err = e.parseJoinTableExpr(from, &subqueries, &aliases)
+			if err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = checkOuterSelect(stmt, aliases)
+		}
+		if err == nil {
+			outerSql = formatOuterSql(stmt, subqueries)
+		}
+	default:
+		return "", nil, nil, nil
+	}
+	if err != nil {
+		return "", nil, nil, err
+	}
+	// 合并各子查询的 callback 与列信息，同名列以先出现的子查询为准，JOIN 时另按 <alias>.<column> 区分
+	callbacks := make(map[string]func(*common.Result) error)
+	columnSchemaMap := make(map[string]*common.ColumnSchema)
+	for _, subquery := range subqueries {
+		for column, callback := range subquery.engine.View.GetCallbacks() {
+			if _, ok := callbacks[column]; !ok {
+				callbacks[column] = callback
+			}
+		}
+		for _, columnSchema := range subquery.engine.ColumnSchemas {
+			if subquery.alias != "" {
+				columnSchemaMap[fmt.Sprintf("%s.%s", subquery.alias, columnSchema.Name)] = columnSchema
+			}
+			if _, ok := columnSchemaMap[columnSchema.Name]; !ok {
+				columnSchemaMap[columnSchema.Name] = columnSchema
+			}
+		}
+	}
+	return outerSql, callbacks, columnSchemaMap, nil
+}
+
+// formatOuterSql 生成外层 sql，FROM 中的子查询替换为翻译后的 sql，
+// 在语法树上替换，不会影响外层条件中用户输入的字符串常量
+func formatOuterSql(stmt sqlparser.SQLNode, subqueries []*subqueryResult) string {
+	buf := sqlparser.NewTrackedBuffer(func(buf *sqlparser.TrackedBuffer, node sqlparser.SQLNode) {
+		if from, ok := node.(*sqlparser.AliasedTableExpr); ok {
+			for _, subquery := range subqueries {
+				if subquery.from == from {
+					buf.Myprintf("(%s)", subquery.sql)
+					if !from.As.IsEmpty() {
+						buf.Myprintf(" as %v", from.As)
+					}
+					return
+				}
+			}
+		}
+		node.Format(buf)
+	})
+	buf.Myprintf("%v", stmt)
+	return buf.String()
+}
+
+func hasSubqueryFrom(froms sqlparser.TableExprs) bool {
+	for _, from := range froms {
+		switch from := from.(type) {
+		case *sqlparser.AliasedTableExpr:
+			if _, ok := from.Expr.(*sqlparser.Subquery); ok {
+				return true
+			}
+		case *sqlparser.JoinTableExpr:
+			return true
+		case *sqlparser.ParenTableExpr:
+			if hasSubqueryFrom(from.Exprs) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (e *CHEngine) parseJoinTableExpr(from sqlparser.TableExpr, subqueries *[]*subqueryResult, aliases *[]string) error {
+	switch from := from.(type) {
+	case *sqlparser.AliasedTableExpr:
+		subquery, ok := from.Expr.(*sqlparser.Subquery)
+		if !ok {
+			errorMessage := fmt.Sprintf("join table %s must be a subquery", sqlparser.String(from))
+			return common.NewError(common.INVALID_PARAMETERS, errorMessage)
+		}
+		if _, err := e.parseSubquery(subquery.Select, subqueries); err != nil {
+			return err
+		}
+		(*subqueries)[len(*subqueries)-1].alias = from.As.String()
+		(*subqueries)[len(*subqueries)-1].from = from
+		*aliases = append(*aliases, from.As.String())
+	case *sqlparser.ParenTableExpr:
+		for _, expr := range from.Exprs {
+			if err := e.parseJoinTableExpr(expr, subqueries, aliases); err != nil {
+				return err
+			}
+		}
+	case *sqlparser.JoinTableExpr:
+		if !slices.Contains([]string{sqlparser.JoinStr, sqlparser.LeftJoinStr, sqlparser.RightJoinStr}, from.Join) {
+			errorMessage := fmt.Sprintf("join type %s is not supported", from.Join)
+			return common.NewError(common.INVALID_PARAMETERS, errorMessage)
+		}
+		if err := e.parseJoinTableExpr(from.LeftExpr, subqueries, aliases); err != nil {
+			return err
+		}
+		if err := e.parseJoinTableExpr(from.RightExpr, subqueries, aliases); err != nil {
+			return err
+		}
+		if slices.Contains(*aliases, "") {
+			return common.NewError(common.INVALID_PARAMETERS, "join subquery must have an alias")
+		}
+		if from.Condition.On == nil || len(from.Condition.Using) > 0 {
+			return common.NewError(common.INVALID_PARAMETERS, "join must use ON condition")
+		}
+		return checkJoinCondition(from.Condition.On, *aliases)
+	}
+	return nil
+}
+
+// ON 条件仅支持 AND 连接的等值比较，且两侧均为子查询结果中的通用标签
+func checkJoinCondition(expr sqlparser.Expr, aliases []string) error {
+	switch expr := expr.(type) {
+	case *sqlparser.AndExpr:
+		if err := checkJoinCondition(expr.Left, aliases); err != nil {
+			return err
+		}
+		return checkJoinCondition(expr.Right, aliases)
+	case *sqlparser.ParenExpr:
+		return checkJoinCondition(expr.Expr, aliases)
+	case *sqlparser.ComparisonExpr:
+		if expr.Operator != sqlparser.EqualStr {
+			break
+		}
+		left, leftOk := expr.Left.(*sqlparser.ColName)
+		right, rightOk := expr.Right.(*sqlparser.ColName)
+		if !leftOk || !rightOk {
+			break
+		}
+		for _, col := range []*sqlparser.ColName{left, right} {
+			if !slices.Contains(aliases, col.Qualifier.Name.String()) {
+				errorMessage := fmt.Sprintf("join column %s must be qualified by subquery alias", sqlparser.String(col))
+				return common.NewError(common.INVALID_PARAMETERS, errorMessage)
+			}
+			if !IsJoinUniversalTag(col.Name.String()) {
+				errorMessage := fmt.Sprintf("join column %s is not a universal tag", sqlparser.String(col))
+				return common.NewError(common.INVALID_PARAMETERS, errorMessage)
+			}
+		}
+		return nil
+	}
+	errorMessage := fmt.Sprintf("join condition %s is not supported", sqlparser.String(expr))
+	return common.NewError(common.INVALID_PARAMETERS, errorMessage)
+}
+
+// 外层查询仅允许引用子查询结果列
+func checkOuterSelect(stmt *sqlparser.Select, aliases []string) error {
+	if stmt.Lock != "" {
+		return common.NewError(common.INVALID_PARAMETERS, "lock is not supported")
+	}
+	for _, selectExpr := range stmt.SelectExprs {
+		switch selectExpr := selectExpr.(type) {
+		case *sqlparser.StarExpr:
+			if err := checkOuterQualifier(selectExpr.TableName, aliases, selectExpr); err != nil {
+				return err
+			}
+		case *sqlparser.AliasedExpr:
+			col, ok := selectExpr.Expr.(*sqlparser.ColName)
+			if !ok {
+				errorMessage := fmt.Sprintf("outer select %s must be a subquery column", sqlparser.String(selectExpr))
+				return common.NewError(common.INVALID_PARAMETERS, errorMessage)
+			}
+			if err := checkOuterQualifier(col.Qualifier, aliases, col); err != nil {
+				return err
+			}
+		default:
+			errorMessage := fmt.Sprintf("outer select %s is not supported", sqlparser.String(selectExpr))
+			return common.NewError(common.INVALID_PARAMETERS, errorMessage)
+		}
+	}
+	for _, where := range []*sqlparser.Where{stmt.Where, stmt.Having} {
+		if where == nil {
+			continue
+		}
+		if err := checkOuterCondition(where.Expr, aliases); err != nil {
+			return err
+		}
+	}
+	exprs := []sqlparser.Expr{}
+	exprs = append(exprs, stmt.GroupBy...)
+	for _, order := range stmt.OrderBy {
+		exprs = append(exprs, order.Expr)
+	}
+	for _, expr := range exprs {
+		col, ok := expr.(*sqlparser.ColName)
+		if !ok {
+			errorMessage := fmt.Sprintf("outer group by or order by %s must be a subquery column", sqlparser.String(expr))
+			return common.NewError(common.INVALID_PARAMETERS, errorMessage)
+		}
+		if err := checkOuterQualifier(col.Qualifier, aliases, col); err != nil {
+			return err
+		}
+	}
+	return checkLimit(stmt.Limit)
+}
+
+func checkOuterQualifier(qualifier sqlparser.TableName, aliases []string, node sqlparser.SQLNode) error {
+	if qualifier.IsEmpty() {
+		return nil
+	}
+	if !qualifier.Qualifier.IsEmpty() || !slices.Contains(aliases, qualifier.Name.String()) {
+		errorMessage := fmt.Sprintf("outer column %s must be qualified by subquery alias", sqlparser.String(node))
+		return common.NewError(common.INVALID_PARAMETERS, errorMessage)
+	}
+	return nil
+}
+
+// 外层 WHERE/HAVING 仅支持子查询结果列与常量之间的逻辑比较
+func checkOuterCondition(expr sqlparser.Expr, aliases []string) error {
+	var exprs []sqlparser.Expr
+	switch expr := expr.(type) {
+	case *sqlparser.ColName:
+		return checkOuterQualifier(expr.Qualifier, aliases, expr)
+	case *sqlparser.SQLVal, *sqlparser.NullVal, sqlparser.BoolVal:
+		return nil
+	case sqlparser.ValTuple:
+		exprs = expr
+	case *sqlparser.AndExpr:
+		exprs = []sqlparser.Expr{expr.Left, expr.Right}
+	case *sqlparser.OrExpr:
+		exprs = []sqlparser.Expr{expr.Left, expr.Right}
+	case *sqlparser.NotExpr:
+		exprs = []sqlparser.Expr{expr.Expr}
+	case *sqlparser.ParenExpr:
+		exprs = []sqlparser.Expr{expr.Expr}
+	case *sqlparser.IsExpr:
+		exprs = []sqlparser.Expr{expr.Expr}
+	case *sqlparser.RangeCond:
+		exprs = []sqlparser.Expr{expr.Left, expr.From, expr.To}
+	case *sqlparser.ComparisonExpr:
+		exprs = []sqlparser.Expr{expr.Left, expr.Right}
+		if expr.Escape != nil {
+			exprs = append(exprs, expr.Escape)
+		}
+	default:
+		errorMessage := fmt.Sprintf("outer condition %s is not supported", sqlparser.String(expr))
+		return common.NewError(common.INVALID_PARAMETERS, errorMessage)
+	}
+	for _, expr := range exprs {
+		if err := checkOuterCondition(expr, aliases); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkLimit(limit *sqlparser.Limit) error {
+	if limit == nil {
+		return nil
+	}
+	for _, expr := range []sqlparser.Expr{limit.Offset, limit.Rowcount} {
+		if expr == nil {
+			continue
+		}
+		if _, ok := expr.(*sqlparser.SQLVal); !ok {
+			errorMessage := fmt.Sprintf("limit %s is not supported", sqlparser.String(limit))
+			return common.NewError(common.INVALID_PARAMETERS, errorMessage)
+		}
+	}
+	return nil
+}
+
+func IsJoinUniversalTag(name string) bool {
+	name = strings.Trim(name, "`")
+	if slices.Contains(JOIN_UNIVERSAL_TAGS, name) {
+		return true
+	}
+	for _, suffix := range []string{"_0", "_1"} {
+		if strings.HasSuffix(name, suffix) && slices.Contains(JOIN_UNIVERSAL_TAGS, strings.TrimSuffix(name, suffix)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *CHEngine) parseUnion(stmt *sqlparser.Union, subqueries *[]*subqueryResult) (string, error) {
+	if stmt.Type != sqlparser.UnionAllStr {
+		errorMessage := fmt.Sprintf("%s is not supported, use union all", stmt.Type)
+		return "", common.NewError(common.INVALID_PARAMETERS, errorMessage)
+	}
+	sqls := []string{}
+	for _, side := range []sqlparser.SelectStatement{stmt.Left, stmt.Right} {
+		var sideSql string
+		var err error
+		if union, ok := side.(*sqlparser.Union); ok {
+			sideSql, err = e.parseUnion(union, subqueries)
+		} else {
+			sideSql, err = e.parseSubquery(side, subqueries)
+		}
+		if err != nil {
+			return "", err
+		}
+		sqls = append(sqls, sideSql)
+	}
+	unionSql := strings.Join(sqls, " UNION ALL ")
+	// 外层 ORDER BY 仅支持 UNION 结果列
+	for _, order := range stmt.OrderBy {
+		col, ok := order.Expr.(*sqlparser.ColName)
+		if !ok || !col.Qualifier.IsEmpty() {
+			errorMessage := fmt.Sprintf("union order by %s must be a result column", sqlparser.String(order.Expr))
+			return "", common.NewError(common.INVALID_PARAMETERS, errorMessage)
+		}
+	}
+	if err := checkLimit(stmt.Limit); err != nil {
+		return "", err
+	}
+	if len(stmt.OrderBy) > 0 || stmt.Limit != nil {
+		unionSql = fmt.Sprintf("SELECT * FROM (%s)%s%s", unionSql, sqlparser.String(stmt.OrderBy), sqlparser.String(stmt.Limit))
+	}
+	return unionSql, nil
+}
+
+// 使用独立的 CHEngine 翻译子查询，返回带括号的翻译结果
+func (e *CHEngine) parseSubquery(stmt sqlparser.SelectStatement, subqueries *[]*subqueryResult) (string, error) {
+	if paren, ok := stmt.(*sqlparser.ParenSelect); ok {
+		stmt = paren.Select
+	}
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok || len(sel.From) != 1 {
+		errorMessage := fmt.Sprintf("subquery %s is not supported", sqlparser.String(stmt))
+		return "", common.NewError(common.INVALID_PARAMETERS, errorMessage)
+	}
+	from, ok := sel.From[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		errorMessage := fmt.Sprintf("subquery %s is not supported", sqlparser.String(stmt))
+		return "", common.NewError(common.INVALID_PARAMETERS, errorMessage)
+	}
+	tableName, ok := from.Expr.(sqlparser.TableName)
+	if !ok {
+		errorMessage := fmt.Sprintf("nested subquery %s is not supported", sqlparser.String(stmt))
+		return "", common.NewError(common.INVALID_PARAMETERS, errorMessage)
+	}
+	db := e.DB
+	dataSource := e.DataSource
+	if !tableName.Qualifier.IsEmpty() {
+		db = tableName.Qualifier.String()
+		if _, ok := chCommon.DB_TABLE_MAP[db]; !ok {
+			errorMessage := fmt.Sprintf("db %s not found", db)
+			return "", common.NewError(common.RESOURCE_NOT_FOUND, errorMessage)
+		}
+		if db != e.DB {
+			dataSource = ""
+		}
+		table := tableName.Name.String()
+		// flow_metrics.`application.1m`
+		if db == chCommon.DB_NAME_FLOW_METRICS && strings.Contains(table, ".") {
+			tableSlice := strings.SplitN(table, ".", 2)
+			table, dataSource = tableSlice[0], tableSlice[1]
+		}
+		from.Expr = sqlparser.TableName{Name: sqlparser.NewTableIdent(table)}
+	}
+
+	subEngine := &CHEngine{DB: db, DataSource: dataSource, Context: e.Context, ORGID: e.ORGID, UserID: e.UserID, Language: e.Language, NoPreWhere: e.NoPreWhere}
+	subEngine.Init()
+	subParser := parse.Parser{Engine: subEngine}
+	err := subParser.ParseSQL(sqlparser.String(sel))
+	if err != nil {
+		return "", err
+	}
+	err = subEngine.CheckTimeRangeQuota()
+	if err != nil {
+		return "", err
+	}
+	for _, stmt := range subEngine.Statements {
+		stmt.Format(subEngine.Model)
+	}
+	FormatModel(subEngine.Model)
+	// 使用Model生成View
+	subEngine.View = view.NewView(subEngine.Model)
+	subEngine.View.NoPreWhere = subEngine.NoPreWhere
+	subquerySql := subEngine.ToSQLString()
+	*subqueries = append(*subqueries, &subqueryResult{sql: subquerySql, engine: subEngine})
+	return fmt.Sprintf("(%s)", subquerySql), nil
+}
@@ -84,7 +84,7 @@ func GetExtMetrics(db, table, where, queryCacheTTL, orgID string, useQueryCache
 		// native metrics
 		if config.ControllerCfg.DFWebService.Enabled {
 			getNativeUrl := fmt.Sprintf("http://localhost:%d/v1/native-fields/?db=%s&table_name=%s", config.ControllerCfg.ListenPort, db, table)
-			resp, err := ctlcommon.CURLPerform("GET", getNativeUrl, nil, ctlcommon.WithHeader(ctlcommon.HEADER_KEY_X_ORG_ID, orgID))
+			resp, err := ctlcommon.CURLPerform("GET", getNativeUrl, nil, ctlcommon.WithHeader(ctlcommon.HEADER_KEY_X_ORG_ID, orgID), ctlcommon.WithInternalAuthorization())
 			if err != nil {
 				log.Errorf("request controller failed: %s, URL: %s", resp, getNativeUrl)
 			} else {
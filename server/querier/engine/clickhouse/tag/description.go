@@ -1046,7 +1046,7 @@ func GetDynamicTagDescriptions(db, table, rawSql, queryCacheTTL, orgID string, u
 	// native tags
 	if config.ControllerCfg.DFWebService.Enabled {
 		getNativeUrl := fmt.Sprintf("http://localhost:%d/v1/native-fields/?db=%s&table_name=%s", config.ControllerCfg.ListenPort, db, table)
-		resp, nativeErr := ctlcommon.CURLPerform("GET", getNativeUrl, nil, ctlcommon.WithHeader(ctlcommon.HEADER_KEY_X_ORG_ID, orgID))
+		resp, nativeErr := ctlcommon.CURLPerform("GET", getNativeUrl, nil, ctlcommon.WithHeader(ctlcommon.HEADER_KEY_X_ORG_ID, orgID), ctlcommon.WithInternalAuthorization())
 		if nativeErr != nil {
 			log.Errorf("request controller failed: %s, URL: %s", resp, getNativeUrl)
 		} else {
@@ -1338,7 +1338,7 @@ func GetTagValues(db, table, sql, queryCacheTTL, orgID, language string, useQuer
 		// native tag
 		if config.ControllerCfg.DFWebService.Enabled {
 			getNativeUrl := fmt.Sprintf("http://localhost:%d/v1/native-fields/?db=%s&table_name=%s", config.ControllerCfg.ListenPort, db, table)
-			resp, err := ctlcommon.CURLPerform("GET", getNativeUrl, nil, ctlcommon.WithHeader(ctlcommon.HEADER_KEY_X_ORG_ID, orgID))
+			resp, err := ctlcommon.CURLPerform("GET", getNativeUrl, nil, ctlcommon.WithHeader(ctlcommon.HEADER_KEY_X_ORG_ID, orgID), ctlcommon.WithInternalAuthorization())
 			if err != nil {
 				log.Errorf("request controller failed: %s, URL: %s", resp, getNativeUrl)
 			} else {
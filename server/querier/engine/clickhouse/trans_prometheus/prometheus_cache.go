@@ -51,7 +51,7 @@ type AppLabel struct {
 
 func GenerateOrgMap() {
 	getOrgUrl := fmt.Sprintf("http://localhost:%d/v1/orgs/", config.ControllerCfg.ListenPort)
-	resp, err := common.CURLPerform("GET", getOrgUrl, nil)
+	resp, err := common.CURLPerform("GET", getOrgUrl, nil, common.WithInternalAuthorization())
 	if err != nil {
 		log.Warningf("request controller failed: %s, URL: %s", resp, getOrgUrl)
 		return
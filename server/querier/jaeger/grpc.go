@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jaeger
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	jaegerpb "github.com/deepflowio/deepflow/message/jaeger"
+	"github.com/deepflowio/deepflow/server/libs/auth"
+	"github.com/deepflowio/deepflow/server/querier/common"
+)
+
+// QueryService 实现Jaeger的api_v2.QueryService
+type QueryService struct{}
+
+func StartGrpcServer(port int, opts ...grpc.ServerOption) {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		log.Errorf("jaeger grpc listen failed: %v", err)
+		return
+	}
+	server := grpc.NewServer(opts...)
+	jaegerpb.RegisterQueryServiceServer(server, &QueryService{})
+	log.Infof("listening and serving jaeger query GRPC on: %d", port)
+	if err := server.Serve(lis); err != nil {
+		log.Errorf("jaeger grpc serve failed: %v", err)
+	}
+}
+
+func (s *QueryService) GetTrace(req *jaegerpb.GetTraceRequest, stream jaegerpb.QueryService_GetTraceServer) error {
+	args := &common.JaegerParams{
+		TraceId:   TraceIDFromBytes(req.TraceId),
+		StartTime: timestampToUs(req.StartTime),
+		EndTime:   timestampToUs(req.EndTime),
+		OrgID:     auth.GRPCOrgID(stream.Context()),
+		Context:   stream.Context(),
+	}
+	trace, err := GetTrace(args)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if trace == nil {
+		return status.Errorf(codes.NotFound, "trace %s not found", args.TraceId)
+	}
+	return stream.Send(&jaegerpb.SpansResponseChunk{Spans: trace.ToProto()})
+}
+
+func (s *QueryService) ArchiveTrace(ctx context.Context, req *jaegerpb.ArchiveTraceRequest) (*jaegerpb.ArchiveTraceResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "archive storage is not supported")
+}
+
+func (s *QueryService) FindTraces(req *jaegerpb.FindTracesRequest, stream jaegerpb.QueryService_FindTracesServer) error {
+	query := req.Query
+	if query == nil {
+		return status.Error(codes.InvalidArgument, "missing query")
+	}
+	args := &common.JaegerParams{
+		Service:     query.ServiceName,
+		Operation:   query.OperationName,
+		Tags:        query.Tags,
+		StartTime:   timestampToUs(query.StartTimeMin),
+		EndTime:     timestampToUs(query.StartTimeMax),
+		MinDuration: durationToUs(query.DurationMin),
+		MaxDuration: durationToUs(query.DurationMax),
+		Limit:       int(query.SearchDepth),
+		OrgID:       auth.GRPCOrgID(stream.Context()),
+		Context:     stream.Context(),
+	}
+	traces, err := FindTraces(args)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	for _, trace := range traces {
+		if err := stream.Send(&jaegerpb.SpansResponseChunk{Spans: trace.ToProto()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *QueryService) GetServices(ctx context.Context, req *jaegerpb.GetServicesRequest) (*jaegerpb.GetServicesResponse, error) {
+	services, err := GetServices(&common.JaegerParams{OrgID: auth.GRPCOrgID(ctx), Context: ctx})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &jaegerpb.GetServicesResponse{Services: services}, nil
+}
+
+func (s *QueryService) GetOperations(ctx context.Context, req *jaegerpb.GetOperationsRequest) (*jaegerpb.GetOperationsResponse, error) {
+	operations, err := GetOperations(&common.JaegerParams{Service: req.Service, SpanKind: req.SpanKind, OrgID: auth.GRPCOrgID(ctx), Context: ctx})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	resp := &jaegerpb.GetOperationsResponse{}
+	names := map[string]bool{}
+	for _, o := range operations {
+		if !names[o.Name] {
+			names[o.Name] = true
+			resp.OperationNames = append(resp.OperationNames, o.Name)
+		}
+		resp.Operations = append(resp.Operations, &jaegerpb.Operation{Name: o.Name, SpanKind: o.SpanKind})
+	}
+	return resp, nil
+}
+
+func (s *QueryService) GetDependencies(ctx context.Context, req *jaegerpb.GetDependenciesRequest) (*jaegerpb.GetDependenciesResponse, error) {
+	links, err := GetDependencies(&common.JaegerParams{
+		StartTime: timestampToUs(req.StartTime),
+		EndTime:   timestampToUs(req.EndTime),
+		OrgID:     auth.GRPCOrgID(ctx),
+		Context:   ctx,
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	resp := &jaegerpb.GetDependenciesResponse{}
+	for _, l := range links {
+		resp.Dependencies = append(resp.Dependencies, &jaegerpb.DependencyLink{Parent: l.Parent, Child: l.Child, CallCount: l.CallCount})
+	}
+	return resp, nil
+}
@@ -0,0 +1,322 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jaeger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	logging "github.com/op/go-logging"
+
+	"github.com/deepflowio/deepflow/server/querier/common"
+	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse"
+	"github.com/deepflowio/deepflow/server/querier/tempo"
+)
+
+var log = logging.MustGetLogger("querier.jaeger")
+
+const (
+	DEFAULT_LIMIT = 20
+	// 每个trace查询的span数倍数，用于按trace_id去重
+	TRACE_SEARCH_FACTOR = 10
+	// 并发请求deepflow-app的数量
+	TRACE_FETCH_CONCURRENCY = 8
+	DEPENDENCIES_SPAN_LIMIT = 100000
+	// services和operations接口没有时间参数，查询最近的数据
+	SERVICE_LOOKBACK = 24 * time.Hour
+	DEFAULT_LOOKBACK = time.Hour
+)
+
+// 从tag名到TraceQL属性的映射，其余tag按span/resource属性查询
+var TAG_ATTRIBUTE_MAP = map[string]string{
+	"span.kind": "kind",
+}
+
+var executeQuery = func(sql string, args *common.JaegerParams) (*common.Result, map[string]interface{}, error) {
+	querierArgs := common.QuerierParams{
+		DB:         "flow_log",
+		Sql:        sql,
+		DataSource: "",
+		Debug:      args.Debug,
+		QueryUUID:  uuid.New().String(),
+		ORGID:      args.OrgID,
+		Context:    args.Context,
+	}
+	ckEngine := &clickhouse.CHEngine{DB: querierArgs.DB, DataSource: querierArgs.DataSource}
+	ckEngine.Init()
+	result, debug, err := ckEngine.ExecuteQuery(&querierArgs)
+	if err != nil {
+		log.Errorf("%v %v", debug, err)
+	}
+	return result, debug, err
+}
+
+var l7TracingRequest = tempo.L7TracingRequest
+
+// timeFilters 未指定时间时使用[now-lookback, now]，time字段单位为秒
+func timeFilters(args *common.JaegerParams, lookback time.Duration) []string {
+	end := args.EndTime
+	if end <= 0 {
+		end = time.Now().UnixMicro()
+	}
+	start := args.StartTime
+	if start <= 0 {
+		start = end - lookback.Microseconds()
+	}
+	return []string{
+		fmt.Sprintf("time>=%d", start/1000000),
+		fmt.Sprintf("time<=%d", (end+999999)/1000000),
+	}
+}
+
+func tagFilter(key, value string) (string, error) {
+	if key == "error" {
+		if value == "true" {
+			return "response_status IN (3,4)", nil
+		}
+		return "response_status NOT IN (3,4)", nil
+	}
+	attribute, ok := TAG_ATTRIBUTE_MAP[key]
+	if !ok {
+		attribute = "." + key
+	}
+	return tempo.NewTraceQLEqualCondition(attribute, value).ToSQL()
+}
+
+func GetServices(args *common.JaegerParams) ([]string, error) {
+	filters := append([]string{"app_service != ''"}, timeFilters(args, SERVICE_LOOKBACK)...)
+	sql := fmt.Sprintf(
+		"select app_service from l7_flow_log WHERE %s GROUP BY app_service LIMIT 10000",
+		strings.Join(filters, " AND "),
+	)
+	result, _, err := executeQuery(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	services := []string{}
+	for _, d := range result.Values {
+		services = append(services, toString(d.([]interface{})[0]))
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+func GetOperations(args *common.JaegerParams) ([]*Operation, error) {
+	filters := append([]string{
+		fmt.Sprintf("app_service=%s", common.QuoteString(args.Service)), "endpoint != ''",
+	}, timeFilters(args, SERVICE_LOOKBACK)...)
+	if args.SpanKind != "" {
+		condition, err := tempo.NewTraceQLEqualCondition("kind", args.SpanKind).ToSQL()
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, condition)
+	}
+	sql := fmt.Sprintf(
+		"select endpoint, span_kind from l7_flow_log WHERE %s GROUP BY endpoint, span_kind LIMIT 10000",
+		strings.Join(filters, " AND "),
+	)
+	result, _, err := executeQuery(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	kinds := map[int64]string{}
+	for k, v := range tempo.TRACEQL_KIND_MAP {
+		kinds[int64(v)] = k
+	}
+	operations := []*Operation{}
+	for _, d := range result.Values {
+		value := d.([]interface{})
+		kind := kinds[toInt64(value[1])]
+		if kind == "unspecified" {
+			kind = ""
+		}
+		operations = append(operations, &Operation{Name: toString(value[0]), SpanKind: kind})
+	}
+	sort.SliceStable(operations, func(i, j int) bool {
+		if operations[i].Name != operations[j].Name {
+			return operations[i].Name < operations[j].Name
+		}
+		return operations[i].SpanKind < operations[j].SpanKind
+	})
+	return operations, nil
+}
+
+// findTraceIDs 按开始时间倒序查询满足条件的trace_id
+func findTraceIDs(args *common.JaegerParams) ([]string, error) {
+	filters := append([]string{"trace_id != ''"}, timeFilters(args, DEFAULT_LOOKBACK)...)
+	if args.Service != "" {
+		filters = append(filters, fmt.Sprintf("app_service=%s", common.QuoteString(args.Service)))
+	}
+	if args.Operation != "" {
+		filters = append(filters, fmt.Sprintf("endpoint=%s", common.QuoteString(args.Operation)))
+	}
+	keys := make([]string, 0, len(args.Tags))
+	for k := range args.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		condition, err := tagFilter(k, args.Tags[k])
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, condition)
+	}
+	if args.MinDuration > 0 {
+		filters = append(filters, fmt.Sprintf("response_duration>=%d", args.MinDuration))
+	}
+	if args.MaxDuration > 0 {
+		filters = append(filters, fmt.Sprintf("response_duration<=%d", args.MaxDuration))
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = DEFAULT_LIMIT
+	}
+	sql := fmt.Sprintf(
+		"select trace_id, toUnixTimestamp64Micro(start_time) as startTimeUs from l7_flow_log WHERE %s ORDER BY startTimeUs desc LIMIT %d",
+		strings.Join(filters, " AND "), limit*TRACE_SEARCH_FACTOR,
+	)
+	result, _, err := executeQuery(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	traceIDs := []string{}
+	exists := map[string]bool{}
+	for _, d := range result.Values {
+		traceID := toString(d.([]interface{})[0])
+		if exists[traceID] {
+			continue
+		}
+		exists[traceID] = true
+		traceIDs = append(traceIDs, traceID)
+		if len(traceIDs) >= limit {
+			break
+		}
+	}
+	return traceIDs, nil
+}
+
+func FindTraces(args *common.JaegerParams) ([]*Trace, error) {
+	traceIDs, err := findTraceIDs(args)
+	if err != nil {
+		return nil, err
+	}
+	traces := make([]*Trace, len(traceIDs))
+	errs := make([]error, len(traceIDs))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, TRACE_FETCH_CONCURRENCY)
+	for i, traceID := range traceIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, traceID string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			traceArgs := *args
+			traceArgs.TraceId = traceID
+			traces[i], errs[i] = GetTrace(&traceArgs)
+		}(i, traceID)
+	}
+	wg.Wait()
+	result := []*Trace{}
+	for i, trace := range traces {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if trace != nil {
+			result = append(result, trace)
+		}
+	}
+	return result, nil
+}
+
+// GetTrace 通过deepflow-app的L7FlowTracing查询完整的trace，未找到时返回nil
+func GetTrace(args *common.JaegerParams) (*Trace, error) {
+	tempoArgs := &common.TempoParams{
+		TraceId: args.TraceId,
+		OrgID:   args.OrgID,
+		Context: args.Context,
+	}
+	if args.StartTime > 0 {
+		tempoArgs.StartTime = args.StartTime / 1000000
+	}
+	if args.EndTime > 0 {
+		tempoArgs.EndTime = (args.EndTime + 999999) / 1000000
+	}
+	data, err := l7TracingRequest(tempoArgs)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	trace := ConvertL7Tracing(data, args.TraceId)
+	if len(trace.Spans) == 0 {
+		return nil, nil
+	}
+	return trace, nil
+}
+
+// GetDependencies 根据span的父子关系统计服务之间的调用次数
+func GetDependencies(args *common.JaegerParams) ([]*DependencyLink, error) {
+	filters := append([]string{"app_service != ''", "span_id != ''"}, timeFilters(args, SERVICE_LOOKBACK)...)
+	sql := fmt.Sprintf(
+		"select trace_id, span_id, parent_span_id, app_service from l7_flow_log WHERE %s LIMIT %d",
+		strings.Join(filters, " AND "), DEPENDENCIES_SPAN_LIMIT,
+	)
+	result, _, err := executeQuery(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	type spanKey struct {
+		traceID string
+		spanID  string
+	}
+	services := map[spanKey]string{}
+	for _, d := range result.Values {
+		value := d.([]interface{})
+		services[spanKey{toString(value[0]), toString(value[1])}] = toString(value[3])
+	}
+	callCounts := map[[2]string]uint64{}
+	for _, d := range result.Values {
+		value := d.([]interface{})
+		parentSpanID := toString(value[2])
+		if parentSpanID == "" {
+			continue
+		}
+		parent, ok := services[spanKey{toString(value[0]), parentSpanID}]
+		child := toString(value[3])
+		if !ok || parent == child {
+			continue
+		}
+		callCounts[[2]string{parent, child}]++
+	}
+	links := make([]*DependencyLink, 0, len(callCounts))
+	for k, count := range callCounts {
+		links = append(links, &DependencyLink{Parent: k[0], Child: k[1], CallCount: count})
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Parent != links[j].Parent {
+			return links[i].Parent < links[j].Parent
+		}
+		return links[i].Child < links[j].Child
+	})
+	return links, nil
+}
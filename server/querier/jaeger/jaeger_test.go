@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jaeger
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	jaegerpb "github.com/deepflowio/deepflow/message/jaeger"
+	"github.com/deepflowio/deepflow/server/querier/common"
+)
+
+const testTracing = `{"services": [], "tracing": [
+{"start_time_us": 1669188027800930, "end_time_us": 1669188027825683, "tap_side": "s-app", "l7_protocol_str": "http", "endpoint": "/v1/alarm", "request_type": "GET", "response_status": 3, "response_code": 500, "trace_id": "5455e8b558250c7bfd2eed1bba623314", "service_uname": "statistics", "app_instance": "pod-1", "deepflow_span_id": "98576ec1ece19bb2", "deepflow_parent_span_id": "", "attributes": "{\"k8s.pod\":\"pod-1\"}"},
+{"start_time_us": 1669188027800900, "end_time_us": 1669188027825700, "tap_side": "c-nd", "l7_protocol_str": "http", "endpoint": "", "request_resource": "/v1/alarm", "trace_id": "5455e8b558250c7bfd2eed1bba623314", "service_uname": "", "auto_instance": "node-1", "deepflow_span_id": "N0000000000000000012", "deepflow_parent_span_id": "98576ec1ece19bb2"},
+{"start_time_us": 1669188027801000, "end_time_us": 1669188027801100, "tap_side": "c-app", "endpoint": "select", "trace_id": "5455e8b558250c7bfd2eed1bba623314", "service_uname": "statistics", "app_instance": "pod-1", "deepflow_span_id": "00000000000000a1", "deepflow_parent_span_id": "missing"}
+]}`
+
+func TestConvertL7Tracing(t *testing.T) {
+	var data map[string]interface{}
+	json.Unmarshal([]byte(testTracing), &data)
+	trace := ConvertL7Tracing(data, "5455e8b5-5825-0c7b-fd2e-ed1bba623314")
+	if trace.TraceID != "5455e8b5-5825-0c7b-fd2e-ed1bba623314" || len(trace.Spans) != 3 || len(trace.Processes) != 2 {
+		t.Fatalf("unexpected trace %+v", trace)
+	}
+	// eBPF span按开始时间排在最前，服务名使用auto_instance，引用应用span为父节点
+	ebpf := trace.Spans[0]
+	if trace.Processes[ebpf.ProcessID].ServiceName != "node-1" || ebpf.OperationName != "/v1/alarm" || len(ebpf.SpanID) != 16 {
+		t.Errorf("unexpected ebpf span %+v", ebpf)
+	}
+	if len(ebpf.References) != 1 || ebpf.References[0].SpanID != "98576ec1ece19bb2" {
+		t.Errorf("unexpected ebpf span references %+v", ebpf.References)
+	}
+	app := trace.Spans[1]
+	if app.Duration != 24753 || len(app.References) != 0 {
+		t.Errorf("unexpected app span %+v", app)
+	}
+	tags := map[string]interface{}{}
+	for _, kv := range app.Tags {
+		tags[kv.Key] = kv.Value
+	}
+	if tags["span.kind"] != "server" || tags["error"] != true || tags["response_code"] != int64(500) || tags["k8s.pod"] != "pod-1" {
+		t.Errorf("unexpected app span tags %+v", tags)
+	}
+	// 父span不在trace中时不生成引用
+	if len(trace.Spans[2].References) != 0 {
+		t.Errorf("unexpected references %+v", trace.Spans[2].References)
+	}
+
+	spans := trace.ToProto()
+	if len(spans) != 3 || len(spans[0].TraceId) != 16 || len(spans[0].SpanId) != 8 || spans[0].Process.ServiceName != "node-1" {
+		t.Errorf("unexpected proto spans %+v", spans)
+	}
+	if TraceIDFromBytes(idBytes("a1b2c3d4e5f60718", 16)) != "a1b2c3d4e5f60718" {
+		t.Errorf("64bit trace id should be restored")
+	}
+}
+
+func TestFindTraces(t *testing.T) {
+	var sqls []string
+	executeQuery = func(sql string, args *common.JaegerParams) (*common.Result, map[string]interface{}, error) {
+		if args.OrgID != "2" {
+			t.Errorf("query should be executed in org 2, got %q", args.OrgID)
+		}
+		sqls = append(sqls, sql)
+		return &common.Result{Values: []interface{}{
+			[]interface{}{"5455e8b558250c7bfd2eed1bba623314", int64(3)},
+			[]interface{}{"5455e8b558250c7bfd2eed1bba623314", int64(2)},
+			[]interface{}{"6455e8b558250c7bfd2eed1bba623314", int64(1)},
+		}}, nil, nil
+	}
+	l7TracingRequest = func(args *common.TempoParams) (map[string]interface{}, error) {
+		if args.TraceId != "5455e8b558250c7bfd2eed1bba623314" || args.StartTime != 1669188000 || args.OrgID != "2" {
+			return nil, nil
+		}
+		var data map[string]interface{}
+		json.Unmarshal([]byte(testTracing), &data)
+		return data, nil
+	}
+	traces, err := FindTraces(&common.JaegerParams{
+		Service:     "statistics",
+		Tags:        map[string]string{"http.status_code": "500", "error": "true", "span.kind": "server"},
+		StartTime:   1669188000000000,
+		EndTime:     1669189000000000,
+		MinDuration: 1000,
+		Limit:       2,
+		OrgID:       "2",
+	})
+	if err != nil || len(traces) != 1 {
+		t.Fatalf("unexpected traces %v %v", traces, err)
+	}
+	expected := "select trace_id, toUnixTimestamp64Micro(start_time) as startTimeUs from l7_flow_log WHERE trace_id != '' AND time>=1669188000 AND time<=1669189000 AND app_service='statistics' AND response_status IN (3,4) AND response_code=500 AND span_kind=2 AND response_duration>=1000 ORDER BY startTimeUs desc LIMIT 20"
+	if len(sqls) != 1 || sqls[0] != expected {
+		t.Errorf("\nExpect: %s\nActual: %s", expected, strings.Join(sqls, "\n"))
+	}
+}
+
+type testSpansStream struct {
+	grpc.ServerStream
+	chunks []*jaegerpb.SpansResponseChunk
+}
+
+func (s *testSpansStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *testSpansStream) Send(chunk *jaegerpb.SpansResponseChunk) error {
+	s.chunks = append(s.chunks, chunk)
+	return nil
+}
+
+// FindTraces返回的trace_id通过GetTrace查询时应还原为原始的trace_id
+func TestTraceIDRoundTrip(t *testing.T) {
+	traceIDs := []string{
+		"5455E8B5-5825-0C7B-FD2E-ED1BBA623314", // 大写的UUID
+		"ebpf-3f2a1b",                          // 非十六进制
+		"0000000000000000a1b2c3d4e5f60718",     // 高64位为0的128位trace_id
+		"1a2b3c4d5e6f7081",
+	}
+	executeQuery = func(sql string, args *common.JaegerParams) (*common.Result, map[string]interface{}, error) {
+		result := &common.Result{}
+		for i, traceID := range traceIDs {
+			result.Values = append(result.Values, []interface{}{traceID, int64(len(traceIDs) - i)})
+		}
+		return result, nil, nil
+	}
+	var lock sync.Mutex
+	var requested []string
+	l7TracingRequest = func(args *common.TempoParams) (map[string]interface{}, error) {
+		lock.Lock()
+		requested = append(requested, args.TraceId)
+		lock.Unlock()
+		for _, traceID := range traceIDs {
+			if args.TraceId == traceID {
+				var data map[string]interface{}
+				json.Unmarshal([]byte(testTracing), &data)
+				return data, nil
+			}
+		}
+		return nil, nil
+	}
+
+	// HTTP接口返回原始的trace_id
+	traces, err := FindTraces(&common.JaegerParams{Limit: len(traceIDs)})
+	if err != nil || len(traces) != len(traceIDs) {
+		t.Fatalf("unexpected traces %v %v", traces, err)
+	}
+	for i, trace := range traces {
+		if trace.TraceID != traceIDs[i] {
+			t.Errorf("trace id %s should be kept, got %s", traceIDs[i], trace.TraceID)
+		}
+	}
+
+	service := &QueryService{}
+	found := &testSpansStream{}
+	query := &jaegerpb.FindTracesRequest{Query: &jaegerpb.TraceQueryParameters{SearchDepth: int32(len(traceIDs))}}
+	if err := service.FindTraces(query, found); err != nil || len(found.chunks) != len(traceIDs) {
+		t.Fatalf("unexpected chunks %v %v", found.chunks, err)
+	}
+	for i, chunk := range found.chunks {
+		requested = nil
+		got := &testSpansStream{}
+		if err := service.GetTrace(&jaegerpb.GetTraceRequest{TraceId: chunk.Spans[0].TraceId}, got); err != nil {
+			t.Errorf("get trace %s failed: %v", traceIDs[i], err)
+			continue
+		}
+		if len(requested) != 1 || requested[0] != traceIDs[i] || len(got.chunks) != 1 {
+			t.Errorf("trace id %s should be restored, requested %v", traceIDs[i], requested)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jaeger
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+
+	jaegerpb "github.com/deepflowio/deepflow/message/jaeger"
+)
+
+// Jaeger HTTP API的数据结构，参考jaeger-query的model/json
+
+type Trace struct {
+	TraceID   string              `json:"traceID"`
+	Spans     []*Span             `json:"spans"`
+	Processes map[string]*Process `json:"processes"`
+	Warnings  []string            `json:"warnings"`
+}
+
+type Span struct {
+	TraceID       string      `json:"traceID"`
+	SpanID        string      `json:"spanID"`
+	OperationName string      `json:"operationName"`
+	References    []Reference `json:"references"`
+	StartTime     int64       `json:"startTime"` // 单位：微秒
+	Duration      int64       `json:"duration"`  // 单位：微秒
+	Tags          []KeyValue  `json:"tags"`
+	Logs          []Log       `json:"logs"`
+	ProcessID     string      `json:"processID"`
+	Warnings      []string    `json:"warnings"`
+}
+
+type Reference struct {
+	RefType string `json:"refType"`
+	TraceID string `json:"traceID"`
+	SpanID  string `json:"spanID"`
+}
+
+type KeyValue struct {
+	Key   string      `json:"key"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+type Log struct {
+	Timestamp int64      `json:"timestamp"`
+	Fields    []KeyValue `json:"fields"`
+}
+
+type Process struct {
+	ServiceName string     `json:"serviceName"`
+	Tags        []KeyValue `json:"tags"`
+}
+
+type Operation struct {
+	Name     string `json:"name"`
+	SpanKind string `json:"spanKind"`
+}
+
+type DependencyLink struct {
+	Parent    string `json:"parent"`
+	Child     string `json:"child"`
+	CallCount uint64 `json:"callCount"`
+}
+
+type Response struct {
+	Data   interface{}     `json:"data"`
+	Total  int             `json:"total"`
+	Limit  int             `json:"limit"`
+	Offset int             `json:"offset"`
+	Errors []ResponseError `json:"errors"`
+}
+
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Msg     string `json:"msg"`
+	TraceID string `json:"traceID,omitempty"`
+}
+
+const (
+	VALUE_TYPE_STRING  = "string"
+	VALUE_TYPE_BOOL    = "bool"
+	VALUE_TYPE_INT64   = "int64"
+	VALUE_TYPE_FLOAT64 = "float64"
+
+	REF_TYPE_CHILD_OF = "CHILD_OF"
+
+	// gRPC返回的trace_id无法直接还原为原始trace_id时，保留映射的时间
+	TRACE_ID_CACHE_EXPIRATION = time.Hour
+)
+
+// gRPC中trace_id的bytes -> 原始trace_id，如大写或UUID格式的trace_id、eBPF生成的非十六进制trace_id。
+// 映射只保存在当前querier的内存中，gRPC的FindTraces和GetTrace需由同一个querier处理
+var traceIDCache = cache.New(TRACE_ID_CACHE_EXPIRATION, TRACE_ID_CACHE_EXPIRATION)
+
+// deepflow-app返回的span中作为tag的字段
+var SPAN_TAG_FIELDS = []string{
+	"tap_side", "l7_protocol_str", "request_type", "request_resource", "response_status", "response_code", "endpoint",
+}
+
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int8:
+		return int64(n)
+	case int16:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case uint8:
+		return int64(n)
+	case uint16:
+		return int64(n)
+	case uint32:
+		return int64(n)
+	case uint64:
+		return int64(n)
+	case float32:
+		return int64(n)
+	case float64:
+		return int64(n)
+	case string:
+		i, _ := strconv.ParseInt(n, 10, 64)
+		return i
+	}
+	return 0
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// normalizeTraceID 去掉UUID格式中的'-'并转为小写
+func normalizeTraceID(traceID string) string {
+	return strings.ToLower(strings.ReplaceAll(traceID, "-", ""))
+}
+
+// idBytes 十六进制的ID左侧补0到指定长度，否则(如eBPF span的ID)使用hash，保证同一ID转换结果一致，
+// 转换不可逆，trace_id需使用traceIDBytes
+func idBytes(id string, length int) []byte {
+	id = normalizeTraceID(id)
+	if isHex(id) && len(id) <= length*2 {
+		b, _ := hex.DecodeString(strings.Repeat("0", length*2-len(id)) + id)
+		return b
+	}
+	if length == 8 {
+		h := fnv.New64a()
+		h.Write([]byte(id))
+		return h.Sum(nil)
+	}
+	h := fnv.New128a()
+	h.Write([]byte(id))
+	return h.Sum(nil)
+}
+
+func spanIDString(id string) string {
+	return hex.EncodeToString(idBytes(id, 8))
+}
+
+// traceIDBytes 转换为gRPC中的trace_id，无法由TraceIDFromBytes直接还原时记录映射
+func traceIDBytes(traceID string) []byte {
+	b := idBytes(traceID, 16)
+	if hexTraceID(b) != traceID {
+		traceIDCache.SetDefault(string(b), traceID)
+	}
+	return b
+}
+
+// hexTraceID 64位的trace_id会被补齐为128位，需去掉前缀的0
+func hexTraceID(b []byte) string {
+	id := hex.EncodeToString(b)
+	if len(b) == 16 && strings.HasPrefix(id, strings.Repeat("0", 16)) {
+		return id[16:]
+	}
+	return id
+}
+
+// TraceIDFromBytes gRPC请求中的trace_id转为原始的trace_id
+func TraceIDFromBytes(b []byte) string {
+	if traceID, ok := traceIDCache.Get(string(b)); ok {
+		return traceID.(string)
+	}
+	return hexTraceID(b)
+}
+
+// spanKind 根据tap_side推断span.kind，s-*为服务端，c-*为客户端
+func spanKind(tapSide string) string {
+	switch {
+	case tapSide == "app":
+		return "internal"
+	case strings.HasPrefix(tapSide, "s"):
+		return "server"
+	case strings.HasPrefix(tapSide, "c"):
+		return "client"
+	}
+	return ""
+}
+
+// ConvertL7Tracing 将deepflow-app L7FlowTracing的返回转换为Jaeger trace，
+// 包括没有应用span的eBPF/网络span，其服务名使用auto_instance。
+// trace_id保持原样返回，以便通过GetTrace再次查询
+func ConvertL7Tracing(data map[string]interface{}, traceID string) *Trace {
+	trace := &Trace{
+		TraceID:   traceID,
+		Spans:     []*Span{},
+		Processes: map[string]*Process{},
+		Warnings:  []string{},
+	}
+	tracing, _ := data["tracing"].([]interface{})
+	processIDs := map[string]string{}
+	spanIDs := map[string]bool{}
+	parentIDs := map[*Span]string{}
+	for _, t := range tracing {
+		s, ok := t.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id := toString(s["deepflow_span_id"])
+		if id == "" {
+			id = toString(s["span_id"])
+		}
+		if id == "" {
+			id = toString(s["_id"])
+		}
+		serviceName := toString(s["service_uname"])
+		if serviceName == "" {
+			serviceName = toString(s["app_service"])
+		}
+		if serviceName == "" {
+			serviceName = toString(s["auto_instance"])
+		}
+		if serviceName == "" {
+			serviceName = "unknown"
+		}
+		instance := toString(s["app_instance"])
+		if instance == "" {
+			instance = toString(s["auto_instance"])
+		}
+		processKey := serviceName + "/" + instance
+		processID, ok := processIDs[processKey]
+		if !ok {
+			processID = fmt.Sprintf("p%d", len(processIDs)+1)
+			processIDs[processKey] = processID
+			process := &Process{ServiceName: serviceName, Tags: []KeyValue{}}
+			if instance != "" {
+				process.Tags = append(process.Tags, KeyValue{Key: "service.instance.id", Type: VALUE_TYPE_STRING, Value: instance})
+			}
+			trace.Processes[processID] = process
+		}
+
+		operationName := toString(s["endpoint"])
+		if operationName == "" {
+			operationName = toString(s["request_resource"])
+		}
+		if operationName == "" {
+			operationName = toString(s["l7_protocol_str"])
+		}
+		startTime := toInt64(s["start_time_us"])
+		span := &Span{
+			TraceID:       trace.TraceID,
+			SpanID:        spanIDString(id),
+			OperationName: operationName,
+			References:    []Reference{},
+			StartTime:     startTime,
+			Duration:      toInt64(s["end_time_us"]) - startTime,
+			Tags:          spanTags(s),
+			Logs:          []Log{},
+			ProcessID:     processID,
+			Warnings:      []string{},
+		}
+		spanIDs[span.SpanID] = true
+		if parentID := toString(s["deepflow_parent_span_id"]); parentID != "" {
+			parentIDs[span] = spanIDString(parentID)
+		}
+		trace.Spans = append(trace.Spans, span)
+	}
+	// 只引用trace中存在的父span，避免Jaeger UI提示无效的父节点
+	for span, parentID := range parentIDs {
+		if spanIDs[parentID] {
+			span.References = append(span.References, Reference{RefType: REF_TYPE_CHILD_OF, TraceID: trace.TraceID, SpanID: parentID})
+		}
+	}
+	sort.SliceStable(trace.Spans, func(i, j int) bool {
+		return trace.Spans[i].StartTime < trace.Spans[j].StartTime
+	})
+	return trace
+}
+
+func spanTags(s map[string]interface{}) []KeyValue {
+	tags := []KeyValue{}
+	if kind := spanKind(toString(s["tap_side"])); kind != "" {
+		tags = append(tags, KeyValue{Key: "span.kind", Type: VALUE_TYPE_STRING, Value: kind})
+	}
+	for _, field := range SPAN_TAG_FIELDS {
+		switch v := s[field].(type) {
+		case nil:
+		case string:
+			if v != "" {
+				tags = append(tags, KeyValue{Key: field, Type: VALUE_TYPE_STRING, Value: v})
+			}
+		case float64:
+			tags = append(tags, KeyValue{Key: field, Type: VALUE_TYPE_INT64, Value: int64(v)})
+		default:
+			tags = append(tags, KeyValue{Key: field, Type: VALUE_TYPE_STRING, Value: toString(v)})
+		}
+	}
+	// response_status 3:服务端异常 4:客户端异常
+	if status := toInt64(s["response_status"]); status == 3 || status == 4 {
+		tags = append(tags, KeyValue{Key: "error", Type: VALUE_TYPE_BOOL, Value: true})
+	}
+	if attrs, ok := s["attributes"].(string); ok && attrs != "" {
+		var attributes map[string]interface{}
+		json.Unmarshal([]byte(attrs), &attributes)
+		keys := make([]string, 0, len(attributes))
+		for k := range attributes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			tags = append(tags, KeyValue{Key: k, Type: VALUE_TYPE_STRING, Value: toString(attributes[k])})
+		}
+	}
+	return tags
+}
+
+func usToTimestamp(us int64) *jaegerpb.Timestamp {
+	return &jaegerpb.Timestamp{Seconds: us / 1000000, Nanos: int32(us%1000000) * 1000}
+}
+
+func usToDuration(us int64) *jaegerpb.Duration {
+	return &jaegerpb.Duration{Seconds: us / 1000000, Nanos: int32(us%1000000) * 1000}
+}
+
+func timestampToUs(t *jaegerpb.Timestamp) int64 {
+	if t == nil {
+		return 0
+	}
+	return t.Seconds*1000000 + int64(t.Nanos)/1000
+}
+
+func durationToUs(d *jaegerpb.Duration) int64 {
+	if d == nil {
+		return 0
+	}
+	return d.Seconds*1000000 + int64(d.Nanos)/1000
+}
+
+func keyValuesToProto(kvs []KeyValue) []*jaegerpb.KeyValue {
+	result := make([]*jaegerpb.KeyValue, 0, len(kvs))
+	for _, kv := range kvs {
+		pkv := &jaegerpb.KeyValue{Key: kv.Key}
+		switch v := kv.Value.(type) {
+		case bool:
+			pkv.VType = jaegerpb.ValueType_BOOL
+			pkv.VBool = v
+		case int64:
+			pkv.VType = jaegerpb.ValueType_INT64
+			pkv.VInt64 = v
+		case float64:
+			pkv.VType = jaegerpb.ValueType_FLOAT64
+			pkv.VFloat64 = v
+		default:
+			pkv.VType = jaegerpb.ValueType_STRING
+			pkv.VStr = toString(v)
+		}
+		result = append(result, pkv)
+	}
+	return result
+}
+
+// ToProto 转换为gRPC QueryService返回的span，process直接填充到每个span中
+func (t *Trace) ToProto() []*jaegerpb.Span {
+	traceID := traceIDBytes(t.TraceID)
+	spans := make([]*jaegerpb.Span, 0, len(t.Spans))
+	for _, s := range t.Spans {
+		span := &jaegerpb.Span{
+			TraceId:       traceID,
+			SpanId:        idBytes(s.SpanID, 8),
+			OperationName: s.OperationName,
+			StartTime:     usToTimestamp(s.StartTime),
+			Duration:      usToDuration(s.Duration),
+			Tags:          keyValuesToProto(s.Tags),
+			ProcessId:     s.ProcessID,
+			Warnings:      s.Warnings,
+		}
+		for _, r := range s.References {
+			span.References = append(span.References, &jaegerpb.SpanRef{
+				TraceId: traceID,
+				SpanId:  idBytes(r.SpanID, 8),
+				RefType: jaegerpb.SpanRefType_CHILD_OF,
+			})
+		}
+		if p, ok := t.Processes[s.ProcessID]; ok {
+			span.Process = &jaegerpb.Process{ServiceName: p.ServiceName, Tags: keyValuesToProto(p.Tags)}
+		}
+		spans = append(spans, span)
+	}
+	return spans
+}
@@ -17,6 +17,8 @@
 package parse
 
 import (
+	"fmt"
+
 	"github.com/xwb1989/sqlparser"
 
 	"github.com/deepflowio/deepflow/server/querier/engine"
@@ -38,7 +40,10 @@ func (p *Parser) ParseSQL(sql string) error {
 		return err
 	}
 
-	pStmt := stmt.(*sqlparser.Select)
+	pStmt, ok := stmt.(*sqlparser.Select)
+	if !ok {
+		return fmt.Errorf("unsupported statement: %s", sqlparser.String(stmt))
+	}
 	// From解析
 	if pStmt.From != nil {
 		fromErr := p.Engine.TransFrom(pStmt.From)
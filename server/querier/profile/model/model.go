@@ -32,6 +32,13 @@ type Profile struct {
 	MaxKernelStackDepth *int `json:"max_kernel_stack_depth"` // default: -1
 }
 
+// ProfileDiff 对比两次查询的火焰图，通常为不同时间范围或不同过滤条件（如两个版本、两个pod）
+type ProfileDiff struct {
+	Baseline   Profile `json:"baseline" binding:"required"`
+	Comparison Profile `json:"comparison" binding:"required"`
+	Debug      bool    `json:"debug"`
+}
+
 type ProfileGrafana struct {
 	Sql              string `json:"sql" binding:"required"` // profile filter
 	ProfileEventType string `json:"profile_event_type" binding:"required"`
@@ -66,6 +73,14 @@ type ProfileTree struct {
 	NodeValues     Value    `json:"node_values"`
 }
 
+// ProfileDiffTree 合并后的火焰图，每个节点同时包含基准和对比的值，两侧均不存在的值为0
+type ProfileDiffTree struct {
+	Functions      []string `json:"functions"`
+	FunctionTypes  []string `json:"function_types"`
+	FunctionValues Value    `json:"function_values"`
+	NodeValues     Value    `json:"node_values"`
+}
+
 type Value struct {
 	Columns []string `json:"columns"`
 	Values  [][]int  `json:"values"`
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import "context"
+
+// PyroscopeParams 时间单位均为秒
+type PyroscopeParams struct {
+	Query         string // /pyroscope/render的query，格式为<app_service>.<profile_event_type>{label="value"}
+	ProfileTypeID string // Connect接口的profile_typeID，格式为<language>:<event_type>:<unit>:<event_type>:<unit>
+	LabelSelector string
+	LabelName     string
+	Start         int64
+	End           int64
+	MaxNodes      int
+	GroupBy       []string
+	Step          int64
+	Average       bool
+	Debug         bool
+	OrgID         string
+	Context       context.Context
+}
+
+// 以下为/pyroscope/render返回的FlamebearerProfile格式
+type FlamebearerProfile struct {
+	Version     int                 `json:"version"`
+	Flamebearer Flamebearer         `json:"flamebearer"`
+	Metadata    FlamebearerMetadata `json:"metadata"`
+	Timeline    FlamebearerTimeline `json:"timeline"`
+}
+
+type Flamebearer struct {
+	Names    []string  `json:"names"`
+	Levels   [][]int64 `json:"levels"`
+	NumTicks int64     `json:"numTicks"`
+	MaxSelf  int64     `json:"maxSelf"`
+}
+
+type FlamebearerMetadata struct {
+	Format     string `json:"format"`
+	SpyName    string `json:"spyName"`
+	SampleRate int    `json:"sampleRate"`
+	Units      string `json:"units"`
+	Name       string `json:"name"`
+}
+
+type FlamebearerTimeline struct {
+	StartTime     int64   `json:"startTime"`
+	Samples       []int64 `json:"samples"`
+	DurationDelta int64   `json:"durationDelta"`
+}
+
+type PyroscopeProfileType struct {
+	ID         string
+	Name       string
+	SampleType string
+	SampleUnit string
+}
+
+type PyroscopePoint struct {
+	Timestamp int64 // 毫秒
+	Value     float64
+}
+
+type PyroscopeSeries struct {
+	Labels map[string]string
+	Points []PyroscopePoint
+}
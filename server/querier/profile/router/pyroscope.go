@@ -0,0 +1,375 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package router
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+
+	"github.com/deepflowio/deepflow/message/pyroscope"
+	"github.com/deepflowio/deepflow/server/querier/config"
+	"github.com/deepflowio/deepflow/server/querier/profile/common"
+	"github.com/deepflowio/deepflow/server/querier/profile/model"
+	"github.com/deepflowio/deepflow/server/querier/profile/service"
+)
+
+const (
+	PYROSCOPE_DEFAULT_LOOKBACK = time.Hour
+
+	CONNECT_CONTENT_TYPE_PROTO = "application/proto"
+	CONNECT_CONTENT_TYPE_JSON  = "application/json"
+
+	CONNECT_CODE_INVALID_ARGUMENT = "invalid_argument"
+	CONNECT_CODE_UNIMPLEMENTED    = "unimplemented"
+	CONNECT_CODE_INTERNAL         = "internal"
+)
+
+func pyroscopeRouter(e *gin.Engine, cfg *config.QuerierConfig) {
+	e.GET("/pyroscope/render", pyroscopeRender(cfg))
+	e.GET("/pyroscope/labels", pyroscopeLabels())
+	e.GET("/pyroscope/label-values", pyroscopeLabelValues())
+	// Grafana Pyroscope数据源使用的Connect协议unary接口
+	e.POST("/querier.v1.QuerierService/:method", pyroscopeConnect(cfg))
+}
+
+// parsePyroscopeTime 支持now、now-<duration>、秒或毫秒时间戳
+func parsePyroscopeTime(value string, defaultTime time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultTime, nil
+	}
+	now := time.Now()
+	if value == "now" {
+		return now, nil
+	}
+	if strings.HasPrefix(value, "now-") {
+		durationStr := strings.TrimPrefix(value, "now-")
+		// time.ParseDuration不支持天
+		if strings.HasSuffix(durationStr, "d") {
+			days, err := strconv.Atoi(strings.TrimSuffix(durationStr, "d"))
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid time %q", value)
+			}
+			return now.Add(-time.Duration(days) * 24 * time.Hour), nil
+		}
+		d, err := time.ParseDuration(durationStr)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %q", value)
+		}
+		return now.Add(-d), nil
+	}
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", value)
+	}
+	if i > 1e12 {
+		return time.UnixMilli(i), nil
+	}
+	return time.Unix(i, 0), nil
+}
+
+func parsePyroscopeParams(c *gin.Context) (*model.PyroscopeParams, error) {
+	args := &model.PyroscopeParams{
+		Query:   c.Query("query"),
+		OrgID:   c.Request.Header.Get(common.HEADER_KEY_X_ORG_ID),
+		Context: c.Request.Context(),
+	}
+	args.Debug, _ = strconv.ParseBool(c.Query("debug"))
+	until, err := parsePyroscopeTime(c.Query("until"), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	from, err := parsePyroscopeTime(c.Query("from"), until.Add(-PYROSCOPE_DEFAULT_LOOKBACK))
+	if err != nil {
+		return nil, err
+	}
+	args.Start, args.End = from.Unix(), until.Unix()
+	if maxNodes := c.Query("max-nodes"); maxNodes != "" {
+		args.MaxNodes, _ = strconv.Atoi(maxNodes)
+	} else if maxNodes := c.Query("maxNodes"); maxNodes != "" {
+		args.MaxNodes, _ = strconv.Atoi(maxNodes)
+	}
+	return args, nil
+}
+
+func pyroscopeRender(cfg *config.QuerierConfig) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args, err := parsePyroscopeParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if args.Query == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "query is required"})
+			return
+		}
+		result, err := service.PyroscopeRender(args, cfg)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	})
+}
+
+func pyroscopeLabels() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args, err := parsePyroscopeParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		result, err := service.PyroscopeLabelNames(args)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	})
+}
+
+func pyroscopeLabelValues() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args, err := parsePyroscopeParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		args.LabelName = c.Query("label")
+		if args.LabelName == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "label is required"})
+			return
+		}
+		result, err := service.PyroscopeLabelValues(args)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	})
+}
+
+type connectError struct {
+	status int
+	code   string
+	err    error
+}
+
+func (e *connectError) Error() string {
+	return e.err.Error()
+}
+
+func newConnectError(status int, code string, err error) *connectError {
+	return &connectError{status: status, code: code, err: err}
+}
+
+// connectTimeRange 将毫秒时间范围转换为秒，end向上取整
+func connectTimeRange(start, end int64) (int64, int64) {
+	if end <= 0 {
+		end = time.Now().UnixMilli()
+	}
+	if start <= 0 {
+		start = end - PYROSCOPE_DEFAULT_LOOKBACK.Milliseconds()
+	}
+	return start / 1000, (end + 999) / 1000
+}
+
+// matchersToSelector 合并多个{...}选择器中的匹配条件
+func matchersToSelector(matchers []string) string {
+	parts := []string{}
+	for _, m := range matchers {
+		m = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(m), "{"), "}"))
+		if m != "" {
+			parts = append(parts, m)
+		}
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func pyroscopeConnect(cfg *config.QuerierConfig) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		contentType := c.ContentType()
+		if contentType != CONNECT_CONTENT_TYPE_PROTO && contentType != CONNECT_CONTENT_TYPE_JSON {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"code": CONNECT_CODE_UNIMPLEMENTED, "message": fmt.Sprintf("unsupported content-type %s", contentType)})
+			return
+		}
+		var reader io.Reader = c.Request.Body
+		if c.GetHeader("Content-Encoding") == "gzip" {
+			gzipReader, err := gzip.NewReader(c.Request.Body)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"code": CONNECT_CODE_INVALID_ARGUMENT, "message": err.Error()})
+				return
+			}
+			defer gzipReader.Close()
+			reader = gzipReader
+		}
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": CONNECT_CODE_INVALID_ARGUMENT, "message": err.Error()})
+			return
+		}
+		decode := func(m proto.Message) error {
+			if contentType == CONNECT_CONTENT_TYPE_JSON {
+				unmarshaler := jsonpb.Unmarshaler{AllowUnknownFields: true}
+				return unmarshaler.Unmarshal(bytes.NewReader(body), m)
+			}
+			return proto.Unmarshal(body, m)
+		}
+
+		resp, err := handleConnectMethod(c, cfg, c.Param("method"), decode)
+		if err != nil {
+			connectErr, ok := err.(*connectError)
+			if !ok {
+				connectErr = newConnectError(http.StatusInternalServerError, CONNECT_CODE_INTERNAL, err)
+			}
+			c.JSON(connectErr.status, gin.H{"code": connectErr.code, "message": connectErr.Error()})
+			return
+		}
+		if contentType == CONNECT_CONTENT_TYPE_JSON {
+			marshaler := jsonpb.Marshaler{}
+			data, err := marshaler.MarshalToString(resp)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"code": CONNECT_CODE_INTERNAL, "message": err.Error()})
+				return
+			}
+			c.Data(http.StatusOK, CONNECT_CONTENT_TYPE_JSON, []byte(data))
+			return
+		}
+		data, err := proto.Marshal(resp)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": CONNECT_CODE_INTERNAL, "message": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, CONNECT_CONTENT_TYPE_PROTO, data)
+	})
+}
+
+func handleConnectMethod(c *gin.Context, cfg *config.QuerierConfig, method string, decode func(proto.Message) error) (proto.Message, error) {
+	args := &model.PyroscopeParams{
+		OrgID:   c.Request.Header.Get(common.HEADER_KEY_X_ORG_ID),
+		Context: c.Request.Context(),
+	}
+	invalid := func(err error) error {
+		return newConnectError(http.StatusBadRequest, CONNECT_CODE_INVALID_ARGUMENT, err)
+	}
+	switch method {
+	case "ProfileTypes":
+		req := &pyroscope.ProfileTypesRequest{}
+		if err := decode(req); err != nil {
+			return nil, invalid(err)
+		}
+		args.Start, args.End = connectTimeRange(req.Start, req.End)
+		types, err := service.PyroscopeProfileTypes(args)
+		if err != nil {
+			return nil, err
+		}
+		resp := &pyroscope.ProfileTypesResponse{}
+		for _, t := range types {
+			resp.ProfileTypes = append(resp.ProfileTypes, &pyroscope.ProfileType{
+				ID: t.ID, Name: t.Name, SampleType: t.SampleType, SampleUnit: t.SampleUnit, PeriodType: t.SampleType, PeriodUnit: t.SampleUnit,
+			})
+		}
+		return resp, nil
+	case "LabelNames":
+		req := &pyroscope.LabelNamesRequest{}
+		if err := decode(req); err != nil {
+			return nil, invalid(err)
+		}
+		args.Start, args.End = connectTimeRange(req.Start, req.End)
+		args.LabelSelector = matchersToSelector(req.Matchers)
+		names, err := service.PyroscopeLabelNames(args)
+		if err != nil {
+			return nil, invalid(err)
+		}
+		return &pyroscope.LabelNamesResponse{Names: names}, nil
+	case "LabelValues":
+		req := &pyroscope.LabelValuesRequest{}
+		if err := decode(req); err != nil {
+			return nil, invalid(err)
+		}
+		args.Start, args.End = connectTimeRange(req.Start, req.End)
+		args.LabelSelector = matchersToSelector(req.Matchers)
+		args.LabelName = req.Name
+		values, err := service.PyroscopeLabelValues(args)
+		if err != nil {
+			return nil, invalid(err)
+		}
+		return &pyroscope.LabelValuesResponse{Names: values}, nil
+	case "SelectMergeStacktraces":
+		req := &pyroscope.SelectMergeStacktracesRequest{}
+		if err := decode(req); err != nil {
+			return nil, invalid(err)
+		}
+		if _, _, err := service.ParseProfileTypeID(req.ProfileTypeID); err != nil {
+			return nil, invalid(err)
+		}
+		args.Start, args.End = connectTimeRange(req.Start, req.End)
+		args.ProfileTypeID = req.ProfileTypeID
+		args.LabelSelector = req.LabelSelector
+		args.MaxNodes = int(req.MaxNodes)
+		flamebearer, err := service.PyroscopeFlameGraph(args, cfg)
+		if err != nil {
+			return nil, err
+		}
+		flamegraph := &pyroscope.FlameGraph{Names: flamebearer.Names, Total: flamebearer.NumTicks, MaxSelf: flamebearer.MaxSelf}
+		for _, level := range flamebearer.Levels {
+			flamegraph.Levels = append(flamegraph.Levels, &pyroscope.Level{Values: level})
+		}
+		return &pyroscope.SelectMergeStacktracesResponse{Flamegraph: flamegraph}, nil
+	case "SelectSeries":
+		req := &pyroscope.SelectSeriesRequest{}
+		if err := decode(req); err != nil {
+			return nil, invalid(err)
+		}
+		if _, _, err := service.ParseProfileTypeID(req.ProfileTypeID); err != nil {
+			return nil, invalid(err)
+		}
+		args.Start, args.End = connectTimeRange(req.Start, req.End)
+		args.ProfileTypeID = req.ProfileTypeID
+		args.LabelSelector = req.LabelSelector
+		args.GroupBy = req.GroupBy
+		args.Step = int64(req.Step)
+		args.Average = req.Aggregation == pyroscope.TimeSeriesAggregationType_TIME_SERIES_AGGREGATION_TYPE_AVERAGE
+		series, err := service.PyroscopeSeries(args)
+		if err != nil {
+			return nil, err
+		}
+		resp := &pyroscope.SelectSeriesResponse{}
+		for _, s := range series {
+			pbSeries := &pyroscope.Series{}
+			for _, name := range req.GroupBy {
+				pbSeries.Labels = append(pbSeries.Labels, &pyroscope.LabelPair{Name: name, Value: s.Labels[name]})
+			}
+			for _, p := range s.Points {
+				pbSeries.Points = append(pbSeries.Points, &pyroscope.Point{Value: p.Value, Timestamp: p.Timestamp})
+			}
+			resp.Series = append(resp.Series, pbSeries)
+		}
+		return resp, nil
+	}
+	return nil, newConnectError(http.StatusNotFound, CONNECT_CODE_UNIMPLEMENTED, fmt.Errorf("method %s is not implemented", method))
+}
@@ -17,6 +17,7 @@
 package router
 
 import (
+	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -32,6 +33,18 @@ import (
 func ProfileRouter(e *gin.Engine, cfg *config.QuerierConfig) {
 	e.POST("/v1/profile/ProfileTracing", profile(cfg))
 	e.POST("/v1/profile/ProfileGrafana", profileGrafana(cfg))
+	e.POST("/v1/profile/ProfileDiff", profileDiff(cfg))
+	e.POST("/v1/profile/ProfilePprof", profilePprof(cfg))
+	pyroscopeRouter(e, cfg)
+}
+
+func setProfileDefaults(c *gin.Context, args *model.Profile) {
+	args.Context = c.Request.Context()
+	args.OrgID = c.Request.Header.Get(common.HEADER_KEY_X_ORG_ID)
+	if args.MaxKernelStackDepth == nil {
+		var maxKernelStackDepth = common.MAX_KERNEL_STACK_DEPTH_DEFAULT
+		args.MaxKernelStackDepth = &maxKernelStackDepth
+	}
 }
 
 func profile(cfg *config.QuerierConfig) gin.HandlerFunc {
@@ -44,12 +57,7 @@ func profile(cfg *config.QuerierConfig) gin.HandlerFunc {
 			router.BadRequestResponse(c, common.INVALID_POST_DATA, err.Error())
 			return
 		}
-		args.Context = c.Request.Context()
-		args.OrgID = c.Request.Header.Get(common.HEADER_KEY_X_ORG_ID)
-		if args.MaxKernelStackDepth == nil {
-			var maxKernelStackDepth = common.MAX_KERNEL_STACK_DEPTH_DEFAULT
-			args.MaxKernelStackDepth = &maxKernelStackDepth
-		}
+		setProfileDefaults(c, &args)
 		result, debug, err := service.Profile(args, cfg)
 		if err == nil && !args.Debug {
 			debug = nil
@@ -79,3 +87,51 @@ func profileGrafana(cfg *config.QuerierConfig) gin.HandlerFunc {
 		router.JsonResponse(c, result, debug, err)
 	})
 }
+
+func profileDiff(cfg *config.QuerierConfig) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		var args model.ProfileDiff
+
+		// 参数校验
+		err := c.ShouldBindBodyWith(&args, binding.JSON)
+		if err != nil {
+			router.BadRequestResponse(c, common.INVALID_POST_DATA, err.Error())
+			return
+		}
+		if args.Baseline.ProfileEventType != args.Comparison.ProfileEventType {
+			router.BadRequestResponse(c, common.INVALID_PARAMETERS, "baseline and comparison must have the same profile_event_type")
+			return
+		}
+		setProfileDefaults(c, &args.Baseline)
+		setProfileDefaults(c, &args.Comparison)
+		args.Baseline.Debug = args.Debug
+		args.Comparison.Debug = args.Debug
+		result, debug, err := service.ProfileDiff(args, cfg)
+		if err == nil && !args.Debug {
+			debug = nil
+		}
+		router.JsonResponse(c, result, debug, err)
+	})
+}
+
+// profilePprof 参数与ProfileTracing相同，返回gzip压缩的pprof protobuf
+func profilePprof(cfg *config.QuerierConfig) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		var args model.Profile
+
+		// 参数校验
+		err := c.ShouldBindBodyWith(&args, binding.JSON)
+		if err != nil {
+			router.BadRequestResponse(c, common.INVALID_POST_DATA, err.Error())
+			return
+		}
+		setProfileDefaults(c, &args)
+		result, debug, err := service.ProfilePprof(args, cfg)
+		if err != nil {
+			router.JsonResponse(c, nil, debug, err)
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="profile.pb.gz"`)
+		c.Data(http.StatusOK, "application/octet-stream", result)
+	})
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"sync"
+
+	"github.com/deepflowio/deepflow/server/querier/config"
+	"github.com/deepflowio/deepflow/server/querier/profile/model"
+)
+
+type ProfileDiffDebug struct {
+	Baseline   interface{} `json:"baseline"`
+	Comparison interface{} `json:"comparison"`
+}
+
+// ProfileDiff 分别查询基准和对比的火焰图，并按调用栈合并
+func ProfileDiff(args model.ProfileDiff, cfg *config.QuerierConfig) (model.ProfileDiffTree, interface{}, error) {
+	var baseline, comparison model.ProfileTree
+	var baselineErr, comparisonErr error
+	debugs := ProfileDiffDebug{}
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		baseline, debugs.Baseline, baselineErr = Profile(args.Baseline, cfg)
+	}()
+	go func() {
+		defer wg.Done()
+		comparison, debugs.Comparison, comparisonErr = Profile(args.Comparison, cfg)
+	}()
+	wg.Wait()
+	if baselineErr != nil {
+		return model.ProfileDiffTree{}, debugs, baselineErr
+	}
+	if comparisonErr != nil {
+		return model.ProfileDiffTree{}, debugs, comparisonErr
+	}
+	return DiffProfileTree(baseline, comparison, args.Baseline.ProfileEventType), debugs, nil
+}
+
+type diffNode struct {
+	locationID      int
+	parentNodeID    int
+	baselineSelf    int
+	baselineTotal   int
+	comparisonSelf  int
+	comparisonTotal int
+}
+
+type profileTreeMerger struct {
+	functions    []string
+	functionToID map[string]int
+	nodes        []diffNode
+	// 父节点id及函数id唯一确定合并后的节点
+	childToNodeID map[[2]int]int
+}
+
+// mergeTree 将火焰图的节点按调用栈合并到merger中，父节点先于子节点合并
+func (m *profileTreeMerger) mergeTree(tree model.ProfileTree, isBaseline bool) {
+	nodeIDs := make([]int, len(tree.NodeValues.Values))
+	for i := range nodeIDs {
+		nodeIDs[i] = -1
+	}
+	var merge func(int) int
+	merge = func(id int) int {
+		if nodeIDs[id] >= 0 {
+			return nodeIDs[id]
+		}
+		node := tree.NodeValues.Values[id]
+		mergedID := 0 // 两侧的根节点直接合并
+		if node[1] >= 0 {
+			parentID := merge(node[1])
+			function := tree.Functions[node[0]]
+			functionID, ok := m.functionToID[function]
+			if !ok {
+				functionID = len(m.functions)
+				m.functions = append(m.functions, function)
+				m.functionToID[function] = functionID
+			}
+			key := [2]int{parentID, functionID}
+			if mergedID, ok = m.childToNodeID[key]; !ok {
+				mergedID = len(m.nodes)
+				m.childToNodeID[key] = mergedID
+				m.nodes = append(m.nodes, diffNode{locationID: functionID, parentNodeID: parentID})
+			}
+		}
+		merged := &m.nodes[mergedID]
+		if isBaseline {
+			merged.baselineSelf += node[2]
+			merged.baselineTotal += node[3]
+		} else {
+			merged.comparisonSelf += node[2]
+			merged.comparisonTotal += node[3]
+		}
+		nodeIDs[id] = mergedID
+		return mergedID
+	}
+	for id := range tree.NodeValues.Values {
+		merge(id)
+	}
+}
+
+// DiffProfileTree 按调用栈合并两个火焰图，根节点名称为两侧根节点名称
+func DiffProfileTree(baseline, comparison model.ProfileTree, profileEventType string) model.ProfileDiffTree {
+	root := ""
+	for _, tree := range []model.ProfileTree{baseline, comparison} {
+		if len(tree.Functions) > 0 && tree.Functions[0] != root {
+			if root != "" {
+				root += " / "
+			}
+			root += tree.Functions[0]
+		}
+	}
+	m := &profileTreeMerger{
+		functions:     []string{root},
+		functionToID:  map[string]int{},
+		nodes:         []diffNode{{parentNodeID: -1}},
+		childToNodeID: map[[2]int]int{},
+	}
+	m.mergeTree(baseline, true)
+	m.mergeTree(comparison, false)
+
+	result := model.ProfileDiffTree{}
+	if len(m.nodes) == 1 {
+		return result
+	}
+	functionValues := make([][]int, len(m.functions))
+	for i := range functionValues {
+		functionValues[i] = []int{0, 0, 0, 0}
+	}
+	result.NodeValues.Values = make([][]int, 0, len(m.nodes))
+	for _, node := range m.nodes {
+		values := functionValues[node.locationID]
+		values[0] += node.baselineSelf
+		values[1] += node.baselineTotal
+		values[2] += node.comparisonSelf
+		values[3] += node.comparisonTotal
+		result.NodeValues.Values = append(result.NodeValues.Values, []int{
+			node.locationID, node.parentNodeID, node.baselineSelf, node.baselineTotal, node.comparisonSelf, node.comparisonTotal,
+		})
+	}
+
+	// 函数类型按两侧的合计值判断
+	typeValues := make([][]int, len(functionValues))
+	for i, values := range functionValues {
+		typeValues[i] = []int{values[0] + values[2], values[1] + values[3]}
+	}
+	result.Functions = m.functions
+	result.FunctionTypes = GetLocationType(m.functions, typeValues, profileEventType)
+	result.FunctionValues.Values = functionValues
+	result.FunctionValues.Columns = []string{"baseline_self_value", "baseline_total_value", "comparison_self_value", "comparison_total_value"}
+	result.NodeValues.Columns = []string{"function_id", "parent_node_id", "baseline_self_value", "baseline_total_value", "comparison_self_value", "comparison_total_value"}
+	return result
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/deepflowio/deepflow/server/querier/profile/model"
+)
+
+// svc -> main -> a(self 3), svc -> main -> b(self 1)
+var baselineTree = model.ProfileTree{
+	Functions: []string{"svc", "b", "main", "a"},
+	NodeValues: model.Value{Values: [][]int{
+		{0, -1, 0, 4},
+		{3, 3, 3, 3},
+		{1, 3, 1, 1},
+		{2, 0, 0, 4},
+	}},
+}
+
+// svc -> main -> a(self 5), svc -> main -> c(self 2)
+var comparisonTree = model.ProfileTree{
+	Functions: []string{"svc", "main", "a", "c"},
+	NodeValues: model.Value{Values: [][]int{
+		{0, -1, 0, 7},
+		{1, 0, 0, 7},
+		{2, 1, 5, 5},
+		{3, 1, 2, 2},
+	}},
+}
+
+func TestDiffProfileTree(t *testing.T) {
+	result := DiffProfileTree(baselineTree, comparisonTree, "on-cpu")
+	if !reflect.DeepEqual(result.Functions, []string{"svc", "main", "a", "b", "c"}) {
+		t.Fatalf("unexpected functions: %v", result.Functions)
+	}
+	expect := [][]int{
+		{0, -1, 0, 4, 0, 7},
+		{1, 0, 0, 4, 0, 7},
+		{2, 1, 3, 3, 5, 5},
+		{3, 1, 1, 1, 0, 0},
+		{4, 1, 0, 0, 2, 2},
+	}
+	if !reflect.DeepEqual(result.NodeValues.Values, expect) {
+		t.Errorf("\nExpect: %v\nActual: %v", expect, result.NodeValues.Values)
+	}
+	if len(result.FunctionTypes) != len(result.Functions) {
+		t.Errorf("unexpected function types: %v", result.FunctionTypes)
+	}
+}
+
+func TestProfileTreeToPprof(t *testing.T) {
+	buf := &bytes.Buffer{}
+	args := model.Profile{ProfileEventType: "on-cpu", TimeStart: 100, TimeEnd: 160}
+	if err := ProfileTreeToPprof(baselineTree, args).Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	p, err := profile.Parse(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.SampleType[0].Type != "on-cpu" || p.SampleType[0].Unit != "samples" || p.DurationNanos != 60e9 {
+		t.Errorf("unexpected profile header: %v %d", p.SampleType[0], p.DurationNanos)
+	}
+	stacks := map[string]int64{}
+	for _, s := range p.Sample {
+		stack := ""
+		for _, l := range s.Location {
+			stack += l.Line[0].Function.Name + ";"
+		}
+		stacks[stack] += s.Value[0]
+	}
+	if !reflect.DeepEqual(stacks, map[string]int64{"a;main;": 3, "b;main;": 1}) {
+		t.Errorf("unexpected stacks: %v", stacks)
+	}
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/deepflowio/deepflow/server/querier/config"
+	"github.com/deepflowio/deepflow/server/querier/profile/model"
+)
+
+// 未列出的事件类型单位为count
+var PROFILE_EVENT_TYPE_UNITS = map[string]string{
+	"cpu":           "nanoseconds",
+	"on-cpu":        "samples",
+	"off-cpu":       "microseconds",
+	"mem-alloc":     "bytes",
+	"mem-inuse":     "bytes",
+	"alloc_space":   "bytes",
+	"inuse_space":   "bytes",
+	"wall":          "nanoseconds",
+	"contentions":   "count",
+	"delay":         "nanoseconds",
+	"goroutines":    "count",
+	"inuse_objects": "count",
+}
+
+// ProfilePprof 将火焰图查询结果转换为gzip压缩的pprof格式，可直接用go tool pprof或speedscope打开
+func ProfilePprof(args model.Profile, cfg *config.QuerierConfig) ([]byte, interface{}, error) {
+	tree, debug, err := Profile(args, cfg)
+	if err != nil {
+		return nil, debug, err
+	}
+	p := ProfileTreeToPprof(tree, args)
+	buf := &bytes.Buffer{}
+	if err := p.Write(buf); err != nil {
+		return nil, debug, err
+	}
+	return buf.Bytes(), debug, nil
+}
+
+// ProfileTreeToPprof 每个self_value不为0的节点对应一个sample，调用栈不包含根节点，根节点名称记录在sample的app_service标签中
+func ProfileTreeToPprof(tree model.ProfileTree, args model.Profile) *profile.Profile {
+	unit, ok := PROFILE_EVENT_TYPE_UNITS[args.ProfileEventType]
+	if !ok {
+		unit = "count"
+	}
+	valueType := &profile.ValueType{Type: args.ProfileEventType, Unit: unit}
+	p := &profile.Profile{
+		SampleType:    []*profile.ValueType{valueType},
+		PeriodType:    valueType,
+		Period:        1,
+		TimeNanos:     int64(args.TimeStart) * 1e9,
+		DurationNanos: int64(args.TimeEnd-args.TimeStart) * 1e9,
+	}
+	if len(tree.NodeValues.Values) == 0 {
+		return p
+	}
+
+	// 函数id与location id一一对应，pprof中id从1开始
+	locations := make([]*profile.Location, len(tree.Functions))
+	getLocation := func(functionID int) *profile.Location {
+		if locations[functionID] == nil {
+			name := tree.Functions[functionID]
+			function := &profile.Function{ID: uint64(functionID + 1), Name: name, SystemName: name}
+			locations[functionID] = &profile.Location{ID: uint64(functionID + 1), Line: []profile.Line{{Function: function}}}
+			p.Function = append(p.Function, function)
+			p.Location = append(p.Location, locations[functionID])
+		}
+		return locations[functionID]
+	}
+	root := strings.TrimSpace(tree.Functions[0])
+	for _, node := range tree.NodeValues.Values {
+		selfValue := node[2]
+		if selfValue == 0 || node[1] < 0 {
+			continue
+		}
+		sample := &profile.Sample{Value: []int64{int64(selfValue)}, Label: map[string][]string{"app_service": {root}}}
+		for current := node; current[1] >= 0; current = tree.NodeValues.Values[current[1]] {
+			sample.Location = append(sample.Location, getLocation(current[0]))
+		}
+		p.Sample = append(p.Sample, sample)
+	}
+	return p
+}
@@ -0,0 +1,533 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	querier_common "github.com/deepflowio/deepflow/server/querier/common"
+	"github.com/deepflowio/deepflow/server/querier/config"
+	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse"
+	"github.com/deepflowio/deepflow/server/querier/profile/common"
+	"github.com/deepflowio/deepflow/server/querier/profile/model"
+)
+
+const (
+	PYROSCOPE_LABEL_PROFILE_TYPE  = "__profile_type__"
+	PYROSCOPE_LABEL_NAME          = "__name__"
+	PYROSCOPE_LABEL_SERVICE_NAME  = "service_name"
+	PYROSCOPE_ROOT_NAME           = "total"
+	PYROSCOPE_TIMELINE_STEP       = 10
+	PYROSCOPE_MAX_TIMELINE_POINTS = 1024
+	PYROSCOPE_LABEL_LIMIT         = 1000
+	PYROSCOPE_SERIES_LIMIT        = 100000
+)
+
+// pyroscope标签与in_process中列的对应关系，未在此列出的标签对应上报时携带的tag.<label>
+var PYROSCOPE_LABEL_COLUMNS = map[string]string{
+	PYROSCOPE_LABEL_SERVICE_NAME: "app_service",
+	PYROSCOPE_LABEL_NAME:         "profile_language_type",
+	"app_instance":               "app_instance",
+	"span_name":                  "span_name",
+	"trace_id":                   "trace_id",
+	"process_id":                 "process_id",
+	"pod":                        "pod",
+	"namespace":                  "pod_ns",
+	"pod_ns":                     "pod_ns",
+	"pod_cluster":                "pod_cluster",
+	"pod_node":                   "pod_node",
+	"pod_service":                "pod_service",
+	"pod_group":                  "pod_group",
+	"host":                       "host",
+	"chost":                      "chost",
+	"agent":                      "agent",
+}
+
+var executePyroscopeQuery = func(sql string, args *model.PyroscopeParams) (*querier_common.Result, error) {
+	ckEngine := &clickhouse.CHEngine{DB: common.DATABASE_PROFILE}
+	ckEngine.Init()
+	querierArgs := querier_common.QuerierParams{
+		DB:        common.DATABASE_PROFILE,
+		Sql:       sql,
+		Debug:     strconv.FormatBool(args.Debug),
+		QueryUUID: uuid.New().String(),
+		Context:   args.Context,
+		ORGID:     args.OrgID,
+	}
+	result, debug, err := ckEngine.ExecuteQuery(&querierArgs)
+	if err != nil {
+		log.Errorf("ExecuteQuery failed: %v", debug, err)
+	}
+	return result, err
+}
+
+func pyroscopeLabelColumn(label string) string {
+	if column, ok := PYROSCOPE_LABEL_COLUMNS[label]; ok {
+		return column
+	}
+	return "`tag." + label + "`"
+}
+
+// ParseProfileTypeID 解析<language>:<event_type>:<unit>:<event_type>:<unit>，返回语言类型和事件类型
+func ParseProfileTypeID(id string) (string, string, error) {
+	parts := strings.Split(id, ":")
+	if len(parts) != 5 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid profile type id %q", id)
+	}
+	return parts[0], parts[1], nil
+}
+
+func NewProfileTypeID(language, eventType, unit string) string {
+	return strings.Join([]string{language, eventType, unit, eventType, unit}, ":")
+}
+
+// parseLabelSelector 解析{label="value"}形式的选择器，空选择器返回nil
+func parseLabelSelector(selector string) ([]*labels.Matcher, error) {
+	selector = strings.TrimSpace(selector)
+	if selector == "" || strings.ReplaceAll(selector, " ", "") == "{}" {
+		return nil, nil
+	}
+	return parser.ParseMetricSelector(selector)
+}
+
+func matcherToSQL(m *labels.Matcher) (string, error) {
+	if m.Name == PYROSCOPE_LABEL_PROFILE_TYPE {
+		if m.Type != labels.MatchEqual {
+			return "", fmt.Errorf("label %s only supports =", m.Name)
+		}
+		language, eventType, err := ParseProfileTypeID(m.Value)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("profile_language_type=%s AND profile_event_type=%s", querier_common.QuoteString(language), querier_common.QuoteString(eventType)), nil
+	}
+	column := pyroscopeLabelColumn(m.Name)
+	switch m.Type {
+	case labels.MatchEqual:
+		return fmt.Sprintf("%s=%s", column, querier_common.QuoteString(m.Value)), nil
+	case labels.MatchNotEqual:
+		return fmt.Sprintf("%s!=%s", column, querier_common.QuoteString(m.Value)), nil
+	case labels.MatchRegexp:
+		return fmt.Sprintf("%s regexp %s", column, querier_common.QuoteString("^(?:"+m.Value+")$")), nil
+	case labels.MatchNotRegexp:
+		return fmt.Sprintf("%s not regexp %s", column, querier_common.QuoteString("^(?:"+m.Value+")$")), nil
+	}
+	return "", fmt.Errorf("unsupported matcher %s", m.String())
+}
+
+// parseRenderQuery 解析<app_service>.<profile_event_type>{label="value"}，app_service中可能包含.
+func parseRenderQuery(query string) (appService, eventType, selector string) {
+	name := query
+	if index := strings.Index(query, "{"); index >= 0 {
+		name, selector = query[:index], query[index:]
+	}
+	name = strings.TrimSpace(name)
+	if index := strings.LastIndex(name, "."); index > 0 {
+		return name[:index], name[index+1:], selector
+	}
+	return name, "", selector
+}
+
+// pyroscopeFilters 生成过滤条件，args.Query和args.ProfileTypeID同时只会使用一个
+func pyroscopeFilters(args *model.PyroscopeParams) ([]string, error) {
+	filters := []string{fmt.Sprintf("time>=%d", args.Start), fmt.Sprintf("time<=%d", args.End)}
+	selector := args.LabelSelector
+	if args.Query != "" {
+		var appService, eventType string
+		appService, eventType, selector = parseRenderQuery(args.Query)
+		if appService != "" {
+			filters = append(filters, fmt.Sprintf("app_service=%s", querier_common.QuoteString(appService)))
+		}
+		if eventType != "" {
+			filters = append(filters, fmt.Sprintf("profile_event_type=%s", querier_common.QuoteString(eventType)))
+		}
+	}
+	if args.ProfileTypeID != "" {
+		language, eventType, err := ParseProfileTypeID(args.ProfileTypeID)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, fmt.Sprintf("profile_language_type=%s", querier_common.QuoteString(language)))
+		filters = append(filters, fmt.Sprintf("profile_event_type=%s", querier_common.QuoteString(eventType)))
+	}
+	matchers, err := parseLabelSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range matchers {
+		filter, err := matcherToSQL(m)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// PyroscopeFlameGraph 查询合并后的火焰图，并转换为pyroscope按层编码的格式
+func PyroscopeFlameGraph(args *model.PyroscopeParams, cfg *config.QuerierConfig) (*model.Flamebearer, error) {
+	filters, err := pyroscopeFilters(args)
+	if err != nil {
+		return nil, err
+	}
+	profileArgs := model.Profile{
+		AppService: PYROSCOPE_ROOT_NAME,
+		Debug:      args.Debug,
+		Context:    args.Context,
+		OrgID:      args.OrgID,
+	}
+	if args.ProfileTypeID != "" {
+		profileArgs.ProfileLanguageType, profileArgs.ProfileEventType, _ = ParseProfileTypeID(args.ProfileTypeID)
+	} else if args.Query != "" {
+		_, profileArgs.ProfileEventType, _ = parseRenderQuery(args.Query)
+	}
+	maxKernelStackDepth := common.MAX_KERNEL_STACK_DEPTH_DEFAULT
+	profileArgs.MaxKernelStackDepth = &maxKernelStackDepth
+	tree, _, err := GenerateProfile(profileArgs, cfg, strings.Join(filters, " AND "), model.ProfileDebug{})
+	if err != nil {
+		return nil, err
+	}
+	return ProfileTreeToFlamebearer(tree, args.MaxNodes), nil
+}
+
+// ProfileTreeToFlamebearer 按层输出节点，每个节点为[相对同层前一节点结束位置的偏移, total, self, 名称下标]，
+// 子节点从父节点起始位置依次排列，self位于父节点右侧。maxNodes大于0时只保留total最大的maxNodes个节点
+func ProfileTreeToFlamebearer(tree model.ProfileTree, maxNodes int) *model.Flamebearer {
+	result := &model.Flamebearer{Names: []string{}, Levels: [][]int64{}}
+	nodes := tree.NodeValues.Values
+	if len(nodes) == 0 {
+		return result
+	}
+	minTotal := 0
+	if maxNodes > 0 && len(nodes) > maxNodes {
+		totals := make([]int, 0, len(nodes))
+		for _, node := range nodes {
+			totals = append(totals, node[3])
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(totals)))
+		minTotal = totals[maxNodes-1]
+	}
+	children := make([][]int, len(nodes))
+	for id, node := range nodes {
+		if node[1] >= 0 && node[3] >= minTotal && node[3] > 0 {
+			children[node[1]] = append(children[node[1]], id)
+		}
+	}
+
+	nameToIndex := map[string]int64{}
+	nameIndex := func(name string) int64 {
+		index, ok := nameToIndex[name]
+		if !ok {
+			index = int64(len(result.Names))
+			nameToIndex[name] = index
+			result.Names = append(result.Names, name)
+		}
+		return index
+	}
+	type levelNode struct {
+		id    int
+		start int64
+	}
+	level := []levelNode{{id: 0}}
+	for len(level) > 0 {
+		values := make([]int64, 0, len(level)*4)
+		next := []levelNode{}
+		var prevEnd int64
+		for _, n := range level {
+			node := nodes[n.id]
+			total, self := int64(node[3]), int64(node[2])
+			name := tree.Functions[node[0]]
+			if n.id == 0 {
+				name = PYROSCOPE_ROOT_NAME
+			}
+			values = append(values, n.start-prevEnd, total, self, nameIndex(name))
+			prevEnd = n.start + total
+			if self > result.MaxSelf {
+				result.MaxSelf = self
+			}
+			childStart := n.start
+			for _, child := range children[n.id] {
+				next = append(next, levelNode{id: child, start: childStart})
+				childStart += int64(nodes[child][3])
+			}
+		}
+		result.Levels = append(result.Levels, values)
+		level = next
+	}
+	result.NumTicks = int64(nodes[0][3])
+	return result
+}
+
+func timelineStep(start, end int64) int64 {
+	step := int64(PYROSCOPE_TIMELINE_STEP)
+	for (end-start)/step > PYROSCOPE_MAX_TIMELINE_POINTS {
+		step *= 2
+	}
+	return step
+}
+
+// PyroscopeSeries 按step秒聚合profile_value，groupBy为pyroscope标签名
+func PyroscopeSeries(args *model.PyroscopeParams) ([]*model.PyroscopeSeries, error) {
+	filters, err := pyroscopeFilters(args)
+	if err != nil {
+		return nil, err
+	}
+	step := args.Step
+	if step <= 0 {
+		step = timelineStep(args.Start, args.End)
+	}
+	timeColumn := fmt.Sprintf("time_%d", step)
+	selects := []string{fmt.Sprintf("time(time, %d) AS %s", step, timeColumn)}
+	groups := []string{timeColumn}
+	for _, label := range args.GroupBy {
+		selects = append(selects, pyroscopeLabelColumn(label))
+		groups = append(groups, pyroscopeLabelColumn(label))
+	}
+	function := "Sum"
+	if args.Average {
+		function = "AAvg"
+	}
+	selects = append(selects, fmt.Sprintf("%s(%s) AS value", function, common.PROFILE_VALUE))
+	sql := fmt.Sprintf(
+		"SELECT %s FROM %s WHERE %s GROUP BY %s LIMIT %d",
+		strings.Join(selects, ", "), common.TABLE_PROFILE, strings.Join(filters, " AND "), strings.Join(groups, ", "), PYROSCOPE_SERIES_LIMIT,
+	)
+	result, err := executePyroscopeQuery(sql, args)
+	if err != nil {
+		return nil, err
+	}
+
+	series := []*model.PyroscopeSeries{}
+	seriesMap := map[string]*model.PyroscopeSeries{}
+	for _, value := range result.Values {
+		row := value.([]interface{})
+		labelValues := map[string]string{}
+		keys := []string{}
+		for i, label := range args.GroupBy {
+			labelValues[label] = toString(row[i+1])
+			keys = append(keys, label+"="+labelValues[label])
+		}
+		key := strings.Join(keys, ",")
+		s, ok := seriesMap[key]
+		if !ok {
+			s = &model.PyroscopeSeries{Labels: labelValues}
+			seriesMap[key] = s
+			series = append(series, s)
+		}
+		s.Points = append(s.Points, model.PyroscopePoint{Timestamp: toInt64(row[0]) * 1000, Value: toFloat64(row[len(row)-1])})
+	}
+	for _, s := range series {
+		sort.Slice(s.Points, func(i, j int) bool { return s.Points[i].Timestamp < s.Points[j].Timestamp })
+	}
+	return series, nil
+}
+
+// PyroscopeRender 对应/pyroscope/render，返回火焰图及每个时间段的合计值
+func PyroscopeRender(args *model.PyroscopeParams, cfg *config.QuerierConfig) (*model.FlamebearerProfile, error) {
+	flamebearer, err := PyroscopeFlameGraph(args, cfg)
+	if err != nil {
+		return nil, err
+	}
+	step := timelineStep(args.Start, args.End)
+	seriesArgs := *args
+	seriesArgs.Step = step
+	seriesArgs.GroupBy = nil
+	series, err := PyroscopeSeries(&seriesArgs)
+	if err != nil {
+		return nil, err
+	}
+	startTime := args.Start / step * step
+	samples := make([]int64, (args.End-startTime)/step+1)
+	for _, s := range series {
+		for _, p := range s.Points {
+			if index := (p.Timestamp/1000 - startTime) / step; index >= 0 && index < int64(len(samples)) {
+				samples[index] += int64(p.Value)
+			}
+		}
+	}
+	appService, eventType, _ := parseRenderQuery(args.Query)
+	return &model.FlamebearerProfile{
+		Version:     1,
+		Flamebearer: *flamebearer,
+		Metadata:    model.FlamebearerMetadata{Format: "single", SampleRate: 100, Units: "samples", Name: appService + "." + eventType},
+		Timeline:    model.FlamebearerTimeline{StartTime: startTime, Samples: samples, DurationDelta: step},
+	}, nil
+}
+
+// PyroscopeProfileTypes 返回时间范围内存在的profile类型
+func PyroscopeProfileTypes(args *model.PyroscopeParams) ([]*model.PyroscopeProfileType, error) {
+	sql := fmt.Sprintf(
+		"SELECT profile_language_type, profile_event_type, profile_value_unit FROM %s WHERE time>=%d AND time<=%d "+
+			"GROUP BY profile_language_type, profile_event_type, profile_value_unit LIMIT %d",
+		common.TABLE_PROFILE, args.Start, args.End, PYROSCOPE_LABEL_LIMIT,
+	)
+	result, err := executePyroscopeQuery(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	types := []*model.PyroscopeProfileType{}
+	for _, value := range result.Values {
+		row := value.([]interface{})
+		language, eventType, unit := toString(row[0]), toString(row[1]), toString(row[2])
+		if language == "" || eventType == "" {
+			continue
+		}
+		types = append(types, &model.PyroscopeProfileType{
+			ID: NewProfileTypeID(language, eventType, unit), Name: language, SampleType: eventType, SampleUnit: unit,
+		})
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].ID < types[j].ID })
+	return types, nil
+}
+
+// PyroscopeLabelNames 返回内置标签及上报时携带的标签名
+func PyroscopeLabelNames(args *model.PyroscopeParams) ([]string, error) {
+	filters, err := pyroscopeFilters(args)
+	if err != nil {
+		return nil, err
+	}
+	sql := fmt.Sprintf(
+		"SELECT tag FROM %s WHERE %s LIMIT %d",
+		common.TABLE_PROFILE, strings.Join(filters, " AND "), PYROSCOPE_LABEL_LIMIT,
+	)
+	result, err := executePyroscopeQuery(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{PYROSCOPE_LABEL_PROFILE_TYPE: true}
+	for name := range PYROSCOPE_LABEL_COLUMNS {
+		names[name] = true
+	}
+	for _, value := range result.Values {
+		for name := range toStringMap(value.([]interface{})[0]) {
+			names[name] = true
+		}
+	}
+	return sortedKeys(names), nil
+}
+
+func PyroscopeLabelValues(args *model.PyroscopeParams) ([]string, error) {
+	filters, err := pyroscopeFilters(args)
+	if err != nil {
+		return nil, err
+	}
+	if args.LabelName == PYROSCOPE_LABEL_PROFILE_TYPE {
+		types, err := PyroscopeProfileTypes(args)
+		if err != nil {
+			return nil, err
+		}
+		values := []string{}
+		for _, t := range types {
+			values = append(values, t.ID)
+		}
+		return values, nil
+	}
+	column := pyroscopeLabelColumn(args.LabelName)
+	sql := fmt.Sprintf(
+		"SELECT %s FROM %s WHERE %s GROUP BY %s LIMIT %d",
+		column, common.TABLE_PROFILE, strings.Join(filters, " AND "), column, PYROSCOPE_LABEL_LIMIT,
+	)
+	result, err := executePyroscopeQuery(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	values := []string{}
+	for _, value := range result.Values {
+		if v := toString(value.([]interface{})[0]); v != "" {
+			values = append(values, v)
+		}
+	}
+	sort.Strings(values)
+	return values, nil
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toInt64(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case uint64:
+		return int64(v)
+	case int:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+func toFloat64(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case int:
+		return float64(v)
+	}
+	return 0
+}
+
+// toStringMap 查询结果中的map类型字段可能为JSON字符串或map
+func toStringMap(value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v
+	case map[string]string:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[k] = val
+		}
+		return m
+	case string:
+		m := map[string]interface{}{}
+		json.Unmarshal([]byte(v), &m)
+		return m
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
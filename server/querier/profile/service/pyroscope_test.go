@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/deepflowio/deepflow/server/querier/profile/model"
+)
+
+func TestPyroscopeFilters(t *testing.T) {
+	var cases = []struct {
+		args   model.PyroscopeParams
+		output string
+	}{{
+		args:   model.PyroscopeParams{Query: `my.app.cpu{env="prod", pod=~"web-.*"}`},
+		output: "app_service='my.app' AND profile_event_type='cpu' AND `tag.env`='prod' AND pod regexp '^(?:web-.*)$'",
+	}, {
+		args:   model.PyroscopeParams{ProfileTypeID: "Golang:cpu:nanoseconds:cpu:nanoseconds", LabelSelector: `{}`},
+		output: "profile_language_type='Golang' AND profile_event_type='cpu'",
+	}, {
+		args:   model.PyroscopeParams{LabelSelector: `{__profile_type__="eBPF:on-cpu:samples:on-cpu:samples", service_name!="it's"}`},
+		output: "profile_language_type='eBPF' AND profile_event_type='on-cpu' AND app_service!='it\\'s'",
+	}}
+	for _, c := range cases {
+		filters, err := pyroscopeFilters(&c.args)
+		if err != nil {
+			t.Errorf("%+v failed: %v", c.args, err)
+			continue
+		}
+		if actual := strings.Join(filters[2:], " AND "); actual != c.output {
+			t.Errorf("\nExpect: %s\nActual: %s", c.output, actual)
+		}
+	}
+	if _, err := pyroscopeFilters(&model.PyroscopeParams{ProfileTypeID: "cpu"}); err == nil {
+		t.Errorf("invalid profile type id should fail")
+	}
+}
+
+func TestProfileTreeToFlamebearer(t *testing.T) {
+	result := ProfileTreeToFlamebearer(baselineTree, 0)
+	expect := &model.Flamebearer{
+		Names:    []string{"total", "main", "a", "b"},
+		Levels:   [][]int64{{0, 4, 0, 0}, {0, 4, 0, 1}, {0, 3, 3, 2, 0, 1, 1, 3}},
+		NumTicks: 4,
+		MaxSelf:  3,
+	}
+	if !reflect.DeepEqual(result, expect) {
+		t.Errorf("\nExpect: %+v\nActual: %+v", expect, result)
+	}
+
+	// total最小的b被裁剪
+	result = ProfileTreeToFlamebearer(baselineTree, 3)
+	if !reflect.DeepEqual(result.Levels[2], []int64{0, 3, 3, 2}) {
+		t.Errorf("unexpected levels: %v", result.Levels)
+	}
+}
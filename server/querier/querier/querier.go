@@ -28,23 +28,32 @@ import (
 	yaml "gopkg.in/yaml.v2"
 
 	servercommon "github.com/deepflowio/deepflow/server/common"
+	"github.com/deepflowio/deepflow/server/libs/auth"
 	"github.com/deepflowio/deepflow/server/libs/logger"
 	"github.com/deepflowio/deepflow/server/libs/stats"
 	distributed_tracing "github.com/deepflowio/deepflow/server/querier/app/distributed_tracing/router"
 	"github.com/deepflowio/deepflow/server/querier/app/distributed_tracing/service/tracemap"
+	loki_router "github.com/deepflowio/deepflow/server/querier/app/loki/router"
 	prometheus_router "github.com/deepflowio/deepflow/server/querier/app/prometheus/router"
 	tracing_adapter "github.com/deepflowio/deepflow/server/querier/app/tracing-adapter/router"
 	"github.com/deepflowio/deepflow/server/querier/common"
 	"github.com/deepflowio/deepflow/server/querier/config"
 	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse/trans_prometheus"
+	"github.com/deepflowio/deepflow/server/querier/jaeger"
 	profile_router "github.com/deepflowio/deepflow/server/querier/profile/router"
 	"github.com/deepflowio/deepflow/server/querier/router"
 	"github.com/deepflowio/deepflow/server/querier/statsd"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"google.golang.org/grpc"
 )
 
 var log = logging.MustGetLogger("querier")
 
+// querier 的接口均为查询接口，POST 请求同样只需要 viewer 角色
+var authRouteRules = []auth.RouteRule{
+	{PathPrefix: "/", ReadRole: auth.ROLE_VIEWER, WriteRole: auth.ROLE_VIEWER},
+}
+
 func Start(configPath, serverLogFile string, shared *servercommon.ControllerIngesterShared) {
 	ServerCfg := config.DefaultConfig()
 	ServerCfg.Load(configPath)
@@ -81,9 +90,22 @@ func Start(configPath, serverLogFile string, shared *servercommon.ControllerInge
 	tracemap_generator := tracemap.NewTraceMapGenerator(shared.TraceTreeQueue, &cfg)
 	tracemap_generator.Start()
 
+	// 静态 token 由 controller 校验，metrics 供 Prometheus 抓取，无需认证
+	authenticator := auth.NewAuthenticator(auth.NewRemoteTokenStore(config.ControllerCfg.ListenPort), authRouteRules, stats.METRICS_PATH)
+
+	// jaeger query gRPC api
+	if cfg.JaegerGrpcPort > 0 {
+		go jaeger.StartGrpcServer(
+			cfg.JaegerGrpcPort,
+			grpc.UnaryInterceptor(authenticator.GRPCUnaryInterceptor()),
+			grpc.StreamInterceptor(authenticator.GRPCStreamInterceptor()),
+		)
+	}
+
 	// 注册router
 	r := gin.New()
 	r.Use(gin.Recovery())
+	r.Use(authenticator.GinMiddleware())
 	r.Use(otelgin.Middleware("gin-web-server"))
 	r.Use(gin.LoggerWithFormatter(logger.GinLogFormat))
 	r.Use(StatdHandle())
@@ -91,6 +113,8 @@ func Start(configPath, serverLogFile string, shared *servercommon.ControllerInge
 	router.QueryRouter(r)
 	profile_router.ProfileRouter(r, &cfg)
 	prometheus_router.PrometheusRouter(r)
+	loki_router.LokiRouter(r)
+	r.GET(stats.METRICS_PATH, gin.WrapH(stats.MetricsHandler()))
 	tracing_adapter.TracingAdapterRouter(r)
 	distributed_tracing.TraceMapRouter(r, &cfg, tracemap_generator)
 	registerRouterCounter(r.Routes())
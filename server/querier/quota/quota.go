@@ -0,0 +1,311 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package quota
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	logging "github.com/op/go-logging"
+
+	"github.com/deepflowio/deepflow/server/libs/stats"
+	"github.com/deepflowio/deepflow/server/querier/common"
+	"github.com/deepflowio/deepflow/server/querier/config"
+	"github.com/deepflowio/deepflow/server/querier/statsd"
+)
+
+var log = logging.MustGetLogger("querier.quota")
+
+const ALL_TABLES = "*"
+
+// 组织或用户维度的配额使用情况，仅在当前 querier 进程内计数，多个 querier 之间不共享，
+// 因此并发数及每分钟查询数的实际上限为配置值乘以 querier 数量
+type usage struct {
+	running     int
+	minute      int64
+	minuteCount int
+}
+
+type manager struct {
+	mutex    sync.Mutex
+	orgs     map[string]*usage
+	users    map[string]*usage // key 为 userKey(orgID, userID)，不同组织中相同 ID 的用户分别计数
+	counters map[string]*Counter
+}
+
+var quotaManager = &manager{
+	orgs:     make(map[string]*usage),
+	users:    make(map[string]*usage),
+	counters: make(map[string]*Counter),
+}
+
+func enabled() bool {
+	return config.Cfg != nil && config.Cfg.Quota.Enabled
+}
+
+func getOrgLimits(orgID string) *config.QuotaLimits {
+	for i := range config.Cfg.Quota.Orgs {
+		if config.Cfg.Quota.Orgs[i].OrgID == orgID {
+			return &config.Cfg.Quota.Orgs[i].QuotaLimits
+		}
+	}
+	return &config.Cfg.Quota.Default
+}
+
+// normalizeOrgID 未指定组织时为默认组织
+func normalizeOrgID(orgID string) string {
+	if orgID == "" {
+		return common.DEFAULT_ORG_ID
+	}
+	return orgID
+}
+
+func userKey(orgID, userID string) string {
+	return normalizeOrgID(orgID) + "/" + userID
+}
+
+func getUserLimits(orgID, userID string) *config.QuotaLimits {
+	if userID == "" {
+		return nil
+	}
+	orgID = normalizeOrgID(orgID)
+	for i := range config.Cfg.Quota.Users {
+		user := &config.Cfg.Quota.Users[i]
+		if user.UserID == userID && normalizeOrgID(user.OrgID) == orgID {
+			return &user.QuotaLimits
+		}
+	}
+	return nil
+}
+
+func getUsage(usages map[string]*usage, key string) *usage {
+	u, ok := usages[key]
+	if !ok {
+		u = &usage{}
+		usages[key] = u
+	}
+	return u
+}
+
+func newQuotaError(format string, a ...interface{}) error {
+	return common.NewError(common.QUOTA_EXCEEDED, fmt.Sprintf(format, a...))
+}
+
+// Acquire 检查并占用并发数及每分钟查询数配额，查询结束后需调用返回的 release
+func Acquire(orgID, userID string) (release func(), err error) {
+	if !enabled() {
+		return func() {}, nil
+	}
+	type scope struct {
+		name   string
+		limits *config.QuotaLimits
+		usage  *usage
+	}
+	minute := time.Now().Unix() / 60
+
+	m := quotaManager
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	counter := m.getCounter(orgID)
+	scopes := []scope{{name: "org " + orgID, limits: getOrgLimits(orgID), usage: getUsage(m.orgs, orgID)}}
+	if userLimits := getUserLimits(orgID, userID); userLimits != nil {
+		scopes = append(scopes, scope{name: "user " + userID, limits: userLimits, usage: getUsage(m.users, userKey(orgID, userID))})
+	}
+	for _, s := range scopes {
+		if s.usage.minute != minute {
+			s.usage.minute, s.usage.minuteCount = minute, 0
+		}
+		if s.limits.MaxConcurrentQueries > 0 && s.usage.running >= s.limits.MaxConcurrentQueries {
+			counter.add(func(c *Counter) { c.RejectedConcurrency++ })
+			return nil, newQuotaError("%s exceeds max concurrent queries %d", s.name, s.limits.MaxConcurrentQueries)
+		}
+		if s.limits.MaxQueriesPerMinute > 0 && s.usage.minuteCount >= s.limits.MaxQueriesPerMinute {
+			counter.add(func(c *Counter) { c.RejectedQPS++ })
+			return nil, newQuotaError("%s exceeds max queries per minute %d", s.name, s.limits.MaxQueriesPerMinute)
+		}
+	}
+	for _, s := range scopes {
+		s.usage.running++
+		s.usage.minuteCount++
+	}
+	counter.add(func(c *Counter) {
+		c.QueryCount++
+		c.ConcurrentQueries++
+	})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			for _, s := range scopes {
+				s.usage.running--
+			}
+			counter.add(func(c *Counter) { c.ConcurrentQueries-- })
+		})
+	}, nil
+}
+
+// CheckTimeRange 检查查询时间范围，timeStart 为 0 表示未指定开始时间，timeEnd 为 0 表示截止到当前
+func CheckTimeRange(orgID, userID, table string, timeStart, timeEnd int64) error {
+	if !enabled() {
+		return nil
+	}
+	for _, limits := range []*config.QuotaLimits{getOrgLimits(orgID), getUserLimits(orgID, userID)} {
+		if limits == nil {
+			continue
+		}
+		maxTimeRange, ok := limits.MaxTimeRange[table]
+		if !ok {
+			maxTimeRange = limits.MaxTimeRange[ALL_TABLES]
+		}
+		if maxTimeRange <= 0 {
+			continue
+		}
+		if timeEnd == 0 {
+			timeEnd = time.Now().Unix()
+		}
+		if timeStart == 0 {
+			quotaManager.getCounterLocked(orgID).add(func(c *Counter) { c.RejectedTimeRange++ })
+			return newQuotaError("time filter is required when querying %s, max time range is %ds", table, maxTimeRange)
+		}
+		if timeEnd-timeStart > int64(maxTimeRange) {
+			quotaManager.getCounterLocked(orgID).add(func(c *Counter) { c.RejectedTimeRange++ })
+			return newQuotaError("time range %ds of %s exceeds max time range %ds", timeEnd-timeStart, table, maxTimeRange)
+		}
+	}
+	return nil
+}
+
+func minLimit(a, b uint64) uint64 {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// GetRowsLimits 返回组织与用户配额中较小的读取行数及结果行数上限，0 表示不限制
+func GetRowsLimits(orgID, userID string) (maxRowsRead uint64, maxResultRows uint64) {
+	if !enabled() {
+		return 0, 0
+	}
+	for _, limits := range []*config.QuotaLimits{getOrgLimits(orgID), getUserLimits(orgID, userID)} {
+		if limits == nil {
+			continue
+		}
+		maxRowsRead = minLimit(maxRowsRead, limits.MaxRowsRead)
+		maxResultRows = minLimit(maxResultRows, limits.MaxResultRows)
+	}
+	return
+}
+
+// CheckEstimatedRows 根据 EXPLAIN ESTIMATE 的预估行数判断是否超出读取行数配额
+func CheckEstimatedRows(orgID, userID string, rows uint64) error {
+	if !enabled() {
+		return nil
+	}
+	counter := quotaManager.getCounterLocked(orgID)
+	counter.add(func(c *Counter) { c.EstimatedRows += rows })
+	maxRowsRead, _ := GetRowsLimits(orgID, userID)
+	if maxRowsRead > 0 && rows > maxRowsRead {
+		counter.add(func(c *Counter) { c.RejectedRowsRead++ })
+		return newQuotaError("estimated rows to read %d exceeds max rows read %d, please narrow the time range or add filters", rows, maxRowsRead)
+	}
+	return nil
+}
+
+type Counter struct {
+	QueryCount          uint64 `statsd:"query_count"`
+	RejectedConcurrency uint64 `statsd:"rejected_concurrency"`
+	RejectedQPS         uint64 `statsd:"rejected_qps"`
+	RejectedTimeRange   uint64 `statsd:"rejected_time_range"`
+	RejectedRowsRead    uint64 `statsd:"rejected_rows_read"`
+	EstimatedRows       uint64 `statsd:"estimated_rows"`
+	ConcurrentQueries   uint64 `statsd:"concurrent_queries,gauge"`
+
+	mutex  sync.Mutex
+	exited bool
+}
+
+func (c *Counter) add(f func(*Counter)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	f(c)
+}
+
+// GetCounter 累计值读取后清零，concurrent_queries 为当前值不清零
+func (c *Counter) GetCounter() interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	counter := &Counter{
+		QueryCount:          c.QueryCount,
+		RejectedConcurrency: c.RejectedConcurrency,
+		RejectedQPS:         c.RejectedQPS,
+		RejectedTimeRange:   c.RejectedTimeRange,
+		RejectedRowsRead:    c.RejectedRowsRead,
+		EstimatedRows:       c.EstimatedRows,
+		ConcurrentQueries:   c.ConcurrentQueries,
+	}
+	c.QueryCount, c.RejectedConcurrency, c.RejectedQPS, c.RejectedTimeRange, c.RejectedRowsRead, c.EstimatedRows = 0, 0, 0, 0, 0, 0
+	return counter
+}
+
+func (c *Counter) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.exited = true
+}
+
+func (c *Counter) Closed() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.exited
+}
+
+// Reset 关闭已注册的配额统计并清空使用量，重新加载配额配置时调用
+func Reset() {
+	m := quotaManager
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, counter := range m.counters {
+		counter.Close()
+	}
+	m.orgs = make(map[string]*usage)
+	m.users = make(map[string]*usage)
+	m.counters = make(map[string]*Counter)
+}
+
+// 调用方需持有 m.mutex
+func (m *manager) getCounter(orgID string) *Counter {
+	counter, ok := m.counters[orgID]
+	if !ok {
+		counter = &Counter{}
+		m.counters[orgID] = counter
+		err := statsd.RegisterCountableForIngester("querier_quota_count", counter, stats.OptionStatTags{"org_id": orgID})
+		if err != nil {
+			log.Warningf("register quota counter of org %s failed: %s", orgID, err)
+		}
+	}
+	return counter
+}
+
+func (m *manager) getCounterLocked(orgID string) *Counter {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.getCounter(orgID)
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package quota
+
+import (
+	"testing"
+	"time"
+
+	"github.com/deepflowio/deepflow/server/querier/common"
+	"github.com/deepflowio/deepflow/server/querier/config"
+)
+
+func initQuotaTest(quota config.Quota) {
+	quota.Enabled = true
+	config.Cfg = &config.QuerierConfig{Quota: quota}
+	Reset()
+}
+
+func assertQuotaError(t *testing.T, name string, err error) {
+	t.Helper()
+	if err == nil {
+		t.Errorf("%s: want quota error, got nil", name)
+		return
+	}
+	if e, ok := err.(*common.ServiceError); !ok || e.Status != common.QUOTA_EXCEEDED {
+		t.Errorf("%s: want quota error, got %v", name, err)
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	initQuotaTest(config.Quota{
+		Default: config.QuotaLimits{MaxConcurrentQueries: 2},
+		Users:   []config.UserQuota{{UserID: "2", QuotaLimits: config.QuotaLimits{MaxConcurrentQueries: 1}}},
+	})
+
+	release1, err := Acquire("1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release2, err := Acquire("1", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Acquire("1", "")
+	assertQuotaError(t, "org concurrency", err)
+	// 其他组织不受影响
+	release3, err := Acquire("3", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release3()
+
+	// release 可重复调用，只释放一次
+	release1()
+	release1()
+	_, err = Acquire("1", "2")
+	assertQuotaError(t, "user concurrency", err)
+	release4, err := Acquire("1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Acquire("1", "")
+	assertQuotaError(t, "org concurrency after release twice", err)
+	// 其他组织中相同 ID 的用户不共享配额
+	release5, err := Acquire("3", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release5()
+	release2()
+	release4()
+
+	counter := quotaManager.getCounterLocked("1").GetCounter().(*Counter)
+	if counter.QueryCount != 3 || counter.RejectedConcurrency != 3 || counter.ConcurrentQueries != 0 {
+		t.Errorf("counter got %+v", counter)
+	}
+}
+
+func TestAcquirePerMinute(t *testing.T) {
+	initQuotaTest(config.Quota{Default: config.QuotaLimits{MaxQueriesPerMinute: 2}})
+	minute := time.Now().Unix() / 60
+	for i := 0; i < 2; i++ {
+		release, err := Acquire("1", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	_, err := Acquire("1", "")
+	// 跨分钟时计数重置
+	if time.Now().Unix()/60 == minute {
+		assertQuotaError(t, "queries per minute", err)
+	}
+}
+
+func TestAcquireDisabled(t *testing.T) {
+	initQuotaTest(config.Quota{Default: config.QuotaLimits{MaxConcurrentQueries: 1}})
+	config.Cfg.Quota.Enabled = false
+	for i := 0; i < 3; i++ {
+		if _, err := Acquire("1", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheckTimeRange(t *testing.T) {
+	initQuotaTest(config.Quota{
+		Default: config.QuotaLimits{MaxTimeRange: map[string]int{"l7_flow_log": 3600, ALL_TABLES: 86400}},
+		Users:   []config.UserQuota{{UserID: "2", QuotaLimits: config.QuotaLimits{MaxTimeRange: map[string]int{ALL_TABLES: 600}}}},
+	})
+	now := time.Now().Unix()
+	cases := []struct {
+		name      string
+		userID    string
+		table     string
+		timeStart int64
+		timeEnd   int64
+		wantErr   bool
+	}{
+		{name: "table limit", table: "l7_flow_log", timeStart: now - 1800, timeEnd: now},
+		{name: "table limit exceeded", table: "l7_flow_log", timeStart: now - 7200, timeEnd: now, wantErr: true},
+		{name: "all tables limit", table: "l4_flow_log", timeStart: now - 7200, timeEnd: now},
+		{name: "no time start", table: "l4_flow_log", wantErr: true},
+		{name: "no time end", table: "l7_flow_log", timeStart: now - 7200, wantErr: true},
+		{name: "user limit exceeded", userID: "2", table: "l4_flow_log", timeStart: now - 1800, timeEnd: now, wantErr: true},
+		{name: "other user", userID: "3", table: "l4_flow_log", timeStart: now - 1800, timeEnd: now},
+	}
+	for _, c := range cases {
+		err := CheckTimeRange("1", c.userID, c.table, c.timeStart, c.timeEnd)
+		if c.wantErr {
+			assertQuotaError(t, c.name, err)
+		} else if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+	}
+}
+
+func TestCheckEstimatedRows(t *testing.T) {
+	initQuotaTest(config.Quota{
+		Default: config.QuotaLimits{MaxRowsRead: 1000, MaxResultRows: 100},
+		Users:   []config.UserQuota{{UserID: "2", QuotaLimits: config.QuotaLimits{MaxRowsRead: 500}}},
+	})
+	if err := CheckEstimatedRows("1", "", 1000); err != nil {
+		t.Error(err)
+	}
+	assertQuotaError(t, "org rows", CheckEstimatedRows("1", "", 1001))
+	assertQuotaError(t, "user rows", CheckEstimatedRows("1", "2", 501))
+
+	maxRowsRead, maxResultRows := GetRowsLimits("1", "2")
+	if maxRowsRead != 500 || maxResultRows != 100 {
+		t.Errorf("rows limits got %d, %d", maxRowsRead, maxResultRows)
+	}
+}
+
+func TestReset(t *testing.T) {
+	initQuotaTest(config.Quota{})
+	counter := quotaManager.getCounterLocked("1")
+	Reset()
+	if !counter.Closed() {
+		t.Error("counter should be closed after reset")
+	}
+	if quotaManager.getCounterLocked("1") == counter {
+		t.Error("counter should be recreated after reset")
+	}
+}
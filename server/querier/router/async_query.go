@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package router
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/deepflowio/deepflow/server/querier/common"
+	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse/client"
+	"github.com/deepflowio/deepflow/server/querier/service"
+)
+
+func getORGID(c *gin.Context) string {
+	orgID := c.Request.Header.Get(common.HEADER_KEY_X_ORG_ID)
+	if orgID == "" {
+		orgID = common.DEFAULT_ORG_ID
+	}
+	return orgID
+}
+
+// getQueryUUID 校验路径中的 query_uuid，非 uuid 时返回 400
+func getQueryUUID(c *gin.Context) (string, bool) {
+	queryUUID := c.Param("query_uuid")
+	if _, err := uuid.Parse(queryUUID); err != nil {
+		BadRequestResponse(c, common.INVALID_PARAMETERS, fmt.Sprintf("invalid query_uuid: %s", queryUUID))
+		return "", false
+	}
+	return queryUUID, true
+}
+
+// submitAsyncQuery 参数与 /v1/query/ 一致，另可通过 format 指定结果格式：csv/ndjson/arrow，默认 ndjson
+func submitAsyncQuery() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		format := c.Query("format")
+		if format == "" {
+			format = c.DefaultPostForm("format", client.EXPORT_FORMAT_NDJSON)
+		}
+		args := getQuerierParams(c)
+		// query_uuid 会作为 ClickHouse 的 query_id 及结果文件名，只接受 uuid
+		if _, err := uuid.Parse(args.QueryUUID); err != nil {
+			BadRequestResponse(c, common.INVALID_PARAMETERS, fmt.Sprintf("invalid query_uuid: %s", args.QueryUUID))
+			return
+		}
+		if args.Sql == "" {
+			BadRequestResponse(c, common.INVALID_PARAMETERS, "sql is required")
+			return
+		}
+		job, err := service.SubmitAsyncQuery(&args, format)
+		JsonResponse(c, job, nil, err)
+	})
+}
+
+func getAsyncQuery() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		queryUUID, ok := getQueryUUID(c)
+		if !ok {
+			return
+		}
+		job, err := service.GetAsyncQuery(queryUUID, getORGID(c), c.Request.Header.Get(common.HEADER_KEY_X_USER_ID))
+		JsonResponse(c, job, nil, err)
+	})
+}
+
+func cancelAsyncQuery() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		queryUUID, ok := getQueryUUID(c)
+		if !ok {
+			return
+		}
+		job, err := service.CancelAsyncQuery(queryUUID, getORGID(c), c.Request.Header.Get(common.HEADER_KEY_X_USER_ID))
+		JsonResponse(c, job, nil, err)
+	})
+}
+
+// downloadAsyncQueryResult 按块流式返回结果文件，不整体读入内存
+func downloadAsyncQueryResult() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		queryUUID, ok := getQueryUUID(c)
+		if !ok {
+			return
+		}
+		file, job, err := service.OpenAsyncQueryResult(queryUUID, getORGID(c), c.Request.Header.Get(common.HEADER_KEY_X_USER_ID))
+		if err != nil {
+			JsonResponse(c, nil, nil, err)
+			return
+		}
+		defer file.Close()
+		stat, err := file.Stat()
+		if err != nil {
+			JsonResponse(c, nil, nil, err)
+			return
+		}
+		extraHeaders := map[string]string{
+			"Content-Disposition": fmt.Sprintf("attachment; filename=\"%s.%s\"", job.QueryUUID, job.Format),
+		}
+		c.DataFromReader(http.StatusOK, stat.Size(), client.EXPORT_CONTENT_TYPE_MAP[job.Format], file, extraHeaders)
+	})
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/deepflowio/deepflow/server/querier/common"
+	"github.com/deepflowio/deepflow/server/querier/jaeger"
+)
+
+func jaegerResponse(c *gin.Context, data interface{}, total int, err error) {
+	if err != nil {
+		jaegerErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, jaeger.Response{Data: data, Total: total, Errors: []jaeger.ResponseError{}})
+}
+
+func jaegerErrorResponse(c *gin.Context, code int, msg string) {
+	c.JSON(code, jaeger.Response{Errors: []jaeger.ResponseError{{Code: code, Msg: msg}}})
+}
+
+func jaegerServicesReader() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		services, err := jaeger.GetServices(&common.JaegerParams{OrgID: c.Request.Header.Get(common.HEADER_KEY_X_ORG_ID), Context: c.Request.Context()})
+		jaegerResponse(c, services, len(services), err)
+	})
+}
+
+func jaegerOperationsReader() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args := common.JaegerParams{
+			Service:  c.Param("service"),
+			SpanKind: c.Query("spanKind"),
+			OrgID:    c.Request.Header.Get(common.HEADER_KEY_X_ORG_ID),
+			Context:  c.Request.Context(),
+		}
+		operations, err := jaeger.GetOperations(&args)
+		names := []string{}
+		exists := map[string]bool{}
+		for _, o := range operations {
+			if !exists[o.Name] {
+				exists[o.Name] = true
+				names = append(names, o.Name)
+			}
+		}
+		jaegerResponse(c, names, len(names), err)
+	})
+}
+
+// parseJaegerTime start/end的单位为微秒，未指定end时使用当前时间，未指定start时使用end-lookback
+func parseJaegerTime(c *gin.Context, args *common.JaegerParams) error {
+	var err error
+	if end := c.Query("end"); end != "" {
+		if args.EndTime, err = strconv.ParseInt(end, 10, 64); err != nil {
+			return fmt.Errorf("invalid end %s", end)
+		}
+	}
+	if start := c.Query("start"); start != "" {
+		if args.StartTime, err = strconv.ParseInt(start, 10, 64); err != nil {
+			return fmt.Errorf("invalid start %s", start)
+		}
+	} else if lookback := c.Query("lookback"); lookback != "" && lookback != "custom" {
+		d, err := time.ParseDuration(lookback)
+		if err != nil {
+			return fmt.Errorf("invalid lookback %s", lookback)
+		}
+		if args.EndTime == 0 {
+			args.EndTime = time.Now().UnixMicro()
+		}
+		args.StartTime = args.EndTime - d.Microseconds()
+	}
+	return nil
+}
+
+func jaegerTracesReader() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args := common.JaegerParams{
+			Service:   c.Query("service"),
+			Operation: c.Query("operation"),
+			OrgID:     c.Request.Header.Get(common.HEADER_KEY_X_ORG_ID),
+			Context:   c.Request.Context(),
+		}
+		if err := parseJaegerTime(c, &args); err != nil {
+			jaegerErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		// 指定traceID时直接查询对应的trace
+		if traceIDs := c.QueryArray("traceID"); len(traceIDs) > 0 {
+			traces := []*jaeger.Trace{}
+			for _, traceID := range traceIDs {
+				args.TraceId = traceID
+				trace, err := jaeger.GetTrace(&args)
+				if err != nil {
+					jaegerErrorResponse(c, http.StatusInternalServerError, err.Error())
+					return
+				}
+				if trace != nil {
+					traces = append(traces, trace)
+				}
+			}
+			jaegerResponse(c, traces, len(traces), nil)
+			return
+		}
+		if tags := c.Query("tags"); tags != "" {
+			if err := json.Unmarshal([]byte(tags), &args.Tags); err != nil {
+				jaegerErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid tags %s", tags))
+				return
+			}
+		}
+		for key, value := range map[string]*int64{"minDuration": &args.MinDuration, "maxDuration": &args.MaxDuration} {
+			if v := c.Query(key); v != "" {
+				d, err := time.ParseDuration(v)
+				if err != nil {
+					jaegerErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid %s %s", key, v))
+					return
+				}
+				*value = d.Microseconds()
+			}
+		}
+		if limit := c.Query("limit"); limit != "" {
+			var err error
+			if args.Limit, err = strconv.Atoi(limit); err != nil {
+				jaegerErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid limit %s", limit))
+				return
+			}
+		}
+		traces, err := jaeger.FindTraces(&args)
+		jaegerResponse(c, traces, len(traces), err)
+	})
+}
+
+func jaegerTraceReader() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args := common.JaegerParams{
+			TraceId: c.Param("traceId"),
+			OrgID:   c.Request.Header.Get(common.HEADER_KEY_X_ORG_ID),
+			Context: c.Request.Context(),
+		}
+		if err := parseJaegerTime(c, &args); err != nil {
+			jaegerErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		trace, err := jaeger.GetTrace(&args)
+		if err != nil {
+			jaegerErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if trace == nil {
+			jaegerErrorResponse(c, http.StatusNotFound, "trace not found")
+			return
+		}
+		jaegerResponse(c, []*jaeger.Trace{trace}, 1, nil)
+	})
+}
+
+// jaegerDependenciesReader endTs和lookback的单位为毫秒
+func jaegerDependenciesReader() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args := common.JaegerParams{
+			OrgID:   c.Request.Header.Get(common.HEADER_KEY_X_ORG_ID),
+			Context: c.Request.Context(),
+		}
+		endTs := time.Now().UnixMilli()
+		if v := c.Query("endTs"); v != "" {
+			var err error
+			if endTs, err = strconv.ParseInt(v, 10, 64); err != nil {
+				jaegerErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid endTs %s", v))
+				return
+			}
+		}
+		args.EndTime = endTs * 1000
+		if v := c.Query("lookback"); v != "" {
+			lookback, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				jaegerErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid lookback %s", v))
+				return
+			}
+			args.StartTime = (endTs - lookback) * 1000
+		}
+		links, err := jaeger.GetDependencies(&args)
+		jaegerResponse(c, links, len(links), err)
+	})
+}
@@ -28,6 +28,11 @@ import (
 
 func QueryRouter(e *gin.Engine) {
 	e.POST("/v1/query/", executeQuery())
+	// 异步查询
+	e.POST("/v1/query/async/", submitAsyncQuery())
+	e.GET("/v1/query/async/:query_uuid", getAsyncQuery())
+	e.DELETE("/v1/query/async/:query_uuid", cancelAsyncQuery())
+	e.GET("/v1/query/async/:query_uuid/result", downloadAsyncQueryResult())
 
 	// api router for tempo
 	e.GET("/api/traces/:traceId", tempoTraceReader())
@@ -35,38 +40,21 @@ func QueryRouter(e *gin.Engine) {
 	e.GET("/api/search/tags", tempoTagsReader())
 	e.GET("/api/search/tag/:tagName/values", tempoTagValuesReader())
 	e.GET("/api/search", tempoSearchReader())
+	e.GET("/api/v2/search/tags", tempoTagsV2Reader())
+	e.GET("/api/v2/search/tag/:tagName/values", tempoTagValuesV2Reader())
+
+	// Jaeger query api，/api/traces/:traceId与tempo冲突，统一使用/jaeger前缀
+	jaegerGroup := e.Group("/jaeger")
+	jaegerGroup.GET("/api/services", jaegerServicesReader())
+	jaegerGroup.GET("/api/services/:service/operations", jaegerOperationsReader())
+	jaegerGroup.GET("/api/traces", jaegerTracesReader())
+	jaegerGroup.GET("/api/traces/:traceId", jaegerTraceReader())
+	jaegerGroup.GET("/api/dependencies", jaegerDependenciesReader())
 }
 
 func executeQuery() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
-		args := common.QuerierParams{}
-		args.Context = c.Request.Context()
-		args.Debug = c.Query("debug")
-		args.UseQueryCache, _ = strconv.ParseBool(c.DefaultQuery("use_query_cache", "false"))
-		args.SimpleSql, _ = strconv.ParseBool(c.DefaultQuery("simple_sql", "false"))
-		args.QueryCacheTTL = c.Query("query_cache_ttl")
-		args.QueryUUID = c.Query("query_uuid")
-		args.NoPreWhere, _ = strconv.ParseBool(c.DefaultQuery("no_prewhere", "false"))
-		args.ORGID = c.Request.Header.Get(common.HEADER_KEY_X_ORG_ID)
-		args.Language = c.Request.Header.Get(common.HEADER_KEY_LANGUAGE)
-		// if no org_id in header, set default org id
-		if args.ORGID == "" {
-			args.ORGID = common.DEFAULT_ORG_ID
-		}
-		if args.QueryUUID == "" {
-			query_uuid := uuid.New()
-			args.QueryUUID = query_uuid.String()
-		}
-		args.DB = c.PostForm("db")
-		args.Sql = c.PostForm("sql")
-		args.DataSource = c.PostForm("data_precision")
-		if args.Sql == "" && args.DB == "" {
-			json := make(map[string]interface{})
-			c.BindJSON(&json)
-			args.DB, _ = json["db"].(string)
-			args.Sql, _ = json["sql"].(string)
-		}
-
+		args := getQuerierParams(c)
 		result := map[string]interface{}{}
 		debug := map[string]interface{}{}
 		var err error
@@ -82,3 +70,35 @@ func executeQuery() gin.HandlerFunc {
 		JsonResponse(c, result, debug, err)
 	})
 }
+
+func getQuerierParams(c *gin.Context) common.QuerierParams {
+	args := common.QuerierParams{}
+	args.Context = c.Request.Context()
+	args.Debug = c.Query("debug")
+	args.UseQueryCache, _ = strconv.ParseBool(c.DefaultQuery("use_query_cache", "false"))
+	args.SimpleSql, _ = strconv.ParseBool(c.DefaultQuery("simple_sql", "false"))
+	args.QueryCacheTTL = c.Query("query_cache_ttl")
+	args.QueryUUID = c.Query("query_uuid")
+	args.NoPreWhere, _ = strconv.ParseBool(c.DefaultQuery("no_prewhere", "false"))
+	args.ORGID = c.Request.Header.Get(common.HEADER_KEY_X_ORG_ID)
+	args.Language = c.Request.Header.Get(common.HEADER_KEY_LANGUAGE)
+	args.UserID = c.Request.Header.Get(common.HEADER_KEY_X_USER_ID)
+	// if no org_id in header, set default org id
+	if args.ORGID == "" {
+		args.ORGID = common.DEFAULT_ORG_ID
+	}
+	if args.QueryUUID == "" {
+		query_uuid := uuid.New()
+		args.QueryUUID = query_uuid.String()
+	}
+	args.DB = c.PostForm("db")
+	args.Sql = c.PostForm("sql")
+	args.DataSource = c.PostForm("data_precision")
+	if args.Sql == "" && args.DB == "" {
+		json := make(map[string]interface{})
+		c.BindJSON(&json)
+		args.DB, _ = json["db"].(string)
+		args.Sql, _ = json["sql"].(string)
+	}
+	return args
+}
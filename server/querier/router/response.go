@@ -70,8 +70,13 @@ func JsonResponse(c *gin.Context, data interface{}, debug interface{}, err error
 		case *common.ServiceError:
 			switch t.Status {
 			case common.RESOURCE_NOT_FOUND, common.INVALID_POST_DATA, common.RESOURCE_NUM_EXCEEDED,
-				common.SELECTED_RESOURCES_NUM_EXCEEDED:
+				common.SELECTED_RESOURCES_NUM_EXCEEDED, common.INVALID_PARAMETERS, common.RESOURCE_ALREADY_EXIST:
 				BadRequestResponse(c, t.Status, t.Message)
+			case common.QUOTA_EXCEEDED:
+				c.JSON(http.StatusTooManyRequests, Response{
+					OptStatus:   t.Status,
+					Description: t.Message,
+				})
 			case common.SERVER_ERROR:
 				InternalErrorResponse(c, data, debug, t.Status, t.Message)
 			}
@@ -18,6 +18,9 @@ package router
 
 import (
 	"encoding/json"
+	"fmt"
+	"strconv"
+
 	"github.com/gin-gonic/gin"
 	//"github.com/k0kubun/pp"
 
@@ -32,6 +35,22 @@ import (
 	//"github.com/k0kubun/pp"
 )
 
+// parseTempoTimeRange 解析 start/end 参数，未指定时为 0
+func parseTempoTimeRange(c *gin.Context, args *common.TempoParams) error {
+	var err error
+	if start := c.Query("start"); start != "" {
+		if args.StartTime, err = strconv.ParseInt(start, 10, 64); err != nil {
+			return fmt.Errorf("invalid start %s", start)
+		}
+	}
+	if end := c.Query("end"); end != "" {
+		if args.EndTime, err = strconv.ParseInt(end, 10, 64); err != nil {
+			return fmt.Errorf("invalid end %s", end)
+		}
+	}
+	return nil
+}
+
 func tempoTagValuesReader() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		args := common.TempoParams{
@@ -61,21 +80,55 @@ func tempoTagsReader() gin.HandlerFunc {
 	})
 }
 
+func tempoTagValuesV2Reader() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args := common.TempoParams{
+			TagName: c.Param("tagName"),
+			Context: c.Request.Context(),
+		}
+		result, _, err := tempo.ShowTagValuesV2(&args)
+		if err != nil {
+			c.JSON(500, err.Error())
+			return
+		}
+		c.JSON(200, result)
+	})
+}
+
+func tempoTagsV2Reader() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args := common.TempoParams{
+			Scope:   c.Query("scope"),
+			Context: c.Request.Context(),
+		}
+		result, _, err := tempo.ShowTagsV2(&args)
+		if err != nil {
+			c.JSON(500, err.Error())
+			return
+		}
+		c.JSON(200, result)
+	})
+}
+
 func tempoSearchReader() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		args := common.TempoParams{
-			MinDuration: c.Query("minDuration"),
-			MaxDuration: c.Query("maxDuration"),
-			Limit:       c.Query("limit"),
-			StartTime:   c.Query("start"),
-			EndTime:     c.Query("end"),
-			Debug:       c.Query("debug"),
-			Context:     c.Request.Context(),
+			MinDuration:     c.Query("minDuration"),
+			MaxDuration:     c.Query("maxDuration"),
+			Limit:           c.Query("limit"),
+			Debug:           c.Query("debug"),
+			Query:           c.Query("q"),
+			SpansPerSpanSet: c.Query("spss"),
+			Context:         c.Request.Context(),
+		}
+		if err := parseTempoTimeRange(c, &args); err != nil {
+			c.JSON(400, err.Error())
+			return
 		}
 		args.SetFilters(c.Query("tags"))
 		result, _, err := tempo.TraceSearch(&args)
 		if err != nil {
-			c.JSON(500, err)
+			c.JSON(500, err.Error())
 			return
 		}
 		c.JSON(200, result)
@@ -85,10 +138,12 @@ func tempoSearchReader() gin.HandlerFunc {
 func tempoTraceReader() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		args := common.TempoParams{
-			TraceId:   c.Param("traceId"),
-			StartTime: c.Query("start"),
-			EndTime:   c.Query("end"),
-			Context:   c.Request.Context(),
+			TraceId: c.Param("traceId"),
+			Context: c.Request.Context(),
+		}
+		if err := parseTempoTimeRange(c, &args); err != nil {
+			c.JSON(400, err.Error())
+			return
 		}
 		resp, err := tempo.FindTraceByTraceID(&args)
 		if err != nil {
@@ -0,0 +1,448 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/op/go-logging"
+
+	"github.com/deepflowio/deepflow/server/querier/common"
+	"github.com/deepflowio/deepflow/server/querier/config"
+	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse"
+	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse/client"
+	"github.com/deepflowio/deepflow/server/querier/quota"
+)
+
+var log = logging.MustGetLogger("service")
+
+const (
+	ASYNC_QUERY_STATE_PENDING   = "pending"
+	ASYNC_QUERY_STATE_RUNNING   = "running"
+	ASYNC_QUERY_STATE_FINISHED  = "finished"
+	ASYNC_QUERY_STATE_FAILED    = "failed"
+	ASYNC_QUERY_STATE_CANCELLED = "cancelled"
+)
+
+// 执行查询的 querier 定期刷新 UPDATED_AT，超时未刷新的未结束查询视为该 querier 已退出
+const (
+	ASYNC_QUERY_HEARTBEAT_INTERVAL = 10 * time.Second
+	ASYNC_QUERY_HEARTBEAT_TIMEOUT  = 3 * ASYNC_QUERY_HEARTBEAT_INTERVAL
+)
+
+type AsyncQueryJob struct {
+	QueryUUID   string    `json:"QUERY_UUID"`
+	ORGID       string    `json:"ORG_ID"`
+	UserID      string    `json:"USER_ID"`
+	DB          string    `json:"DB"`
+	Sql         string    `json:"SQL"`
+	Format      string    `json:"FORMAT"`
+	State       string    `json:"STATE"`
+	Error       string    `json:"ERROR,omitempty"`
+	ReadRows    uint64    `json:"READ_ROWS"`
+	TotalRows   uint64    `json:"TOTAL_ROWS"`
+	ResultBytes int64     `json:"RESULT_BYTES"`
+	CreatedAt   time.Time `json:"CREATED_AT"`
+	StartedAt   time.Time `json:"STARTED_AT"`
+	FinishedAt  time.Time `json:"FINISHED_AT"`
+	UpdatedAt   time.Time `json:"UPDATED_AT"`
+
+	cancel context.CancelFunc
+}
+
+func (j *AsyncQueryJob) isDone() bool {
+	return j.State == ASYNC_QUERY_STATE_FINISHED || j.State == ASYNC_QUERY_STATE_FAILED || j.State == ASYNC_QUERY_STATE_CANCELLED
+}
+
+// 未结束且心跳超时，说明执行查询的 querier 已退出
+func (j *AsyncQueryJob) isOrphaned(now time.Time) bool {
+	return !j.isDone() && now.Sub(j.UpdatedAt) > ASYNC_QUERY_HEARTBEAT_TIMEOUT
+}
+
+func (j *AsyncQueryJob) copy() *AsyncQueryJob {
+	jobCopy := *j
+	jobCopy.cancel = nil
+	return &jobCopy
+}
+
+// 查询状态以 <query_uuid>.json 与结果文件一同保存在 result-dir 中，
+// result-dir 为多个 querier 共享的存储时，任一 querier 均可查询状态、取消及下载结果，querier 重启后也不会丢失
+func jobPath(queryUUID string) string {
+	return filepath.Join(config.Cfg.AsyncQuery.ResultDir, queryUUID+".json")
+}
+
+func resultPath(job *AsyncQueryJob) string {
+	return filepath.Join(config.Cfg.AsyncQuery.ResultDir, fmt.Sprintf("%s.%s", job.QueryUUID, job.Format))
+}
+
+// 先写入临时文件再替换，避免读取到写了一半的状态；create 为 true 时若查询已存在则返回 os.ErrExist
+func writeJob(job *AsyncQueryJob, create bool) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(config.Cfg.AsyncQuery.ResultDir, job.QueryUUID+".json.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if create {
+		return os.Link(tmp.Name(), jobPath(job.QueryUUID))
+	}
+	return os.Rename(tmp.Name(), jobPath(job.QueryUUID))
+}
+
+func readJob(queryUUID string) (*AsyncQueryJob, error) {
+	data, err := os.ReadFile(jobPath(queryUUID))
+	if err != nil {
+		return nil, err
+	}
+	job := &AsyncQueryJob{}
+	if err := json.Unmarshal(data, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// 在 ClickHouse 集群上终止查询及获取查询进度，测试中可替换
+var (
+	killQuery = func(queryUUID string) error {
+		return newClickhouseClient(context.Background(), queryUUID).KillQuery(queryUUID)
+	}
+	getQueryProgress = func(queryUUID string) (uint64, uint64, error) {
+		return newClickhouseClient(context.Background(), queryUUID).GetQueryProgress(queryUUID)
+	}
+)
+
+// asyncQueryManager 管理本 querier 上执行的查询，查询状态的读写统一经过 result-dir 中的文件
+type asyncQueryManager struct {
+	mutex   sync.Mutex
+	jobs    map[string]*AsyncQueryJob
+	running chan struct{}
+}
+
+var asyncQueries *asyncQueryManager
+var asyncQueriesOnce sync.Once
+
+func getAsyncQueryManager() *asyncQueryManager {
+	asyncQueriesOnce.Do(func() {
+		maxRunning := config.Cfg.AsyncQuery.MaxRunningJobs
+		if maxRunning <= 0 {
+			maxRunning = 1
+		}
+		asyncQueries = &asyncQueryManager{
+			jobs:    make(map[string]*AsyncQueryJob),
+			running: make(chan struct{}, maxRunning),
+		}
+	})
+	return asyncQueries
+}
+
+func newClickhouseClient(ctx context.Context, queryUUID string) *client.Client {
+	return &client.Client{
+		Host:     config.Cfg.Clickhouse.Host,
+		Port:     config.Cfg.Clickhouse.Port,
+		UserName: config.Cfg.Clickhouse.User,
+		Password: config.Cfg.Clickhouse.Password,
+		Context:  ctx,
+		Debug: &client.Debug{
+			IP:        config.Cfg.Clickhouse.Host,
+			QueryUUID: queryUUID,
+		},
+	}
+}
+
+// SubmitAsyncQuery 同步完成 sql 翻译以便尽早返回语法错误，随后在后台执行查询并将结果落盘
+func SubmitAsyncQuery(args *common.QuerierParams, format string) (*AsyncQueryJob, error) {
+	if _, ok := client.EXPORT_FORMAT_MAP[format]; !ok {
+		return nil, common.NewError(common.INVALID_PARAMETERS, fmt.Sprintf("unsupported format: %s", format))
+	}
+	if err := os.MkdirAll(config.Cfg.AsyncQuery.ResultDir, 0755); err != nil {
+		return nil, common.NewError(common.SERVER_ERROR, err.Error())
+	}
+	m := getAsyncQueryManager()
+	m.cleanExpired()
+	if _, err := os.Stat(jobPath(args.QueryUUID)); err == nil {
+		return nil, common.NewError(common.RESOURCE_ALREADY_EXIST, fmt.Sprintf("query %s already exists", args.QueryUUID))
+	}
+
+	engine := &clickhouse.CHEngine{DB: args.DB, DataSource: args.DataSource, Context: context.Background()}
+	engine.Init()
+	chSql, callbacks, columnSchemaMap, err := engine.ParseQuerySql(args)
+	if err != nil {
+		return nil, err
+	}
+	if format == client.EXPORT_FORMAT_ARROW && len(callbacks) > 0 {
+		return nil, common.NewError(common.INVALID_PARAMETERS, "arrow format is not supported for this query, use csv or ndjson")
+	}
+	params := &client.QueryParams{
+		Sql:             chSql,
+		Callbacks:       callbacks,
+		QueryUUID:       args.QueryUUID,
+		ColumnSchemaMap: columnSchemaMap,
+		ORGID:           args.ORGID,
+		UserID:          args.UserID,
+		EnableQuota:     true,
+	}
+	return m.submit(args, format, params)
+}
+
+func (m *asyncQueryManager) submit(args *common.QuerierParams, format string, params *client.QueryParams) (*AsyncQueryJob, error) {
+	// 配额在提交时占用，查询结束后释放
+	release, err := quota.Acquire(args.ORGID, args.UserID)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	now := time.Now()
+	job := &AsyncQueryJob{
+		QueryUUID: args.QueryUUID,
+		ORGID:     args.ORGID,
+		UserID:    args.UserID,
+		DB:        args.DB,
+		Sql:       args.Sql,
+		Format:    format,
+		State:     ASYNC_QUERY_STATE_PENDING,
+		CreatedAt: now,
+		UpdatedAt: now,
+		cancel:    cancel,
+	}
+	m.mutex.Lock()
+	err = writeJob(job, true)
+	if err != nil {
+		m.mutex.Unlock()
+		cancel()
+		release()
+		if errors.Is(err, os.ErrExist) {
+			return nil, common.NewError(common.RESOURCE_ALREADY_EXIST, fmt.Sprintf("query %s already exists", args.QueryUUID))
+		}
+		return nil, common.NewError(common.SERVER_ERROR, err.Error())
+	}
+	m.jobs[job.QueryUUID] = job
+	jobCopy := job.copy()
+	m.mutex.Unlock()
+
+	go m.heartbeat(ctx, job)
+	go m.run(ctx, job, params, release)
+	return jobCopy, nil
+}
+
+func (m *asyncQueryManager) run(ctx context.Context, job *AsyncQueryJob, params *client.QueryParams, release func()) {
+	defer release()
+	defer job.cancel()
+	select {
+	case m.running <- struct{}{}:
+		defer func() { <-m.running }()
+	case <-ctx.Done():
+		m.finish(job, ASYNC_QUERY_STATE_CANCELLED, nil)
+		return
+	}
+	m.mutex.Lock()
+	job.State = ASYNC_QUERY_STATE_RUNNING
+	job.StartedAt = time.Now()
+	m.save(job)
+	m.mutex.Unlock()
+
+	file, err := os.Create(resultPath(job))
+	if err != nil {
+		m.finish(job, ASYNC_QUERY_STATE_FAILED, err)
+		return
+	}
+	chClient := newClickhouseClient(ctx, job.QueryUUID)
+	written, err := chClient.Export(params, job.Format, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	m.mutex.Lock()
+	job.ResultBytes = written
+	m.mutex.Unlock()
+	if ctx.Err() != nil {
+		m.finish(job, ASYNC_QUERY_STATE_CANCELLED, nil)
+	} else if err != nil {
+		m.finish(job, ASYNC_QUERY_STATE_FAILED, err)
+	} else {
+		m.finish(job, ASYNC_QUERY_STATE_FINISHED, nil)
+	}
+}
+
+// 定期刷新心跳，同时感知其他 querier 发起的取消
+func (m *asyncQueryManager) heartbeat(ctx context.Context, job *AsyncQueryJob) {
+	ticker := time.NewTicker(ASYNC_QUERY_HEARTBEAT_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.mutex.Lock()
+			if !job.isDone() {
+				m.save(job)
+			}
+			m.mutex.Unlock()
+		}
+	}
+}
+
+// save 保存本 querier 上查询的状态，需持有 m.mutex；若查询已被其他 querier 取消，则终止本地执行
+func (m *asyncQueryManager) save(job *AsyncQueryJob) {
+	if stored, err := readJob(job.QueryUUID); err == nil && stored.State == ASYNC_QUERY_STATE_CANCELLED && !job.isDone() {
+		job.State = ASYNC_QUERY_STATE_CANCELLED
+		job.FinishedAt = stored.FinishedAt
+		job.cancel()
+	}
+	job.UpdatedAt = time.Now()
+	if err := writeJob(job, false); err != nil {
+		log.Warningf("save async query %s failed: %s", job.QueryUUID, err)
+	}
+}
+
+func (m *asyncQueryManager) finish(job *AsyncQueryJob, state string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.jobs, job.QueryUUID)
+	// 已被其他 querier 取消时保留取消状态
+	if stored, readErr := readJob(job.QueryUUID); readErr == nil && stored.State == ASYNC_QUERY_STATE_CANCELLED {
+		state, err = ASYNC_QUERY_STATE_CANCELLED, nil
+	}
+	job.State = state
+	job.FinishedAt = time.Now()
+	job.UpdatedAt = job.FinishedAt
+	if err != nil {
+		job.Error = err.Error()
+		log.Errorf("async query %s failed: %s", job.QueryUUID, err)
+	}
+	if state != ASYNC_QUERY_STATE_FINISHED {
+		os.Remove(resultPath(job))
+	}
+	if err := writeJob(job, false); err != nil {
+		log.Warningf("save async query %s failed: %s", job.QueryUUID, err)
+	}
+}
+
+// 清理超过 result-ttl 的已结束查询、已退出 querier 遗留的查询及其结果文件
+func (m *asyncQueryManager) cleanExpired() {
+	ttl := time.Duration(config.Cfg.AsyncQuery.ResultTTL) * time.Second
+	paths, err := filepath.Glob(filepath.Join(config.Cfg.AsyncQuery.ResultDir, "*.json"))
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for _, path := range paths {
+		job, err := readJob(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			continue
+		}
+		if (job.isDone() && now.Sub(job.FinishedAt) > ttl) || (job.isOrphaned(now) && now.Sub(job.UpdatedAt) > ttl) {
+			os.Remove(resultPath(job))
+			os.Remove(path)
+		}
+	}
+}
+
+// 查询仅对提交的组织及用户可见
+func (m *asyncQueryManager) get(queryUUID, orgID, userID string) (*AsyncQueryJob, error) {
+	job, err := readJob(queryUUID)
+	if err != nil || job.ORGID != orgID || job.UserID != userID {
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warningf("read async query %s failed: %s", queryUUID, err)
+		}
+		return nil, common.NewError(common.RESOURCE_NOT_FOUND, fmt.Sprintf("query %s not found", queryUUID))
+	}
+	if job.isOrphaned(time.Now()) {
+		job.State = ASYNC_QUERY_STATE_FAILED
+		job.Error = "querier exited before the query finished"
+		job.FinishedAt = job.UpdatedAt
+	}
+	return job, nil
+}
+
+// GetAsyncQuery 返回查询状态，运行中的查询从 ClickHouse 获取读取进度
+func GetAsyncQuery(queryUUID, orgID, userID string) (*AsyncQueryJob, error) {
+	job, err := getAsyncQueryManager().get(queryUUID, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if job.State == ASYNC_QUERY_STATE_RUNNING {
+		readRows, totalRows, err := getQueryProgress(queryUUID)
+		if err != nil {
+			log.Warningf("get async query %s progress failed: %s", queryUUID, err)
+		} else if readRows > 0 || totalRows > 0 {
+			job.ReadRows, job.TotalRows = readRows, totalRows
+		}
+	}
+	return job, nil
+}
+
+// CancelAsyncQuery 取消查询并在 ClickHouse 集群上执行 KILL QUERY，查询由其他 querier 执行时，该 querier 在下次心跳时终止本地任务
+func CancelAsyncQuery(queryUUID, orgID, userID string) (*AsyncQueryJob, error) {
+	m := getAsyncQueryManager()
+	job, err := m.get(queryUUID, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if job.isDone() {
+		return nil, common.NewError(common.INVALID_PARAMETERS, fmt.Sprintf("query %s is already %s", queryUUID, job.State))
+	}
+	job.State = ASYNC_QUERY_STATE_CANCELLED
+	job.FinishedAt = time.Now()
+	m.mutex.Lock()
+	err = writeJob(job, false)
+	if localJob, ok := m.jobs[queryUUID]; ok {
+		localJob.cancel()
+	}
+	m.mutex.Unlock()
+	if err != nil {
+		return nil, common.NewError(common.SERVER_ERROR, err.Error())
+	}
+	if err := killQuery(queryUUID); err != nil {
+		log.Warningf("kill async query %s failed: %s", queryUUID, err)
+	}
+	return job, nil
+}
+
+// OpenAsyncQueryResult 打开已完成查询的结果文件，由调用方负责关闭
+func OpenAsyncQueryResult(queryUUID, orgID, userID string) (*os.File, *AsyncQueryJob, error) {
+	job, err := getAsyncQueryManager().get(queryUUID, orgID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if job.State != ASYNC_QUERY_STATE_FINISHED {
+		return nil, nil, common.NewError(common.INVALID_PARAMETERS, fmt.Sprintf("query %s is %s", queryUUID, job.State))
+	}
+	file, err := os.Open(resultPath(job))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, common.NewError(common.RESOURCE_NOT_FOUND, fmt.Sprintf("result of query %s not found", queryUUID))
+	} else if err != nil {
+		return nil, nil, err
+	}
+	return file, job, nil
+}
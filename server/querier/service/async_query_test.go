@@ -0,0 +1,221 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/deepflowio/deepflow/server/querier/config"
+)
+
+func initAsyncQueryTest(t *testing.T) *asyncQueryManager {
+	config.Cfg = &config.QuerierConfig{
+		AsyncQuery: config.AsyncQuery{ResultDir: t.TempDir(), MaxRunningJobs: 1, ResultTTL: 3600},
+	}
+	m := getAsyncQueryManager()
+	m.jobs = make(map[string]*AsyncQueryJob)
+	return m
+}
+
+// 模拟本 querier 上正在执行的查询
+func newLocalJob(t *testing.T, m *asyncQueryManager, queryUUID string) (*AsyncQueryJob, context.Context) {
+	ctx, cancel := context.WithCancel(context.Background())
+	now := time.Now()
+	job := &AsyncQueryJob{
+		QueryUUID: queryUUID,
+		ORGID:     "1",
+		UserID:    "u1",
+		Format:    "csv",
+		State:     ASYNC_QUERY_STATE_RUNNING,
+		CreatedAt: now,
+		UpdatedAt: now,
+		cancel:    cancel,
+	}
+	if err := writeJob(job, true); err != nil {
+		t.Fatal(err)
+	}
+	m.jobs[queryUUID] = job
+	return job, ctx
+}
+
+func TestWriteJob(t *testing.T) {
+	initAsyncQueryTest(t)
+	job := &AsyncQueryJob{QueryUUID: "q1", ORGID: "1", State: ASYNC_QUERY_STATE_PENDING}
+	if err := writeJob(job, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeJob(job, true); !errors.Is(err, os.ErrExist) {
+		t.Errorf("create existing job, got %v, want %v", err, os.ErrExist)
+	}
+	job.State = ASYNC_QUERY_STATE_RUNNING
+	if err := writeJob(job, false); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := readJob("q1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.State != ASYNC_QUERY_STATE_RUNNING || stored.ORGID != "1" {
+		t.Errorf("read job got %+v", stored)
+	}
+}
+
+func TestGetAsyncQuery(t *testing.T) {
+	m := initAsyncQueryTest(t)
+	newLocalJob(t, m, "q1")
+	getQueryProgress = func(string) (uint64, uint64, error) { return 10, 100, nil }
+
+	job, err := GetAsyncQuery("q1", "1", "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.State != ASYNC_QUERY_STATE_RUNNING || job.ReadRows != 10 || job.TotalRows != 100 {
+		t.Errorf("get running job got %+v", job)
+	}
+	if _, err := GetAsyncQuery("q1", "2", "u1"); err == nil {
+		t.Error("get job of another org should fail")
+	}
+	if _, err := GetAsyncQuery("q1", "1", "u2"); err == nil {
+		t.Error("get job of another user should fail")
+	}
+	if _, err := GetAsyncQuery("q2", "1", "u1"); err == nil {
+		t.Error("get not existing job should fail")
+	}
+
+	// 执行查询的 querier 已退出，心跳超时
+	orphan := &AsyncQueryJob{QueryUUID: "q3", ORGID: "1", UserID: "u1", State: ASYNC_QUERY_STATE_RUNNING, UpdatedAt: time.Now().Add(-time.Minute)}
+	if err := writeJob(orphan, true); err != nil {
+		t.Fatal(err)
+	}
+	job, err = GetAsyncQuery("q3", "1", "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.State != ASYNC_QUERY_STATE_FAILED {
+		t.Errorf("get orphaned job state got %s, want %s", job.State, ASYNC_QUERY_STATE_FAILED)
+	}
+}
+
+func TestCancelAsyncQuery(t *testing.T) {
+	m := initAsyncQueryTest(t)
+	job, ctx := newLocalJob(t, m, "q1")
+	killed := ""
+	killQuery = func(queryUUID string) error {
+		killed = queryUUID
+		return nil
+	}
+
+	if _, err := CancelAsyncQuery("q1", "1", "u2"); err == nil || ctx.Err() != nil {
+		t.Error("cancel job of another user should fail")
+	}
+	cancelled, err := CancelAsyncQuery("q1", "1", "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.State != ASYNC_QUERY_STATE_CANCELLED || killed != "q1" || ctx.Err() == nil {
+		t.Errorf("cancel job got %+v, killed %q, ctx err %v", cancelled, killed, ctx.Err())
+	}
+	// ClickHouse 查询被终止后返回错误，仍保留取消状态
+	m.finish(job, ASYNC_QUERY_STATE_FAILED, errors.New("query was cancelled"))
+	stored, err := readJob("q1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.State != ASYNC_QUERY_STATE_CANCELLED || stored.Error != "" {
+		t.Errorf("finish cancelled job got %+v", stored)
+	}
+	if _, err := CancelAsyncQuery("q1", "1", "u1"); err == nil {
+		t.Error("cancel finished job should fail")
+	}
+}
+
+func TestCancelByOtherQuerier(t *testing.T) {
+	m := initAsyncQueryTest(t)
+	job, ctx := newLocalJob(t, m, "q1")
+	// 其他 querier 只能修改共享目录中的状态
+	stored := job.copy()
+	stored.State = ASYNC_QUERY_STATE_CANCELLED
+	stored.FinishedAt = time.Now()
+	if err := writeJob(stored, false); err != nil {
+		t.Fatal(err)
+	}
+
+	m.mutex.Lock()
+	m.save(job)
+	m.mutex.Unlock()
+	if job.State != ASYNC_QUERY_STATE_CANCELLED || ctx.Err() == nil {
+		t.Errorf("heartbeat after cancel got state %s, ctx err %v", job.State, ctx.Err())
+	}
+}
+
+func TestOpenAsyncQueryResult(t *testing.T) {
+	m := initAsyncQueryTest(t)
+	job, _ := newLocalJob(t, m, "q1")
+	if _, _, err := OpenAsyncQueryResult("q1", "1", "u1"); err == nil {
+		t.Error("open result of running job should fail")
+	}
+	if err := os.WriteFile(resultPath(job), []byte("a\n1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m.finish(job, ASYNC_QUERY_STATE_FINISHED, nil)
+
+	if _, _, err := OpenAsyncQueryResult("q1", "1", "u2"); err == nil {
+		t.Error("open result of another user should fail")
+	}
+	file, finished, err := OpenAsyncQueryResult("q1", "1", "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	data, _ := io.ReadAll(file)
+	if finished.State != ASYNC_QUERY_STATE_FINISHED || string(data) != "a\n1\n" {
+		t.Errorf("open result got %+v, %q", finished, data)
+	}
+}
+
+func TestCleanExpired(t *testing.T) {
+	m := initAsyncQueryTest(t)
+	now := time.Now()
+	jobs := []*AsyncQueryJob{
+		{QueryUUID: "expired", Format: "csv", State: ASYNC_QUERY_STATE_FINISHED, FinishedAt: now.Add(-2 * time.Hour)},
+		{QueryUUID: "orphaned", Format: "csv", State: ASYNC_QUERY_STATE_RUNNING, UpdatedAt: now.Add(-2 * time.Hour)},
+		{QueryUUID: "finished", Format: "csv", State: ASYNC_QUERY_STATE_FINISHED, FinishedAt: now},
+		{QueryUUID: "running", Format: "csv", State: ASYNC_QUERY_STATE_RUNNING, UpdatedAt: now},
+	}
+	for _, job := range jobs {
+		if err := writeJob(job, true); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(resultPath(job), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.cleanExpired()
+	for _, job := range jobs {
+		_, jobErr := os.Stat(jobPath(job.QueryUUID))
+		_, resultErr := os.Stat(resultPath(job))
+		removed := job.QueryUUID == "expired" || job.QueryUUID == "orphaned"
+		if removed != (jobErr != nil) || removed != (resultErr != nil) {
+			t.Errorf("clean %s got job err %v, result err %v", job.QueryUUID, jobErr, resultErr)
+		}
+	}
+}
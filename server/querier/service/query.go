@@ -20,9 +20,15 @@ import (
 	"github.com/deepflowio/deepflow/server/querier/common"
 	"github.com/deepflowio/deepflow/server/querier/engine"
 	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse"
+	"github.com/deepflowio/deepflow/server/querier/quota"
 )
 
 func Execute(args *common.QuerierParams) (jsonData map[string]interface{}, debug map[string]interface{}, err error) {
+	release, err := quota.Acquire(args.ORGID, args.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
 	db := getDbBy()
 	var engine engine.Engine
 	switch db {
@@ -42,6 +48,11 @@ func getDbBy() string {
 }
 
 func SimpleExecute(args *common.QuerierParams) (jsonData map[string]interface{}, debug map[string]interface{}, err error) {
+	release, err := quota.Acquire(args.ORGID, args.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
 	result, debug, err := clickhouse.SimpleExecute(args)
 	if result != nil {
 		jsonData = result.ToJson()
@@ -33,12 +33,12 @@ type ClickhouseCounter struct {
 	ColumnCount  uint64 `statsd:"column_count"`
 	QueryTime    uint64
 	QueryTimeSum uint64
-	QueryTimeAvg uint64 `statsd:"query_time_avg"`
-	QueryTimeMax uint64 `statsd:"query_time_max"`
+	QueryTimeAvg uint64 `statsd:"query_time_avg,gauge"`
+	QueryTimeMax uint64 `statsd:"query_time_max,gauge"`
 	ApiTime      uint64
 	ApiTimeSum   uint64
-	ApiTimeAvg   uint64 `statsd:"api_time_avg"`
-	ApiTimeMax   uint64 `statsd:"api_time_max"`
+	ApiTimeAvg   uint64 `statsd:"api_time_avg,gauge"`
+	ApiTimeMax   uint64 `statsd:"api_time_max,gauge"`
 	ApiCount     uint64 `statsd:"api_count"`
 }
 
@@ -110,8 +110,8 @@ var QuerierCounter *Counter
 type ApiStats struct {
 	ApiTime    uint64
 	ApiTimeSum uint64
-	ApiTimeAvg uint64 `statsd:"api_time_avg"`
-	ApiTimeMax uint64 `statsd:"api_time_max"`
+	ApiTimeAvg uint64 `statsd:"api_time_avg,gauge"`
+	ApiTimeMax uint64 `statsd:"api_time_max,gauge"`
 	ApiCount   uint64 `statsd:"api_count"`
 }
 
@@ -80,12 +80,16 @@ func L7TracingRequest(args *common.TempoParams) (map[string]interface{}, error)
 	url := fmt.Sprintf("http://%s:%s/v1/stats/querier/L7FlowTracing", config.Cfg.DeepflowApp.Host, config.Cfg.DeepflowApp.Port)
 	l7Body := map[string]interface{}{
 		"trace_id":       args.TraceId,
-		"time_start":     args.StartTime,
-		"time_end":       args.EndTime,
 		"database":       "flow_log",
 		"table":          "l7_flow_log",
 		"has_attributes": 1,
 	}
+	if args.StartTime != 0 {
+		l7Body["time_start"] = args.StartTime
+	}
+	if args.EndTime != 0 {
+		l7Body["time_end"] = args.EndTime
+	}
 	jsonBytes, _ := json.Marshal(l7Body)
 	payload := strings.NewReader(string(jsonBytes))
 	client := &http.Client{}
@@ -94,6 +98,9 @@ func L7TracingRequest(args *common.TempoParams) (map[string]interface{}, error)
 		return nil, err
 	}
 	reqest.Header.Add("Content-Type", "application/json")
+	if args.OrgID != "" {
+		reqest.Header.Add(common.HEADER_KEY_X_ORG_ID, args.OrgID)
+	}
 	response, err := client.Do(reqest)
 	if err != nil {
 		return nil, err
@@ -349,7 +356,36 @@ func ShowTagValues(args *common.TempoParams) (resp map[string][]interface{}, deb
 	return resp, debug, err
 }
 
+// searchFilters 时间范围及minDuration/maxDuration对应的过滤条件
+func searchFilters(args *common.TempoParams) ([]string, error) {
+	filters := []string{"trace_id != ''"}
+	if args.StartTime != 0 {
+		filters = append(filters, fmt.Sprintf("time>=%d", args.StartTime))
+	}
+	if args.EndTime != 0 {
+		filters = append(filters, fmt.Sprintf("time<=%d", args.EndTime))
+	}
+	if args.MinDuration != "" {
+		minDuration, err := time.ParseDuration(args.MinDuration)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, fmt.Sprintf("response_duration>=%s", strconv.FormatInt(minDuration.Microseconds(), 10)))
+	}
+	if args.MaxDuration != "" {
+		MaxDuration, err := time.ParseDuration(args.MaxDuration)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, fmt.Sprintf("response_duration<=%s", strconv.FormatInt(MaxDuration.Microseconds(), 10)))
+	}
+	return filters, nil
+}
+
 func TraceSearch(args *common.TempoParams) (resp map[string]interface{}, debug map[string]interface{}, err error) {
+	if args.Query != "" {
+		return TraceQLSearch(args)
+	}
 	resp = map[string]interface{}{
 		"metrics": map[string]interface{}{
 			/* 			"inspectedBlocks": 1,
@@ -360,12 +396,9 @@ func TraceSearch(args *common.TempoParams) (resp map[string]interface{}, debug m
 		"traces": []map[string]interface{}{},
 	}
 	sql := fmt.Sprintf("select %s from %s", strings.Join(SEARCH_FIELDS, ", "), TABLE_NAME_L7_FLOW_LOG)
-	filters := []string{"trace_id != ''"}
-	if args.StartTime != "" {
-		filters = append(filters, fmt.Sprintf("time>=%s", args.StartTime))
-	}
-	if args.EndTime != "" {
-		filters = append(filters, fmt.Sprintf("time<=%s", args.EndTime))
+	filters, err := searchFilters(args)
+	if err != nil {
+		return nil, nil, err
 	}
 	for _, kv := range args.Filters {
 		key := kv.Key
@@ -374,20 +407,6 @@ func TraceSearch(args *common.TempoParams) (resp map[string]interface{}, debug m
 		}
 		filters = append(filters, fmt.Sprintf("%s='%s'", key, kv.Value))
 	}
-	if args.MinDuration != "" {
-		minDuration, err := time.ParseDuration(args.MinDuration)
-		if err != nil {
-			return nil, nil, err
-		}
-		filters = append(filters, fmt.Sprintf("response_duration>=%s", strconv.FormatInt(minDuration.Microseconds(), 10)))
-	}
-	if args.MaxDuration != "" {
-		MaxDuration, err := time.ParseDuration(args.MaxDuration)
-		if err != nil {
-			return nil, nil, err
-		}
-		filters = append(filters, fmt.Sprintf("response_duration<=%s", strconv.FormatInt(MaxDuration.Microseconds(), 10)))
-	}
 	if filters != nil {
 		where := strings.Join(filters, " AND ")
 		sql = fmt.Sprintf("%s WHERE %s", sql, where)
@@ -0,0 +1,685 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tempo
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deepflowio/deepflow/server/querier/common"
+)
+
+// TraceQL语法参考 https://grafana.com/docs/tempo/latest/traceql/
+// 支持的子集：
+//   - spanset过滤：{ span.x = "a" && (resource.y =~ "b.*" || duration > 100ms) }
+//   - spanset之间的结构运算：&& || > >> ~
+//   - 聚合管道：{ ... } | count() > 3、| avg(duration) > 1s，以及min/max/sum
+
+const (
+	traceQLTokenEOF = iota
+	traceQLTokenIdent
+	traceQLTokenString
+	traceQLTokenNumber
+	traceQLTokenDuration
+	traceQLTokenOp
+)
+
+type traceQLToken struct {
+	typ   int
+	value string
+	pos   int
+}
+
+// 按长度降序排列，保证优先匹配双字符运算符
+var TRACEQL_OPERATORS = []string{
+	"&&", "||", "!=", ">=", "<=", "=~", "!~", ">>",
+	"{", "}", "(", ")", "|", "!", "=", ">", "<", "~",
+}
+
+func isTraceQLIdentStart(c byte) bool {
+	return c == '.' || c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isTraceQLIdentChar(c byte) bool {
+	return isTraceQLIdentStart(c) || c == ':' || c == '-' || c == '/' || (c >= '0' && c <= '9')
+}
+
+func isTraceQLDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func lexTraceQL(query string) ([]traceQLToken, error) {
+	tokens := []traceQLToken{}
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(query) && query[j] != c; j++ {
+				if c == '"' && query[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(query) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			value := query[i+1 : j]
+			if c == '"' {
+				unquoted, err := strconv.Unquote(query[i : j+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid string %s at position %d", query[i:j+1], i)
+				}
+				value = unquoted
+			}
+			tokens = append(tokens, traceQLToken{typ: traceQLTokenString, value: value, pos: i})
+			i = j + 1
+		case isTraceQLDigit(c) || (c == '-' && i+1 < len(query) && isTraceQLDigit(query[i+1])):
+			j := i + 1
+			for ; j < len(query) && (isTraceQLDigit(query[j]) || query[j] == '.'); j++ {
+			}
+			k := j
+			for ; k < len(query) && ((query[k] >= 'a' && query[k] <= 'z') || strings.HasPrefix(query[k:], "µ")); k++ {
+			}
+			if k > j {
+				if _, err := time.ParseDuration(query[i:k]); err != nil {
+					return nil, fmt.Errorf("invalid duration %s at position %d", query[i:k], i)
+				}
+				tokens = append(tokens, traceQLToken{typ: traceQLTokenDuration, value: query[i:k], pos: i})
+			} else {
+				if _, err := strconv.ParseFloat(query[i:j], 64); err != nil {
+					return nil, fmt.Errorf("invalid number %s at position %d", query[i:j], i)
+				}
+				tokens = append(tokens, traceQLToken{typ: traceQLTokenNumber, value: query[i:j], pos: i})
+			}
+			i = k
+		case isTraceQLIdentStart(c):
+			j := i + 1
+			for ; j < len(query) && isTraceQLIdentChar(query[j]); j++ {
+			}
+			tokens = append(tokens, traceQLToken{typ: traceQLTokenIdent, value: query[i:j], pos: i})
+			i = j
+		default:
+			matched := false
+			for _, op := range TRACEQL_OPERATORS {
+				if strings.HasPrefix(query[i:], op) {
+					tokens = append(tokens, traceQLToken{typ: traceQLTokenOp, value: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+		}
+	}
+	tokens = append(tokens, traceQLToken{typ: traceQLTokenEOF, pos: len(query)})
+	return tokens, nil
+}
+
+// TraceQLQuery spanset表达式及其后的聚合过滤管道
+type TraceQLQuery struct {
+	Spanset    TraceQLSpanset
+	Aggregates []*TraceQLAggregate
+}
+
+type TraceQLSpanset interface {
+	isSpanset()
+}
+
+// SpansetFilter {}中的过滤条件，Condition为nil时匹配所有span
+type SpansetFilter struct {
+	Condition TraceQLCondition
+}
+
+// SpansetOperation 两个spanset之间的运算
+// &&/||：trace同时/任一满足两侧条件
+// >/>>/~：右侧span是左侧span的子节点/后代节点/兄弟节点
+type SpansetOperation struct {
+	Op  string
+	LHS TraceQLSpanset
+	RHS TraceQLSpanset
+}
+
+func (s *SpansetFilter) isSpanset()    {}
+func (s *SpansetOperation) isSpanset() {}
+
+type TraceQLCondition interface {
+	ToSQL() (string, error)
+}
+
+type FieldCondition struct {
+	Attribute string
+	Op        string
+	Value     TraceQLValue
+}
+
+type BinaryCondition struct {
+	Op  string
+	LHS TraceQLCondition
+	RHS TraceQLCondition
+}
+
+type NotCondition struct {
+	Condition TraceQLCondition
+}
+
+type TraceQLValue struct {
+	Type  int
+	Value string
+}
+
+// TraceQLAggregate 聚合管道，例如count() > 3、avg(duration) > 1s
+type TraceQLAggregate struct {
+	Func      string
+	Attribute string
+	Op        string
+	Value     TraceQLValue
+}
+
+var TRACEQL_COMPARISON_OPERATORS = []string{"=", "!=", ">", ">=", "<", "<=", "=~", "!~"}
+var TRACEQL_AGGREGATE_FUNCS = []string{"count", "avg", "min", "max", "sum"}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+type traceQLParser struct {
+	tokens []traceQLToken
+	pos    int
+}
+
+func (p *traceQLParser) peek() traceQLToken {
+	return p.tokens[p.pos]
+}
+
+func (p *traceQLParser) next() traceQLToken {
+	t := p.tokens[p.pos]
+	if t.typ != traceQLTokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *traceQLParser) isOp(ops ...string) bool {
+	t := p.peek()
+	return t.typ == traceQLTokenOp && containsString(ops, t.value)
+}
+
+func (p *traceQLParser) expect(op string) error {
+	t := p.next()
+	if t.typ != traceQLTokenOp || t.value != op {
+		return p.errorf(t, "expected %s", op)
+	}
+	return nil
+}
+
+func (p *traceQLParser) errorf(t traceQLToken, format string, a ...interface{}) error {
+	found := t.value
+	if t.typ == traceQLTokenEOF {
+		found = "end of query"
+	}
+	return fmt.Errorf("%s at position %d, found %s", fmt.Sprintf(format, a...), t.pos, found)
+}
+
+func ParseTraceQL(query string) (*TraceQLQuery, error) {
+	tokens, err := lexTraceQL(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &traceQLParser{tokens: tokens}
+	spanset, err := p.parseSpansetOr()
+	if err != nil {
+		return nil, err
+	}
+	q := &TraceQLQuery{Spanset: spanset}
+	for p.isOp("|") {
+		p.next()
+		aggregate, err := p.parseAggregate()
+		if err != nil {
+			return nil, err
+		}
+		q.Aggregates = append(q.Aggregates, aggregate)
+	}
+	if t := p.peek(); t.typ != traceQLTokenEOF {
+		return nil, p.errorf(t, "unexpected token")
+	}
+	return q, nil
+}
+
+// 优先级：|| < && < 结构运算(> >> ~)
+func (p *traceQLParser) parseSpansetOr() (TraceQLSpanset, error) {
+	lhs, err := p.parseSpansetAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		p.next()
+		rhs, err := p.parseSpansetAnd()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &SpansetOperation{Op: "||", LHS: lhs, RHS: rhs}
+	}
+	return lhs, nil
+}
+
+func (p *traceQLParser) parseSpansetAnd() (TraceQLSpanset, error) {
+	lhs, err := p.parseSpansetStructural()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		p.next()
+		rhs, err := p.parseSpansetStructural()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &SpansetOperation{Op: "&&", LHS: lhs, RHS: rhs}
+	}
+	return lhs, nil
+}
+
+func (p *traceQLParser) parseSpansetStructural() (TraceQLSpanset, error) {
+	lhs, err := p.parseSpansetPrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp(">", ">>", "~") {
+		op := p.next().value
+		rhs, err := p.parseSpansetPrimary()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &SpansetOperation{Op: op, LHS: lhs, RHS: rhs}
+	}
+	return lhs, nil
+}
+
+func (p *traceQLParser) parseSpansetPrimary() (TraceQLSpanset, error) {
+	if p.isOp("(") {
+		p.next()
+		spanset, err := p.parseSpansetOr()
+		if err != nil {
+			return nil, err
+		}
+		return spanset, p.expect(")")
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	filter := &SpansetFilter{}
+	if p.isOp("}") {
+		p.next()
+		return filter, nil
+	}
+	condition, err := p.parseConditionOr()
+	if err != nil {
+		return nil, err
+	}
+	filter.Condition = condition
+	return filter, p.expect("}")
+}
+
+func (p *traceQLParser) parseConditionOr() (TraceQLCondition, error) {
+	lhs, err := p.parseConditionAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		p.next()
+		rhs, err := p.parseConditionAnd()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryCondition{Op: "||", LHS: lhs, RHS: rhs}
+	}
+	return lhs, nil
+}
+
+func (p *traceQLParser) parseConditionAnd() (TraceQLCondition, error) {
+	lhs, err := p.parseConditionUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		p.next()
+		rhs, err := p.parseConditionUnary()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryCondition{Op: "&&", LHS: lhs, RHS: rhs}
+	}
+	return lhs, nil
+}
+
+func (p *traceQLParser) parseConditionUnary() (TraceQLCondition, error) {
+	if p.isOp("!") {
+		p.next()
+		condition, err := p.parseConditionUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotCondition{Condition: condition}, nil
+	}
+	if p.isOp("(") {
+		p.next()
+		condition, err := p.parseConditionOr()
+		if err != nil {
+			return nil, err
+		}
+		return condition, p.expect(")")
+	}
+	t := p.next()
+	if t.typ != traceQLTokenIdent {
+		return nil, p.errorf(t, "expected attribute")
+	}
+	op := p.next()
+	if op.typ != traceQLTokenOp || !containsString(TRACEQL_COMPARISON_OPERATORS, op.value) {
+		return nil, p.errorf(op, "expected comparison operator")
+	}
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return &FieldCondition{Attribute: t.value, Op: op.value, Value: value}, nil
+}
+
+func (p *traceQLParser) parseValue() (TraceQLValue, error) {
+	t := p.next()
+	switch t.typ {
+	case traceQLTokenString, traceQLTokenNumber, traceQLTokenDuration, traceQLTokenIdent:
+		return TraceQLValue{Type: t.typ, Value: t.value}, nil
+	}
+	return TraceQLValue{}, p.errorf(t, "expected value")
+}
+
+func (p *traceQLParser) parseAggregate() (*TraceQLAggregate, error) {
+	t := p.next()
+	if t.typ != traceQLTokenIdent || !containsString(TRACEQL_AGGREGATE_FUNCS, t.value) {
+		return nil, p.errorf(t, "expected aggregate function %s", strings.Join(TRACEQL_AGGREGATE_FUNCS, "/"))
+	}
+	aggregate := &TraceQLAggregate{Func: t.value}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	if aggregate.Func != "count" {
+		attr := p.next()
+		if attr.typ != traceQLTokenIdent {
+			return nil, p.errorf(attr, "expected attribute")
+		}
+		aggregate.Attribute = attr.value
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	op := p.next()
+	if op.typ != traceQLTokenOp || !containsString(TRACEQL_COMPARISON_OPERATORS[:6], op.value) {
+		return nil, p.errorf(op, "expected comparison operator")
+	}
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	if value.Type != traceQLTokenNumber && value.Type != traceQLTokenDuration {
+		return nil, fmt.Errorf("aggregate %s() must be compared with a number or duration", aggregate.Func)
+	}
+	aggregate.Op = op.value
+	aggregate.Value = value
+	return aggregate, nil
+}
+
+const (
+	traceQLFieldString = iota
+	traceQLFieldInt
+	traceQLFieldDuration
+	traceQLFieldStatus
+	traceQLFieldKind
+)
+
+// TraceQLField TraceQL属性对应的l7_flow_log字段
+type TraceQLField struct {
+	Column string
+	Type   int
+}
+
+func (f TraceQLField) SQLColumn() string {
+	if strings.HasPrefix(f.Column, "attribute.") {
+		return fmt.Sprintf("`%s`", f.Column)
+	}
+	return f.Column
+}
+
+var TRACEQL_INTRINSICS_MAP = map[string]TraceQLField{
+	"name":     {Column: L7_TRACING_ENDPOINT, Type: traceQLFieldString},
+	"duration": {Column: "response_duration", Type: traceQLFieldDuration},
+	"status":   {Column: "response_status", Type: traceQLFieldStatus},
+	"kind":     {Column: "span_kind", Type: traceQLFieldKind},
+}
+
+// 属性名不带scope前缀
+var TRACEQL_SPAN_ATTRS_MAP = map[string]TraceQLField{
+	"http.method":               {Column: "request_type", Type: traceQLFieldString},
+	"http.request.method":       {Column: "request_type", Type: traceQLFieldString},
+	"http.status_code":          {Column: "response_code", Type: traceQLFieldInt},
+	"http.response.status_code": {Column: "response_code", Type: traceQLFieldInt},
+}
+
+var TRACEQL_RESOURCE_ATTRS_MAP = map[string]TraceQLField{
+	"service.name":        {Column: L7_FLOW_LOG_SERVICE_NAME, Type: traceQLFieldString},
+	"service.instance.id": {Column: "app_instance", Type: traceQLFieldString},
+}
+
+// status=error同时包含服务端异常和客户端异常
+var TRACEQL_STATUS_MAP = map[string][]int{
+	"ok":    {0},
+	"error": {3, 4},
+	"unset": {5},
+}
+
+var TRACEQL_KIND_MAP = map[string]int{
+	"unspecified": 0,
+	"internal":    1,
+	"server":      2,
+	"client":      3,
+	"producer":    4,
+	"consumer":    5,
+}
+
+// ResolveTraceQLAttribute 解析span.x、resource.x、.x以及内置属性
+// 未在映射表中的属性统一查询attribute.x
+func ResolveTraceQLAttribute(attribute string) (TraceQLField, error) {
+	name := strings.TrimPrefix(attribute, "span:")
+	if field, ok := TRACEQL_INTRINSICS_MAP[name]; ok {
+		return field, nil
+	}
+	var key string
+	switch {
+	case strings.HasPrefix(attribute, "span."):
+		key = strings.TrimPrefix(attribute, "span.")
+		if field, ok := TRACEQL_SPAN_ATTRS_MAP[key]; ok {
+			return field, nil
+		}
+	case strings.HasPrefix(attribute, "resource."):
+		key = strings.TrimPrefix(attribute, "resource.")
+		if field, ok := TRACEQL_RESOURCE_ATTRS_MAP[key]; ok {
+			return field, nil
+		}
+	case strings.HasPrefix(attribute, "."):
+		key = strings.TrimPrefix(attribute, ".")
+		if field, ok := TRACEQL_SPAN_ATTRS_MAP[key]; ok {
+			return field, nil
+		}
+		if field, ok := TRACEQL_RESOURCE_ATTRS_MAP[key]; ok {
+			return field, nil
+		}
+	default:
+		return TraceQLField{}, fmt.Errorf("unknown attribute %s, attributes must be scoped by span., resource. or .", attribute)
+	}
+	if key == "" {
+		return TraceQLField{}, fmt.Errorf("invalid attribute %s", attribute)
+	}
+	return TraceQLField{Column: "attribute." + key, Type: traceQLFieldString}, nil
+}
+
+// NewTraceQLEqualCondition 属性等于value的过滤条件，供其他查询接口复用TraceQL的属性映射
+func NewTraceQLEqualCondition(attribute, value string) *FieldCondition {
+	condition := &FieldCondition{Attribute: attribute, Op: "=", Value: TraceQLValue{Type: traceQLTokenString, Value: value}}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		condition.Value.Type = traceQLTokenNumber
+	} else if field, err := ResolveTraceQLAttribute(attribute); err == nil && (field.Type == traceQLFieldStatus || field.Type == traceQLFieldKind) {
+		condition.Value.Type = traceQLTokenIdent
+	}
+	return condition
+}
+
+func parseTraceQLDuration(value TraceQLValue) (int64, error) {
+	if value.Type != traceQLTokenDuration {
+		return 0, fmt.Errorf("%s is not a duration", value.Value)
+	}
+	d, err := time.ParseDuration(value.Value)
+	if err != nil {
+		return 0, err
+	}
+	return d.Microseconds(), nil
+}
+
+func (c *FieldCondition) ToSQL() (string, error) {
+	field, err := ResolveTraceQLAttribute(c.Attribute)
+	if err != nil {
+		return "", err
+	}
+	column := field.SQLColumn()
+	isRegex := c.Op == "=~" || c.Op == "!~"
+	isEqual := c.Op == "=" || c.Op == "!="
+	switch field.Type {
+	case traceQLFieldDuration:
+		if isRegex {
+			return "", fmt.Errorf("operator %s is not supported by %s", c.Op, c.Attribute)
+		}
+		us, err := parseTraceQLDuration(c.Value)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s%s%d", column, c.Op, us), nil
+	case traceQLFieldStatus:
+		codes, ok := TRACEQL_STATUS_MAP[c.Value.Value]
+		if c.Value.Type != traceQLTokenIdent || !ok {
+			return "", fmt.Errorf("invalid status %s, should be ok, error or unset", c.Value.Value)
+		}
+		if !isEqual {
+			return "", fmt.Errorf("operator %s is not supported by %s", c.Op, c.Attribute)
+		}
+		codeStrs := make([]string, 0, len(codes))
+		for _, code := range codes {
+			codeStrs = append(codeStrs, strconv.Itoa(code))
+		}
+		op := "IN"
+		if c.Op == "!=" {
+			op = "NOT IN"
+		}
+		return fmt.Sprintf("%s %s (%s)", column, op, strings.Join(codeStrs, ",")), nil
+	case traceQLFieldKind:
+		kind, ok := TRACEQL_KIND_MAP[c.Value.Value]
+		if c.Value.Type != traceQLTokenIdent || !ok {
+			return "", fmt.Errorf("invalid kind %s", c.Value.Value)
+		}
+		if !isEqual {
+			return "", fmt.Errorf("operator %s is not supported by %s", c.Op, c.Attribute)
+		}
+		return fmt.Sprintf("%s%s%d", column, c.Op, kind), nil
+	case traceQLFieldInt:
+		if isRegex || c.Value.Type != traceQLTokenNumber {
+			return "", fmt.Errorf("%s should be compared with a number", c.Attribute)
+		}
+		return fmt.Sprintf("%s%s%s", column, c.Op, c.Value.Value), nil
+	}
+	// attribute中的值均为字符串，不支持大小比较
+	if !isEqual && !isRegex {
+		return "", fmt.Errorf("operator %s is not supported by string attribute %s", c.Op, c.Attribute)
+	}
+	switch c.Op {
+	case "=~":
+		return fmt.Sprintf("%s regexp %s", column, common.QuoteString(c.Value.Value)), nil
+	case "!~":
+		return fmt.Sprintf("%s not regexp %s", column, common.QuoteString(c.Value.Value)), nil
+	}
+	return fmt.Sprintf("%s%s%s", column, c.Op, common.QuoteString(c.Value.Value)), nil
+}
+
+func (c *BinaryCondition) ToSQL() (string, error) {
+	lhs, err := c.LHS.ToSQL()
+	if err != nil {
+		return "", err
+	}
+	rhs, err := c.RHS.ToSQL()
+	if err != nil {
+		return "", err
+	}
+	op := "AND"
+	if c.Op == "||" {
+		op = "OR"
+	}
+	return fmt.Sprintf("(%s %s %s)", lhs, op, rhs), nil
+}
+
+func (c *NotCondition) ToSQL() (string, error) {
+	condition, err := c.Condition.ToSQL()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("not(%s)", condition), nil
+}
+
+// ToSQL 生成spanset过滤对应的where条件，{}返回空字符串
+func (s *SpansetFilter) ToSQL() (string, error) {
+	if s.Condition == nil {
+		return "", nil
+	}
+	return s.Condition.ToSQL()
+}
+
+// 聚合的属性只支持数值类型的字段
+func (a *TraceQLAggregate) compareValue() (float64, error) {
+	if a.Func != "count" {
+		field, err := ResolveTraceQLAttribute(a.Attribute)
+		if err != nil {
+			return 0, err
+		}
+		if field.Type == traceQLFieldDuration {
+			us, err := parseTraceQLDuration(a.Value)
+			return float64(us), err
+		}
+		if field.Type != traceQLFieldInt {
+			return 0, fmt.Errorf("aggregate %s() is not supported by %s", a.Func, a.Attribute)
+		}
+	}
+	if a.Value.Type != traceQLTokenNumber {
+		return 0, errors.New("aggregate should be compared with a number")
+	}
+	return strconv.ParseFloat(a.Value.Value, 64)
+}
@@ -0,0 +1,636 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tempo
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/deepflowio/deepflow/server/querier/common"
+	"github.com/deepflowio/deepflow/server/querier/engine/clickhouse"
+)
+
+const (
+	// 每次spanset过滤最多查询的span数量，超过时返回错误，避免结构运算和聚合基于不完整的span计算
+	TRACEQL_SPAN_LIMIT                 = 10000
+	TRACEQL_DEFAULT_LIMIT              = 20
+	TRACEQL_DEFAULT_SPANS_PER_SPAN_SET = 3
+)
+
+var TRACEQL_SEARCH_FIELDS = []string{
+	"trace_id", "span_id", "parent_span_id", "app_service", "endpoint",
+	"toUnixTimestamp64Micro(start_time) as startTimeUs", "response_duration", "response_code",
+}
+
+var TRACEQL_INTRINSICS = []string{"duration", "kind", "name", "status"}
+
+type traceQLSpan struct {
+	traceID      string
+	spanID       string
+	parentSpanID string
+	serviceName  string
+	name         string
+	startTimeUs  int64
+	durationUs   float64
+	responseCode float64
+}
+
+func (s *traceQLSpan) key() string {
+	return fmt.Sprintf("%s-%d-%s", s.spanID, s.startTimeUs, s.name)
+}
+
+func (s *traceQLSpan) value(column string) float64 {
+	if column == "response_code" {
+		return s.responseCode
+	}
+	return s.durationUs
+}
+
+// trace_id -> 匹配的span
+type traceQLSpansets map[string][]*traceQLSpan
+
+type traceQLQueryFunc func(sql string) (*common.Result, map[string]interface{}, error)
+
+func newTraceQLQueryFunc(args *common.TempoParams) traceQLQueryFunc {
+	return func(sql string) (*common.Result, map[string]interface{}, error) {
+		querierArgs := common.QuerierParams{
+			DB:         "flow_log",
+			Sql:        sql,
+			DataSource: "",
+			Debug:      args.Debug,
+			QueryUUID:  uuid.New().String(),
+			Context:    args.Context,
+		}
+		ckEngine := &clickhouse.CHEngine{DB: querierArgs.DB, DataSource: querierArgs.DataSource}
+		ckEngine.Init()
+		return ckEngine.ExecuteQuery(&querierArgs)
+	}
+}
+
+// traceQLExecutor 每个spanset过滤翻译为一条querier SQL，
+// &&和结构运算右侧的查询限定在左侧匹配的trace中，结构运算和聚合在查询结果上按trace计算
+type traceQLExecutor struct {
+	filters     []string
+	timeFilters []string
+	query       traceQLQueryFunc
+	// trace_id -> span_id -> parent_span_id，计算>>时按需查询
+	parents map[string]map[string]string
+	debug   map[string]interface{}
+}
+
+func TraceQLSearch(args *common.TempoParams) (resp map[string]interface{}, debug map[string]interface{}, err error) {
+	query, err := ParseTraceQL(args.Query)
+	if err != nil {
+		return nil, nil, err
+	}
+	filters, err := searchFilters(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	limit := TRACEQL_DEFAULT_LIMIT
+	if args.Limit != "" {
+		if limit, err = strconv.Atoi(args.Limit); err != nil {
+			return nil, nil, err
+		}
+	}
+	spansPerSpanSet := TRACEQL_DEFAULT_SPANS_PER_SPAN_SET
+	if args.SpansPerSpanSet != "" {
+		if spansPerSpanSet, err = strconv.Atoi(args.SpansPerSpanSet); err != nil {
+			return nil, nil, err
+		}
+	}
+	e := &traceQLExecutor{
+		filters: filters,
+		query:   newTraceQLQueryFunc(args),
+	}
+	if args.StartTime != 0 {
+		e.timeFilters = append(e.timeFilters, fmt.Sprintf("time>=%d", args.StartTime))
+	}
+	if args.EndTime != 0 {
+		e.timeFilters = append(e.timeFilters, fmt.Sprintf("time<=%d", args.EndTime))
+	}
+	traces, err := e.search(query, limit, spansPerSpanSet)
+	if err != nil {
+		return nil, e.debug, err
+	}
+	resp = map[string]interface{}{
+		"metrics": map[string]interface{}{},
+		"traces":  traces,
+	}
+	return resp, e.debug, nil
+}
+
+func (e *traceQLExecutor) search(query *TraceQLQuery, limit, spansPerSpanSet int) ([]map[string]interface{}, error) {
+	spansets, err := e.evalSpanset(query.Spanset, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = applyTraceQLAggregates(spansets, query.Aggregates); err != nil {
+		return nil, err
+	}
+	return buildTraceQLTraces(spansets, limit, spansPerSpanSet), nil
+}
+
+// evalSpanset traceIDs不为nil时只查询其中的trace
+func (e *traceQLExecutor) evalSpanset(spanset TraceQLSpanset, traceIDs []string) (traceQLSpansets, error) {
+	switch s := spanset.(type) {
+	case *SpansetFilter:
+		return e.fetchSpans(s, traceIDs)
+	case *SpansetOperation:
+		lhs, err := e.evalSpanset(s.LHS, traceIDs)
+		if err != nil {
+			return nil, err
+		}
+		rhsTraceIDs := traceIDs
+		if s.Op != "||" {
+			// 除||外，右侧只需要在左侧匹配的trace中查询
+			if len(lhs) == 0 {
+				return traceQLSpansets{}, nil
+			}
+			rhsTraceIDs = sortedKeys(lhs)
+		}
+		rhs, err := e.evalSpanset(s.RHS, rhsTraceIDs)
+		if err != nil {
+			return nil, err
+		}
+		return e.combine(s.Op, lhs, rhs)
+	}
+	return nil, fmt.Errorf("unknown spanset %T", spanset)
+}
+
+func quoteTraceIDs(traceIDs []string) string {
+	quoted := make([]string, 0, len(traceIDs))
+	for _, traceID := range traceIDs {
+		quoted = append(quoted, common.QuoteString(traceID))
+	}
+	return strings.Join(quoted, ",")
+}
+
+func (e *traceQLExecutor) fetchSpans(filter *SpansetFilter, traceIDs []string) (traceQLSpansets, error) {
+	condition, err := filter.ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	filters := append([]string{}, e.filters...)
+	if condition != "" {
+		filters = append(filters, fmt.Sprintf("(%s)", condition))
+	}
+	if traceIDs != nil {
+		filters = append(filters, fmt.Sprintf("trace_id IN (%s)", quoteTraceIDs(traceIDs)))
+	}
+	// 多查询一条用于判断是否超过限制
+	sql := fmt.Sprintf(
+		"select %s from %s WHERE %s ORDER BY startTimeUs desc LIMIT %d",
+		strings.Join(TRACEQL_SEARCH_FIELDS, ", "), TABLE_NAME_L7_FLOW_LOG, strings.Join(filters, " AND "), TRACEQL_SPAN_LIMIT+1,
+	)
+	result, debug, err := e.query(sql)
+	e.debug = debug
+	if err != nil {
+		log.Errorf("%v %v", debug, err)
+		return nil, err
+	}
+	if len(result.Values) > TRACEQL_SPAN_LIMIT {
+		return nil, fmt.Errorf("spanset filter %s matched more than %d spans, please narrow the time range or add more conditions", condition, TRACEQL_SPAN_LIMIT)
+	}
+	spansets := traceQLSpansets{}
+	for _, d := range result.Values {
+		value := d.([]interface{})
+		span := &traceQLSpan{
+			traceID:      traceQLString(value[0]),
+			spanID:       traceQLString(value[1]),
+			parentSpanID: traceQLString(value[2]),
+			serviceName:  traceQLString(value[3]),
+			name:         traceQLString(value[4]),
+			startTimeUs:  int64(traceQLFloat(value[5])),
+			durationUs:   traceQLFloat(value[6]),
+			responseCode: traceQLFloat(value[7]),
+		}
+		spansets[span.traceID] = append(spansets[span.traceID], span)
+	}
+	return spansets, nil
+}
+
+// fetchParents 查询trace中所有span的父子关系
+func (e *traceQLExecutor) fetchParents(traceIDs []string) error {
+	if e.parents == nil {
+		e.parents = make(map[string]map[string]string)
+	}
+	fetchIDs := []string{}
+	for _, traceID := range traceIDs {
+		if _, ok := e.parents[traceID]; !ok {
+			fetchIDs = append(fetchIDs, traceID)
+			e.parents[traceID] = make(map[string]string)
+		}
+	}
+	if len(fetchIDs) == 0 {
+		return nil
+	}
+	sort.Strings(fetchIDs)
+	filters := append([]string{}, e.timeFilters...)
+	filters = append(filters, fmt.Sprintf("trace_id IN (%s)", quoteTraceIDs(fetchIDs)), "span_id != ''")
+	sql := fmt.Sprintf(
+		"select trace_id, span_id, parent_span_id from %s WHERE %s LIMIT %d",
+		TABLE_NAME_L7_FLOW_LOG, strings.Join(filters, " AND "), TRACEQL_SPAN_LIMIT+1,
+	)
+	result, debug, err := e.query(sql)
+	e.debug = debug
+	if err != nil {
+		log.Errorf("%v %v", debug, err)
+		return err
+	}
+	if len(result.Values) > TRACEQL_SPAN_LIMIT {
+		return fmt.Errorf("the traces matched by >> have more than %d spans, please narrow the time range or add more conditions", TRACEQL_SPAN_LIMIT)
+	}
+	for _, d := range result.Values {
+		value := d.([]interface{})
+		traceID := traceQLString(value[0])
+		if _, ok := e.parents[traceID]; !ok {
+			continue
+		}
+		e.parents[traceID][traceQLString(value[1])] = traceQLString(value[2])
+	}
+	return nil
+}
+
+func (e *traceQLExecutor) combine(op string, lhs, rhs traceQLSpansets) (traceQLSpansets, error) {
+	result := traceQLSpansets{}
+	switch op {
+	case "||":
+		for traceID, spans := range lhs {
+			result[traceID] = mergeTraceQLSpans(spans, rhs[traceID])
+		}
+		for traceID, spans := range rhs {
+			if _, ok := result[traceID]; !ok {
+				result[traceID] = spans
+			}
+		}
+		return result, nil
+	case "&&":
+		for traceID, spans := range lhs {
+			if rhsSpans, ok := rhs[traceID]; ok {
+				result[traceID] = mergeTraceQLSpans(spans, rhsSpans)
+			}
+		}
+		return result, nil
+	}
+
+	traceIDs := []string{}
+	for traceID := range lhs {
+		if _, ok := rhs[traceID]; ok {
+			traceIDs = append(traceIDs, traceID)
+		}
+	}
+	if op == ">>" {
+		if err := e.fetchParents(traceIDs); err != nil {
+			return nil, err
+		}
+	}
+	for _, traceID := range traceIDs {
+		var matched []*traceQLSpan
+		switch op {
+		case ">":
+			parentIDs := map[string]bool{}
+			for _, s := range lhs[traceID] {
+				parentIDs[s.spanID] = true
+			}
+			for _, s := range rhs[traceID] {
+				if s.parentSpanID != "" && parentIDs[s.parentSpanID] {
+					matched = append(matched, s)
+				}
+			}
+		case ">>":
+			ancestorIDs := map[string]bool{}
+			for _, s := range lhs[traceID] {
+				ancestorIDs[s.spanID] = true
+			}
+			parents := e.parents[traceID]
+			for _, s := range rhs[traceID] {
+				visited := map[string]bool{}
+				for id := s.parentSpanID; id != "" && !visited[id]; id = parents[id] {
+					if ancestorIDs[id] {
+						matched = append(matched, s)
+						break
+					}
+					visited[id] = true
+				}
+			}
+		case "~":
+			// parent_span_id -> 左侧span的span_id
+			siblings := map[string]map[string]bool{}
+			for _, s := range lhs[traceID] {
+				if s.parentSpanID == "" {
+					continue
+				}
+				if _, ok := siblings[s.parentSpanID]; !ok {
+					siblings[s.parentSpanID] = map[string]bool{}
+				}
+				siblings[s.parentSpanID][s.spanID] = true
+			}
+			for _, s := range rhs[traceID] {
+				ids, ok := siblings[s.parentSpanID]
+				if ok && (len(ids) > 1 || !ids[s.spanID]) {
+					matched = append(matched, s)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unknown spanset operator %s", op)
+		}
+		if len(matched) > 0 {
+			result[traceID] = matched
+		}
+	}
+	return result, nil
+}
+
+func mergeTraceQLSpans(lhs, rhs []*traceQLSpan) []*traceQLSpan {
+	keys := map[string]bool{}
+	spans := make([]*traceQLSpan, 0, len(lhs)+len(rhs))
+	for _, s := range append(append([]*traceQLSpan{}, lhs...), rhs...) {
+		if keys[s.key()] {
+			continue
+		}
+		keys[s.key()] = true
+		spans = append(spans, s)
+	}
+	return spans
+}
+
+func applyTraceQLAggregates(spansets traceQLSpansets, aggregates []*TraceQLAggregate) error {
+	for _, a := range aggregates {
+		threshold, err := a.compareValue()
+		if err != nil {
+			return err
+		}
+		var field TraceQLField
+		if a.Func != "count" {
+			field, _ = ResolveTraceQLAttribute(a.Attribute)
+		}
+		for traceID, spans := range spansets {
+			if !compareTraceQLValue(a.aggregate(field, spans), a.Op, threshold) {
+				delete(spansets, traceID)
+			}
+		}
+	}
+	return nil
+}
+
+func (a *TraceQLAggregate) aggregate(field TraceQLField, spans []*traceQLSpan) float64 {
+	if a.Func == "count" || len(spans) == 0 {
+		return float64(len(spans))
+	}
+	result := spans[0].value(field.Column)
+	if a.Func == "sum" || a.Func == "avg" {
+		result = 0
+	}
+	for _, s := range spans {
+		v := s.value(field.Column)
+		switch a.Func {
+		case "min":
+			if v < result {
+				result = v
+			}
+		case "max":
+			if v > result {
+				result = v
+			}
+		default:
+			result += v
+		}
+	}
+	if a.Func == "avg" {
+		result /= float64(len(spans))
+	}
+	return result
+}
+
+func compareTraceQLValue(v float64, op string, threshold float64) bool {
+	switch op {
+	case "=":
+		return v == threshold
+	case "!=":
+		return v != threshold
+	case ">":
+		return v > threshold
+	case ">=":
+		return v >= threshold
+	case "<":
+		return v < threshold
+	case "<=":
+		return v <= threshold
+	}
+	return false
+}
+
+// buildTraceQLTraces 按trace开始时间倒序返回，spanSet中包含匹配的span
+func buildTraceQLTraces(spansets traceQLSpansets, limit, spansPerSpanSet int) []map[string]interface{} {
+	type traceItem struct {
+		traceID string
+		startUs int64
+		value   map[string]interface{}
+	}
+	items := make([]traceItem, 0, len(spansets))
+	for traceID, spans := range spansets {
+		if len(spans) == 0 {
+			continue
+		}
+		sort.SliceStable(spans, func(i, j int) bool {
+			return spans[i].startTimeUs < spans[j].startTimeUs
+		})
+		root := spans[0]
+		for _, s := range spans {
+			if s.parentSpanID == "" {
+				root = s
+				break
+			}
+		}
+		startUs, endUs := spans[0].startTimeUs, int64(0)
+		spanValues := []map[string]interface{}{}
+		for i, s := range spans {
+			if end := s.startTimeUs + int64(s.durationUs); end > endUs {
+				endUs = end
+			}
+			if i >= spansPerSpanSet {
+				continue
+			}
+			spanValues = append(spanValues, map[string]interface{}{
+				"spanID":            s.spanID,
+				"startTimeUnixNano": strconv.FormatInt(s.startTimeUs*1000, 10),
+				"durationNanos":     strconv.FormatInt(int64(s.durationUs)*1000, 10),
+				"attributes": []map[string]interface{}{
+					{"key": "service.name", "value": map[string]interface{}{"stringValue": s.serviceName}},
+				},
+			})
+		}
+		items = append(items, traceItem{
+			traceID: traceID,
+			startUs: startUs,
+			value: map[string]interface{}{
+				"traceID":           traceID,
+				"rootServiceName":   root.serviceName,
+				"rootTraceName":     root.name,
+				"startTimeUnixNano": strconv.FormatInt(startUs*1000, 10),
+				"durationMs":        (endUs - startUs) / 1000,
+				"spanSet": map[string]interface{}{
+					"spans":   spanValues,
+					"matched": len(spans),
+				},
+			},
+		})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].startUs != items[j].startUs {
+			return items[i].startUs > items[j].startUs
+		}
+		return items[i].traceID < items[j].traceID
+	})
+	traces := []map[string]interface{}{}
+	for i, item := range items {
+		if limit > 0 && i >= limit {
+			break
+		}
+		traces = append(traces, item.value)
+	}
+	return traces
+}
+
+func traceQLString(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+func traceQLFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case uint32:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	case float32:
+		return float64(n)
+	case float64:
+		return n
+	case string:
+		f, _ := strconv.ParseFloat(n, 64)
+		return f
+	}
+	return 0
+}
+
+// ShowTagsV2 Tempo v2接口，按span/resource/intrinsic返回可用于TraceQL的属性
+func ShowTagsV2(args *common.TempoParams) (resp map[string]interface{}, debug map[string]interface{}, err error) {
+	scope := args.Scope
+	if scope == "all" {
+		scope = ""
+	}
+	scopes := []map[string]interface{}{}
+	if scope == "" || scope == "span" {
+		result, d, err := ShowTags(args)
+		if err != nil {
+			return nil, d, err
+		}
+		debug = d
+		tagSet := map[string]bool{}
+		for k := range TRACEQL_SPAN_ATTRS_MAP {
+			tagSet[k] = true
+		}
+		for _, t := range result["tagNames"] {
+			tagSet[strings.TrimPrefix(traceQLString(t), "attribute.")] = true
+		}
+		scopes = append(scopes, map[string]interface{}{"name": "span", "tags": sortedKeys(tagSet)})
+	}
+	if scope == "" || scope == "resource" {
+		tagSet := map[string]bool{}
+		for k := range TRACEQL_RESOURCE_ATTRS_MAP {
+			tagSet[k] = true
+		}
+		scopes = append(scopes, map[string]interface{}{"name": "resource", "tags": sortedKeys(tagSet)})
+	}
+	if scope == "" || scope == "intrinsic" {
+		scopes = append(scopes, map[string]interface{}{"name": "intrinsic", "tags": TRACEQL_INTRINSICS})
+	}
+	resp = map[string]interface{}{
+		"scopes": scopes,
+	}
+	return resp, debug, nil
+}
+
+// ShowTagValuesV2 Tempo v2接口，返回带类型的属性值
+func ShowTagValuesV2(args *common.TempoParams) (resp map[string]interface{}, debug map[string]interface{}, err error) {
+	tagValues := []map[string]interface{}{}
+	switch strings.TrimPrefix(args.TagName, "span:") {
+	case "status":
+		for _, k := range sortedKeys(TRACEQL_STATUS_MAP) {
+			tagValues = append(tagValues, map[string]interface{}{"type": "keyword", "value": k})
+		}
+	case "kind":
+		kinds := sortedKeys(TRACEQL_KIND_MAP)
+		sort.SliceStable(kinds, func(i, j int) bool {
+			return TRACEQL_KIND_MAP[kinds[i]] < TRACEQL_KIND_MAP[kinds[j]]
+		})
+		for _, k := range kinds {
+			tagValues = append(tagValues, map[string]interface{}{"type": "keyword", "value": k})
+		}
+	case "duration":
+	default:
+		field, err := ResolveTraceQLAttribute(args.TagName)
+		if err != nil {
+			return nil, nil, err
+		}
+		sql := fmt.Sprintf("show tag %s values from %s", field.Column, TABLE_NAME_L7_FLOW_LOG)
+		result, d, err := newTraceQLQueryFunc(args)(sql)
+		if err != nil {
+			log.Errorf("%v %v", d, err)
+			return nil, d, err
+		}
+		debug = d
+		valueType := "string"
+		if field.Type == traceQLFieldInt {
+			valueType = "int"
+		}
+		for _, v := range result.Values {
+			value := v.([]interface{})
+			tagValues = append(tagValues, map[string]interface{}{"type": valueType, "value": traceQLString(value[0])})
+		}
+	}
+	resp = map[string]interface{}{
+		"tagValues": tagValues,
+	}
+	return resp, debug, nil
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
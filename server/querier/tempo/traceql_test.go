@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2024 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tempo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/deepflowio/deepflow/server/querier/common"
+)
+
+func TestTraceQLToSQL(t *testing.T) {
+	var cases = []struct {
+		input  string
+		output string
+	}{{
+		input:  `{}`,
+		output: ``,
+	}, {
+		input:  `{ resource.service.name = "frontend" }`,
+		output: `app_service='frontend'`,
+	}, {
+		input:  `{ span.http.method = "GET" && span.http.status_code >= 500 }`,
+		output: `(request_type='GET' AND response_code>=500)`,
+	}, {
+		input:  `{ .db.system != "mysql" || name =~ "/api/.*" }`,
+		output: "(`attribute.db.system`!='mysql' OR endpoint regexp '/api/.*')",
+	}, {
+		input:  `{ duration > 1.5s && status = error && kind = server }`,
+		output: `((response_duration>1500000 AND response_status IN (3,4)) AND span_kind=2)`,
+	}, {
+		input:  `{ !(span.peer.service !~ "it's") }`,
+		output: "not(`attribute.peer.service` not regexp 'it\\'s')",
+	}}
+	for _, c := range cases {
+		q, err := ParseTraceQL(c.input)
+		if err != nil {
+			t.Errorf("parse %s failed: %v", c.input, err)
+			continue
+		}
+		sql, err := q.Spanset.(*SpansetFilter).ToSQL()
+		if err != nil || sql != c.output {
+			t.Errorf("\nInput: %s\nExpect: %s\nActual: %s, %v", c.input, c.output, sql, err)
+		}
+	}
+}
+
+func TestTraceQLParseError(t *testing.T) {
+	for _, input := range []string{
+		`{ span.http.method = }`,
+		`{ name = "a"`,
+		`{ foo = "a" }`,
+		`{ span.foo > "a" }`,
+		`{ status = failed }`,
+		`{} | count( > 1`,
+		`{} | count() > "a"`,
+	} {
+		q, err := ParseTraceQL(input)
+		if err == nil {
+			_, err = q.Spanset.(*SpansetFilter).ToSQL()
+		}
+		if err == nil {
+			t.Errorf("%s should be invalid", input)
+		}
+	}
+}
+
+func TestTraceQLSearch(t *testing.T) {
+	// trace a: root(1) -> child(2) -> grandchild(3)，2和4是兄弟节点
+	rows := map[string][]interface{}{
+		"frontend": {
+			[]interface{}{"a", "1", "", "frontend", "GET /", int64(1000), uint64(3000), nil},
+			[]interface{}{"b", "5", "", "frontend", "GET /", int64(2000), uint64(100), nil},
+		},
+		"db": {
+			[]interface{}{"a", "3", "2", "db", "select", int64(1200), uint64(500), nil},
+			[]interface{}{"a", "4", "1", "db", "select", int64(1100), uint64(700), nil},
+		},
+		"cart": {
+			[]interface{}{"a", "2", "1", "cart", "add", int64(1100), uint64(1000), nil},
+		},
+	}
+	e := &traceQLExecutor{
+		filters: []string{"trace_id != ''"},
+		query: func(sql string) (*common.Result, map[string]interface{}, error) {
+			result := &common.Result{}
+			if strings.HasPrefix(sql, "select trace_id, span_id, parent_span_id from") {
+				for _, values := range rows {
+					for _, v := range values {
+						result.Values = append(result.Values, v.([]interface{})[:3])
+					}
+				}
+				return result, nil, nil
+			}
+			for service, values := range rows {
+				if strings.Contains(sql, "'"+service+"'") {
+					result.Values = append(result.Values, values...)
+				}
+			}
+			return result, nil, nil
+		},
+	}
+	var cases = []struct {
+		input   string
+		traces  []string
+		matched []int
+	}{
+		{`{ resource.service.name = "frontend" }`, []string{"b", "a"}, []int{1, 1}},
+		{`{ resource.service.name = "frontend" } > { resource.service.name = "db" }`, []string{"a"}, []int{1}},
+		{`{ resource.service.name = "frontend" } >> { resource.service.name = "db" }`, []string{"a"}, []int{2}},
+		{`{ resource.service.name = "cart" } ~ { resource.service.name = "db" }`, []string{"a"}, []int{1}},
+		{`{ resource.service.name = "cart" } && { resource.service.name = "db" }`, []string{"a"}, []int{3}},
+		{`{ resource.service.name = "frontend" } | count() > 1`, []string{}, []int{}},
+		{`({ resource.service.name = "frontend" } || { resource.service.name = "db" }) | avg(duration) >= 1ms`, []string{"a"}, []int{3}},
+	}
+	for _, c := range cases {
+		q, err := ParseTraceQL(c.input)
+		if err != nil {
+			t.Fatalf("parse %s failed: %v", c.input, err)
+		}
+		traces, err := e.search(q, TRACEQL_DEFAULT_LIMIT, TRACEQL_DEFAULT_SPANS_PER_SPAN_SET)
+		if err != nil {
+			t.Fatalf("search %s failed: %v", c.input, err)
+		}
+		if len(traces) != len(c.traces) {
+			t.Errorf("%s: expect traces %v, actual %v", c.input, c.traces, traces)
+			continue
+		}
+		for i, trace := range traces {
+			matched := trace["spanSet"].(map[string]interface{})["matched"].(int)
+			if trace["traceID"] != c.traces[i] || matched != c.matched[i] {
+				t.Errorf("%s: expect trace %s matched %d, actual %v", c.input, c.traces[i], c.matched[i], trace)
+			}
+		}
+	}
+}
+
+func TestTraceQLSearchTraceIDFilter(t *testing.T) {
+	var sqls []string
+	e := &traceQLExecutor{
+		query: func(sql string) (*common.Result, map[string]interface{}, error) {
+			sqls = append(sqls, sql)
+			result := &common.Result{}
+			if strings.Contains(sql, "'frontend'") {
+				result.Values = append(result.Values,
+					[]interface{}{"b", "5", "", "frontend", "GET /", int64(2000), uint64(100), nil},
+					[]interface{}{"a", "1", "", "frontend", "GET /", int64(1000), uint64(3000), nil})
+			}
+			return result, nil, nil
+		},
+	}
+	q, _ := ParseTraceQL(`{ resource.service.name = "frontend" } > { resource.service.name = "db" }`)
+	if _, err := e.search(q, TRACEQL_DEFAULT_LIMIT, TRACEQL_DEFAULT_SPANS_PER_SPAN_SET); err != nil {
+		t.Fatal(err)
+	}
+	if len(sqls) != 2 || strings.Contains(sqls[0], "trace_id IN") || !strings.Contains(sqls[1], "trace_id IN ('a','b')") {
+		t.Errorf("the right side should be queried in the traces matched by the left side: %v", sqls)
+	}
+
+	// 左侧没有匹配时不查询右侧
+	sqls = nil
+	q, _ = ParseTraceQL(`{ resource.service.name = "db" } && { resource.service.name = "frontend" }`)
+	if _, err := e.search(q, TRACEQL_DEFAULT_LIMIT, TRACEQL_DEFAULT_SPANS_PER_SPAN_SET); err != nil || len(sqls) != 1 {
+		t.Errorf("unexpected queries %v, err: %v", sqls, err)
+	}
+}
+
+func TestTraceQLSearchSpanLimit(t *testing.T) {
+	e := &traceQLExecutor{
+		query: func(sql string) (*common.Result, map[string]interface{}, error) {
+			result := &common.Result{}
+			for i := 0; i <= TRACEQL_SPAN_LIMIT; i++ {
+				result.Values = append(result.Values, []interface{}{"a", "1", "", "frontend", "GET /", int64(1000), uint64(3000), nil})
+			}
+			return result, nil, nil
+		},
+	}
+	q, _ := ParseTraceQL(`{ resource.service.name = "frontend" } | count() > 1`)
+	if _, err := e.search(q, TRACEQL_DEFAULT_LIMIT, TRACEQL_DEFAULT_SPANS_PER_SPAN_SET); err == nil || !strings.Contains(err.Error(), "more than") {
+		t.Errorf("the truncated spans should fail, err: %v", err)
+	}
+}